@@ -0,0 +1,155 @@
+// Package client provides the implementation for interacting with the WeKnora API
+// The Dataset related interfaces are used for managing the datasets evaluation tasks run against
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Dataset represents an evaluation dataset
+type Dataset struct {
+	ID            string    `json:"id"`             // Dataset unique identifier
+	TenantID      uint      `json:"tenant_id"`      // Tenant ID
+	Name          string    `json:"name"`           // Dataset name
+	Description   string    `json:"description"`    // Dataset description
+	Format        string    `json:"format"`         // Upload format: parquet, jsonl or csv
+	QuestionCount int       `json:"question_count"` // Number of QA pairs
+	PassageCount  int       `json:"passage_count"`  // Number of distinct passages
+	CreatedAt     time.Time `json:"created_at"`     // Creation time
+	UpdatedAt     time.Time `json:"updated_at"`     // Last update time
+}
+
+// CreateDatasetRequest represents a dataset upload request
+type CreateDatasetRequest struct {
+	Name        string // Dataset name, required
+	Description string // Dataset description
+	Format      string // Upload format: parquet, jsonl or csv, inferred from the files when empty
+	// Files maps form fields to local file paths
+	// parquet datasets use queries, corpus, qrels, answers and the optional qas fields,
+	// jsonl and csv datasets use the file field
+	Files map[string]string
+}
+
+// DatasetResponse represents the API response containing a single dataset
+type DatasetResponse struct {
+	Success bool    `json:"success"`
+	Data    Dataset `json:"data"`
+}
+
+// DatasetListResponse represents the API response containing a list of datasets
+type DatasetListResponse struct {
+	Success bool      `json:"success"`
+	Data    []Dataset `json:"data"`
+}
+
+// CreateDataset uploads a new evaluation dataset
+// Parameters:
+//   - ctx: Context, used for passing request context information
+//   - request: Dataset name, format and the local files to upload
+//
+// Returns:
+//   - *Dataset: Created dataset
+//   - error: Error information if the request fails
+func (c *Client) CreateDataset(ctx context.Context, request *CreateDatasetRequest) (*Dataset, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for field, filePath := range request.Files {
+		if err := writeFormFile(writer, field, filePath); err != nil {
+			return nil, err
+		}
+	}
+	for field, value := range map[string]string{
+		"name":        request.Name,
+		"description": request.Description,
+		"format":      request.Format,
+	} {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(field, value); err != nil {
+			return nil, fmt.Errorf("failed to write %s field: %w", field, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close writer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/datasets", body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if c.token != "" {
+		req.Header.Set("X-API-Key", c.token)
+	}
+	if requestID := ctx.Value("RequestID"); requestID != nil {
+		req.Header.Set("X-Request-ID", requestID.(string))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var response DatasetResponse
+	if err := parseResponse(resp, &response); err != nil {
+		return nil, err
+	}
+	return &response.Data, nil
+}
+
+// writeFormFile copies a local file into a multipart form field
+func writeFormFile(writer *multipart.Writer, field string, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	part, err := writer.CreateFormFile(field, filepath.Base(filePath))
+	if err != nil {
+		return fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return fmt.Errorf("failed to copy file content: %w", err)
+	}
+	return nil
+}
+
+// ListDatasets lists the evaluation datasets of the tenant
+func (c *Client) ListDatasets(ctx context.Context) ([]Dataset, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/datasets", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response DatasetListResponse
+	if err := parseResponse(resp, &response); err != nil {
+		return nil, err
+	}
+	return response.Data, nil
+}
+
+// DeleteDataset deletes an evaluation dataset
+func (c *Client) DeleteDataset(ctx context.Context, datasetID string) error {
+	path := fmt.Sprintf("/api/v1/datasets/%s", datasetID)
+	resp, err := c.doRequest(ctx, http.MethodDelete, path, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Success bool   `json:"success"`
+		Message string `json:"message,omitempty"`
+	}
+	return parseResponse(resp, &response)
+}
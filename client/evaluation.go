@@ -8,6 +8,8 @@ import (
 	"context"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 )
 
 // EvaluationTask represents an evaluation task
@@ -111,3 +113,138 @@ func (c *Client) GetEvaluationResult(ctx context.Context, taskID string) (*Evalu
 
 	return &response.Data, nil
 }
+
+// EvaluationRunTask represents a persisted evaluation task
+type EvaluationRunTask struct {
+	ID        string     `json:"id"`                 // Task unique identifier
+	TenantID  uint       `json:"tenant_id"`          // Tenant ID
+	DatasetID string     `json:"dataset_id"`         // Evaluation dataset ID
+	StartTime time.Time  `json:"start_time"`         // Task start time
+	EndTime   *time.Time `json:"end_time,omitempty"` // Task end time
+	Status    int        `json:"status"`             // Task status: 0 pending, 1 running, 2 success, 3 failed
+	ErrMsg    string     `json:"err_msg,omitempty"`  // Error message, has value when task fails
+	Total     int        `json:"total,omitempty"`    // Total number of questions
+	Finished  int        `json:"finished,omitempty"` // Number of evaluated questions
+	CreatedAt time.Time  `json:"created_at"`         // Task creation time
+}
+
+// EvaluationMetrics represents the metrics of an evaluation run or of a single question
+type EvaluationMetrics struct {
+	RetrievalMetrics  map[string]float64 `json:"retrieval_metrics"`  // Retrieval metrics: precision, recall, ndcg3, ...
+	GenerationMetrics map[string]float64 `json:"generation_metrics"` // Generation metrics: bleu1, rouge1, ...
+}
+
+// EvaluationRun represents an evaluation task together with its parameters and metrics
+type EvaluationRun struct {
+	Task   EvaluationRunTask      `json:"task"`             // Evaluation task
+	Params map[string]interface{} `json:"params"`           // Retrieval and generation parameters of the run
+	Metric *EvaluationMetrics     `json:"metric,omitempty"` // Aggregate metrics
+}
+
+// EvaluationRunListResponse represents the response of listing evaluation runs
+type EvaluationRunListResponse struct {
+	Success  bool            `json:"success"`
+	Data     []EvaluationRun `json:"data"`
+	Total    int64           `json:"total"`
+	Page     int             `json:"page"`
+	PageSize int             `json:"page_size"`
+}
+
+// EvaluationMetricDiff represents the difference of a metric between two runs
+type EvaluationMetricDiff struct {
+	Name   string  `json:"name"`   // Metric name
+	Base   float64 `json:"base"`   // Value of the base run
+	Target float64 `json:"target"` // Value of the target run
+	Delta  float64 `json:"delta"`  // Target minus base
+}
+
+// EvaluationQuestion represents the evaluation record of a single question
+type EvaluationQuestion struct {
+	ID            uint64                 `json:"id"`             // Record ID
+	TaskID        string                 `json:"task_id"`        // Evaluation task ID
+	QuestionIndex int                    `json:"question_index"` // Position of the question in the dataset
+	QID           int                    `json:"qid"`            // Question ID in the dataset
+	Question      string                 `json:"question"`       // Question text
+	Input         map[string]interface{} `json:"input"`          // Metric input: ground truth, retrieved IDs and texts
+	Metric        *EvaluationMetrics     `json:"metric"`         // Metrics of the question
+}
+
+// EvaluationQuestionRegression represents a question whose metrics dropped in the target run
+type EvaluationQuestionRegression struct {
+	QID       int                    `json:"qid"`       // Question ID in the dataset
+	Question  string                 `json:"question"`  // Question text
+	Base      *EvaluationQuestion    `json:"base"`      // Record of the question in the base run
+	Target    *EvaluationQuestion    `json:"target"`    // Record of the question in the target run
+	Regressed []EvaluationMetricDiff `json:"regressed"` // Metrics that dropped
+}
+
+// EvaluationComparison represents the metric by metric comparison of two runs
+type EvaluationComparison struct {
+	Base        EvaluationRun                  `json:"base"`        // Base run
+	Target      EvaluationRun                  `json:"target"`      // Target run
+	Metrics     []EvaluationMetricDiff         `json:"metrics"`     // Differences of the aggregate metrics
+	Regressions []EvaluationQuestionRegression `json:"regressions"` // Questions that regressed
+}
+
+// EvaluationComparisonResponse represents the response of comparing two evaluation runs
+type EvaluationComparisonResponse struct {
+	Success bool                 `json:"success"`
+	Data    EvaluationComparison `json:"data"`
+}
+
+// ListEvaluations lists past evaluation runs with pagination, newest first
+// Parameters:
+//   - ctx: Context, used for passing request context information
+//   - page: Page number, starting from 1
+//   - pageSize: Number of runs per page
+//
+// Returns:
+//   - []EvaluationRun: Evaluation runs of the page
+//   - int64: Total number of evaluation runs
+//   - error: Error information if the request fails
+func (c *Client) ListEvaluations(ctx context.Context, page int, pageSize int) ([]EvaluationRun, int64, error) {
+	queryParams := url.Values{}
+	queryParams.Add("page", strconv.Itoa(page))
+	queryParams.Add("page_size", strconv.Itoa(pageSize))
+
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/evaluation/runs", nil, queryParams)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var response EvaluationRunListResponse
+	if err := parseResponse(resp, &response); err != nil {
+		return nil, 0, err
+	}
+
+	return response.Data, response.Total, nil
+}
+
+// CompareEvaluations compares two evaluation runs metric by metric
+// Parameters:
+//   - ctx: Context, used for passing request context information
+//   - baseTaskID: ID of the evaluation task used as the baseline
+//   - targetTaskID: ID of the evaluation task compared to the baseline
+//
+// Returns:
+//   - *EvaluationComparison: Metric differences and the questions that regressed
+//   - error: Error information if the request fails
+func (c *Client) CompareEvaluations(ctx context.Context,
+	baseTaskID string, targetTaskID string,
+) (*EvaluationComparison, error) {
+	queryParams := url.Values{}
+	queryParams.Add("base_task_id", baseTaskID)
+	queryParams.Add("target_task_id", targetTaskID)
+
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/evaluation/compare", nil, queryParams)
+	if err != nil {
+		return nil, err
+	}
+
+	var response EvaluationComparisonResponse
+	if err := parseResponse(resp, &response); err != nil {
+		return nil, err
+	}
+
+	return &response.Data, nil
+}
@@ -0,0 +1,174 @@
+// Package client provides the implementation for interacting with the WeKnora API
+// The Graph related interfaces are used for querying the knowledge graph of knowledge bases
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// GraphEntity represents an entity of the knowledge graph of a knowledge base
+type GraphEntity struct {
+	ID              string    `json:"id"`                // Entity unique identifier
+	TenantID        uint      `json:"tenant_id"`         // Tenant ID
+	KnowledgeBaseID string    `json:"knowledge_base_id"` // Knowledge base ID
+	Title           string    `json:"title"`             // Display name
+	Type            string    `json:"type"`              // Classification of the entity
+	Description     string    `json:"description"`       // Description of the entity
+	Frequency       int       `json:"frequency"`         // Number of chunks the entity appears in
+	Degree          int       `json:"degree"`            // Number of relationships of the entity
+	ChunkIDs        []string  `json:"chunk_ids"`         // Chunks the entity appears in
+	KnowledgeIDs    []string  `json:"knowledge_ids"`     // Knowledge the entity was extracted from
+	CreatedAt       time.Time `json:"created_at"`        // Creation time
+	UpdatedAt       time.Time `json:"updated_at"`        // Last update time
+}
+
+// GraphRelationship represents a directed relationship between two entities
+type GraphRelationship struct {
+	ID              string    `json:"id"`                // Relationship unique identifier
+	TenantID        uint      `json:"tenant_id"`         // Tenant ID
+	KnowledgeBaseID string    `json:"knowledge_base_id"` // Knowledge base ID
+	SourceID        string    `json:"source_id"`         // ID of the entity where the relationship starts
+	TargetID        string    `json:"target_id"`         // ID of the entity where the relationship ends
+	Description     string    `json:"description"`       // Description of the relationship
+	Strength        int       `json:"strength"`          // Strength of the relationship (1-10)
+	ChunkIDs        []string  `json:"chunk_ids"`         // Chunks the relationship appears in
+	KnowledgeIDs    []string  `json:"knowledge_ids"`     // Knowledge the relationship was extracted from
+	CreatedAt       time.Time `json:"created_at"`        // Creation time
+	UpdatedAt       time.Time `json:"updated_at"`        // Last update time
+}
+
+// KnowledgeGraph represents a subgraph of the knowledge graph
+type KnowledgeGraph struct {
+	Entities      []GraphEntity       `json:"entities"`
+	Relationships []GraphRelationship `json:"relationships"`
+}
+
+// GraphEntityListResponse represents the API response containing a list of entities with pagination
+type GraphEntityListResponse struct {
+	Success  bool          `json:"success"`
+	Data     []GraphEntity `json:"data"`
+	Total    int64         `json:"total"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+}
+
+// KnowledgeGraphResponse represents the API response containing a subgraph
+type KnowledgeGraphResponse struct {
+	Success bool           `json:"success"`
+	Data    KnowledgeGraph `json:"data"`
+}
+
+// ListGraphEntities lists the entities of the knowledge graph of a knowledge base, the most connected first
+// keyword filters the entities by title and may be empty
+func (c *Client) ListGraphEntities(ctx context.Context,
+	knowledgeBaseID string,
+	keyword string,
+	page int,
+	pageSize int,
+) ([]GraphEntity, int64, error) {
+	path := fmt.Sprintf("/api/v1/knowledge-bases/%s/graph/entities", knowledgeBaseID)
+
+	queryParams := url.Values{}
+	queryParams.Add("page", strconv.Itoa(page))
+	queryParams.Add("page_size", strconv.Itoa(pageSize))
+	if keyword != "" {
+		queryParams.Add("keyword", keyword)
+	}
+
+	resp, err := c.doRequest(ctx, http.MethodGet, path, nil, queryParams)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var response GraphEntityListResponse
+	if err := parseResponse(resp, &response); err != nil {
+		return nil, 0, err
+	}
+	return response.Data, response.Total, nil
+}
+
+// GetGraphNeighbors returns the entities within depth relationships of an entity and the relationships between them
+// A depth of 0 uses the server default
+func (c *Client) GetGraphNeighbors(ctx context.Context,
+	knowledgeBaseID string,
+	entityID string,
+	depth int,
+) (*KnowledgeGraph, error) {
+	path := fmt.Sprintf("/api/v1/knowledge-bases/%s/graph/entities/%s/neighbors", knowledgeBaseID, entityID)
+
+	queryParams := url.Values{}
+	if depth > 0 {
+		queryParams.Add("depth", strconv.Itoa(depth))
+	}
+
+	resp, err := c.doRequest(ctx, http.MethodGet, path, nil, queryParams)
+	if err != nil {
+		return nil, err
+	}
+
+	var response KnowledgeGraphResponse
+	if err := parseResponse(resp, &response); err != nil {
+		return nil, err
+	}
+	return &response.Data, nil
+}
+
+// FindGraphPath returns a shortest path between two entities, the entities are in path order
+// The returned graph is empty when no path of at most maxDepth relationships exists, a maxDepth of 0 uses the server default
+func (c *Client) FindGraphPath(ctx context.Context,
+	knowledgeBaseID string,
+	sourceID string,
+	targetID string,
+	maxDepth int,
+) (*KnowledgeGraph, error) {
+	path := fmt.Sprintf("/api/v1/knowledge-bases/%s/graph/path", knowledgeBaseID)
+
+	queryParams := url.Values{}
+	queryParams.Add("source", sourceID)
+	queryParams.Add("target", targetID)
+	if maxDepth > 0 {
+		queryParams.Add("max_depth", strconv.Itoa(maxDepth))
+	}
+
+	resp, err := c.doRequest(ctx, http.MethodGet, path, nil, queryParams)
+	if err != nil {
+		return nil, err
+	}
+
+	var response KnowledgeGraphResponse
+	if err := parseResponse(resp, &response); err != nil {
+		return nil, err
+	}
+	return &response.Data, nil
+}
+
+// ExportGraph writes the knowledge graph of a knowledge base to w
+// format is either "json" or "graphml"
+func (c *Client) ExportGraph(ctx context.Context, knowledgeBaseID string, format string, w io.Writer) error {
+	path := fmt.Sprintf("/api/v1/knowledge-bases/%s/graph/export", knowledgeBaseID)
+
+	queryParams := url.Values{}
+	queryParams.Add("format", format)
+
+	resp, err := c.doRequest(ctx, http.MethodGet, path, nil, queryParams)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to write graph: %w", err)
+	}
+	return nil
+}
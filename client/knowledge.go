@@ -40,6 +40,10 @@ type Knowledge struct {
 	UpdatedAt        time.Time         `json:"updated_at"`
 	ProcessedAt      *time.Time        `json:"processed_at"`
 	ErrorMessage     string            `json:"error_message"`
+	RefreshInterval  int               `json:"refresh_interval"` // Refresh interval in minutes of a URL knowledge, 0 means never
+	NextRefreshAt    *time.Time        `json:"next_refresh_at"`
+	LastCheckedAt    *time.Time        `json:"last_checked_at"`
+	LastChangedAt    *time.Time        `json:"last_changed_at"`
 }
 
 // KnowledgeResponse represents the API response containing a single knowledge entry
@@ -171,6 +175,71 @@ func (c *Client) CreateKnowledgeFromFile(ctx context.Context,
 	return &response.Data, nil
 }
 
+// ReplaceKnowledgeFile replaces the file of a knowledge entry with a local file,
+// only the chunks whose content changed are embedded again
+func (c *Client) ReplaceKnowledgeFile(ctx context.Context,
+	knowledgeID string, filePath string, enableMultimodel *bool,
+) (*Knowledge, error) {
+	// Open the local file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	// Get file information
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file information: %w", err)
+	}
+
+	// Create a multipart form writer
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", fileInfo.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, fmt.Errorf("failed to copy file content: %w", err)
+	}
+	if enableMultimodel != nil {
+		if err := writer.WriteField("enable_multimodel", strconv.FormatBool(*enableMultimodel)); err != nil {
+			return nil, fmt.Errorf("failed to write enable_multimodel field: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close writer: %w", err)
+	}
+
+	// Create the HTTP request
+	path := fmt.Sprintf("/api/v1/knowledge/%s/file", knowledgeID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if c.token != "" {
+		req.Header.Set("X-API-Key", c.token)
+	}
+	if requestID := ctx.Value("RequestID"); requestID != nil {
+		req.Header.Set("X-Request-ID", requestID.(string))
+	}
+
+	// Send the request
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var response KnowledgeResponse
+	if err := parseResponse(resp, &response); err != nil {
+		return nil, err
+	}
+	return &response.Data, nil
+}
+
 // CreateKnowledgeFromURL creates a knowledge entry from a web URL
 func (c *Client) CreateKnowledgeFromURL(ctx context.Context, knowledgeBaseID string, url string, enableMultimodel *bool) (*Knowledge, error) {
 	path := fmt.Sprintf("/api/v1/knowledge-bases/%s/knowledge/url", knowledgeBaseID)
@@ -327,6 +396,27 @@ func (c *Client) UpdateKnowledge(ctx context.Context, knowledge *Knowledge) erro
 	return parseResponse(resp, &response)
 }
 
+// SetKnowledgeRefreshInterval sets how often in minutes a URL knowledge is re-fetched, 0 disables refreshing
+func (c *Client) SetKnowledgeRefreshInterval(ctx context.Context, knowledgeID string, interval int) (*Knowledge, error) {
+	path := fmt.Sprintf("/api/v1/knowledge/%s/refresh-schedule", knowledgeID)
+	reqBody := struct {
+		RefreshInterval int `json:"refresh_interval"`
+	}{
+		RefreshInterval: interval,
+	}
+
+	resp, err := c.doRequest(ctx, http.MethodPut, path, reqBody, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response KnowledgeResponse
+	if err := parseResponse(resp, &response); err != nil {
+		return nil, err
+	}
+	return &response.Data, nil
+}
+
 // UpdateChunk updates a chunk's information
 // Updates information for a specific chunk under a knowledge document
 // Parameters:
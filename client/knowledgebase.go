@@ -38,6 +38,12 @@ type ChunkingConfig struct {
 	ChunkOverlap     int      `json:"chunk_overlap"`     // Overlap size
 	Separators       []string `json:"separators"`        // Separators
 	EnableMultimodal bool     `json:"enable_multimodal"` // Whether to enable multimodal processing
+	// Chunking strategy: recursive (default), heading, semantic or parent_child
+	Strategy string `json:"strategy,omitempty"`
+	// Size of the parent chunks of the parent_child strategy
+	ParentChunkSize int `json:"parent_chunk_size,omitempty"`
+	// Distance percentile above which the semantic strategy starts a new chunk
+	BreakpointPercentile int `json:"breakpoint_percentile,omitempty"`
 }
 
 // ImageProcessingConfig represents image processing configuration
@@ -73,6 +79,28 @@ type SearchResult struct {
 	Metadata          map[string]string `json:"metadata"`
 	KnowledgeFilename string            `json:"knowledge_filename"`
 	KnowledgeSource   string            `json:"knowledge_source"`
+	GraphPath         *GraphPath        `json:"graph_path,omitempty"` // Graph path the chunk was retrieved along
+}
+
+// GraphPath represents a path of the entity graph, Relations[i] connects Nodes[i] and Nodes[i+1] in either direction
+type GraphPath struct {
+	Nodes     []GraphPathNode     `json:"nodes"`
+	Relations []GraphPathRelation `json:"relations"`
+	Score     float64             `json:"score"`
+}
+
+// GraphPathNode represents an entity of a graph path
+type GraphPathNode struct {
+	Name       string   `json:"name"`
+	Chunks     []string `json:"chunks,omitempty"`
+	Attributes []string `json:"attributes,omitempty"`
+}
+
+// GraphPathRelation represents a relation of a graph path, directed from Node1 to Node2
+type GraphPathRelation struct {
+	Node1 string `json:"node1"`
+	Node2 string `json:"node2"`
+	Type  string `json:"type"`
 }
 
 // HybridSearchResponse hybrid search response
@@ -21,6 +21,8 @@ type Message struct {
 	Role                string          `json:"role"`
 	KnowledgeReferences []*SearchResult `json:"knowledge_references" `
 	IsCompleted         bool            `json:"is_completed"`
+	IsFailed            bool            `json:"is_failed"`
+	ErrorMessage        string          `json:"error_message,omitempty"`
 	CreatedAt           time.Time       `json:"created_at"`
 	UpdatedAt           time.Time       `json:"updated_at"`
 }
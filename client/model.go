@@ -74,8 +74,34 @@ const (
 const (
 	ModelSourceInternal ModelSource = "internal"
 	ModelSourceExternal ModelSource = "external"
+	// ModelSourceRoute groups several models of the same type, set as the "route" parameter
+	ModelSourceRoute ModelSource = "route"
+	// Native chat model APIs besides the OpenAI compatible one
+	ModelSourceAnthropic   ModelSource = "anthropic"
+	ModelSourceGemini      ModelSource = "gemini"
+	ModelSourceAzureOpenAI ModelSource = "azure_openai"
 )
 
+// Model route strategy constants
+const (
+	ModelRouteStrategyPriority = "priority"
+	ModelRouteStrategyWeighted = "weighted"
+)
+
+// ModelRouteTarget is a model of a route
+type ModelRouteTarget struct {
+	ModelID  string `json:"model_id"` // ID of a model of the route type
+	Priority int    `json:"priority"` // Lower values are called first
+	Weight   int    `json:"weight"`   // Weight in weighted round-robin
+}
+
+// ModelRoute is the "route" parameter of a model of the route source
+type ModelRoute struct {
+	Strategy    string             `json:"strategy"`               // priority or weighted
+	Targets     []ModelRouteTarget `json:"targets"`                // Models of the route
+	MaxAttempts int                `json:"max_attempts,omitempty"` // Models tried per call, all when zero
+}
+
 // CreateModel creates a model
 func (c *Client) CreateModel(ctx context.Context, request *CreateModelRequest) (*Model, error) {
 	resp, err := c.doRequest(ctx, http.MethodPost, "/api/v1/models", request, nil)
@@ -14,23 +14,48 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // SessionStrategy defines session strategy
 type SessionStrategy struct {
-	MaxRounds         int            `json:"max_rounds"`          // Maximum number of rounds to maintain
-	EnableRewrite     bool           `json:"enable_rewrite"`      // Enable query rewrite
-	FallbackStrategy  string         `json:"fallback_strategy"`   // Fallback strategy
-	FallbackResponse  string         `json:"fallback_response"`   // Fixed fallback response content
-	EmbeddingTopK     int            `json:"embedding_top_k"`     // Top K for vector retrieval
-	KeywordThreshold  float64        `json:"keyword_threshold"`   // Keyword retrieval threshold
-	VectorThreshold   float64        `json:"vector_threshold"`    // Vector retrieval threshold
-	RerankModelID     string         `json:"rerank_model_id"`     // Rerank model ID
-	RerankTopK        int            `json:"rerank_top_k"`        // Top K for reranking
-	RerankThreshold   float64        `json:"reranking_threshold"` // Reranking threshold
-	SummaryModelID    string         `json:"summary_model_id"`    // Summary model ID
-	SummaryParameters *SummaryConfig `json:"summary_parameters"`  // Summary model parameters
-	NoMatchPrefix     string         `json:"no_match_prefix"`     // Fallback response prefix
+	MaxRounds         int             `json:"max_rounds"`                // Maximum number of rounds to maintain
+	EnableRewrite     bool            `json:"enable_rewrite"`            // Enable query rewrite
+	FallbackStrategy  string          `json:"fallback_strategy"`         // Fallback strategy
+	FallbackResponse  string          `json:"fallback_response"`         // Fixed fallback response content
+	EmbeddingTopK     int             `json:"embedding_top_k"`           // Top K for vector retrieval
+	KeywordThreshold  float64         `json:"keyword_threshold"`         // Keyword retrieval threshold
+	VectorThreshold   float64         `json:"vector_threshold"`          // Vector retrieval threshold
+	FusionStrategy    string          `json:"fusion_strategy"`           // Fusion strategy: concat, rrf or weighted
+	VectorWeight      float64         `json:"vector_weight"`             // Weight of vector results in fusion
+	KeywordWeight     float64         `json:"keyword_weight"`            // Weight of keyword results in fusion
+	RerankModelID     string          `json:"rerank_model_id"`           // Rerank model ID
+	RerankTopK        int             `json:"rerank_top_k"`              // Top K for reranking
+	RerankThreshold   float64         `json:"reranking_threshold"`       // Reranking threshold
+	SummaryModelID    string          `json:"summary_model_id"`          // Summary model ID
+	SummaryParameters *SummaryConfig  `json:"summary_parameters"`        // Summary model parameters
+	NoMatchPrefix     string          `json:"no_match_prefix"`           // Fallback response prefix
+	Pipeline          *Pipeline       `json:"pipeline,omitempty"`        // Chat pipeline, server default when nil
+	QueryExpansion    *QueryExpansion `json:"query_expansion,omitempty"` // Query expansion, disabled when nil
+}
+
+// QueryExpansion expands the query into paraphrases and a hypothetical answer passage searched besides it
+type QueryExpansion struct {
+	Paraphrases int  `json:"paraphrases"` // Number of paraphrases of the query
+	HyDE        bool `json:"hyde"`        // Whether a hypothetical answer passage is searched
+}
+
+// Pipeline selects the chat pipeline of a session or tenant,
+// Steps declares the pipeline inline, otherwise Name refers to a built-in or configured pipeline
+type Pipeline struct {
+	Name  string         `json:"name,omitempty"`
+	Steps []PipelineStep `json:"steps,omitempty"`
+}
+
+// PipelineStep is a single event of a pipeline, Params overrides the chat parameters of the same name
+type PipelineStep struct {
+	Event  string                 `json:"event"`
+	Params map[string]interface{} `json:"params,omitempty"`
 }
 
 // SummaryConfig defines summary configuration
@@ -51,30 +76,39 @@ type SummaryConfig struct {
 
 // CreateSessionRequest session creation request
 type CreateSessionRequest struct {
-	KnowledgeBaseID string           `json:"knowledge_base_id"` // Associated knowledge base ID
-	SessionStrategy *SessionStrategy `json:"session_strategy"`  // Session strategy
+	KnowledgeBaseID  string           `json:"knowledge_base_id"`            // Associated knowledge base ID
+	KnowledgeBaseIDs []string         `json:"knowledge_base_ids,omitempty"` // Additional associated knowledge base IDs
+	SessionStrategy  *SessionStrategy `json:"session_strategy"`             // Session strategy
 }
 
 // Session session information
 type Session struct {
-	ID                string         `json:"id"`
-	TenantID          uint           `json:"tenant_id"`
-	KnowledgeBaseID   string         `json:"knowledge_base_id"`
-	Title             string         `json:"title"`
-	MaxRounds         int            `json:"max_rounds"`
-	EnableRewrite     bool           `json:"enable_rewrite"`
-	FallbackStrategy  string         `json:"fallback_strategy"`
-	FallbackResponse  string         `json:"fallback_response"`
-	EmbeddingTopK     int            `json:"embedding_top_k"`
-	KeywordThreshold  float64        `json:"keyword_threshold"`
-	VectorThreshold   float64        `json:"vector_threshold"`
-	RerankModelID     string         `json:"rerank_model_id"`
-	RerankTopK        int            `json:"rerank_top_k"`
-	RerankThreshold   float64        `json:"reranking_threshold"` // Reranking threshold
-	SummaryModelID    string         `json:"summary_model_id"`
-	SummaryParameters *SummaryConfig `json:"summary_parameters"`
-	CreatedAt         string         `json:"created_at"`
-	UpdatedAt         string         `json:"updated_at"`
+	ID                string          `json:"id"`
+	TenantID          uint            `json:"tenant_id"`
+	KnowledgeBaseID   string          `json:"knowledge_base_id"`
+	KnowledgeBaseIDs  []string        `json:"knowledge_base_ids"`
+	Title             string          `json:"title"`
+	MaxRounds         int             `json:"max_rounds"`
+	EnableRewrite     bool            `json:"enable_rewrite"`
+	FallbackStrategy  string          `json:"fallback_strategy"`
+	FallbackResponse  string          `json:"fallback_response"`
+	EmbeddingTopK     int             `json:"embedding_top_k"`
+	KeywordThreshold  float64         `json:"keyword_threshold"`
+	VectorThreshold   float64         `json:"vector_threshold"`
+	FusionStrategy    string          `json:"fusion_strategy"`
+	VectorWeight      float64         `json:"vector_weight"`
+	KeywordWeight     float64         `json:"keyword_weight"`
+	RerankModelID     string          `json:"rerank_model_id"`
+	RerankTopK        int             `json:"rerank_top_k"`
+	RerankThreshold   float64         `json:"reranking_threshold"` // Reranking threshold
+	SummaryModelID    string          `json:"summary_model_id"`
+	SummaryParameters *SummaryConfig  `json:"summary_parameters"`
+	Pipeline          *Pipeline       `json:"pipeline,omitempty"`
+	QueryExpansion    *QueryExpansion `json:"query_expansion,omitempty"`
+	Summary           string          `json:"summary,omitempty"`       // Rolling summary of the earlier conversation
+	SummaryUntil      string          `json:"summary_until,omitempty"` // Creation time of the last round in the summary
+	CreatedAt         string          `json:"created_at"`
+	UpdatedAt         string          `json:"updated_at"`
 }
 
 // SessionResponse session response
@@ -202,7 +236,18 @@ func (c *Client) GenerateTitle(ctx context.Context, sessionID string, request *G
 
 // KnowledgeQARequest knowledge Q&A request
 type KnowledgeQARequest struct {
-	Query string `json:"query"`
+	Query  string        `json:"query"`
+	Filter *SearchFilter `json:"filter,omitempty"` // Optional metadata filter
+}
+
+// SearchFilter restricts retrieval to knowledge matching all the given conditions
+type SearchFilter struct {
+	KnowledgeIDs  []string          `json:"knowledge_ids,omitempty"`  // Only search the given knowledge
+	FileTypes     []string          `json:"file_types,omitempty"`     // Only search the given file types, e.g. pdf
+	Tags          []string          `json:"tags,omitempty"`           // Only search knowledge with all the given tags
+	CreatedAfter  *time.Time        `json:"created_after,omitempty"`  // Only search knowledge created after this time
+	CreatedBefore *time.Time        `json:"created_before,omitempty"` // Only search knowledge created before this time
+	Metadata      map[string]string `json:"metadata,omitempty"`       // Only search knowledge with the given metadata
 }
 
 type ResponseType string
@@ -210,8 +255,21 @@ type ResponseType string
 const (
 	ResponseTypeAnswer     ResponseType = "answer"
 	ResponseTypeReferences ResponseType = "references"
+	// ResponseTypeError ends a failed stream, its content is the error message
+	ResponseTypeError ResponseType = "error"
 )
 
+// StreamError is returned by the streaming APIs when the server ends the answer with an error,
+// the content received before the error has already been passed to the callback
+type StreamError struct {
+	Message string
+}
+
+// Error implements the error interface
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("stream failed: %s", e.Message)
+}
+
 // StreamResponse streaming response
 type StreamResponse struct {
 	ID                  string          `json:"id"`                   // Unique identifier
@@ -219,16 +277,20 @@ type StreamResponse struct {
 	Content             string          `json:"content"`              // Current content fragment
 	Done                bool            `json:"done"`                 // Whether completed
 	KnowledgeReferences []*SearchResult `json:"knowledge_references"` // Knowledge references
+	Usage               *TokenUsage     `json:"usage,omitempty"`      // Token usage of the answer, set on the final fragment
 }
 
-// KnowledgeQAStream knowledge Q&A streaming API
+// KnowledgeQAStream knowledge Q&A streaming API, a *StreamError is returned when the answer fails
 func (c *Client) KnowledgeQAStream(ctx context.Context, sessionID string, query string, callback func(*StreamResponse) error) error {
-	path := fmt.Sprintf("/api/v1/knowledge-chat/%s", sessionID)
-	fmt.Printf("Starting KnowledgeQAStream request, session ID: %s, query: %s\n", sessionID, query)
+	return c.KnowledgeQAStreamWithRequest(ctx, sessionID, &KnowledgeQARequest{Query: query}, callback)
+}
 
-	request := &KnowledgeQARequest{
-		Query: query,
-	}
+// KnowledgeQAStreamWithRequest knowledge Q&A streaming API with full request options, such as metadata filter
+func (c *Client) KnowledgeQAStreamWithRequest(ctx context.Context,
+	sessionID string, request *KnowledgeQARequest, callback func(*StreamResponse) error,
+) error {
+	path := fmt.Sprintf("/api/v1/knowledge-chat/%s", sessionID)
+	fmt.Printf("Starting KnowledgeQAStream request, session ID: %s, query: %s\n", sessionID, request.Query)
 
 	resp, err := c.doRequest(ctx, http.MethodPost, path, request, nil)
 	if err != nil {
@@ -269,6 +331,11 @@ func (c *Client) KnowledgeQAStream(ctx context.Context, sessionID string, query
 				messageCount++
 				fmt.Printf("Parsed message #%d, done status: %v\n", messageCount, streamResponse.Done)
 
+				if streamResponse.ResponseType == ResponseTypeError {
+					fmt.Printf("Stream ended with error: %s\n", streamResponse.Content)
+					return &StreamError{Message: streamResponse.Content}
+				}
+
 				if err := callback(&streamResponse); err != nil {
 					fmt.Printf("Callback processing failed: %v\n", err)
 					return err
@@ -334,6 +401,9 @@ func (c *Client) ContinueStream(ctx context.Context, sessionID string, messageID
 					return fmt.Errorf("failed to parse SSE data: %w", err)
 				}
 
+				if streamResponse.ResponseType == ResponseTypeError {
+					return &StreamError{Message: streamResponse.Content}
+				}
 				if err := callback(&streamResponse); err != nil {
 					return err
 				}
@@ -363,8 +433,9 @@ func (c *Client) ContinueStream(ctx context.Context, sessionID string, messageID
 
 // SearchKnowledgeRequest knowledge search request
 type SearchKnowledgeRequest struct {
-	Query           string `json:"query"`             // Query content
-	KnowledgeBaseID string `json:"knowledge_base_id"` // Knowledge base ID
+	Query           string        `json:"query"`             // Query content
+	KnowledgeBaseID string        `json:"knowledge_base_id"` // Knowledge base ID
+	Filter          *SearchFilter `json:"filter,omitempty"`  // Optional metadata filter
 }
 
 // SearchKnowledgeResponse search results response
@@ -22,6 +22,14 @@ type RetrieverEngineParams struct {
 	RetrieverEngineType string `json:"retriever_engine_type"` // Type of engine implementing the retriever
 }
 
+// TenantRateLimits contains the rate limits and quotas of a tenant, a zero limit is unlimited
+type TenantRateLimits struct {
+	RequestsPerMinute int64 `json:"requests_per_minute"` // Requests per minute to the chat, search and ingestion APIs
+	ConcurrentStreams int64 `json:"concurrent_streams"`  // Chat streams generated at the same time
+	TokensPerDay      int64 `json:"tokens_per_day"`      // Model tokens consumed per day
+	DocumentsPerHour  int64 `json:"documents_per_hour"`  // Documents ingested per hour
+}
+
 // Tenant represents tenant information in the system
 type Tenant struct {
 	ID uint `yaml:"id" json:"id" gorm:"primaryKey"`
@@ -37,6 +45,10 @@ type Tenant struct {
 	RetrieverEngines RetrieverEngines `yaml:"retriever_engines" json:"retriever_engines" gorm:"type:json"`
 	// Business/department information
 	Business string `yaml:"business" json:"business"`
+	// Default chat pipeline of the tenant's sessions
+	Pipeline *Pipeline `yaml:"pipeline" json:"pipeline,omitempty"`
+	// Rate limits and quotas of the tenant, the server defaults apply when empty
+	RateLimits *TenantRateLimits `yaml:"rate_limits" json:"rate_limits,omitempty"`
 	// Creation timestamp
 	CreatedAt time.Time `yaml:"created_at" json:"created_at"`
 	// Last update timestamp
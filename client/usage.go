@@ -0,0 +1,86 @@
+// Package client provides the implementation for interacting with the WeKnora API
+// The Usage related interfaces are used for reporting the token usage and cost of the tenant
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TokenUsage represents the number of tokens consumed by a model call
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`     // Prompt tokens
+	CompletionTokens int `json:"completion_tokens"` // Completion tokens
+	TotalTokens      int `json:"total_tokens"`      // Total tokens
+}
+
+// UsageReportRequest represents the parameters of a usage report
+type UsageReportRequest struct {
+	StartDate string   // First day of the period, formatted as 2006-01-02, 30 days before the end date when empty
+	EndDate   string   // Last day of the period, formatted as 2006-01-02, today when empty
+	GroupBy   []string // Dimensions to group by: day, model and tenant, day and model when empty
+}
+
+// UsageReportItem represents the usage of one group of a usage report
+type UsageReportItem struct {
+	Day              string  `json:"day,omitempty"`        // Day, set when grouped by day
+	TenantID         uint    `json:"tenant_id,omitempty"`  // Tenant ID, set when grouped by tenant
+	ModelID          string  `json:"model_id,omitempty"`   // Model ID, set when grouped by model
+	ModelName        string  `json:"model_name,omitempty"` // Model name, set when grouped by model
+	Type             string  `json:"type,omitempty"`       // Kind of the model calls: chat, embedding or rerank
+	Calls            int64   `json:"calls"`                // Number of model calls
+	PromptTokens     int64   `json:"prompt_tokens"`        // Prompt tokens
+	CompletionTokens int64   `json:"completion_tokens"`    // Completion tokens
+	TotalTokens      int64   `json:"total_tokens"`         // Total tokens
+	Cost             float64 `json:"cost"`                 // Cost at the configured model prices
+}
+
+// UsageReport represents the token usage and cost of a period
+type UsageReport struct {
+	StartTime time.Time          `json:"start_time"` // Start of the period
+	EndTime   time.Time          `json:"end_time"`   // End of the period, exclusive
+	Currency  string             `json:"currency"`   // Currency of the costs
+	Items     []*UsageReportItem `json:"items"`      // Usage of each group
+	Total     *UsageReportItem   `json:"total"`      // Total usage of the period
+}
+
+// UsageReportResponse represents the API response containing a usage report
+type UsageReportResponse struct {
+	Success bool        `json:"success"`
+	Data    UsageReport `json:"data"`
+}
+
+// GetUsageReport reports the token usage and cost of the tenant
+// Parameters:
+//   - ctx: Context, used for passing request context information
+//   - request: Period and dimensions of the report
+//
+// Returns:
+//   - *UsageReport: Usage report
+//   - error: Error information if the request fails
+func (c *Client) GetUsageReport(ctx context.Context, request *UsageReportRequest) (*UsageReport, error) {
+	query := url.Values{}
+	if request.StartDate != "" {
+		query.Add("start_date", request.StartDate)
+	}
+	if request.EndDate != "" {
+		query.Add("end_date", request.EndDate)
+	}
+	if len(request.GroupBy) > 0 {
+		query.Add("group_by", strings.Join(request.GroupBy, ","))
+	}
+
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/usage/report", nil, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var response UsageReportResponse
+	if err := parseResponse(resp, &response); err != nil {
+		return nil, err
+	}
+	return &response.Data, nil
+}
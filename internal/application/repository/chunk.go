@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/Tencent/WeKnora/internal/common"
 	"github.com/Tencent/WeKnora/internal/types"
@@ -96,6 +97,20 @@ func (r *chunkRepository) ListPagedChunksByKnowledgeID(
 	return chunks, total, nil
 }
 
+// ListChunksByKnowledgeIDAndType lists all chunks of the given types for a knowledge ID
+func (r *chunkRepository) ListChunksByKnowledgeIDAndType(
+	ctx context.Context, tenantID uint, knowledgeID string, chunkType []types.ChunkType,
+) ([]*types.Chunk, error) {
+	var chunks []*types.Chunk
+	if err := r.db.WithContext(ctx).
+		Where("tenant_id = ? AND knowledge_id = ? and chunk_type in (?)", tenantID, knowledgeID, chunkType).
+		Order("chunk_index ASC").
+		Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
 func (r *chunkRepository) ListChunkByParentID(ctx context.Context, tenantID uint, parentID string) ([]*types.Chunk, error) {
 	var chunks []*types.Chunk
 	if err := r.db.WithContext(ctx).
@@ -106,6 +121,62 @@ func (r *chunkRepository) ListChunkByParentID(ctx context.Context, tenantID uint
 	return chunks, nil
 }
 
+// ListEnabledChunksByKnowledgeBaseID lists enabled chunks of a knowledge base after the given chunk,
+// parent chunks are left out as they are never embedded
+// Chunks are ordered by (created_at, id) so that chunks created while walking are still visited
+func (r *chunkRepository) ListEnabledChunksByKnowledgeBaseID(
+	ctx context.Context, tenantID uint, knowledgeBaseID string, after *types.Chunk, limit int,
+) ([]*types.Chunk, error) {
+	var chunks []*types.Chunk
+	query := r.db.WithContext(ctx).
+		Select("id, content, knowledge_id, knowledge_base_id, chunk_type, created_at").
+		Where("tenant_id = ? AND knowledge_base_id = ? AND is_enabled = ?", tenantID, knowledgeBaseID, true).
+		Where("chunk_type <> ?", types.ChunkTypeParentText)
+	if after != nil {
+		query = query.Where("(created_at > ? OR (created_at = ? AND id > ?))",
+			after.CreatedAt, after.CreatedAt, after.ID)
+	}
+	if err := query.Order("created_at ASC, id ASC").Limit(limit).Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// ListChunksUpdatedSince lists the chunks of a knowledge base updated at or after the given time,
+// disabled chunks included and parent chunks left out
+// Chunks are ordered by (updated_at, id) and listed after the given chunk
+func (r *chunkRepository) ListChunksUpdatedSince(
+	ctx context.Context, tenantID uint, knowledgeBaseID string, since time.Time, after *types.Chunk, limit int,
+) ([]*types.Chunk, error) {
+	var chunks []*types.Chunk
+	query := r.db.WithContext(ctx).
+		Select("id, content, knowledge_id, knowledge_base_id, chunk_type, is_enabled, created_at, updated_at").
+		Where("tenant_id = ? AND knowledge_base_id = ? AND updated_at >= ?", tenantID, knowledgeBaseID, since).
+		Where("chunk_type <> ?", types.ChunkTypeParentText)
+	if after != nil {
+		query = query.Where("(updated_at > ? OR (updated_at = ? AND id > ?))",
+			after.UpdatedAt, after.UpdatedAt, after.ID)
+	}
+	if err := query.Order("updated_at ASC, id ASC").Limit(limit).Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// CountEnabledChunksByKnowledgeBaseID counts enabled chunks of a knowledge base, parent chunks excluded
+func (r *chunkRepository) CountEnabledChunksByKnowledgeBaseID(
+	ctx context.Context, tenantID uint, knowledgeBaseID string,
+) (int64, error) {
+	var total int64
+	if err := r.db.WithContext(ctx).Model(&types.Chunk{}).
+		Where("tenant_id = ? AND knowledge_base_id = ? AND is_enabled = ?", tenantID, knowledgeBaseID, true).
+		Where("chunk_type <> ?", types.ChunkTypeParentText).
+		Count(&total).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
 // UpdateChunk updates a chunk
 func (r *chunkRepository) UpdateChunk(ctx context.Context, chunk *types.Chunk) error {
 	return r.db.WithContext(ctx).Save(chunk).Error
@@ -116,6 +187,14 @@ func (r *chunkRepository) DeleteChunk(ctx context.Context, tenantID uint, id str
 	return r.db.WithContext(ctx).Where("tenant_id = ? AND id = ?", tenantID, id).Delete(&types.Chunk{}).Error
 }
 
+// DeleteChunks deletes chunks by their IDs
+func (r *chunkRepository) DeleteChunks(ctx context.Context, tenantID uint, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Where("tenant_id = ? AND id in ?", tenantID, ids).Delete(&types.Chunk{}).Error
+}
+
 // DeleteChunksByKnowledgeID deletes all chunks for a knowledge ID
 func (r *chunkRepository) DeleteChunksByKnowledgeID(ctx context.Context, tenantID uint, knowledgeID string) error {
 	return r.db.WithContext(ctx).Where(
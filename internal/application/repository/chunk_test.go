@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+func TestListEnabledChunksByKnowledgeBaseIDSkipsParentChunks(t *testing.T) {
+	db, recorder := newDryRunDB(t, "postgres")
+	repo := NewChunkRepository(db)
+
+	if _, err := repo.ListEnabledChunksByKnowledgeBaseID(context.Background(), 1, "kb", nil, 100); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertContains(t, recorder.last(), "chunk_type <> 'parent_text'", "is_enabled = true")
+
+	if _, err := repo.CountEnabledChunksByKnowledgeBaseID(context.Background(), 1, "kb"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertContains(t, recorder.last(), "count(*)", "chunk_type <> 'parent_text'")
+}
+
+func TestListChunksUpdatedSince(t *testing.T) {
+	db, recorder := newDryRunDB(t, "postgres")
+	repo := NewChunkRepository(db)
+	since := time.Date(2025, 8, 12, 10, 0, 0, 0, time.UTC)
+	after := &types.Chunk{ID: "c1", UpdatedAt: since.Add(time.Minute)}
+
+	if _, err := repo.ListChunksUpdatedSince(context.Background(), 1, "kb", since, after, 100); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Disabled chunks are listed so that their vectors can be dropped
+	sql := recorder.last()
+	assertContains(t, sql, "updated_at >= '2025-08-12 10:00:00", "updated_at = '2025-08-12 10:01:00",
+		"id > 'c1'", "chunk_type <> 'parent_text'", "ORDER BY updated_at ASC, id ASC")
+	if strings.Contains(sql, "is_enabled =") {
+		t.Errorf("Expected disabled chunks to be listed, got %s", sql)
+	}
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"gorm.io/gorm"
+)
+
+// datasetRepository implements the DatasetRepository interface
+type datasetRepository struct {
+	db *gorm.DB
+}
+
+// NewDatasetRepository creates a new dataset repository
+func NewDatasetRepository(db *gorm.DB) interfaces.DatasetRepository {
+	return &datasetRepository{db: db}
+}
+
+// CreateDataset creates a dataset together with its QA pairs
+func (r *datasetRepository) CreateDataset(ctx context.Context,
+	dataset *types.Dataset, pairs []*types.DatasetQAPair,
+) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(dataset).Error; err != nil {
+			return err
+		}
+		for _, pair := range pairs {
+			pair.DatasetID = dataset.ID
+		}
+		return tx.CreateInBatches(pairs, 100).Error
+	})
+}
+
+// GetDatasetByID gets a dataset by id
+func (r *datasetRepository) GetDatasetByID(ctx context.Context, tenantID uint, id string) (*types.Dataset, error) {
+	var dataset types.Dataset
+	if err := r.db.WithContext(ctx).Where("tenant_id = ? AND id = ?", tenantID, id).First(&dataset).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, types.ErrDatasetNotFound
+		}
+		return nil, err
+	}
+	return &dataset, nil
+}
+
+// ListDatasets lists the datasets of a tenant, newest first
+func (r *datasetRepository) ListDatasets(ctx context.Context, tenantID uint) ([]*types.Dataset, error) {
+	var datasets []*types.Dataset
+	if err := r.db.WithContext(ctx).
+		Where("tenant_id = ?", tenantID).
+		Order("created_at DESC").
+		Find(&datasets).Error; err != nil {
+		return nil, err
+	}
+	return datasets, nil
+}
+
+// ListQAPairs lists the QA pairs of a dataset in upload order
+func (r *datasetRepository) ListQAPairs(ctx context.Context, datasetID string) ([]*types.DatasetQAPair, error) {
+	var pairs []*types.DatasetQAPair
+	if err := r.db.WithContext(ctx).
+		Where("dataset_id = ?", datasetID).
+		Order("id ASC").
+		Find(&pairs).Error; err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// DeleteDataset deletes a dataset and its QA pairs
+func (r *datasetRepository) DeleteDataset(ctx context.Context, tenantID uint, id string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("tenant_id = ? AND id = ?", tenantID, id).Delete(&types.Dataset{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return types.ErrDatasetNotFound
+		}
+		return tx.Where("dataset_id = ?", id).Delete(&types.DatasetQAPair{}).Error
+	})
+}
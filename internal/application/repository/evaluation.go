@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"gorm.io/gorm"
+)
+
+// evaluationRepository implements the EvaluationRepository interface
+type evaluationRepository struct {
+	db *gorm.DB
+}
+
+// NewEvaluationRepository creates a new evaluation repository
+func NewEvaluationRepository(db *gorm.DB) interfaces.EvaluationRepository {
+	return &evaluationRepository{db: db}
+}
+
+// CreateTask creates a new evaluation task
+func (r *evaluationRepository) CreateTask(ctx context.Context, task *types.EvaluationTask) error {
+	return r.db.WithContext(ctx).Create(task).Error
+}
+
+// GetTaskByID gets an evaluation task by id
+func (r *evaluationRepository) GetTaskByID(ctx context.Context,
+	tenantID uint, id string,
+) (*types.EvaluationTask, error) {
+	var task types.EvaluationTask
+	if err := r.db.WithContext(ctx).Where("tenant_id = ? AND id = ?", tenantID, id).First(&task).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, types.ErrEvaluationTaskNotFound
+		}
+		return nil, err
+	}
+	return &task, nil
+}
+
+// ListPagedTasks lists the evaluation tasks of a tenant, newest first
+func (r *evaluationRepository) ListPagedTasks(ctx context.Context,
+	tenantID uint, page *types.Pagination,
+) ([]*types.EvaluationTask, int64, error) {
+	var tasks []*types.EvaluationTask
+	var total int64
+
+	if err := r.db.WithContext(ctx).Model(&types.EvaluationTask{}).
+		Where("tenant_id = ?", tenantID).
+		Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := r.db.WithContext(ctx).
+		Where("tenant_id = ?", tenantID).
+		Order("created_at DESC").
+		Offset(page.Offset()).
+		Limit(page.Limit()).
+		Find(&tasks).Error; err != nil {
+		return nil, 0, err
+	}
+	return tasks, total, nil
+}
+
+// UpdateTask saves the status, progress and metrics of an evaluation task
+func (r *evaluationRepository) UpdateTask(ctx context.Context, task *types.EvaluationTask) error {
+	return r.db.WithContext(ctx).Save(task).Error
+}
+
+// FailInterruptedTasks marks the pending and running evaluation tasks as failed
+func (r *evaluationRepository) FailInterruptedTasks(ctx context.Context, errMsg string) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&types.EvaluationTask{}).
+		Where("status IN ?", []types.EvaluationStatue{types.EvaluationStatuePending, types.EvaluationStatueRunning}).
+		Updates(map[string]interface{}{
+			"status":   types.EvaluationStatueFailed,
+			"err_msg":  errMsg,
+			"end_time": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// CreateQuestion creates the evaluation record of a question
+func (r *evaluationRepository) CreateQuestion(ctx context.Context, question *types.EvaluationQuestion) error {
+	return r.db.WithContext(ctx).Create(question).Error
+}
+
+// ListQuestionsByTaskID lists the question records of an evaluation task in dataset order
+func (r *evaluationRepository) ListQuestionsByTaskID(ctx context.Context,
+	taskID string,
+) ([]*types.EvaluationQuestion, error) {
+	var questions []*types.EvaluationQuestion
+	if err := r.db.WithContext(ctx).
+		Where("task_id = ?", taskID).
+		Order("question_index ASC").
+		Find(&questions).Error; err != nil {
+		return nil, err
+	}
+	return questions, nil
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFailInterruptedTasks(t *testing.T) {
+	db, recorder := newDryRunDB(t, "postgres")
+	if _, err := NewEvaluationRepository(db).FailInterruptedTasks(context.Background(), "interrupted"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertContains(t, recorder.last(), `UPDATE "evaluation_tasks" SET`, `"status"=3`,
+		`"err_msg"='interrupted'`, `"end_time"=`, "status IN (0,1)")
+}
@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// graphRepository implements the GraphRepository interface
+type graphRepository struct {
+	db *gorm.DB
+}
+
+// NewGraphRepository creates a new knowledge graph repository
+func NewGraphRepository(db *gorm.DB) interfaces.GraphRepository {
+	return &graphRepository{db: db}
+}
+
+// graphWriteBatchSize is the number of entities or relationships upserted per statement
+const graphWriteBatchSize = 100
+
+// UpdateGraph merges changes into the entities of the scope and the relationships touching them in a transaction.
+// Missing entities are first inserted by title key, then the entities and relationships are locked row by row,
+// so knowledge sharing entities are merged one after another while the rest of the graph stays writable
+func (r *graphRepository) UpdateGraph(ctx context.Context, knowledgeBaseID string, scope *types.GraphScope,
+	update func(graph *types.KnowledgeGraph) (*types.GraphChanges, error),
+) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := insertGraphEntities(tx, scope.Entities); err != nil {
+			return err
+		}
+		graph, err := lockGraphScope(tx, knowledgeBaseID, scope)
+		if err != nil {
+			return err
+		}
+		changes, err := update(graph)
+		if err != nil {
+			return err
+		}
+		return saveGraphChanges(tx, knowledgeBaseID, changes)
+	})
+}
+
+// insertGraphEntities inserts the entities whose title key is not in the graph yet,
+// entities inserted concurrently by another knowledge are kept
+func insertGraphEntities(tx *gorm.DB, entities []*types.GraphEntity) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	// Sorted by title key so that concurrent inserts wait on each other in the same order
+	entities = slices.Clone(entities)
+	slices.SortFunc(entities, func(a, b *types.GraphEntity) int { return strings.Compare(a.TitleKey, b.TitleKey) })
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "knowledge_base_id"}, {Name: "title_key"}},
+		DoNothing: true,
+	}).CreateInBatches(entities, graphWriteBatchSize).Error
+}
+
+// lockGraphScope loads and locks the entities of the scope, either by title key or because the knowledge
+// contributed to them, and the relationships touching these entities
+func lockGraphScope(tx *gorm.DB, knowledgeBaseID string, scope *types.GraphScope) (*types.KnowledgeGraph, error) {
+	graph := &types.KnowledgeGraph{}
+	titleKeys := make([]string, 0, len(scope.Entities))
+	for _, entity := range scope.Entities {
+		titleKeys = append(titleKeys, entity.TitleKey)
+	}
+	if len(titleKeys) == 0 && len(scope.KnowledgeIDs) == 0 {
+		return graph, nil
+	}
+
+	conditions := []string{}
+	args := []interface{}{}
+	if len(titleKeys) > 0 {
+		conditions = append(conditions, "title_key IN ?")
+		args = append(args, titleKeys)
+	}
+	if len(scope.KnowledgeIDs) > 0 {
+		// Knowledge IDs are stored as a JSON array, the expressions differ between databases
+		if tx.Dialector.Name() == "mysql" {
+			knowledgeIDs, err := json.Marshal(scope.KnowledgeIDs)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, "JSON_OVERLAPS(knowledge_ids, ?)")
+			args = append(args, string(knowledgeIDs))
+		} else {
+			conditions = append(conditions,
+				"EXISTS (SELECT 1 FROM jsonb_array_elements_text(knowledge_ids) WHERE value IN ?)")
+			args = append(args, scope.KnowledgeIDs)
+		}
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("knowledge_base_id = ?", knowledgeBaseID).
+		Where(strings.Join(conditions, " OR "), args...).
+		Order("id ASC").
+		Find(&graph.Entities).Error; err != nil {
+		return nil, err
+	}
+	if len(graph.Entities) == 0 {
+		return graph, nil
+	}
+
+	entityIDs := make([]string, 0, len(graph.Entities))
+	for _, entity := range graph.Entities {
+		entityIDs = append(entityIDs, entity.ID)
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("knowledge_base_id = ?", knowledgeBaseID).
+		Where("source_id IN ? OR target_id IN ?", entityIDs, entityIDs).
+		Order("id ASC").
+		Find(&graph.Relationships).Error; err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+// saveGraphChanges deletes and upserts the entities and relationships of the changes
+func saveGraphChanges(tx *gorm.DB, knowledgeBaseID string, changes *types.GraphChanges) error {
+	if len(changes.DeleteRelationshipIDs) > 0 {
+		if err := tx.Where("knowledge_base_id = ? AND id IN ?", knowledgeBaseID, changes.DeleteRelationshipIDs).
+			Delete(&types.GraphRelationship{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(changes.DeleteEntityIDs) > 0 {
+		if err := tx.Where("knowledge_base_id = ? AND id IN ?", knowledgeBaseID, changes.DeleteEntityIDs).
+			Delete(&types.GraphEntity{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(changes.SaveEntities) > 0 {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "knowledge_base_id"}, {Name: "title_key"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"title", "type", "description", "frequency", "degree",
+				"chunk_ids", "knowledge_ids", "sources", "updated_at",
+			}),
+		}).CreateInBatches(changes.SaveEntities, graphWriteBatchSize).Error; err != nil {
+			return err
+		}
+	}
+	if len(changes.SaveRelationships) > 0 {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "knowledge_base_id"}, {Name: "source_id"}, {Name: "target_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"description", "strength", "chunk_ids", "knowledge_ids", "sources", "updated_at",
+			}),
+		}).CreateInBatches(changes.SaveRelationships, graphWriteBatchSize).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteGraph deletes the entities and relationships of a knowledge base
+func (r *graphRepository) DeleteGraph(ctx context.Context, knowledgeBaseID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("knowledge_base_id = ?", knowledgeBaseID).
+			Delete(&types.GraphRelationship{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("knowledge_base_id = ?", knowledgeBaseID).Delete(&types.GraphEntity{}).Error
+	})
+}
+
+// ListEntities lists the entities of a knowledge base, the most connected first
+func (r *graphRepository) ListEntities(ctx context.Context,
+	knowledgeBaseID string, keyword string, page *types.Pagination,
+) ([]*types.GraphEntity, int64, error) {
+	query := func() *gorm.DB {
+		db := r.db.WithContext(ctx).Model(&types.GraphEntity{}).Where("knowledge_base_id = ?", knowledgeBaseID)
+		if keyword != "" {
+			db = db.Where("title_key LIKE ?", "%"+types.NormalizeEntityTitle(keyword)+"%")
+		}
+		return db
+	}
+
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entities []*types.GraphEntity
+	if err := query().
+		Order("degree DESC").
+		Order("frequency DESC").
+		Order("id ASC").
+		Offset(page.Offset()).
+		Limit(page.Limit()).
+		Find(&entities).Error; err != nil {
+		return nil, 0, err
+	}
+	return entities, total, nil
+}
+
+// GetEntitiesByIDs gets entities of a knowledge base by id
+func (r *graphRepository) GetEntitiesByIDs(ctx context.Context,
+	knowledgeBaseID string, ids []string,
+) ([]*types.GraphEntity, error) {
+	var entities []*types.GraphEntity
+	if len(ids) == 0 {
+		return entities, nil
+	}
+	if err := r.db.WithContext(ctx).
+		Where("knowledge_base_id = ? AND id IN ?", knowledgeBaseID, ids).
+		Find(&entities).Error; err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
+
+// ListRelationshipsByEntityIDs lists the relationships starting or ending at the entities
+func (r *graphRepository) ListRelationshipsByEntityIDs(ctx context.Context,
+	knowledgeBaseID string, entityIDs []string,
+) ([]*types.GraphRelationship, error) {
+	var relationships []*types.GraphRelationship
+	if len(entityIDs) == 0 {
+		return relationships, nil
+	}
+	if err := r.db.WithContext(ctx).
+		Where("knowledge_base_id = ?", knowledgeBaseID).
+		Where("source_id IN ? OR target_id IN ?", entityIDs, entityIDs).
+		Find(&relationships).Error; err != nil {
+		return nil, err
+	}
+	return relationships, nil
+}
+
+// GetGraph gets the entities and relationships of a knowledge base
+func (r *graphRepository) GetGraph(ctx context.Context, knowledgeBaseID string) (*types.KnowledgeGraph, error) {
+	return getGraph(r.db.WithContext(ctx), knowledgeBaseID)
+}
+
+// getGraph gets the entities and relationships of a knowledge base
+func getGraph(db *gorm.DB, knowledgeBaseID string) (*types.KnowledgeGraph, error) {
+	graph := &types.KnowledgeGraph{}
+	if err := db.Where("knowledge_base_id = ?", knowledgeBaseID).
+		Order("id ASC").
+		Find(&graph.Entities).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("knowledge_base_id = ?", knowledgeBaseID).
+		Order("id ASC").
+		Find(&graph.Relationships).Error; err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+func TestInsertGraphEntities(t *testing.T) {
+	db, recorder := newDryRunDB(t, "postgres")
+	entities := []*types.GraphEntity{
+		{ID: "e2", KnowledgeBaseID: "kb", Title: "WeKnora", TitleKey: "weknora"},
+		{ID: "e1", KnowledgeBaseID: "kb", Title: "Tencent", TitleKey: "tencent"},
+	}
+	if err := insertGraphEntities(db, entities); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	statement := recorder.last()
+	assertContains(t, statement, `INSERT INTO "graph_entities"`,
+		`ON CONFLICT ("knowledge_base_id","title_key") DO NOTHING`)
+	if strings.Index(statement, "'tencent'") > strings.Index(statement, "'weknora'") {
+		t.Errorf("Expected the entities to be inserted by title key, got %s", statement)
+	}
+	if entities[0].ID != "e2" {
+		t.Error("Expected the entities of the caller to keep their order")
+	}
+
+	recorder.statements = nil
+	if err := insertGraphEntities(db, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(recorder.statements) != 0 {
+		t.Errorf("Expected no statement without entities, got %v", recorder.statements)
+	}
+}
+
+func TestLockGraphScope(t *testing.T) {
+	scope := &types.GraphScope{
+		Entities:     []*types.GraphEntity{{TitleKey: "tencent"}},
+		KnowledgeIDs: []string{"k1", "k2"},
+	}
+
+	t.Run("postgres", func(t *testing.T) {
+		db, recorder := newDryRunDB(t, "postgres")
+		if _, err := lockGraphScope(db, "kb", scope); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(recorder.statements) != 1 {
+			t.Fatalf("Expected a single entity query, got %v", recorder.statements)
+		}
+		assertContains(t, recorder.last(), `FROM "graph_entities"`, "knowledge_base_id = 'kb'",
+			"title_key IN ('tencent') OR EXISTS (SELECT 1 FROM jsonb_array_elements_text(knowledge_ids) "+
+				"WHERE value IN ('k1','k2'))",
+			"FOR UPDATE")
+	})
+
+	t.Run("mysql", func(t *testing.T) {
+		db, recorder := newDryRunDB(t, "mysql")
+		if _, err := lockGraphScope(db, "kb", scope); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertContains(t, recorder.last(), `JSON_OVERLAPS(knowledge_ids, '["k1","k2"]')`, "FOR UPDATE")
+	})
+
+	t.Run("empty scope", func(t *testing.T) {
+		db, recorder := newDryRunDB(t, "postgres")
+		graph, err := lockGraphScope(db, "kb", &types.GraphScope{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(recorder.statements) != 0 || len(graph.Entities) != 0 {
+			t.Errorf("Expected nothing to be loaded, got %v", recorder.statements)
+		}
+	})
+}
+
+func TestSaveGraphChanges(t *testing.T) {
+	db, recorder := newDryRunDB(t, "postgres")
+	changes := &types.GraphChanges{
+		DeleteRelationshipIDs: []string{"r1"},
+		DeleteEntityIDs:       []string{"e1"},
+		SaveEntities: []*types.GraphEntity{
+			{ID: "e2", KnowledgeBaseID: "kb", Title: "WeKnora", TitleKey: "weknora"},
+		},
+		SaveRelationships: []*types.GraphRelationship{
+			{ID: "r2", KnowledgeBaseID: "kb", SourceID: "e2", TargetID: "e3"},
+		},
+	}
+	if err := saveGraphChanges(db, "kb", changes); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(recorder.statements) != 4 {
+		t.Fatalf("Expected 4 statements, got %v", recorder.statements)
+	}
+	assertContains(t, recorder.statements[0], `DELETE FROM "graph_relationships"`, "id IN ('r1')")
+	assertContains(t, recorder.statements[1], `DELETE FROM "graph_entities"`, "id IN ('e1')")
+	assertContains(t, recorder.statements[2], `INSERT INTO "graph_entities"`,
+		`ON CONFLICT ("knowledge_base_id","title_key") DO UPDATE SET`, `"sources"="excluded"."sources"`)
+	assertContains(t, recorder.statements[3], `INSERT INTO "graph_relationships"`,
+		`ON CONFLICT ("knowledge_base_id","source_id","target_id") DO UPDATE SET`)
+	for _, statement := range recorder.statements {
+		if strings.Contains(statement, "knowledge_bases") {
+			t.Errorf("Expected the knowledge base not to be touched, got %s", statement)
+		}
+	}
+}
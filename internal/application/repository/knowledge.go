@@ -3,14 +3,15 @@ package repository
 import (
 	"context"
 	"errors"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Tencent/WeKnora/internal/types"
 	"github.com/Tencent/WeKnora/internal/types/interfaces"
 	"gorm.io/gorm"
 )
 
-var ErrKnowledgeNotFound = errors.New("knowledge not found")
-
 // knowledgeRepository implements knowledge base and knowledge repository interface
 type knowledgeRepository struct {
 	db *gorm.DB
@@ -32,7 +33,7 @@ func (r *knowledgeRepository) GetKnowledgeByID(ctx context.Context, tenantID uin
 	var knowledge types.Knowledge
 	if err := r.db.WithContext(ctx).Where("tenant_id = ? AND id = ?", tenantID, id).First(&knowledge).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrKnowledgeNotFound
+			return nil, types.ErrKnowledgeNotFound
 		}
 		return nil, err
 	}
@@ -51,6 +52,19 @@ func (r *knowledgeRepository) ListKnowledgeByKnowledgeBaseID(
 	return knowledges, nil
 }
 
+// ListKnowledgeDueForRefresh lists the URL knowledge of all tenants whose scheduled refresh is due
+func (r *knowledgeRepository) ListKnowledgeDueForRefresh(
+	ctx context.Context, now time.Time, limit int,
+) ([]*types.Knowledge, error) {
+	var knowledges []*types.Knowledge
+	if err := r.db.WithContext(ctx).
+		Where("type = ? AND refresh_interval > 0 AND next_refresh_at <= ?", "url", now).
+		Order("next_refresh_at ASC").Limit(limit).Find(&knowledges).Error; err != nil {
+		return nil, err
+	}
+	return knowledges, nil
+}
+
 // ListPagedKnowledgeByKnowledgeBaseID lists all knowledge in a knowledge base with pagination
 func (r *knowledgeRepository) ListPagedKnowledgeByKnowledgeBaseID(
 	ctx context.Context,
@@ -202,3 +216,66 @@ func (r *knowledgeRepository) UpdateKnowledgeColumn(ctx context.Context, id stri
 	err := r.db.WithContext(ctx).Model(&types.Knowledge{}).Where("id = ?", id).Update(column, value).Error
 	return err
 }
+
+// UpdateKnowledgeColumns updates the given columns of a knowledge without touching the others
+func (r *knowledgeRepository) UpdateKnowledgeColumns(ctx context.Context,
+	id string, columns map[string]interface{},
+) error {
+	return r.db.WithContext(ctx).Model(&types.Knowledge{}).Where("id = ?", id).Updates(columns).Error
+}
+
+// ListKnowledgeIDsByFilter lists at most limit IDs of the knowledge in the knowledge bases matching the search filter
+func (r *knowledgeRepository) ListKnowledgeIDsByFilter(ctx context.Context,
+	tenantID uint, kbIDs []string, filter *types.SearchFilter, limit int,
+) ([]string, error) {
+	query := r.db.WithContext(ctx).Model(&types.Knowledge{}).Where("tenant_id = ?", tenantID)
+	if len(kbIDs) > 0 {
+		query = query.Where("knowledge_base_id IN ?", kbIDs)
+	}
+	if filter != nil {
+		if len(filter.KnowledgeIDs) > 0 {
+			query = query.Where("id IN ?", filter.KnowledgeIDs)
+		}
+		if len(filter.FileTypes) > 0 {
+			fileTypes := make([]string, 0, len(filter.FileTypes))
+			for _, fileType := range filter.FileTypes {
+				fileTypes = append(fileTypes, strings.ToLower(strings.TrimPrefix(fileType, ".")))
+			}
+			query = query.Where("LOWER(file_type) IN ?", fileTypes)
+		}
+		if filter.CreatedAfter != nil {
+			query = query.Where("created_at >= ?", *filter.CreatedAfter)
+		}
+		if filter.CreatedBefore != nil {
+			query = query.Where("created_at < ?", *filter.CreatedBefore)
+		}
+		// Metadata is stored as JSON, the expressions differ between databases
+		isMySQL := r.db.Dialector.Name() == "mysql"
+		for _, tag := range filter.Tags {
+			if isMySQL {
+				query = query.Where(
+					"FIND_IN_SET(?, REPLACE(JSON_UNQUOTE(JSON_EXTRACT(metadata, '$.tags')), ' ', '')) > 0",
+					strings.TrimSpace(tag),
+				)
+			} else {
+				query = query.Where(
+					"? = ANY(regexp_split_to_array(trim(metadata ->> 'tags'), '\\s*,\\s*'))",
+					strings.TrimSpace(tag),
+				)
+			}
+		}
+		for key, value := range filter.Metadata {
+			if isMySQL {
+				query = query.Where("JSON_UNQUOTE(JSON_EXTRACT(metadata, ?)) = ?", "$."+strconv.Quote(key), value)
+			} else {
+				query = query.Where("metadata ->> ? = ?", key, value)
+			}
+		}
+	}
+
+	knowledgeIDs := []string{}
+	if err := query.Limit(limit).Pluck("id", &knowledgeIDs).Error; err != nil {
+		return nil, err
+	}
+	return knowledgeIDs, nil
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+func TestListKnowledgeIDsByFilter(t *testing.T) {
+	createdAfter := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	filter := &types.SearchFilter{
+		KnowledgeIDs: []string{"k1", "k2"},
+		FileTypes:    []string{".PDF", "docx"},
+		Tags:         []string{" finance "},
+		CreatedAfter: &createdAfter,
+		Metadata:     map[string]string{"team": "risk"},
+	}
+
+	t.Run("postgres", func(t *testing.T) {
+		db, recorder := newDryRunDB(t, "postgres")
+		_, err := NewKnowledgeRepository(db).ListKnowledgeIDsByFilter(context.Background(), 1, []string{"kb"}, filter, 100)
+		if !isDryRun(err) {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertContains(t, recorder.last(), `FROM "knowledges"`, "tenant_id = 1", "knowledge_base_id IN ('kb')",
+			"id IN ('k1','k2')", "LOWER(file_type) IN ('pdf','docx')", "created_at >= '2025-03-01 00:00:00'",
+			`'finance' = ANY(regexp_split_to_array(trim(metadata ->> 'tags'), '\s*,\s*'))`,
+			"metadata ->> 'team' = 'risk'", "LIMIT 100")
+	})
+
+	t.Run("mysql", func(t *testing.T) {
+		db, recorder := newDryRunDB(t, "mysql")
+		_, err := NewKnowledgeRepository(db).ListKnowledgeIDsByFilter(context.Background(), 1, []string{"kb"}, filter, 100)
+		if !isDryRun(err) {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertContains(t, recorder.last(),
+			"FIND_IN_SET('finance', REPLACE(JSON_UNQUOTE(JSON_EXTRACT(metadata, '$.tags')), ' ', '')) > 0",
+			`JSON_UNQUOTE(JSON_EXTRACT(metadata, '$."team"')) = 'risk'`, "LIMIT 100")
+	})
+}
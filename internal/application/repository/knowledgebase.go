@@ -3,14 +3,13 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/Tencent/WeKnora/internal/types"
 	"github.com/Tencent/WeKnora/internal/types/interfaces"
 	"gorm.io/gorm"
 )
 
-var ErrKnowledgeBaseNotFound = errors.New("knowledge base not found")
-
 // knowledgeBaseRepository implements the KnowledgeBaseRepository interface
 type knowledgeBaseRepository struct {
 	db *gorm.DB
@@ -31,7 +30,7 @@ func (r *knowledgeBaseRepository) GetKnowledgeBaseByID(ctx context.Context, id s
 	var kb types.KnowledgeBase
 	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&kb).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrKnowledgeBaseNotFound
+			return nil, types.ErrKnowledgeBaseNotFound
 		}
 		return nil, err
 	}
@@ -64,6 +63,23 @@ func (r *knowledgeBaseRepository) UpdateKnowledgeBase(ctx context.Context, kb *t
 	return r.db.WithContext(ctx).Save(kb).Error
 }
 
+// UpdateEmbeddingModel switches the embedding model of a knowledge base and of its knowledge
+func (r *knowledgeBaseRepository) UpdateEmbeddingModel(ctx context.Context, id string, modelID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&types.KnowledgeBase{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"embedding_model_id": modelID, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return types.ErrKnowledgeBaseNotFound
+		}
+		return tx.Model(&types.Knowledge{}).Where("knowledge_base_id = ?", id).
+			UpdateColumn("embedding_model_id", modelID).Error
+	})
+}
+
 // DeleteKnowledgeBase deletes a knowledge base
 func (r *knowledgeBaseRepository) DeleteKnowledgeBase(ctx context.Context, id string) error {
 	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&types.KnowledgeBase{}).Error
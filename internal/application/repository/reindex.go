@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"gorm.io/gorm"
+)
+
+// reindexJobRepository implements the ReindexJobRepository interface
+type reindexJobRepository struct {
+	db *gorm.DB
+}
+
+// NewReindexJobRepository creates a new reindex job repository
+func NewReindexJobRepository(db *gorm.DB) interfaces.ReindexJobRepository {
+	return &reindexJobRepository{db: db}
+}
+
+// CreateJob creates a new reindex job
+func (r *reindexJobRepository) CreateJob(ctx context.Context, job *types.ReindexJob) error {
+	return r.db.WithContext(ctx).Create(job).Error
+}
+
+// GetJobByID gets a reindex job by id
+func (r *reindexJobRepository) GetJobByID(ctx context.Context, tenantID uint, id string) (*types.ReindexJob, error) {
+	var job types.ReindexJob
+	if err := r.db.WithContext(ctx).Where("tenant_id = ? AND id = ?", tenantID, id).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, types.ErrReindexJobNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetActiveJobByKnowledgeBaseID gets the pending or running reindex job of a knowledge base
+// Returns nil when the knowledge base has no active job
+func (r *reindexJobRepository) GetActiveJobByKnowledgeBaseID(
+	ctx context.Context, tenantID uint, knowledgeBaseID string,
+) (*types.ReindexJob, error) {
+	var jobs []*types.ReindexJob
+	if err := r.db.WithContext(ctx).
+		Where("tenant_id = ? AND knowledge_base_id = ? AND status IN ?", tenantID, knowledgeBaseID,
+			[]types.ReindexJobStatus{types.ReindexJobPending, types.ReindexJobRunning}).
+		Order("created_at DESC").Limit(1).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return jobs[0], nil
+}
+
+// UpdateJobProgress saves the progress of a running job
+// Returns false when the job is no longer running, e.g. it has been cancelled
+func (r *reindexJobRepository) UpdateJobProgress(ctx context.Context, job *types.ReindexJob) (bool, error) {
+	job.UpdatedAt = time.Now()
+	result := r.db.WithContext(ctx).Model(&types.ReindexJob{}).
+		Where("tenant_id = ? AND id = ? AND status = ?", job.TenantID, job.ID, types.ReindexJobRunning).
+		Updates(map[string]interface{}{
+			"processed_chunks":      job.ProcessedChunks,
+			"total_chunks":          job.TotalChunks,
+			"last_chunk_created_at": job.LastChunkCreatedAt,
+			"last_chunk_id":         job.LastChunkID,
+			"updated_at":            job.UpdatedAt,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateJobStatus moves a job to the given status if its current status is one of from
+// Returns false when the job is not in any of the from statuses
+func (r *reindexJobRepository) UpdateJobStatus(ctx context.Context, job *types.ReindexJob,
+	from []types.ReindexJobStatus, to types.ReindexJobStatus,
+) (bool, error) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":        to,
+		"error_message": job.ErrorMessage,
+		"updated_at":    now,
+	}
+	if (&types.ReindexJob{Status: to}).Finished() {
+		updates["finished_at"] = now
+	}
+	result := r.db.WithContext(ctx).Model(&types.ReindexJob{}).
+		Where("tenant_id = ? AND id = ? AND status IN ?", job.TenantID, job.ID, from).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	job.Status = to
+	job.UpdatedAt = now
+	if _, ok := updates["finished_at"]; ok {
+		job.FinishedAt = &now
+	}
+	return true, nil
+}
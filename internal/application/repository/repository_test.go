@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlRecorder records the statements built by a dry run database
+type sqlRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *sqlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+// last returns the last recorded statement
+func (r *sqlRecorder) last() string {
+	if len(r.statements) == 0 {
+		return ""
+	}
+	return r.statements[len(r.statements)-1]
+}
+
+// mysqlDialector reports the mysql dialect to exercise the MySQL branches of the queries
+type mysqlDialector struct {
+	gorm.Dialector
+}
+
+func (mysqlDialector) Name() string {
+	return "mysql"
+}
+
+// newDryRunDB returns a database that builds the statements without executing them
+func newDryRunDB(t *testing.T, dialect string) (*gorm.DB, *sqlRecorder) {
+	t.Helper()
+	recorder := &sqlRecorder{Interface: logger.Discard}
+	var dialector gorm.Dialector = postgres.New(postgres.Config{DSN: "host=localhost"})
+	if dialect == "mysql" {
+		dialector = mysqlDialector{Dialector: dialector}
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 recorder,
+	})
+	if err != nil {
+		t.Fatalf("open dry run database: %v", err)
+	}
+	return db, recorder
+}
+
+// assertContains fails the test when the statement lacks one of the fragments
+func assertContains(t *testing.T, statement string, fragments ...string) {
+	t.Helper()
+	for _, fragment := range fragments {
+		if !strings.Contains(statement, fragment) {
+			t.Errorf("Expected %q in statement %s", fragment, statement)
+		}
+	}
+}
@@ -298,6 +298,110 @@ func (e *elasticsearchRepository) DeleteByKnowledgeIDList(ctx context.Context,
 	return e.deleteByFieldList(ctx, "knowledge_id.keyword", knowledgeIDList)
 }
 
+// DeleteByKnowledgeBaseID Delete all indices of a knowledge base
+func (e *elasticsearchRepository) DeleteByKnowledgeBaseID(ctx context.Context, knowledgeBaseID string) error {
+	return e.deleteByFieldList(ctx, "knowledge_base_id.keyword", []string{knowledgeBaseID})
+}
+
+// SwapKnowledgeBaseIndices Replace the indices of a knowledge base with the staged indices
+// Elasticsearch has no multi-document transaction, so the old documents are removed first
+// and the staged documents are relabelled right after
+func (e *elasticsearchRepository) SwapKnowledgeBaseIndices(ctx context.Context,
+	knowledgeBaseID string, stagingKnowledgeBaseID string,
+) error {
+	log := logger.GetLogger(ctx)
+	log.Infof("[ElasticsearchV7] Swapping indices of knowledge base %s with staged indices %s",
+		knowledgeBaseID, stagingKnowledgeBaseID)
+	stagingQuery := map[string]interface{}{
+		"term": map[string]interface{}{"knowledge_base_id.keyword": stagingKnowledgeBaseID},
+	}
+
+	// Nothing staged means the swap already happened, keep the current documents
+	staged, err := e.count(ctx, stagingQuery)
+	if err != nil {
+		return err
+	}
+	if staged == 0 {
+		log.Warnf("[ElasticsearchV7] No staged indices found for %s, skipping swap", stagingKnowledgeBaseID)
+		return nil
+	}
+	if err := e.DeleteByKnowledgeBaseID(ctx, knowledgeBaseID); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"query": stagingQuery,
+		"script": map[string]interface{}{
+			"source": "ctx._source.knowledge_base_id = params.knowledge_base_id; " +
+				"ctx._source.source_type = params.source_type",
+			"params": map[string]interface{}{
+				"knowledge_base_id": knowledgeBaseID,
+				"source_type":       int(typesLocal.ChunkSourceType),
+			},
+		},
+	})
+	if err != nil {
+		log.Errorf("[ElasticsearchV7] Failed to marshal update by query: %v", err)
+		return err
+	}
+
+	resp, err := e.client.UpdateByQuery(
+		[]string{e.index},
+		e.client.UpdateByQuery.WithBody(bytes.NewReader(body)),
+		e.client.UpdateByQuery.WithRefresh(true),
+		e.client.UpdateByQuery.WithConflicts("proceed"),
+		e.client.UpdateByQuery.WithContext(ctx),
+	)
+	if err != nil {
+		log.Errorf("[ElasticsearchV7] Failed to execute update by query: %v", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		log.Errorf("[ElasticsearchV7] Failed to relabel staged indices: %s", resp.String())
+		return fmt.Errorf("failed to update by query: %s", resp.String())
+	}
+
+	log.Infof("[ElasticsearchV7] Successfully swapped indices of knowledge base %s", knowledgeBaseID)
+	return nil
+}
+
+// count Count the documents matching the query
+func (e *elasticsearchRepository) count(ctx context.Context, query map[string]interface{}) (int64, error) {
+	log := logger.GetLogger(ctx)
+	body, err := json.Marshal(map[string]interface{}{"query": query})
+	if err != nil {
+		log.Errorf("[ElasticsearchV7] Failed to marshal count query: %v", err)
+		return 0, err
+	}
+
+	resp, err := e.client.Count(
+		e.client.Count.WithIndex(e.index),
+		e.client.Count.WithBody(bytes.NewReader(body)),
+		e.client.Count.WithContext(ctx),
+	)
+	if err != nil {
+		log.Errorf("[ElasticsearchV7] Failed to execute count: %v", err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		log.Errorf("[ElasticsearchV7] Failed to count documents: %s", resp.String())
+		return 0, fmt.Errorf("failed to count: %s", resp.String())
+	}
+
+	var countResponse struct {
+		Count int64 `json:"count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&countResponse); err != nil {
+		log.Errorf("[ElasticsearchV7] Failed to decode count response: %v", err)
+		return 0, err
+	}
+	return countResponse.Count, nil
+}
+
 // deleteByFieldList Delete documents by field value list
 func (e *elasticsearchRepository) deleteByFieldList(ctx context.Context, field string, valueList []string) error {
 	log := logger.GetLogger(ctx)
@@ -358,6 +462,10 @@ func (e *elasticsearchRepository) getBaseConds(params typesLocal.RetrieveParams)
 		ids, _ := json.Marshal(params.KnowledgeBaseIDs)
 		must = append(must, fmt.Sprintf(`{"terms": {"knowledge_base_id.keyword": %s}}`, ids))
 	}
+	if len(params.KnowledgeIDs) > 0 {
+		ids, _ := json.Marshal(params.KnowledgeIDs)
+		must = append(must, fmt.Sprintf(`{"terms": {"knowledge_id.keyword": %s}}`, ids))
+	}
 
 	// Build MUST_NOT conditions (negative filters)
 	mustNot := make([]string, 0)
@@ -208,6 +208,71 @@ func (e *elasticsearchRepository) DeleteByKnowledgeIDList(ctx context.Context,
 	return nil
 }
 
+// DeleteByKnowledgeBaseID removes all documents of a knowledge base from the index
+// Returns an error if the delete operation fails
+func (e *elasticsearchRepository) DeleteByKnowledgeBaseID(ctx context.Context, knowledgeBaseID string) error {
+	log := logger.GetLogger(ctx)
+	log.Infof("[Elasticsearch] Deleting indices by knowledge base ID: %s", knowledgeBaseID)
+	_, err := e.client.DeleteByQuery(e.index).Query(&types.Query{
+		Term: map[string]types.TermQuery{"knowledge_base_id.keyword": {Value: knowledgeBaseID}},
+	}).Refresh(true).Do(ctx)
+	if err != nil {
+		log.Errorf("[Elasticsearch] Failed to delete by knowledge base ID: %v", err)
+		return fmt.Errorf("failed to delete by query: %w", err)
+	}
+
+	log.Infof("[Elasticsearch] Successfully deleted documents by knowledge base ID")
+	return nil
+}
+
+// SwapKnowledgeBaseIndices replaces the documents of a knowledge base with the staged documents
+// Elasticsearch has no multi-document transaction, so the old documents are removed first
+// and the staged documents are relabelled right after
+func (e *elasticsearchRepository) SwapKnowledgeBaseIndices(ctx context.Context,
+	knowledgeBaseID string, stagingKnowledgeBaseID string,
+) error {
+	log := logger.GetLogger(ctx)
+	log.Infof("[Elasticsearch] Swapping indices of knowledge base %s with staged indices %s",
+		knowledgeBaseID, stagingKnowledgeBaseID)
+	stagingQuery := &types.Query{
+		Term: map[string]types.TermQuery{"knowledge_base_id.keyword": {Value: stagingKnowledgeBaseID}},
+	}
+	// Nothing staged means the swap already happened, keep the current documents
+	countResp, err := e.client.Count().Index(e.index).Query(stagingQuery).Do(ctx)
+	if err != nil {
+		log.Errorf("[Elasticsearch] Failed to count staged indices: %v", err)
+		return fmt.Errorf("failed to count staged indices: %w", err)
+	}
+	if countResp.Count == 0 {
+		log.Warnf("[Elasticsearch] No staged indices found for %s, skipping swap", stagingKnowledgeBaseID)
+		return nil
+	}
+	if err := e.DeleteByKnowledgeBaseID(ctx, knowledgeBaseID); err != nil {
+		return err
+	}
+
+	kbID, err := json.Marshal(knowledgeBaseID)
+	if err != nil {
+		return err
+	}
+	sourceType, err := json.Marshal(int(typesLocal.ChunkSourceType))
+	if err != nil {
+		return err
+	}
+	source := "ctx._source.knowledge_base_id = params.knowledge_base_id; ctx._source.source_type = params.source_type"
+	_, err = e.client.UpdateByQuery(e.index).Query(stagingQuery).Script(&types.Script{
+		Source: &source,
+		Params: map[string]json.RawMessage{"knowledge_base_id": kbID, "source_type": sourceType},
+	}).Refresh(true).Do(ctx)
+	if err != nil {
+		log.Errorf("[Elasticsearch] Failed to relabel staged indices: %v", err)
+		return fmt.Errorf("failed to update by query: %w", err)
+	}
+
+	log.Infof("[Elasticsearch] Successfully swapped indices of knowledge base %s", knowledgeBaseID)
+	return nil
+}
+
 // getBaseConds creates the base query conditions for retrieval operations
 // Returns a slice of Query objects with must and must_not conditions
 func (e *elasticsearchRepository) getBaseConds(params typesLocal.RetrieveParams) []types.Query {
@@ -219,6 +284,11 @@ func (e *elasticsearchRepository) getBaseConds(params typesLocal.RetrieveParams)
 			},
 		}})
 	}
+	if len(params.KnowledgeIDs) > 0 {
+		must = append(must, types.Query{Terms: &types.TermsQuery{
+			TermsQuery: map[string]types.TermsQueryField{"knowledge_id.keyword": params.KnowledgeIDs},
+		}})
+	}
 	mustNot := make([]types.Query, 0)
 	if len(params.ExcludeKnowledgeIDs) > 0 {
 		mustNot = append(mustNot, types.Query{Terms: &types.TermsQuery{
@@ -3,6 +3,7 @@ package neo4j
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/Tencent/WeKnora/internal/logger"
@@ -118,10 +119,18 @@ func (n *Neo4jRepository) DelGraph(ctx context.Context, namespaces []types.NameS
 	result, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
 		for _, namespace := range namespaces {
 			labelExpr := n.Label(namespace)
+			if labelExpr == "" {
+				continue
+			}
+			// The nodes of a whole knowledge base are selected by its label alone
+			nodeProps := ""
+			if namespace.Knowledge != "" {
+				nodeProps = " {kg: $knowledge_id}"
+			}
 
 			deleteRelsQuery := `
 				CALL apoc.periodic.iterate(
-					"MATCH (n:` + labelExpr + ` {kg: $knowledge_id})-[r]-(m:` + labelExpr + ` {kg: $knowledge_id}) RETURN r",
+					"MATCH (n:` + labelExpr + nodeProps + `)-[r]-(m:` + labelExpr + nodeProps + `) RETURN r",
 					"DELETE r",
 					{batchSize: 1000, parallel: true, params: {knowledge_id: $knowledge_id}}
 				) YIELD batches, total
@@ -133,7 +142,7 @@ func (n *Neo4jRepository) DelGraph(ctx context.Context, namespaces []types.NameS
 
 			deleteNodesQuery := `
 				CALL apoc.periodic.iterate(
-					"MATCH (n:` + labelExpr + ` {kg: $knowledge_id}) RETURN n",
+					"MATCH (n:` + labelExpr + nodeProps + `) RETURN n",
 					"DELETE n",
 					{batchSize: 1000, parallel: true, params: {knowledge_id: $knowledge_id}}
 				) YIELD batches, total
@@ -152,6 +161,89 @@ func (n *Neo4jRepository) DelGraph(ctx context.Context, namespaces []types.NameS
 	return nil
 }
 
+// DelChunks implements interfaces.RetrieveGraphRepository.
+func (n *Neo4jRepository) DelChunks(ctx context.Context, namespace types.NameSpace, chunkIDs []string) error {
+	if n.driver == nil {
+		logger.Warnf(ctx, "NOT SUPPORT RETRIEVE GRAPH")
+		return nil
+	}
+	labelExpr := n.Label(namespace)
+	if labelExpr == "" || len(chunkIDs) == 0 {
+		return nil
+	}
+	session := n.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		// Nodes emptied by this delete go with their relations, and so do their neighbours created only by
+		// relations once they have none left. Other nodes without chunks are left alone
+		pruneQuery := `
+			MATCH (n:` + labelExpr + `)
+			WHERE ANY(chunk IN n.chunks WHERE chunk IN $chunks)
+			SET n.chunks = [chunk IN n.chunks WHERE NOT chunk IN $chunks]
+			WITH n WHERE size(n.chunks) = 0
+			OPTIONAL MATCH (n)--(m:` + labelExpr + `)
+			WHERE size(coalesce(m.chunks, [])) = 0
+			WITH collect(DISTINCT n) AS emptied, collect(DISTINCT m) AS candidates
+			WITH emptied, [m IN candidates WHERE NOT m IN emptied] AS neighbours
+			FOREACH (e IN emptied | DETACH DELETE e)
+			WITH neighbours
+			UNWIND neighbours AS m
+			WITH m WHERE NOT EXISTS { (m)--() }
+			DELETE m
+		`
+		if _, err := tx.Run(ctx, pruneQuery, map[string]interface{}{"chunks": chunkIDs}); err != nil {
+			return nil, fmt.Errorf("failed to remove chunks from nodes: %v", err)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		logger.Errorf(ctx, "delete graph chunks failed: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ListChunkIDs implements interfaces.RetrieveGraphRepository.
+func (n *Neo4jRepository) ListChunkIDs(ctx context.Context, namespace types.NameSpace) ([]string, error) {
+	if n.driver == nil {
+		logger.Warnf(ctx, "NOT SUPPORT RETRIEVE GRAPH")
+		return nil, nil
+	}
+	labelExpr := n.Label(namespace)
+	if labelExpr == "" {
+		return nil, nil
+	}
+	session := n.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		query := `
+			MATCH (n:` + labelExpr + `)
+			UNWIND coalesce(n.chunks, []) AS chunk
+			RETURN DISTINCT chunk
+		`
+		result, err := tx.Run(ctx, query, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run query: %v", err)
+		}
+		chunkIDs := []string{}
+		for result.Next(ctx) {
+			chunk, _ := result.Record().Get("chunk")
+			chunkIDs = append(chunkIDs, fmt.Sprintf("%v", chunk))
+		}
+		if err := result.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read chunks: %v", err)
+		}
+		return chunkIDs, nil
+	})
+	if err != nil {
+		logger.Errorf(ctx, "list graph chunks failed: %v", err)
+		return nil, err
+	}
+	return result.([]string), nil
+}
+
 func (n *Neo4jRepository) SearchNode(ctx context.Context, namespace types.NameSpace, nodes []string) (*types.GraphData, error) {
 	if n.driver == nil {
 		logger.Warnf(ctx, "NOT SUPPORT RETRIEVE GRAPH")
@@ -214,6 +306,87 @@ func (n *Neo4jRepository) SearchNode(ctx context.Context, namespace types.NameSp
 	return result.(*types.GraphData), nil
 }
 
+// SearchPath implements interfaces.RetrieveGraphRepository.
+func (n *Neo4jRepository) SearchPath(ctx context.Context,
+	namespace types.NameSpace, query *types.GraphPathQuery,
+) ([]*types.GraphPath, error) {
+	if n.driver == nil {
+		logger.Warnf(ctx, "NOT SUPPORT RETRIEVE GRAPH")
+		return nil, nil
+	}
+	if len(query.Entities) == 0 || query.MaxHops <= 0 {
+		return nil, nil
+	}
+	session := n.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		labelExpr := n.Label(namespace)
+		// The bounds of a variable length pattern can not be parameters
+		cypher := `
+			MATCH p = (n:` + labelExpr + `)-[*1..` + strconv.Itoa(query.MaxHops) + `]-(m:` + labelExpr + `)
+			WHERE ANY(nodeText IN $nodes WHERE n.name CONTAINS nodeText)
+			AND (size($types) = 0 OR ALL(r IN relationships(p) WHERE type(r) IN $types))
+			RETURN p
+			LIMIT $limit
+		`
+		relationTypes := query.RelationTypes
+		if relationTypes == nil {
+			relationTypes = []string{}
+		}
+		params := map[string]interface{}{
+			"nodes": query.Entities,
+			"types": relationTypes,
+			"limit": query.CandidateLimit(),
+		}
+		result, err := tx.Run(ctx, cypher, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run query: %v", err)
+		}
+
+		paths := []*types.GraphPath{}
+		for result.Next(ctx) {
+			value, _ := result.Record().Get("p")
+			paths = append(paths, toGraphPath(value.(neo4j.Path)))
+		}
+		if err := result.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read paths: %v", err)
+		}
+		return paths, nil
+	})
+	if err != nil {
+		logger.Errorf(ctx, "search path failed: %v", err)
+		return nil, err
+	}
+	return types.RankGraphPaths(result.([]*types.GraphPath), query.Entities, query.Limit), nil
+}
+
+// toGraphPath converts a Neo4j path, keeping the direction of its relationships
+func toGraphPath(path neo4j.Path) *types.GraphPath {
+	graphPath := &types.GraphPath{}
+	names := make(map[string]string, len(path.Nodes))
+	for _, node := range path.Nodes {
+		name, _ := node.Props["name"].(string)
+		names[node.ElementId] = name
+		graphNode := &types.GraphNode{Name: name}
+		if chunks, ok := node.Props["chunks"].([]interface{}); ok {
+			graphNode.Chunks = listI2listS(chunks)
+		}
+		if attributes, ok := node.Props["attributes"].([]interface{}); ok {
+			graphNode.Attributes = listI2listS(attributes)
+		}
+		graphPath.Nodes = append(graphPath.Nodes, graphNode)
+	}
+	for _, relationship := range path.Relationships {
+		graphPath.Relations = append(graphPath.Relations, &types.GraphRelation{
+			Node1: names[relationship.StartElementId],
+			Node2: names[relationship.EndElementId],
+			Type:  relationship.Type,
+		})
+	}
+	return graphPath
+}
+
 func listI2listS(list []any) []string {
 	result := make([]string, len(list))
 	for i, v := range list {
@@ -0,0 +1,515 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// searchNodeDepth is the number of relations walked from the nodes matched by SearchNode
+const searchNodeDepth = 1
+
+// pgGraphRepository implements the retrieval graph with node and edge tables in PostgreSQL
+type pgGraphRepository struct {
+	db *gorm.DB // Database connection
+}
+
+// NewPostgresGraphRepository creates a new PostgreSQL graph repository,
+// the graph_nodes and graph_edges tables are created by the paradedb migrations
+func NewPostgresGraphRepository(db *gorm.DB) (interfaces.RetrieveGraphRepository, error) {
+	logger.GetLogger(context.Background()).Info("[Postgres] Initializing PostgreSQL graph repository")
+	if name := db.Dialector.Name(); name != "postgres" {
+		return nil, fmt.Errorf("postgres graph driver requires a PostgreSQL database, got %s", name)
+	}
+	return &pgGraphRepository{db: db}, nil
+}
+
+// AddGraph merges the nodes and relations of the graphs into the namespace,
+// nodes are identified by name and accumulate the chunks and attributes they are extracted with
+func (r *pgGraphRepository) AddGraph(ctx context.Context, namespace types.NameSpace, graphs []*types.GraphData) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, graph := range graphs {
+			if err := r.addGraph(tx, namespace, graph); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf(ctx, "[Postgres] Failed to add graph: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *pgGraphRepository) addGraph(tx *gorm.DB, namespace types.NameSpace, graph *types.GraphData) error {
+	nodes := toDBGraphNodes(namespace, graph)
+	if len(nodes) == 0 {
+		return nil
+	}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "knowledge_base_id"}, {Name: "knowledge_id"}, {Name: "name"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "chunks"}, Value: unionJSONArray("chunks")},
+			{Column: clause.Column{Name: "attributes"}, Value: unionJSONArray("attributes")},
+			{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("EXCLUDED.updated_at")},
+		},
+	}).Create(&nodes).Error; err != nil {
+		return fmt.Errorf("failed to create nodes: %w", err)
+	}
+
+	nodeIDs := make(map[string]int64, len(nodes))
+	for _, node := range nodes {
+		nodeIDs[node.Name] = node.ID
+	}
+	edges := make([]*graphEdge, 0, len(graph.Relation))
+	for _, relation := range graph.Relation {
+		if relation.Node1 == "" || relation.Node2 == "" {
+			continue
+		}
+		edges = append(edges, &graphEdge{
+			KnowledgeBaseID: namespace.KnowledgeBase,
+			KnowledgeID:     namespace.Knowledge,
+			SourceID:        nodeIDs[relation.Node1],
+			TargetID:        nodeIDs[relation.Node2],
+			Type:            relation.Type,
+		})
+	}
+	if len(edges) == 0 {
+		return nil
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&edges).Error; err != nil {
+		return fmt.Errorf("failed to create relationships: %w", err)
+	}
+	return nil
+}
+
+// DelGraph deletes the nodes and relations of the namespaces
+func (r *pgGraphRepository) DelGraph(ctx context.Context, namespaces []types.NameSpace) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, namespace := range namespaces {
+			condition, args := namespaceCondition(namespace)
+			if condition == "" {
+				continue
+			}
+			if err := tx.Where(condition, args...).Delete(&graphEdge{}).Error; err != nil {
+				return fmt.Errorf("failed to delete relationships: %w", err)
+			}
+			if err := tx.Where(condition, args...).Delete(&graphNode{}).Error; err != nil {
+				return fmt.Errorf("failed to delete nodes: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// DelChunks removes the chunks from the nodes of the namespace. Nodes left without chunks by this delete are
+// removed with their edges, along with their chunkless neighbours left without edges
+func (r *pgGraphRepository) DelChunks(ctx context.Context, namespace types.NameSpace, chunkIDs []string) error {
+	scope, args := namespaceCondition(namespace)
+	if scope == "" || len(chunkIDs) == 0 {
+		return nil
+	}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		update := `
+			UPDATE graph_nodes SET
+				chunks = COALESCE((SELECT jsonb_agg(value) FROM jsonb_array_elements_text(chunks) WHERE value NOT IN ?), '[]'::jsonb),
+				updated_at = NOW()
+			WHERE ` + scope + ` AND EXISTS (SELECT 1 FROM jsonb_array_elements_text(chunks) WHERE value IN ?)
+			RETURNING id, jsonb_array_length(chunks) AS remaining
+		`
+		updateArgs := append([]interface{}{chunkIDs}, args...)
+		updateArgs = append(updateArgs, chunkIDs)
+		var rows []struct {
+			ID        int64
+			Remaining int
+		}
+		if err := tx.Raw(update, updateArgs...).Scan(&rows).Error; err != nil {
+			return fmt.Errorf("failed to remove chunks from nodes: %w", err)
+		}
+
+		var emptied []int64
+		for _, row := range rows {
+			if row.Remaining == 0 {
+				emptied = append(emptied, row.ID)
+			}
+		}
+		return sweepGraph(tx, emptied)
+	})
+	if err != nil {
+		logger.Errorf(ctx, "[Postgres] Failed to delete graph chunks: %v", err)
+		return err
+	}
+	return nil
+}
+
+// sweepGraph deletes the nodes emptied by a chunk delete and their edges. Their neighbours created only by
+// relations have no chunks either, those whose every edge leads to an emptied node go with them. Other
+// chunkless nodes are left alone, their relations still come from chunks of the knowledge
+func sweepGraph(tx *gorm.DB, emptied []int64) error {
+	if len(emptied) == 0 {
+		return nil
+	}
+	if err := tx.Where("id NOT IN ? AND chunks = '[]'::jsonb", emptied).
+		Where("id IN (SELECT target_id FROM graph_edges WHERE source_id IN ? "+
+			"UNION SELECT source_id FROM graph_edges WHERE target_id IN ?)", emptied, emptied).
+		Where("NOT EXISTS (SELECT 1 FROM graph_edges WHERE (graph_edges.source_id = graph_nodes.id "+
+			"OR graph_edges.target_id = graph_nodes.id) AND graph_edges.source_id NOT IN ? "+
+			"AND graph_edges.target_id NOT IN ?)", emptied, emptied).
+		Delete(&graphNode{}).Error; err != nil {
+		return fmt.Errorf("failed to delete orphaned nodes: %w", err)
+	}
+	if err := tx.Where("source_id IN ? OR target_id IN ?", emptied, emptied).
+		Delete(&graphEdge{}).Error; err != nil {
+		return fmt.Errorf("failed to delete relationships: %w", err)
+	}
+	if err := tx.Where("id IN ?", emptied).Delete(&graphNode{}).Error; err != nil {
+		return fmt.Errorf("failed to delete nodes: %w", err)
+	}
+	return nil
+}
+
+// ListChunkIDs returns the distinct chunks referenced by the nodes of the namespace
+func (r *pgGraphRepository) ListChunkIDs(ctx context.Context, namespace types.NameSpace) ([]string, error) {
+	scope, args := namespaceCondition(namespace)
+	if scope == "" {
+		return nil, nil
+	}
+	var chunkIDs []string
+	query := "SELECT DISTINCT jsonb_array_elements_text(chunks) FROM graph_nodes WHERE " + scope
+	if err := r.db.WithContext(ctx).Raw(query, args...).Scan(&chunkIDs).Error; err != nil {
+		logger.Errorf(ctx, "[Postgres] Failed to list graph chunks: %v", err)
+		return nil, err
+	}
+	return chunkIDs, nil
+}
+
+// SearchNode returns the relations within searchNodeDepth of the nodes whose name contains any of the given texts,
+// together with the nodes they connect
+func (r *pgGraphRepository) SearchNode(ctx context.Context,
+	namespace types.NameSpace, nodes []string,
+) (*types.GraphData, error) {
+	graph := &types.GraphData{}
+	scope, args := namespaceCondition(namespace)
+	if scope == "" {
+		return graph, nil
+	}
+	matches := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if node == "" {
+			continue
+		}
+		matches = append(matches, "strpos(name, ?) > 0")
+		args = append(args, node)
+	}
+	if len(matches) == 0 {
+		return graph, nil
+	}
+	args = append(args, searchNodeDepth, searchNodeDepth)
+
+	// Walk the edges from the matched nodes in both directions, then collect the edges touching the walked nodes
+	query := `
+		WITH RECURSIVE walk(node_id, depth) AS (
+			SELECT id, 0 FROM graph_nodes
+			WHERE ` + scope + ` AND (` + strings.Join(matches, " OR ") + `)
+			UNION
+			SELECT CASE WHEN e.source_id = w.node_id THEN e.target_id ELSE e.source_id END, w.depth + 1
+			FROM walk w JOIN graph_edges e ON e.source_id = w.node_id OR e.target_id = w.node_id
+			WHERE w.depth < ?
+		)
+		SELECT DISTINCT e.* FROM graph_edges e
+		JOIN walk w ON e.source_id = w.node_id OR e.target_id = w.node_id
+		WHERE w.depth < ?
+		ORDER BY e.id
+	`
+	var edges []*graphEdge
+	if err := r.db.WithContext(ctx).Raw(query, args...).Scan(&edges).Error; err != nil {
+		logger.Errorf(ctx, "[Postgres] Failed to search node: %v", err)
+		return nil, err
+	}
+	if len(edges) == 0 {
+		return graph, nil
+	}
+
+	nodeIDs := make([]int64, 0, len(edges)*2)
+	for _, edge := range edges {
+		nodeIDs = append(nodeIDs, edge.SourceID, edge.TargetID)
+	}
+	slices.Sort(nodeIDs)
+	var dbNodes []*graphNode
+	if err := r.db.WithContext(ctx).Where("id IN ?", slices.Compact(nodeIDs)).Find(&dbNodes).Error; err != nil {
+		logger.Errorf(ctx, "[Postgres] Failed to get nodes: %v", err)
+		return nil, err
+	}
+	return fromDBGraph(edges, dbNodes), nil
+}
+
+// SearchPath walks simple paths of at most query.MaxHops edges from the nodes whose name contains
+// any of the entities, optionally only along edges of the given types, and returns the best scored ones
+func (r *pgGraphRepository) SearchPath(ctx context.Context,
+	namespace types.NameSpace, query *types.GraphPathQuery,
+) ([]*types.GraphPath, error) {
+	scope, args := namespaceCondition(namespace)
+	if scope == "" || query.MaxHops <= 0 {
+		return nil, nil
+	}
+	matches := make([]string, 0, len(query.Entities))
+	for _, entity := range query.Entities {
+		if entity == "" {
+			continue
+		}
+		matches = append(matches, "strpos(name, ?) > 0")
+		args = append(args, entity)
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	args = append(args, query.MaxHops)
+	typeFilter := ""
+	if len(query.RelationTypes) > 0 {
+		typeFilter = "AND e.type IN ?"
+		args = append(args, query.RelationTypes)
+	}
+	args = append(args, query.CandidateLimit())
+
+	// Every row of walk is a path, node_ids and edge_ids record the nodes and edges in walk order
+	// and revisiting a node is not allowed. The recursion produces the paths breadth first and
+	// stops once the limit is reached, so the shortest paths are collected without walking the whole neighbourhood
+	sql := `
+		WITH RECURSIVE walk(node_id, node_ids, edge_ids, hops) AS (
+			SELECT id, ARRAY[id], ARRAY[]::bigint[], 0 FROM graph_nodes
+			WHERE ` + scope + ` AND (` + strings.Join(matches, " OR ") + `)
+			UNION ALL
+			SELECT next.node_id, w.node_ids || next.node_id, w.edge_ids || e.id, w.hops + 1
+			FROM walk w
+			JOIN graph_edges e ON e.source_id = w.node_id OR e.target_id = w.node_id
+			CROSS JOIN LATERAL (
+				SELECT CASE WHEN e.source_id = w.node_id THEN e.target_id ELSE e.source_id END AS node_id
+			) next
+			WHERE w.hops < ? AND next.node_id <> ALL(w.node_ids) ` + typeFilter + `
+		)
+		SELECT array_to_string(node_ids, ',') AS node_ids, array_to_string(edge_ids, ',') AS edge_ids
+		FROM walk WHERE hops > 0
+		LIMIT ?
+	`
+	var rows []struct {
+		NodeIDs string
+		EdgeIDs string
+	}
+	if err := r.db.WithContext(ctx).Raw(sql, args...).Scan(&rows).Error; err != nil {
+		logger.Errorf(ctx, "[Postgres] Failed to search path: %v", err)
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	pathNodeIDs := make([][]int64, len(rows))
+	pathEdgeIDs := make([][]int64, len(rows))
+	var nodeIDs, edgeIDs []int64
+	for i, row := range rows {
+		var err error
+		if pathNodeIDs[i], err = parseIDs(row.NodeIDs); err != nil {
+			return nil, err
+		}
+		if pathEdgeIDs[i], err = parseIDs(row.EdgeIDs); err != nil {
+			return nil, err
+		}
+		nodeIDs = append(nodeIDs, pathNodeIDs[i]...)
+		edgeIDs = append(edgeIDs, pathEdgeIDs[i]...)
+	}
+	slices.Sort(nodeIDs)
+	slices.Sort(edgeIDs)
+
+	var dbNodes []*graphNode
+	if err := r.db.WithContext(ctx).Where("id IN ?", slices.Compact(nodeIDs)).Find(&dbNodes).Error; err != nil {
+		logger.Errorf(ctx, "[Postgres] Failed to get nodes: %v", err)
+		return nil, err
+	}
+	var edges []*graphEdge
+	if err := r.db.WithContext(ctx).Where("id IN ?", slices.Compact(edgeIDs)).Find(&edges).Error; err != nil {
+		logger.Errorf(ctx, "[Postgres] Failed to get edges: %v", err)
+		return nil, err
+	}
+
+	paths := make([]*types.GraphPath, 0, len(rows))
+	for i := range rows {
+		if path := fromDBGraphPath(pathNodeIDs[i], pathEdgeIDs[i], dbNodes, edges); path != nil {
+			paths = append(paths, path)
+		}
+	}
+	return types.RankGraphPaths(paths, query.Entities, query.Limit), nil
+}
+
+// fromDBGraphPath converts the nodes and edges of a path to a graph path,
+// nil is returned when some of them no longer exist
+func fromDBGraphPath(nodeIDs []int64, edgeIDs []int64, dbNodes []*graphNode, edges []*graphEdge) *types.GraphPath {
+	path := &types.GraphPath{}
+	names := make(map[int64]string, len(nodeIDs))
+	for _, id := range nodeIDs {
+		index := slices.IndexFunc(dbNodes, func(node *graphNode) bool { return node.ID == id })
+		if index < 0 {
+			return nil
+		}
+		dbNode := dbNodes[index]
+		names[id] = dbNode.Name
+		path.Nodes = append(path.Nodes, &types.GraphNode{
+			Name:       dbNode.Name,
+			Chunks:     dbNode.Chunks,
+			Attributes: dbNode.Attributes,
+		})
+	}
+	for _, id := range edgeIDs {
+		index := slices.IndexFunc(edges, func(edge *graphEdge) bool { return edge.ID == id })
+		if index < 0 {
+			return nil
+		}
+		edge := edges[index]
+		path.Relations = append(path.Relations, &types.GraphRelation{
+			Node1: names[edge.SourceID],
+			Node2: names[edge.TargetID],
+			Type:  edge.Type,
+		})
+	}
+	return path
+}
+
+// parseIDs parses a comma separated list of ids
+func parseIDs(s string) ([]int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	ids := make([]int64, len(parts))
+	for i, part := range parts {
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q: %w", part, err)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// namespaceCondition returns the condition selecting the rows of a namespace,
+// the condition is empty for an empty namespace
+func namespaceCondition(namespace types.NameSpace) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if namespace.KnowledgeBase != "" {
+		conditions = append(conditions, "knowledge_base_id = ?")
+		args = append(args, namespace.KnowledgeBase)
+	}
+	if namespace.Knowledge != "" {
+		conditions = append(conditions, "knowledge_id = ?")
+		args = append(args, namespace.Knowledge)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// unionJSONArray returns the expression merging the stored and inserted values of a JSON array column
+func unionJSONArray(column string) clause.Expr {
+	return gorm.Expr(fmt.Sprintf(
+		"(SELECT COALESCE(jsonb_agg(DISTINCT value), '[]'::jsonb) FROM jsonb_array_elements(graph_nodes.%[1]s || EXCLUDED.%[1]s))",
+		column,
+	))
+}
+
+// toDBGraphNodes converts the nodes of a graph to database models, merging nodes with the same name
+// and adding the nodes only referenced by relations. The nodes are sorted by name
+// so that concurrent upserts lock them in the same order
+func toDBGraphNodes(namespace types.NameSpace, graph *types.GraphData) []*graphNode {
+	byName := make(map[string]*graphNode)
+	node := func(name string) *graphNode {
+		if byName[name] == nil {
+			byName[name] = &graphNode{
+				KnowledgeBaseID: namespace.KnowledgeBase,
+				KnowledgeID:     namespace.Knowledge,
+				Name:            name,
+				Chunks:          types.StringArray{},
+				Attributes:      types.StringArray{},
+			}
+		}
+		return byName[name]
+	}
+	for _, n := range graph.Node {
+		if n.Name == "" {
+			continue
+		}
+		dbNode := node(n.Name)
+		dbNode.Chunks = appendUnique(dbNode.Chunks, n.Chunks...)
+		dbNode.Attributes = appendUnique(dbNode.Attributes, n.Attributes...)
+	}
+	for _, relation := range graph.Relation {
+		if relation.Node1 == "" || relation.Node2 == "" {
+			continue
+		}
+		node(relation.Node1)
+		node(relation.Node2)
+	}
+
+	nodes := make([]*graphNode, 0, len(byName))
+	for _, dbNode := range byName {
+		nodes = append(nodes, dbNode)
+	}
+	slices.SortFunc(nodes, func(a, b *graphNode) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return nodes
+}
+
+// fromDBGraph converts edges and the nodes they connect to graph data,
+// nodes of different knowledge with the same name are merged into one node
+func fromDBGraph(edges []*graphEdge, dbNodes []*graphNode) *types.GraphData {
+	nodesByID := make(map[int64]*graphNode, len(dbNodes))
+	for _, dbNode := range dbNodes {
+		nodesByID[dbNode.ID] = dbNode
+	}
+
+	graph := &types.GraphData{}
+	nodesByName := make(map[string]*types.GraphNode)
+	addNode := func(id int64) string {
+		dbNode := nodesByID[id]
+		if dbNode == nil {
+			return ""
+		}
+		node := nodesByName[dbNode.Name]
+		if node == nil {
+			node = &types.GraphNode{Name: dbNode.Name}
+			nodesByName[dbNode.Name] = node
+			graph.Node = append(graph.Node, node)
+		}
+		node.Chunks = appendUnique(node.Chunks, dbNode.Chunks...)
+		node.Attributes = appendUnique(node.Attributes, dbNode.Attributes...)
+		return dbNode.Name
+	}
+
+	seen := make(map[types.GraphRelation]bool)
+	for _, edge := range edges {
+		relation := types.GraphRelation{Node1: addNode(edge.SourceID), Node2: addNode(edge.TargetID), Type: edge.Type}
+		if relation.Node1 == "" || relation.Node2 == "" || seen[relation] {
+			continue
+		}
+		seen[relation] = true
+		graph.Relation = append(graph.Relation, &relation)
+	}
+	return graph
+}
+
+// appendUnique appends the values missing from list
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
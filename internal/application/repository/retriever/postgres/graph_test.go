@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestToDBGraphNodes(t *testing.T) {
+	namespace := types.NameSpace{KnowledgeBase: "kb", Knowledge: "k"}
+	nodes := toDBGraphNodes(namespace, &types.GraphData{
+		Node: []*types.GraphNode{
+			{Name: "WeKnora", Chunks: []string{"c1"}, Attributes: []string{"framework"}},
+			{Name: "WeKnora", Chunks: []string{"c1", "c2"}},
+			{Name: ""},
+		},
+		Relation: []*types.GraphRelation{
+			{Node1: "Tencent", Node2: "WeKnora", Type: "develops"},
+			{Node1: "Tencent", Node2: ""},
+		},
+	})
+
+	if len(nodes) != 2 {
+		t.Fatalf("Expected 2 nodes, got %d", len(nodes))
+	}
+	if nodes[0].Name != "Tencent" || nodes[1].Name != "WeKnora" {
+		t.Errorf("Expected nodes sorted by name, got %s, %s", nodes[0].Name, nodes[1].Name)
+	}
+	if len(nodes[0].Chunks) != 0 || nodes[0].Chunks == nil {
+		t.Errorf("Expected empty chunks for a relation only node, got %v", nodes[0].Chunks)
+	}
+	if !reflect.DeepEqual([]string(nodes[1].Chunks), []string{"c1", "c2"}) {
+		t.Errorf("Expected merged chunks, got %v", nodes[1].Chunks)
+	}
+	if nodes[1].KnowledgeBaseID != "kb" || nodes[1].KnowledgeID != "k" {
+		t.Errorf("Expected namespace of the node to be set, got %s, %s", nodes[1].KnowledgeBaseID, nodes[1].KnowledgeID)
+	}
+}
+
+func TestFromDBGraph(t *testing.T) {
+	dbNodes := []*graphNode{
+		{ID: 1, KnowledgeID: "k1", Name: "WeKnora", Chunks: types.StringArray{"c1"}},
+		{ID: 2, KnowledgeID: "k1", Name: "Tencent", Chunks: types.StringArray{"c1"}},
+		{ID: 3, KnowledgeID: "k2", Name: "WeKnora", Chunks: types.StringArray{"c3"}},
+		{ID: 4, KnowledgeID: "k2", Name: "Tencent", Chunks: types.StringArray{"c3"}},
+	}
+	edges := []*graphEdge{
+		{SourceID: 2, TargetID: 1, Type: "develops"},
+		{SourceID: 4, TargetID: 3, Type: "develops"},
+	}
+
+	graph := fromDBGraph(edges, dbNodes)
+	if len(graph.Node) != 2 {
+		t.Fatalf("Expected nodes with the same name to be merged, got %d nodes", len(graph.Node))
+	}
+	if len(graph.Relation) != 1 {
+		t.Fatalf("Expected duplicate relations to be merged, got %d relations", len(graph.Relation))
+	}
+	if relation := graph.Relation[0]; relation.Node1 != "Tencent" || relation.Node2 != "WeKnora" {
+		t.Errorf("Expected relation from Tencent to WeKnora, got %s to %s", relation.Node1, relation.Node2)
+	}
+	for _, node := range graph.Node {
+		if len(node.Chunks) != 2 {
+			t.Errorf("Expected chunks of both knowledge for %s, got %v", node.Name, node.Chunks)
+		}
+	}
+}
+
+// sqlRecorder records the statements built by a dry run database
+type sqlRecorder struct {
+	gormlogger.Interface
+	statements []string
+}
+
+func (r *sqlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+// newDryRunDB returns a database that builds the statements without executing them
+func newDryRunDB(t *testing.T) (*gorm.DB, *sqlRecorder) {
+	t.Helper()
+	recorder := &sqlRecorder{Interface: gormlogger.Discard}
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 recorder,
+	})
+	if err != nil {
+		t.Fatalf("open dry run database: %v", err)
+	}
+	return db, recorder
+}
+
+func TestSweepGraph(t *testing.T) {
+	db, recorder := newDryRunDB(t)
+	if err := sweepGraph(db, nil); err != nil {
+		t.Fatalf("sweepGraph: %v", err)
+	}
+	if len(recorder.statements) != 0 {
+		t.Fatalf("Expected no statement without emptied nodes, got %v", recorder.statements)
+	}
+
+	if err := sweepGraph(db, []int64{1, 2}); err != nil {
+		t.Fatalf("sweepGraph: %v", err)
+	}
+	if len(recorder.statements) != 3 {
+		t.Fatalf("Expected 3 statements, got %v", recorder.statements)
+	}
+	for _, statement := range recorder.statements {
+		if !strings.Contains(statement, "(1,2)") {
+			t.Errorf("Expected the statement to be limited to the emptied nodes: %s", statement)
+		}
+	}
+	neighbours := recorder.statements[0]
+	for _, fragment := range []string{
+		"DELETE FROM \"graph_nodes\"",
+		"id NOT IN (1,2) AND chunks = '[]'::jsonb",
+		"SELECT target_id FROM graph_edges WHERE source_id IN (1,2)",
+		"graph_edges.source_id NOT IN (1,2) AND graph_edges.target_id NOT IN (1,2)",
+	} {
+		if !strings.Contains(neighbours, fragment) {
+			t.Errorf("Expected %q in statement %s", fragment, neighbours)
+		}
+	}
+	if !strings.Contains(recorder.statements[1], "DELETE FROM \"graph_edges\" WHERE source_id IN (1,2) OR target_id IN (1,2)") {
+		t.Errorf("Expected the edges of the emptied nodes to be deleted: %s", recorder.statements[1])
+	}
+	if !strings.Contains(recorder.statements[2], "DELETE FROM \"graph_nodes\" WHERE id IN (1,2)") {
+		t.Errorf("Expected the emptied nodes to be deleted: %s", recorder.statements[2])
+	}
+}
+
+// mysqlDialector reports a MySQL dialect on top of the PostgreSQL dialector
+type mysqlDialector struct {
+	gorm.Dialector
+}
+
+func (mysqlDialector) Name() string {
+	return "mysql"
+}
+
+func TestNewPostgresGraphRepository(t *testing.T) {
+	db, recorder := newDryRunDB(t)
+	if _, err := NewPostgresGraphRepository(db); err != nil {
+		t.Fatalf("NewPostgresGraphRepository: %v", err)
+	}
+	if len(recorder.statements) != 0 {
+		t.Errorf("Expected the tables to be left to the migrations, got %v", recorder.statements)
+	}
+
+	mysqlDB := db.Session(&gorm.Session{})
+	mysqlDB.Dialector = mysqlDialector{Dialector: db.Dialector}
+	if _, err := NewPostgresGraphRepository(mysqlDB); err == nil {
+		t.Error("Expected a MySQL database to be rejected")
+	}
+}
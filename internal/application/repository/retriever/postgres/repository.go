@@ -129,6 +129,53 @@ func (g *pgRepository) DeleteByKnowledgeIDList(ctx context.Context, knowledgeIDL
 	return nil
 }
 
+// DeleteByKnowledgeBaseID deletes all indices of a knowledge base
+func (g *pgRepository) DeleteByKnowledgeBaseID(ctx context.Context, knowledgeBaseID string) error {
+	logger.GetLogger(ctx).Infof("[Postgres] Deleting indices by knowledge base ID: %s", knowledgeBaseID)
+	result := g.db.WithContext(ctx).Where("knowledge_base_id = ?", knowledgeBaseID).Delete(&pgVector{})
+	if result.Error != nil {
+		logger.GetLogger(ctx).Errorf("[Postgres] Failed to delete indices by knowledge base ID: %v", result.Error)
+		return result.Error
+	}
+	logger.GetLogger(ctx).Infof("[Postgres] Successfully deleted %d indices by knowledge base ID", result.RowsAffected)
+	return nil
+}
+
+// SwapKnowledgeBaseIndices replaces the indices of a knowledge base with the staged indices in one transaction
+func (g *pgRepository) SwapKnowledgeBaseIndices(ctx context.Context,
+	knowledgeBaseID string, stagingKnowledgeBaseID string,
+) error {
+	logger.GetLogger(ctx).Infof("[Postgres] Swapping indices of knowledge base %s with staged indices %s",
+		knowledgeBaseID, stagingKnowledgeBaseID)
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Nothing staged means the swap already happened, keep the current indices
+		var staged int64
+		if err := tx.Model(&pgVector{}).Where("knowledge_base_id = ?", stagingKnowledgeBaseID).
+			Count(&staged).Error; err != nil {
+			return err
+		}
+		if staged == 0 {
+			logger.GetLogger(ctx).Warnf("[Postgres] No staged indices found for %s, skipping swap", stagingKnowledgeBaseID)
+			return nil
+		}
+		if err := tx.Where("knowledge_base_id = ?", knowledgeBaseID).Delete(&pgVector{}).Error; err != nil {
+			return err
+		}
+		// Staged indices use their own source type to avoid the unique (source_id, source_type) constraint
+		return tx.Model(&pgVector{}).Where("knowledge_base_id = ?", stagingKnowledgeBaseID).
+			Updates(map[string]interface{}{
+				"knowledge_base_id": knowledgeBaseID,
+				"source_type":       int(types.ChunkSourceType),
+			}).Error
+	})
+	if err != nil {
+		logger.GetLogger(ctx).Errorf("[Postgres] Failed to swap knowledge base indices: %v", err)
+		return err
+	}
+	logger.GetLogger(ctx).Infof("[Postgres] Successfully swapped indices of knowledge base %s", knowledgeBaseID)
+	return nil
+}
+
 // Retrieve handles retrieval requests and routes to appropriate method
 func (g *pgRepository) Retrieve(ctx context.Context, params types.RetrieveParams) ([]*types.RetrieveResult, error) {
 	logger.GetLogger(ctx).Debugf("[Postgres] Processing retrieval request of type: %s", params.RetrieverType)
@@ -155,6 +202,13 @@ func (g *pgRepository) KeywordsRetrieve(ctx context.Context,
 			SQL: fmt.Sprintf("knowledge_base_id @@@ 'in (%s)'", common.StringSliceJoin(params.KnowledgeBaseIDs)),
 		})
 	}
+	if len(params.KnowledgeIDs) > 0 {
+		logger.GetLogger(ctx).Debugf("[Postgres] Filtering by knowledge IDs, count: %d", len(params.KnowledgeIDs))
+		conds = append(conds, clause.IN{
+			Column: "knowledge_id",
+			Values: common.ToInterfaceSlice(params.KnowledgeIDs),
+		})
+	}
 	conds = append(conds, clause.Expr{
 		SQL:  "id @@@ paradedb.match(field => 'content', value => ?, distance => 1)",
 		Vars: []interface{}{params.Query},
@@ -222,6 +276,16 @@ func (g *pgRepository) VectorRetrieve(ctx context.Context,
 			Values: common.ToInterfaceSlice(params.KnowledgeBaseIDs),
 		})
 	}
+	if len(params.KnowledgeIDs) > 0 {
+		logger.GetLogger(ctx).Debugf(
+			"[Postgres] Filtering vector search by knowledge IDs, count: %d",
+			len(params.KnowledgeIDs),
+		)
+		conds = append(conds, clause.IN{
+			Column: "knowledge_id",
+			Values: common.ToInterfaceSlice(params.KnowledgeIDs),
+		})
+	}
 	// <=> Cosine similarity operator
 	// <-> L2 distance operator
 	// <#> Inner product operator
@@ -86,3 +86,36 @@ func fromDBVectorEmbeddingWithScore(embedding *pgVectorWithScore, matchType type
 		MatchType:       matchType,
 	}
 }
+
+// graphNode defines the database model for entities of the retrieval graph
+type graphNode struct {
+	ID              int64             `gorm:"primarykey"`
+	CreatedAt       time.Time         `gorm:"column:created_at"`
+	UpdatedAt       time.Time         `gorm:"column:updated_at"`
+	KnowledgeBaseID string            `gorm:"column:knowledge_base_id;type:varchar(36);not null;uniqueIndex:idx_graph_nodes_name"`
+	KnowledgeID     string            `gorm:"column:knowledge_id;type:varchar(36);not null;uniqueIndex:idx_graph_nodes_name"`
+	Name            string            `gorm:"column:name;type:text;not null;uniqueIndex:idx_graph_nodes_name"`
+	Chunks          types.StringArray `gorm:"column:chunks;type:jsonb"`
+	Attributes      types.StringArray `gorm:"column:attributes;type:jsonb"`
+}
+
+// TableName specifies the database table name for graphNode
+func (graphNode) TableName() string {
+	return "graph_nodes"
+}
+
+// graphEdge defines the database model for relations of the retrieval graph
+type graphEdge struct {
+	ID              int64     `gorm:"primarykey"`
+	CreatedAt       time.Time `gorm:"column:created_at"`
+	KnowledgeBaseID string    `gorm:"column:knowledge_base_id;type:varchar(36);not null;index:idx_graph_edges_namespace"`
+	KnowledgeID     string    `gorm:"column:knowledge_id;type:varchar(36);not null;index:idx_graph_edges_namespace"`
+	SourceID        int64     `gorm:"column:source_id;not null;uniqueIndex:idx_graph_edges_ends"`
+	TargetID        int64     `gorm:"column:target_id;not null;uniqueIndex:idx_graph_edges_ends;index"`
+	Type            string    `gorm:"column:type;type:varchar(255);not null;uniqueIndex:idx_graph_edges_ends"`
+}
+
+// TableName specifies the database table name for graphEdge
+func (graphEdge) TableName() string {
+	return "graph_edges"
+}
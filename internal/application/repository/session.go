@@ -77,10 +77,23 @@ func (r *sessionRepository) GetPagedByTenantID(
 	return sessions, total, nil
 }
 
-// Update updates a session
+// Update updates a session, the conversation summary is only written by UpdateSummary
 func (r *sessionRepository) Update(ctx context.Context, session *types.Session) error {
 	session.UpdatedAt = time.Now()
-	return r.db.WithContext(ctx).Where("tenant_id = ?", session.TenantID).Save(session).Error
+	return r.db.WithContext(ctx).Where("tenant_id = ?", session.TenantID).
+		Omit("summary", "summary_until").Save(session).Error
+}
+
+// UpdateSummary updates the conversation summary of a session unless it already covers the rounds until the given time,
+// so that a summary computed concurrently from older rounds never replaces a more recent one
+func (r *sessionRepository) UpdateSummary(ctx context.Context,
+	tenantID uint, id string, summary string, until time.Time,
+) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&types.Session{}).
+		Where("tenant_id = ? AND id = ?", tenantID, id).
+		Where("summary_until IS NULL OR summary_until < ?", until).
+		Updates(map[string]interface{}{"summary": summary, "summary_until": until})
+	return result.RowsAffected > 0, result.Error
 }
 
 // Delete deletes a session
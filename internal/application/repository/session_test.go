@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUpdateSummary(t *testing.T) {
+	db, recorder := newDryRunDB(t, "postgres")
+	until := time.Date(2025, 8, 12, 10, 0, 0, 0, time.UTC)
+	if _, err := NewSessionRepository(db).UpdateSummary(context.Background(), 1, "s1", "summary", until); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertContains(t, recorder.last(), `UPDATE "sessions" SET`, `"summary"='summary'`,
+		"tenant_id = 1 AND id = 's1'", "summary_until IS NULL OR summary_until < '2025-08-12 10:00:00'")
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"gorm.io/gorm"
+)
+
+// usageRepository implements the UsageRepository interface
+type usageRepository struct {
+	db *gorm.DB
+}
+
+// NewUsageRepository creates a new usage repository
+func NewUsageRepository(db *gorm.DB) interfaces.UsageRepository {
+	return &usageRepository{db: db}
+}
+
+// CreateUsageRecord creates a usage record
+func (r *usageRepository) CreateUsageRecord(ctx context.Context, record *types.UsageRecord) error {
+	return r.db.WithContext(ctx).Create(record).Error
+}
+
+// AggregateUsage sums the usage of a tenant, or of every tenant, in a period per model and the requested
+// dimensions, the rows are always split by model so that each of them can be priced
+func (r *usageRepository) AggregateUsage(ctx context.Context,
+	params *types.UsageReportParams,
+) ([]*types.UsageReportItem, error) {
+	columns := []string{
+		"model_id", "model_name", "type",
+		"COUNT(*) AS calls",
+		"SUM(prompt_tokens) AS prompt_tokens",
+		"SUM(completion_tokens) AS completion_tokens",
+		"SUM(total_tokens) AS total_tokens",
+	}
+	groups := []string{"model_id", "model_name", "type"}
+	for _, groupBy := range params.GroupBy {
+		switch groupBy {
+		case types.UsageGroupByDay:
+			// Date formatting differs between databases
+			if r.db.Dialector.Name() == "mysql" {
+				columns = append(columns, "DATE_FORMAT(created_at, '%Y-%m-%d') AS day")
+			} else {
+				columns = append(columns, "TO_CHAR(created_at, 'YYYY-MM-DD') AS day")
+			}
+			groups = append(groups, "day")
+		case types.UsageGroupByTenant:
+			columns = append(columns, "tenant_id")
+			groups = append(groups, "tenant_id")
+		}
+	}
+
+	query := r.db.WithContext(ctx).Model(&types.UsageRecord{}).
+		Select(columns).
+		Where("created_at >= ? AND created_at < ?", params.StartTime, params.EndTime)
+	if !params.AllTenants {
+		query = query.Where("tenant_id = ?", params.TenantID)
+	}
+	for _, group := range groups {
+		query = query.Group(group)
+	}
+
+	var items []*types.UsageReportItem
+	if err := query.Scan(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
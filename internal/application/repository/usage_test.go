@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"gorm.io/gorm"
+)
+
+// isDryRun reports whether the query succeeded or only failed to scan in dry run mode, its statement is recorded anyway
+func isDryRun(err error) bool {
+	return err == nil || errors.Is(err, gorm.ErrDryRunModeUnsupported)
+}
+
+func TestAggregateUsage(t *testing.T) {
+	params := func(allTenants bool) *types.UsageReportParams {
+		return &types.UsageReportParams{
+			TenantID:   7,
+			AllTenants: allTenants,
+			StartTime:  time.Date(2025, 8, 12, 0, 0, 0, 0, time.UTC),
+			EndTime:    time.Date(2025, 8, 14, 0, 0, 0, 0, time.UTC),
+			GroupBy:    []types.UsageGroupBy{types.UsageGroupByDay, types.UsageGroupByTenant},
+		}
+	}
+
+	t.Run("postgres", func(t *testing.T) {
+		db, recorder := newDryRunDB(t, "postgres")
+		if _, err := NewUsageRepository(db).AggregateUsage(context.Background(), params(false)); !isDryRun(err) {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertContains(t, recorder.last(), "TO_CHAR(created_at, 'YYYY-MM-DD') AS day", "tenant_id = 7",
+			`GROUP BY "model_id","model_name","type","day","tenant_id"`)
+	})
+
+	t.Run("mysql", func(t *testing.T) {
+		db, recorder := newDryRunDB(t, "mysql")
+		if _, err := NewUsageRepository(db).AggregateUsage(context.Background(), params(false)); !isDryRun(err) {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertContains(t, recorder.last(), "DATE_FORMAT(created_at, '%Y-%m-%d') AS day")
+		if strings.Contains(recorder.last(), "TO_CHAR") {
+			t.Errorf("Expected no PostgreSQL function for MySQL, got %s", recorder.last())
+		}
+	})
+
+	t.Run("all tenants", func(t *testing.T) {
+		db, recorder := newDryRunDB(t, "postgres")
+		if _, err := NewUsageRepository(db).AggregateUsage(context.Background(), params(true)); !isDryRun(err) {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if strings.Contains(recorder.last(), "tenant_id = ") {
+			t.Errorf("Expected no tenant filter, got %s", recorder.last())
+		}
+	})
+}
@@ -77,6 +77,16 @@ func (e *EventManager) Trigger(ctx context.Context,
 	return nil
 }
 
+// HasPlugin reports whether a plugin other than tracing handles the specified event type
+func (e *EventManager) HasPlugin(eventType types.EventType) bool {
+	for _, plugin := range e.listeners[eventType] {
+		if _, ok := plugin.(*PluginTracing); !ok {
+			return true
+		}
+	}
+	return false
+}
+
 // PluginError represents an error in plugin execution
 type PluginError struct {
 	Err         error  // Original error
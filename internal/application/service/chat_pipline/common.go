@@ -9,6 +9,12 @@ import (
 	"github.com/Tencent/WeKnora/internal/types/interfaces"
 )
 
+// maxHistoryRounds is the number of most recent history rounds sent to the chat model
+const maxHistoryRounds = 2
+
+// historySummaryPrompt introduces the conversation summary appended to the system prompt
+const historySummaryPrompt = "\n\n## 此前对话的摘要\n"
+
 // prepareChatModel shared logic to prepare chat model and options
 func prepareChatModel(ctx context.Context, modelService interfaces.ModelService,
 	chatManage *types.ChatManage,
@@ -46,12 +52,12 @@ func prepareBaseMessages(chatManage *types.ChatManage) []chat.Message {
 // prepareMessagesWithHistory prepare complete messages including history
 func prepareMessagesWithHistory(chatManage *types.ChatManage) []chat.Message {
 	chatMessages := []chat.Message{
-		{Role: "system", Content: chatManage.SummaryConfig.Prompt},
+		{Role: "system", Content: systemPromptWithSummary(chatManage)},
 	}
 
 	chatHistory := chatManage.History
-	if len(chatHistory) > 2 {
-		chatHistory = chatHistory[len(chatHistory)-2:]
+	if len(chatHistory) > maxHistoryRounds {
+		chatHistory = chatHistory[len(chatHistory)-maxHistoryRounds:]
 	}
 
 	// Add conversation history
@@ -65,3 +71,11 @@ func prepareMessagesWithHistory(chatManage *types.ChatManage) []chat.Message {
 
 	return chatMessages
 }
+
+// systemPromptWithSummary returns the system prompt followed by the summary of the earlier conversation, if any
+func systemPromptWithSummary(chatManage *types.ChatManage) string {
+	if chatManage.HistorySummary == "" {
+		return chatManage.SummaryConfig.Prompt
+	}
+	return chatManage.SummaryConfig.Prompt + historySummaryPrompt + chatManage.HistorySummary
+}
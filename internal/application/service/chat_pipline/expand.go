@@ -0,0 +1,329 @@
+package chatpipline
+
+import (
+	"context"
+
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+)
+
+const (
+	// DefaultExpandMaxTokens is the default token budget of the results after expansion
+	DefaultExpandMaxTokens = 4096
+	// MaxExpandWindow is the maximum number of neighbouring chunks added on each side of a result
+	MaxExpandWindow = 5
+)
+
+// PluginExpand expands the merged search results with their neighbouring chunks or to their parent chunk,
+// so that the chat model sees the evidence straddling chunk boundaries
+type PluginExpand struct {
+	chunkRepo interfaces.ChunkRepository
+}
+
+// NewPluginExpand creates and registers a new PluginExpand instance
+func NewPluginExpand(eventManager *EventManager, chunkRepository interfaces.ChunkRepository) *PluginExpand {
+	res := &PluginExpand{chunkRepo: chunkRepository}
+	eventManager.Register(res)
+	return res
+}
+
+// ActivationEvents returns the event types this plugin handles
+func (p *PluginExpand) ActivationEvents() []types.EventType {
+	return []types.EventType{types.CHUNK_EXPAND}
+}
+
+// resultExpansion tracks the chunks around a result that are not part of it yet
+type resultExpansion struct {
+	result *types.SearchResult
+	// first and last are the chunks at the boundaries of the result
+	first, last *types.Chunk
+	// before and after are the neighbouring chunks, nearest first
+	before, after []*types.Chunk
+}
+
+// OnEvent processes the CHUNK_EXPAND event to expand the merged search results.
+// The results are kept as they are, their expansion spends what is left of the token budget
+// with the best results expanded first
+func (p *PluginExpand) OnEvent(ctx context.Context,
+	eventType types.EventType, chatManage *types.ChatManage, next func() *PluginError,
+) *PluginError {
+	window := min(chatManage.ExpandWindow, MaxExpandWindow)
+	if (window <= 0 && !chatManage.ExpandToParent) || len(chatManage.MergeResult) == 0 {
+		return next()
+	}
+	maxTokens := chatManage.ExpandMaxTokens
+	if maxTokens <= 0 {
+		maxTokens = DefaultExpandMaxTokens
+	}
+
+	budget := maxTokens
+	seen := make(map[string]bool)
+	for _, result := range chatManage.MergeResult {
+		budget -= EstimateTokens(result.Content)
+		seen[result.ID] = true
+		for _, id := range result.SubChunkID {
+			seen[id] = true
+		}
+	}
+	logger.Infof(ctx, "Expanding %d results, window: %d, parent: %v, remaining budget: %d tokens",
+		len(chatManage.MergeResult), window, chatManage.ExpandToParent, budget)
+	if budget <= 0 {
+		return next()
+	}
+
+	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
+	expansions, err := p.loadBoundaries(ctx, tenantID, chatManage.MergeResult)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to load chunks of the results, session_id: %s, error: %v",
+			chatManage.SessionID, err)
+		return next()
+	}
+	if chatManage.ExpandToParent {
+		expansions, budget = p.expandParents(ctx, tenantID, expansions, budget, seen)
+	}
+	if window > 0 {
+		if err := p.loadNeighbours(ctx, tenantID, expansions, window); err != nil {
+			logger.Errorf(ctx, "Failed to load neighbouring chunks, session_id: %s, error: %v",
+				chatManage.SessionID, err)
+		} else {
+			budget = expandNeighbours(ctx, expansions, window, budget, seen)
+		}
+	}
+
+	results := make([]*types.SearchResult, 0, len(expansions))
+	for _, expansion := range expansions {
+		results = append(results, expansion.result)
+	}
+	chatManage.MergeResult = results
+	logger.Infof(ctx, "Expanded results, count: %d, remaining budget: %d tokens", len(results), budget)
+	return next()
+}
+
+// loadBoundaries loads the first and last chunk of every result, merged results end with their last sub chunk
+func (p *PluginExpand) loadBoundaries(ctx context.Context,
+	tenantID uint, results []*types.SearchResult,
+) ([]*resultExpansion, error) {
+	ids := make([]string, 0, len(results)*2)
+	for _, result := range results {
+		ids = append(ids, result.ID)
+		if len(result.SubChunkID) > 0 {
+			ids = append(ids, result.SubChunkID[len(result.SubChunkID)-1])
+		}
+	}
+	chunks, err := p.listChunks(ctx, tenantID, ids)
+	if err != nil {
+		return nil, err
+	}
+	expansions := make([]*resultExpansion, 0, len(results))
+	for _, result := range results {
+		expansion := &resultExpansion{result: result, first: chunks[result.ID], last: chunks[result.ID]}
+		if len(result.SubChunkID) > 0 {
+			expansion.last = chunks[result.SubChunkID[len(result.SubChunkID)-1]]
+		}
+		expansions = append(expansions, expansion)
+	}
+	return expansions, nil
+}
+
+// expandParents replaces the results with their parent chunk when the parent fits into the budget,
+// a parent is sent once with the best of its results and absorbs the others
+func (p *PluginExpand) expandParents(ctx context.Context, tenantID uint,
+	expansions []*resultExpansion, budget int, seen map[string]bool,
+) ([]*resultExpansion, int) {
+	var parentIDs []string
+	for _, expansion := range expansions {
+		if expansion.result.ParentChunkID != "" {
+			parentIDs = append(parentIDs, expansion.result.ParentChunkID)
+		}
+	}
+	if len(parentIDs) == 0 {
+		return expansions, budget
+	}
+	parents, err := p.listChunks(ctx, tenantID, parentIDs)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to load parent chunks: %v", err)
+		return expansions, budget
+	}
+
+	expanded := make(map[string]*resultExpansion)
+	kept := make([]*resultExpansion, 0, len(expansions))
+	for _, expansion := range expansions {
+		result := expansion.result
+		parent, ok := parents[result.ParentChunkID]
+		if !ok {
+			kept = append(kept, expansion)
+			continue
+		}
+		if first, ok := expanded[parent.ID]; ok {
+			first.result.SubChunkID = append(first.result.SubChunkID, result.ID)
+			first.result.SubChunkID = append(first.result.SubChunkID, result.SubChunkID...)
+			budget += EstimateTokens(result.Content)
+			continue
+		}
+		cost := EstimateTokens(parent.Content) - EstimateTokens(result.Content)
+		if cost > budget {
+			kept = append(kept, expansion)
+			continue
+		}
+		budget -= cost
+		result.Content = parent.Content
+		result.StartAt = parent.StartAt
+		result.EndAt = parent.EndAt
+		result.ImageInfo = parent.ImageInfo
+		result.SubChunkID = append(result.SubChunkID, parent.ID)
+		seen[parent.ID] = true
+		expansion.first, expansion.last = parent, parent
+		expanded[parent.ID] = expansion
+		kept = append(kept, expansion)
+	}
+	return kept, budget
+}
+
+// loadNeighbours walks the chunk links of all results in rounds, one batch query per round
+func (p *PluginExpand) loadNeighbours(ctx context.Context,
+	tenantID uint, expansions []*resultExpansion, window int,
+) error {
+	for round := 0; round < window; round++ {
+		var ids []string
+		for _, expansion := range expansions {
+			if id := expansion.nextBefore(); id != "" {
+				ids = append(ids, id)
+			}
+			if id := expansion.nextAfter(); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		chunks, err := p.listChunks(ctx, tenantID, ids)
+		if err != nil {
+			return err
+		}
+		for _, expansion := range expansions {
+			if chunk, ok := chunks[expansion.nextBefore()]; ok {
+				expansion.before = append(expansion.before, chunk)
+			}
+			if chunk, ok := chunks[expansion.nextAfter()]; ok {
+				expansion.after = append(expansion.after, chunk)
+			}
+		}
+	}
+	return nil
+}
+
+// nextBefore returns the ID of the next chunk to load before the result
+func (e *resultExpansion) nextBefore() string {
+	if len(e.before) > 0 {
+		return e.before[len(e.before)-1].PreChunkID
+	}
+	if e.first != nil {
+		return e.first.PreChunkID
+	}
+	return ""
+}
+
+// nextAfter returns the ID of the next chunk to load after the result
+func (e *resultExpansion) nextAfter() string {
+	if len(e.after) > 0 {
+		return e.after[len(e.after)-1].NextChunkID
+	}
+	if e.last != nil {
+		return e.last.NextChunkID
+	}
+	return ""
+}
+
+// expandNeighbours adds the neighbouring chunks to the results, nearest first and alternating sides.
+// A side stops at a chunk that is already sent with another result or that exceeds the budget
+func expandNeighbours(ctx context.Context,
+	expansions []*resultExpansion, window int, budget int, seen map[string]bool,
+) int {
+	for _, expansion := range expansions {
+		result := expansion.result
+		beforeOpen, afterOpen := true, true
+		for i := 0; i < window && (beforeOpen || afterOpen); i++ {
+			if beforeOpen {
+				beforeOpen = i < len(expansion.before) && !seen[expansion.before[i].ID]
+				if beforeOpen {
+					content := leadingContent(expansion.before[i], result.StartAt)
+					if cost := EstimateTokens(content); cost <= budget {
+						budget -= cost
+						prependChunk(ctx, result, expansion.before[i], content)
+						seen[expansion.before[i].ID] = true
+					} else {
+						beforeOpen = false
+					}
+				}
+			}
+			if afterOpen {
+				afterOpen = i < len(expansion.after) && !seen[expansion.after[i].ID]
+				if afterOpen {
+					content := trailingContent(expansion.after[i], result.EndAt)
+					if cost := EstimateTokens(content); cost <= budget {
+						budget -= cost
+						appendChunk(ctx, result, expansion.after[i], content)
+						seen[expansion.after[i].ID] = true
+					} else {
+						afterOpen = false
+					}
+				}
+			}
+		}
+	}
+	return budget
+}
+
+// leadingContent returns the part of a chunk before start, chunks overlap in the document.
+// Chunks whose content does not match their span, like chunks prefixed with their headings, are kept whole
+func leadingContent(chunk *types.Chunk, start int) string {
+	content := []rune(chunk.Content)
+	if len(content) != chunk.EndAt-chunk.StartAt || chunk.EndAt <= start {
+		return chunk.Content
+	}
+	return string(content[:min(max(start-chunk.StartAt, 0), len(content))])
+}
+
+// trailingContent returns the part of a chunk after end, chunks overlap in the document.
+// Chunks whose content does not match their span, like chunks prefixed with their headings, are kept whole
+func trailingContent(chunk *types.Chunk, end int) string {
+	content := []rune(chunk.Content)
+	if len(content) != chunk.EndAt-chunk.StartAt || chunk.StartAt >= end {
+		return chunk.Content
+	}
+	return string(content[min(max(end-chunk.StartAt, 0), len(content)):])
+}
+
+// prependChunk adds the content of a chunk before the result
+func prependChunk(ctx context.Context, result *types.SearchResult, chunk *types.Chunk, content string) {
+	result.Content = content + result.Content
+	result.StartAt = min(result.StartAt, chunk.StartAt)
+	result.SubChunkID = append(result.SubChunkID, chunk.ID)
+	if err := mergeImageInfo(ctx, result, &types.SearchResult{ImageInfo: chunk.ImageInfo}); err != nil {
+		logger.Warnf(ctx, "Failed to merge ImageInfo: %v", err)
+	}
+}
+
+// appendChunk adds the content of a chunk after the result
+func appendChunk(ctx context.Context, result *types.SearchResult, chunk *types.Chunk, content string) {
+	result.Content = result.Content + content
+	result.EndAt = max(result.EndAt, chunk.EndAt)
+	result.SubChunkID = append(result.SubChunkID, chunk.ID)
+	if err := mergeImageInfo(ctx, result, &types.SearchResult{ImageInfo: chunk.ImageInfo}); err != nil {
+		logger.Warnf(ctx, "Failed to merge ImageInfo: %v", err)
+	}
+}
+
+// listChunks loads chunks by ID into a map
+func (p *PluginExpand) listChunks(ctx context.Context, tenantID uint, ids []string) (map[string]*types.Chunk, error) {
+	chunks, err := p.chunkRepo.ListChunksByID(ctx, tenantID, ids)
+	if err != nil {
+		return nil, err
+	}
+	chunkMap := make(map[string]*types.Chunk, len(chunks))
+	for _, chunk := range chunks {
+		chunkMap[chunk.ID] = chunk
+	}
+	return chunkMap, nil
+}
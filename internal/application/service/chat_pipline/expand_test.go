@@ -0,0 +1,105 @@
+package chatpipline
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+)
+
+// memoryChunkRepository serves chunks from memory
+type memoryChunkRepository struct {
+	interfaces.ChunkRepository
+	chunks map[string]*types.Chunk
+}
+
+func (r *memoryChunkRepository) ListChunksByID(ctx context.Context,
+	tenantID uint, ids []string,
+) ([]*types.Chunk, error) {
+	var chunks []*types.Chunk
+	for _, id := range ids {
+		if chunk, ok := r.chunks[id]; ok {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, nil
+}
+
+// newChunkChain creates linked chunks of ten characters that overlap by two characters
+func newChunkChain(ids ...string) map[string]*types.Chunk {
+	chunks := make(map[string]*types.Chunk)
+	for i, id := range ids {
+		chunk := &types.Chunk{ID: id, StartAt: i * 8, EndAt: i*8 + 10}
+		chunk.Content = strings.Repeat(id, 10)[:10]
+		if i > 0 {
+			chunk.PreChunkID = ids[i-1]
+		}
+		if i < len(ids)-1 {
+			chunk.NextChunkID = ids[i+1]
+		}
+		chunks[id] = chunk
+	}
+	return chunks
+}
+
+func TestPluginExpand(t *testing.T) {
+	chunks := newChunkChain("a", "b", "c", "d", "e", "f", "g")
+	chunks["p"] = &types.Chunk{ID: "p", Content: "parent section"}
+	plugin := &PluginExpand{chunkRepo: &memoryChunkRepository{chunks: chunks}}
+	ctx := context.WithValue(context.Background(), types.TenantIDContextKey, uint(1))
+
+	chatManage := &types.ChatManage{
+		ExpandWindow:    2,
+		ExpandToParent:  true,
+		ExpandMaxTokens: 100,
+		MergeResult: []*types.SearchResult{
+			{ID: "c", Content: chunks["c"].Content, StartAt: 16, EndAt: 26, Score: 0.9},
+			{ID: "f", Content: chunks["f"].Content, StartAt: 40, EndAt: 50, Score: 0.8},
+			{ID: "o1", Content: "caption", ParentChunkID: "p", Score: 0.7},
+			{ID: "o2", Content: "ocr text", ParentChunkID: "p", Score: 0.6},
+		},
+	}
+	if err := plugin.OnEvent(ctx, types.CHUNK_EXPAND, chatManage, func() *PluginError { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	results := chatManage.MergeResult
+	if len(results) != 3 {
+		t.Fatalf("Expected results sharing a parent to be merged, got %d results", len(results))
+	}
+	// c takes two neighbours on both sides, f only the neighbours c left over
+	if got := results[0].Content; got != "aaaaaaaa"+"bbbbbbbb"+"cccccccccc"+"dddddddd"+"eeeeeeee" {
+		t.Errorf("Expected c expanded without overlap, got %q", got)
+	}
+	if results[0].StartAt != 0 || results[0].EndAt != 42 {
+		t.Errorf("Expected c to span 0-42, got %d-%d", results[0].StartAt, results[0].EndAt)
+	}
+	if got := results[1].Content; got != "ffffffffff"+"gggggggg" {
+		t.Errorf("Expected f to stop at the chunks sent with c, got %q", got)
+	}
+	if results[2].Content != "parent section" || len(results[2].SubChunkID) != 2 {
+		t.Errorf("Expected the parent with both of its results, got %q with %v",
+			results[2].Content, results[2].SubChunkID)
+	}
+}
+
+func TestPluginExpandBudget(t *testing.T) {
+	chunks := newChunkChain("a", "b", "c")
+	plugin := &PluginExpand{chunkRepo: &memoryChunkRepository{chunks: chunks}}
+	ctx := context.WithValue(context.Background(), types.TenantIDContextKey, uint(1))
+
+	chatManage := &types.ChatManage{
+		ExpandWindow:    1,
+		ExpandMaxTokens: 5,
+		MergeResult:     []*types.SearchResult{{ID: "b", Content: chunks["b"].Content, StartAt: 8, EndAt: 18}},
+	}
+	if err := plugin.OnEvent(ctx, types.CHUNK_EXPAND, chatManage, func() *PluginError { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	// b costs 3 tokens, the 8 characters of a fit into the remaining 2 tokens but c does not
+	if got := chatManage.MergeResult[0].Content; got != "aaaaaaaa"+"bbbbbbbbbb" {
+		t.Errorf("Expected expansion within the budget, got %q", got)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"regexp"
 	"strings"
 
@@ -52,8 +51,8 @@ func (p *PluginExtractEntity) ActivationEvents() []types.EventType {
 func (p *PluginExtractEntity) OnEvent(ctx context.Context,
 	eventType types.EventType, chatManage *types.ChatManage, next func() *PluginError,
 ) *PluginError {
-	if strings.ToLower(os.Getenv("NEO4J_ENABLE")) != "true" {
-		logger.Debugf(ctx, "skipping extract entity, neo4j is disabled")
+	if config.GetGraphDriver() == "" {
+		logger.Debugf(ctx, "skipping extract entity, graph retrieval is disabled")
 		return next()
 	}
 
@@ -65,12 +64,20 @@ func (p *PluginExtractEntity) OnEvent(ctx context.Context,
 		return next()
 	}
 
-	kb, err := p.knowledgeBaseRepo.GetKnowledgeBaseByID(ctx, chatManage.KnowledgeBaseID)
-	if err != nil {
-		logger.Errorf(ctx, "failed to get knowledge base: %v", err)
-		return next()
+	// Entities are only extracted when at least one knowledge base has a graph
+	hasExtractConfig := false
+	for _, kbID := range chatManage.GetKnowledgeBaseIDs() {
+		kb, err := p.knowledgeBaseRepo.GetKnowledgeBaseByID(ctx, kbID)
+		if err != nil {
+			logger.Errorf(ctx, "failed to get knowledge base: %v", err)
+			continue
+		}
+		if kb.ExtractConfig != nil {
+			hasExtractConfig = true
+			break
+		}
 	}
-	if kb.ExtractConfig == nil {
+	if !hasExtractConfig {
 		logger.Warnf(ctx, "failed to get extract config")
 		return next()
 	}
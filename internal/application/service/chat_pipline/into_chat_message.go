@@ -7,20 +7,37 @@ import (
 	"fmt"
 	"html/template"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/Tencent/WeKnora/internal/config"
 	"github.com/Tencent/WeKnora/internal/logger"
 	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
 	secutils "github.com/Tencent/WeKnora/internal/utils"
 )
 
+const (
+	// defaultCompletionReserve is the number of tokens reserved for the completion
+	// when the summary config limits neither the completion nor the total tokens
+	defaultCompletionReserve = 1024
+	// minTruncatedPassageTokens is the smallest budget a passage is truncated to rather than dropped
+	minTruncatedPassageTokens = 64
+)
+
 // PluginIntoChatMessage handles the transformation of search results into chat messages
-type PluginIntoChatMessage struct{}
+type PluginIntoChatMessage struct {
+	modelService interfaces.ModelService
+	cfg          *config.Config
+}
 
 // NewPluginIntoChatMessage creates and registers a new PluginIntoChatMessage instance
-func NewPluginIntoChatMessage(eventManager *EventManager) *PluginIntoChatMessage {
-	res := &PluginIntoChatMessage{}
+func NewPluginIntoChatMessage(eventManager *EventManager,
+	modelService interfaces.ModelService, cfg *config.Config,
+) *PluginIntoChatMessage {
+	res := &PluginIntoChatMessage{modelService: modelService, cfg: cfg}
 	eventManager.Register(res)
 	return res
 }
@@ -30,17 +47,12 @@ func (p *PluginIntoChatMessage) ActivationEvents() []types.EventType {
 	return []types.EventType{types.INTO_CHAT_MESSAGE}
 }
 
-// OnEvent processes the INTO_CHAT_MESSAGE event to format chat message content
+// OnEvent processes the INTO_CHAT_MESSAGE event to format chat message content.
+// The history and the passages are fitted into the context window of the chat model,
+// passages that do not fit are dropped from the merge results, lowest scores first
 func (p *PluginIntoChatMessage) OnEvent(ctx context.Context,
 	eventType types.EventType, chatManage *types.ChatManage, next func() *PluginError,
 ) *PluginError {
-	// Extract content from merge results
-	passages := make([]string, len(chatManage.MergeResult))
-	for i, result := range chatManage.MergeResult {
-		// 合并内容和图片信息
-		passages[i] = getEnrichedPassageForChat(ctx, result)
-	}
-
 	// Parse the context template
 	tmpl, err := template.New("searchContent").Parse(chatManage.SummaryConfig.ContextTemplate)
 	if err != nil {
@@ -49,7 +61,6 @@ func (p *PluginIntoChatMessage) OnEvent(ctx context.Context,
 
 	// Prepare weekday names for template
 	weekdayName := []string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
-	var userContent bytes.Buffer
 
 	// 验证用户查询的安全性
 	safeQuery, isValid := secutils.ValidateInput(chatManage.Query)
@@ -58,22 +69,143 @@ func (p *PluginIntoChatMessage) OnEvent(ctx context.Context,
 		return ErrTemplateExecute.WithError(fmt.Errorf("用户查询包含非法内容"))
 	}
 
-	// Execute template with context data
-	err = tmpl.Execute(&userContent, map[string]interface{}{
-		"Query":       safeQuery,                                // User's original query
-		"Contexts":    passages,                                 // Extracted passages from search results
-		"CurrentTime": time.Now().Format("2006-01-02 15:04:05"), // Formatted current time
-		"CurrentWeek": weekdayName[time.Now().Weekday()],        // Current weekday in Chinese
-	})
+	render := func(passages []string) (string, error) {
+		var userContent bytes.Buffer
+		// Execute template with context data
+		err := tmpl.Execute(&userContent, map[string]interface{}{
+			"Query":       safeQuery,                                // User's original query
+			"Contexts":    passages,                                 // Extracted passages from search results
+			"CurrentTime": time.Now().Format("2006-01-02 15:04:05"), // Formatted current time
+			"CurrentWeek": weekdayName[time.Now().Weekday()],        // Current weekday in Chinese
+		})
+		return userContent.String(), err
+	}
+
+	// The prompt is the system prompt and the template rendered without passages
+	emptyContent, err := render(nil)
+	if err != nil {
+		return ErrTemplateExecute.WithError(err)
+	}
+	budget := p.contextBudget(ctx, chatManage)
+	promptTokens := EstimateTokens(chatManage.SummaryConfig.Prompt) + EstimateTokens(emptyContent)
+	// The conversation summary is sent with the system prompt but spends the history budget
+	summaryTokens := EstimateTokens(systemPromptWithSummary(chatManage)) - EstimateTokens(chatManage.SummaryConfig.Prompt)
+	var historyTokens int
+	chatManage.History, historyTokens = fitHistory(chatManage.History, budget.history-summaryTokens)
+	historyTokens += summaryTokens
+	contentTokens := min(budget.available-promptTokens-historyTokens,
+		budget.content+max(budget.prompt-promptTokens, 0)+budget.history-historyTokens)
+	logger.Infof(ctx, "Context budget of %d tokens, prompt: %d, history: %d, content: %d",
+		budget.available, promptTokens, historyTokens, contentTokens)
+
+	// Extract content from merge results
+	passages, kept, dropped := fitPassages(ctx, chatManage.MergeResult, contentTokens)
+	if len(dropped) > 0 {
+		ids := make([]string, 0, len(dropped))
+		for _, result := range dropped {
+			ids = append(ids, result.ID)
+		}
+		logger.Warnf(ctx, "Dropped %d of %d passages exceeding the context budget: %v",
+			len(dropped), len(chatManage.MergeResult), ids)
+	}
+	chatManage.MergeResult = kept
+	chatManage.DropResult = dropped
+
+	userContent, err := render(passages)
 	if err != nil {
 		return ErrTemplateExecute.WithError(err)
 	}
 
 	// Set formatted content back to chat management
-	chatManage.UserContent = userContent.String()
+	chatManage.UserContent = userContent
 	return next()
 }
 
+// tokenBudget is the token budget of the parts of the chat context
+type tokenBudget struct {
+	available, prompt, history, content int
+}
+
+// contextBudget splits the context window of the chat model, less the tokens reserved for the completion,
+// by the token budget of the request, of the config or the default one in that order
+func (p *PluginIntoChatMessage) contextBudget(ctx context.Context, chatManage *types.ChatManage) tokenBudget {
+	window := types.DefaultContextWindow
+	if model, err := p.modelService.GetModelByID(ctx, chatManage.ChatModelID); err != nil {
+		logger.Warnf(ctx, "Failed to get chat model, using the default context window: %v", err)
+	} else {
+		window = model.GetContextWindow()
+	}
+	reserve := chatManage.SummaryConfig.MaxCompletionTokens
+	if reserve <= 0 {
+		reserve = chatManage.SummaryConfig.MaxTokens
+	}
+	if reserve <= 0 || reserve >= window {
+		reserve = min(defaultCompletionReserve, window/2)
+	}
+
+	shares := types.DefaultTokenBudget
+	if chatManage.TokenBudget != nil {
+		shares = *chatManage.TokenBudget
+	} else if p.cfg != nil && p.cfg.Conversation != nil && p.cfg.Conversation.TokenBudget != nil {
+		shares = *p.cfg.Conversation.TokenBudget
+	}
+	if err := shares.Validate(); err != nil {
+		logger.Warnf(ctx, "Invalid token budget, using the default one: %v", err)
+		shares = types.DefaultTokenBudget
+	}
+
+	available := window - reserve
+	return tokenBudget{
+		available: available,
+		prompt:    int(shares.PromptShare * float64(available)),
+		history:   int(shares.HistoryShare * float64(available)),
+		content:   int(shares.ContentShare * float64(available)),
+	}
+}
+
+// fitHistory keeps the most recent rounds of the history sent to the chat model that fit into the budget
+func fitHistory(history []*types.History, budget int) ([]*types.History, int) {
+	if len(history) > maxHistoryRounds {
+		history = history[len(history)-maxHistoryRounds:]
+	}
+	tokens := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		cost := EstimateTokens(history[i].Query) + EstimateTokens(history[i].Answer)
+		if tokens+cost > budget {
+			return history[i+1:], tokens
+		}
+		tokens += cost
+	}
+	return history, tokens
+}
+
+// fitPassages fills the budget with the passages of the results by descending score,
+// a passage that does not fit is truncated when enough of the budget is left and dropped otherwise.
+// It returns the passages and the results kept, by descending score, and the results dropped
+func fitPassages(ctx context.Context, results []*types.SearchResult, budget int,
+) (passages []string, kept []*types.SearchResult, dropped []*types.SearchResult) {
+	sorted := slices.Clone(results)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Score > sorted[j].Score })
+	for _, result := range sorted {
+		// 合并内容和图片信息
+		passage := getEnrichedPassageForChat(ctx, result)
+		cost := EstimateTokens(passage)
+		switch {
+		case cost <= budget:
+		case budget >= minTruncatedPassageTokens:
+			passage = truncateTokens(passage, budget)
+			cost = budget
+		default:
+			dropped = append(dropped, result)
+			continue
+		}
+		budget -= cost
+		passages = append(passages, passage)
+		kept = append(kept, result)
+	}
+	return passages, kept, dropped
+}
+
 // getEnrichedPassageForChat 合并Content和ImageInfo的文本内容，为聊天消息准备
 func getEnrichedPassageForChat(ctx context.Context, result *types.SearchResult) string {
 	// 如果没有图片信息，直接返回内容
@@ -0,0 +1,44 @@
+package chatpipline
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+func TestFitPassages(t *testing.T) {
+	results := []*types.SearchResult{
+		{ID: "low", Content: strings.Repeat("低", 30), Score: 0.2},
+		{ID: "high", Content: strings.Repeat("高", 60), Score: 0.9},
+		{ID: "mid", Content: strings.Repeat("中", 120), Score: 0.5},
+	}
+
+	passages, kept, dropped := fitPassages(context.Background(), results, 130)
+	if len(kept) != 2 || kept[0].ID != "high" || kept[1].ID != "mid" {
+		t.Fatalf("Expected the best results kept by score, got %v", kept)
+	}
+	if got := len([]rune(passages[1])); got != 70 {
+		t.Errorf("Expected the second passage truncated to the remaining 70 tokens, got %d", got)
+	}
+	if len(dropped) != 1 || dropped[0].ID != "low" {
+		t.Errorf("Expected the lowest result dropped, got %v", dropped)
+	}
+}
+
+func TestFitHistory(t *testing.T) {
+	history := []*types.History{
+		{Query: "q1", Answer: strings.Repeat("a", 400)},
+		{Query: "q2", Answer: strings.Repeat("b", 400)},
+		{Query: "q3", Answer: strings.Repeat("c", 40)},
+	}
+
+	kept, tokens := fitHistory(history, 100)
+	if len(kept) != 1 || kept[0].Query != "q3" {
+		t.Fatalf("Expected only the most recent round to fit, got %d rounds", len(kept))
+	}
+	if tokens != 11 {
+		t.Errorf("Expected 11 tokens, got %d", tokens)
+	}
+}
@@ -0,0 +1,162 @@
+package chatpipline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Tencent/WeKnora/internal/config"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// protectedPipelineParams are the ChatManage fields that carry the request itself
+// and therefore cannot be overridden by the parameters of a pipeline step
+var protectedPipelineParams = []string{
+	"session_id", "query", "processed_query", "rewrite_query", "history", "knowledge_base_id", "knowledge_base_ids",
+}
+
+// IsProtectedPipelineParam reports whether a step parameter names a protected ChatManage field,
+// json keys match fields case-insensitively so the comparison does too
+func IsProtectedPipelineParam(key string) bool {
+	return slices.ContainsFunc(protectedPipelineParams, func(protected string) bool {
+		return strings.EqualFold(protected, key)
+	})
+}
+
+// PipelineRegistry holds the built-in and configured pipelines
+// and validates pipeline declarations against the plugins registered on the EventManager
+type PipelineRegistry struct {
+	eventManager    *EventManager
+	pipelines       map[string][]types.PipelineStep
+	defaultPipeline string
+}
+
+// NewPipelineRegistry creates a registry of the built-in pipelines extended with the configured ones,
+// a configured pipeline replaces the built-in pipeline of the same name
+func NewPipelineRegistry(eventManager *EventManager, cfg *config.Config) *PipelineRegistry {
+	r := &PipelineRegistry{
+		eventManager:    eventManager,
+		pipelines:       make(map[string][]types.PipelineStep),
+		defaultPipeline: types.DefaultPipelineName,
+	}
+	for name, events := range types.Pipline {
+		r.pipelines[name] = types.PipelineSteps(events)
+	}
+	if cfg != nil && cfg.Conversation != nil {
+		for name, steps := range cfg.Conversation.Pipelines {
+			r.pipelines[name] = steps
+		}
+		if cfg.Conversation.DefaultPipeline != "" {
+			r.defaultPipeline = cfg.Conversation.DefaultPipeline
+		}
+	}
+	return r
+}
+
+// Pipeline returns the steps of a named pipeline
+func (r *PipelineRegistry) Pipeline(name string) ([]types.PipelineStep, bool) {
+	steps, ok := r.pipelines[name]
+	return steps, ok
+}
+
+// Default returns the steps of the default pipeline
+func (r *PipelineRegistry) Default() []types.PipelineStep {
+	return r.pipelines[r.defaultPipeline]
+}
+
+// Validate checks that every step triggers an event handled by a registered plugin
+// and that its parameters are known, overridable ChatManage fields
+func (r *PipelineRegistry) Validate(steps []types.PipelineStep) error {
+	if len(steps) == 0 {
+		return errors.New("pipeline has no steps")
+	}
+	for i, step := range steps {
+		if !r.eventManager.HasPlugin(step.Event) {
+			return fmt.Errorf("step %d: no plugin registered for event %q", i, step.Event)
+		}
+		if len(step.Params) == 0 {
+			continue
+		}
+		for key := range step.Params {
+			if IsProtectedPipelineParam(key) {
+				return fmt.Errorf("step %d: parameter %q cannot be overridden", i, key)
+			}
+		}
+		data, err := json.Marshal(step.Params)
+		if err != nil {
+			return fmt.Errorf("step %d: invalid parameters: %w", i, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		params := &types.ChatManage{}
+		if err := decoder.Decode(params); err != nil {
+			return fmt.Errorf("step %d: invalid parameters: %w", i, err)
+		}
+		if params.TokenBudget != nil {
+			if err := params.TokenBudget.Validate(); err != nil {
+				return fmt.Errorf("step %d: invalid parameters: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateConfig validates the pipeline selected by a session or tenant,
+// such pipelines answer streaming requests and must therefore stream the chat completion
+func (r *PipelineRegistry) ValidateConfig(pipeline *types.PipelineConfig) error {
+	if pipeline.IsEmpty() {
+		return nil
+	}
+	steps, err := r.Resolve(pipeline)
+	if err != nil {
+		return err
+	}
+	if err := r.Validate(steps); err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(steps, func(step types.PipelineStep) bool {
+		return step.Event == types.CHAT_COMPLETION_STREAM
+	}) {
+		return fmt.Errorf("pipeline must contain the %s event", types.CHAT_COMPLETION_STREAM)
+	}
+	return nil
+}
+
+// Resolve returns the steps of the first non-empty pipeline config, in order of precedence,
+// and the default pipeline when none is set
+func (r *PipelineRegistry) Resolve(pipelines ...*types.PipelineConfig) ([]types.PipelineStep, error) {
+	for _, pipeline := range pipelines {
+		if pipeline.IsEmpty() {
+			continue
+		}
+		if len(pipeline.Steps) > 0 {
+			return pipeline.Steps, nil
+		}
+		steps, ok := r.pipelines[pipeline.Name]
+		if !ok {
+			return nil, fmt.Errorf("pipeline %q not found", pipeline.Name)
+		}
+		return steps, nil
+	}
+	steps, ok := r.pipelines[r.defaultPipeline]
+	if !ok {
+		return nil, fmt.Errorf("default pipeline %q not found", r.defaultPipeline)
+	}
+	return steps, nil
+}
+
+// ValidatePipelines validates the configured pipelines once all plugins are registered
+func ValidatePipelines(r *PipelineRegistry) error {
+	if _, ok := r.pipelines[r.defaultPipeline]; !ok {
+		return fmt.Errorf("default pipeline %q not found", r.defaultPipeline)
+	}
+	for name, steps := range r.pipelines {
+		if err := r.Validate(steps); err != nil {
+			return fmt.Errorf("invalid pipeline %q: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package chatpipline
+
+import (
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/config"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+func newTestPipelineRegistry(cfg *config.Config) *PipelineRegistry {
+	manager := NewEventManager()
+	manager.Register(&PluginTracing{})
+	manager.Register(&testPlugin{
+		name:   "test_plugin",
+		events: []types.EventType{types.CHUNK_SEARCH, types.CHAT_COMPLETION, types.CHAT_COMPLETION_STREAM},
+	})
+	return NewPipelineRegistry(manager, cfg)
+}
+
+func TestPipelineRegistryValidate(t *testing.T) {
+	registry := newTestPipelineRegistry(nil)
+
+	tests := []struct {
+		name    string
+		steps   []types.PipelineStep
+		wantErr bool
+	}{
+		{
+			name:    "Empty",
+			wantErr: true,
+		},
+		{
+			name: "RegisteredEvents",
+			steps: []types.PipelineStep{
+				{Event: types.CHUNK_SEARCH, Params: map[string]interface{}{"embedding_top_k": 20}},
+				{Event: types.CHAT_COMPLETION_STREAM},
+			},
+		},
+		{
+			name:    "UnregisteredEvent",
+			steps:   []types.PipelineStep{{Event: types.EventType("unknown")}},
+			wantErr: true,
+		},
+		{
+			name:    "TracingOnlyEvent",
+			steps:   []types.PipelineStep{{Event: types.CHUNK_RERANK}},
+			wantErr: true,
+		},
+		{
+			name: "UnknownParam",
+			steps: []types.PipelineStep{
+				{Event: types.CHUNK_SEARCH, Params: map[string]interface{}{"top_k": 20}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "InvalidParamType",
+			steps: []types.PipelineStep{
+				{Event: types.CHUNK_SEARCH, Params: map[string]interface{}{"embedding_top_k": "20"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ProtectedParam",
+			steps: []types.PipelineStep{
+				{Event: types.CHUNK_SEARCH, Params: map[string]interface{}{"query": "overridden"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ProtectedParamOtherCase",
+			steps: []types.PipelineStep{
+				{Event: types.CHUNK_SEARCH, Params: map[string]interface{}{"Knowledge_Base_IDs": []string{"kb"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "InvalidTokenBudget",
+			steps: []types.PipelineStep{
+				{Event: types.CHUNK_SEARCH, Params: map[string]interface{}{
+					"token_budget": map[string]interface{}{"history_share": 0.5, "content_share": 0.8},
+				}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := registry.Validate(tt.steps)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPipelineRegistryValidateConfig(t *testing.T) {
+	registry := newTestPipelineRegistry(nil)
+
+	if err := registry.ValidateConfig(nil); err != nil {
+		t.Errorf("Expected nil error for empty config, got %v", err)
+	}
+	if err := registry.ValidateConfig(&types.PipelineConfig{Name: "chat"}); err == nil {
+		t.Error("Expected error for pipeline without streaming chat completion")
+	}
+	if err := registry.ValidateConfig(&types.PipelineConfig{Name: "missing"}); err == nil {
+		t.Error("Expected error for unknown pipeline")
+	}
+	err := registry.ValidateConfig(&types.PipelineConfig{Steps: []types.PipelineStep{
+		{Event: types.CHUNK_SEARCH},
+		{Event: types.CHAT_COMPLETION_STREAM},
+	}})
+	if err != nil {
+		t.Errorf("Expected nil error, got %v", err)
+	}
+}
+
+func TestPipelineRegistryResolve(t *testing.T) {
+	custom := []types.PipelineStep{{Event: types.CHUNK_SEARCH}, {Event: types.CHAT_COMPLETION_STREAM}}
+	registry := newTestPipelineRegistry(&config.Config{Conversation: &config.ConversationConfig{
+		Pipelines:       map[string][]types.PipelineStep{"custom": custom},
+		DefaultPipeline: "custom",
+	}})
+
+	t.Run("Default", func(t *testing.T) {
+		steps, err := registry.Resolve(nil, &types.PipelineConfig{})
+		if err != nil || len(steps) != len(custom) {
+			t.Errorf("Expected the configured default pipeline, got %v, %v", steps, err)
+		}
+	})
+
+	t.Run("Precedence", func(t *testing.T) {
+		steps, err := registry.Resolve(&types.PipelineConfig{Name: "chat"}, &types.PipelineConfig{Name: "custom"})
+		if err != nil || len(steps) != 1 || steps[0].Event != types.CHAT_COMPLETION {
+			t.Errorf("Expected the chat pipeline, got %v, %v", steps, err)
+		}
+	})
+
+	t.Run("InlineSteps", func(t *testing.T) {
+		inline := []types.PipelineStep{{Event: types.CHAT_COMPLETION_STREAM}}
+		steps, err := registry.Resolve(&types.PipelineConfig{Name: "chat", Steps: inline})
+		if err != nil || len(steps) != 1 || steps[0].Event != types.CHAT_COMPLETION_STREAM {
+			t.Errorf("Expected the inline steps, got %v, %v", steps, err)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		if _, err := registry.Resolve(&types.PipelineConfig{Name: "missing"}); err == nil {
+			t.Error("Expected error for unknown pipeline")
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package chatpipline
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/Tencent/WeKnora/internal/config"
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/models/chat"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+)
+
+const (
+	// defaultMaxParaphrases is the maximum number of paraphrases of a query when the config sets none
+	defaultMaxParaphrases = 3
+	// defaultMaxExpansionCalls is the maximum number of chat model calls of an expansion when the config sets none
+	defaultMaxExpansionCalls = 2
+	// paraphraseMaxTokens is the completion limit of each paraphrase
+	paraphraseMaxTokens = 64
+	// hypotheticalPassageMaxTokens is the completion limit of the hypothetical answer passage
+	hypotheticalPassageMaxTokens = 256
+)
+
+// listMarkerRegexp matches the list marker the chat model puts before a paraphrase
+var listMarkerRegexp = regexp.MustCompile(`^(?:[-*•]|\d+[.、)）])\s*`)
+
+// PluginQueryExpand expands terse queries into paraphrases and a hypothetical answer passage (HyDE),
+// each expansion is searched besides the query by PluginSearch and the results are fused
+type PluginQueryExpand struct {
+	modelService interfaces.ModelService
+	config       *config.Config
+}
+
+// NewPluginQueryExpand creates and registers a new PluginQueryExpand instance
+func NewPluginQueryExpand(eventManager *EventManager,
+	modelService interfaces.ModelService, config *config.Config,
+) *PluginQueryExpand {
+	res := &PluginQueryExpand{modelService: modelService, config: config}
+	eventManager.Register(res)
+	return res
+}
+
+// ActivationEvents returns the event types this plugin handles
+func (p *PluginQueryExpand) ActivationEvents() []types.EventType {
+	return []types.EventType{types.QUERY_EXPAND}
+}
+
+// OnEvent processes the QUERY_EXPAND event. Paraphrases and the hypothetical passage are generated
+// concurrently within the cap on chat model calls, paraphrases first.
+// Expansion is best effort, a failed generation leaves the query to be searched on its own
+func (p *PluginQueryExpand) OnEvent(ctx context.Context,
+	eventType types.EventType, chatManage *types.ChatManage, next func() *PluginError,
+) *PluginError {
+	chatManage.Expansions = nil
+	cfg := p.expansionConfig()
+	paraphrases := min(chatManage.QueryParaphrases, cfg.MaxParaphrases)
+	if paraphrases <= 0 && !chatManage.QueryHyDE {
+		return next()
+	}
+	query := strings.TrimSpace(chatManage.RewriteQuery)
+	if query == "" {
+		query = strings.TrimSpace(chatManage.Query)
+	}
+
+	chatModel, err := p.modelService.GetChatModel(ctx, chatManage.ChatModelID)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to get chat model, session_id: %s, error: %v", chatManage.SessionID, err)
+		return next()
+	}
+
+	var wg sync.WaitGroup
+	var paraphraseList []string
+	var passage string
+	calls := cfg.MaxLLMCalls
+	if paraphrases > 0 && calls > 0 {
+		calls--
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			paraphraseList = p.paraphrase(ctx, chatModel, cfg.ParaphrasePrompt, query, paraphrases)
+		}()
+	}
+	if chatManage.QueryHyDE && calls > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			passage = p.hypotheticalPassage(ctx, chatModel, cfg.HyDEPrompt, query)
+		}()
+	}
+	wg.Wait()
+
+	chatManage.Expansions = uniqueExpansions(query, append(paraphraseList, passage))
+	logger.Infof(ctx, "Expanded query into %d expansions, session_id: %s, expansions: %v",
+		len(chatManage.Expansions), chatManage.SessionID, chatManage.Expansions)
+	return next()
+}
+
+// expansionConfig returns the query expansion config with defaults for the limits it does not set
+func (p *PluginQueryExpand) expansionConfig() config.QueryExpansionConfig {
+	var cfg config.QueryExpansionConfig
+	if p.config != nil && p.config.Conversation != nil && p.config.Conversation.QueryExpansion != nil {
+		cfg = *p.config.Conversation.QueryExpansion
+	}
+	if cfg.MaxParaphrases <= 0 {
+		cfg.MaxParaphrases = defaultMaxParaphrases
+	}
+	if cfg.MaxLLMCalls <= 0 {
+		cfg.MaxLLMCalls = defaultMaxExpansionCalls
+	}
+	return cfg
+}
+
+// paraphrase asks the chat model for paraphrases of the query, one per line
+func (p *PluginQueryExpand) paraphrase(ctx context.Context,
+	chatModel chat.Chat, prompt string, query string, count int,
+) []string {
+	content, err := expandQuery(ctx, chatModel, prompt, map[string]interface{}{
+		"Query": query,
+		"Count": count,
+	}, &chat.ChatOptions{Temperature: 0.7, MaxCompletionTokens: paraphraseMaxTokens * count})
+	if err != nil {
+		logger.Errorf(ctx, "Failed to paraphrase query: %v", err)
+		return nil
+	}
+	return parseParaphrases(content, count)
+}
+
+// hypotheticalPassage asks the chat model for a passage answering the query,
+// which is closer to the chunks holding the answer than the query itself
+func (p *PluginQueryExpand) hypotheticalPassage(ctx context.Context,
+	chatModel chat.Chat, prompt string, query string,
+) string {
+	content, err := expandQuery(ctx, chatModel, prompt, map[string]interface{}{
+		"Query": query,
+	}, &chat.ChatOptions{Temperature: 0.3, MaxCompletionTokens: hypotheticalPassageMaxTokens})
+	if err != nil {
+		logger.Errorf(ctx, "Failed to generate hypothetical passage: %v", err)
+		return ""
+	}
+	return strings.TrimSpace(content)
+}
+
+// expandQuery renders the prompt and returns the answer of the chat model without its thinking process
+func expandQuery(ctx context.Context, chatModel chat.Chat,
+	prompt string, data map[string]interface{}, opts *chat.ChatOptions,
+) (string, error) {
+	tmpl, err := template.New("expandQuery").Parse(prompt)
+	if err != nil {
+		return "", err
+	}
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, data); err != nil {
+		return "", err
+	}
+	thinking := false
+	opts.Thinking = &thinking
+	response, err := chatModel.Chat(ctx, []chat.Message{{Role: "user", Content: content.String()}}, opts)
+	if err != nil {
+		return "", err
+	}
+	return reg.ReplaceAllString(response.Content, ""), nil
+}
+
+// parseParaphrases returns up to count non-empty lines of the answer without their list markers
+func parseParaphrases(content string, count int) []string {
+	var paraphrases []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(listMarkerRegexp.ReplaceAllString(strings.TrimSpace(line), ""))
+		if line == "" {
+			continue
+		}
+		paraphrases = append(paraphrases, line)
+		if len(paraphrases) == count {
+			break
+		}
+	}
+	return paraphrases
+}
+
+// uniqueExpansions removes empty expansions and those repeating the query or another expansion
+func uniqueExpansions(query string, expansions []string) []string {
+	seen := map[string]bool{strings.ToLower(query): true}
+	var unique []string
+	for _, expansion := range expansions {
+		key := strings.ToLower(strings.TrimSpace(expansion))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, strings.TrimSpace(expansion))
+	}
+	return unique
+}
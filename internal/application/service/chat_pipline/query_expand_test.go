@@ -0,0 +1,45 @@
+package chatpipline
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+func TestParseParaphrases(t *testing.T) {
+	content := "1. 微信支付如何保障安全\n\n2、微信支付的安全机制\n- 微信付款是否安全\n* 第四个改写"
+	got := parseParaphrases(content, 3)
+	want := []string{"微信支付如何保障安全", "微信支付的安全机制", "微信付款是否安全"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	expansions := uniqueExpansions("微信支付安全吗", []string{"微信支付安全吗", " 微信支付的安全机制 ", "", "微信支付的安全机制"})
+	if !slices.Equal(expansions, []string{"微信支付的安全机制"}) {
+		t.Errorf("Expected the query, empty and repeated expansions to be removed, got %v", expansions)
+	}
+}
+
+func TestFuseQueryResults(t *testing.T) {
+	results := fuseQueryResults([][]*types.SearchResult{
+		{{ID: "a", Score: 0.9}, {ID: "b", Score: 0.8}, {ID: "a", Score: 0.5}},
+		{{ID: "b", Score: 0.7}, {ID: "c", Score: 0.6}},
+		nil,
+		{{ID: "b", Score: 0.9}, {ID: "a", Score: 0.4}},
+	})
+
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	if !slices.Equal(ids, []string{"b", "a", "c"}) {
+		t.Fatalf("Expected results ranked by reciprocal rank fusion, got %v", ids)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score || results[i].Score <= 0 || results[i-1].Score > 1 {
+			t.Errorf("Expected normalized scores in descending order, got %v and %v",
+				results[i-1].Score, results[i].Score)
+		}
+	}
+}
@@ -58,54 +58,12 @@ func (p *PluginRewrite) OnEvent(ctx context.Context,
 	// Initialize rewritten query as original query
 	chatManage.RewriteQuery = chatManage.Query
 
-	// Get conversation history
-	history, err := p.messageService.GetRecentMessagesBySession(ctx, chatManage.SessionID, 20)
-	if err != nil {
-		logger.Errorf(ctx, "Failed to get conversation history, session_id: %s, error: %v", chatManage.SessionID, err)
-	}
-
-	// Convert historical messages to conversation history structure
-	historyMap := make(map[string]*types.History)
-
-	// Process historical messages, grouped by requestID
-	for _, message := range history {
-		history, ok := historyMap[message.RequestID]
-		if !ok {
-			history = &types.History{}
-		}
-		if message.Role == "user" {
-			// User message as query
-			history.Query = message.Content
-			history.CreateAt = message.CreatedAt
-		} else {
-			// System message as answer, while removing thinking process
-			history.Answer = reg.ReplaceAllString(message.Content, "")
-			history.KnowledgeReferences = message.KnowledgeReferences
-		}
-		historyMap[message.RequestID] = history
+	// History provided by the caller (e.g. the messages of an OpenAI style request) takes precedence,
+	// otherwise it is loaded from the messages of the session
+	if chatManage.History == nil {
+		chatManage.History = p.getHistory(ctx, chatManage)
 	}
-
-	// Convert to list and filter incomplete conversations
-	historyList := make([]*types.History, 0)
-	for _, history := range historyMap {
-		if history.Answer != "" && history.Query != "" {
-			historyList = append(historyList, history)
-		}
-	}
-
-	// Sort by time, keep the most recent conversations
-	sort.Slice(historyList, func(i, j int) bool {
-		return historyList[i].CreateAt.After(historyList[j].CreateAt)
-	})
-
-	// Limit the number of historical records
-	if len(historyList) > p.config.Conversation.MaxRounds {
-		historyList = historyList[:p.config.Conversation.MaxRounds]
-	}
-
-	// Reverse to chronological order
-	slices.Reverse(historyList)
-	chatManage.History = historyList
+	historyList := chatManage.History
 
 	userTmpl, err := template.New("rewriteContent").Parse(p.config.Conversation.RewritePromptUser)
 	if err != nil {
@@ -124,6 +82,7 @@ func (p *PluginRewrite) OnEvent(ctx context.Context,
 		"CurrentTime":  currentTime,
 		"Yesterday":    time.Now().AddDate(0, 0, -1).Format("2006-01-02"),
 		"Conversation": historyList,
+		"Summary":      chatManage.HistorySummary,
 	})
 	if err != nil {
 		logger.GetLogger(ctx).Errorf("Failed to execute template, session_id: %s, error: %v", chatManage.SessionID, err)
@@ -134,6 +93,7 @@ func (p *PluginRewrite) OnEvent(ctx context.Context,
 		"CurrentTime":  currentTime,
 		"Yesterday":    time.Now().AddDate(0, 0, -1).Format("2006-01-02"),
 		"Conversation": historyList,
+		"Summary":      chatManage.HistorySummary,
 	})
 	if err != nil {
 		logger.Errorf(ctx, "Failed to execute template, session_id: %s, error: %v", chatManage.SessionID, err)
@@ -174,3 +134,66 @@ func (p *PluginRewrite) OnEvent(ctx context.Context,
 		chatManage.SessionID, chatManage.RewriteQuery)
 	return next()
 }
+
+// getHistory loads the most recent complete conversation rounds of the session in chronological order,
+// rounds already compressed into the conversation summary are left out
+func (p *PluginRewrite) getHistory(ctx context.Context, chatManage *types.ChatManage) []*types.History {
+	// Get conversation history
+	history, err := p.messageService.GetRecentMessagesBySession(ctx, chatManage.SessionID, 20)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to get conversation history, session_id: %s, error: %v", chatManage.SessionID, err)
+	}
+
+	historyList := GroupHistory(history)
+	if chatManage.SummaryUntil != nil {
+		historyList = slices.DeleteFunc(historyList, func(history *types.History) bool {
+			return !history.CreateAt.After(*chatManage.SummaryUntil)
+		})
+	}
+
+	// Limit the number of historical records
+	if len(historyList) > p.config.Conversation.MaxRounds {
+		historyList = historyList[len(historyList)-p.config.Conversation.MaxRounds:]
+	}
+	return historyList
+}
+
+// GroupHistory groups messages into complete conversation rounds by request ID,
+// in chronological order and with the thinking process removed from the answers.
+// Rounds whose answer failed are incomplete and left out
+func GroupHistory(messages []*types.Message) []*types.History {
+	// Convert historical messages to conversation history structure
+	historyMap := make(map[string]*types.History)
+
+	// Process historical messages, grouped by requestID
+	for _, message := range messages {
+		history, ok := historyMap[message.RequestID]
+		if !ok {
+			history = &types.History{}
+		}
+		if message.Role == "user" {
+			// User message as query
+			history.Query = message.Content
+			history.CreateAt = message.CreatedAt
+		} else if !message.IsFailed {
+			// System message as answer, while removing thinking process
+			history.Answer = reg.ReplaceAllString(message.Content, "")
+			history.KnowledgeReferences = message.KnowledgeReferences
+		}
+		historyMap[message.RequestID] = history
+	}
+
+	// Convert to list and filter incomplete conversations
+	historyList := make([]*types.History, 0)
+	for _, history := range historyMap {
+		if history.Answer != "" && history.Query != "" {
+			historyList = append(historyList, history)
+		}
+	}
+
+	// Sort by time in chronological order
+	sort.Slice(historyList, func(i, j int) bool {
+		return historyList[i].CreateAt.Before(historyList[j].CreateAt)
+	})
+	return historyList
+}
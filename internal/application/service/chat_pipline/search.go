@@ -1,8 +1,11 @@
 package chatpipline
 
 import (
+	"cmp"
 	"context"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/Tencent/WeKnora/internal/config"
 	"github.com/Tencent/WeKnora/internal/logger"
@@ -10,6 +13,9 @@ import (
 	"github.com/Tencent/WeKnora/internal/types/interfaces"
 )
 
+// queryFusionK is the rank constant of the reciprocal rank fusion of the results of several queries
+const queryFusionK = 60
+
 // PluginSearch implements search functionality for chat pipeline
 type PluginSearch struct {
 	knowledgeBaseService interfaces.KnowledgeBaseService
@@ -46,11 +52,15 @@ func (p *PluginSearch) OnEvent(ctx context.Context,
 		VectorThreshold:  chatManage.VectorThreshold,
 		KeywordThreshold: chatManage.KeywordThreshold,
 		MatchCount:       chatManage.EmbeddingTopK,
+		FusionStrategy:   chatManage.FusionStrategy,
+		VectorWeight:     chatManage.VectorWeight,
+		KeywordWeight:    chatManage.KeywordWeight,
+		Filter:           chatManage.SearchFilter,
 	}
 	logger.Infof(ctx, "Search parameters: %v", searchParams)
 
 	// Perform initial hybrid search
-	searchResults, err := p.knowledgeBaseService.HybridSearch(ctx, chatManage.KnowledgeBaseID, searchParams)
+	searchResults, err := p.knowledgeBaseService.MultiHybridSearch(ctx, chatManage.GetKnowledgeBaseIDs(), searchParams)
 	logger.Infof(ctx, "Search results count: %d, error: %v", len(searchResults), err)
 	if err != nil {
 		return ErrSearch.WithError(err)
@@ -58,19 +68,13 @@ func (p *PluginSearch) OnEvent(ctx context.Context,
 	chatManage.SearchResult = searchResults
 	logger.Infof(ctx, "Search result count: %d", len(chatManage.SearchResult))
 
-	// Add relevant results from chat history
-	historyResult := p.getSearchResultFromHistory(chatManage)
-	if historyResult != nil {
-		logger.Infof(ctx, "Add history result, result count: %d", len(historyResult))
-		chatManage.SearchResult = append(chatManage.SearchResult, historyResult...)
-	}
-
 	// Try search with processed query if different from rewrite query
 	if chatManage.RewriteQuery != chatManage.ProcessedQuery {
-		searchParams.QueryText = strings.TrimSpace(chatManage.ProcessedQuery)
-		searchResults, err = p.knowledgeBaseService.HybridSearch(ctx, chatManage.KnowledgeBaseID, searchParams)
+		processedParams := searchParams
+		processedParams.QueryText = strings.TrimSpace(chatManage.ProcessedQuery)
+		searchResults, err = p.knowledgeBaseService.MultiHybridSearch(ctx, chatManage.GetKnowledgeBaseIDs(), processedParams)
 		logger.Infof(ctx, "Search by processed query: %s, results count: %d, error: %v",
-			searchParams.QueryText, len(searchResults), err,
+			processedParams.QueryText, len(searchResults), err,
 		)
 		if err != nil {
 			return ErrSearch.WithError(err)
@@ -78,6 +82,23 @@ func (p *PluginSearch) OnEvent(ctx context.Context,
 		chatManage.SearchResult = append(chatManage.SearchResult, searchResults...)
 	}
 
+	// Search the expansions of the query and fuse their results with the results of the query
+	if len(chatManage.Expansions) > 0 {
+		chatManage.SearchResult = p.searchExpansions(ctx, chatManage, searchParams)
+		logger.Infof(ctx, "Fused results of %d expansions, result count: %d",
+			len(chatManage.Expansions), len(chatManage.SearchResult))
+	}
+
+	// Add relevant results from chat history, skipped when a filter is set since they may not match it
+	var historyResult []*types.SearchResult
+	if chatManage.SearchFilter.IsEmpty() {
+		historyResult = p.getSearchResultFromHistory(chatManage)
+	}
+	if historyResult != nil {
+		logger.Infof(ctx, "Add history result, result count: %d", len(historyResult))
+		chatManage.SearchResult = append(chatManage.SearchResult, historyResult...)
+	}
+
 	// remove duplicate results
 	chatManage.SearchResult = removeDuplicateResults(chatManage.SearchResult)
 
@@ -94,6 +115,64 @@ func (p *PluginSearch) OnEvent(ctx context.Context,
 	return ErrSearchNothing
 }
 
+// searchExpansions searches the expansions of the query concurrently and fuses their results
+// with the search results of the query, an expansion whose search fails is skipped
+func (p *PluginSearch) searchExpansions(ctx context.Context,
+	chatManage *types.ChatManage, params types.SearchParams,
+) []*types.SearchResult {
+	lists := make([][]*types.SearchResult, len(chatManage.Expansions)+1)
+	lists[0] = chatManage.SearchResult
+
+	var wg sync.WaitGroup
+	for i, expansion := range chatManage.Expansions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			expansionParams := params
+			expansionParams.QueryText = expansion
+			results, err := p.knowledgeBaseService.MultiHybridSearch(ctx,
+				chatManage.GetKnowledgeBaseIDs(), expansionParams)
+			if err != nil {
+				logger.Warnf(ctx, "Failed to search expansion: %s, error: %v", expansion, err)
+				return
+			}
+			logger.Infof(ctx, "Search by expansion: %s, results count: %d", expansion, len(results))
+			lists[i+1] = results
+		}()
+	}
+	wg.Wait()
+	return fuseQueryResults(lists)
+}
+
+// fuseQueryResults fuses the result lists of several queries by reciprocal rank fusion.
+// The fused score is normalized so that a result ranked first by every query scores 1,
+// the fused results are sorted by it in descending order
+func fuseQueryResults(lists [][]*types.SearchResult) []*types.SearchResult {
+	fused := make(map[string]*types.SearchResult)
+	scores := make(map[string]float64)
+	var order []string
+	for _, list := range lists {
+		ranked := removeDuplicateResults(slices.Clone(list))
+		slices.SortStableFunc(ranked, func(a, b *types.SearchResult) int { return cmp.Compare(b.Score, a.Score) })
+		for i, result := range ranked {
+			if _, ok := fused[result.ID]; !ok {
+				fused[result.ID] = result
+				order = append(order, result.ID)
+			}
+			scores[result.ID] += 1.0 / float64(queryFusionK+i+1)
+		}
+	}
+
+	best := float64(len(lists)) / float64(queryFusionK+1)
+	results := make([]*types.SearchResult, 0, len(order))
+	for _, id := range order {
+		fused[id].Score = scores[id] / best
+		results = append(results, fused[id])
+	}
+	slices.SortStableFunc(results, func(a, b *types.SearchResult) int { return cmp.Compare(b.Score, a.Score) })
+	return results
+}
+
 // getSearchResultFromHistory retrieves relevant knowledge references from chat history
 func (p *PluginSearch) getSearchResultFromHistory(chatManage *types.ChatManage) []*types.SearchResult {
 	if len(chatManage.History) == 0 {
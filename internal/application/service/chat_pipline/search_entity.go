@@ -2,13 +2,23 @@ package chatpipline
 
 import (
 	"context"
+	"slices"
 
 	"github.com/Tencent/WeKnora/internal/logger"
 	"github.com/Tencent/WeKnora/internal/types"
 	"github.com/Tencent/WeKnora/internal/types/interfaces"
 )
 
-// PluginSearch implements search functionality for chat pipeline
+const (
+	// DefaultGraphMaxHops is the default number of relations walked from the query entities
+	DefaultGraphMaxHops = 2
+	// MaxGraphMaxHops is the maximum number of relations walked from the query entities
+	MaxGraphMaxHops = 3
+	// DefaultGraphPathTopK is the default number of graph paths whose chunks are retrieved
+	DefaultGraphPathTopK = 5
+)
+
+// PluginSearchEntity implements graph search functionality for chat pipeline
 type PluginSearchEntity struct {
 	graphRepo     interfaces.RetrieveGraphRepository
 	chunkRepo     interfaces.ChunkRepository
@@ -36,6 +46,7 @@ func (p *PluginSearchEntity) ActivationEvents() []types.EventType {
 }
 
 // OnEvent handles search events in the chat pipeline
+// It walks the graph of every knowledge base from the query entities and adds the chunks along the best paths
 func (p *PluginSearchEntity) OnEvent(ctx context.Context,
 	eventType types.EventType, chatManage *types.ChatManage, next func() *PluginError,
 ) *PluginError {
@@ -45,21 +56,45 @@ func (p *PluginSearchEntity) OnEvent(ctx context.Context,
 		return next()
 	}
 
-	graph, err := p.graphRepo.SearchNode(ctx, types.NameSpace{KnowledgeBase: chatManage.KnowledgeBaseID}, entity)
-	if err != nil {
-		logger.Errorf(ctx, "Failed to search node, session_id: %s, error: %v", chatManage.SessionID, err)
-		return next()
+	query := &types.GraphPathQuery{
+		Entities:      entity,
+		MaxHops:       chatManage.GraphMaxHops,
+		RelationTypes: chatManage.GraphRelationTypes,
+		Limit:         chatManage.GraphPathTopK,
+	}
+	if query.MaxHops <= 0 {
+		query.MaxHops = DefaultGraphMaxHops
+	}
+	query.MaxHops = min(query.MaxHops, MaxGraphMaxHops)
+	if query.Limit <= 0 {
+		query.Limit = DefaultGraphPathTopK
 	}
-	chatManage.GraphResult = graph
-	logger.Infof(ctx, "search entity result count: %d", len(graph.Node))
-	// graphStr, _ := json.Marshal(graph)
-	// logger.Debugf(ctx, "search entity result: %s", string(graphStr))
 
-	chunkIDs := filterSeenChunk(ctx, graph, chatManage.SearchResult)
-	if len(chunkIDs) == 0 {
+	// Every knowledge base has its own graph namespace, search them all and keep the best paths
+	paths := []*types.GraphPath{}
+	for _, kbID := range chatManage.GetKnowledgeBaseIDs() {
+		kbPaths, err := p.graphRepo.SearchPath(ctx, types.NameSpace{KnowledgeBase: kbID}, query)
+		if err != nil {
+			logger.Errorf(ctx, "Failed to search path, session_id: %s, knowledge_base_id: %s, error: %v",
+				chatManage.SessionID, kbID, err)
+			continue
+		}
+		paths = append(paths, kbPaths...)
+	}
+	paths = types.RankGraphPaths(paths, entity, query.Limit)
+	chatManage.GraphResult = pathsToGraph(paths)
+	logger.Infof(ctx, "search entity result, path count: %d, node count: %d",
+		len(paths), len(chatManage.GraphResult.Node))
+
+	chunkPaths := filterSeenChunk(ctx, paths, chatManage.SearchResult)
+	if len(chunkPaths) == 0 {
 		logger.Infof(ctx, "No new chunk found")
 		return next()
 	}
+	chunkIDs := make([]string, 0, len(chunkPaths))
+	for chunkID := range chunkPaths {
+		chunkIDs = append(chunkIDs, chunkID)
+	}
 	chunks, err := p.chunkRepo.ListChunksByID(ctx, ctx.Value(types.TenantIDContextKey).(uint), chunkIDs)
 	if err != nil {
 		logger.Errorf(ctx, "Failed to list chunks, session_id: %s, error: %v", chatManage.SessionID, err)
@@ -67,7 +102,17 @@ func (p *PluginSearchEntity) OnEvent(ctx context.Context,
 	}
 	knowledgeIDs := []string{}
 	for _, chunk := range chunks {
-		knowledgeIDs = append(knowledgeIDs, chunk.KnowledgeID)
+		if !slices.Contains(knowledgeIDs, chunk.KnowledgeID) {
+			knowledgeIDs = append(knowledgeIDs, chunk.KnowledgeID)
+		}
+	}
+	// Chunks of the knowledge not matching the search filter are skipped with their knowledge
+	if !chatManage.SearchFilter.IsEmpty() {
+		knowledgeIDs, err = p.matchSearchFilter(ctx, chatManage, knowledgeIDs)
+		if err != nil {
+			logger.Errorf(ctx, "Failed to apply search filter, session_id: %s, error: %v", chatManage.SessionID, err)
+			return next()
+		}
 	}
 	knowledges, err := p.knowledgeRepo.GetKnowledgeBatch(ctx, ctx.Value(types.TenantIDContextKey).(uint), knowledgeIDs)
 	if err != nil {
@@ -79,8 +124,18 @@ func (p *PluginSearchEntity) OnEvent(ctx context.Context,
 	for _, knowledge := range knowledges {
 		knowledgeMap[knowledge.ID] = knowledge
 	}
+	// The best path scores 1, like an exact match, and the chunks of other paths score relative to it
+	bestScore := paths[0].Score
 	for _, chunk := range chunks {
-		searchResult := chunk2SearchResult(chunk, knowledgeMap[chunk.KnowledgeID])
+		knowledge := knowledgeMap[chunk.KnowledgeID]
+		if knowledge == nil {
+			continue
+		}
+		searchResult := chunk2SearchResult(chunk, knowledge)
+		searchResult.GraphPath = chunkPaths[chunk.ID]
+		if bestScore > 0 {
+			searchResult.Score = searchResult.GraphPath.Score / bestScore
+		}
 		chatManage.SearchResult = append(chatManage.SearchResult, searchResult)
 	}
 	// remove duplicate results
@@ -93,25 +148,71 @@ func (p *PluginSearchEntity) OnEvent(ctx context.Context,
 	return next()
 }
 
-func filterSeenChunk(ctx context.Context, graph *types.GraphData, searchResult []*types.SearchResult) []string {
+// matchSearchFilter returns the knowledge among the given ones that matches the search filter of the chat
+func (p *PluginSearchEntity) matchSearchFilter(ctx context.Context,
+	chatManage *types.ChatManage, knowledgeIDs []string,
+) ([]string, error) {
+	filter := *chatManage.SearchFilter
+	if len(filter.KnowledgeIDs) > 0 {
+		knowledgeIDs = slices.DeleteFunc(knowledgeIDs, func(id string) bool {
+			return !slices.Contains(filter.KnowledgeIDs, id)
+		})
+	}
+	if !filter.HasKnowledgeConditions() || len(knowledgeIDs) == 0 {
+		return knowledgeIDs, nil
+	}
+	filter.KnowledgeIDs = knowledgeIDs
+	return p.knowledgeRepo.ListKnowledgeIDsByFilter(ctx, ctx.Value(types.TenantIDContextKey).(uint),
+		chatManage.GetKnowledgeBaseIDs(), &filter, len(knowledgeIDs))
+}
+
+// filterSeenChunk maps the chunks of the path nodes that are not search results yet to the best path containing them,
+// the paths must be sorted by score
+func filterSeenChunk(
+	ctx context.Context, paths []*types.GraphPath, searchResult []*types.SearchResult,
+) map[string]*types.GraphPath {
 	seen := map[string]bool{}
 	for _, chunk := range searchResult {
 		seen[chunk.ID] = true
 	}
 	logger.Infof(ctx, "filterSeenChunk: seen count: %d", len(seen))
 
-	chunkIDs := []string{}
-	for _, node := range graph.Node {
-		for _, chunkID := range node.Chunks {
-			if seen[chunkID] {
-				continue
+	chunkPaths := map[string]*types.GraphPath{}
+	for _, path := range paths {
+		for _, node := range path.Nodes {
+			for _, chunkID := range node.Chunks {
+				if seen[chunkID] {
+					continue
+				}
+				seen[chunkID] = true
+				chunkPaths[chunkID] = path
+			}
+		}
+	}
+	logger.Infof(ctx, "filterSeenChunk: new chunkIDs count: %d", len(chunkPaths))
+	return chunkPaths
+}
+
+// pathsToGraph merges the nodes and relations of the paths into one graph
+func pathsToGraph(paths []*types.GraphPath) *types.GraphData {
+	graph := &types.GraphData{}
+	seenNode := map[string]bool{}
+	seenRelation := map[types.GraphRelation]bool{}
+	for _, path := range paths {
+		for _, node := range path.Nodes {
+			if !seenNode[node.Name] {
+				seenNode[node.Name] = true
+				graph.Node = append(graph.Node, node)
+			}
+		}
+		for _, relation := range path.Relations {
+			if !seenRelation[*relation] {
+				seenRelation[*relation] = true
+				graph.Relation = append(graph.Relation, relation)
 			}
-			seen[chunkID] = true
-			chunkIDs = append(chunkIDs, chunkID)
 		}
 	}
-	logger.Infof(ctx, "filterSeenChunk: new chunkIDs count: %d", len(chunkIDs))
-	return chunkIDs
+	return graph
 }
 
 func chunk2SearchResult(chunk *types.Chunk, knowledge *types.Knowledge) *types.SearchResult {
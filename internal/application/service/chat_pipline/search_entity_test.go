@@ -0,0 +1,90 @@
+package chatpipline
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+)
+
+// fakeEntityKnowledgeRepo matches the knowledge of the given file type
+type fakeEntityKnowledgeRepo struct {
+	interfaces.KnowledgeRepository
+	fileTypes map[string]string
+}
+
+func (r *fakeEntityKnowledgeRepo) ListKnowledgeIDsByFilter(ctx context.Context,
+	tenantID uint, kbIDs []string, filter *types.SearchFilter, limit int,
+) ([]string, error) {
+	var ids []string
+	for _, id := range filter.KnowledgeIDs {
+		if r.fileTypes[id] == filter.FileTypes[0] && len(ids) < limit {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func TestRankedPathChunks(t *testing.T) {
+	service := &types.GraphNode{Name: "payment service", Chunks: []string{"c1"}}
+	team := &types.GraphNode{Name: "trading team", Chunks: []string{"c2"}}
+	manager := &types.GraphNode{Name: "alice", Chunks: []string{"c3"}}
+	other := &types.GraphNode{Name: "billing", Chunks: []string{"c1", "c4"}}
+
+	direct := &types.GraphPath{
+		Nodes:     []*types.GraphNode{service, other},
+		Relations: []*types.GraphRelation{{Node1: "payment service", Node2: "billing", Type: "calls"}},
+	}
+	twoHops := &types.GraphPath{
+		Nodes: []*types.GraphNode{service, team, manager},
+		Relations: []*types.GraphRelation{
+			{Node1: "trading team", Node2: "payment service", Type: "owns"},
+			{Node1: "alice", Node2: "trading team", Type: "manages"},
+		},
+	}
+
+	paths := types.RankGraphPaths([]*types.GraphPath{direct, twoHops}, []string{"payment", "alice"}, 5)
+	if paths[0] != twoHops {
+		t.Fatalf("Expected the path connecting both entities first, got %s", paths[0])
+	}
+	if got, want := twoHops.String(), "payment service <-[owns]- trading team <-[manages]- alice"; got != want {
+		t.Errorf("Expected path %q, got %q", want, got)
+	}
+
+	chunkPaths := filterSeenChunk(context.Background(), paths, []*types.SearchResult{{ID: "c2"}})
+	if _, ok := chunkPaths["c2"]; ok {
+		t.Error("Expected chunks already searched to be skipped")
+	}
+	if chunkPaths["c1"] != twoHops || chunkPaths["c3"] != twoHops {
+		t.Error("Expected chunks to be attributed to the best path containing them")
+	}
+	if chunkPaths["c4"] != direct {
+		t.Error("Expected chunks only on the direct path to be attributed to it")
+	}
+
+	graph := pathsToGraph(paths)
+	if len(graph.Node) != 4 || len(graph.Relation) != 3 {
+		t.Errorf("Expected 4 nodes and 3 relations, got %d nodes and %d relations", len(graph.Node), len(graph.Relation))
+	}
+}
+
+func TestMatchSearchFilter(t *testing.T) {
+	ctx := context.WithValue(context.Background(), types.TenantIDContextKey, uint(1))
+	p := &PluginSearchEntity{knowledgeRepo: &fakeEntityKnowledgeRepo{
+		fileTypes: map[string]string{"k1": "pdf", "k2": "docx", "k3": "pdf"},
+	}}
+
+	chatManage := &types.ChatManage{SearchFilter: &types.SearchFilter{KnowledgeIDs: []string{"k1", "k2"}}}
+	ids, err := p.matchSearchFilter(ctx, chatManage, []string{"k1", "k2", "k3"})
+	if err != nil || !reflect.DeepEqual(ids, []string{"k1", "k2"}) {
+		t.Errorf("Expected the knowledge of the filter, got %v, %v", ids, err)
+	}
+
+	chatManage.SearchFilter = &types.SearchFilter{KnowledgeIDs: []string{"k1", "k2"}, FileTypes: []string{"pdf"}}
+	ids, err = p.matchSearchFilter(ctx, chatManage, []string{"k1", "k2", "k3"})
+	if err != nil || !reflect.DeepEqual(ids, []string{"k1"}) {
+		t.Errorf("Expected the knowledge matching all conditions, got %v, %v", ids, err)
+	}
+}
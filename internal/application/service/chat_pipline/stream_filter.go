@@ -47,6 +47,14 @@ func (p *PluginStreamFilter) OnEvent(ctx context.Context,
 	go func() {
 		logger.Info(ctx, "Starting stream filter goroutine")
 		for resp := range oldStream {
+			// Pass errors through, a failed answer must not be replaced by the fallback response
+			if resp.ResponseType == types.ResponseTypeError {
+				logger.Errorf(ctx, "Chat completion stream failed: %s", resp.Content)
+				newStream <- resp
+				matchNoMatchBuilderPrefix = false
+				continue
+			}
+
 			// Accumulate answer content
 			if resp.ResponseType == types.ResponseTypeAnswer {
 				responseBuilder.WriteString(resp.Content)
@@ -0,0 +1,34 @@
+package chatpipline
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+func TestPluginStreamFilterPassesErrors(t *testing.T) {
+	ctx := context.WithValue(context.Background(), types.RequestIDContextKey, "request")
+	stream := make(chan types.StreamResponse, 2)
+	stream <- types.StreamResponse{ResponseType: types.ResponseTypeAnswer, Content: "NO_"}
+	stream <- types.StreamResponse{ResponseType: types.ResponseTypeError, Content: "connection reset", Done: true}
+	close(stream)
+
+	chatManage := &types.ChatManage{
+		SummaryConfig:    types.SummaryConfig{NoMatchPrefix: "NO_MATCH"},
+		FallbackResponse: "fallback",
+		ResponseChan:     stream,
+	}
+	plugin := &PluginStreamFilter{}
+	if err := plugin.OnEvent(ctx, types.STREAM_FILTER, chatManage, func() *PluginError { return nil }); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var responses []types.StreamResponse
+	for response := range chatManage.ResponseChan {
+		responses = append(responses, response)
+	}
+	if len(responses) != 1 || responses[0].ResponseType != types.ResponseTypeError {
+		t.Errorf("Expected the error to end the stream without the fallback response, got %+v", responses)
+	}
+}
@@ -0,0 +1,38 @@
+package chatpipline
+
+import "unicode"
+
+// isCJK reports whether a rune is a CJK character, which is about one token
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// EstimateTokens estimates the number of tokens of a text,
+// a CJK character is about one token and other text about four characters per token
+func EstimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// truncateTokens cuts a text to the estimated number of tokens
+func truncateTokens(text string, tokens int) string {
+	cjk, other := 0, 0
+	for i, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other++
+		}
+		if cjk+(other+3)/4 > tokens {
+			return text[:i]
+		}
+	}
+	return text
+}
@@ -27,12 +27,14 @@ func (p *PluginTracing) ActivationEvents() []types.EventType {
 		types.CHUNK_SEARCH,
 		types.CHUNK_RERANK,
 		types.CHUNK_MERGE,
+		types.CHUNK_EXPAND,
 		types.INTO_CHAT_MESSAGE,
 		types.CHAT_COMPLETION,
 		types.CHAT_COMPLETION_STREAM,
 		types.FILTER_TOP_K,
 		types.REWRITE_QUERY,
 		types.PREPROCESS_QUERY,
+		types.QUERY_EXPAND,
 	}
 }
 
@@ -57,6 +59,8 @@ func (p *PluginTracing) OnEvent(ctx context.Context,
 		return p.Rerank(ctx, eventType, chatManage, next)
 	case types.CHUNK_MERGE:
 		return p.Merge(ctx, eventType, chatManage, next)
+	case types.CHUNK_EXPAND:
+		return p.Expand(ctx, eventType, chatManage, next)
 	case types.INTO_CHAT_MESSAGE:
 		return p.IntoChatMessage(ctx, eventType, chatManage, next)
 	case types.CHAT_COMPLETION:
@@ -69,6 +73,8 @@ func (p *PluginTracing) OnEvent(ctx context.Context,
 		return p.RewriteQuery(ctx, eventType, chatManage, next)
 	case types.PREPROCESS_QUERY:
 		return p.PreprocessQuery(ctx, eventType, chatManage, next)
+	case types.QUERY_EXPAND:
+		return p.QueryExpand(ctx, eventType, chatManage, next)
 	}
 	return next()
 }
@@ -84,6 +90,9 @@ func (p *PluginTracing) Search(ctx context.Context,
 		attribute.Float64("vector_threshold", chatManage.VectorThreshold),
 		attribute.Float64("keyword_threshold", chatManage.KeywordThreshold),
 		attribute.Int("match_count", chatManage.EmbeddingTopK),
+		attribute.String("fusion_strategy", string(chatManage.FusionStrategy)),
+		attribute.Float64("vector_weight", chatManage.VectorWeight),
+		attribute.Float64("keyword_weight", chatManage.KeywordWeight),
 	)
 	err := next()
 	searchResultJson, _ := json.Marshal(chatManage.SearchResult)
@@ -135,6 +144,47 @@ func (p *PluginTracing) Merge(ctx context.Context,
 	return err
 }
 
+// Expand traces expansion operations in the chat pipeline
+func (p *PluginTracing) Expand(ctx context.Context,
+	eventType types.EventType, chatManage *types.ChatManage, next func() *PluginError,
+) *PluginError {
+	_, span := tracing.ContextWithSpan(ctx, "PluginTracing.Expand")
+	defer span.End()
+	span.SetAttributes(
+		attribute.Int("merge_results_count", len(chatManage.MergeResult)),
+		attribute.Int("expand_window", chatManage.ExpandWindow),
+		attribute.Bool("expand_to_parent", chatManage.ExpandToParent),
+		attribute.Int("expand_max_tokens", chatManage.ExpandMaxTokens),
+	)
+	err := next()
+	expandResultJson, _ := json.Marshal(chatManage.MergeResult)
+	span.SetAttributes(
+		attribute.Int("expand_results_count", len(chatManage.MergeResult)),
+		attribute.String("expand_results", string(expandResultJson)),
+	)
+	return err
+}
+
+// QueryExpand traces query expansion operations
+func (p *PluginTracing) QueryExpand(ctx context.Context,
+	eventType types.EventType, chatManage *types.ChatManage, next func() *PluginError,
+) *PluginError {
+	_, span := tracing.ContextWithSpan(ctx, "PluginTracing.QueryExpand")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("rewrite_query", chatManage.RewriteQuery),
+		attribute.Int("query_paraphrases", chatManage.QueryParaphrases),
+		attribute.Bool("query_hyde", chatManage.QueryHyDE),
+	)
+	err := next()
+	expansionsJson, _ := json.Marshal(chatManage.Expansions)
+	span.SetAttributes(
+		attribute.Int("expansions_count", len(chatManage.Expansions)),
+		attribute.String("expansions", string(expansionsJson)),
+	)
+	return err
+}
+
 // IntoChatMessage traces message conversion operations
 func (p *PluginTracing) IntoChatMessage(ctx context.Context,
 	eventType types.EventType, chatManage *types.ChatManage, next func() *PluginError,
@@ -147,7 +197,13 @@ func (p *PluginTracing) IntoChatMessage(ctx context.Context,
 		attribute.Int("merge_results_count", len(chatManage.MergeResult)),
 	)
 	err := next()
-	span.SetAttributes(attribute.Int("generated_content_length", len(chatManage.UserContent)))
+	dropResultJson, _ := json.Marshal(chatManage.DropResult)
+	span.SetAttributes(
+		attribute.Int("generated_content_length", len(chatManage.UserContent)),
+		attribute.Int("history_count", len(chatManage.History)),
+		attribute.Int("drop_results_count", len(chatManage.DropResult)),
+		attribute.String("drop_results", string(dropResultJson)),
+	)
 	return err
 }
 
@@ -192,15 +248,20 @@ func (p *PluginTracing) ChatCompletionStream(ctx context.Context,
 	chatManage.ResponseChan = newStream
 
 	go func(ctx context.Context) {
+		success := true
 		for resp := range oldStream {
-			if resp.ResponseType == types.ResponseTypeAnswer {
+			switch resp.ResponseType {
+			case types.ResponseTypeAnswer:
 				responseBuilder.WriteString(resp.Content)
+			case types.ResponseTypeError:
+				success = false
+				span.SetAttributes(attribute.String("chat_completion_error", resp.Content))
 			}
 			newStream <- resp
 		}
 		elapsedMS := time.Since(startTime).Milliseconds()
 		span.SetAttributes(
-			attribute.Bool("chat_completion_success", true),
+			attribute.Bool("chat_completion_success", success),
 			attribute.Int64("response_time_ms", elapsedMS),
 			attribute.String("chat_response", responseBuilder.String()),
 			attribute.Int("final_response_length", responseBuilder.Len()),
@@ -245,6 +306,8 @@ func (p *PluginTracing) RewriteQuery(ctx context.Context,
 	err := next()
 	span.SetAttributes(
 		attribute.String("rewrite_query", chatManage.RewriteQuery),
+		attribute.Int("history_count", len(chatManage.History)),
+		attribute.Bool("history_summary", chatManage.HistorySummary != ""),
 	)
 	return err
 }
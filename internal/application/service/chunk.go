@@ -18,12 +18,14 @@ type chunkService struct {
 	chunkRepository interfaces.ChunkRepository // Repository for chunk data persistence
 	kbRepository    interfaces.KnowledgeBaseRepository
 	modelService    interfaces.ModelService
+	graphEngine     interfaces.RetrieveGraphRepository // Retrieval graph whose nodes reference the chunks
 }
 
 // NewChunkService creates a new chunk service
 // It initializes a service with the provided chunk repository
 // Parameters:
 //   - chunkRepository: Repository for chunk operations
+//   - graphEngine: Retrieval graph cleaned up when chunks are deleted
 //
 // Returns:
 //   - interfaces.ChunkService: Initialized chunk service implementation
@@ -31,11 +33,13 @@ func NewChunkService(
 	chunkRepository interfaces.ChunkRepository,
 	kbRepository interfaces.KnowledgeBaseRepository,
 	modelService interfaces.ModelService,
+	graphEngine interfaces.RetrieveGraphRepository,
 ) interfaces.ChunkService {
 	return &chunkService{
 		chunkRepository: chunkRepository,
 		kbRepository:    kbRepository,
 		modelService:    modelService,
+		graphEngine:     graphEngine,
 	}
 }
 
@@ -186,6 +190,7 @@ func (s *chunkService) UpdateChunk(ctx context.Context, chunk *types.Chunk) erro
 
 // DeleteChunk deletes a chunk by ID
 // This method removes a specific chunk from the repository
+// and from the retrieval graph nodes referencing it
 // Parameters:
 //   - ctx: Context with authentication and request information
 //   - id: ID of the chunk to delete
@@ -199,7 +204,16 @@ func (s *chunkService) DeleteChunk(ctx context.Context, id string) error {
 	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
 	logger.Infof(ctx, "Tenant ID: %d", tenantID)
 
-	err := s.chunkRepository.DeleteChunk(ctx, tenantID, id)
+	chunk, err := s.chunkRepository.GetChunkByID(ctx, tenantID, id)
+	if err != nil {
+		logger.ErrorWithFields(ctx, err, map[string]interface{}{
+			"chunk_id":  id,
+			"tenant_id": tenantID,
+		})
+		return err
+	}
+
+	err = s.chunkRepository.DeleteChunk(ctx, tenantID, id)
 	if err != nil {
 		logger.ErrorWithFields(ctx, err, map[string]interface{}{
 			"chunk_id":  id,
@@ -208,12 +222,21 @@ func (s *chunkService) DeleteChunk(ctx context.Context, id string) error {
 		return err
 	}
 
+	namespace := types.NameSpace{KnowledgeBase: chunk.KnowledgeBaseID, Knowledge: chunk.KnowledgeID}
+	if err := s.graphEngine.DelChunks(ctx, namespace, []string{id}); err != nil {
+		logger.ErrorWithFields(ctx, err, map[string]interface{}{
+			"chunk_id": id,
+		})
+		return err
+	}
+
 	logger.Info(ctx, "Chunk deleted successfully")
 	return nil
 }
 
 // DeleteChunksByKnowledgeID deletes all chunks for a knowledge ID
 // This method removes all chunks belonging to a specific knowledge document
+// together with the retrieval graph extracted from them
 // Parameters:
 //   - ctx: Context with authentication and request information
 //   - knowledgeID: ID of the knowledge document
@@ -236,6 +259,14 @@ func (s *chunkService) DeleteChunksByKnowledgeID(ctx context.Context, knowledgeI
 		return err
 	}
 
+	// The graph of the knowledge is extracted from its chunks only
+	if err := s.graphEngine.DelGraph(ctx, []types.NameSpace{{Knowledge: knowledgeID}}); err != nil {
+		logger.ErrorWithFields(ctx, err, map[string]interface{}{
+			"knowledge_id": knowledgeID,
+		})
+		return err
+	}
+
 	logger.Info(ctx, "All chunks under knowledge deleted successfully")
 	return nil
 }
@@ -256,6 +287,17 @@ func (s *chunkService) DeleteByKnowledgeList(ctx context.Context, ids []string)
 		return err
 	}
 
+	namespaces := make([]types.NameSpace, 0, len(ids))
+	for _, id := range ids {
+		namespaces = append(namespaces, types.NameSpace{Knowledge: id})
+	}
+	if err := s.graphEngine.DelGraph(ctx, namespaces); err != nil {
+		logger.ErrorWithFields(ctx, err, map[string]interface{}{
+			"knowledge_id": ids,
+		})
+		return err
+	}
+
 	logger.Info(ctx, "All chunks under knowledge deleted successfully")
 	return nil
 }
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/models/embedding"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/services/docreader/src/proto"
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultChunkSize is the chunk size the document reader applies when none is configured
+	defaultChunkSize = 512
+	// defaultParentChunkFactor sizes the parent chunks of the parent_child strategy when none is configured
+	defaultParentChunkFactor = 4
+	// defaultBreakpointPercentile is the distance percentile above which the semantic strategy starts a new chunk
+	defaultBreakpointPercentile = 90
+	// semanticUnitsPerChunk is the number of sentences a chunk of the semantic strategy is assembled from on average
+	semanticUnitsPerChunk = 4
+	// minSemanticUnitSize bounds the size of the sentences the document reader splits the text into
+	minSemanticUnitSize = 50
+	// semanticEmbedBatchSize is the number of sentences embedded at once
+	semanticEmbedBatchSize = 32
+)
+
+// chunkSize returns the configured chunk size or the default of the document reader
+func chunkSize(config types.ChunkingConfig) int {
+	if config.ChunkSize > 0 {
+		return config.ChunkSize
+	}
+	return defaultChunkSize
+}
+
+// parentChunkSize returns the size of the parent chunks of the parent_child strategy
+func parentChunkSize(config types.ChunkingConfig) int {
+	if config.ParentChunkSize > 0 {
+		return config.ParentChunkSize
+	}
+	return chunkSize(config) * defaultParentChunkFactor
+}
+
+// semanticUnitSize returns the size of the sentences the semantic strategy assembles its chunks from
+func semanticUnitSize(config types.ChunkingConfig) int {
+	return max(chunkSize(config)/semanticUnitsPerChunk, minSemanticUnitSize)
+}
+
+// readerChunking returns the strategy and chunk size the document reader splits the text with.
+// The reader only knows the recursive and heading strategies, the semantic strategy reads sentences
+// that are assembled afterwards and the parent_child strategy reads the parent chunks that are split afterwards
+func readerChunking(config types.ChunkingConfig) (types.ChunkingStrategy, int) {
+	switch config.Strategy {
+	case types.ChunkingStrategyHeading:
+		return types.ChunkingStrategyHeading, config.ChunkSize
+	case types.ChunkingStrategySemantic:
+		return types.ChunkingStrategyRecursive, semanticUnitSize(config)
+	case types.ChunkingStrategyParentChild:
+		return types.ChunkingStrategyRecursive, parentChunkSize(config)
+	default:
+		return types.ChunkingStrategyRecursive, config.ChunkSize
+	}
+}
+
+// semanticChunks assembles chunks from the sentences split by the document reader.
+// A chunk ends where the embedding distance to the next sentence is above the breakpoint percentile
+// of all the distances of the document, or where the next sentence would exceed the chunk size
+func semanticChunks(ctx context.Context,
+	embedder embedding.Embedder, config types.ChunkingConfig, units []*proto.Chunk,
+) ([]*proto.Chunk, error) {
+	if len(units) < 2 {
+		return units, nil
+	}
+	vectors := make([][]float32, 0, len(units))
+	for start := 0; start < len(units); start += semanticEmbedBatchSize {
+		batch := units[start:min(start+semanticEmbedBatchSize, len(units))]
+		texts := make([]string, len(batch))
+		for i, unit := range batch {
+			texts[i] = unit.Content
+		}
+		embeddings, err := embedder.BatchEmbed(ctx, texts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed sentences: %w", err)
+		}
+		if len(embeddings) != len(batch) {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", len(batch), len(embeddings))
+		}
+		vectors = append(vectors, embeddings...)
+	}
+
+	distances := make([]float64, len(units)-1)
+	for i := range distances {
+		distances[i] = 1 - cosineSimilarity(vectors[i], vectors[i+1])
+	}
+	percentile := config.BreakpointPercentile
+	if percentile == 0 {
+		percentile = defaultBreakpointPercentile
+	}
+	threshold := percentileOf(distances, percentile)
+
+	size := chunkSize(config)
+	chunks := []*proto.Chunk{}
+	var current *proto.Chunk
+	for i, unit := range units {
+		if current != nil && (distances[i-1] > threshold || runeLen(current.Content)+runeLen(unit.Content) > size) {
+			chunks = append(chunks, current)
+			current = nil
+		}
+		if current == nil {
+			current = &proto.Chunk{Seq: int32(len(chunks)), Start: unit.Start, End: unit.End, Content: unit.Content}
+			current.Images = unit.Images
+			continue
+		}
+		appendUnit(current, unit)
+	}
+	return append(chunks, current), nil
+}
+
+// appendUnit appends the part of a unit following the end of the chunk, the units split by the
+// document reader may overlap. Images are moved to the position of the unit in the chunk
+func appendUnit(chunk *proto.Chunk, unit *proto.Chunk) {
+	content := []rune(unit.Content)
+	skip := min(max(int(chunk.End-unit.Start), 0), len(content))
+	offset := runeLen(chunk.Content) - skip
+	for _, image := range unit.Images {
+		if int(image.Start) < skip {
+			continue
+		}
+		image.Start += int32(offset)
+		image.End += int32(offset)
+		chunk.Images = append(chunk.Images, image)
+	}
+	chunk.Content += string(content[skip:])
+	chunk.End = max(chunk.End, unit.End)
+}
+
+// splitParentChunks turns the text chunks into parent chunks and splits every parent into child chunks
+// of the chunk size. Only the child chunks are embedded and retrieved, a retrieved child chunk is answered
+// with its parent. The child chunks are numbered after all other chunks and linked to their neighbours
+func splitParentChunks(knowledge *types.Knowledge,
+	config types.ChunkingConfig, chunks []*types.Chunk,
+) []*types.Chunk {
+	index := 0
+	for _, chunk := range chunks {
+		index = max(index, chunk.ChunkIndex+1)
+	}
+
+	var children []*types.Chunk
+	for _, parent := range chunks {
+		if parent.ChunkType != types.ChunkTypeText {
+			continue
+		}
+		parent.ChunkType = types.ChunkTypeParentText
+		var images []types.ImageInfo
+		if parent.ImageInfo != "" {
+			_ = json.Unmarshal([]byte(parent.ImageInfo), &images)
+		}
+		for _, span := range splitText(parent.Content, chunkSize(config), config.ChunkOverlap, config.Separators) {
+			if strings.TrimSpace(span.Content) == "" {
+				continue
+			}
+			child := &types.Chunk{
+				ID:              uuid.New().String(),
+				TenantID:        knowledge.TenantID,
+				KnowledgeID:     knowledge.ID,
+				KnowledgeBaseID: knowledge.KnowledgeBaseID,
+				Content:         span.Content,
+				ChunkIndex:      index,
+				IsEnabled:       true,
+				CreatedAt:       time.Now(),
+				UpdatedAt:       time.Now(),
+				StartAt:         parent.StartAt + span.Start,
+				EndAt:           parent.StartAt + span.End,
+				ChunkType:       types.ChunkTypeText,
+				ParentChunkID:   parent.ID,
+			}
+			index++
+			var childImages []types.ImageInfo
+			for _, image := range images {
+				if image.StartPos >= span.Start && image.EndPos <= span.End {
+					image.StartPos -= span.Start
+					image.EndPos -= span.Start
+					childImages = append(childImages, image)
+				}
+			}
+			if len(childImages) > 0 {
+				if imageInfo, err := json.Marshal(childImages); err == nil {
+					child.ImageInfo = string(imageInfo)
+				}
+			}
+			children = append(children, child)
+		}
+	}
+	for i, child := range children {
+		if i > 0 {
+			child.PreChunkID = children[i-1].ID
+		}
+		if i < len(children)-1 {
+			child.NextChunkID = children[i+1].ID
+		}
+	}
+	return append(chunks, children...)
+}
+
+// textSpan is a part of a text, Start and End are rune offsets
+type textSpan struct {
+	Content string
+	Start   int
+	End     int
+}
+
+// splitText splits a text at the separators into spans of at most size runes, neighbouring spans share
+// up to overlap runes of whole units. Units longer than size are cut
+func splitText(text string, size int, overlap int, separators []string) []textSpan {
+	if len(separators) == 0 {
+		separators = []string{"\n\n", "\n", "。"}
+	}
+	units := splitUnits(text, separators, size)
+
+	var spans []textSpan
+	var current []string
+	currentSize, start := 0, 0
+	for _, unit := range units {
+		unitSize := runeLen(unit)
+		if currentSize+unitSize > size && len(current) > 0 {
+			spans = append(spans, newTextSpan(current, separators, start))
+
+			// Keep the trailing units within the overlap, without leading separators
+			kept, keptSize := 0, 0
+			for i := len(current) - 1; i >= 0 && keptSize+runeLen(current[i]) <= overlap; i-- {
+				kept++
+				keptSize += runeLen(current[i])
+			}
+			current = current[len(current)-kept:]
+			for len(current) > 0 && slices.Contains(separators, current[0]) {
+				keptSize -= runeLen(current[0])
+				current = current[1:]
+			}
+			start += currentSize - keptSize
+			currentSize = keptSize
+		}
+		current = append(current, unit)
+		currentSize += unitSize
+	}
+	if len(current) > 0 {
+		spans = append(spans, newTextSpan(current, separators, start))
+	}
+	return spans
+}
+
+// newTextSpan joins the units of a span starting at start, without trailing separators
+func newTextSpan(units []string, separators []string, start int) textSpan {
+	for len(units) > 0 && slices.Contains(separators, units[len(units)-1]) {
+		units = units[:len(units)-1]
+	}
+	content := strings.Join(units, "")
+	return textSpan{Content: content, Start: start, End: start + runeLen(content)}
+}
+
+// splitUnits splits a text into units at the separators, the separators are kept as units of their own.
+// The separators are tried in order and units longer than size are cut
+func splitUnits(text string, separators []string, size int) []string {
+	if text == "" {
+		return nil
+	}
+	if runeLen(text) <= size {
+		return []string{text}
+	}
+	for i, separator := range separators {
+		if separator == "" || !strings.Contains(text, separator) {
+			continue
+		}
+		var units []string
+		parts := strings.Split(text, separator)
+		for j, part := range parts {
+			units = append(units, splitUnits(part, separators[i+1:], size)...)
+			if j < len(parts)-1 {
+				units = append(units, separator)
+			}
+		}
+		return units
+	}
+	var units []string
+	runes := []rune(text)
+	for start := 0; start < len(runes); start += size {
+		units = append(units, string(runes[start:min(start+size, len(runes))]))
+	}
+	return units
+}
+
+// cosineSimilarity returns the cosine similarity of two vectors, 0 when either of them is zero
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// percentileOf returns the value below which the given percentage of the values fall
+func percentileOf(values []float64, percentile int) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	index := int(math.Ceil(float64(percentile)/100*float64(len(sorted)))) - 1
+	return sorted[min(max(index, 0), len(sorted)-1)]
+}
+
+// runeLen returns the number of runes of a string, the offsets of the document reader count characters
+func runeLen(s string) int {
+	return len([]rune(s))
+}
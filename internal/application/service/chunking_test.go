@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/models/embedding"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/services/docreader/src/proto"
+)
+
+// topicEmbedder embeds a text by the topic words it contains
+type topicEmbedder struct {
+	embedding.Embedder
+}
+
+func (topicEmbedder) BatchEmbed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float32{0, 0}
+		if strings.Contains(text, "cat") {
+			vectors[i][0] = 1
+		}
+		if strings.Contains(text, "rocket") {
+			vectors[i][1] = 1
+		}
+	}
+	return vectors, nil
+}
+
+func TestSemanticChunks(t *testing.T) {
+	sentences := []string{"The cat sleeps. ", "A cat purrs. ", "The cat eats. ", "The rocket lifts off. ", "The rocket lands."}
+	var units []*proto.Chunk
+	start := 0
+	for i, sentence := range sentences {
+		// Neighbouring units overlap by one rune as the document reader always overlaps
+		overlap := 0
+		if i > 0 {
+			overlap = 1
+		}
+		content := sentence
+		if overlap > 0 {
+			content = sentences[i-1][len(sentences[i-1])-1:] + sentence
+		}
+		units = append(units, &proto.Chunk{
+			Seq: int32(i), Content: content, Start: int32(start - overlap), End: int32(start + len(sentence)),
+		})
+		start += len(sentence)
+	}
+
+	chunks, err := semanticChunks(context.Background(), topicEmbedder{},
+		types.ChunkingConfig{ChunkSize: 1000, BreakpointPercentile: 50}, units)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 chunks, got %d", len(chunks))
+	}
+	if want := strings.Join(sentences[:3], ""); chunks[0].Content != want {
+		t.Errorf("Expected first chunk %q, got %q", want, chunks[0].Content)
+	}
+	if want := " " + strings.Join(sentences[3:], ""); chunks[1].Content != want {
+		t.Errorf("Expected second chunk %q, got %q", want, chunks[1].Content)
+	}
+	if chunks[1].Seq != 1 || chunks[0].End != units[2].End {
+		t.Errorf("Expected renumbered chunks spanning their units, got seq %d, end %d", chunks[1].Seq, chunks[0].End)
+	}
+}
+
+func TestSplitParentChunks(t *testing.T) {
+	knowledge := &types.Knowledge{ID: "k", KnowledgeBaseID: "kb", TenantID: 1}
+	parent := &types.Chunk{
+		ID: "p", ChunkType: types.ChunkTypeText, StartAt: 100,
+		Content:   "first paragraph\n\nsecond paragraph\n\nthird paragraph",
+		ImageInfo: `[{"url":"img","start_pos":17,"end_pos":23}]`,
+	}
+	chunks := splitParentChunks(knowledge,
+		types.ChunkingConfig{ChunkSize: 20, Separators: []string{"\n\n"}}, []*types.Chunk{parent})
+
+	if parent.ChunkType != types.ChunkTypeParentText {
+		t.Errorf("Expected the text chunk to become a parent, got %s", parent.ChunkType)
+	}
+	children := chunks[1:]
+	if len(children) != 3 {
+		t.Fatalf("Expected 3 child chunks, got %d", len(children))
+	}
+	for i, child := range children {
+		if child.ParentChunkID != "p" || child.ChunkIndex != i+1 {
+			t.Errorf("Expected child %d of p, got index %d of %s", i, child.ChunkIndex, child.ParentChunkID)
+		}
+		if got := parent.Content[child.StartAt-100 : child.EndAt-100]; got != child.Content {
+			t.Errorf("Expected child span %q to match its content %q", got, child.Content)
+		}
+	}
+	if children[1].Content != "second paragraph" || children[1].ImageInfo != `[{"url":"img","original_url":"","start_pos":0,"end_pos":6,"caption":"","ocr_text":""}]` {
+		t.Errorf("Expected the image moved to the second child, got %q with %s", children[1].Content, children[1].ImageInfo)
+	}
+	if children[0].NextChunkID != children[1].ID || children[2].PreChunkID != children[1].ID {
+		t.Error("Expected child chunks linked to their neighbours")
+	}
+}
@@ -1,22 +1,53 @@
 package service
 
 import (
+	"bufio"
 	"context"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
-
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	werrors "github.com/Tencent/WeKnora/internal/errors"
 	"github.com/Tencent/WeKnora/internal/logger"
 	"github.com/Tencent/WeKnora/internal/types"
 	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/google/uuid"
 	"github.com/parquet-go/parquet-go"
 )
 
+const (
+	// defaultDatasetDir is the directory of the built-in sample dataset
+	defaultDatasetDir = "./dataset/samples"
+	// maxDatasetFileSize is the maximum size of an uploaded dataset file
+	maxDatasetFileSize = 100 << 20
+)
+
+// Form fields of the files of an uploaded dataset
+const (
+	DatasetFileQueries = "queries" // parquet: qid -> question text
+	DatasetFileCorpus  = "corpus"  // parquet: pid -> passage text
+	DatasetFileQrels   = "qrels"   // parquet: qid -> pid
+	DatasetFileAnswers = "answers" // parquet: aid -> answer text
+	DatasetFileQas     = "qas"     // parquet: qid -> aid, optional, answers are keyed by qid without it
+	DatasetFile        = "file"    // jsonl or csv QA pairs
+)
+
 // DatasetService provides operations for working with datasets
-type DatasetService struct{}
+type DatasetService struct {
+	repo interfaces.DatasetRepository
+}
 
 // NewDatasetService creates a new DatasetService instance
-func NewDatasetService() interfaces.DatasetService {
-	return &DatasetService{}
+func NewDatasetService(repo interfaces.DatasetRepository) interfaces.DatasetService {
+	return &DatasetService{repo: repo}
 }
 
 // TextInfo represents text data with ID in parquet format
@@ -42,45 +73,238 @@ func (d *DatasetService) GetDatasetByID(ctx context.Context, datasetID string) (
 	logger.Info(ctx, "Start getting dataset by ID")
 	logger.Infof(ctx, "Getting dataset with ID: %s", datasetID)
 
-	dataset := DefaultDataset()
-	dataset.PrintStats(ctx)
-	qaPairs := dataset.Iterate()
+	if datasetID == types.DefaultDatasetID {
+		dataset, err := DefaultDataset()
+		if err != nil {
+			logger.Errorf(ctx, "Failed to load default dataset: %v", err)
+			return nil, err
+		}
+		dataset.PrintStats(ctx)
+		qaPairs := dataset.Iterate()
+
+		logger.Infof(ctx, "Retrieved %d QA pairs from dataset", len(qaPairs))
+		return qaPairs, nil
+	}
+
+	if _, err := d.GetDataset(ctx, datasetID); err != nil {
+		return nil, err
+	}
+	pairs, err := d.repo.ListQAPairs(ctx, datasetID)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to list QA pairs of dataset %s: %v", datasetID, err)
+		return nil, err
+	}
+	qaPairs := make([]*types.QAPair, 0, len(pairs))
+	for _, pair := range pairs {
+		qaPairs = append(qaPairs, pair.QAPair())
+	}
 
 	logger.Infof(ctx, "Retrieved %d QA pairs from dataset", len(qaPairs))
 	return qaPairs, nil
 }
 
+// GetDataset gets the information of a dataset of the tenant or of the built-in default dataset
+func (d *DatasetService) GetDataset(ctx context.Context, datasetID string) (*types.Dataset, error) {
+	if datasetID == types.DefaultDatasetID {
+		return &types.Dataset{
+			ID:          types.DefaultDatasetID,
+			Name:        types.DefaultDatasetID,
+			Description: "Built-in sample dataset",
+			Format:      types.DatasetFormatParquet,
+		}, nil
+	}
+
+	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
+	dataset, err := d.repo.GetDatasetByID(ctx, tenantID, datasetID)
+	if err != nil {
+		if errors.Is(err, types.ErrDatasetNotFound) {
+			return nil, werrors.NewNotFoundError("Dataset not found")
+		}
+		logger.Errorf(ctx, "Failed to get dataset %s: %v", datasetID, err)
+		return nil, err
+	}
+	return dataset, nil
+}
+
+// CreateDataset parses the uploaded files into QA pairs and saves them as a new dataset of the tenant
+// The format is inferred from the uploaded files when it is not given
+func (d *DatasetService) CreateDataset(ctx context.Context,
+	dataset *types.Dataset, files map[string]*multipart.FileHeader,
+) (*types.Dataset, error) {
+	logger.Infof(ctx, "Start creating dataset, name: %s, format: %s", dataset.Name, dataset.Format)
+
+	for name, file := range files {
+		if file.Size > maxDatasetFileSize {
+			return nil, werrors.NewBadRequestError(
+				fmt.Sprintf("Dataset file %s exceeds the %d MB limit", name, maxDatasetFileSize>>20))
+		}
+	}
+	if dataset.Format == "" {
+		dataset.Format = inferDatasetFormat(files)
+	}
+
+	parsed, err := parseDataset(dataset.Format, files)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to parse dataset: %v", err)
+		return nil, werrors.NewBadRequestError("Invalid dataset").WithDetails(err.Error())
+	}
+
+	qaPairs := parsed.Iterate()
+	if len(qaPairs) == 0 {
+		return nil, werrors.NewBadRequestError("Dataset contains no QA pairs")
+	}
+	pairs := make([]*types.DatasetQAPair, 0, len(qaPairs))
+	passages := make(map[int]struct{})
+	for _, qaPair := range qaPairs {
+		for _, pid := range qaPair.PIDs {
+			passages[pid] = struct{}{}
+		}
+		pairs = append(pairs, &types.DatasetQAPair{
+			QID:      qaPair.QID,
+			Question: qaPair.Question,
+			PIDs:     qaPair.PIDs,
+			Passages: qaPair.Passages,
+			AID:      qaPair.AID,
+			Answer:   qaPair.Answer,
+		})
+	}
+
+	dataset.ID = uuid.New().String()
+	dataset.TenantID = ctx.Value(types.TenantIDContextKey).(uint)
+	dataset.QuestionCount = len(pairs)
+	dataset.PassageCount = len(passages)
+	dataset.CreatedAt = time.Now()
+	dataset.UpdatedAt = dataset.CreatedAt
+	if err := d.repo.CreateDataset(ctx, dataset, pairs); err != nil {
+		logger.Errorf(ctx, "Failed to save dataset: %v", err)
+		return nil, err
+	}
+
+	logger.Infof(ctx, "Dataset created successfully, ID: %s, QA pairs: %d", dataset.ID, dataset.QuestionCount)
+	return dataset, nil
+}
+
+// ListDatasets lists the datasets of the tenant
+func (d *DatasetService) ListDatasets(ctx context.Context) ([]*types.Dataset, error) {
+	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
+	datasets, err := d.repo.ListDatasets(ctx, tenantID)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to list datasets: %v", err)
+		return nil, err
+	}
+	return datasets, nil
+}
+
+// DeleteDataset deletes a dataset of the tenant, the built-in default dataset cannot be deleted
+func (d *DatasetService) DeleteDataset(ctx context.Context, datasetID string) error {
+	if datasetID == types.DefaultDatasetID {
+		return werrors.NewBadRequestError("The default dataset cannot be deleted")
+	}
+	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
+	if err := d.repo.DeleteDataset(ctx, tenantID, datasetID); err != nil {
+		if errors.Is(err, types.ErrDatasetNotFound) {
+			return werrors.NewNotFoundError("Dataset not found")
+		}
+		logger.Errorf(ctx, "Failed to delete dataset %s: %v", datasetID, err)
+		return err
+	}
+	logger.Infof(ctx, "Dataset deleted successfully, ID: %s", datasetID)
+	return nil
+}
+
+// inferDatasetFormat infers the format of a dataset from its uploaded files
+func inferDatasetFormat(files map[string]*multipart.FileHeader) types.DatasetFormat {
+	if file, ok := files[DatasetFile]; ok {
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Filename)), ".")
+		if ext == "json" {
+			return types.DatasetFormatJSONL
+		}
+		return types.DatasetFormat(ext)
+	}
+	return types.DatasetFormatParquet
+}
+
+// parseDataset loads a dataset in the given format from its uploaded files
+func parseDataset(format types.DatasetFormat, files map[string]*multipart.FileHeader) (dataset, error) {
+	switch format {
+	case types.DatasetFormatParquet:
+		return parquetDatasetFromFiles(files)
+	case types.DatasetFormatJSONL, types.DatasetFormatCSV:
+		file, ok := files[DatasetFile]
+		if !ok {
+			return dataset{}, fmt.Errorf("missing dataset file %q", DatasetFile)
+		}
+		return qaPairDatasetFromFile(file, format)
+	default:
+		return dataset{}, fmt.Errorf("unsupported dataset format %q", format)
+	}
+}
+
 // DefaultDataset loads and initializes the default dataset from parquet files
-func DefaultDataset() dataset {
-	datasetDir := "./dataset/samples"
-	queries, err := loadParquet[TextInfo](fmt.Sprintf("%s/queries.parquet", datasetDir))
+func DefaultDataset() (dataset, error) {
+	queries, err := loadParquet[TextInfo](fmt.Sprintf("%s/queries.parquet", defaultDatasetDir))
 	if err != nil {
-		panic(err)
+		return dataset{}, err
 	}
-	corpus, err := loadParquet[TextInfo](fmt.Sprintf("%s/corpus.parquet", datasetDir))
+	corpus, err := loadParquet[TextInfo](fmt.Sprintf("%s/corpus.parquet", defaultDatasetDir))
 	if err != nil {
-		panic(err)
+		return dataset{}, err
 	}
-	answers, err := loadParquet[TextInfo](fmt.Sprintf("%s/answers.parquet", datasetDir))
+	answers, err := loadParquet[TextInfo](fmt.Sprintf("%s/answers.parquet", defaultDatasetDir))
 	if err != nil {
-		panic(err)
+		return dataset{}, err
 	}
-	qrels, err := loadParquet[RelsInfo](fmt.Sprintf("%s/qrels.parquet", datasetDir))
+	qrels, err := loadParquet[RelsInfo](fmt.Sprintf("%s/qrels.parquet", defaultDatasetDir))
 	if err != nil {
-		panic(err)
+		return dataset{}, err
 	}
-	qas, err := loadParquet[QaInfo](fmt.Sprintf("%s/qas.parquet", datasetDir))
+	qas, err := loadParquet[QaInfo](fmt.Sprintf("%s/qas.parquet", defaultDatasetDir))
 	if err != nil {
-		panic(err)
+		return dataset{}, err
 	}
+	return newParquetDataset(queries, corpus, answers, qrels, qas), nil
+}
 
-	res := dataset{
-		queries: make(map[int64]string),  // qid -> question text
-		corpus:  make(map[int64]string),  // pid -> passage text
-		answers: make(map[int64]string),  // aid -> answer text
-		qrels:   make(map[int64][]int64), // qid -> list of pid
-		qas:     make(map[int64]int64),   // qid -> aid
+// parquetDatasetFromFiles loads a dataset from uploaded parquet files
+func parquetDatasetFromFiles(files map[string]*multipart.FileHeader) (dataset, error) {
+	for _, name := range []string{DatasetFileQueries, DatasetFileCorpus, DatasetFileQrels, DatasetFileAnswers} {
+		if _, ok := files[name]; !ok {
+			return dataset{}, fmt.Errorf("missing parquet file %q", name)
+		}
+	}
+	queries, err := readParquet[TextInfo](files[DatasetFileQueries])
+	if err != nil {
+		return dataset{}, fmt.Errorf("read %s: %w", DatasetFileQueries, err)
+	}
+	corpus, err := readParquet[TextInfo](files[DatasetFileCorpus])
+	if err != nil {
+		return dataset{}, fmt.Errorf("read %s: %w", DatasetFileCorpus, err)
+	}
+	answers, err := readParquet[TextInfo](files[DatasetFileAnswers])
+	if err != nil {
+		return dataset{}, fmt.Errorf("read %s: %w", DatasetFileAnswers, err)
+	}
+	qrels, err := readParquet[RelsInfo](files[DatasetFileQrels])
+	if err != nil {
+		return dataset{}, fmt.Errorf("read %s: %w", DatasetFileQrels, err)
 	}
+	var qas []QaInfo
+	if file, ok := files[DatasetFileQas]; ok {
+		if qas, err = readParquet[QaInfo](file); err != nil {
+			return dataset{}, fmt.Errorf("read %s: %w", DatasetFileQas, err)
+		}
+	} else {
+		// Without qas the answers are keyed by question ID
+		for _, ai := range answers {
+			qas = append(qas, QaInfo{QID: ai.ID, AID: ai.ID})
+		}
+	}
+	return newParquetDataset(queries, corpus, answers, qrels, qas), nil
+}
+
+// newParquetDataset builds a dataset from the rows of its parquet files
+func newParquetDataset(queries, corpus, answers []TextInfo, qrels []RelsInfo, qas []QaInfo) dataset {
+	res := newDataset()
 	for _, qi := range queries {
 		res.queries[qi.ID] = qi.Text
 	}
@@ -99,6 +323,151 @@ func DefaultDataset() dataset {
 	return res
 }
 
+// qaPairRow is a QA pair of a JSONL or CSV dataset
+type qaPairRow struct {
+	QID      *int64   `json:"qid"`      // Question ID, the position of the row when missing
+	Question string   `json:"question"` // Question text
+	Answer   string   `json:"answer"`   // Reference answer
+	Passages []string `json:"passages"` // Passages relevant to the question
+}
+
+// qaPairDatasetFromFile loads a dataset from an uploaded JSONL or CSV file of QA pairs
+// Passages with the same text share a passage ID, answers are keyed by question ID
+func qaPairDatasetFromFile(file *multipart.FileHeader, format types.DatasetFormat) (dataset, error) {
+	f, err := file.Open()
+	if err != nil {
+		return dataset{}, err
+	}
+	defer f.Close()
+
+	var rows []*qaPairRow
+	if format == types.DatasetFormatCSV {
+		rows, err = readCSVQAPairs(f)
+	} else {
+		rows, err = readJSONLQAPairs(f)
+	}
+	if err != nil {
+		return dataset{}, err
+	}
+
+	res := newDataset()
+	pids := make(map[string]int64)
+	for i, row := range rows {
+		qid := int64(i)
+		if row.QID != nil {
+			qid = *row.QID
+		}
+		if _, ok := res.queries[qid]; ok {
+			return dataset{}, fmt.Errorf("duplicate question ID %d", qid)
+		}
+		res.queries[qid] = row.Question
+		res.answers[qid] = row.Answer
+		res.qas[qid] = qid
+		for _, passage := range row.Passages {
+			if passage == "" {
+				continue
+			}
+			pid, ok := pids[passage]
+			if !ok {
+				pid = int64(len(pids))
+				pids[passage] = pid
+				res.corpus[pid] = passage
+			}
+			res.qrels[qid] = append(res.qrels[qid], pid)
+		}
+	}
+	return res, nil
+}
+
+// readJSONLQAPairs reads one QA pair per line, blank lines are skipped
+func readJSONLQAPairs(r io.Reader) ([]*qaPairRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxDatasetFileSize)
+	var rows []*qaPairRow
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var row qaPairRow
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if row.Question == "" {
+			return nil, fmt.Errorf("line %d: missing question", line)
+		}
+		rows = append(rows, &row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// readCSVQAPairs reads one QA pair per row, the header must contain a question column
+// and may contain a qid and an answer column, every column whose name starts with passage holds a passage
+func readCSVQAPairs(r io.Reader) ([]*qaPairRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	qidCol, questionCol, answerCol := -1, -1, -1
+	var passageCols []int
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		switch {
+		case name == "qid":
+			qidCol = i
+		case name == "question":
+			questionCol = i
+		case name == "answer":
+			answerCol = i
+		case strings.HasPrefix(name, "passage"):
+			passageCols = append(passageCols, i)
+		}
+	}
+	if questionCol < 0 {
+		return nil, errors.New("missing question column")
+	}
+
+	cell := func(record []string, col int) string {
+		if col < 0 || col >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[col])
+	}
+	var rows []*qaPairRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := &qaPairRow{Question: cell(record, questionCol), Answer: cell(record, answerCol)}
+		if row.Question == "" {
+			return nil, fmt.Errorf("line %d: missing question", line)
+		}
+		if qid := cell(record, qidCol); qid != "" {
+			v, err := strconv.ParseInt(qid, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid qid %q", line, qid)
+			}
+			row.QID = &v
+		}
+		for _, col := range passageCols {
+			row.Passages = append(row.Passages, cell(record, col))
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
 // dataset represents the in-memory dataset structure
 type dataset struct {
 	queries map[int64]string  // qid -> question text
@@ -108,11 +477,32 @@ type dataset struct {
 	qas     map[int64]int64   // qid -> aid
 }
 
-// Iterate generates QA pairs from the dataset
+// newDataset creates an empty dataset
+func newDataset() dataset {
+	return dataset{
+		queries: make(map[int64]string),  // qid -> question text
+		corpus:  make(map[int64]string),  // pid -> passage text
+		answers: make(map[int64]string),  // aid -> answer text
+		qrels:   make(map[int64][]int64), // qid -> list of pid
+		qas:     make(map[int64]int64),   // qid -> aid
+	}
+}
+
+// Iterate generates QA pairs from the dataset ordered by question ID
+// Passage IDs are renumbered densely from 0 in order of first reference,
+// since evaluation uses them as the positions of the passages in the evaluation knowledge
 func (d *dataset) Iterate() []*types.QAPair {
 	var pairs []*types.QAPair
 
-	for qid, question := range d.queries {
+	qids := make([]int64, 0, len(d.queries))
+	for qid := range d.queries {
+		qids = append(qids, qid)
+	}
+	slices.Sort(qids)
+
+	densePIDs := make(map[int64]int)
+	for _, qid := range qids {
+		question := d.queries[qid]
 		// Get answer info
 		aid, hasAnswer := d.qas[qid]
 		answer := ""
@@ -121,14 +511,20 @@ func (d *dataset) Iterate() []*types.QAPair {
 		}
 
 		// Get related passages
-		pids := d.qrels[qid]
 		var pidStr []int
-		for _, pid := range pids {
-			pidStr = append(pidStr, int(pid))
-		}
 		var passages []string
-		for _, pid := range pids {
-			passages = append(passages, d.corpus[pid])
+		for _, pid := range d.qrels[qid] {
+			text, ok := d.corpus[pid]
+			if !ok || text == "" {
+				continue
+			}
+			dense, ok := densePIDs[pid]
+			if !ok {
+				dense = len(densePIDs)
+				densePIDs[pid] = dense
+			}
+			pidStr = append(pidStr, dense)
+			passages = append(passages, text)
 		}
 
 		pairs = append(pairs, &types.QAPair{
@@ -241,3 +637,13 @@ func loadParquet[T any](filePath string) ([]T, error) {
 	}
 	return rows, nil
 }
+
+// readParquet loads data from an uploaded parquet file into specified type
+func readParquet[T any](file *multipart.FileHeader) ([]T, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parquet.Read[T](f, file.Size)
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"bytes"
+	"mime/multipart"
+	"reflect"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/parquet-go/parquet-go"
+)
+
+// newUploadedFiles returns the file headers of a multipart form holding the given files
+func newUploadedFiles(t *testing.T,
+	files map[string]string, contents map[string][]byte,
+) map[string]*multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for field, filename := range files {
+		part, err := writer.CreateFormFile(field, filename)
+		if err != nil {
+			t.Fatalf("create form file: %v", err)
+		}
+		part.Write(contents[field])
+	}
+	writer.Close()
+
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("read form: %v", err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	headers := make(map[string]*multipart.FileHeader, len(form.File))
+	for field, fileHeaders := range form.File {
+		headers[field] = fileHeaders[0]
+	}
+	return headers
+}
+
+func writeParquet[T any](t *testing.T, rows []T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, rows); err != nil {
+		t.Fatalf("write parquet: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParquetDatasetFromFiles(t *testing.T) {
+	contents := map[string][]byte{
+		DatasetFileQueries: writeParquet(t, []TextInfo{{ID: 2, Text: "q2"}, {ID: 1, Text: "q1"}}),
+		DatasetFileCorpus:  writeParquet(t, []TextInfo{{ID: 10, Text: "p10"}, {ID: 20, Text: "p20"}}),
+		DatasetFileAnswers: writeParquet(t, []TextInfo{{ID: 1, Text: "a1"}, {ID: 2, Text: "a2"}}),
+		DatasetFileQrels:   writeParquet(t, []RelsInfo{{QID: 1, PID: 20}, {QID: 2, PID: 20}, {QID: 2, PID: 10}}),
+	}
+	files := map[string]string{
+		DatasetFileQueries: "queries.parquet",
+		DatasetFileCorpus:  "corpus.parquet",
+		DatasetFileAnswers: "answers.parquet",
+		DatasetFileQrels:   "qrels.parquet",
+	}
+	uploaded := newUploadedFiles(t, files, contents)
+	if format := inferDatasetFormat(uploaded); format != types.DatasetFormatParquet {
+		t.Fatalf("Expected parquet format, got %s", format)
+	}
+
+	// Without qas the answers are keyed by question ID
+	d, err := parseDataset(types.DatasetFormatParquet, uploaded)
+	if err != nil {
+		t.Fatalf("parseDataset: %v", err)
+	}
+	pairs := d.Iterate()
+	if len(pairs) != 2 || pairs[0].Question != "q1" || pairs[0].Answer != "a1" || pairs[1].Answer != "a2" {
+		t.Fatalf("Unexpected QA pairs %+v", pairs)
+	}
+	// Passage IDs are dense in order of first reference
+	if !reflect.DeepEqual(pairs[0].PIDs, []int{0}) || !reflect.DeepEqual(pairs[1].PIDs, []int{0, 1}) ||
+		!reflect.DeepEqual(pairs[1].Passages, []string{"p20", "p10"}) {
+		t.Errorf("Unexpected passages %v %v and %v", pairs[0].PIDs, pairs[1].PIDs, pairs[1].Passages)
+	}
+
+	// qas maps the questions to their answers
+	contents[DatasetFileQas] = writeParquet(t, []QaInfo{{QID: 1, AID: 2}, {QID: 2, AID: 1}})
+	files[DatasetFileQas] = "qas.parquet"
+	d, err = parseDataset(types.DatasetFormatParquet, newUploadedFiles(t, files, contents))
+	if err != nil {
+		t.Fatalf("parseDataset: %v", err)
+	}
+	if pairs := d.Iterate(); pairs[0].Answer != "a2" || pairs[0].AID != 2 {
+		t.Errorf("Expected the answer of qas, got %+v", pairs[0])
+	}
+
+	delete(files, DatasetFileCorpus)
+	if _, err := parseDataset(types.DatasetFormatParquet, newUploadedFiles(t, files, contents)); err == nil {
+		t.Error("Expected a missing corpus to be rejected")
+	}
+}
+
+func TestJSONLDataset(t *testing.T) {
+	content := `{"question": "q0", "answer": "a0", "passages": ["shared", "p0"]}
+
+{"qid": 7, "question": "q7", "answer": "a7", "passages": ["shared", ""]}
+`
+	uploaded := newUploadedFiles(t, map[string]string{DatasetFile: "qa.json"},
+		map[string][]byte{DatasetFile: []byte(content)})
+	if format := inferDatasetFormat(uploaded); format != types.DatasetFormatJSONL {
+		t.Fatalf("Expected jsonl format, got %s", format)
+	}
+
+	d, err := parseDataset(types.DatasetFormatJSONL, uploaded)
+	if err != nil {
+		t.Fatalf("parseDataset: %v", err)
+	}
+	pairs := d.Iterate()
+	if len(pairs) != 2 || pairs[0].QID != 0 || pairs[1].QID != 7 || pairs[1].Answer != "a7" {
+		t.Fatalf("Unexpected QA pairs %+v", pairs)
+	}
+	// Passages with the same text share an ID and empty passages are skipped
+	if !reflect.DeepEqual(pairs[0].PIDs, []int{0, 1}) || !reflect.DeepEqual(pairs[1].PIDs, []int{0}) {
+		t.Errorf("Unexpected passage IDs %v and %v", pairs[0].PIDs, pairs[1].PIDs)
+	}
+
+	for name, content := range map[string]string{
+		"invalid json":       "{",
+		"missing question":   `{"answer": "a"}`,
+		"duplicate question": "{\"qid\": 1, \"question\": \"q\"}\n{\"qid\": 1, \"question\": \"q\"}",
+	} {
+		uploaded := newUploadedFiles(t, map[string]string{DatasetFile: "qa.jsonl"},
+			map[string][]byte{DatasetFile: []byte(content)})
+		if _, err := parseDataset(types.DatasetFormatJSONL, uploaded); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
+
+func TestCSVDataset(t *testing.T) {
+	content := "\ufeffQID,Question,Answer,Passage 1,Passage 2\n" +
+		"3, q3 ,a3,p1,p2\n" +
+		"1,q1,a1,p2\n"
+	uploaded := newUploadedFiles(t, map[string]string{DatasetFile: "qa.csv"},
+		map[string][]byte{DatasetFile: []byte(content)})
+	if format := inferDatasetFormat(uploaded); format != types.DatasetFormatCSV {
+		t.Fatalf("Expected csv format, got %s", format)
+	}
+
+	d, err := parseDataset(types.DatasetFormatCSV, uploaded)
+	if err != nil {
+		t.Fatalf("parseDataset: %v", err)
+	}
+	pairs := d.Iterate()
+	if len(pairs) != 2 || pairs[0].QID != 1 || pairs[1].QID != 3 || pairs[1].Question != "q3" {
+		t.Fatalf("Unexpected QA pairs %+v", pairs)
+	}
+	if !reflect.DeepEqual(pairs[0].Passages, []string{"p2"}) ||
+		!reflect.DeepEqual(pairs[1].Passages, []string{"p1", "p2"}) {
+		t.Errorf("Unexpected passages %v and %v", pairs[0].Passages, pairs[1].Passages)
+	}
+
+	for name, content := range map[string]string{
+		"missing question column": "qid,answer\n1,a\n",
+		"missing question":        "qid,question\n1,\n",
+		"invalid qid":             "qid,question\nx,q\n",
+	} {
+		uploaded := newUploadedFiles(t, map[string]string{DatasetFile: "qa.csv"},
+			map[string][]byte{DatasetFile: []byte(content)})
+		if _, err := parseDataset(types.DatasetFormatCSV, uploaded); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
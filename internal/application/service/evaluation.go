@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/Tencent/WeKnora/internal/config"
+	werrors "github.com/Tencent/WeKnora/internal/errors"
 	"github.com/Tencent/WeKnora/internal/logger"
 	"github.com/Tencent/WeKnora/internal/types"
 	"github.com/Tencent/WeKnora/internal/types/interfaces"
@@ -32,8 +33,7 @@ type EvaluationService struct {
 	knowledgeService     interfaces.KnowledgeService     // Service for knowledge operations
 	sessionService       interfaces.SessionService       // Service for chat sessions
 	modelService         interfaces.ModelService         // Service for model operations
-
-	evaluationMemoryStorage *evaluationMemoryStorage // In-memory storage for evaluation tasks
+	repo                 interfaces.EvaluationRepository // Repository for evaluation tasks and their results
 }
 
 func NewEvaluationService(
@@ -43,86 +43,169 @@ func NewEvaluationService(
 	knowledgeService interfaces.KnowledgeService,
 	sessionService interfaces.SessionService,
 	modelService interfaces.ModelService,
+	repo interfaces.EvaluationRepository,
 ) interfaces.EvaluationService {
-	evaluationMemoryStorage := newEvaluationMemoryStorage()
 	return &EvaluationService{
-		config:                  config,
-		dataset:                 dataset,
-		knowledgeBaseService:    knowledgeBaseService,
-		knowledgeService:        knowledgeService,
-		sessionService:          sessionService,
-		modelService:            modelService,
-		evaluationMemoryStorage: evaluationMemoryStorage,
+		config:               config,
+		dataset:              dataset,
+		knowledgeBaseService: knowledgeBaseService,
+		knowledgeService:     knowledgeService,
+		sessionService:       sessionService,
+		modelService:         modelService,
+		repo:                 repo,
 	}
 }
 
-// evaluationMemoryStorage stores evaluation tasks in memory with thread-safe access
-type evaluationMemoryStorage struct {
-	store map[string]*types.EvaluationDetail // Map of taskID to evaluation details
-	mu    *sync.RWMutex                      // Read-write lock for concurrent access
-}
-
-func newEvaluationMemoryStorage() *evaluationMemoryStorage {
-	res := &evaluationMemoryStorage{
-		store: make(map[string]*types.EvaluationDetail),
-		mu:    &sync.RWMutex{},
+// FailInterruptedEvaluations fails the evaluation tasks left pending or running by a previous process,
+// evaluations run in the background of the process that started them and can not be resumed after a restart
+func FailInterruptedEvaluations(repo interfaces.EvaluationRepository) error {
+	ctx := context.Background()
+	count, err := repo.FailInterruptedTasks(ctx, "evaluation interrupted by a server restart")
+	if err != nil {
+		logger.Errorf(ctx, "Failed to fail interrupted evaluation tasks: %v", err)
+		return err
 	}
-	return res
-}
-
-func (e *evaluationMemoryStorage) register(params *types.EvaluationDetail) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	logger.Infof(context.Background(), "Registering evaluation task: %s", params.Task.ID)
-	e.store[params.Task.ID] = params
+	if count > 0 {
+		logger.Warnf(ctx, "Marked %d interrupted evaluation tasks as failed", count)
+	}
+	return nil
 }
 
-func (e *evaluationMemoryStorage) get(taskID string) (*types.EvaluationDetail, error) {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
-	logger.Infof(context.Background(), "Getting evaluation task: %s", taskID)
-	res, ok := e.store[taskID]
-	if !ok {
-		return nil, errors.New("task not found")
+// getTask gets an evaluation task of the current tenant
+func (e *EvaluationService) getTask(ctx context.Context, taskID string) (*types.EvaluationTask, error) {
+	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
+	task, err := e.repo.GetTaskByID(ctx, tenantID, taskID)
+	if err != nil {
+		if errors.Is(err, types.ErrEvaluationTaskNotFound) {
+			return nil, werrors.NewNotFoundError("Evaluation task not found")
+		}
+		logger.Errorf(ctx, "Failed to get evaluation task: %v", err)
+		return nil, err
 	}
-	return res, nil
+	return task, nil
 }
 
-func (e *evaluationMemoryStorage) update(taskID string, fn func(params *types.EvaluationDetail)) error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	params, ok := e.store[taskID]
-	if !ok {
-		return errors.New("task not found")
+// saveTask saves the state of an evaluation task, failures are only logged
+// so that a database hiccup does not abort a running evaluation
+func (e *EvaluationService) saveTask(ctx context.Context, task *types.EvaluationTask) {
+	if err := e.repo.UpdateTask(ctx, task); err != nil {
+		logger.Errorf(ctx, "Failed to save evaluation task: %v, task ID: %s", err, task.ID)
 	}
-	fn(params)
-	return nil
 }
 
 func (e *EvaluationService) EvaluationResult(ctx context.Context, taskID string) (*types.EvaluationDetail, error) {
 	logger.Info(ctx, "Start getting evaluation result")
 	logger.Infof(ctx, "Task ID: %s", taskID)
 
-	detail, err := e.evaluationMemoryStorage.get(taskID)
+	task, err := e.getTask(ctx, taskID)
 	if err != nil {
-		logger.Errorf(ctx, "Failed to get evaluation task: %v", err)
 		return nil, err
 	}
 
+	logger.Info(ctx, "Evaluation result retrieved successfully")
+	return task.Detail(), nil
+}
+
+// ListEvaluations lists the past evaluation tasks of the tenant, newest first
+func (e *EvaluationService) ListEvaluations(ctx context.Context,
+	page *types.Pagination,
+) (*types.PageResult, error) {
 	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
-	logger.Infof(
-		ctx,
-		"Checking tenant ID match, task tenant ID: %d, current tenant ID: %d",
-		detail.Task.TenantID, tenantID,
-	)
-
-	if tenantID != detail.Task.TenantID {
-		logger.Error(ctx, "Tenant ID mismatch")
-		return nil, errors.New("tenant ID does not match")
+	tasks, total, err := e.repo.ListPagedTasks(ctx, tenantID, page)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to list evaluation tasks: %v", err)
+		return nil, err
 	}
 
-	logger.Info(ctx, "Evaluation result retrieved successfully")
-	return detail, nil
+	details := make([]*types.EvaluationDetail, 0, len(tasks))
+	for _, task := range tasks {
+		details = append(details, task.Detail())
+	}
+	return types.NewPageResult(total, page, details), nil
+}
+
+// CompareEvaluations compares the metrics of a target evaluation task against a base task
+// Questions are matched by their text, a question regressed when any of its metrics dropped
+func (e *EvaluationService) CompareEvaluations(ctx context.Context,
+	baseTaskID string, targetTaskID string,
+) (*types.EvaluationComparison, error) {
+	logger.Infof(ctx, "Comparing evaluation tasks, base: %s, target: %s", baseTaskID, targetTaskID)
+
+	base, err := e.getTask(ctx, baseTaskID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := e.getTask(ctx, targetTaskID)
+	if err != nil {
+		return nil, err
+	}
+	if base.Metric == nil || target.Metric == nil {
+		return nil, werrors.NewBadRequestError("Evaluation task has no metrics yet")
+	}
+
+	baseQuestions, err := e.repo.ListQuestionsByTaskID(ctx, base.ID)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to list questions of evaluation task %s: %v", base.ID, err)
+		return nil, err
+	}
+	targetQuestions, err := e.repo.ListQuestionsByTaskID(ctx, target.ID)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to list questions of evaluation task %s: %v", target.ID, err)
+		return nil, err
+	}
+
+	byQuestion := make(map[string]*types.EvaluationQuestion, len(baseQuestions))
+	for _, q := range baseQuestions {
+		if _, ok := byQuestion[q.Question]; !ok {
+			byQuestion[q.Question] = q
+		}
+	}
+	regressions := make([]*types.QuestionRegression, 0)
+	for _, q := range targetQuestions {
+		baseQuestion, ok := byQuestion[q.Question]
+		if !ok || baseQuestion.Metric == nil || q.Metric == nil {
+			continue
+		}
+		var regressed []*types.MetricDiff
+		for _, diff := range diffMetrics(baseQuestion.Metric, q.Metric) {
+			if diff.Delta < 0 {
+				regressed = append(regressed, diff)
+			}
+		}
+		if len(regressed) == 0 {
+			continue
+		}
+		regressions = append(regressions, &types.QuestionRegression{
+			QID:       q.QID,
+			Question:  q.Question,
+			Base:      baseQuestion,
+			Target:    q,
+			Regressed: regressed,
+		})
+	}
+
+	logger.Infof(ctx, "Evaluation tasks compared, %d questions regressed", len(regressions))
+	return &types.EvaluationComparison{
+		Base:        base.Detail(),
+		Target:      target.Detail(),
+		Metrics:     diffMetrics(base.Metric, target.Metric),
+		Regressions: regressions,
+	}, nil
+}
+
+// diffMetrics returns the difference of every metric from base to target
+func diffMetrics(base, target *types.MetricResult) []*types.MetricDiff {
+	diffs := make([]*types.MetricDiff, 0, len(metricCalculators))
+	for _, c := range metricCalculators {
+		baseValue, targetValue := *c.getField(base), *c.getField(target)
+		diffs = append(diffs, &types.MetricDiff{
+			Name:   c.name,
+			Base:   baseValue,
+			Target: targetValue,
+			Delta:  targetValue - baseValue,
+		})
+	}
+	return diffs
 }
 
 // Evaluation starts a new evaluation task with given parameters
@@ -141,6 +224,16 @@ func (e *EvaluationService) Evaluation(ctx context.Context,
 	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
 	logger.Infof(ctx, "Tenant ID: %d", tenantID)
 
+	// Check the dataset before creating any resources for the evaluation
+	if datasetID == "" {
+		datasetID = types.DefaultDatasetID
+		logger.Info(ctx, "Using default dataset")
+	}
+	if _, err := e.dataset.GetDataset(ctx, datasetID); err != nil {
+		logger.Errorf(ctx, "Failed to get dataset %s: %v", datasetID, err)
+		return nil, err
+	}
+
 	// Handle knowledge base creation if not provided
 	if knowledgeBaseID == "" {
 		logger.Info(ctx, "No knowledge base ID provided, creating new knowledge base")
@@ -202,11 +295,6 @@ func (e *EvaluationService) Evaluation(ctx context.Context,
 	}
 
 	// Set default values for optional parameters
-	if datasetID == "" {
-		datasetID = "default"
-		logger.Info(ctx, "Using default dataset")
-	}
-
 	if rerankModelID == "" {
 		// 获取默认的重排模型
 		models, err := e.modelService.ListModels(ctx)
@@ -247,20 +335,21 @@ func (e *EvaluationService) Evaluation(ctx context.Context,
 	taskID := uuid.New().String()
 	logger.Infof(ctx, "Generated task ID: %s", taskID)
 
-	// Prepare evaluation detail with all parameters
-	detail := &types.EvaluationDetail{
-		Task: &types.EvaluationTask{
-			ID:        taskID,
-			TenantID:  tenantID,
-			DatasetID: datasetID,
-			Status:    types.EvaluationStatuePending,
-			StartTime: time.Now(),
-		},
+	// Prepare evaluation task with all parameters
+	task := &types.EvaluationTask{
+		ID:        taskID,
+		TenantID:  tenantID,
+		DatasetID: datasetID,
+		Status:    types.EvaluationStatuePending,
+		StartTime: time.Now(),
 		Params: &types.ChatManage{
 			KnowledgeBaseID:  knowledgeBaseID,
 			VectorThreshold:  e.config.Conversation.VectorThreshold,
 			KeywordThreshold: e.config.Conversation.KeywordThreshold,
 			EmbeddingTopK:    e.config.Conversation.EmbeddingTopK,
+			FusionStrategy:   types.FusionStrategy(e.config.Conversation.FusionStrategy),
+			VectorWeight:     e.config.Conversation.VectorWeight,
+			KeywordWeight:    e.config.Conversation.KeywordWeight,
 			RerankModelID:    rerankModelID,
 			RerankTopK:       e.config.Conversation.RerankTopK,
 			RerankThreshold:  e.config.Conversation.RerankThreshold,
@@ -283,9 +372,14 @@ func (e *EvaluationService) Evaluation(ctx context.Context,
 		},
 	}
 
-	// Store evaluation task in memory storage
-	logger.Info(ctx, "Registering evaluation task")
-	e.evaluationMemoryStorage.register(detail)
+	// Persist evaluation task
+	logger.Info(ctx, "Saving evaluation task")
+	if err := e.repo.CreateTask(ctx, task); err != nil {
+		logger.Errorf(ctx, "Failed to create evaluation task: %v", err)
+		return nil, err
+	}
+	// The background evaluation keeps updating the task, return a snapshot of it
+	created := *task
 
 	// Start evaluation in background goroutine
 	logger.Info(ctx, "Starting evaluation in background")
@@ -295,52 +389,57 @@ func (e *EvaluationService) Evaluation(ctx context.Context,
 		logger.Infof(newCtx, "Background evaluation started for task ID: %s", taskID)
 
 		// Update task status to running
-		detail.Task.Status = types.EvaluationStatueRunning
+		task.Status = types.EvaluationStatueRunning
+		e.saveTask(newCtx, task)
 		logger.Info(newCtx, "Evaluation task status set to running")
 
 		// Execute actual evaluation
-		if err := e.EvalDataset(newCtx, detail); err != nil {
-			detail.Task.Status = types.EvaluationStatueFailed
-			detail.Task.ErrMsg = err.Error()
+		err := e.EvalDataset(newCtx, task)
+		endTime := time.Now()
+		task.EndTime = &endTime
+		if err != nil {
+			task.Status = types.EvaluationStatueFailed
+			task.ErrMsg = err.Error()
+			e.saveTask(newCtx, task)
 			logger.Errorf(newCtx, "Evaluation task failed: %v, task ID: %s", err, taskID)
 			return
 		}
 
 		// Mark task as completed successfully
+		task.Status = types.EvaluationStatueSuccess
+		e.saveTask(newCtx, task)
 		logger.Infof(newCtx, "Evaluation task completed successfully, task ID: %s", taskID)
-		detail.Task.Status = types.EvaluationStatueSuccess
 	}()
 
 	logger.Infof(ctx, "Evaluation task created successfully, task ID: %s", taskID)
-	return detail, nil
+	return created.Detail(), nil
 }
 
 // EvalDataset performs the actual evaluation of a dataset
-// Processes each QA pair in parallel and records metrics
-func (e *EvaluationService) EvalDataset(ctx context.Context, detail *types.EvaluationDetail) error {
+// Processes each QA pair in parallel and records the metrics of every question and of the whole task
+func (e *EvaluationService) EvalDataset(ctx context.Context, task *types.EvaluationTask) error {
 	logger.Info(ctx, "Start evaluating dataset")
-	logger.Infof(ctx, "Task ID: %s, Dataset ID: %s", detail.Task.ID, detail.Task.DatasetID)
+	logger.Infof(ctx, "Task ID: %s, Dataset ID: %s", task.ID, task.DatasetID)
 
 	// Retrieve dataset from storage
-	dataset, err := e.dataset.GetDatasetByID(ctx, detail.Task.DatasetID)
+	dataset, err := e.dataset.GetDatasetByID(ctx, task.DatasetID)
 	if err != nil {
 		logger.Errorf(ctx, "Failed to get dataset: %v", err)
 		return err
 	}
 	logger.Infof(ctx, "Dataset retrieved successfully with %d QA pairs", len(dataset))
 
-	// Update total QA pairs count in task details
-	e.evaluationMemoryStorage.update(detail.Task.ID, func(params *types.EvaluationDetail) {
-		params.Task.Total = len(dataset)
-		logger.Infof(ctx, "Updated task total to %d QA pairs", params.Task.Total)
-	})
+	// Update total QA pairs count of the task
+	task.Total = len(dataset)
+	e.saveTask(ctx, task)
+	logger.Infof(ctx, "Updated task total to %d QA pairs", task.Total)
 
 	// Extract and organize passages from dataset
 	passages := getPassageList(dataset)
 	logger.Infof(ctx, "Creating knowledge from %d passages", len(passages))
 
 	// Create knowledge base from passages
-	knowledge, err := e.knowledgeService.CreateKnowledgeFromPassage(ctx, detail.Params.KnowledgeBaseID, passages)
+	knowledge, err := e.knowledgeService.CreateKnowledgeFromPassage(ctx, task.Params.KnowledgeBaseID, passages)
 	if err != nil {
 		logger.Errorf(ctx, "Failed to create knowledge from passages: %v", err)
 		return err
@@ -354,12 +453,12 @@ func (e *EvaluationService) EvalDataset(ctx context.Context, detail *types.Evalu
 			logger.Errorf(ctx, "Failed to delete knowledge: %v, knowledge ID: %s", err, knowledge.ID)
 		}
 
-		logger.Infof(ctx, "Cleaning up resources - deleting knowledge base: %s", detail.Params.KnowledgeBaseID)
-		if err := e.knowledgeBaseService.DeleteKnowledgeBase(ctx, detail.Params.KnowledgeBaseID); err != nil {
+		logger.Infof(ctx, "Cleaning up resources - deleting knowledge base: %s", task.Params.KnowledgeBaseID)
+		if err := e.knowledgeBaseService.DeleteKnowledgeBase(ctx, task.Params.KnowledgeBaseID); err != nil {
 			logger.Errorf(
 				ctx,
 				"Failed to delete knowledge base: %v, knowledge base ID: %s",
-				err, detail.Params.KnowledgeBaseID,
+				err, task.Params.KnowledgeBaseID,
 			)
 		}
 	}()
@@ -382,13 +481,12 @@ func (e *EvaluationService) EvalDataset(ctx context.Context, detail *types.Evalu
 			logger.Infof(ctx, "Processing QA pair %d, question: %s", i, qaPair.Question)
 
 			// Prepare chat management parameters for this QA pair
-			chatManage := detail.Params.Clone()
+			chatManage := task.Params.Clone()
 			chatManage.Query = qaPair.Question
 
 			// Execute knowledge QA pipeline
 			logger.Infof(ctx, "Running knowledge QA for question: %s", qaPair.Question)
-			err = e.sessionService.KnowledgeQAByEvent(ctx, chatManage, types.Pipline["rag"])
-			if err != nil {
+			if err := e.sessionService.KnowledgeQAByEvent(ctx, chatManage, types.Pipline["rag"]); err != nil {
 				logger.Errorf(ctx, "Failed to process question %d: %v", i, err)
 				return err
 			}
@@ -400,18 +498,29 @@ func (e *EvaluationService) EvalDataset(ctx context.Context, detail *types.Evalu
 			metricHook.recordSearchResult(i, chatManage.SearchResult)
 			metricHook.recordRerankResult(i, chatManage.RerankResult)
 			metricHook.recordChatResponse(i, chatManage.ChatResponse)
-			metricHook.recordFinish(i)
+			metricInput, metricResult := metricHook.recordFinish(i)
+
+			// Persist the record of the question
+			if err := e.repo.CreateQuestion(ctx, &types.EvaluationQuestion{
+				TaskID:        task.ID,
+				QuestionIndex: i,
+				QID:           qaPair.QID,
+				Question:      qaPair.Question,
+				Input:         metricInput,
+				Metric:        metricResult,
+			}); err != nil {
+				logger.Errorf(ctx, "Failed to save evaluation question %d: %v", i, err)
+				return err
+			}
 
-			// Update progress metrics
+			// Update progress metrics, saved under the lock so that progress never goes backwards
 			mu.Lock()
+			defer mu.Unlock()
 			finished += 1
-			metricResult := metricHook.MetricResult()
-			mu.Unlock()
-			e.evaluationMemoryStorage.update(detail.Task.ID, func(params *types.EvaluationDetail) {
-				params.Metric = metricResult
-				params.Task.Finished = finished
-				logger.Infof(ctx, "Updated task progress: %d/%d completed", finished, params.Task.Total)
-			})
+			task.Metric = metricHook.MetricResult()
+			task.Finished = finished
+			e.saveTask(ctx, task)
+			logger.Infof(ctx, "Updated task progress: %d/%d completed", finished, task.Total)
 			return nil
 		})
 	}
@@ -423,13 +532,11 @@ func (e *EvaluationService) EvalDataset(ctx context.Context, detail *types.Evalu
 		return err
 	}
 
-	// Final update of evaluation metrics
-	e.evaluationMemoryStorage.update(detail.Task.ID, func(params *types.EvaluationDetail) {
-		params.Metric = metricHook.MetricResult()
-		params.Task.Finished = finished
-	})
+	// Final update of evaluation metrics, saved together with the task status by the caller
+	task.Metric = metricHook.MetricResult()
+	task.Finished = finished
 
-	logger.Infof(ctx, "Dataset evaluation completed successfully, task ID: %s", detail.Task.ID)
+	logger.Infof(ctx, "Dataset evaluation completed successfully, task ID: %s", task.ID)
 	return nil
 }
 
@@ -444,8 +551,8 @@ func getPassageList(dataset []*types.QAPair) []string {
 			maxPID = max(maxPID, qaPair.PIDs[i])
 		}
 	}
-	passages := make([]string, maxPID)
-	for i := 0; i < maxPID; i++ {
+	passages := make([]string, maxPID+1)
+	for i := 0; i <= maxPID; i++ {
 		if _, ok := pIDMap[i]; ok {
 			passages[i] = pIDMap[i]
 		}
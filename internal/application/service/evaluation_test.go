@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	werrors "github.com/Tencent/WeKnora/internal/errors"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+)
+
+// fakeEvaluationRepo keeps the evaluation tasks and their question records in memory
+type fakeEvaluationRepo struct {
+	interfaces.EvaluationRepository
+	tasks     map[string]*types.EvaluationTask
+	questions map[string][]*types.EvaluationQuestion
+}
+
+func (r *fakeEvaluationRepo) GetTaskByID(ctx context.Context,
+	tenantID uint, id string,
+) (*types.EvaluationTask, error) {
+	task, ok := r.tasks[id]
+	if !ok || task.TenantID != tenantID {
+		return nil, types.ErrEvaluationTaskNotFound
+	}
+	return task, nil
+}
+
+func (r *fakeEvaluationRepo) ListQuestionsByTaskID(ctx context.Context,
+	taskID string,
+) ([]*types.EvaluationQuestion, error) {
+	return r.questions[taskID], nil
+}
+
+func newMetricResult(recall, bleu1 float64) *types.MetricResult {
+	return &types.MetricResult{
+		RetrievalMetrics:  types.RetrievalMetrics{Recall: recall},
+		GenerationMetrics: types.GenerationMetrics{BLEU1: bleu1},
+	}
+}
+
+func TestDiffMetrics(t *testing.T) {
+	diffs := diffMetrics(newMetricResult(0.5, 0.2), newMetricResult(0.75, 0.1))
+	if len(diffs) != len(metricCalculators) {
+		t.Fatalf("Expected a diff per metric, got %d", len(diffs))
+	}
+	byName := make(map[string]*types.MetricDiff, len(diffs))
+	for _, diff := range diffs {
+		byName[diff.Name] = diff
+	}
+	if recall := byName["recall"]; recall.Base != 0.5 || recall.Target != 0.75 || recall.Delta != 0.25 {
+		t.Errorf("Unexpected recall diff %+v", recall)
+	}
+	if bleu1 := byName["bleu1"]; bleu1.Delta >= 0 {
+		t.Errorf("Expected a negative bleu1 delta, got %+v", bleu1)
+	}
+	if precision := byName["precision"]; precision.Delta != 0 {
+		t.Errorf("Expected an unchanged precision, got %+v", precision)
+	}
+}
+
+func TestCompareEvaluations(t *testing.T) {
+	repo := &fakeEvaluationRepo{
+		tasks: map[string]*types.EvaluationTask{
+			"base":    {ID: "base", TenantID: 1, Metric: newMetricResult(0.5, 0.5)},
+			"target":  {ID: "target", TenantID: 1, Metric: newMetricResult(0.6, 0.4)},
+			"running": {ID: "running", TenantID: 1},
+			"other":   {ID: "other", TenantID: 2, Metric: newMetricResult(1, 1)},
+		},
+		questions: map[string][]*types.EvaluationQuestion{
+			"base": {
+				{QID: 1, Question: "q1", Metric: newMetricResult(1, 0.5)},
+				{QID: 2, Question: "q2", Metric: newMetricResult(0.5, 0.5)},
+				{QID: 3, Question: "q3", Metric: newMetricResult(0.5, 0.5)},
+			},
+			"target": {
+				{QID: 1, Question: "q1", Metric: newMetricResult(0.5, 0.5)},
+				{QID: 2, Question: "q2", Metric: newMetricResult(1, 0.5)},
+				{QID: 4, Question: "q4", Metric: newMetricResult(0, 0)},
+			},
+		},
+	}
+	s := &EvaluationService{repo: repo}
+	ctx := context.WithValue(context.Background(), types.TenantIDContextKey, uint(1))
+
+	comparison, err := s.CompareEvaluations(ctx, "base", "target")
+	if err != nil {
+		t.Fatalf("CompareEvaluations: %v", err)
+	}
+	if comparison.Base.Task.ID != "base" || comparison.Target.Task.ID != "target" {
+		t.Errorf("Unexpected tasks %s and %s", comparison.Base.Task.ID, comparison.Target.Task.ID)
+	}
+	if len(comparison.Metrics) != len(metricCalculators) {
+		t.Errorf("Expected the task metrics to be compared, got %d", len(comparison.Metrics))
+	}
+	// q2 improved and q4 is missing from the base, only q1 regressed
+	if len(comparison.Regressions) != 1 {
+		t.Fatalf("Expected a single regression, got %d", len(comparison.Regressions))
+	}
+	regression := comparison.Regressions[0]
+	if regression.QID != 1 || len(regression.Regressed) != 1 || regression.Regressed[0].Name != "recall" {
+		t.Errorf("Expected the recall of q1 to regress, got %+v", regression)
+	}
+
+	var appErr *werrors.AppError
+	if _, err := s.CompareEvaluations(ctx, "base", "running"); !errors.As(err, &appErr) ||
+		appErr.Code != werrors.ErrBadRequest {
+		t.Errorf("Expected a task without metrics to be rejected, got %v", err)
+	}
+	if _, err := s.CompareEvaluations(ctx, "base", "other"); !errors.As(err, &appErr) ||
+		appErr.Code != werrors.ErrNotFound {
+		t.Errorf("Expected the task of another tenant not to be found, got %v", err)
+	}
+}
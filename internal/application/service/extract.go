@@ -4,8 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-	"strings"
 
 	chatpipline "github.com/Tencent/WeKnora/internal/application/service/chat_pipline"
 	"github.com/Tencent/WeKnora/internal/config"
@@ -17,7 +15,7 @@ import (
 )
 
 func NewChunkExtractTask(ctx context.Context, client *asynq.Client, tenantID uint, chunkID string, modelID string) error {
-	if strings.ToLower(os.Getenv("NEO4J_ENABLE")) != "true" {
+	if config.GetGraphDriver() == "" {
 		logger.Debugf(ctx, "NOT SUPPORT RETRIEVE GRAPH")
 		return nil
 	}
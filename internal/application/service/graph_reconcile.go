@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Tencent/WeKnora/internal/config"
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// GraphReconcileScanSpec is the schedule of the periodic reconciliation of the retrieval graph
+	GraphReconcileScanSpec = "@every 24h"
+	// graphReconcileBatchSize is the number of graph chunks checked against the chunk table at once
+	graphReconcileBatchSize = 500
+	// graphReconcileMaxRetry is the maximum number of retries of a reconcile task
+	graphReconcileMaxRetry = 1
+)
+
+// graphReconcileService repairs the retrieval graph of knowledge bases whose nodes still reference deleted chunks,
+// such drift is left by deletions that happened before the graph was cleaned up with the chunks
+type graphReconcileService struct {
+	kbRepo      interfaces.KnowledgeBaseRepository
+	chunkRepo   interfaces.ChunkRepository
+	graphEngine interfaces.RetrieveGraphRepository
+	task        *asynq.Client
+}
+
+// NewGraphReconcileService creates a new graph reconcile service
+func NewGraphReconcileService(
+	kbRepo interfaces.KnowledgeBaseRepository,
+	chunkRepo interfaces.ChunkRepository,
+	graphEngine interfaces.RetrieveGraphRepository,
+	task *asynq.Client,
+) interfaces.GraphReconciler {
+	return &graphReconcileService{
+		kbRepo:      kbRepo,
+		chunkRepo:   chunkRepo,
+		graphEngine: graphEngine,
+		task:        task,
+	}
+}
+
+// Scan enqueues a reconcile task for every knowledge base when a retrieval graph is configured
+// The task ID is derived from the knowledge base ID so a knowledge base is never queued twice
+func (s *graphReconcileService) Scan(ctx context.Context, t *asynq.Task) error {
+	if config.GetGraphDriver() == "" {
+		return nil
+	}
+	kbs, err := s.kbRepo.ListKnowledgeBases(ctx)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to list knowledge bases: %v", err)
+		return err
+	}
+	for _, kb := range kbs {
+		payload, err := json.Marshal(types.GraphReconcilePayload{
+			TenantID:        kb.TenantID,
+			KnowledgeBaseID: kb.ID,
+		})
+		if err != nil {
+			return err
+		}
+		task := asynq.NewTask(types.TypeGraphReconcile, payload,
+			asynq.TaskID(types.TypeGraphReconcile+":"+kb.ID),
+			asynq.MaxRetry(graphReconcileMaxRetry), asynq.Queue("low"))
+		if _, err := s.task.Enqueue(task); err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+			logger.Errorf(ctx, "Failed to enqueue graph reconcile task of knowledge base %s: %v", kb.ID, err)
+		}
+	}
+	logger.Infof(ctx, "Graph reconcile scan enqueued %d knowledge bases", len(kbs))
+	return nil
+}
+
+// Reconcile removes the chunks referenced by the graph of a knowledge base that no longer exist,
+// nodes and relations left without chunks are removed with them
+func (s *graphReconcileService) Reconcile(ctx context.Context, t *asynq.Task) error {
+	var p types.GraphReconcilePayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		logger.Errorf(ctx, "failed to unmarshal task payload: %v", err)
+		return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+	}
+	requestID := uuid.New().String()
+	ctx = logger.WithRequestID(ctx, requestID)
+	ctx = logger.WithField(ctx, "knowledge_base", p.KnowledgeBaseID)
+	ctx = context.WithValue(ctx, types.RequestIDContextKey, requestID)
+	ctx = context.WithValue(ctx, types.TenantIDContextKey, p.TenantID)
+
+	namespace := types.NameSpace{KnowledgeBase: p.KnowledgeBaseID}
+	chunkIDs, err := s.graphEngine.ListChunkIDs(ctx, namespace)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to list graph chunks: %v", err)
+		return err
+	}
+
+	var missing []string
+	for start := 0; start < len(chunkIDs); start += graphReconcileBatchSize {
+		batch := chunkIDs[start:min(start+graphReconcileBatchSize, len(chunkIDs))]
+		chunks, err := s.chunkRepo.ListChunksByID(ctx, p.TenantID, batch)
+		if err != nil {
+			logger.Errorf(ctx, "Failed to list chunks: %v", err)
+			return err
+		}
+		existing := make(map[string]bool, len(chunks))
+		for _, chunk := range chunks {
+			existing[chunk.ID] = true
+		}
+		for _, id := range batch {
+			if !existing[id] {
+				missing = append(missing, id)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	logger.Infof(ctx, "Removing %d deleted chunks from the graph of %d chunks", len(missing), len(chunkIDs))
+	for start := 0; start < len(missing); start += graphReconcileBatchSize {
+		batch := missing[start:min(start+graphReconcileBatchSize, len(missing))]
+		if err := s.graphEngine.DelChunks(ctx, namespace, batch); err != nil {
+			logger.Errorf(ctx, "Failed to remove deleted chunks from the graph: %v", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/hibiken/asynq"
+)
+
+// fakeReconcileChunkRepo returns the chunks of the ids it knows
+type fakeReconcileChunkRepo struct {
+	interfaces.ChunkRepository
+	existing map[string]bool
+	calls    int
+}
+
+func (r *fakeReconcileChunkRepo) ListChunksByID(ctx context.Context, tenantID uint, ids []string) ([]*types.Chunk, error) {
+	r.calls++
+	var chunks []*types.Chunk
+	for _, id := range ids {
+		if r.existing[id] {
+			chunks = append(chunks, &types.Chunk{ID: id, TenantID: tenantID})
+		}
+	}
+	return chunks, nil
+}
+
+// fakeReconcileGraph records the chunks removed from the graph
+type fakeReconcileGraph struct {
+	interfaces.RetrieveGraphRepository
+	chunkIDs []string
+	deleted  [][]string
+	err      error
+}
+
+func (g *fakeReconcileGraph) ListChunkIDs(ctx context.Context, namespace types.NameSpace) ([]string, error) {
+	return g.chunkIDs, nil
+}
+
+func (g *fakeReconcileGraph) DelChunks(ctx context.Context, namespace types.NameSpace, chunkIDs []string) error {
+	if namespace.KnowledgeBase != "kb" || namespace.Knowledge != "" {
+		return fmt.Errorf("unexpected namespace %+v", namespace)
+	}
+	g.deleted = append(g.deleted, chunkIDs)
+	return g.err
+}
+
+func newReconcileTask(t *testing.T) *asynq.Task {
+	t.Helper()
+	payload, err := json.Marshal(types.GraphReconcilePayload{TenantID: 1, KnowledgeBaseID: "kb"})
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	return asynq.NewTask(types.TypeGraphReconcile, payload)
+}
+
+func TestGraphReconcile(t *testing.T) {
+	t.Run("removes missing chunks", func(t *testing.T) {
+		chunkRepo := &fakeReconcileChunkRepo{existing: map[string]bool{"c1": true, "c3": true}}
+		graph := &fakeReconcileGraph{chunkIDs: []string{"c1", "c2", "c3", "c4"}}
+		s := &graphReconcileService{chunkRepo: chunkRepo, graphEngine: graph}
+		if err := s.Reconcile(context.Background(), newReconcileTask(t)); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+		if !reflect.DeepEqual(graph.deleted, [][]string{{"c2", "c4"}}) {
+			t.Errorf("Expected the missing chunks to be removed, got %v", graph.deleted)
+		}
+	})
+
+	t.Run("nothing missing", func(t *testing.T) {
+		chunkRepo := &fakeReconcileChunkRepo{existing: map[string]bool{"c1": true}}
+		graph := &fakeReconcileGraph{chunkIDs: []string{"c1"}}
+		s := &graphReconcileService{chunkRepo: chunkRepo, graphEngine: graph}
+		if err := s.Reconcile(context.Background(), newReconcileTask(t)); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+		if len(graph.deleted) != 0 {
+			t.Errorf("Expected no chunk removed, got %v", graph.deleted)
+		}
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		chunkIDs := make([]string, graphReconcileBatchSize+10)
+		for i := range chunkIDs {
+			chunkIDs[i] = fmt.Sprintf("c%d", i)
+		}
+		chunkRepo := &fakeReconcileChunkRepo{existing: map[string]bool{}}
+		graph := &fakeReconcileGraph{chunkIDs: chunkIDs}
+		s := &graphReconcileService{chunkRepo: chunkRepo, graphEngine: graph}
+		if err := s.Reconcile(context.Background(), newReconcileTask(t)); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+		if chunkRepo.calls != 2 {
+			t.Errorf("Expected 2 chunk lookups, got %d", chunkRepo.calls)
+		}
+		if len(graph.deleted) != 2 || len(graph.deleted[0]) != graphReconcileBatchSize || len(graph.deleted[1]) != 10 {
+			t.Errorf("Expected the missing chunks removed in 2 batches, got %d", len(graph.deleted))
+		}
+	})
+
+	t.Run("graph error", func(t *testing.T) {
+		chunkRepo := &fakeReconcileChunkRepo{}
+		graph := &fakeReconcileGraph{chunkIDs: []string{"c1"}, err: errors.New("graph down")}
+		s := &graphReconcileService{chunkRepo: chunkRepo, graphEngine: graph}
+		if err := s.Reconcile(context.Background(), newReconcileTask(t)); err == nil {
+			t.Error("Expected the graph error to be returned")
+		}
+	})
+
+	t.Run("invalid payload", func(t *testing.T) {
+		s := &graphReconcileService{}
+		err := s.Reconcile(context.Background(), asynq.NewTask(types.TypeGraphReconcile, []byte("{")))
+		if !errors.Is(err, asynq.SkipRetry) {
+			t.Errorf("Expected the task to skip retries, got %v", err)
+		}
+	})
+}
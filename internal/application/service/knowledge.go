@@ -9,10 +9,7 @@ import (
 	"fmt"
 	"io"
 	"mime/multipart"
-	"os"
-	"regexp"
 	"slices"
-	"sort"
 	"strings"
 	"time"
 
@@ -20,17 +17,12 @@ import (
 	"github.com/Tencent/WeKnora/internal/config"
 	werrors "github.com/Tencent/WeKnora/internal/errors"
 	"github.com/Tencent/WeKnora/internal/logger"
-	"github.com/Tencent/WeKnora/internal/models/chat"
-	"github.com/Tencent/WeKnora/internal/models/utils"
-	"github.com/Tencent/WeKnora/internal/tracing"
 	"github.com/Tencent/WeKnora/internal/types"
 	"github.com/Tencent/WeKnora/internal/types/interfaces"
 	secutils "github.com/Tencent/WeKnora/internal/utils"
 	"github.com/Tencent/WeKnora/services/docreader/src/client"
-	"github.com/Tencent/WeKnora/services/docreader/src/proto"
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
-	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -63,7 +55,7 @@ type knowledgeService struct {
 	fileSvc         interfaces.FileService
 	modelService    interfaces.ModelService
 	task            *asynq.Client
-	graphEngine     interfaces.RetrieveGraphRepository
+	graphService    interfaces.GraphService
 }
 
 // NewKnowledgeService creates a new knowledge service instance
@@ -78,7 +70,7 @@ func NewKnowledgeService(
 	fileSvc interfaces.FileService,
 	modelService interfaces.ModelService,
 	task *asynq.Client,
-	graphEngine interfaces.RetrieveGraphRepository,
+	graphService interfaces.GraphService,
 ) (interfaces.KnowledgeService, error) {
 	return &knowledgeService{
 		config:          config,
@@ -91,7 +83,7 @@ func NewKnowledgeService(
 		fileSvc:         fileSvc,
 		modelService:    modelService,
 		task:            task,
-		graphEngine:     graphEngine,
+		graphService:    graphService,
 	}, nil
 }
 
@@ -248,11 +240,12 @@ func (s *knowledgeService) CreateKnowledgeFromFile(ctx context.Context,
 
 	// Process document asynchronously
 	logger.Info(ctx, "Starting asynchronous document processing")
-	newCtx := logger.CloneContext(ctx)
 	if enableMultimodel == nil {
 		enableMultimodel = &kb.ChunkingConfig.EnableMultimodal
 	}
-	go s.processDocument(newCtx, kb, knowledge, file, *enableMultimodel)
+	if err := s.enqueueKnowledgeProcess(ctx, knowledge, *enableMultimodel, nil, 0); err != nil {
+		return nil, err
+	}
 
 	logger.Infof(ctx, "Knowledge from file created successfully, ID: %s", knowledge.ID)
 	return knowledge, nil
@@ -340,8 +333,9 @@ func (s *knowledgeService) CreateKnowledgeFromURL(ctx context.Context,
 	if enableMultimodel == nil {
 		enableMultimodel = &kb.ChunkingConfig.EnableMultimodal
 	}
-	newCtx := logger.CloneContext(ctx)
-	go s.processDocumentFromURL(newCtx, kb, knowledge, url, *enableMultimodel)
+	if err := s.enqueueKnowledgeProcess(ctx, knowledge, *enableMultimodel, nil, 0); err != nil {
+		return nil, err
+	}
 
 	logger.Infof(ctx, "Knowledge from URL created successfully, ID: %s", knowledge.ID)
 	return knowledge, nil
@@ -396,12 +390,151 @@ func (s *knowledgeService) CreateKnowledgeFromPassage(ctx context.Context,
 
 	// Process passages asynchronously
 	logger.Info(ctx, "Starting asynchronous passage processing")
-	go s.processDocumentFromPassage(ctx, kb, knowledge, safePassages)
+	if err := s.enqueueKnowledgeProcess(ctx, knowledge, false, safePassages, 0); err != nil {
+		return nil, err
+	}
 
 	logger.Infof(ctx, "Knowledge from passage created successfully, ID: %s", knowledge.ID)
 	return knowledge, nil
 }
 
+// ReplaceKnowledgeFile replaces the source file of a file knowledge and re-ingests it incrementally,
+// unchanged chunks keep their index and only the changed chunks are embedded again
+func (s *knowledgeService) ReplaceKnowledgeFile(ctx context.Context,
+	id string, file *multipart.FileHeader, enableMultimodel *bool,
+) (*types.Knowledge, error) {
+	logger.Info(ctx, "Start replacing knowledge file")
+	logger.Infof(ctx, "Knowledge ID: %s, file: %s", id, file.Filename)
+
+	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
+	knowledge, err := s.repo.GetKnowledgeByID(ctx, tenantID, id)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to get knowledge: %v", err)
+		return nil, err
+	}
+	if knowledge.Type != "file" {
+		logger.Errorf(ctx, "Knowledge %s is not a file knowledge, type: %s", id, knowledge.Type)
+		return nil, werrors.NewBadRequestError("只能替换文件类型知识的内容")
+	}
+	if knowledge.ParseStatus == "pending" || knowledge.ParseStatus == "processing" {
+		logger.Errorf(ctx, "Knowledge %s is being processed, status: %s", id, knowledge.ParseStatus)
+		return nil, werrors.NewConflictError("知识正在解析中, 请稍后再试")
+	}
+
+	// Validate file type
+	logger.Infof(ctx, "Checking file type: %s", file.Filename)
+	if !isValidFileType(file.Filename) {
+		logger.Error(ctx, "Invalid file type")
+		return nil, ErrInvalidFileType
+	}
+	safeFilename, isValid := secutils.ValidateInput(file.Filename)
+	if !isValid {
+		logger.Errorf(ctx, "Invalid filename: %s", file.Filename)
+		return nil, werrors.NewValidationError("文件名包含非法字符")
+	}
+
+	kb, err := s.kbService.GetKnowledgeBaseByID(ctx, knowledge.KnowledgeBaseID)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to get knowledge base: %v", err)
+		return nil, err
+	}
+
+	// Nothing to do when the content is not changed
+	hash, err := calculateFileHash(file)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to calculate file hash: %v", err)
+		return nil, err
+	}
+	if hash == knowledge.FileHash {
+		logger.Infof(ctx, "File content is not changed, knowledge ID: %s", id)
+		return knowledge, nil
+	}
+
+	// Check storage quota
+	tenantInfo := ctx.Value(types.TenantInfoContextKey).(*types.Tenant)
+	if tenantInfo.StorageQuota > 0 && tenantInfo.StorageUsed >= tenantInfo.StorageQuota {
+		logger.Error(ctx, "Storage quota exceeded")
+		return nil, types.NewStorageQuotaExceededError()
+	}
+
+	// Save the new file before releasing the old one
+	logger.Infof(ctx, "Saving file, knowledge ID: %s", knowledge.ID)
+	filePath, err := s.fileSvc.SaveFile(ctx, file, knowledge.TenantID, knowledge.ID)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to save file, knowledge ID: %s, error: %v", knowledge.ID, err)
+		return nil, err
+	}
+	if knowledge.FilePath != "" && knowledge.FilePath != filePath {
+		if err := s.fileSvc.DeleteFile(ctx, knowledge.FilePath); err != nil {
+			logger.Warnf(ctx, "Failed to delete replaced file %s: %v", knowledge.FilePath, err)
+		}
+	}
+
+	// Only the chunks of a completed ingestion are known to be indexed and can be kept,
+	// otherwise the knowledge is ingested from scratch
+	var generation int64
+	if knowledge.ParseStatus == "completed" {
+		knowledge.Generation++
+		generation = knowledge.Generation
+	}
+
+	if knowledge.Title == knowledge.FileName {
+		knowledge.Title = safeFilename
+	}
+	knowledge.FileName = safeFilename
+	knowledge.FileType = getFileType(safeFilename)
+	knowledge.FileSize = file.Size
+	knowledge.FileHash = hash
+	knowledge.FilePath = filePath
+	knowledge.ParseStatus = "pending"
+	knowledge.ErrorMessage = ""
+	knowledge.StageProgress = nil
+	knowledge.UpdatedAt = time.Now()
+	if err := s.repo.UpdateKnowledge(ctx, knowledge); err != nil {
+		logger.Errorf(ctx, "Failed to update knowledge, ID: %s, error: %v", knowledge.ID, err)
+		return nil, err
+	}
+
+	// Re-ingest the knowledge, the parse stage diffs the new chunks against the existing ones
+	logger.Info(ctx, "Starting asynchronous incremental document processing")
+	if enableMultimodel == nil {
+		enableMultimodel = &kb.ChunkingConfig.EnableMultimodal
+	}
+	if err := s.enqueueKnowledgeProcess(ctx, knowledge, *enableMultimodel, nil, generation); err != nil {
+		return nil, err
+	}
+
+	logger.Infof(ctx, "Knowledge file replaced successfully, ID: %s", knowledge.ID)
+	return knowledge, nil
+}
+
+// enqueueKnowledgeProcess starts the persisted ingestion of a knowledge entry,
+// a non-zero generation re-ingests the replaced content of an existing knowledge incrementally
+func (s *knowledgeService) enqueueKnowledgeProcess(ctx context.Context,
+	knowledge *types.Knowledge, enableMultimodel bool, passages []string, generation int64,
+) error {
+	requestID, _ := ctx.Value(types.RequestIDContextKey).(string)
+	payload := &types.KnowledgeProcessPayload{
+		TenantID:         knowledge.TenantID,
+		KnowledgeID:      knowledge.ID,
+		RequestID:        requestID,
+		EnableMultimodel: enableMultimodel,
+		Passages:         passages,
+		Generation:       generation,
+	}
+	if err := NewKnowledgeProcessTask(ctx, s.task, types.KnowledgeStageParse, payload); err != nil {
+		logger.Errorf(ctx, "Failed to enqueue knowledge process task, ID: %s, error: %v", knowledge.ID, err)
+		knowledge.ParseStatus = "failed"
+		knowledge.ErrorMessage = err.Error()
+		knowledge.UpdatedAt = time.Now()
+		if err := s.repo.UpdateKnowledge(ctx, knowledge); err != nil {
+			logger.Errorf(ctx, "Failed to update knowledge, ID: %s, error: %v", knowledge.ID, err)
+		}
+		return err
+	}
+	return nil
+}
+
 // GetKnowledgeByID retrieves a knowledge entry by its ID
 func (s *knowledgeService) GetKnowledgeByID(ctx context.Context, id string) (*types.Knowledge, error) {
 	logger.Info(ctx, "Start getting knowledge by ID")
@@ -471,7 +604,7 @@ func (s *knowledgeService) DeleteKnowledge(ctx context.Context, id string) error
 		return nil
 	})
 
-	// Delete all chunks associated with this knowledge
+	// Delete all chunks associated with this knowledge, together with the graph extracted from them
 	wg.Go(func() error {
 		if err := s.chunkService.DeleteChunksByKnowledgeID(ctx, knowledge.ID); err != nil {
 			logger.GetLogger(ctx).WithField("error", err).Errorf("DeleteKnowledge delete chunks failed")
@@ -495,11 +628,11 @@ func (s *knowledgeService) DeleteKnowledge(ctx context.Context, id string) error
 		return nil
 	})
 
-	// Delete the knowledge graph
+	// Remove the knowledge from the GraphRAG graph of its knowledge base
 	wg.Go(func() error {
-		namespace := types.NameSpace{KnowledgeBase: knowledge.KnowledgeBaseID, Knowledge: knowledge.ID}
-		if err := s.graphEngine.DelGraph(ctx, []types.NameSpace{namespace}); err != nil {
-			logger.GetLogger(ctx).WithField("error", err).Errorf("DeleteKnowledge delete knowledge graph failed")
+		err := s.graphService.DeleteKnowledgeGraph(ctx, knowledge.KnowledgeBaseID, []string{knowledge.ID})
+		if err != nil {
+			logger.GetLogger(ctx).WithField("error", err).Errorf("DeleteKnowledge delete GraphRAG graph failed")
 			return err
 		}
 		return nil
@@ -551,7 +684,7 @@ func (s *knowledgeService) DeleteKnowledgeList(ctx context.Context, ids []string
 		return nil
 	})
 
-	// 3. Delete all chunks associated with this knowledge
+	// 3. Delete all chunks associated with this knowledge, together with the graph extracted from them
 	wg.Go(func() error {
 		if err := s.chunkService.DeleteByKnowledgeList(ctx, ids); err != nil {
 			logger.GetLogger(ctx).WithField("error", err).Errorf("DeleteKnowledge delete chunks failed")
@@ -578,15 +711,17 @@ func (s *knowledgeService) DeleteKnowledgeList(ctx context.Context, ids []string
 		return nil
 	})
 
-	// Delete the knowledge graph
+	// Remove the knowledge from the GraphRAG graph of their knowledge bases
 	wg.Go(func() error {
-		namespaces := []types.NameSpace{}
+		group := map[string][]string{}
 		for _, knowledge := range knowledgeList {
-			namespaces = append(namespaces, types.NameSpace{KnowledgeBase: knowledge.KnowledgeBaseID, Knowledge: knowledge.ID})
+			group[knowledge.KnowledgeBaseID] = append(group[knowledge.KnowledgeBaseID], knowledge.ID)
 		}
-		if err := s.graphEngine.DelGraph(ctx, namespaces); err != nil {
-			logger.GetLogger(ctx).WithField("error", err).Errorf("DeleteKnowledge delete knowledge graph failed")
-			return err
+		for kbID, knowledgeIDs := range group {
+			if err := s.graphService.DeleteKnowledgeGraph(ctx, kbID, knowledgeIDs); err != nil {
+				logger.GetLogger(ctx).WithField("error", err).Errorf("DeleteKnowledge delete GraphRAG graph failed")
+				return err
+			}
 		}
 		return nil
 	})
@@ -654,665 +789,6 @@ func (s *knowledgeService) cloneKnowledge(ctx context.Context, src *types.Knowle
 	return
 }
 
-// processDocument handles asynchronous processing of document files
-func (s *knowledgeService) processDocument(ctx context.Context,
-	kb *types.KnowledgeBase, knowledge *types.Knowledge, file *multipart.FileHeader, enableMultimodel bool,
-) {
-	logger.GetLogger(ctx).Infof("processDocument enableMultimodel: %v", enableMultimodel)
-
-	ctx, span := tracing.ContextWithSpan(ctx, "knowledgeService.processDocument")
-	defer span.End()
-	span.SetAttributes(
-		attribute.String("request_id", ctx.Value(types.RequestIDContextKey).(string)),
-		attribute.String("knowledge_base_id", kb.ID),
-		attribute.Int("tenant_id", int(kb.TenantID)),
-		attribute.String("knowledge_id", knowledge.ID),
-		attribute.String("file_name", knowledge.FileName),
-		attribute.String("file_type", knowledge.FileType),
-		attribute.String("file_path", knowledge.FilePath),
-		attribute.Int64("file_size", knowledge.FileSize),
-		attribute.String("embedding_model", knowledge.EmbeddingModelID),
-		attribute.Bool("enable_multimodal", enableMultimodel),
-	)
-	logger.GetLogger(ctx).Infof("processDocument trace id: %s", span.SpanContext().TraceID().String())
-
-	if !enableMultimodel && IsImageType(knowledge.FileType) {
-		logger.GetLogger(ctx).WithField("knowledge_id", knowledge.ID).
-			WithField("error", ErrImageNotParse).Errorf("processDocument image without enable multimodel")
-		knowledge.ParseStatus = "failed"
-		knowledge.ErrorMessage = ErrImageNotParse.Error()
-		s.repo.UpdateKnowledge(ctx, knowledge)
-		span.RecordError(ErrImageNotParse)
-		return
-	}
-
-	// Update status to processing
-	knowledge.ParseStatus = "processing"
-	knowledge.UpdatedAt = time.Now()
-	if err := s.repo.UpdateKnowledge(ctx, knowledge); err != nil {
-		span.RecordError(err)
-		return
-	}
-
-	// Read and chunk the document
-	f, err := file.Open()
-	if err != nil {
-		logger.GetLogger(ctx).WithField("knowledge_id", knowledge.ID).
-			WithField("error", err).Errorf("processDocument open file failed")
-		knowledge.ParseStatus = "failed"
-		knowledge.ErrorMessage = err.Error()
-		knowledge.UpdatedAt = time.Now()
-		s.repo.UpdateKnowledge(ctx, knowledge)
-		span.RecordError(err)
-		return
-	}
-	defer f.Close()
-
-	span.AddEvent("start read file")
-	contentBytes, err := io.ReadAll(f)
-	if err != nil {
-		knowledge.ParseStatus = "failed"
-		knowledge.ErrorMessage = err.Error()
-		knowledge.UpdatedAt = time.Now()
-		s.repo.UpdateKnowledge(ctx, knowledge)
-		span.RecordError(err)
-		return
-	}
-
-	// Split file into chunks using document reader service
-	span.AddEvent("start split file")
-	resp, err := s.docReaderClient.ReadFromFile(ctx, &proto.ReadFromFileRequest{
-		FileContent: contentBytes,
-		FileName:    knowledge.FileName,
-		FileType:    knowledge.FileType,
-		ReadConfig: &proto.ReadConfig{
-			ChunkSize:        int32(kb.ChunkingConfig.ChunkSize),
-			ChunkOverlap:     int32(kb.ChunkingConfig.ChunkOverlap),
-			Separators:       kb.ChunkingConfig.Separators,
-			EnableMultimodal: enableMultimodel,
-			StorageConfig: &proto.StorageConfig{
-				Provider:        proto.StorageProvider(proto.StorageProvider_value[strings.ToUpper(kb.StorageConfig.Provider)]),
-				Region:          kb.StorageConfig.Region,
-				BucketName:      kb.StorageConfig.BucketName,
-				AccessKeyId:     kb.StorageConfig.SecretID,
-				SecretAccessKey: kb.StorageConfig.SecretKey,
-				AppId:           kb.StorageConfig.AppID,
-				PathPrefix:      kb.StorageConfig.PathPrefix,
-			},
-			VlmConfig: &proto.VLMConfig{
-				ModelName:     kb.VLMConfig.ModelName,
-				BaseUrl:       kb.VLMConfig.BaseURL,
-				ApiKey:        kb.VLMConfig.APIKey,
-				InterfaceType: kb.VLMConfig.InterfaceType,
-			},
-		},
-		RequestId: ctx.Value(types.RequestIDContextKey).(string),
-	})
-	if err != nil {
-		logger.GetLogger(ctx).WithField("knowledge_id", knowledge.ID).
-			WithField("error", err).Errorf("processDocument read file failed")
-		knowledge.ParseStatus = "failed"
-		knowledge.ErrorMessage = err.Error()
-		knowledge.UpdatedAt = time.Now()
-		s.repo.UpdateKnowledge(ctx, knowledge)
-		span.RecordError(err)
-		return
-	}
-
-	// Process and store chunks
-	span.AddEvent("start process chunks")
-	s.processChunks(ctx, kb, knowledge, resp.Chunks)
-}
-
-// processDocumentFromURL handles asynchronous processing of URL content
-func (s *knowledgeService) processDocumentFromURL(ctx context.Context,
-	kb *types.KnowledgeBase, knowledge *types.Knowledge, url string, enableMultimodel bool,
-) {
-	// Update status to processing
-	knowledge.ParseStatus = "processing"
-	knowledge.UpdatedAt = time.Now()
-	if err := s.repo.UpdateKnowledge(ctx, knowledge); err != nil {
-		return
-	}
-	logger.GetLogger(ctx).Infof("processDocumentFromURL enableMultimodel: %v", enableMultimodel)
-
-	// Fetch and chunk content from URL
-	resp, err := s.docReaderClient.ReadFromURL(ctx, &proto.ReadFromURLRequest{
-		Url:   url,
-		Title: knowledge.Title,
-		ReadConfig: &proto.ReadConfig{
-			ChunkSize:        int32(kb.ChunkingConfig.ChunkSize),
-			ChunkOverlap:     int32(kb.ChunkingConfig.ChunkOverlap),
-			Separators:       kb.ChunkingConfig.Separators,
-			EnableMultimodal: enableMultimodel,
-			StorageConfig: &proto.StorageConfig{
-				Provider:        proto.StorageProvider(proto.StorageProvider_value[strings.ToUpper(kb.StorageConfig.Provider)]),
-				Region:          kb.StorageConfig.Region,
-				BucketName:      kb.StorageConfig.BucketName,
-				AccessKeyId:     kb.StorageConfig.SecretID,
-				SecretAccessKey: kb.StorageConfig.SecretKey,
-				AppId:           kb.StorageConfig.AppID,
-				PathPrefix:      kb.StorageConfig.PathPrefix,
-			},
-			VlmConfig: &proto.VLMConfig{
-				ModelName:     kb.VLMConfig.ModelName,
-				BaseUrl:       kb.VLMConfig.BaseURL,
-				ApiKey:        kb.VLMConfig.APIKey,
-				InterfaceType: kb.VLMConfig.InterfaceType,
-			},
-		},
-		RequestId: ctx.Value(types.RequestIDContextKey).(string),
-	})
-	if err != nil {
-		knowledge.ParseStatus = "failed"
-		knowledge.ErrorMessage = err.Error()
-		knowledge.UpdatedAt = time.Now()
-		s.repo.UpdateKnowledge(ctx, knowledge)
-		return
-	}
-
-	// Process and store chunks
-	s.processChunks(ctx, kb, knowledge, resp.Chunks)
-}
-
-// processDocumentFromPassage handles asynchronous processing of text passages
-func (s *knowledgeService) processDocumentFromPassage(ctx context.Context,
-	kb *types.KnowledgeBase, knowledge *types.Knowledge, passage []string,
-) {
-	// Update status to processing
-	knowledge.ParseStatus = "processing"
-	knowledge.UpdatedAt = time.Now()
-	if err := s.repo.UpdateKnowledge(ctx, knowledge); err != nil {
-		return
-	}
-
-	// Convert passages to chunks
-	chunks := make([]*proto.Chunk, 0, len(passage))
-	start, end := 0, 0
-	for i, p := range passage {
-		if p == "" {
-			continue
-		}
-		end += len([]rune(p))
-		chunk := &proto.Chunk{
-			Content: p,
-			Seq:     int32(i),
-			Start:   int32(start),
-			End:     int32(end),
-		}
-		start = end
-		chunks = append(chunks, chunk)
-	}
-	// Process and store chunks
-	s.processChunks(ctx, kb, knowledge, chunks)
-}
-
-// processChunks processes chunks and creates embeddings for knowledge content
-func (s *knowledgeService) processChunks(ctx context.Context,
-	kb *types.KnowledgeBase, knowledge *types.Knowledge, chunks []*proto.Chunk,
-) {
-	ctx, span := tracing.ContextWithSpan(ctx, "knowledgeService.processChunks")
-	defer span.End()
-	span.SetAttributes(
-		attribute.Int("tenant_id", int(knowledge.TenantID)),
-		attribute.String("knowledge_base_id", knowledge.KnowledgeBaseID),
-		attribute.String("knowledge_id", knowledge.ID),
-		attribute.String("embedding_model_id", kb.EmbeddingModelID),
-		attribute.Int("chunk_count", len(chunks)),
-	)
-
-	// Get embedding model for vectorization
-	embeddingModel, err := s.modelService.GetEmbeddingModel(ctx, kb.EmbeddingModelID)
-	if err != nil {
-		logger.GetLogger(ctx).WithField("error", err).Errorf("processChunks get embedding model failed")
-		span.RecordError(err)
-		return
-	}
-
-	// Generate document summary - 只使用文本类型的 Chunk
-	chatModel, err := s.modelService.GetChatModel(ctx, kb.SummaryModelID)
-	if err != nil {
-		logger.GetLogger(ctx).WithField("error", err).Errorf("processChunks get summary model failed")
-		span.RecordError(err)
-		return
-	}
-
-	enableGraphRAG := os.Getenv("ENABLE_GRAPH_RAG") == "true"
-
-	// Create chunk objects from proto chunks
-	maxSeq := 0
-
-	// 统计图片相关的子Chunk数量，用于扩展insertChunks的容量
-	imageChunkCount := 0
-	for _, chunkData := range chunks {
-		if len(chunkData.Images) > 0 {
-			// 为每个图片的OCR和Caption分别创建一个Chunk
-			imageChunkCount += len(chunkData.Images) * 2
-		}
-		if int(chunkData.Seq) > maxSeq {
-			maxSeq = int(chunkData.Seq)
-		}
-	}
-
-	// 重新分配容量，考虑图片相关的Chunk
-	insertChunks := make([]*types.Chunk, 0, len(chunks)+imageChunkCount)
-
-	for _, chunkData := range chunks {
-		if strings.TrimSpace(chunkData.Content) == "" {
-			continue
-		}
-
-		// 创建主文本Chunk
-		textChunk := &types.Chunk{
-			ID:              uuid.New().String(),
-			TenantID:        knowledge.TenantID,
-			KnowledgeID:     knowledge.ID,
-			KnowledgeBaseID: knowledge.KnowledgeBaseID,
-			Content:         chunkData.Content,
-			ChunkIndex:      int(chunkData.Seq),
-			IsEnabled:       true,
-			CreatedAt:       time.Now(),
-			UpdatedAt:       time.Now(),
-			StartAt:         int(chunkData.Start),
-			EndAt:           int(chunkData.End),
-			ChunkType:       types.ChunkTypeText,
-		}
-		var chunkImages []types.ImageInfo
-		insertChunks = append(insertChunks, textChunk)
-
-		// 处理图片信息
-		if len(chunkData.Images) > 0 {
-			logger.GetLogger(ctx).Infof("Processing %d images in chunk #%d", len(chunkData.Images), chunkData.Seq)
-
-			for i, img := range chunkData.Images {
-				// 保存图片信息到文本Chunk
-				imageInfo := types.ImageInfo{
-					URL:         img.Url,
-					OriginalURL: img.OriginalUrl,
-					StartPos:    int(img.Start),
-					EndPos:      int(img.End),
-					OCRText:     img.OcrText,
-					Caption:     img.Caption,
-				}
-				chunkImages = append(chunkImages, imageInfo)
-
-				// 将ImageInfo序列化为JSON
-				imageInfoJSON, err := json.Marshal([]types.ImageInfo{imageInfo})
-				if err != nil {
-					logger.GetLogger(ctx).WithField("error", err).Errorf("Failed to marshal image info to JSON")
-					continue
-				}
-
-				// 如果有OCR文本，创建OCR Chunk
-				if img.OcrText != "" {
-					ocrChunk := &types.Chunk{
-						ID:              uuid.New().String(),
-						TenantID:        knowledge.TenantID,
-						KnowledgeID:     knowledge.ID,
-						KnowledgeBaseID: knowledge.KnowledgeBaseID,
-						Content:         img.OcrText,
-						ChunkIndex:      maxSeq + i*100 + 1, // 使用不冲突的索引方式
-						IsEnabled:       true,
-						CreatedAt:       time.Now(),
-						UpdatedAt:       time.Now(),
-						StartAt:         int(img.Start),
-						EndAt:           int(img.End),
-						ChunkType:       types.ChunkTypeImageOCR,
-						ParentChunkID:   textChunk.ID,
-						ImageInfo:       string(imageInfoJSON),
-					}
-					insertChunks = append(insertChunks, ocrChunk)
-					logger.GetLogger(ctx).Infof("Created OCR chunk for image %d in chunk #%d", i, chunkData.Seq)
-				}
-
-				// 如果有图片描述，创建Caption Chunk
-				if img.Caption != "" {
-					captionChunk := &types.Chunk{
-						ID:              uuid.New().String(),
-						TenantID:        knowledge.TenantID,
-						KnowledgeID:     knowledge.ID,
-						KnowledgeBaseID: knowledge.KnowledgeBaseID,
-						Content:         img.Caption,
-						ChunkIndex:      maxSeq + i*100 + 2, // 使用不冲突的索引方式
-						IsEnabled:       true,
-						CreatedAt:       time.Now(),
-						UpdatedAt:       time.Now(),
-						StartAt:         int(img.Start),
-						EndAt:           int(img.End),
-						ChunkType:       types.ChunkTypeImageCaption,
-						ParentChunkID:   textChunk.ID,
-						ImageInfo:       string(imageInfoJSON),
-					}
-					insertChunks = append(insertChunks, captionChunk)
-					logger.GetLogger(ctx).Infof("Created caption chunk for image %d in chunk #%d", i, chunkData.Seq)
-				}
-			}
-
-			imageInfoJSON, err := json.Marshal(chunkImages)
-			if err != nil {
-				logger.GetLogger(ctx).WithField("error", err).Errorf("Failed to marshal image info to JSON")
-				continue
-			}
-			textChunk.ImageInfo = string(imageInfoJSON)
-		}
-	}
-
-	// Sort chunks by index for proper ordering
-	sort.Slice(insertChunks, func(i, j int) bool {
-		return insertChunks[i].ChunkIndex < insertChunks[j].ChunkIndex
-	})
-
-	// 仅为文本类型的Chunk设置前后关系
-	textChunks := make([]*types.Chunk, 0, len(chunks))
-	for _, chunk := range insertChunks {
-		if chunk.ChunkType == types.ChunkTypeText {
-			textChunks = append(textChunks, chunk)
-		}
-	}
-
-	// 设置文本Chunk之间的前后关系
-	for i, chunk := range textChunks {
-		if i > 0 {
-			textChunks[i-1].NextChunkID = chunk.ID
-		}
-		if i < len(textChunks)-1 {
-			textChunks[i+1].PreChunkID = chunk.ID
-		}
-	}
-	if enableGraphRAG {
-		relationChunkSize := 5
-		indirectRelationChunkSize := 5
-		graphBuilder := NewGraphBuilder(s.config, chatModel)
-		err = graphBuilder.BuildGraph(ctx, textChunks)
-		if err != nil {
-			logger.GetLogger(ctx).WithField("error", err).Errorf("processChunks build graph failed")
-			span.RecordError(err)
-		} else {
-			for _, chunk := range textChunks {
-				chunk.RelationChunks, _ = json.Marshal(graphBuilder.GetRelationChunks(chunk.ID, relationChunkSize))
-				chunk.IndirectRelationChunks, _ = json.Marshal(graphBuilder.GetIndirectRelationChunks(chunk.ID, indirectRelationChunkSize))
-			}
-			for i, entity := range graphBuilder.GetAllEntities() {
-				relationChunks, _ := json.Marshal(entity.ChunkIDs)
-				entityChunk := &types.Chunk{
-					ID:              entity.ID,
-					TenantID:        knowledge.TenantID,
-					KnowledgeID:     knowledge.ID,
-					KnowledgeBaseID: knowledge.KnowledgeBaseID,
-					Content:         entity.Description,
-					ChunkIndex:      maxSeq + i*100 + 3,
-					IsEnabled:       true,
-					CreatedAt:       time.Now(),
-					UpdatedAt:       time.Now(),
-					ChunkType:       types.ChunkTypeEntity,
-					RelationChunks:  types.JSON(relationChunks),
-				}
-				insertChunks = append(insertChunks, entityChunk)
-			}
-			for i, relationship := range graphBuilder.GetAllRelationships() {
-				relationChunks, _ := json.Marshal(relationship.ChunkIDs)
-				relationshipChunk := &types.Chunk{
-					ID:              relationship.ID,
-					TenantID:        knowledge.TenantID,
-					KnowledgeID:     knowledge.ID,
-					KnowledgeBaseID: knowledge.KnowledgeBaseID,
-					Content:         relationship.Description,
-					ChunkIndex:      maxSeq + i*100 + 4,
-					IsEnabled:       true,
-					CreatedAt:       time.Now(),
-					UpdatedAt:       time.Now(),
-					ChunkType:       types.ChunkTypeRelationship,
-					RelationChunks:  types.JSON(relationChunks),
-				}
-				insertChunks = append(insertChunks, relationshipChunk)
-			}
-		}
-	}
-
-	span.AddEvent("extract summary")
-	summary, err := s.getSummary(ctx, chatModel, knowledge, textChunks)
-	if err != nil {
-		logger.GetLogger(ctx).WithField("knowledge_id", knowledge.ID).
-			WithField("error", err).Errorf("processChunks get summary failed, use first chunk as description")
-		if len(textChunks) > 0 {
-			knowledge.Description = textChunks[0].Content
-		}
-	} else {
-		knowledge.Description = summary
-	}
-	span.SetAttributes(attribute.String("summary", knowledge.Description))
-
-	// 批量索引
-	if strings.TrimSpace(knowledge.Description) != "" && len(textChunks) > 0 {
-		sChunk := &types.Chunk{
-			ID:              uuid.New().String(),
-			TenantID:        knowledge.TenantID,
-			KnowledgeID:     knowledge.ID,
-			KnowledgeBaseID: knowledge.KnowledgeBaseID,
-			Content:         fmt.Sprintf("# 文档名称\n%s\n\n# 摘要\n%s", knowledge.FileName, knowledge.Description),
-			ChunkIndex:      maxSeq + 3, // 使用不冲突的索引方式
-			IsEnabled:       true,
-			CreatedAt:       time.Now(),
-			UpdatedAt:       time.Now(),
-			StartAt:         0,
-			EndAt:           0,
-			ChunkType:       types.ChunkTypeSummary,
-			ParentChunkID:   textChunks[0].ID,
-		}
-		logger.GetLogger(ctx).Infof("Created summary chunk for %s with index %d",
-			sChunk.ParentChunkID, sChunk.ChunkIndex)
-		insertChunks = append(insertChunks, sChunk)
-	}
-
-	// Create index information for each chunk
-	indexInfoList := utils.MapSlice(insertChunks, func(chunk *types.Chunk) *types.IndexInfo {
-		return &types.IndexInfo{
-			Content:         chunk.Content,
-			SourceID:        chunk.ID,
-			SourceType:      types.ChunkSourceType,
-			ChunkID:         chunk.ID,
-			KnowledgeID:     knowledge.ID,
-			KnowledgeBaseID: knowledge.KnowledgeBaseID,
-		}
-	})
-
-	// Initialize retrieval engine
-	tenantInfo := ctx.Value(types.TenantInfoContextKey).(*types.Tenant)
-	retrieveEngine, err := retriever.NewCompositeRetrieveEngine(tenantInfo.RetrieverEngines.Engines)
-	if err != nil {
-		knowledge.ParseStatus = "failed"
-		knowledge.ErrorMessage = err.Error()
-		knowledge.UpdatedAt = time.Now()
-		s.repo.UpdateKnowledge(ctx, knowledge)
-		span.RecordError(err)
-		return
-	}
-
-	// Calculate storage size required for embeddings
-	span.AddEvent("estimate storage size")
-	totalStorageSize := retrieveEngine.EstimateStorageSize(ctx, embeddingModel, indexInfoList)
-	if tenantInfo.StorageQuota > 0 {
-		// Re-fetch tenant storage information
-		tenantInfo, err = s.tenantRepo.GetTenantByID(ctx, tenantInfo.ID)
-		if err != nil {
-			knowledge.ParseStatus = "failed"
-			knowledge.ErrorMessage = err.Error()
-			knowledge.UpdatedAt = time.Now()
-			s.repo.UpdateKnowledge(ctx, knowledge)
-			span.RecordError(err)
-			return
-		}
-		// Check if there's enough storage quota available
-		if tenantInfo.StorageUsed+totalStorageSize > tenantInfo.StorageQuota {
-			knowledge.ParseStatus = "failed"
-			knowledge.ErrorMessage = "存储空间不足"
-			knowledge.UpdatedAt = time.Now()
-			s.repo.UpdateKnowledge(ctx, knowledge)
-			span.RecordError(errors.New("storage quota exceeded"))
-			return
-		}
-	}
-
-	// Save chunks to database
-	span.AddEvent("create chunks")
-	if err := s.chunkService.CreateChunks(ctx, insertChunks); err != nil {
-		knowledge.ParseStatus = "failed"
-		knowledge.ErrorMessage = err.Error()
-		knowledge.UpdatedAt = time.Now()
-		s.repo.UpdateKnowledge(ctx, knowledge)
-		span.RecordError(err)
-		return
-	}
-
-	span.AddEvent("batch index")
-	err = retrieveEngine.BatchIndex(ctx, embeddingModel, indexInfoList)
-	if err != nil {
-		knowledge.ParseStatus = "failed"
-		knowledge.ErrorMessage = err.Error()
-		knowledge.UpdatedAt = time.Now()
-		s.repo.UpdateKnowledge(ctx, knowledge)
-
-		// delete failed chunks
-		if err := s.chunkService.DeleteChunksByKnowledgeID(ctx, knowledge.ID); err != nil {
-			logger.Errorf(ctx, "Delete chunks failed: %v", err)
-		}
-
-		// delete index
-		if err := retrieveEngine.DeleteByKnowledgeIDList(
-			ctx, []string{knowledge.ID}, embeddingModel.GetDimensions(),
-		); err != nil {
-			logger.Errorf(ctx, "Delete index failed: %v", err)
-		}
-		span.RecordError(err)
-		return
-	}
-	logger.GetLogger(ctx).Infof("processChunks batch index successfully, with %d index", len(indexInfoList))
-
-	logger.Infof(ctx, "processChunks create relationship rag task")
-	for _, chunk := range textChunks {
-		err := NewChunkExtractTask(ctx, s.task, chunk.TenantID, chunk.ID, kb.SummaryModelID)
-		if err != nil {
-			logger.GetLogger(ctx).WithField("error", err).Errorf("processChunks create chunk extract task failed")
-			span.RecordError(err)
-		}
-	}
-
-	// Update knowledge status to completed
-	knowledge.ParseStatus = "completed"
-	knowledge.EnableStatus = "enabled"
-	knowledge.StorageSize = totalStorageSize
-	now := time.Now()
-	knowledge.ProcessedAt = &now
-	knowledge.UpdatedAt = now
-	if err := s.repo.UpdateKnowledge(ctx, knowledge); err != nil {
-		logger.GetLogger(ctx).WithField("error", err).Errorf("processChunks update knowledge failed")
-	}
-
-	// Update tenant's storage usage
-	tenantInfo.StorageUsed += totalStorageSize
-	if err := s.tenantRepo.AdjustStorageUsed(ctx, tenantInfo.ID, totalStorageSize); err != nil {
-		logger.GetLogger(ctx).WithField("error", err).Errorf("processChunks update tenant storage used failed")
-	}
-	logger.GetLogger(ctx).Infof("processChunks successfully")
-}
-
-// GetSummary generates a summary for knowledge content using an AI model
-func (s *knowledgeService) getSummary(ctx context.Context,
-	summaryModel chat.Chat, knowledge *types.Knowledge, chunks []*types.Chunk,
-) (string, error) {
-	// Get knowledge info from the first chunk
-	if len(chunks) == 0 {
-		return "", fmt.Errorf("no chunks provided for summary generation")
-	}
-
-	// concat chunk contents
-	chunkContents := ""
-	allImageInfos := make([]*types.ImageInfo, 0)
-
-	// then, sort chunks by StartAt
-	sortedChunks := make([]*types.Chunk, len(chunks))
-	copy(sortedChunks, chunks)
-	sort.Slice(sortedChunks, func(i, j int) bool {
-		return sortedChunks[i].StartAt < sortedChunks[j].StartAt
-	})
-
-	// concat chunk contents and collect image infos
-	for _, chunk := range sortedChunks {
-		if chunk.EndAt > 4096 {
-			break
-		}
-		chunkContents = string([]rune(chunkContents)[:chunk.StartAt]) + chunk.Content
-		if chunk.ImageInfo != "" {
-			var images []*types.ImageInfo
-			if err := json.Unmarshal([]byte(chunk.ImageInfo), &images); err == nil {
-				allImageInfos = append(allImageInfos, images...)
-			}
-		}
-	}
-	// remove markdown image syntax
-	re := regexp.MustCompile(`!\[[^\]]*\]\([^)]+\)`)
-	chunkContents = re.ReplaceAllString(chunkContents, "")
-	// collect all image infos
-	if len(allImageInfos) > 0 {
-		// add image infos to chunk contents
-		var imageAnnotations string
-		for _, img := range allImageInfos {
-			if img.Caption != "" {
-				imageAnnotations += fmt.Sprintf("\n[图片描述: %s]", img.Caption)
-			}
-			if img.OCRText != "" {
-				imageAnnotations += fmt.Sprintf("\n[图片文字: %s]", img.OCRText)
-			}
-		}
-
-		// concat chunk contents and image annotations
-		chunkContents = chunkContents + imageAnnotations
-	}
-
-	if len(chunkContents) < 300 {
-		return chunkContents, nil
-	}
-
-	// Prepare content with metadata for summary generation
-	contentWithMetadata := chunkContents
-
-	// Add knowledge metadata if available
-	if knowledge != nil {
-		metadataIntro := fmt.Sprintf("文档类型: %s\n文件名称: %s\n", knowledge.FileType, knowledge.FileName)
-
-		// Add additional metadata if available
-		if knowledge.Type != "" {
-			metadataIntro += fmt.Sprintf("知识类型: %s\n", knowledge.Type)
-		}
-
-		// Prepend metadata to content
-		contentWithMetadata = metadataIntro + "\n内容:\n" + contentWithMetadata
-	}
-
-	// Generate summary using AI model
-	thinking := false
-	summary, err := summaryModel.Chat(ctx, []chat.Message{
-		{
-			Role:    "system",
-			Content: s.config.Conversation.GenerateSummaryPrompt,
-		},
-		{
-			Role:    "user",
-			Content: contentWithMetadata,
-		},
-	}, &chat.ChatOptions{
-		Temperature: 0.3,
-		MaxTokens:   1024,
-		Thinking:    &thinking,
-	})
-	if err != nil {
-		logger.GetLogger(ctx).WithField("error", err).Errorf("GetSummary failed")
-		return "", err
-	}
-	logger.GetLogger(ctx).WithField("summary", summary.Content).Infof("GetSummary success")
-	return summary.Content, nil
-}
-
 // GetKnowledgeFile retrieves the physical file associated with a knowledge entry
 func (s *knowledgeService) GetKnowledgeFile(ctx context.Context, id string) (io.ReadCloser, string, error) {
 	// Get knowledge record
@@ -1350,6 +826,41 @@ func (s *knowledgeService) UpdateKnowledge(ctx context.Context, knowledge *types
 	return nil
 }
 
+// SetKnowledgeRefreshInterval sets the refresh schedule of a URL knowledge, 0 disables refreshing
+func (s *knowledgeService) SetKnowledgeRefreshInterval(ctx context.Context,
+	id string, interval int,
+) (*types.Knowledge, error) {
+	knowledge, err := s.repo.GetKnowledgeByID(ctx, ctx.Value(types.TenantIDContextKey).(uint), id)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to get knowledge record: %v", err)
+		return nil, err
+	}
+	if knowledge.Type != "url" {
+		logger.Errorf(ctx, "Knowledge %s is not a URL knowledge, type: %s", id, knowledge.Type)
+		return nil, werrors.NewBadRequestError("只有URL类型的知识支持定时刷新")
+	}
+	if interval < 0 || (interval > 0 && interval < MinKnowledgeRefreshInterval) {
+		return nil, werrors.NewBadRequestError(
+			fmt.Sprintf("刷新间隔必须为0或不小于%d分钟", MinKnowledgeRefreshInterval),
+		)
+	}
+
+	now := time.Now()
+	knowledge.RefreshInterval = interval
+	knowledge.NextRefreshAt = nil
+	if interval > 0 {
+		next := now.Add(time.Duration(interval) * time.Minute)
+		knowledge.NextRefreshAt = &next
+	}
+	knowledge.UpdatedAt = now
+	if err := s.repo.UpdateKnowledge(ctx, knowledge); err != nil {
+		logger.Errorf(ctx, "Failed to update knowledge: %v", err)
+		return nil, err
+	}
+	logger.Infof(ctx, "Knowledge refresh interval set, ID: %s, interval: %d minutes", id, interval)
+	return knowledge, nil
+}
+
 // isValidFileType checks if a file type is supported
 func isValidFileType(filename string) bool {
 	switch strings.ToLower(getFileType(filename)) {
@@ -1710,7 +1221,7 @@ func (s *knowledgeService) CloneChunk(ctx context.Context, src, dst *types.Knowl
 	srcTodst := map[string]string{}
 	targetChunks := make([]*types.Chunk, 0, 10)
 	chunkType := []types.ChunkType{
-		types.ChunkTypeText, types.ChunkTypeSummary,
+		types.ChunkTypeText, types.ChunkTypeParentText, types.ChunkTypeSummary,
 		types.ChunkTypeImageCaption, types.ChunkTypeImageOCR,
 	}
 	for {
@@ -0,0 +1,604 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	werrors "github.com/Tencent/WeKnora/internal/errors"
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultGraphNeighborDepth is the default number of relationships walked from an entity
+	DefaultGraphNeighborDepth = 1
+	// MaxGraphNeighborDepth is the maximum number of relationships walked from an entity
+	MaxGraphNeighborDepth = 3
+	// DefaultGraphPathDepth is the default maximum length of a path between two entities
+	DefaultGraphPathDepth = 4
+	// MaxGraphPathDepth is the maximum length of a path between two entities
+	MaxGraphPathDepth = 6
+)
+
+// graphService persists the GraphRAG graph of knowledge bases and answers graph queries
+type graphService struct {
+	repo   interfaces.GraphRepository
+	kbRepo interfaces.KnowledgeBaseRepository
+}
+
+// NewGraphService creates a new knowledge graph service
+func NewGraphService(repo interfaces.GraphRepository,
+	kbRepo interfaces.KnowledgeBaseRepository,
+) interfaces.GraphService {
+	return &graphService{repo: repo, kbRepo: kbRepo}
+}
+
+// SaveKnowledgeGraph replaces the contribution of a knowledge to the graph of its knowledge base,
+// entities are merged with the entities of other knowledge by their normalized title
+func (s *graphService) SaveKnowledgeGraph(ctx context.Context, knowledge *types.Knowledge,
+	entities []*types.Entity, relationships []*types.Relationship,
+) error {
+	logger.Infof(ctx, "Saving knowledge graph, knowledge ID: %s, entities: %d, relationships: %d",
+		knowledge.ID, len(entities), len(relationships))
+	scope := &types.GraphScope{
+		Entities:     newGraphEntities(knowledge.TenantID, knowledge.KnowledgeBaseID, entities),
+		KnowledgeIDs: []string{knowledge.ID},
+	}
+	return s.repo.UpdateGraph(ctx, knowledge.KnowledgeBaseID, scope,
+		func(graph *types.KnowledgeGraph) (*types.GraphChanges, error) {
+			merger := newGraphMerger(graph, knowledge.TenantID, knowledge.KnowledgeBaseID)
+			merger.remove([]string{knowledge.ID})
+			merger.add(knowledge.ID, entities, relationships)
+			return merger.changes(), nil
+		},
+	)
+}
+
+// DeleteKnowledgeGraph removes the contribution of knowledge to the graph of a knowledge base,
+// entities and relationships no other knowledge contributes to are deleted
+func (s *graphService) DeleteKnowledgeGraph(ctx context.Context, knowledgeBaseID string, knowledgeIDs []string) error {
+	if len(knowledgeIDs) == 0 {
+		return nil
+	}
+	return s.repo.UpdateGraph(ctx, knowledgeBaseID, &types.GraphScope{KnowledgeIDs: knowledgeIDs},
+		func(graph *types.KnowledgeGraph) (*types.GraphChanges, error) {
+			merger := newGraphMerger(graph, 0, knowledgeBaseID)
+			merger.remove(knowledgeIDs)
+			return merger.changes(), nil
+		},
+	)
+}
+
+// ListEntities lists the entities of a knowledge base, the most connected first
+func (s *graphService) ListEntities(ctx context.Context,
+	knowledgeBaseID string, keyword string, page *types.Pagination,
+) (*types.PageResult, error) {
+	if err := s.checkKnowledgeBase(ctx, knowledgeBaseID); err != nil {
+		return nil, err
+	}
+	entities, total, err := s.repo.ListEntities(ctx, knowledgeBaseID, keyword, page)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to list graph entities, knowledge base ID: %s, error: %v", knowledgeBaseID, err)
+		return nil, err
+	}
+	return types.NewPageResult(total, page, entities), nil
+}
+
+// GetNeighbors returns the entities within depth relationships of an entity and the relationships between them
+func (s *graphService) GetNeighbors(ctx context.Context,
+	knowledgeBaseID string, entityID string, depth int,
+) (*types.KnowledgeGraph, error) {
+	if err := s.checkKnowledgeBase(ctx, knowledgeBaseID); err != nil {
+		return nil, err
+	}
+	if depth <= 0 {
+		depth = DefaultGraphNeighborDepth
+	}
+	if depth > MaxGraphNeighborDepth {
+		return nil, werrors.NewBadRequestError("Depth must not exceed " + strconv.Itoa(MaxGraphNeighborDepth))
+	}
+	entities, err := s.repo.GetEntitiesByIDs(ctx, knowledgeBaseID, []string{entityID})
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return nil, werrors.NewNotFoundError("Entity not found").WithDetails(entityID)
+	}
+
+	visited := map[string]bool{entityID: true}
+	relationships := make(map[string]*types.GraphRelationship)
+	frontier := []string{entityID}
+	for i := 0; i < depth && len(frontier) > 0; i++ {
+		edges, err := s.repo.ListRelationshipsByEntityIDs(ctx, knowledgeBaseID, frontier)
+		if err != nil {
+			return nil, err
+		}
+		frontier = frontier[:0]
+		for _, edge := range edges {
+			relationships[edge.ID] = edge
+			for _, id := range []string{edge.SourceID, edge.TargetID} {
+				if !visited[id] {
+					visited[id] = true
+					frontier = append(frontier, id)
+				}
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(visited))
+	for id := range visited {
+		ids = append(ids, id)
+	}
+	if entities, err = s.repo.GetEntitiesByIDs(ctx, knowledgeBaseID, ids); err != nil {
+		return nil, err
+	}
+	graph := &types.KnowledgeGraph{Entities: entities, Relationships: make([]*types.GraphRelationship, 0)}
+	for _, relationship := range relationships {
+		graph.Relationships = append(graph.Relationships, relationship)
+	}
+	sortKnowledgeGraph(graph)
+	return graph, nil
+}
+
+// FindPath returns the entities and relationships of a shortest path between two entities,
+// relationships are walked in both directions and an empty graph is returned when no path is found
+func (s *graphService) FindPath(ctx context.Context,
+	knowledgeBaseID string, sourceID string, targetID string, maxDepth int,
+) (*types.KnowledgeGraph, error) {
+	if err := s.checkKnowledgeBase(ctx, knowledgeBaseID); err != nil {
+		return nil, err
+	}
+	if maxDepth <= 0 {
+		maxDepth = DefaultGraphPathDepth
+	}
+	if maxDepth > MaxGraphPathDepth {
+		return nil, werrors.NewBadRequestError("Max depth must not exceed " + strconv.Itoa(MaxGraphPathDepth))
+	}
+	graph, err := s.repo.GetGraph(ctx, knowledgeBaseID)
+	if err != nil {
+		return nil, err
+	}
+	entities := make(map[string]*types.GraphEntity, len(graph.Entities))
+	for _, entity := range graph.Entities {
+		entities[entity.ID] = entity
+	}
+	for _, id := range []string{sourceID, targetID} {
+		if entities[id] == nil {
+			return nil, werrors.NewNotFoundError("Entity not found").WithDetails(id)
+		}
+	}
+
+	adjacency := make(map[string][]*types.GraphRelationship)
+	for _, relationship := range graph.Relationships {
+		adjacency[relationship.SourceID] = append(adjacency[relationship.SourceID], relationship)
+		adjacency[relationship.TargetID] = append(adjacency[relationship.TargetID], relationship)
+	}
+
+	// Breadth first search, via records the relationship each entity was reached through
+	via := map[string]*types.GraphRelationship{sourceID: nil}
+	frontier := []string{sourceID}
+	for depth := 0; depth < maxDepth && len(frontier) > 0 && !hasKey(via, targetID); depth++ {
+		var next []string
+		for _, id := range frontier {
+			for _, relationship := range adjacency[id] {
+				neighbor := relationship.TargetID
+				if neighbor == id {
+					neighbor = relationship.SourceID
+				}
+				if !hasKey(via, neighbor) {
+					via[neighbor] = relationship
+					next = append(next, neighbor)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	path := &types.KnowledgeGraph{
+		Entities:      make([]*types.GraphEntity, 0),
+		Relationships: make([]*types.GraphRelationship, 0),
+	}
+	if !hasKey(via, targetID) {
+		return path, nil
+	}
+	for id := targetID; ; {
+		path.Entities = append(path.Entities, entities[id])
+		relationship := via[id]
+		if relationship == nil {
+			break
+		}
+		path.Relationships = append(path.Relationships, relationship)
+		if relationship.TargetID == id {
+			id = relationship.SourceID
+		} else {
+			id = relationship.TargetID
+		}
+	}
+	slices.Reverse(path.Entities)
+	slices.Reverse(path.Relationships)
+	return path, nil
+}
+
+// ExportGraph writes the whole graph of a knowledge base as JSON or GraphML
+func (s *graphService) ExportGraph(ctx context.Context,
+	knowledgeBaseID string, format types.GraphExportFormat, w io.Writer,
+) error {
+	if format != types.GraphExportFormatJSON && format != types.GraphExportFormatGraphML {
+		return werrors.NewBadRequestError("Unsupported export format").WithDetails(string(format))
+	}
+	if err := s.checkKnowledgeBase(ctx, knowledgeBaseID); err != nil {
+		return err
+	}
+	graph, err := s.repo.GetGraph(ctx, knowledgeBaseID)
+	if err != nil {
+		return err
+	}
+	logger.Infof(ctx, "Exporting knowledge graph, knowledge base ID: %s, format: %s, entities: %d, relationships: %d",
+		knowledgeBaseID, format, len(graph.Entities), len(graph.Relationships))
+	if format == types.GraphExportFormatJSON {
+		return json.NewEncoder(w).Encode(graph)
+	}
+	return writeGraphML(w, knowledgeBaseID, graph)
+}
+
+// checkKnowledgeBase checks that the knowledge base exists and belongs to the tenant of the request
+func (s *graphService) checkKnowledgeBase(ctx context.Context, knowledgeBaseID string) error {
+	kb, err := s.kbRepo.GetKnowledgeBaseByID(ctx, knowledgeBaseID)
+	if err != nil {
+		if errors.Is(err, types.ErrKnowledgeBaseNotFound) {
+			return werrors.NewNotFoundError("Knowledge base not found")
+		}
+		return err
+	}
+	if kb.TenantID != ctx.Value(types.TenantIDContextKey).(uint) {
+		return werrors.NewNotFoundError("Knowledge base not found")
+	}
+	return nil
+}
+
+// graphMerger merges the contributions of knowledge into the part of the graph of a knowledge base they touch
+// and tracks the entities and relationships that need to be saved. The graph holds every relationship of
+// its entities, relationships may lead to entities outside of it
+type graphMerger struct {
+	tenantID        uint
+	knowledgeBaseID string
+	now             time.Time
+
+	entities      map[string]*types.GraphEntity       // Entities by ID
+	entityByKey   map[string]*types.GraphEntity       // Entities by normalized title
+	relationships map[string]*types.GraphRelationship // Relationships by source and target ID
+
+	dirtyEntities      map[string]bool
+	dirtyRelationships map[string]bool
+}
+
+// newGraphMerger creates a merger of the graph of a knowledge base
+func newGraphMerger(graph *types.KnowledgeGraph, tenantID uint, knowledgeBaseID string) *graphMerger {
+	m := &graphMerger{
+		tenantID:           tenantID,
+		knowledgeBaseID:    knowledgeBaseID,
+		now:                time.Now(),
+		entities:           make(map[string]*types.GraphEntity),
+		entityByKey:        make(map[string]*types.GraphEntity),
+		relationships:      make(map[string]*types.GraphRelationship),
+		dirtyEntities:      make(map[string]bool),
+		dirtyRelationships: make(map[string]bool),
+	}
+	for _, entity := range graph.Entities {
+		if entity.Sources == nil {
+			entity.Sources = types.GraphSources{}
+		}
+		m.entities[entity.ID] = entity
+		m.entityByKey[entity.TitleKey] = entity
+	}
+	for _, relationship := range graph.Relationships {
+		if relationship.Sources == nil {
+			relationship.Sources = types.GraphSources{}
+		}
+		m.relationships[relationshipKey(relationship.SourceID, relationship.TargetID)] = relationship
+	}
+	return m
+}
+
+// remove drops the contributions of the knowledge
+func (m *graphMerger) remove(knowledgeIDs []string) {
+	for _, knowledgeID := range knowledgeIDs {
+		for id, entity := range m.entities {
+			if _, ok := entity.Sources[knowledgeID]; ok {
+				delete(entity.Sources, knowledgeID)
+				m.dirtyEntities[id] = true
+			}
+		}
+		for key, relationship := range m.relationships {
+			if _, ok := relationship.Sources[knowledgeID]; ok {
+				delete(relationship.Sources, knowledgeID)
+				m.dirtyRelationships[key] = true
+			}
+		}
+	}
+}
+
+// add merges the entities and relationships extracted from a knowledge
+func (m *graphMerger) add(knowledgeID string, entities []*types.Entity, relationships []*types.Relationship) {
+	for _, extracted := range entities {
+		key := types.NormalizeEntityTitle(extracted.Title)
+		if key == "" {
+			continue
+		}
+		entity := m.entityByKey[key]
+		if entity == nil {
+			entity = newGraphEntity(m.tenantID, m.knowledgeBaseID, extracted.Title, m.now)
+			m.entities[entity.ID] = entity
+			m.entityByKey[key] = entity
+		}
+		source := entity.Sources[knowledgeID]
+		if source == nil {
+			source = &types.GraphSource{}
+			entity.Sources[knowledgeID] = source
+		}
+		source.ChunkIDs = mergeIDs(source.ChunkIDs, extracted.ChunkIDs)
+		if len(extracted.Description) > len(source.Description) {
+			source.Type = extracted.Type
+			source.Description = extracted.Description
+		}
+		m.dirtyEntities[entity.ID] = true
+	}
+
+	for _, extracted := range relationships {
+		// Both ends must be entities of the same knowledge, so that removing a knowledge never leaves
+		// relationships to entities it was the only contributor of
+		source := m.entityByKey[types.NormalizeEntityTitle(extracted.Source)]
+		target := m.entityByKey[types.NormalizeEntityTitle(extracted.Target)]
+		if source == nil || target == nil || source.ID == target.ID ||
+			source.Sources[knowledgeID] == nil || target.Sources[knowledgeID] == nil {
+			continue
+		}
+		key := relationshipKey(source.ID, target.ID)
+		relationship := m.relationships[key]
+		if relationship == nil {
+			relationship = &types.GraphRelationship{
+				ID:              uuid.New().String(),
+				TenantID:        m.tenantID,
+				KnowledgeBaseID: m.knowledgeBaseID,
+				SourceID:        source.ID,
+				TargetID:        target.ID,
+				Sources:         types.GraphSources{},
+				CreatedAt:       m.now,
+			}
+			m.relationships[key] = relationship
+		}
+		contribution := relationship.Sources[knowledgeID]
+		if contribution == nil {
+			contribution = &types.GraphSource{}
+			relationship.Sources[knowledgeID] = contribution
+		}
+		contribution.ChunkIDs = mergeIDs(contribution.ChunkIDs, extracted.ChunkIDs)
+		contribution.Strength = extracted.Strength
+		if len(extracted.Description) > len(contribution.Description) {
+			contribution.Description = extracted.Description
+		}
+		m.dirtyRelationships[key] = true
+	}
+}
+
+// changes returns the changes to save, entities and relationships without any contribution are deleted
+// and the degree of every entity is recomputed
+func (m *graphMerger) changes() *types.GraphChanges {
+	changes := &types.GraphChanges{}
+	deleted := make(map[string]bool)
+	for id := range m.dirtyEntities {
+		if len(m.entities[id].Sources) == 0 {
+			changes.DeleteEntityIDs = append(changes.DeleteEntityIDs, id)
+			deleted[id] = true
+			delete(m.entityByKey, m.entities[id].TitleKey)
+			delete(m.entities, id)
+		}
+	}
+
+	degrees := make(map[string]int)
+	for key, relationship := range m.relationships {
+		if len(relationship.Sources) == 0 || deleted[relationship.SourceID] || deleted[relationship.TargetID] {
+			changes.DeleteRelationshipIDs = append(changes.DeleteRelationshipIDs, relationship.ID)
+			delete(m.relationships, key)
+			continue
+		}
+		degrees[relationship.SourceID]++
+		degrees[relationship.TargetID]++
+		if m.dirtyRelationships[key] {
+			relationship.Refresh()
+			relationship.UpdatedAt = m.now
+			changes.SaveRelationships = append(changes.SaveRelationships, relationship)
+		}
+	}
+
+	for id, entity := range m.entities {
+		if entity.Degree != degrees[id] {
+			entity.Degree = degrees[id]
+			m.dirtyEntities[id] = true
+		}
+		if m.dirtyEntities[id] {
+			entity.Refresh()
+			entity.UpdatedAt = m.now
+			changes.SaveEntities = append(changes.SaveEntities, entity)
+		}
+	}
+
+	slices.Sort(changes.DeleteEntityIDs)
+	slices.Sort(changes.DeleteRelationshipIDs)
+	slices.SortFunc(changes.SaveEntities, func(a, b *types.GraphEntity) int { return strings.Compare(a.ID, b.ID) })
+	slices.SortFunc(changes.SaveRelationships, func(a, b *types.GraphRelationship) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return changes
+}
+
+// newGraphEntities returns the entities of the extracted entities, one per normalized title
+func newGraphEntities(tenantID uint, knowledgeBaseID string, entities []*types.Entity) []*types.GraphEntity {
+	now := time.Now()
+	byKey := make(map[string]bool, len(entities))
+	graphEntities := make([]*types.GraphEntity, 0, len(entities))
+	for _, extracted := range entities {
+		entity := newGraphEntity(tenantID, knowledgeBaseID, extracted.Title, now)
+		if entity.TitleKey == "" || byKey[entity.TitleKey] {
+			continue
+		}
+		byKey[entity.TitleKey] = true
+		graphEntities = append(graphEntities, entity)
+	}
+	return graphEntities
+}
+
+// newGraphEntity returns an entity without contributions
+func newGraphEntity(tenantID uint, knowledgeBaseID string, title string, now time.Time) *types.GraphEntity {
+	return &types.GraphEntity{
+		ID:              uuid.New().String(),
+		TenantID:        tenantID,
+		KnowledgeBaseID: knowledgeBaseID,
+		Title:           strings.TrimSpace(title),
+		TitleKey:        types.NormalizeEntityTitle(title),
+		ChunkIDs:        types.StringArray{},
+		KnowledgeIDs:    types.StringArray{},
+		Sources:         types.GraphSources{},
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+}
+
+// relationshipKey returns the key of the relationship between two entities
+func relationshipKey(sourceID, targetID string) string {
+	return sourceID + "#" + targetID
+}
+
+// mergeIDs returns the union of two ID lists
+func mergeIDs(ids []string, more []string) []string {
+	for _, id := range more {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// hasKey reports whether the map contains the key
+func hasKey[K comparable, V any](m map[K]V, key K) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// sortKnowledgeGraph sorts entities by degree and relationships by strength, both descending
+func sortKnowledgeGraph(graph *types.KnowledgeGraph) {
+	slices.SortFunc(graph.Entities, func(a, b *types.GraphEntity) int {
+		if a.Degree != b.Degree {
+			return b.Degree - a.Degree
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	slices.SortFunc(graph.Relationships, func(a, b *types.GraphRelationship) int {
+		if a.Strength != b.Strength {
+			return b.Strength - a.Strength
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
+
+// graphML is the root element of a GraphML document
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+// graphMLKey declares an attribute of the nodes or edges
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+// graphMLGraph is the graph element of a GraphML document
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+// graphMLNode is a node of a GraphML graph
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+// graphMLEdge is an edge of a GraphML graph
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+// graphMLData is an attribute value of a node or edge
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// writeGraphML writes the graph as a GraphML document
+func writeGraphML(w io.Writer, knowledgeBaseID string, graph *types.KnowledgeGraph) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "title", For: "node", AttrName: "title", AttrType: "string"},
+			{ID: "type", For: "node", AttrName: "type", AttrType: "string"},
+			{ID: "description", For: "node", AttrName: "description", AttrType: "string"},
+			{ID: "frequency", For: "node", AttrName: "frequency", AttrType: "int"},
+			{ID: "degree", For: "node", AttrName: "degree", AttrType: "int"},
+			{ID: "relationship_description", For: "edge", AttrName: "description", AttrType: "string"},
+			{ID: "strength", For: "edge", AttrName: "strength", AttrType: "int"},
+		},
+		Graph: graphMLGraph{ID: knowledgeBaseID, EdgeDefault: "directed"},
+	}
+	for _, entity := range graph.Entities {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: entity.ID,
+			Data: []graphMLData{
+				{Key: "title", Value: entity.Title},
+				{Key: "type", Value: entity.Type},
+				{Key: "description", Value: entity.Description},
+				{Key: "frequency", Value: strconv.Itoa(entity.Frequency)},
+				{Key: "degree", Value: strconv.Itoa(entity.Degree)},
+			},
+		})
+	}
+	for _, relationship := range graph.Relationships {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     relationship.ID,
+			Source: relationship.SourceID,
+			Target: relationship.TargetID,
+			Data: []graphMLData{
+				{Key: "relationship_description", Value: relationship.Description},
+				{Key: "strength", Value: strconv.Itoa(relationship.Strength)},
+			},
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	return encoder.Flush()
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// mergeKnowledge merges the extraction of a knowledge into the graph and returns the changes
+func mergeKnowledge(graph *types.KnowledgeGraph, knowledgeID string,
+	entities []*types.Entity, relationships []*types.Relationship,
+) *types.GraphChanges {
+	merger := newGraphMerger(graph, 1, "kb")
+	merger.remove([]string{knowledgeID})
+	merger.add(knowledgeID, entities, relationships)
+	return merger.changes()
+}
+
+// savedGraph returns the graph made of the saved entities and relationships
+func savedGraph(changes *types.GraphChanges) *types.KnowledgeGraph {
+	return &types.KnowledgeGraph{Entities: changes.SaveEntities, Relationships: changes.SaveRelationships}
+}
+
+func TestGraphMergerAdd(t *testing.T) {
+	changes := mergeKnowledge(&types.KnowledgeGraph{}, "k1",
+		[]*types.Entity{
+			{Title: "Tencent", Type: "organization", Description: "A company", ChunkIDs: []string{"c1"}},
+			{Title: " tencent ", Description: "A technology company", ChunkIDs: []string{"c2"}},
+			{Title: "WeKnora", Type: "software", ChunkIDs: []string{"c1"}},
+			{Title: "   "},
+		},
+		[]*types.Relationship{
+			{Source: "Tencent", Target: "weknora", Description: "develops", Strength: 8, ChunkIDs: []string{"c1"}},
+			{Source: "Tencent", Target: "Unknown", Strength: 5},
+			{Source: "WeKnora", Target: "WEKNORA", Strength: 5},
+		},
+	)
+
+	if len(changes.SaveEntities) != 2 || len(changes.DeleteEntityIDs) != 0 {
+		t.Fatalf("Expected 2 entities saved, got %d saved and %d deleted",
+			len(changes.SaveEntities), len(changes.DeleteEntityIDs))
+	}
+	entities := make(map[string]*types.GraphEntity)
+	for _, entity := range changes.SaveEntities {
+		entities[entity.TitleKey] = entity
+	}
+	tencent := entities["tencent"]
+	if tencent == nil || tencent.Title != "Tencent" || tencent.Description != "A technology company" {
+		t.Fatalf("Expected entities merged by normalized title, got %+v", tencent)
+	}
+	if !reflect.DeepEqual([]string(tencent.ChunkIDs), []string{"c1", "c2"}) || tencent.Frequency != 2 {
+		t.Errorf("Expected the chunks of both mentions, got %v", tencent.ChunkIDs)
+	}
+	if tencent.Degree != 1 || entities["weknora"].Degree != 1 {
+		t.Errorf("Expected a degree of 1, got %d and %d", tencent.Degree, entities["weknora"].Degree)
+	}
+
+	if len(changes.SaveRelationships) != 1 {
+		t.Fatalf("Expected 1 relationship saved, got %d", len(changes.SaveRelationships))
+	}
+	relationship := changes.SaveRelationships[0]
+	if relationship.SourceID != tencent.ID || relationship.TargetID != entities["weknora"].ID ||
+		relationship.Strength != 8 || !reflect.DeepEqual([]string(relationship.KnowledgeIDs), []string{"k1"}) {
+		t.Errorf("Unexpected relationship %+v", relationship)
+	}
+}
+
+func TestGraphMergerSharedEntities(t *testing.T) {
+	entities := []*types.Entity{
+		{Title: "Tencent", Description: "A company", ChunkIDs: []string{"c1"}},
+		{Title: "WeKnora", ChunkIDs: []string{"c1"}},
+	}
+	relationships := []*types.Relationship{{Source: "Tencent", Target: "WeKnora", Strength: 8, ChunkIDs: []string{"c1"}}}
+	first := mergeKnowledge(&types.KnowledgeGraph{}, "k1", entities, relationships)
+
+	second := mergeKnowledge(savedGraph(first), "k2",
+		[]*types.Entity{
+			{Title: "TENCENT", Description: "A company based in Shenzhen", ChunkIDs: []string{"c9"}},
+			{Title: "WeKnora", ChunkIDs: []string{"c9"}},
+		},
+		[]*types.Relationship{{Source: "tencent", Target: "weknora", Strength: 4, ChunkIDs: []string{"c9"}}},
+	)
+	if len(second.SaveEntities) != 2 || len(second.SaveRelationships) != 1 {
+		t.Fatalf("Expected the entities and relationship to be updated, got %d and %d",
+			len(second.SaveEntities), len(second.SaveRelationships))
+	}
+	relationship := second.SaveRelationships[0]
+	if relationship.ID != first.SaveRelationships[0].ID || relationship.Strength != 6 {
+		t.Errorf("Expected the relationship to be merged with an average strength, got %+v", relationship)
+	}
+	for _, entity := range second.SaveEntities {
+		if !reflect.DeepEqual([]string(entity.KnowledgeIDs), []string{"k1", "k2"}) {
+			t.Errorf("Expected the entity to keep both knowledge, got %v", entity.KnowledgeIDs)
+		}
+		if entity.TitleKey == "tencent" && entity.Description != "A company based in Shenzhen" {
+			t.Errorf("Expected the most detailed description, got %s", entity.Description)
+		}
+	}
+
+	// Removing one of the knowledge keeps the entities and relationship of the other
+	merger := newGraphMerger(savedGraph(second), 0, "kb")
+	merger.remove([]string{"k2"})
+	changes := merger.changes()
+	if len(changes.DeleteEntityIDs) != 0 || len(changes.DeleteRelationshipIDs) != 0 {
+		t.Fatalf("Expected nothing deleted, got %v and %v", changes.DeleteEntityIDs, changes.DeleteRelationshipIDs)
+	}
+	if changes.SaveRelationships[0].Strength != 8 {
+		t.Errorf("Expected the strength of the remaining knowledge, got %d", changes.SaveRelationships[0].Strength)
+	}
+}
+
+func TestGraphMergerRemove(t *testing.T) {
+	first := mergeKnowledge(&types.KnowledgeGraph{}, "k1",
+		[]*types.Entity{{Title: "Tencent", ChunkIDs: []string{"c1"}}, {Title: "WeKnora", ChunkIDs: []string{"c1"}}},
+		[]*types.Relationship{{Source: "Tencent", Target: "WeKnora", Strength: 8}},
+	)
+
+	merger := newGraphMerger(savedGraph(first), 0, "kb")
+	merger.remove([]string{"k1"})
+	changes := merger.changes()
+	if len(changes.DeleteEntityIDs) != 2 || len(changes.DeleteRelationshipIDs) != 1 {
+		t.Errorf("Expected the entities and relationship to be deleted, got %v and %v",
+			changes.DeleteEntityIDs, changes.DeleteRelationshipIDs)
+	}
+	if len(changes.SaveEntities) != 0 || len(changes.SaveRelationships) != 0 {
+		t.Errorf("Expected nothing saved, got %d and %d", len(changes.SaveEntities), len(changes.SaveRelationships))
+	}
+}
+
+func TestGraphMergerPartialGraph(t *testing.T) {
+	// The graph only holds the entities of the knowledge, the relationship leads to an entity outside of it
+	graph := &types.KnowledgeGraph{
+		Entities: []*types.GraphEntity{{
+			ID:       "e1",
+			Title:    "Tencent",
+			TitleKey: "tencent",
+			Degree:   1,
+			Sources: types.GraphSources{
+				"k1": {ChunkIDs: []string{"c1"}},
+				"k2": {ChunkIDs: []string{"c2"}},
+			},
+		}},
+		Relationships: []*types.GraphRelationship{{
+			ID:       "r1",
+			SourceID: "e1",
+			TargetID: "e2",
+			Sources:  types.GraphSources{"k2": {ChunkIDs: []string{"c2"}, Strength: 5}},
+		}},
+	}
+	merger := newGraphMerger(graph, 0, "kb")
+	merger.remove([]string{"k1"})
+	changes := merger.changes()
+
+	if len(changes.DeleteRelationshipIDs) != 0 || len(changes.DeleteEntityIDs) != 0 {
+		t.Fatalf("Expected the relationship to an entity outside of the graph to be kept, got %v",
+			changes.DeleteRelationshipIDs)
+	}
+	if len(changes.SaveEntities) != 1 || changes.SaveEntities[0].Degree != 1 {
+		t.Errorf("Expected the entity to be saved with its degree, got %+v", changes.SaveEntities)
+	}
+	if len(changes.SaveRelationships) != 0 {
+		t.Errorf("Expected the untouched relationship not to be saved, got %d", len(changes.SaveRelationships))
+	}
+}
+
+func TestNewGraphEntities(t *testing.T) {
+	entities := newGraphEntities(1, "kb", []*types.Entity{
+		{Title: " Tencent "},
+		{Title: "tencent"},
+		{Title: ""},
+		{Title: "WeKnora"},
+	})
+	if len(entities) != 2 {
+		t.Fatalf("Expected one entity per title key, got %d", len(entities))
+	}
+	if entities[0].Title != "Tencent" || entities[0].TitleKey != "tencent" || entities[0].KnowledgeBaseID != "kb" {
+		t.Errorf("Unexpected entity %+v", entities[0])
+	}
+	if entities[0].Sources == nil || entities[0].ID == entities[1].ID {
+		t.Errorf("Expected entities without contributions and with their own ID")
+	}
+}
@@ -0,0 +1,1244 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/application/service/retriever"
+	"github.com/Tencent/WeKnora/internal/config"
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/models/chat"
+	"github.com/Tencent/WeKnora/internal/models/embedding"
+	"github.com/Tencent/WeKnora/internal/models/utils"
+	"github.com/Tencent/WeKnora/internal/tracing"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/Tencent/WeKnora/services/docreader/src/client"
+	"github.com/Tencent/WeKnora/services/docreader/src/proto"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// knowledgeTaskMaxRetry is the maximum number of retries of every ingestion stage
+const knowledgeTaskMaxRetry = 5
+
+// ErrStorageQuotaExceeded is returned when the embeddings of a knowledge exceed the tenant storage quota
+var ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+// errEmbeddingModelChanged retries an embed stage whose knowledge base switched embedding model meanwhile
+var errEmbeddingModelChanged = errors.New("embedding model of the knowledge base changed")
+
+// knowledgeStageTasks maps every ingestion stage to its asynq task type
+var knowledgeStageTasks = map[types.KnowledgeProcessStage]string{
+	types.KnowledgeStageParse:     types.TypeKnowledgeParse,
+	types.KnowledgeStageEmbed:     types.TypeKnowledgeEmbed,
+	types.KnowledgeStageSummarize: types.TypeKnowledgeSummarize,
+	types.KnowledgeStageGraph:     types.TypeKnowledgeGraph,
+}
+
+// NewKnowledgeProcessTask enqueues the task of the given ingestion stage
+func NewKnowledgeProcessTask(ctx context.Context, client *asynq.Client,
+	stage types.KnowledgeProcessStage, payload *types.KnowledgeProcessPayload,
+) error {
+	taskType, ok := knowledgeStageTasks[stage]
+	if !ok {
+		return fmt.Errorf("unknown knowledge process stage: %s", stage)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	task := asynq.NewTask(taskType, data, asynq.MaxRetry(knowledgeTaskMaxRetry))
+	info, err := client.Enqueue(task)
+	if err != nil {
+		logger.Errorf(ctx, "failed to enqueue task: %v", err)
+		return fmt.Errorf("failed to enqueue task: %v", err)
+	}
+	logger.Infof(ctx, "enqueued task: id=%s queue=%s stage=%s knowledge=%s",
+		info.ID, info.Queue, stage, payload.KnowledgeID)
+	return nil
+}
+
+// knowledgeProcessService runs the knowledge ingestion stages as persisted asynq tasks
+type knowledgeProcessService struct {
+	config          *config.Config
+	repo            interfaces.KnowledgeRepository
+	kbRepo          interfaces.KnowledgeBaseRepository
+	tenantRepo      interfaces.TenantRepository
+	docReaderClient *client.Client
+	chunkRepo       interfaces.ChunkRepository
+	fileSvc         interfaces.FileService
+	modelService    interfaces.ModelService
+	graphService    interfaces.GraphService
+	graphEngine     interfaces.RetrieveGraphRepository
+	task            *asynq.Client
+	httpClient      *http.Client
+}
+
+// NewKnowledgeProcessService creates a new knowledge process service
+func NewKnowledgeProcessService(
+	config *config.Config,
+	repo interfaces.KnowledgeRepository,
+	kbRepo interfaces.KnowledgeBaseRepository,
+	tenantRepo interfaces.TenantRepository,
+	docReaderClient *client.Client,
+	chunkRepo interfaces.ChunkRepository,
+	fileSvc interfaces.FileService,
+	modelService interfaces.ModelService,
+	graphService interfaces.GraphService,
+	graphEngine interfaces.RetrieveGraphRepository,
+	task *asynq.Client,
+) interfaces.KnowledgeProcessor {
+	return &knowledgeProcessService{
+		config:          config,
+		repo:            repo,
+		kbRepo:          kbRepo,
+		tenantRepo:      tenantRepo,
+		docReaderClient: docReaderClient,
+		chunkRepo:       chunkRepo,
+		fileSvc:         fileSvc,
+		modelService:    modelService,
+		graphService:    graphService,
+		graphEngine:     graphEngine,
+		task:            task,
+		httpClient:      newURLFetchClient(),
+	}
+}
+
+// knowledgeTask holds everything an ingestion stage needs
+type knowledgeTask struct {
+	payload   *types.KnowledgeProcessPayload
+	knowledge *types.Knowledge
+	kb        *types.KnowledgeBase
+	tenant    *types.Tenant
+}
+
+// prepare decodes the task payload and rebuilds the request context of the ingestion
+// It returns a nil task when the knowledge no longer exists
+func (s *knowledgeProcessService) prepare(ctx context.Context,
+	t *asynq.Task,
+) (context.Context, *knowledgeTask, error) {
+	var p types.KnowledgeProcessPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		logger.Errorf(ctx, "failed to unmarshal task payload: %v", err)
+		return ctx, nil, fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+	}
+	if p.RequestID == "" {
+		p.RequestID = uuid.New().String()
+	}
+	ctx = logger.WithRequestID(ctx, p.RequestID)
+	ctx = logger.WithField(ctx, "knowledge", p.KnowledgeID)
+	ctx = context.WithValue(ctx, types.RequestIDContextKey, p.RequestID)
+	ctx = context.WithValue(ctx, types.TenantIDContextKey, p.TenantID)
+	ctx = context.WithValue(ctx, types.KnowledgeIDContextKey, p.KnowledgeID)
+
+	tenant, err := s.tenantRepo.GetTenantByID(ctx, p.TenantID)
+	if err != nil {
+		logger.Errorf(ctx, "failed to get tenant: %v", err)
+		return ctx, nil, err
+	}
+	ctx = context.WithValue(ctx, types.TenantInfoContextKey, tenant)
+
+	knowledge, err := s.repo.GetKnowledgeByID(ctx, p.TenantID, p.KnowledgeID)
+	if errors.Is(err, types.ErrKnowledgeNotFound) {
+		// The knowledge was deleted, the task has nothing left to do
+		logger.Warnf(ctx, "ignore task of knowledge %s: %v", p.KnowledgeID, err)
+		return ctx, nil, nil
+	}
+	if err != nil {
+		logger.Errorf(ctx, "failed to get knowledge: %v", err)
+		return ctx, nil, err
+	}
+	kb, err := s.kbRepo.GetKnowledgeBaseByID(ctx, knowledge.KnowledgeBaseID)
+	if err != nil {
+		logger.Errorf(ctx, "failed to get knowledge base: %v", err)
+		return ctx, nil, err
+	}
+	return ctx, &knowledgeTask{payload: &p, knowledge: knowledge, kb: kb, tenant: tenant}, nil
+}
+
+// startStage records the beginning of an attempt of the given stage
+func (s *knowledgeProcessService) startStage(ctx context.Context,
+	knowledge *types.Knowledge, stage types.KnowledgeProcessStage,
+) error {
+	now := time.Now()
+	retried, _ := asynq.GetRetryCount(ctx)
+	progress := knowledge.Stage(stage)
+	progress.Status = "processing"
+	progress.Attempts = retried + 1
+	progress.Error = ""
+	progress.StartedAt = &now
+	progress.FinishedAt = nil
+	knowledge.ParseStatus = "processing"
+	knowledge.ProcessStage = stage
+	knowledge.ErrorMessage = ""
+	knowledge.UpdatedAt = now
+	return s.repo.UpdateKnowledge(ctx, knowledge)
+}
+
+// finishStage marks the given stage as completed and enqueues the next stage if any
+func (s *knowledgeProcessService) finishStage(ctx context.Context, task *knowledgeTask,
+	stage types.KnowledgeProcessStage, next types.KnowledgeProcessStage,
+) error {
+	now := time.Now()
+	progress := task.knowledge.Stage(stage)
+	progress.Status = "completed"
+	progress.FinishedAt = &now
+	task.knowledge.UpdatedAt = now
+	if err := s.repo.UpdateKnowledge(ctx, task.knowledge); err != nil {
+		return err
+	}
+	if next == "" {
+		return nil
+	}
+	return NewKnowledgeProcessTask(ctx, s.task, next, task.payload)
+}
+
+// failStage records a failed attempt of the given stage
+// The knowledge is marked as failed once the stage will not be retried any more
+func (s *knowledgeProcessService) failStage(ctx context.Context,
+	knowledge *types.Knowledge, stage types.KnowledgeProcessStage, err error, final bool,
+) error {
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, ok := asynq.GetMaxRetry(ctx)
+	final = final || (ok && retried >= maxRetry)
+
+	logger.GetLogger(ctx).WithField("stage", stage).WithField("final", final).
+		WithField("error", err).Errorf("knowledge process stage failed")
+	now := time.Now()
+	progress := knowledge.Stage(stage)
+	progress.Status = "processing"
+	progress.Error = err.Error()
+	knowledge.UpdatedAt = now
+	if final {
+		progress.Status = "failed"
+		progress.FinishedAt = &now
+		knowledge.ParseStatus = "failed"
+		knowledge.ErrorMessage = err.Error()
+	}
+	if uerr := s.repo.UpdateKnowledge(ctx, knowledge); uerr != nil {
+		logger.GetLogger(ctx).WithField("error", uerr).Errorf("failStage update knowledge failed")
+	}
+	if final {
+		return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+	}
+	return err
+}
+
+// Parse reads the source document of the knowledge and persists its chunks
+func (s *knowledgeProcessService) Parse(ctx context.Context, t *asynq.Task) error {
+	ctx, task, err := s.prepare(ctx, t)
+	if err != nil || task == nil {
+		return err
+	}
+	knowledge, kb := task.knowledge, task.kb
+	stage := types.KnowledgeStageParse
+
+	ctx, span := tracing.ContextWithSpan(ctx, "knowledgeProcessService.Parse")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("request_id", task.payload.RequestID),
+		attribute.String("knowledge_base_id", kb.ID),
+		attribute.Int("tenant_id", int(kb.TenantID)),
+		attribute.String("knowledge_id", knowledge.ID),
+		attribute.String("knowledge_type", knowledge.Type),
+		attribute.String("file_name", knowledge.FileName),
+		attribute.String("file_type", knowledge.FileType),
+		attribute.Bool("enable_multimodal", task.payload.EnableMultimodel),
+	)
+
+	if !task.payload.EnableMultimodel && IsImageType(knowledge.FileType) {
+		span.RecordError(ErrImageNotParse)
+		return s.failStage(ctx, knowledge, stage, ErrImageNotParse, true)
+	}
+	if err := s.startStage(ctx, knowledge, stage); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	chunks, err := s.readDocument(ctx, task)
+	if err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+
+	// Passages are chunked by the caller
+	if knowledge.Type != "passage" && kb.ChunkingConfig.Strategy == types.ChunkingStrategySemantic {
+		embeddingModel, err := s.modelService.GetEmbeddingModel(ctx, kb.EmbeddingModelID)
+		if err != nil {
+			span.RecordError(err)
+			return s.failStage(ctx, knowledge, stage, err, false)
+		}
+		if chunks, err = semanticChunks(ctx, embeddingModel, kb.ChunkingConfig, chunks); err != nil {
+			span.RecordError(err)
+			return s.failStage(ctx, knowledge, stage, err, false)
+		}
+	}
+	insertChunks := s.buildChunks(ctx, knowledge, chunks)
+	if knowledge.Type != "passage" && kb.ChunkingConfig.Strategy == types.ChunkingStrategyParentChild {
+		insertChunks = splitParentChunks(knowledge, kb.ChunkingConfig, insertChunks)
+	}
+	span.SetAttributes(attribute.Int("chunk_count", len(insertChunks)))
+	if task.payload.Generation != 0 {
+		// Replaced content keeps the unchanged chunks and their index
+		if err := s.replaceChunks(ctx, task, insertChunks); err != nil {
+			span.RecordError(err)
+			return s.failStage(ctx, knowledge, stage, err, false)
+		}
+	} else {
+		// Drop the chunks written by a previous attempt and the graph extracted from them
+		// before persisting the new ones
+		if err := s.chunkRepo.DeleteChunksByKnowledgeID(ctx, knowledge.TenantID, knowledge.ID); err != nil {
+			span.RecordError(err)
+			return s.failStage(ctx, knowledge, stage, err, false)
+		}
+		namespace := types.NameSpace{KnowledgeBase: knowledge.KnowledgeBaseID, Knowledge: knowledge.ID}
+		if err := s.graphEngine.DelGraph(ctx, []types.NameSpace{namespace}); err != nil {
+			span.RecordError(err)
+			return s.failStage(ctx, knowledge, stage, err, false)
+		}
+		if err := s.chunkRepo.CreateChunks(ctx, insertChunks); err != nil {
+			span.RecordError(err)
+			return s.failStage(ctx, knowledge, stage, err, false)
+		}
+	}
+
+	if err := s.finishStage(ctx, task, stage, types.KnowledgeStageEmbed); err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+	logger.Infof(ctx, "Parse knowledge successfully, with %d chunks", len(insertChunks))
+	return nil
+}
+
+// readDocument splits the source of the knowledge into chunks through the document reader
+func (s *knowledgeProcessService) readDocument(ctx context.Context, task *knowledgeTask) ([]*proto.Chunk, error) {
+	knowledge, kb := task.knowledge, task.kb
+	switch knowledge.Type {
+	case "file":
+		f, err := s.fileSvc.GetFile(ctx, knowledge.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		contentBytes, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.docReaderClient.ReadFromFile(ctx, &proto.ReadFromFileRequest{
+			FileContent: contentBytes,
+			FileName:    knowledge.FileName,
+			FileType:    knowledge.FileType,
+			ReadConfig:  newReadConfig(kb, task.payload.EnableMultimodel),
+			RequestId:   task.payload.RequestID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return resp.Chunks, nil
+	case "url":
+		if knowledge.ETag == "" && knowledge.ContentHash == "" {
+			s.recordURLState(ctx, knowledge)
+		}
+		resp, err := s.docReaderClient.ReadFromURL(ctx, &proto.ReadFromURLRequest{
+			Url:        knowledge.Source,
+			Title:      knowledge.Title,
+			ReadConfig: newReadConfig(kb, task.payload.EnableMultimodel),
+			RequestId:  task.payload.RequestID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return resp.Chunks, nil
+	case "passage":
+		return passageToChunks(task.payload.Passages), nil
+	default:
+		return nil, fmt.Errorf("unsupported knowledge type: %s", knowledge.Type)
+	}
+}
+
+// recordURLState records the ETag and content hash of the source a URL knowledge is ingested from,
+// the refresh of the knowledge compares the source against them to detect changes
+func (s *knowledgeProcessService) recordURLState(ctx context.Context, knowledge *types.Knowledge) {
+	etag, contentHash, _, err := fetchURL(ctx, s.httpClient, knowledge)
+	if err != nil {
+		logger.Warnf(ctx, "Failed to fetch the content hash of %s: %v", knowledge.Source, err)
+		return
+	}
+	now := time.Now()
+	if err := s.repo.UpdateKnowledgeColumns(ctx, knowledge.ID, map[string]interface{}{
+		"etag":            etag,
+		"content_hash":    contentHash,
+		"last_checked_at": now,
+	}); err != nil {
+		logger.Errorf(ctx, "Failed to update knowledge, ID: %s, error: %v", knowledge.ID, err)
+		return
+	}
+	knowledge.ETag = etag
+	knowledge.ContentHash = contentHash
+	knowledge.LastCheckedAt = &now
+}
+
+// newReadConfig builds the document reader configuration of a knowledge base
+func newReadConfig(kb *types.KnowledgeBase, enableMultimodel bool) *proto.ReadConfig {
+	strategy, chunkSize := readerChunking(kb.ChunkingConfig)
+	return &proto.ReadConfig{
+		ChunkSize:        int32(chunkSize),
+		ChunkOverlap:     int32(kb.ChunkingConfig.ChunkOverlap),
+		Separators:       kb.ChunkingConfig.Separators,
+		EnableMultimodal: enableMultimodel,
+		ChunkingStrategy: string(strategy),
+		StorageConfig: &proto.StorageConfig{
+			Provider:        proto.StorageProvider(proto.StorageProvider_value[strings.ToUpper(kb.StorageConfig.Provider)]),
+			Region:          kb.StorageConfig.Region,
+			BucketName:      kb.StorageConfig.BucketName,
+			AccessKeyId:     kb.StorageConfig.SecretID,
+			SecretAccessKey: kb.StorageConfig.SecretKey,
+			AppId:           kb.StorageConfig.AppID,
+			PathPrefix:      kb.StorageConfig.PathPrefix,
+		},
+		VlmConfig: &proto.VLMConfig{
+			ModelName:     kb.VLMConfig.ModelName,
+			BaseUrl:       kb.VLMConfig.BaseURL,
+			ApiKey:        kb.VLMConfig.APIKey,
+			InterfaceType: kb.VLMConfig.InterfaceType,
+		},
+	}
+}
+
+// passageToChunks converts text passages to chunks
+func passageToChunks(passage []string) []*proto.Chunk {
+	chunks := make([]*proto.Chunk, 0, len(passage))
+	start, end := 0, 0
+	for i, p := range passage {
+		if p == "" {
+			continue
+		}
+		end += len([]rune(p))
+		chunk := &proto.Chunk{
+			Content: p,
+			Seq:     int32(i),
+			Start:   int32(start),
+			End:     int32(end),
+		}
+		start = end
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// buildChunks creates text and image chunks from the document reader output
+// and links the text chunks to their neighbours
+func (s *knowledgeProcessService) buildChunks(ctx context.Context,
+	knowledge *types.Knowledge, chunks []*proto.Chunk,
+) []*types.Chunk {
+	maxSeq := 0
+
+	// 统计图片相关的子Chunk数量，用于扩展insertChunks的容量
+	imageChunkCount := 0
+	for _, chunkData := range chunks {
+		if len(chunkData.Images) > 0 {
+			// 为每个图片的OCR和Caption分别创建一个Chunk
+			imageChunkCount += len(chunkData.Images) * 2
+		}
+		if int(chunkData.Seq) > maxSeq {
+			maxSeq = int(chunkData.Seq)
+		}
+	}
+
+	// 重新分配容量，考虑图片相关的Chunk
+	insertChunks := make([]*types.Chunk, 0, len(chunks)+imageChunkCount)
+
+	for _, chunkData := range chunks {
+		if strings.TrimSpace(chunkData.Content) == "" {
+			continue
+		}
+
+		// 创建主文本Chunk
+		textChunk := &types.Chunk{
+			ID:              uuid.New().String(),
+			TenantID:        knowledge.TenantID,
+			KnowledgeID:     knowledge.ID,
+			KnowledgeBaseID: knowledge.KnowledgeBaseID,
+			Content:         chunkData.Content,
+			ChunkIndex:      int(chunkData.Seq),
+			IsEnabled:       true,
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+			StartAt:         int(chunkData.Start),
+			EndAt:           int(chunkData.End),
+			ChunkType:       types.ChunkTypeText,
+		}
+		var chunkImages []types.ImageInfo
+		insertChunks = append(insertChunks, textChunk)
+
+		// 处理图片信息
+		if len(chunkData.Images) > 0 {
+			logger.GetLogger(ctx).Infof("Processing %d images in chunk #%d", len(chunkData.Images), chunkData.Seq)
+
+			for i, img := range chunkData.Images {
+				// 保存图片信息到文本Chunk
+				imageInfo := types.ImageInfo{
+					URL:         img.Url,
+					OriginalURL: img.OriginalUrl,
+					StartPos:    int(img.Start),
+					EndPos:      int(img.End),
+					OCRText:     img.OcrText,
+					Caption:     img.Caption,
+				}
+				chunkImages = append(chunkImages, imageInfo)
+
+				// 将ImageInfo序列化为JSON
+				imageInfoJSON, err := json.Marshal([]types.ImageInfo{imageInfo})
+				if err != nil {
+					logger.GetLogger(ctx).WithField("error", err).Errorf("Failed to marshal image info to JSON")
+					continue
+				}
+
+				// 如果有OCR文本，创建OCR Chunk
+				if img.OcrText != "" {
+					ocrChunk := &types.Chunk{
+						ID:              uuid.New().String(),
+						TenantID:        knowledge.TenantID,
+						KnowledgeID:     knowledge.ID,
+						KnowledgeBaseID: knowledge.KnowledgeBaseID,
+						Content:         img.OcrText,
+						ChunkIndex:      maxSeq + i*100 + 1, // 使用不冲突的索引方式
+						IsEnabled:       true,
+						CreatedAt:       time.Now(),
+						UpdatedAt:       time.Now(),
+						StartAt:         int(img.Start),
+						EndAt:           int(img.End),
+						ChunkType:       types.ChunkTypeImageOCR,
+						ParentChunkID:   textChunk.ID,
+						ImageInfo:       string(imageInfoJSON),
+					}
+					insertChunks = append(insertChunks, ocrChunk)
+					logger.GetLogger(ctx).Infof("Created OCR chunk for image %d in chunk #%d", i, chunkData.Seq)
+				}
+
+				// 如果有图片描述，创建Caption Chunk
+				if img.Caption != "" {
+					captionChunk := &types.Chunk{
+						ID:              uuid.New().String(),
+						TenantID:        knowledge.TenantID,
+						KnowledgeID:     knowledge.ID,
+						KnowledgeBaseID: knowledge.KnowledgeBaseID,
+						Content:         img.Caption,
+						ChunkIndex:      maxSeq + i*100 + 2, // 使用不冲突的索引方式
+						IsEnabled:       true,
+						CreatedAt:       time.Now(),
+						UpdatedAt:       time.Now(),
+						StartAt:         int(img.Start),
+						EndAt:           int(img.End),
+						ChunkType:       types.ChunkTypeImageCaption,
+						ParentChunkID:   textChunk.ID,
+						ImageInfo:       string(imageInfoJSON),
+					}
+					insertChunks = append(insertChunks, captionChunk)
+					logger.GetLogger(ctx).Infof("Created caption chunk for image %d in chunk #%d", i, chunkData.Seq)
+				}
+			}
+
+			imageInfoJSON, err := json.Marshal(chunkImages)
+			if err != nil {
+				logger.GetLogger(ctx).WithField("error", err).Errorf("Failed to marshal image info to JSON")
+				continue
+			}
+			textChunk.ImageInfo = string(imageInfoJSON)
+		}
+	}
+
+	// Sort chunks by index for proper ordering
+	sort.Slice(insertChunks, func(i, j int) bool {
+		return insertChunks[i].ChunkIndex < insertChunks[j].ChunkIndex
+	})
+
+	// 仅为文本类型的Chunk设置前后关系
+	textChunks := make([]*types.Chunk, 0, len(chunks))
+	for _, chunk := range insertChunks {
+		if chunk.ChunkType == types.ChunkTypeText {
+			textChunks = append(textChunks, chunk)
+		}
+	}
+
+	// 设置文本Chunk之间的前后关系
+	for i, chunk := range textChunks {
+		if i > 0 {
+			textChunks[i-1].NextChunkID = chunk.ID
+		}
+		if i < len(textChunks)-1 {
+			textChunks[i+1].PreChunkID = chunk.ID
+		}
+	}
+	return insertChunks
+}
+
+// replaceChunks persists the chunks of the replaced content of a knowledge.
+// Chunks whose content is unchanged keep their ID and index, stale chunks are removed together
+// with their index and their references in the retrieval graph, and changed chunks are created
+// with the generation of the replacement to be embedded by the embed stage.
+func (s *knowledgeProcessService) replaceChunks(ctx context.Context,
+	task *knowledgeTask, chunks []*types.Chunk,
+) error {
+	knowledge := task.knowledge
+	existing, err := s.chunkRepo.ListChunksByKnowledgeIDAndType(ctx, knowledge.TenantID, knowledge.ID,
+		[]types.ChunkType{
+			types.ChunkTypeText, types.ChunkTypeParentText, types.ChunkTypeImageOCR, types.ChunkTypeImageCaption,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	kept, created, stale := diffChunks(existing, chunks)
+	for _, chunk := range created {
+		chunk.Generation = task.payload.Generation
+	}
+	logger.Infof(ctx, "Replace knowledge chunks, kept: %d, created: %d, stale: %d",
+		len(kept), len(created), len(stale))
+
+	if len(stale) > 0 {
+		embeddingModel, err := s.modelService.GetEmbeddingModel(ctx, knowledge.EmbeddingModelID)
+		if err != nil {
+			return err
+		}
+		retrieveEngine, err := retriever.NewCompositeRetrieveEngine(task.tenant.RetrieverEngines.Engines)
+		if err != nil {
+			return err
+		}
+		ids := utils.MapSlice(stale, func(chunk *types.Chunk) string { return chunk.ID })
+		if err := retrieveEngine.DeleteByChunkIDList(ctx, ids, embeddingModel.GetDimensions()); err != nil {
+			return err
+		}
+		if err := s.chunkRepo.DeleteChunks(ctx, knowledge.TenantID, ids); err != nil {
+			return err
+		}
+		namespace := types.NameSpace{KnowledgeBase: knowledge.KnowledgeBaseID, Knowledge: knowledge.ID}
+		if err := s.graphEngine.DelChunks(ctx, namespace, ids); err != nil {
+			return err
+		}
+	}
+	for _, chunk := range kept {
+		if err := s.chunkRepo.UpdateChunk(ctx, chunk); err != nil {
+			return err
+		}
+	}
+	if len(created) == 0 {
+		return nil
+	}
+	return s.chunkRepo.CreateChunks(ctx, created)
+}
+
+// diffChunks matches the new chunks of a knowledge against its existing chunks by chunk type and content hash.
+// A matched new chunk takes over the ID and the state of the existing chunk, the references between the
+// new chunks are rewritten accordingly. It returns the matched chunks to update, the unmatched new chunks
+// to create and the unmatched existing chunks to remove.
+func diffChunks(existing, chunks []*types.Chunk) (kept, created, stale []*types.Chunk) {
+	contentKey := func(chunk *types.Chunk) string {
+		return string(chunk.ChunkType) + ":" + calculateStr(chunk.Content)
+	}
+
+	// Existing chunks with the same content are matched in document order
+	sorted := slices.Clone(existing)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ChunkIndex < sorted[j].ChunkIndex })
+	pool := make(map[string][]*types.Chunk)
+	for _, chunk := range sorted {
+		key := contentKey(chunk)
+		pool[key] = append(pool[key], chunk)
+	}
+
+	matched := make(map[string]*types.Chunk)
+	for _, chunk := range chunks {
+		key := contentKey(chunk)
+		if candidates := pool[key]; len(candidates) > 0 {
+			matched[chunk.ID] = candidates[0]
+			pool[key] = candidates[1:]
+		}
+	}
+	for _, candidates := range pool {
+		stale = append(stale, candidates...)
+	}
+	remap := func(id string) string {
+		if old, ok := matched[id]; ok {
+			return old.ID
+		}
+		return id
+	}
+
+	for _, chunk := range chunks {
+		chunk.ParentChunkID = remap(chunk.ParentChunkID)
+		chunk.PreChunkID = remap(chunk.PreChunkID)
+		chunk.NextChunkID = remap(chunk.NextChunkID)
+		old, ok := matched[chunk.ID]
+		if !ok {
+			created = append(created, chunk)
+			continue
+		}
+		chunk.ID = old.ID
+		chunk.IsEnabled = old.IsEnabled
+		chunk.RelationChunks = old.RelationChunks
+		chunk.IndirectRelationChunks = old.IndirectRelationChunks
+		chunk.CreatedAt = old.CreatedAt
+		chunk.Generation = old.Generation
+		kept = append(kept, chunk)
+	}
+	return kept, created, stale
+}
+
+// replacedChunks returns the chunks created for the given generation of the knowledge content
+func replacedChunks(chunks []*types.Chunk, generation int64) []*types.Chunk {
+	return slices.DeleteFunc(slices.Clone(chunks), func(chunk *types.Chunk) bool {
+		return chunk.Generation != generation
+	})
+}
+
+// Embed embeds the persisted chunks of the knowledge and writes them to the retrieve engines
+func (s *knowledgeProcessService) Embed(ctx context.Context, t *asynq.Task) error {
+	ctx, task, err := s.prepare(ctx, t)
+	if err != nil || task == nil {
+		return err
+	}
+	knowledge, kb := task.knowledge, task.kb
+	stage := types.KnowledgeStageEmbed
+
+	ctx, span := tracing.ContextWithSpan(ctx, "knowledgeProcessService.Embed")
+	defer span.End()
+	span.SetAttributes(
+		attribute.Int("tenant_id", int(knowledge.TenantID)),
+		attribute.String("knowledge_base_id", knowledge.KnowledgeBaseID),
+		attribute.String("knowledge_id", knowledge.ID),
+		attribute.String("embedding_model_id", kb.EmbeddingModelID),
+	)
+
+	if err := s.startStage(ctx, knowledge, stage); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	chunks, err := s.chunkRepo.ListChunksByKnowledgeIDAndType(ctx, knowledge.TenantID, knowledge.ID,
+		[]types.ChunkType{types.ChunkTypeText, types.ChunkTypeImageOCR, types.ChunkTypeImageCaption},
+	)
+	if err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+	span.SetAttributes(attribute.Int("chunk_count", len(chunks)))
+
+	embeddingModel, err := s.modelService.GetEmbeddingModel(ctx, kb.EmbeddingModelID)
+	if err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+	retrieveEngine, err := retriever.NewCompositeRetrieveEngine(task.tenant.RetrieverEngines.Engines)
+	if err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+
+	// Drop the index written by a previous attempt,
+	// a replaced knowledge only embeds the chunks created by the replacement
+	embedChunks := chunks
+	dropIndex := func() error {
+		return retrieveEngine.DeleteByKnowledgeIDList(ctx, []string{knowledge.ID}, embeddingModel.GetDimensions())
+	}
+	if generation := task.payload.Generation; generation != 0 {
+		embedChunks = replacedChunks(chunks, generation)
+		ids := utils.MapSlice(embedChunks, func(chunk *types.Chunk) string { return chunk.ID })
+		dropIndex = func() error {
+			if len(ids) == 0 {
+				return nil
+			}
+			return retrieveEngine.DeleteByChunkIDList(ctx, ids, embeddingModel.GetDimensions())
+		}
+	}
+	span.SetAttributes(attribute.Int("embed_chunk_count", len(embedChunks)))
+	if err := dropIndex(); err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+
+	// Calculate storage size required for embeddings of the whole knowledge
+	span.AddEvent("estimate storage size")
+	totalStorageSize := retrieveEngine.EstimateStorageSize(ctx, embeddingModel, chunksToIndexInfo(chunks))
+	storageDelta := totalStorageSize - knowledge.StorageSize
+	if task.tenant.StorageQuota > 0 && task.tenant.StorageUsed+storageDelta > task.tenant.StorageQuota {
+		span.RecordError(ErrStorageQuotaExceeded)
+		return s.failStage(ctx, knowledge, stage, ErrStorageQuotaExceeded, true)
+	}
+
+	span.AddEvent("batch index")
+	indexInfoList := chunksToIndexInfo(embedChunks)
+	if len(indexInfoList) > 0 {
+		if err := retrieveEngine.BatchIndex(ctx, embeddingModel, indexInfoList); err != nil {
+			if derr := dropIndex(); derr != nil {
+				logger.Errorf(ctx, "Delete index failed: %v", derr)
+			}
+			span.RecordError(err)
+			return s.failStage(ctx, knowledge, stage, err, false)
+		}
+	}
+	logger.GetLogger(ctx).Infof("Embed batch index successfully, with %d index", len(indexInfoList))
+
+	// A re-embedding job may have swapped in the vectors of another model meanwhile,
+	// the retry drops the vectors written with the previous model and embeds with the new one
+	current, err := s.kbRepo.GetKnowledgeBaseByID(ctx, kb.ID)
+	if err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+	if current.EmbeddingModelID != kb.EmbeddingModelID {
+		knowledge.EmbeddingModelID = current.EmbeddingModelID
+		span.RecordError(errEmbeddingModelChanged)
+		return s.failStage(ctx, knowledge, stage, errEmbeddingModelChanged, false)
+	}
+
+	knowledge.StorageSize = totalStorageSize
+	if err := s.finishStage(ctx, task, stage, types.KnowledgeStageSummarize); err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+	s.adjustStorageUsed(ctx, task.tenant, storageDelta)
+	return nil
+}
+
+// Summarize generates the document summary and indexes it as a summary chunk
+func (s *knowledgeProcessService) Summarize(ctx context.Context, t *asynq.Task) error {
+	ctx, task, err := s.prepare(ctx, t)
+	if err != nil || task == nil {
+		return err
+	}
+	knowledge, kb := task.knowledge, task.kb
+	stage := types.KnowledgeStageSummarize
+
+	ctx, span := tracing.ContextWithSpan(ctx, "knowledgeProcessService.Summarize")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("knowledge_id", knowledge.ID),
+		attribute.String("summary_model_id", kb.SummaryModelID),
+	)
+
+	if err := s.startStage(ctx, knowledge, stage); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	chatModel, err := s.modelService.GetChatModel(ctx, kb.SummaryModelID)
+	if err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+	embeddingModel, err := s.modelService.GetEmbeddingModel(ctx, kb.EmbeddingModelID)
+	if err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+	retrieveEngine, err := retriever.NewCompositeRetrieveEngine(task.tenant.RetrieverEngines.Engines)
+	if err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+
+	// Drop the summary written by a previous attempt
+	if err := s.deleteChunksByType(ctx, retrieveEngine, embeddingModel.GetDimensions(), knowledge,
+		[]types.ChunkType{types.ChunkTypeSummary},
+	); err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+
+	textChunks, err := s.chunkRepo.ListChunksByKnowledgeIDAndType(ctx, knowledge.TenantID, knowledge.ID,
+		[]types.ChunkType{types.ChunkTypeText},
+	)
+	if err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+
+	span.AddEvent("extract summary")
+	summary, err := s.getSummary(ctx, chatModel, knowledge, textChunks)
+	if err != nil {
+		logger.GetLogger(ctx).WithField("knowledge_id", knowledge.ID).
+			WithField("error", err).Errorf("Summarize get summary failed, use first chunk as description")
+		if len(textChunks) > 0 {
+			knowledge.Description = textChunks[0].Content
+		}
+	} else {
+		knowledge.Description = summary
+	}
+	span.SetAttributes(attribute.String("summary", knowledge.Description))
+
+	var storageDelta int64
+	if strings.TrimSpace(knowledge.Description) != "" && len(textChunks) > 0 {
+		sChunk := &types.Chunk{
+			ID:              uuid.New().String(),
+			TenantID:        knowledge.TenantID,
+			KnowledgeID:     knowledge.ID,
+			KnowledgeBaseID: knowledge.KnowledgeBaseID,
+			Content:         fmt.Sprintf("# 文档名称\n%s\n\n# 摘要\n%s", knowledge.FileName, knowledge.Description),
+			ChunkIndex:      maxChunkIndex(textChunks) + 3, // 使用不冲突的索引方式
+			IsEnabled:       true,
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+			StartAt:         0,
+			EndAt:           0,
+			ChunkType:       types.ChunkTypeSummary,
+			ParentChunkID:   textChunks[0].ID,
+		}
+		logger.GetLogger(ctx).Infof("Created summary chunk for %s with index %d",
+			sChunk.ParentChunkID, sChunk.ChunkIndex)
+
+		if storageDelta, err = s.indexChunks(ctx, retrieveEngine, embeddingModel, task.tenant,
+			[]*types.Chunk{sChunk},
+		); err != nil {
+			span.RecordError(err)
+			return s.failStage(ctx, knowledge, stage, err, errors.Is(err, ErrStorageQuotaExceeded))
+		}
+	}
+
+	knowledge.StorageSize += storageDelta
+	if err := s.finishStage(ctx, task, stage, types.KnowledgeStageGraph); err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+	s.adjustStorageUsed(ctx, task.tenant, storageDelta)
+	return nil
+}
+
+// Graph builds the knowledge graph of the knowledge, dispatches the chunk extract tasks
+// and completes the ingestion
+func (s *knowledgeProcessService) Graph(ctx context.Context, t *asynq.Task) error {
+	ctx, task, err := s.prepare(ctx, t)
+	if err != nil || task == nil {
+		return err
+	}
+	knowledge, kb := task.knowledge, task.kb
+	stage := types.KnowledgeStageGraph
+
+	ctx, span := tracing.ContextWithSpan(ctx, "knowledgeProcessService.Graph")
+	defer span.End()
+	span.SetAttributes(attribute.String("knowledge_id", knowledge.ID))
+
+	if err := s.startStage(ctx, knowledge, stage); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	textChunks, err := s.chunkRepo.ListChunksByKnowledgeIDAndType(ctx, knowledge.TenantID, knowledge.ID,
+		[]types.ChunkType{types.ChunkTypeText},
+	)
+	if err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+
+	var storageDelta int64
+	if os.Getenv("ENABLE_GRAPH_RAG") == "true" {
+		storageDelta, err = s.buildGraph(ctx, task, textChunks)
+		if err != nil {
+			span.RecordError(err)
+			return s.failStage(ctx, knowledge, stage, err, errors.Is(err, ErrStorageQuotaExceeded))
+		}
+	}
+
+	// A replaced knowledge only extracts the relations of the changed chunks
+	extractChunks := textChunks
+	if generation := task.payload.Generation; generation != 0 {
+		extractChunks = replacedChunks(textChunks, generation)
+	}
+
+	logger.Infof(ctx, "Graph create relationship rag task")
+	for _, chunk := range extractChunks {
+		err := NewChunkExtractTask(ctx, s.task, chunk.TenantID, chunk.ID, kb.SummaryModelID)
+		if err != nil {
+			logger.GetLogger(ctx).WithField("error", err).Errorf("Graph create chunk extract task failed")
+			span.RecordError(err)
+		}
+	}
+
+	// Update knowledge status to completed
+	now := time.Now()
+	knowledge.ParseStatus = "completed"
+	knowledge.EnableStatus = "enabled"
+	knowledge.StorageSize += storageDelta
+	knowledge.ProcessedAt = &now
+	if err := s.finishStage(ctx, task, stage, ""); err != nil {
+		span.RecordError(err)
+		return s.failStage(ctx, knowledge, stage, err, false)
+	}
+	s.adjustStorageUsed(ctx, task.tenant, storageDelta)
+	logger.GetLogger(ctx).Infof("Knowledge process successfully")
+	return nil
+}
+
+// buildGraph builds the GraphRAG relations of the text chunks and indexes the entity and relationship chunks
+// It returns the storage size taken by the new index
+func (s *knowledgeProcessService) buildGraph(ctx context.Context,
+	task *knowledgeTask, textChunks []*types.Chunk,
+) (int64, error) {
+	knowledge, kb := task.knowledge, task.kb
+	chatModel, err := s.modelService.GetChatModel(ctx, kb.SummaryModelID)
+	if err != nil {
+		return 0, err
+	}
+	embeddingModel, err := s.modelService.GetEmbeddingModel(ctx, kb.EmbeddingModelID)
+	if err != nil {
+		return 0, err
+	}
+	retrieveEngine, err := retriever.NewCompositeRetrieveEngine(task.tenant.RetrieverEngines.Engines)
+	if err != nil {
+		return 0, err
+	}
+
+	// Drop the graph chunks written by a previous attempt
+	if err := s.deleteChunksByType(ctx, retrieveEngine, embeddingModel.GetDimensions(), knowledge,
+		[]types.ChunkType{types.ChunkTypeEntity, types.ChunkTypeRelationship},
+	); err != nil {
+		return 0, err
+	}
+
+	relationChunkSize := 5
+	indirectRelationChunkSize := 5
+	graphBuilder := NewGraphBuilder(s.config, chatModel)
+	if err := graphBuilder.BuildGraph(ctx, textChunks); err != nil {
+		logger.GetLogger(ctx).WithField("error", err).Errorf("buildGraph build graph failed")
+		return 0, nil
+	}
+	if err := s.graphService.SaveKnowledgeGraph(ctx, knowledge,
+		graphBuilder.GetAllEntities(), graphBuilder.GetAllRelationships(),
+	); err != nil {
+		logger.GetLogger(ctx).WithField("error", err).Errorf("buildGraph save knowledge graph failed")
+		return 0, err
+	}
+
+	for _, chunk := range textChunks {
+		chunk.RelationChunks, _ = json.Marshal(graphBuilder.GetRelationChunks(chunk.ID, relationChunkSize))
+		chunk.IndirectRelationChunks, _ = json.Marshal(
+			graphBuilder.GetIndirectRelationChunks(chunk.ID, indirectRelationChunkSize),
+		)
+		if err := s.chunkRepo.UpdateChunk(ctx, chunk); err != nil {
+			return 0, err
+		}
+	}
+
+	maxSeq := maxChunkIndex(textChunks)
+	graphChunks := make([]*types.Chunk, 0)
+	for i, entity := range graphBuilder.GetAllEntities() {
+		relationChunks, _ := json.Marshal(entity.ChunkIDs)
+		graphChunks = append(graphChunks, &types.Chunk{
+			ID:              entity.ID,
+			TenantID:        knowledge.TenantID,
+			KnowledgeID:     knowledge.ID,
+			KnowledgeBaseID: knowledge.KnowledgeBaseID,
+			Content:         entity.Description,
+			ChunkIndex:      maxSeq + i*100 + 3,
+			IsEnabled:       true,
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+			ChunkType:       types.ChunkTypeEntity,
+			RelationChunks:  types.JSON(relationChunks),
+		})
+	}
+	for i, relationship := range graphBuilder.GetAllRelationships() {
+		relationChunks, _ := json.Marshal(relationship.ChunkIDs)
+		graphChunks = append(graphChunks, &types.Chunk{
+			ID:              relationship.ID,
+			TenantID:        knowledge.TenantID,
+			KnowledgeID:     knowledge.ID,
+			KnowledgeBaseID: knowledge.KnowledgeBaseID,
+			Content:         relationship.Description,
+			ChunkIndex:      maxSeq + i*100 + 4,
+			IsEnabled:       true,
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+			ChunkType:       types.ChunkTypeRelationship,
+			RelationChunks:  types.JSON(relationChunks),
+		})
+	}
+	if len(graphChunks) == 0 {
+		return 0, nil
+	}
+	return s.indexChunks(ctx, retrieveEngine, embeddingModel, task.tenant, graphChunks)
+}
+
+// indexChunks persists the chunks and writes them to the retrieve engines
+// It returns the storage size taken by the new index
+func (s *knowledgeProcessService) indexChunks(ctx context.Context,
+	retrieveEngine *retriever.CompositeRetrieveEngine, embeddingModel embedding.Embedder,
+	tenant *types.Tenant, chunks []*types.Chunk,
+) (int64, error) {
+	indexInfoList := chunksToIndexInfo(chunks)
+	storageSize := retrieveEngine.EstimateStorageSize(ctx, embeddingModel, indexInfoList)
+	if tenant.StorageQuota > 0 && tenant.StorageUsed+storageSize > tenant.StorageQuota {
+		return 0, ErrStorageQuotaExceeded
+	}
+	if err := s.chunkRepo.CreateChunks(ctx, chunks); err != nil {
+		return 0, err
+	}
+	if err := retrieveEngine.BatchIndex(ctx, embeddingModel, indexInfoList); err != nil {
+		return 0, err
+	}
+	return storageSize, nil
+}
+
+// deleteChunksByType removes the chunks of the given types of a knowledge together with their index
+func (s *knowledgeProcessService) deleteChunksByType(ctx context.Context,
+	retrieveEngine *retriever.CompositeRetrieveEngine, dimension int,
+	knowledge *types.Knowledge, chunkType []types.ChunkType,
+) error {
+	chunks, err := s.chunkRepo.ListChunksByKnowledgeIDAndType(ctx, knowledge.TenantID, knowledge.ID, chunkType)
+	if err != nil {
+		return err
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+	ids := utils.MapSlice(chunks, func(chunk *types.Chunk) string { return chunk.ID })
+	if err := retrieveEngine.DeleteByChunkIDList(ctx, ids, dimension); err != nil {
+		return err
+	}
+	return s.chunkRepo.DeleteChunks(ctx, knowledge.TenantID, ids)
+}
+
+// adjustStorageUsed updates the storage used by the tenant
+func (s *knowledgeProcessService) adjustStorageUsed(ctx context.Context, tenant *types.Tenant, delta int64) {
+	if delta == 0 {
+		return
+	}
+	tenant.StorageUsed += delta
+	if err := s.tenantRepo.AdjustStorageUsed(ctx, tenant.ID, delta); err != nil {
+		logger.GetLogger(ctx).WithField("error", err).Errorf("adjustStorageUsed update tenant storage used failed")
+	}
+}
+
+// chunksToIndexInfo creates index information for each chunk
+func chunksToIndexInfo(chunks []*types.Chunk) []*types.IndexInfo {
+	return utils.MapSlice(chunks, func(chunk *types.Chunk) *types.IndexInfo {
+		return &types.IndexInfo{
+			Content:         chunk.Content,
+			SourceID:        chunk.ID,
+			SourceType:      types.ChunkSourceType,
+			ChunkID:         chunk.ID,
+			KnowledgeID:     chunk.KnowledgeID,
+			KnowledgeBaseID: chunk.KnowledgeBaseID,
+		}
+	})
+}
+
+// maxChunkIndex returns the largest chunk index of the chunks
+func maxChunkIndex(chunks []*types.Chunk) int {
+	maxSeq := 0
+	for _, chunk := range chunks {
+		if chunk.ChunkIndex > maxSeq {
+			maxSeq = chunk.ChunkIndex
+		}
+	}
+	return maxSeq
+}
+
+// GetSummary generates a summary for knowledge content using an AI model
+func (s *knowledgeProcessService) getSummary(ctx context.Context,
+	summaryModel chat.Chat, knowledge *types.Knowledge, chunks []*types.Chunk,
+) (string, error) {
+	// Get knowledge info from the first chunk
+	if len(chunks) == 0 {
+		return "", fmt.Errorf("no chunks provided for summary generation")
+	}
+
+	// concat chunk contents
+	chunkContents := ""
+	allImageInfos := make([]*types.ImageInfo, 0)
+
+	// then, sort chunks by StartAt
+	sortedChunks := make([]*types.Chunk, len(chunks))
+	copy(sortedChunks, chunks)
+	sort.Slice(sortedChunks, func(i, j int) bool {
+		return sortedChunks[i].StartAt < sortedChunks[j].StartAt
+	})
+
+	// concat chunk contents and collect image infos
+	for _, chunk := range sortedChunks {
+		if chunk.EndAt > 4096 {
+			break
+		}
+		chunkContents = string([]rune(chunkContents)[:chunk.StartAt]) + chunk.Content
+		if chunk.ImageInfo != "" {
+			var images []*types.ImageInfo
+			if err := json.Unmarshal([]byte(chunk.ImageInfo), &images); err == nil {
+				allImageInfos = append(allImageInfos, images...)
+			}
+		}
+	}
+	// remove markdown image syntax
+	re := regexp.MustCompile(`!\[[^\]]*\]\([^)]+\)`)
+	chunkContents = re.ReplaceAllString(chunkContents, "")
+	// collect all image infos
+	if len(allImageInfos) > 0 {
+		// add image infos to chunk contents
+		var imageAnnotations string
+		for _, img := range allImageInfos {
+			if img.Caption != "" {
+				imageAnnotations += fmt.Sprintf("\n[图片描述: %s]", img.Caption)
+			}
+			if img.OCRText != "" {
+				imageAnnotations += fmt.Sprintf("\n[图片文字: %s]", img.OCRText)
+			}
+		}
+
+		// concat chunk contents and image annotations
+		chunkContents = chunkContents + imageAnnotations
+	}
+
+	if len(chunkContents) < 300 {
+		return chunkContents, nil
+	}
+
+	// Prepare content with metadata for summary generation
+	contentWithMetadata := chunkContents
+
+	// Add knowledge metadata if available
+	if knowledge != nil {
+		metadataIntro := fmt.Sprintf("文档类型: %s\n文件名称: %s\n", knowledge.FileType, knowledge.FileName)
+
+		// Add additional metadata if available
+		if knowledge.Type != "" {
+			metadataIntro += fmt.Sprintf("知识类型: %s\n", knowledge.Type)
+		}
+
+		// Prepend metadata to content
+		contentWithMetadata = metadataIntro + "\n内容:\n" + contentWithMetadata
+	}
+
+	// Generate summary using AI model
+	thinking := false
+	summary, err := summaryModel.Chat(ctx, []chat.Message{
+		{
+			Role:    "system",
+			Content: s.config.Conversation.GenerateSummaryPrompt,
+		},
+		{
+			Role:    "user",
+			Content: contentWithMetadata,
+		},
+	}, &chat.ChatOptions{
+		Temperature: 0.3,
+		MaxTokens:   1024,
+		Thinking:    &thinking,
+	})
+	if err != nil {
+		logger.GetLogger(ctx).WithField("error", err).Errorf("GetSummary failed")
+		return "", err
+	}
+	logger.GetLogger(ctx).WithField("summary", summary.Content).Infof("GetSummary success")
+	return summary.Content, nil
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/hibiken/asynq"
+)
+
+// fakeReplaceChunkRepo keeps the chunks of a knowledge in memory
+type fakeReplaceChunkRepo struct {
+	interfaces.ChunkRepository
+	existing []*types.Chunk
+	updated  []*types.Chunk
+	created  []*types.Chunk
+	deleted  []string
+}
+
+func (r *fakeReplaceChunkRepo) ListChunksByKnowledgeIDAndType(ctx context.Context,
+	tenantID uint, knowledgeID string, chunkTypes []types.ChunkType,
+) ([]*types.Chunk, error) {
+	return r.existing, nil
+}
+
+func (r *fakeReplaceChunkRepo) UpdateChunk(ctx context.Context, chunk *types.Chunk) error {
+	r.updated = append(r.updated, chunk)
+	return nil
+}
+
+func (r *fakeReplaceChunkRepo) CreateChunks(ctx context.Context, chunks []*types.Chunk) error {
+	r.created = append(r.created, chunks...)
+	return nil
+}
+
+func (r *fakeReplaceChunkRepo) DeleteChunks(ctx context.Context, tenantID uint, ids []string) error {
+	r.deleted = append(r.deleted, ids...)
+	return nil
+}
+
+// fakeReplaceGraph records the chunks removed from the graph of a knowledge
+type fakeReplaceGraph struct {
+	interfaces.RetrieveGraphRepository
+	deleted [][]string
+}
+
+func (g *fakeReplaceGraph) DelChunks(ctx context.Context, namespace types.NameSpace, chunkIDs []string) error {
+	if namespace.Knowledge == "k1" {
+		g.deleted = append(g.deleted, chunkIDs)
+	}
+	return nil
+}
+
+func chunkIDs(chunks []*types.Chunk) []string {
+	ids := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		ids = append(ids, chunk.ID)
+	}
+	return ids
+}
+
+func TestDiffChunks(t *testing.T) {
+	existing := []*types.Chunk{
+		{ID: "old-b", Content: "b", ChunkType: types.ChunkTypeText, ChunkIndex: 1, Generation: 1},
+		{ID: "old-a", Content: "a", ChunkType: types.ChunkTypeText, ChunkIndex: 0, Generation: 1, IsEnabled: true},
+		{ID: "old-c", Content: "c", ChunkType: types.ChunkTypeText, ChunkIndex: 2, Generation: 1},
+		{ID: "old-ocr", Content: "a", ChunkType: types.ChunkTypeImageOCR, ParentChunkID: "old-a", Generation: 1},
+	}
+	chunks := []*types.Chunk{
+		{ID: "new-a", Content: "a", ChunkType: types.ChunkTypeText, NextChunkID: "new-x"},
+		{ID: "new-x", Content: "x", ChunkType: types.ChunkTypeText, PreChunkID: "new-a", NextChunkID: "new-b"},
+		{ID: "new-b", Content: "b", ChunkType: types.ChunkTypeText, PreChunkID: "new-x"},
+		{ID: "new-caption", Content: "a", ChunkType: types.ChunkTypeImageCaption, ParentChunkID: "new-a"},
+	}
+
+	kept, created, stale := diffChunks(existing, chunks)
+	if !reflect.DeepEqual(chunkIDs(kept), []string{"old-a", "old-b"}) {
+		t.Errorf("Expected the unchanged chunks to keep their ID, got %v", chunkIDs(kept))
+	}
+	if !reflect.DeepEqual(chunkIDs(created), []string{"new-x", "new-caption"}) {
+		t.Errorf("Expected the changed chunks to be created, got %v", chunkIDs(created))
+	}
+	staleIDs := chunkIDs(stale)
+	if len(staleIDs) != 2 || !containsAll(staleIDs, "old-c", "old-ocr") {
+		t.Errorf("Expected the unmatched chunks to be stale, got %v", staleIDs)
+	}
+
+	if !kept[0].IsEnabled || kept[0].Generation != 1 {
+		t.Errorf("Expected the kept chunk to take over the existing state, got %+v", kept[0])
+	}
+	if kept[0].NextChunkID != "new-x" || created[0].PreChunkID != "old-a" || created[0].NextChunkID != "old-b" {
+		t.Errorf("Expected the references to be rewritten to the kept IDs, got %+v", created[0])
+	}
+	if created[1].ParentChunkID != "old-a" {
+		t.Errorf("Expected the parent to be rewritten, got %s", created[1].ParentChunkID)
+	}
+}
+
+func TestDiffChunksDuplicates(t *testing.T) {
+	existing := []*types.Chunk{
+		{ID: "old-2", Content: "same", ChunkType: types.ChunkTypeText, ChunkIndex: 2},
+		{ID: "old-1", Content: "same", ChunkType: types.ChunkTypeText, ChunkIndex: 1},
+	}
+	chunks := []*types.Chunk{{ID: "new-1", Content: "same", ChunkType: types.ChunkTypeText}}
+
+	kept, created, stale := diffChunks(existing, chunks)
+	if len(kept) != 1 || kept[0].ID != "old-1" {
+		t.Errorf("Expected the first existing chunk in document order to be kept, got %v", chunkIDs(kept))
+	}
+	if len(created) != 0 || !reflect.DeepEqual(chunkIDs(stale), []string{"old-2"}) {
+		t.Errorf("Expected the duplicate to be stale, got created %v and stale %v", chunkIDs(created), chunkIDs(stale))
+	}
+}
+
+func TestReplaceChunks(t *testing.T) {
+	chunkRepo := &fakeReplaceChunkRepo{existing: []*types.Chunk{
+		{ID: "old-a", Content: "a", ChunkType: types.ChunkTypeText, Generation: 1},
+		{ID: "old-b", Content: "b", ChunkType: types.ChunkTypeText, Generation: 1},
+	}}
+	graph := &fakeReplaceGraph{}
+	s := &knowledgeProcessService{
+		chunkRepo:    chunkRepo,
+		modelService: fakeReindexModelService{},
+		graphEngine:  graph,
+	}
+	task := &knowledgeTask{
+		payload:   &types.KnowledgeProcessPayload{Generation: 2},
+		knowledge: &types.Knowledge{ID: "k1", TenantID: 1, KnowledgeBaseID: "kb", Generation: 2},
+		tenant:    &types.Tenant{},
+	}
+	chunks := []*types.Chunk{
+		{ID: "new-a", Content: "a", ChunkType: types.ChunkTypeText},
+		{ID: "new-c", Content: "c", ChunkType: types.ChunkTypeText},
+	}
+	if err := s.replaceChunks(context.Background(), task, chunks); err != nil {
+		t.Fatalf("replaceChunks: %v", err)
+	}
+
+	if !reflect.DeepEqual(chunkIDs(chunkRepo.updated), []string{"old-a"}) || chunkRepo.updated[0].Generation != 1 {
+		t.Errorf("Expected the unchanged chunk to be kept with its generation, got %+v", chunkRepo.updated)
+	}
+	if !reflect.DeepEqual(chunkIDs(chunkRepo.created), []string{"new-c"}) || chunkRepo.created[0].Generation != 2 {
+		t.Errorf("Expected the changed chunk to be created with the new generation, got %+v", chunkRepo.created)
+	}
+	if !reflect.DeepEqual(chunkRepo.deleted, []string{"old-b"}) || !reflect.DeepEqual(graph.deleted, [][]string{{"old-b"}}) {
+		t.Errorf("Expected the stale chunk to be removed from the chunks and the graph, got %v and %v",
+			chunkRepo.deleted, graph.deleted)
+	}
+
+	// Only the chunks of the replacement are embedded again
+	all := append(chunkRepo.updated, chunkRepo.created...)
+	if embed := replacedChunks(all, 2); !reflect.DeepEqual(chunkIDs(embed), []string{"new-c"}) {
+		t.Errorf("Expected only the created chunk to be embedded, got %v", chunkIDs(embed))
+	}
+}
+
+func containsAll(values []string, expected ...string) bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	for _, value := range expected {
+		if !set[value] {
+			return false
+		}
+	}
+	return true
+}
+
+// fakeStageKnowledgeRepo keeps a single knowledge and snapshots every update of its progress
+type fakeStageKnowledgeRepo struct {
+	interfaces.KnowledgeRepository
+	knowledge *types.Knowledge
+	err       error
+	updates   []types.Knowledge
+}
+
+func (r *fakeStageKnowledgeRepo) GetKnowledgeByID(ctx context.Context,
+	tenantID uint, id string,
+) (*types.Knowledge, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.knowledge, nil
+}
+
+func (r *fakeStageKnowledgeRepo) UpdateKnowledge(ctx context.Context, knowledge *types.Knowledge) error {
+	snapshot := *knowledge
+	snapshot.StageProgress = types.KnowledgeStageProgress{}
+	for stage, progress := range knowledge.StageProgress {
+		copied := *progress
+		snapshot.StageProgress[stage] = &copied
+	}
+	r.updates = append(r.updates, snapshot)
+	return nil
+}
+
+// fakeStageTenantRepo returns a tenant for any ID
+type fakeStageTenantRepo struct {
+	interfaces.TenantRepository
+}
+
+func (r *fakeStageTenantRepo) GetTenantByID(ctx context.Context, id uint) (*types.Tenant, error) {
+	return &types.Tenant{ID: id}, nil
+}
+
+// fakeStageChunkRepo records the chunks of every parse attempt
+type fakeStageChunkRepo struct {
+	interfaces.ChunkRepository
+	deletes int
+	created [][]*types.Chunk
+}
+
+func (r *fakeStageChunkRepo) DeleteChunksByKnowledgeID(ctx context.Context, tenantID uint, knowledgeID string) error {
+	r.deletes++
+	return nil
+}
+
+func (r *fakeStageChunkRepo) CreateChunks(ctx context.Context, chunks []*types.Chunk) error {
+	r.created = append(r.created, chunks)
+	return nil
+}
+
+// fakeStageGraph records the namespaces whose graph is dropped
+type fakeStageGraph struct {
+	interfaces.RetrieveGraphRepository
+	deleted []types.NameSpace
+}
+
+func (g *fakeStageGraph) DelGraph(ctx context.Context, namespaces []types.NameSpace) error {
+	g.deleted = append(g.deleted, namespaces...)
+	return nil
+}
+
+func newStageTask(t *testing.T, payload *types.KnowledgeProcessPayload) *asynq.Task {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return asynq.NewTask(types.TypeKnowledgeParse, data)
+}
+
+func TestKnowledgeProcessPrepare(t *testing.T) {
+	s := &knowledgeProcessService{
+		repo:       &fakeStageKnowledgeRepo{err: types.ErrKnowledgeNotFound},
+		tenantRepo: &fakeStageTenantRepo{},
+	}
+
+	// The knowledge was deleted while its task was queued
+	payload := &types.KnowledgeProcessPayload{TenantID: 1, KnowledgeID: "k1"}
+	_, task, err := s.prepare(context.Background(), newStageTask(t, payload))
+	if err != nil || task != nil {
+		t.Errorf("Expected the task to be dropped, got %v, %v", task, err)
+	}
+
+	// A payload that can not be decoded is never retried
+	_, _, err = s.prepare(context.Background(), asynq.NewTask(types.TypeKnowledgeParse, []byte("{")))
+	if !errors.Is(err, asynq.SkipRetry) {
+		t.Errorf("Expected SkipRetry, got %v", err)
+	}
+}
+
+func TestKnowledgeProcessFailStage(t *testing.T) {
+	repo := &fakeStageKnowledgeRepo{}
+	s := &knowledgeProcessService{repo: repo}
+	knowledge := &types.Knowledge{ID: "k1"}
+	stage := types.KnowledgeStageEmbed
+	if err := s.startStage(context.Background(), knowledge, stage); err != nil {
+		t.Fatalf("startStage: %v", err)
+	}
+	if knowledge.ProcessStage != stage || knowledge.Stage(stage).Attempts != 1 {
+		t.Errorf("Expected the first attempt of the embed stage, got %+v", knowledge.Stage(stage))
+	}
+
+	// A failed attempt that will be retried keeps the knowledge processing
+	cause := errors.New("embedding service unavailable")
+	err := s.failStage(context.Background(), knowledge, stage, cause, false)
+	if !errors.Is(err, cause) || errors.Is(err, asynq.SkipRetry) {
+		t.Errorf("Expected a retryable error, got %v", err)
+	}
+	progress := knowledge.Stage(stage)
+	if knowledge.ParseStatus != "processing" || progress.Status != "processing" || progress.Error != cause.Error() {
+		t.Errorf("Expected the stage to stay processing with its error, got %s, %+v", knowledge.ParseStatus, progress)
+	}
+
+	// The last attempt fails the knowledge
+	err = s.failStage(context.Background(), knowledge, stage, cause, true)
+	if !errors.Is(err, asynq.SkipRetry) {
+		t.Errorf("Expected SkipRetry, got %v", err)
+	}
+	if knowledge.ParseStatus != "failed" || progress.Status != "failed" || progress.FinishedAt == nil {
+		t.Errorf("Expected the stage to fail, got %s, %+v", knowledge.ParseStatus, progress)
+	}
+	if knowledge.ErrorMessage != cause.Error() {
+		t.Errorf("Expected the error message to be kept, got %q", knowledge.ErrorMessage)
+	}
+	if len(repo.updates) != 3 {
+		t.Errorf("Expected every transition to be persisted, got %d updates", len(repo.updates))
+	}
+}
+
+func TestKnowledgeProcessParseResume(t *testing.T) {
+	knowledge := &types.Knowledge{ID: "k1", TenantID: 1, KnowledgeBaseID: "kb", Type: "passage"}
+	repo := &fakeStageKnowledgeRepo{knowledge: knowledge}
+	chunkRepo := &fakeStageChunkRepo{}
+	graph := &fakeStageGraph{}
+	// The task queue is unreachable so the embed stage can not be enqueued
+	client := asynq.NewClient(asynq.RedisClientOpt{Addr: "127.0.0.1:1"})
+	defer client.Close()
+	s := &knowledgeProcessService{
+		repo:        repo,
+		kbRepo:      &fakeReindexKBRepo{kb: &types.KnowledgeBase{ID: "kb", TenantID: 1}},
+		tenantRepo:  &fakeStageTenantRepo{},
+		chunkRepo:   chunkRepo,
+		graphEngine: graph,
+		task:        client,
+	}
+	payload := &types.KnowledgeProcessPayload{
+		TenantID: 1, KnowledgeID: "k1", Passages: []string{"first passage", "", "second passage"},
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		err := s.Parse(context.Background(), newStageTask(t, payload))
+		if err == nil || errors.Is(err, asynq.SkipRetry) {
+			t.Fatalf("Attempt %d: expected a retryable enqueue error, got %v", attempt, err)
+		}
+		// Every attempt drops what the previous one wrote before persisting its chunks
+		if chunkRepo.deletes != attempt || len(graph.deleted) != attempt || len(chunkRepo.created) != attempt {
+			t.Fatalf("Attempt %d: expected the previous chunks to be replaced, got %d deletes, %d graph deletes, %d creates",
+				attempt, chunkRepo.deletes, len(graph.deleted), len(chunkRepo.created))
+		}
+		if created := chunkRepo.created[attempt-1]; len(created) != 2 {
+			t.Errorf("Attempt %d: expected 2 chunks, got %d", attempt, len(created))
+		}
+	}
+	if graph.deleted[0] != (types.NameSpace{KnowledgeBase: "kb", Knowledge: "k1"}) {
+		t.Errorf("Expected the graph of the knowledge to be dropped, got %+v", graph.deleted[0])
+	}
+
+	// The parse stage completed but stays resumable until the embed stage is enqueued
+	last := repo.updates[len(repo.updates)-1]
+	progress := last.StageProgress[types.KnowledgeStageParse]
+	if last.ProcessStage != types.KnowledgeStageParse || last.ParseStatus != "processing" {
+		t.Errorf("Expected the knowledge to stay in the parse stage, got %s, %s", last.ProcessStage, last.ParseStatus)
+	}
+	if progress == nil || progress.Status != "processing" || progress.Error == "" {
+		t.Errorf("Expected the enqueue error to be recorded, got %+v", progress)
+	}
+}
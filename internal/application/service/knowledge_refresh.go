@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	secutils "github.com/Tencent/WeKnora/internal/utils"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// KnowledgeRefreshScanSpec is the schedule of the periodic scan for due URL knowledge
+	KnowledgeRefreshScanSpec = "@every 1m"
+	// knowledgeRefreshScanLimit is the maximum number of refresh tasks enqueued per scan
+	knowledgeRefreshScanLimit = 100
+	// knowledgeRefreshMaxRetry is the maximum number of retries of a refresh task
+	knowledgeRefreshMaxRetry = 3
+	// knowledgeRefreshFetchTimeout bounds a single re-fetch of a URL
+	knowledgeRefreshFetchTimeout = 60 * time.Second
+	// MinKnowledgeRefreshInterval is the minimum refresh interval in minutes of a URL knowledge
+	MinKnowledgeRefreshInterval = 10
+)
+
+// knowledgeRefreshService re-fetches URL knowledge on their refresh schedule
+type knowledgeRefreshService struct {
+	repo       interfaces.KnowledgeRepository
+	kbRepo     interfaces.KnowledgeBaseRepository
+	task       *asynq.Client
+	httpClient *http.Client
+}
+
+// NewKnowledgeRefreshService creates a new knowledge refresh service
+func NewKnowledgeRefreshService(
+	repo interfaces.KnowledgeRepository,
+	kbRepo interfaces.KnowledgeBaseRepository,
+	task *asynq.Client,
+) interfaces.KnowledgeRefresher {
+	return &knowledgeRefreshService{
+		repo:       repo,
+		kbRepo:     kbRepo,
+		task:       task,
+		httpClient: newURLFetchClient(),
+	}
+}
+
+// newURLFetchClient creates the HTTP client used to fetch the source of URL knowledge
+func newURLFetchClient() *http.Client {
+	return &http.Client{
+		Timeout: knowledgeRefreshFetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if !secutils.IsValidURL(req.URL.String()) {
+				return fmt.Errorf("unsafe redirect URL: %s", req.URL)
+			}
+			return nil
+		},
+	}
+}
+
+// Scan enqueues a refresh task for every URL knowledge whose scheduled refresh is due
+// The task ID is derived from the knowledge ID so a knowledge is never queued twice
+func (s *knowledgeRefreshService) Scan(ctx context.Context, t *asynq.Task) error {
+	knowledges, err := s.repo.ListKnowledgeDueForRefresh(ctx, time.Now(), knowledgeRefreshScanLimit)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to list knowledge due for refresh: %v", err)
+		return err
+	}
+	for _, knowledge := range knowledges {
+		payload, err := json.Marshal(types.KnowledgeRefreshPayload{
+			TenantID:    knowledge.TenantID,
+			KnowledgeID: knowledge.ID,
+		})
+		if err != nil {
+			return err
+		}
+		task := asynq.NewTask(types.TypeKnowledgeRefresh, payload,
+			asynq.TaskID(types.TypeKnowledgeRefresh+":"+knowledge.ID),
+			asynq.MaxRetry(knowledgeRefreshMaxRetry), asynq.Queue("low"))
+		if _, err := s.task.Enqueue(task); err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+			logger.Errorf(ctx, "Failed to enqueue refresh task of knowledge %s: %v", knowledge.ID, err)
+		}
+	}
+	if len(knowledges) > 0 {
+		logger.Infof(ctx, "Knowledge refresh scan enqueued %d knowledge", len(knowledges))
+	}
+	return nil
+}
+
+// Refresh re-fetches the URL of a knowledge and re-ingests it when its content changed
+// Changes are detected by the ETag of the source first and by the hash of the fetched content otherwise
+func (s *knowledgeRefreshService) Refresh(ctx context.Context, t *asynq.Task) error {
+	var p types.KnowledgeRefreshPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		logger.Errorf(ctx, "failed to unmarshal task payload: %v", err)
+		return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+	}
+	requestID := uuid.New().String()
+	ctx = logger.WithRequestID(ctx, requestID)
+	ctx = logger.WithField(ctx, "knowledge", p.KnowledgeID)
+	ctx = context.WithValue(ctx, types.RequestIDContextKey, requestID)
+	ctx = context.WithValue(ctx, types.TenantIDContextKey, p.TenantID)
+
+	knowledge, err := s.repo.GetKnowledgeByID(ctx, p.TenantID, p.KnowledgeID)
+	if err != nil {
+		logger.Warnf(ctx, "ignore refresh of knowledge %s: %v", p.KnowledgeID, err)
+		return nil
+	}
+	if knowledge.Type != "url" || knowledge.RefreshInterval <= 0 {
+		return nil
+	}
+	// The next scan picks the knowledge up again once the running ingestion is done
+	if knowledge.ParseStatus == "pending" || knowledge.ParseStatus == "processing" {
+		logger.Infof(ctx, "Knowledge is being processed, skip refresh, status: %s", knowledge.ParseStatus)
+		return nil
+	}
+
+	etag, contentHash, notModified, err := fetchURL(ctx, s.httpClient, knowledge)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to fetch %s: %v", knowledge.Source, err)
+		retried, _ := asynq.GetRetryCount(ctx)
+		maxRetry, ok := asynq.GetMaxRetry(ctx)
+		if ok && retried >= maxRetry {
+			// Give up this round and try again on the next schedule
+			s.scheduleNext(ctx, knowledge, time.Now(), map[string]interface{}{})
+		}
+		return err
+	}
+
+	// The content hash is recorded when the knowledge is ingested, a knowledge without one is re-ingested
+	now := time.Now()
+	changed := !notModified && contentHash != knowledge.ContentHash
+	columns := map[string]interface{}{"last_checked_at": now}
+	if !notModified {
+		columns["etag"] = etag
+		columns["content_hash"] = contentHash
+	}
+	if !changed {
+		logger.Infof(ctx, "URL content is not changed, not modified: %v", notModified)
+		s.scheduleNext(ctx, knowledge, now, columns)
+		return nil
+	}
+
+	logger.Infof(ctx, "URL content changed, re-ingesting knowledge %s", knowledge.ID)
+	kb, err := s.kbRepo.GetKnowledgeBaseByID(ctx, knowledge.KnowledgeBaseID)
+	if err != nil {
+		logger.Errorf(ctx, "failed to get knowledge base: %v", err)
+		return err
+	}
+	// Only the chunks of a completed ingestion are known to be indexed and can be kept
+	var generation int64
+	if knowledge.ParseStatus == "completed" {
+		generation = knowledge.Generation + 1
+		columns["generation"] = generation
+	}
+	columns["last_changed_at"] = now
+	columns["parse_status"] = "pending"
+	columns["error_message"] = ""
+	columns["stage_progress"] = nil
+	s.scheduleNext(ctx, knowledge, now, columns)
+
+	if err := NewKnowledgeProcessTask(ctx, s.task, types.KnowledgeStageParse, &types.KnowledgeProcessPayload{
+		TenantID:         knowledge.TenantID,
+		KnowledgeID:      knowledge.ID,
+		RequestID:        requestID,
+		EnableMultimodel: kb.ChunkingConfig.EnableMultimodal,
+		Generation:       generation,
+	}); err != nil {
+		// Restore the knowledge so that the retry detects the change again
+		if uerr := s.repo.UpdateKnowledgeColumns(ctx, knowledge.ID, map[string]interface{}{
+			"etag":            knowledge.ETag,
+			"content_hash":    knowledge.ContentHash,
+			"generation":      knowledge.Generation,
+			"last_changed_at": knowledge.LastChangedAt,
+			"parse_status":    knowledge.ParseStatus,
+			"error_message":   knowledge.ErrorMessage,
+			"stage_progress":  knowledge.StageProgress,
+		}); uerr != nil {
+			logger.Errorf(ctx, "Failed to restore knowledge, ID: %s, error: %v", knowledge.ID, uerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// fetchURL fetches the URL of a knowledge with a conditional request on its ETag
+// It returns the new ETag and content hash, or notModified when the source answers 304
+func fetchURL(ctx context.Context, httpClient *http.Client,
+	knowledge *types.Knowledge,
+) (etag string, contentHash string, notModified bool, err error) {
+	if !secutils.IsValidURL(knowledge.Source) {
+		return "", "", false, fmt.Errorf("%w: %s", ErrInvalidURL, knowledge.Source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, knowledge.Source, nil)
+	if err != nil {
+		return "", "", false, err
+	}
+	if knowledge.ETag != "" {
+		req.Header.Set("If-None-Match", knowledge.ETag)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", "", false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return knowledge.ETag, knowledge.ContentHash, true, nil
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return "", "", false, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", "", false, err
+	}
+	return resp.Header.Get("ETag"), hex.EncodeToString(h.Sum(nil)), false, nil
+}
+
+// scheduleNext saves the next refresh time of a knowledge together with the given columns.
+// Only these columns are written so that a concurrent change of the refresh interval is kept
+func (s *knowledgeRefreshService) scheduleNext(ctx context.Context,
+	knowledge *types.Knowledge, now time.Time, columns map[string]interface{},
+) {
+	columns["next_refresh_at"] = now.Add(time.Duration(knowledge.RefreshInterval) * time.Minute)
+	if err := s.repo.UpdateKnowledgeColumns(ctx, knowledge.ID, columns); err != nil {
+		logger.Errorf(ctx, "Failed to update knowledge, ID: %s, error: %v", knowledge.ID, err)
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/hibiken/asynq"
+)
+
+// fakeRefreshKnowledgeRepo returns a single knowledge and records the column updates
+type fakeRefreshKnowledgeRepo struct {
+	interfaces.KnowledgeRepository
+	knowledge *types.Knowledge
+	updates   []map[string]interface{}
+}
+
+func (r *fakeRefreshKnowledgeRepo) GetKnowledgeByID(ctx context.Context,
+	tenantID uint, id string,
+) (*types.Knowledge, error) {
+	knowledge := *r.knowledge
+	return &knowledge, nil
+}
+
+func (r *fakeRefreshKnowledgeRepo) UpdateKnowledgeColumns(ctx context.Context,
+	id string, columns map[string]interface{},
+) error {
+	r.updates = append(r.updates, columns)
+	return nil
+}
+
+// newRefreshSource serves a fixed body with an ETag and answers conditional requests
+func newRefreshSource(t *testing.T, body, etag string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if etag != "" && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newRefreshTask(t *testing.T) *asynq.Task {
+	t.Helper()
+	payload, err := json.Marshal(types.KnowledgeRefreshPayload{TenantID: 1, KnowledgeID: "k1"})
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	return asynq.NewTask(types.TypeKnowledgeRefresh, payload)
+}
+
+func newRefreshKnowledge(source string) *types.Knowledge {
+	return &types.Knowledge{
+		ID:              "k1",
+		TenantID:        1,
+		KnowledgeBaseID: "kb",
+		Type:            "url",
+		Source:          source,
+		ParseStatus:     "completed",
+		RefreshInterval: 60,
+		Generation:      1,
+	}
+}
+
+func TestKnowledgeRefreshUnchanged(t *testing.T) {
+	server := newRefreshSource(t, "content", "")
+	knowledge := newRefreshKnowledge(server.URL)
+	knowledge.ContentHash = calculateStr("content")
+	repo := &fakeRefreshKnowledgeRepo{knowledge: knowledge}
+	s := &knowledgeRefreshService{repo: repo, httpClient: newURLFetchClient()}
+
+	if err := s.Refresh(context.Background(), newRefreshTask(t)); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if len(repo.updates) != 1 {
+		t.Fatalf("Expected a single update, got %v", repo.updates)
+	}
+	columns := repo.updates[0]
+	if columns["next_refresh_at"] == nil || columns["last_checked_at"] == nil {
+		t.Errorf("Expected the next refresh to be scheduled, got %v", columns)
+	}
+	for _, column := range []string{"parse_status", "refresh_interval", "generation"} {
+		if _, ok := columns[column]; ok {
+			t.Errorf("Expected %s not to be written, got %v", column, columns)
+		}
+	}
+}
+
+func TestKnowledgeRefreshNotModified(t *testing.T) {
+	server := newRefreshSource(t, "content", `"v1"`)
+	knowledge := newRefreshKnowledge(server.URL)
+	knowledge.ETag = `"v1"`
+	knowledge.ContentHash = calculateStr("content")
+	repo := &fakeRefreshKnowledgeRepo{knowledge: knowledge}
+	s := &knowledgeRefreshService{repo: repo, httpClient: newURLFetchClient()}
+
+	if err := s.Refresh(context.Background(), newRefreshTask(t)); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if len(repo.updates) != 1 {
+		t.Fatalf("Expected a single update, got %v", repo.updates)
+	}
+	if _, ok := repo.updates[0]["content_hash"]; ok {
+		t.Errorf("Expected the content hash to be kept, got %v", repo.updates[0])
+	}
+}
+
+func TestKnowledgeRefreshChanged(t *testing.T) {
+	// The knowledge was ingested before the source changed, the first check already detects it
+	server := newRefreshSource(t, "new content", "")
+	knowledge := newRefreshKnowledge(server.URL)
+	knowledge.ContentHash = calculateStr("old content")
+	repo := &fakeRefreshKnowledgeRepo{knowledge: knowledge}
+	// The task queue is unreachable so the refresh is rolled back
+	client := asynq.NewClient(asynq.RedisClientOpt{Addr: "127.0.0.1:1"})
+	defer client.Close()
+	s := &knowledgeRefreshService{
+		repo:       repo,
+		kbRepo:     &fakeReindexKBRepo{kb: &types.KnowledgeBase{ID: "kb"}},
+		task:       client,
+		httpClient: newURLFetchClient(),
+	}
+
+	if err := s.Refresh(context.Background(), newRefreshTask(t)); err == nil {
+		t.Fatal("Expected the enqueue error to be returned")
+	}
+	if len(repo.updates) != 2 {
+		t.Fatalf("Expected the change and its rollback, got %v", repo.updates)
+	}
+	changed := repo.updates[0]
+	if changed["parse_status"] != "pending" || changed["generation"] != int64(2) ||
+		changed["content_hash"] != calculateStr("new content") {
+		t.Errorf("Expected the knowledge to be re-ingested with a new generation, got %v", changed)
+	}
+	if _, ok := changed["refresh_interval"]; ok {
+		t.Errorf("Expected the refresh interval not to be written, got %v", changed)
+	}
+	restored := repo.updates[1]
+	if restored["parse_status"] != "completed" || restored["generation"] != int64(1) ||
+		restored["content_hash"] != knowledge.ContentHash {
+		t.Errorf("Expected the knowledge to be restored, got %v", restored)
+	}
+}
+
+func TestRecordURLState(t *testing.T) {
+	server := newRefreshSource(t, "content", `"v1"`)
+	knowledge := newRefreshKnowledge(server.URL)
+	repo := &fakeRefreshKnowledgeRepo{knowledge: knowledge}
+	s := &knowledgeProcessService{repo: repo, httpClient: newURLFetchClient()}
+
+	s.recordURLState(context.Background(), knowledge)
+	if len(repo.updates) != 1 {
+		t.Fatalf("Expected a single update, got %v", repo.updates)
+	}
+	if repo.updates[0]["etag"] != `"v1"` || repo.updates[0]["content_hash"] != calculateStr("content") {
+		t.Errorf("Expected the source state to be recorded, got %v", repo.updates[0])
+	}
+	if knowledge.ContentHash != calculateStr("content") {
+		t.Errorf("Expected the knowledge to be updated, got %s", knowledge.ContentHash)
+	}
+}
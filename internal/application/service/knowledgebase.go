@@ -8,9 +8,7 @@ import (
 	"time"
 
 	"github.com/Tencent/WeKnora/internal/application/service/retriever"
-	"github.com/Tencent/WeKnora/internal/common"
 	"github.com/Tencent/WeKnora/internal/logger"
-	"github.com/Tencent/WeKnora/internal/models/embedding"
 	"github.com/Tencent/WeKnora/internal/types"
 	"github.com/Tencent/WeKnora/internal/types/interfaces"
 	"github.com/google/uuid"
@@ -19,12 +17,19 @@ import (
 // ErrInvalidTenantID represents an error for invalid tenant ID
 var ErrInvalidTenantID = errors.New("invalid tenant ID")
 
+// searchFilterOverfetch multiplies the match count of a search whose filter matches too much knowledge
+// to be passed to the retrieve engines, the results are filtered after retrieval instead
+const searchFilterOverfetch = 5
+
 // knowledgeBaseService implements the knowledge base service interface
 type knowledgeBaseService struct {
-	repo         interfaces.KnowledgeBaseRepository
-	kgRepo       interfaces.KnowledgeRepository
-	chunkRepo    interfaces.ChunkRepository
-	modelService interfaces.ModelService
+	repo           interfaces.KnowledgeBaseRepository
+	kgRepo         interfaces.KnowledgeRepository
+	chunkRepo      interfaces.ChunkRepository
+	modelService   interfaces.ModelService
+	reindexService interfaces.ReindexService
+	graphRepo      interfaces.GraphRepository
+	graphEngine    interfaces.RetrieveGraphRepository
 }
 
 // NewKnowledgeBaseService creates a new knowledge base service
@@ -32,12 +37,18 @@ func NewKnowledgeBaseService(repo interfaces.KnowledgeBaseRepository,
 	kgRepo interfaces.KnowledgeRepository,
 	chunkRepo interfaces.ChunkRepository,
 	modelService interfaces.ModelService,
+	reindexService interfaces.ReindexService,
+	graphRepo interfaces.GraphRepository,
+	graphEngine interfaces.RetrieveGraphRepository,
 ) interfaces.KnowledgeBaseService {
 	return &knowledgeBaseService{
-		repo:         repo,
-		kgRepo:       kgRepo,
-		chunkRepo:    chunkRepo,
-		modelService: modelService,
+		repo:           repo,
+		kgRepo:         kgRepo,
+		chunkRepo:      chunkRepo,
+		modelService:   modelService,
+		reindexService: reindexService,
+		graphRepo:      graphRepo,
+		graphEngine:    graphEngine,
 	}
 }
 
@@ -161,6 +172,20 @@ func (s *knowledgeBaseService) DeleteKnowledgeBase(ctx context.Context, id strin
 
 	logger.Infof(ctx, "Deleting knowledge base, ID: %s", id)
 
+	if err := s.graphRepo.DeleteGraph(ctx, id); err != nil {
+		logger.ErrorWithFields(ctx, err, map[string]interface{}{
+			"knowledge_base_id": id,
+		})
+		return err
+	}
+
+	if err := s.graphEngine.DelGraph(ctx, []types.NameSpace{{KnowledgeBase: id}}); err != nil {
+		logger.ErrorWithFields(ctx, err, map[string]interface{}{
+			"knowledge_base_id": id,
+		})
+		return err
+	}
+
 	err := s.repo.DeleteKnowledgeBase(ctx, id)
 	if err != nil {
 		logger.ErrorWithFields(ctx, err, map[string]interface{}{
@@ -174,15 +199,19 @@ func (s *knowledgeBaseService) DeleteKnowledgeBase(ctx context.Context, id strin
 }
 
 // SetEmbeddingModel sets the embedding model for a knowledge base
-func (s *knowledgeBaseService) SetEmbeddingModel(ctx context.Context, id string, modelID string) error {
+// A knowledge base that already holds chunks keeps its current model until a re-embedding job
+// has embedded every chunk with the new model, the job is returned in that case
+func (s *knowledgeBaseService) SetEmbeddingModel(ctx context.Context,
+	id string, modelID string,
+) (*types.ReindexJob, error) {
 	if id == "" {
 		logger.Error(ctx, "Knowledge base ID is empty")
-		return errors.New("knowledge base ID cannot be empty")
+		return nil, errors.New("knowledge base ID cannot be empty")
 	}
 
 	if modelID == "" {
 		logger.Error(ctx, "Model ID is empty")
-		return errors.New("model ID cannot be empty")
+		return nil, errors.New("model ID cannot be empty")
 	}
 
 	logger.Infof(ctx, "Setting embedding model for knowledge base, knowledge base ID: %s, model ID: %s", id, modelID)
@@ -193,7 +222,23 @@ func (s *knowledgeBaseService) SetEmbeddingModel(ctx context.Context, id string,
 		logger.ErrorWithFields(ctx, err, map[string]interface{}{
 			"knowledge_base_id": id,
 		})
-		return err
+		return nil, err
+	}
+	if kb.EmbeddingModelID == modelID {
+		logger.Info(ctx, "Embedding model unchanged, nothing to do")
+		return nil, nil
+	}
+
+	chunkCount, err := s.chunkRepo.CountEnabledChunksByKnowledgeBaseID(ctx, kb.TenantID, kb.ID)
+	if err != nil {
+		logger.ErrorWithFields(ctx, err, map[string]interface{}{
+			"knowledge_base_id": id,
+		})
+		return nil, err
+	}
+	if chunkCount > 0 {
+		logger.Infof(ctx, "Knowledge base has %d chunks, starting re-embedding job", chunkCount)
+		return s.reindexService.StartReindex(ctx, kb, modelID)
 	}
 
 	// Update the knowledge base's embedding model
@@ -207,7 +252,7 @@ func (s *knowledgeBaseService) SetEmbeddingModel(ctx context.Context, id string,
 			"knowledge_base_id":  id,
 			"embedding_model_id": modelID,
 		})
-		return err
+		return nil, err
 	}
 
 	logger.Infof(
@@ -216,7 +261,7 @@ func (s *knowledgeBaseService) SetEmbeddingModel(ctx context.Context, id string,
 		id,
 		modelID,
 	)
-	return nil
+	return nil, nil
 }
 
 // CopyKnowledgeBase copies a knowledge base to a new knowledge base
@@ -262,7 +307,21 @@ func (s *knowledgeBaseService) HybridSearch(ctx context.Context,
 	id string,
 	params types.SearchParams,
 ) ([]*types.SearchResult, error) {
-	logger.Infof(ctx, "Hybrid search parameters, knowledge base ID: %s, query text: %s", id, params.QueryText)
+	return s.MultiHybridSearch(ctx, []string{id}, params)
+}
+
+// MultiHybridSearch performs hybrid search across several knowledge bases,
+// the query is embedded once for every distinct embedding model used by the knowledge bases
+func (s *knowledgeBaseService) MultiHybridSearch(ctx context.Context,
+	ids []string,
+	params types.SearchParams,
+) ([]*types.SearchResult, error) {
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	if len(ids) == 0 || ids[0] == "" {
+		logger.Error(ctx, "Knowledge base ID is empty")
+		return nil, errors.New("knowledge base ID cannot be empty")
+	}
+	logger.Infof(ctx, "Hybrid search parameters, knowledge base IDs: %v, query text: %s", ids, params.QueryText)
 
 	tenantInfo := ctx.Value(types.TenantInfoContextKey).(*types.Tenant)
 	logger.Infof(ctx, "Creating composite retrieval engine, tenant ID: %d", tenantInfo.ID)
@@ -274,47 +333,80 @@ func (s *knowledgeBaseService) HybridSearch(ctx context.Context,
 		return nil, err
 	}
 
-	var retrieveParams []types.RetrieveParams
-	var embeddingModel embedding.Embedder
-	var kb *types.KnowledgeBase
-
-	// Add vector retrieval params if supported
-	if retrieveEngine.SupportRetriever(types.VectorRetrieverType) {
-		logger.Info(ctx, "Vector retrieval supported, preparing vector retrieval parameters")
-
-		kb, err = s.repo.GetKnowledgeBaseByID(ctx, id)
+	// Only the knowledge bases of the tenant can be searched
+	kbs := make([]*types.KnowledgeBase, 0, len(ids))
+	for _, id := range ids {
+		kb, err := s.repo.GetKnowledgeBaseByID(ctx, id)
 		if err != nil {
 			logger.ErrorWithFields(ctx, err, map[string]interface{}{
 				"knowledge_base_id": id,
 			})
 			return nil, err
 		}
-
-		logger.Infof(ctx, "Getting embedding model, model ID: %s", kb.EmbeddingModelID)
-		embeddingModel, err = s.modelService.GetEmbeddingModel(ctx, kb.EmbeddingModelID)
-		if err != nil {
-			logger.Errorf(ctx, "Failed to get embedding model, model ID: %s, error: %v", kb.EmbeddingModelID, err)
-			return nil, err
+		if kb.TenantID != tenantInfo.ID {
+			logger.Errorf(ctx, "Knowledge base %s does not belong to tenant %d", id, tenantInfo.ID)
+			return nil, types.ErrKnowledgeBaseNotFound
 		}
-		logger.Infof(ctx, "Embedding model retrieved: %v", embeddingModel)
+		kbs = append(kbs, kb)
+	}
 
-		// Generate embedding vector for the query text
-		logger.Info(ctx, "Starting to generate query embedding")
-		queryEmbedding, err := embeddingModel.Embed(ctx, params.QueryText)
-		if err != nil {
-			logger.Errorf(ctx, "Failed to embed query text, query text: %s, error: %v", params.QueryText, err)
-			return nil, err
+	// Resolve the metadata filter into the knowledge to search
+	knowledgeIDs, postFilter, err := s.resolveSearchFilter(ctx, ids, params.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if !params.Filter.IsEmpty() && !postFilter && len(knowledgeIDs) == 0 {
+		logger.Info(ctx, "No knowledge matches the search filter")
+		return nil, nil
+	}
+	topK := params.MatchCount
+	if postFilter {
+		topK *= searchFilterOverfetch
+	}
+
+	var retrieveParams []types.RetrieveParams
+
+	// Add vector retrieval params if supported
+	if retrieveEngine.SupportRetriever(types.VectorRetrieverType) {
+		logger.Info(ctx, "Vector retrieval supported, preparing vector retrieval parameters")
+
+		// Group knowledge bases by embedding model, vectors of different models are not comparable
+		var modelIDs []string
+		kbIDsByModel := make(map[string][]string)
+		for _, kb := range kbs {
+			if _, ok := kbIDsByModel[kb.EmbeddingModelID]; !ok {
+				modelIDs = append(modelIDs, kb.EmbeddingModelID)
+			}
+			kbIDsByModel[kb.EmbeddingModelID] = append(kbIDsByModel[kb.EmbeddingModelID], kb.ID)
 		}
-		logger.Infof(ctx, "Query embedding generated successfully, embedding vector length: %d", len(queryEmbedding))
 
-		retrieveParams = append(retrieveParams, types.RetrieveParams{
-			Query:            params.QueryText,
-			Embedding:        queryEmbedding,
-			KnowledgeBaseIDs: []string{id},
-			TopK:             params.MatchCount,
-			Threshold:        params.VectorThreshold,
-			RetrieverType:    types.VectorRetrieverType,
-		})
+		for _, modelID := range modelIDs {
+			logger.Infof(ctx, "Getting embedding model, model ID: %s", modelID)
+			embeddingModel, err := s.modelService.GetEmbeddingModel(ctx, modelID)
+			if err != nil {
+				logger.Errorf(ctx, "Failed to get embedding model, model ID: %s, error: %v", modelID, err)
+				return nil, err
+			}
+
+			// Generate embedding vector for the query text
+			logger.Infof(ctx, "Starting to generate query embedding, model ID: %s", modelID)
+			queryEmbedding, err := embeddingModel.Embed(ctx, params.QueryText)
+			if err != nil {
+				logger.Errorf(ctx, "Failed to embed query text, query text: %s, error: %v", params.QueryText, err)
+				return nil, err
+			}
+			logger.Infof(ctx, "Query embedding generated successfully, embedding vector length: %d", len(queryEmbedding))
+
+			retrieveParams = append(retrieveParams, types.RetrieveParams{
+				Query:            params.QueryText,
+				Embedding:        queryEmbedding,
+				KnowledgeBaseIDs: kbIDsByModel[modelID],
+				KnowledgeIDs:     knowledgeIDs,
+				TopK:             topK,
+				Threshold:        params.VectorThreshold,
+				RetrieverType:    types.VectorRetrieverType,
+			})
+		}
 		logger.Info(ctx, "Vector retrieval parameters setup completed")
 	}
 
@@ -323,8 +415,9 @@ func (s *knowledgeBaseService) HybridSearch(ctx context.Context,
 		logger.Info(ctx, "Keyword retrieval supported, preparing keyword retrieval parameters")
 		retrieveParams = append(retrieveParams, types.RetrieveParams{
 			Query:            params.QueryText,
-			KnowledgeBaseIDs: []string{id},
-			TopK:             params.MatchCount,
+			KnowledgeBaseIDs: ids,
+			KnowledgeIDs:     knowledgeIDs,
+			TopK:             topK,
 			Threshold:        params.KeywordThreshold,
 			RetrieverType:    types.KeywordsRetrieverType,
 		})
@@ -341,38 +434,127 @@ func (s *knowledgeBaseService) HybridSearch(ctx context.Context,
 	retrieveResults, err := retrieveEngine.Retrieve(ctx, retrieveParams)
 	if err != nil {
 		logger.ErrorWithFields(ctx, err, map[string]interface{}{
-			"knowledge_base_id": id,
-			"query_text":        params.QueryText,
+			"knowledge_base_ids": ids,
+			"query_text":         params.QueryText,
 		})
 		return nil, err
 	}
 
-	// Collect all results from different retrievers and deduplicate by chunk ID
+	// Fuse results from different retrievers and deduplicate by chunk ID
 	logger.Infof(ctx, "Processing retrieval results")
-	matchResults := []*types.IndexWithScore{}
+	matchCount := 0
 	for _, retrieveResult := range retrieveResults {
 		logger.Infof(ctx, "Retrieval results, engine: %v, retriever: %v, count: %v",
 			retrieveResult.RetrieverEngineType,
 			retrieveResult.RetrieverType,
 			len(retrieveResult.Results),
 		)
-		matchResults = append(matchResults, retrieveResult.Results...)
+		matchCount += len(retrieveResult.Results)
 	}
 
 	// Early return if no results
-	if len(matchResults) == 0 {
+	if matchCount == 0 {
 		logger.Info(ctx, "No search results found")
 		return nil, nil
 	}
 
-	// Deduplicate results by chunk ID
-	logger.Infof(ctx, "Result count before deduplication: %d", len(matchResults))
-	deduplicatedChunks := common.Deduplicate(func(r *types.IndexWithScore) string { return r.ChunkID }, matchResults...)
-	logger.Infof(ctx, "Result count after deduplication: %d", len(deduplicatedChunks))
+	// Scores of different knowledge bases are not comparable, normalize them per knowledge base
+	if len(ids) > 1 {
+		retrieveResults = retriever.NormalizeByKnowledgeBase(retrieveResults)
+	}
+
+	logger.Infof(ctx, "Result count before fusion: %d, fusion strategy: %s", matchCount, params.FusionStrategy)
+	deduplicatedChunks := retriever.FuseRetrieveResults(retrieveResults, retriever.FusionParams{
+		Strategy:      params.FusionStrategy,
+		VectorWeight:  params.VectorWeight,
+		KeywordWeight: params.KeywordWeight,
+	})
+	logger.Infof(ctx, "Result count after fusion: %d", len(deduplicatedChunks))
+
+	if postFilter {
+		deduplicatedChunks, err = s.filterSearchResults(ctx, ids, params.Filter, deduplicatedChunks)
+		if err != nil {
+			return nil, err
+		}
+		if params.MatchCount > 0 && len(deduplicatedChunks) > params.MatchCount {
+			deduplicatedChunks = deduplicatedChunks[:params.MatchCount]
+		}
+		logger.Infof(ctx, "Result count after filtering: %d", len(deduplicatedChunks))
+	}
 
 	return s.processSearchResults(ctx, deduplicatedChunks)
 }
 
+// resolveSearchFilter returns the IDs of the knowledge matching the search filter,
+// conditions on knowledge attributes are resolved against the knowledge table.
+// A filter matching more than MaxSearchFilterKnowledge knowledge is not passed to the retrieve engines,
+// postFilter is then true and the results must be filtered with filterSearchResults
+func (s *knowledgeBaseService) resolveSearchFilter(ctx context.Context,
+	kbIDs []string, filter *types.SearchFilter,
+) (knowledgeIDs []string, postFilter bool, err error) {
+	if filter.IsEmpty() {
+		return nil, false, nil
+	}
+	if !filter.HasKnowledgeConditions() {
+		if len(filter.KnowledgeIDs) > types.MaxSearchFilterKnowledge {
+			logger.Warnf(ctx, "Search filter lists more than %d knowledge, filtering the results instead",
+				types.MaxSearchFilterKnowledge)
+			return nil, true, nil
+		}
+		return filter.KnowledgeIDs, false, nil
+	}
+
+	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
+	knowledgeIDs, err = s.kgRepo.ListKnowledgeIDsByFilter(ctx,
+		tenantID, kbIDs, filter, types.MaxSearchFilterKnowledge+1)
+	if err != nil {
+		logger.ErrorWithFields(ctx, err, map[string]interface{}{
+			"knowledge_base_ids": kbIDs,
+			"filter":             filter,
+		})
+		return nil, false, err
+	}
+	if len(knowledgeIDs) > types.MaxSearchFilterKnowledge {
+		logger.Warnf(ctx, "Search filter matches more than %d knowledge, filtering the results instead",
+			types.MaxSearchFilterKnowledge)
+		return nil, true, nil
+	}
+	logger.Infof(ctx, "Search filter resolved, knowledge count: %d", len(knowledgeIDs))
+	return knowledgeIDs, false, nil
+}
+
+// filterSearchResults keeps the results whose knowledge matches the search filter,
+// only the knowledge of the results is checked against the knowledge table
+func (s *knowledgeBaseService) filterSearchResults(ctx context.Context,
+	kbIDs []string, filter *types.SearchFilter, chunks []*types.IndexWithScore,
+) ([]*types.IndexWithScore, error) {
+	var candidates []string
+	for _, chunk := range chunks {
+		if !slices.Contains(candidates, chunk.KnowledgeID) &&
+			(len(filter.KnowledgeIDs) == 0 || slices.Contains(filter.KnowledgeIDs, chunk.KnowledgeID)) {
+			candidates = append(candidates, chunk.KnowledgeID)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	candidateFilter := *filter
+	candidateFilter.KnowledgeIDs = candidates
+	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
+	knowledgeIDs, err := s.kgRepo.ListKnowledgeIDsByFilter(ctx, tenantID, kbIDs, &candidateFilter, len(candidates))
+	if err != nil {
+		logger.ErrorWithFields(ctx, err, map[string]interface{}{
+			"knowledge_base_ids": kbIDs,
+			"filter":             filter,
+		})
+		return nil, err
+	}
+	return slices.DeleteFunc(chunks, func(chunk *types.IndexWithScore) bool {
+		return !slices.Contains(knowledgeIDs, chunk.KnowledgeID)
+	}), nil
+}
+
 // processSearchResults handles the processing of search results, optimizing database queries
 func (s *knowledgeBaseService) processSearchResults(ctx context.Context,
 	chunks []*types.IndexWithScore,
@@ -430,6 +612,20 @@ func (s *knowledgeBaseService) processSearchResults(ctx context.Context,
 		chunkMap[chunk.ID] = chunk
 		processedChunkIDs[chunk.ID] = true
 
+		// A child chunk of the parent_child strategy is answered with its parent section,
+		// which takes the best score and match type of its children
+		if isChildChunk(chunk) {
+			if !processedChunkIDs[chunk.ParentChunkID] {
+				additionalChunkIDs = append(additionalChunkIDs, chunk.ParentChunkID)
+				processedChunkIDs[chunk.ParentChunkID] = true
+			}
+			if score, ok := chunkScores[chunk.ParentChunkID]; !ok || chunkScores[chunk.ID] > score {
+				chunkScores[chunk.ParentChunkID] = chunkScores[chunk.ID]
+				chunkMatchTypes[chunk.ParentChunkID] = chunkMatchTypes[chunk.ID]
+			}
+			continue
+		}
+
 		// Collect parent chunks
 		if chunk.ParentChunkID != "" && !processedChunkIDs[chunk.ParentChunkID] {
 			additionalChunkIDs = append(additionalChunkIDs, chunk.ParentChunkID)
@@ -483,6 +679,10 @@ func (s *knowledgeBaseService) processSearchResults(ctx context.Context,
 		if !s.isValidTextChunk(chunk) {
 			continue
 		}
+		// Child chunks are replaced by their parent unless the parent could not be fetched
+		if _, ok := chunkMap[chunk.ParentChunkID]; ok && isChildChunk(chunk) {
+			continue
+		}
 
 		score, hasScore := chunkScores[chunkID]
 		if !hasScore || score <= 0 {
@@ -551,10 +751,15 @@ func (s *knowledgeBaseService) buildSearchResult(chunk *types.Chunk,
 // isValidTextChunk checks if a chunk is a valid text chunk
 func (s *knowledgeBaseService) isValidTextChunk(chunk *types.Chunk) bool {
 	return slices.Contains([]types.ChunkType{
-		types.ChunkTypeText, types.ChunkTypeSummary,
+		types.ChunkTypeText, types.ChunkTypeParentText, types.ChunkTypeSummary,
 	}, chunk.ChunkType)
 }
 
+// isChildChunk checks if a chunk is a child chunk of the parent_child strategy
+func isChildChunk(chunk *types.Chunk) bool {
+	return chunk.ChunkType == types.ChunkTypeText && chunk.ParentChunkID != ""
+}
+
 // fetchKnowledgeData gets knowledge data in batch
 func (s *knowledgeBaseService) fetchKnowledgeData(ctx context.Context,
 	tenantID uint,
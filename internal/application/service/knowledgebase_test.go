@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+)
+
+// fakeFilterKnowledgeRepo matches the knowledge k0 to k<matches-1>, up to the limit
+type fakeFilterKnowledgeRepo struct {
+	interfaces.KnowledgeRepository
+	matches int
+	limit   int
+}
+
+func (r *fakeFilterKnowledgeRepo) ListKnowledgeIDsByFilter(ctx context.Context,
+	tenantID uint, kbIDs []string, filter *types.SearchFilter, limit int,
+) ([]string, error) {
+	r.limit = limit
+	ids := make([]string, 0, min(r.matches, limit))
+	for i := 0; i < r.matches && len(ids) < limit; i++ {
+		id := fmt.Sprintf("k%d", i)
+		if len(filter.KnowledgeIDs) == 0 || slices.Contains(filter.KnowledgeIDs, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func TestResolveSearchFilter(t *testing.T) {
+	ctx := context.WithValue(context.Background(), types.TenantIDContextKey, uint(1))
+	filter := &types.SearchFilter{FileTypes: []string{"pdf"}}
+
+	repo := &fakeFilterKnowledgeRepo{matches: 3}
+	s := &knowledgeBaseService{kgRepo: repo}
+	ids, postFilter, err := s.resolveSearchFilter(ctx, []string{"kb"}, filter)
+	if err != nil || postFilter || len(ids) != 3 {
+		t.Fatalf("Expected the matching knowledge, got %v, %v, %v", ids, postFilter, err)
+	}
+	if repo.limit != types.MaxSearchFilterKnowledge+1 {
+		t.Errorf("Expected the query to be bounded, got limit %d", repo.limit)
+	}
+
+	// A filter matching too much knowledge is applied to the results instead
+	repo.matches = types.MaxSearchFilterKnowledge + 1
+	ids, postFilter, err = s.resolveSearchFilter(ctx, []string{"kb"}, filter)
+	if err != nil || !postFilter || ids != nil {
+		t.Errorf("Expected the results to be filtered, got %d IDs, %v, %v", len(ids), postFilter, err)
+	}
+
+	ids, postFilter, err = s.resolveSearchFilter(ctx, []string{"kb"}, &types.SearchFilter{KnowledgeIDs: []string{"k1"}})
+	if err != nil || postFilter || !reflect.DeepEqual(ids, []string{"k1"}) {
+		t.Errorf("Expected the knowledge IDs of the filter, got %v, %v, %v", ids, postFilter, err)
+	}
+}
+
+func TestFilterSearchResults(t *testing.T) {
+	ctx := context.WithValue(context.Background(), types.TenantIDContextKey, uint(1))
+	repo := &fakeFilterKnowledgeRepo{matches: 2}
+	s := &knowledgeBaseService{kgRepo: repo}
+	chunks := []*types.IndexWithScore{
+		{ChunkID: "c1", KnowledgeID: "k1"},
+		{ChunkID: "c2", KnowledgeID: "k5"},
+		{ChunkID: "c3", KnowledgeID: "k0"},
+		{ChunkID: "c4", KnowledgeID: "k1"},
+	}
+
+	filtered, err := s.filterSearchResults(ctx, []string{"kb"}, &types.SearchFilter{FileTypes: []string{"pdf"}}, chunks)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var ids []string
+	for _, chunk := range filtered {
+		ids = append(ids, chunk.ChunkID)
+	}
+	if !reflect.DeepEqual(ids, []string{"c1", "c3", "c4"}) {
+		t.Errorf("Expected the chunks of the matching knowledge in their order, got %v", ids)
+	}
+	// Only the knowledge of the results is looked up
+	if repo.limit != 3 {
+		t.Errorf("Expected the 3 distinct knowledge of the results to be checked, got limit %d", repo.limit)
+	}
+}
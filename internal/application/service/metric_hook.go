@@ -17,40 +17,43 @@ type MetricList struct {
 
 // metricCalculators defines all metrics to be calculated
 var metricCalculators = []struct {
+	name     string                             // Metric name, same as the JSON field name of the result
 	calc     interfaces.Metrics                 // Metric calculator implementation
 	getField func(*types.MetricResult) *float64 // Field accessor for result
 }{
 	// Retrieval Metrics
-	{metric.NewPrecisionMetric(), func(r *types.MetricResult) *float64 { return &r.RetrievalMetrics.Precision }},
-	{metric.NewRecallMetric(), func(r *types.MetricResult) *float64 { return &r.RetrievalMetrics.Recall }},
-	{metric.NewNDCGMetric(3), func(r *types.MetricResult) *float64 { return &r.RetrievalMetrics.NDCG3 }},
-	{metric.NewNDCGMetric(10), func(r *types.MetricResult) *float64 { return &r.RetrievalMetrics.NDCG10 }},
-	{metric.NewMRRMetric(), func(r *types.MetricResult) *float64 { return &r.RetrievalMetrics.MRR }},
-	{metric.NewMAPMetric(), func(r *types.MetricResult) *float64 { return &r.RetrievalMetrics.MAP }},
+	{"precision", metric.NewPrecisionMetric(), func(r *types.MetricResult) *float64 {
+		return &r.RetrievalMetrics.Precision
+	}},
+	{"recall", metric.NewRecallMetric(), func(r *types.MetricResult) *float64 { return &r.RetrievalMetrics.Recall }},
+	{"ndcg3", metric.NewNDCGMetric(3), func(r *types.MetricResult) *float64 { return &r.RetrievalMetrics.NDCG3 }},
+	{"ndcg10", metric.NewNDCGMetric(10), func(r *types.MetricResult) *float64 { return &r.RetrievalMetrics.NDCG10 }},
+	{"mrr", metric.NewMRRMetric(), func(r *types.MetricResult) *float64 { return &r.RetrievalMetrics.MRR }},
+	{"map", metric.NewMAPMetric(), func(r *types.MetricResult) *float64 { return &r.RetrievalMetrics.MAP }},
 
 	// Generation Metrics
-	{metric.NewBLEUMetric(true, metric.BLEU1Gram), func(r *types.MetricResult) *float64 {
+	{"bleu1", metric.NewBLEUMetric(true, metric.BLEU1Gram), func(r *types.MetricResult) *float64 {
 		return &r.GenerationMetrics.BLEU1
 	}},
-	{metric.NewBLEUMetric(true, metric.BLEU2Gram), func(r *types.MetricResult) *float64 {
+	{"bleu2", metric.NewBLEUMetric(true, metric.BLEU2Gram), func(r *types.MetricResult) *float64 {
 		return &r.GenerationMetrics.BLEU2
 	}},
-	{metric.NewBLEUMetric(true, metric.BLEU4Gram), func(r *types.MetricResult) *float64 {
+	{"bleu4", metric.NewBLEUMetric(true, metric.BLEU4Gram), func(r *types.MetricResult) *float64 {
 		return &r.GenerationMetrics.BLEU4
 	}},
-	{metric.NewRougeMetric(true, "rouge-1", "f"), func(r *types.MetricResult) *float64 {
+	{"rouge1", metric.NewRougeMetric(true, "rouge-1", "f"), func(r *types.MetricResult) *float64 {
 		return &r.GenerationMetrics.ROUGE1
 	}},
-	{metric.NewRougeMetric(true, "rouge-2", "f"), func(r *types.MetricResult) *float64 {
+	{"rouge2", metric.NewRougeMetric(true, "rouge-2", "f"), func(r *types.MetricResult) *float64 {
 		return &r.GenerationMetrics.ROUGE2
 	}},
-	{metric.NewRougeMetric(true, "rouge-l", "f"), func(r *types.MetricResult) *float64 {
+	{"rougel", metric.NewRougeMetric(true, "rouge-l", "f"), func(r *types.MetricResult) *float64 {
 		return &r.GenerationMetrics.ROUGEL
 	}},
 }
 
-// Append calculates and stores metrics for given input
-func (m *MetricList) Append(metricInput *types.MetricInput) {
+// Append calculates and stores metrics for given input, returning the metrics of the input
+func (m *MetricList) Append(metricInput *types.MetricInput) *types.MetricResult {
 	result := &types.MetricResult{}
 	// Calculate all configured metrics
 	for _, c := range metricCalculators {
@@ -59,6 +62,7 @@ func (m *MetricList) Append(metricInput *types.MetricInput) {
 	}
 	logger.Infof(context.Background(), "metric: %v", result)
 	m.results = append(m.results, result)
+	return result
 }
 
 // Avg calculates average of all stored metric results
@@ -131,8 +135,8 @@ func (h *HookMetric) recordChatResponse(index int, chatResponse *types.ChatRespo
 	h.qaPairMetricList[index].chatResponse = chatResponse
 }
 
-// recordFinish finalizes metrics for a QA pair
-func (h *HookMetric) recordFinish(index int) {
+// recordFinish finalizes metrics for a QA pair and returns its metric input and metrics
+func (h *HookMetric) recordFinish(index int) (*types.MetricInput, *types.MetricResult) {
 	// Prepare retrieval IDs from rerank results
 	retrievalIDs := make([]int, len(h.qaPairMetricList[index].rerankResult))
 	for i, r := range h.qaPairMetricList[index].rerankResult {
@@ -156,7 +160,7 @@ func (h *HookMetric) recordFinish(index int) {
 	// Thread-safe append of metrics
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.metricResults.Append(metricInput)
+	return metricInput, h.metricResults.Append(metricInput)
 }
 
 // MetricResult returns the averaged metric results
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 
+	"github.com/Tencent/WeKnora/internal/config"
 	"github.com/Tencent/WeKnora/internal/logger"
 	"github.com/Tencent/WeKnora/internal/models/chat"
 	"github.com/Tencent/WeKnora/internal/models/embedding"
 	"github.com/Tencent/WeKnora/internal/models/rerank"
+	"github.com/Tencent/WeKnora/internal/models/route"
 	"github.com/Tencent/WeKnora/internal/models/utils/ollama"
 	"github.com/Tencent/WeKnora/internal/types"
 	"github.com/Tencent/WeKnora/internal/types/interfaces"
@@ -16,18 +18,45 @@ import (
 // ErrModelNotFound is returned when a model cannot be found in the repository
 var ErrModelNotFound = errors.New("model not found")
 
+// ErrInvalidModelRoute is returned when the models of a route cannot be grouped
+var ErrInvalidModelRoute = errors.New("invalid model route")
+
 // modelService implements the model service interface
 type modelService struct {
 	repo          interfaces.ModelRepository
 	ollamaService *ollama.OllamaService
+	usageService  interfaces.UsageService
+	quotaLimiter  interfaces.QuotaLimiter
+	router        *route.Router
 }
 
 // NewModelService creates a new model service instance
-func NewModelService(repo interfaces.ModelRepository, ollamaService *ollama.OllamaService) interfaces.ModelService {
+func NewModelService(cfg *config.Config, repo interfaces.ModelRepository,
+	ollamaService *ollama.OllamaService, usageService interfaces.UsageService,
+	quotaLimiter interfaces.QuotaLimiter,
+) interfaces.ModelService {
+	var router *route.Router
+	if cfg.ModelRoute != nil {
+		router = route.NewRouter(cfg.ModelRoute.FailureThreshold, cfg.ModelRoute.OpenDuration)
+	} else {
+		router = route.NewRouter(0, 0)
+	}
 	return &modelService{
 		repo:          repo,
 		ollamaService: ollamaService,
+		usageService:  usageService,
+		quotaLimiter:  quotaLimiter,
+		router:        router,
+	}
+}
+
+// isRemoteModelSource returns whether models of a source are served by a remote API and need no download
+func isRemoteModelSource(source types.ModelSource) bool {
+	switch source {
+	case types.ModelSourceRemote, types.ModelSourceAnthropic, types.ModelSourceGemini, types.ModelSourceAzureOpenAI:
+		return true
 	}
+	return false
 }
 
 // CreateModel creates a new model in the repository
@@ -37,8 +66,32 @@ func (s *modelService) CreateModel(ctx context.Context, model *types.Model) erro
 	logger.Info(ctx, "Start creating model")
 	logger.Infof(ctx, "Creating model: %s, type: %s, source: %s", model.Name, model.Type, model.Source)
 
-	// Handle remote models (e.g., OpenAI, Azure)
-	if model.Source == types.ModelSourceRemote {
+	// Handle model routes, which are ready as soon as their models are
+	if model.Source == types.ModelSourceRoute {
+		if err := s.validateModelRoute(ctx, model); err != nil {
+			logger.ErrorWithFields(ctx, err, map[string]interface{}{
+				"model_name": model.Name,
+				"model_type": model.Type,
+			})
+			return err
+		}
+		model.Status = types.ModelStatusActive
+
+		logger.Info(ctx, "Saving model route to repository")
+		if err := s.repo.Create(ctx, model); err != nil {
+			logger.ErrorWithFields(ctx, err, map[string]interface{}{
+				"model_name": model.Name,
+				"model_type": model.Type,
+			})
+			return err
+		}
+
+		logger.Infof(ctx, "Model route created successfully: %s", model.ID)
+		return nil
+	}
+
+	// Handle remote models (e.g., OpenAI, Azure, Anthropic, Gemini)
+	if isRemoteModelSource(model.Source) {
 		logger.Info(ctx, "Remote model detected, setting status to active")
 		model.Status = types.ModelStatusActive
 
@@ -165,6 +218,16 @@ func (s *modelService) UpdateModel(ctx context.Context, model *types.Model) erro
 	logger.Info(ctx, "Start updating model")
 	logger.Infof(ctx, "Updating model ID: %s, name: %s", model.ID, model.Name)
 
+	if model.Source == types.ModelSourceRoute {
+		if err := s.validateModelRoute(ctx, model); err != nil {
+			logger.ErrorWithFields(ctx, err, map[string]interface{}{
+				"model_id":   model.ID,
+				"model_name": model.Name,
+			})
+			return err
+		}
+	}
+
 	// Update model in repository
 	err := s.repo.Update(ctx, model)
 	if err != nil {
@@ -216,6 +279,14 @@ func (s *modelService) GetEmbeddingModel(ctx context.Context, modelId string) (e
 		return nil, err
 	}
 
+	if model.Source == types.ModelSourceRoute {
+		return s.newEmbeddingRoute(ctx, model)
+	}
+	return s.newEmbeddingModel(ctx, model)
+}
+
+// newEmbeddingModel initializes the embedder of a model
+func (s *modelService) newEmbeddingModel(ctx context.Context, model *types.Model) (embedding.Embedder, error) {
 	logger.Info(ctx, "Creating embedder instance")
 	logger.Infof(ctx, "Model name: %s, source: %s", model.Name, model.Source)
 
@@ -238,7 +309,7 @@ func (s *modelService) GetEmbeddingModel(ctx context.Context, modelId string) (e
 	}
 
 	logger.Info(ctx, "Embedding model initialized successfully")
-	return embedder, nil
+	return &meteredEmbedder{Embedder: embedder, usageService: s.usageService, quotaLimiter: s.quotaLimiter}, nil
 }
 
 // GetRerankModel retrieves and initializes a reranking model instance
@@ -256,6 +327,14 @@ func (s *modelService) GetRerankModel(ctx context.Context, modelId string) (rera
 		return nil, err
 	}
 
+	if model.Source == types.ModelSourceRoute {
+		return s.newRerankRoute(ctx, model)
+	}
+	return s.newRerankModel(ctx, model)
+}
+
+// newRerankModel initializes the reranker of a model
+func (s *modelService) newRerankModel(ctx context.Context, model *types.Model) (rerank.Reranker, error) {
 	logger.Info(ctx, "Creating reranker instance")
 	logger.Infof(ctx, "Model name: %s, source: %s", model.Name, model.Source)
 
@@ -276,7 +355,7 @@ func (s *modelService) GetRerankModel(ctx context.Context, modelId string) (rera
 	}
 
 	logger.Info(ctx, "Rerank model initialized successfully")
-	return reranker, nil
+	return &meteredReranker{Reranker: reranker, usageService: s.usageService, quotaLimiter: s.quotaLimiter}, nil
 }
 
 // GetChatModel retrieves and initializes a chat model instance
@@ -303,16 +382,27 @@ func (s *modelService) GetChatModel(ctx context.Context, modelId string) (chat.C
 		return nil, ErrModelNotFound
 	}
 
+	if model.Source == types.ModelSourceRoute {
+		return s.newChatRoute(ctx, model)
+	}
+	return s.newChatModel(ctx, model)
+}
+
+// newChatModel initializes the chat model of a model
+func (s *modelService) newChatModel(ctx context.Context, model *types.Model) (chat.Chat, error) {
 	logger.Info(ctx, "Creating chat model instance")
 	logger.Infof(ctx, "Model name: %s, source: %s", model.Name, model.Source)
 
 	// Initialize the chat model with model configuration
 	chatModel, err := chat.NewChat(&chat.ChatConfig{
-		ModelID:   model.ID,
-		APIKey:    model.Parameters.APIKey,
-		BaseURL:   model.Parameters.BaseURL,
-		ModelName: model.Name,
-		Source:    model.Source,
+		ModelID:    model.ID,
+		APIKey:     model.Parameters.APIKey,
+		BaseURL:    model.Parameters.BaseURL,
+		ModelName:  model.Name,
+		Source:     model.Source,
+		APIVersion: model.Parameters.APIVersion,
+		// Streamed answers of models without stream usage are not metered
+		NoStreamUsage: model.Parameters.NoStreamUsage,
 	})
 	if err != nil {
 		logger.ErrorWithFields(ctx, err, map[string]interface{}{
@@ -323,5 +413,5 @@ func (s *modelService) GetChatModel(ctx context.Context, modelId string) (chat.C
 	}
 
 	logger.Info(ctx, "Chat model initialized successfully")
-	return chatModel, nil
+	return &meteredChat{model: chatModel, usageService: s.usageService, quotaLimiter: s.quotaLimiter}, nil
 }
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/models/chat"
+	"github.com/Tencent/WeKnora/internal/models/embedding"
+	"github.com/Tencent/WeKnora/internal/models/rerank"
+	"github.com/Tencent/WeKnora/internal/models/route"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// validateModelRoute checks that the models of a route exist and can be grouped: they have the type of
+// the route, are not routes themselves and, for embedding routes, have identical dimensions.
+// The dimensions of an embedding route default to the ones of its models
+func (s *modelService) validateModelRoute(ctx context.Context, model *types.Model) error {
+	modelRoute := model.Parameters.Route
+	if modelRoute == nil || len(modelRoute.Targets) == 0 {
+		return fmt.Errorf("%w: a route needs at least one model", ErrInvalidModelRoute)
+	}
+	switch model.Type {
+	case types.ModelTypeKnowledgeQA, types.ModelTypeEmbedding, types.ModelTypeRerank:
+	default:
+		return fmt.Errorf("%w: %s models cannot be routed", ErrInvalidModelRoute, model.Type)
+	}
+	switch modelRoute.Strategy {
+	case "":
+		modelRoute.Strategy = types.ModelRouteStrategyPriority
+	case types.ModelRouteStrategyPriority, types.ModelRouteStrategyWeighted:
+	default:
+		return fmt.Errorf("%w: unknown strategy %s", ErrInvalidModelRoute, modelRoute.Strategy)
+	}
+
+	dimension := 0
+	seen := make(map[string]bool, len(modelRoute.Targets))
+	for _, target := range modelRoute.Targets {
+		if target.ModelID == model.ID || seen[target.ModelID] {
+			return fmt.Errorf("%w: model %s is repeated", ErrInvalidModelRoute, target.ModelID)
+		}
+		seen[target.ModelID] = true
+		if target.Weight < 0 {
+			return fmt.Errorf("%w: model %s has a negative weight", ErrInvalidModelRoute, target.ModelID)
+		}
+
+		member, err := s.repo.GetByID(ctx, model.TenantID, target.ModelID)
+		if err != nil {
+			return err
+		}
+		if member == nil {
+			return fmt.Errorf("%w: model %s not found", ErrInvalidModelRoute, target.ModelID)
+		}
+		if member.Type != model.Type {
+			return fmt.Errorf("%w: model %s is a %s model, the route is a %s model",
+				ErrInvalidModelRoute, member.ID, member.Type, model.Type)
+		}
+		if member.Source == types.ModelSourceRoute {
+			return fmt.Errorf("%w: model %s is a route", ErrInvalidModelRoute, member.ID)
+		}
+
+		if model.Type != types.ModelTypeEmbedding {
+			continue
+		}
+		memberDimension := member.Parameters.EmbeddingParameters.Dimension
+		if dimension != 0 && memberDimension != dimension {
+			return fmt.Errorf("%w: model %s has %d dimensions, other models of the route have %d",
+				ErrInvalidModelRoute, member.ID, memberDimension, dimension)
+		}
+		dimension = memberDimension
+	}
+
+	if model.Type == types.ModelTypeEmbedding {
+		routeDimension := model.Parameters.EmbeddingParameters.Dimension
+		if routeDimension != 0 && routeDimension != dimension {
+			return fmt.Errorf("%w: the route has %d dimensions, its models have %d",
+				ErrInvalidModelRoute, routeDimension, dimension)
+		}
+		model.Parameters.EmbeddingParameters.Dimension = dimension
+	}
+	return nil
+}
+
+// routeModels returns the active models of a route, models that are gone or not ready are left out
+func (s *modelService) routeModels(ctx context.Context, model *types.Model) []*types.Model {
+	var members []*types.Model
+	if model.Parameters.Route == nil {
+		return members
+	}
+	for _, target := range model.Parameters.Route.Targets {
+		member, err := s.GetModelByID(ctx, target.ModelID)
+		if err != nil {
+			logger.Warnf(ctx, "Model %s of route %s is unavailable: %v", target.ModelID, model.ID, err)
+			continue
+		}
+		if member.Source == types.ModelSourceRoute {
+			logger.Warnf(ctx, "Model %s of route %s is a route, skipped", member.ID, model.ID)
+			continue
+		}
+		members = append(members, member)
+	}
+	return members
+}
+
+// newChatRoute initializes the chat model of a route over its models
+func (s *modelService) newChatRoute(ctx context.Context, model *types.Model) (chat.Chat, error) {
+	logger.Infof(ctx, "Creating chat model route: %s", model.Name)
+	clients := make(map[string]chat.Chat)
+	for _, member := range s.routeModels(ctx, model) {
+		client, err := s.newChatModel(ctx, member)
+		if err != nil {
+			logger.Warnf(ctx, "Model %s of route %s cannot be initialized: %v", member.ID, model.ID, err)
+			continue
+		}
+		clients[member.ID] = client
+	}
+	if len(clients) == 0 {
+		return nil, route.ErrNoTarget
+	}
+	return route.NewChat(model, s.router, clients), nil
+}
+
+// newEmbeddingRoute initializes the embedder of a route over its models
+func (s *modelService) newEmbeddingRoute(ctx context.Context, model *types.Model) (embedding.Embedder, error) {
+	logger.Infof(ctx, "Creating embedding model route: %s", model.Name)
+	clients := make(map[string]embedding.Embedder)
+	for _, member := range s.routeModels(ctx, model) {
+		client, err := s.newEmbeddingModel(ctx, member)
+		if err != nil {
+			logger.Warnf(ctx, "Model %s of route %s cannot be initialized: %v", member.ID, model.ID, err)
+			continue
+		}
+		clients[member.ID] = client
+	}
+	embedder, err := route.NewEmbedder(model, s.router, clients)
+	if err != nil {
+		logger.ErrorWithFields(ctx, err, map[string]interface{}{
+			"model_id":   model.ID,
+			"model_name": model.Name,
+		})
+		return nil, err
+	}
+	return embedder, nil
+}
+
+// newRerankRoute initializes the reranker of a route over its models
+func (s *modelService) newRerankRoute(ctx context.Context, model *types.Model) (rerank.Reranker, error) {
+	logger.Infof(ctx, "Creating rerank model route: %s", model.Name)
+	clients := make(map[string]rerank.Reranker)
+	for _, member := range s.routeModels(ctx, model) {
+		client, err := s.newRerankModel(ctx, member)
+		if err != nil {
+			logger.Warnf(ctx, "Model %s of route %s cannot be initialized: %v", member.ID, model.ID, err)
+			continue
+		}
+		clients[member.ID] = client
+	}
+	if len(clients) == 0 {
+		return nil, route.ErrNoTarget
+	}
+	return route.NewReranker(model, s.router, clients), nil
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/application/service/retriever"
+	werrors "github.com/Tencent/WeKnora/internal/errors"
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/models/embedding"
+	"github.com/Tencent/WeKnora/internal/models/utils"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// reindexTaskMaxRetry is the maximum number of retries of a re-embedding task
+	reindexTaskMaxRetry = 5
+	// reindexBatchSize is the number of chunks re-embedded per batch
+	reindexBatchSize = 100
+)
+
+// errReindexCancelled stops a re-embedding job that has been cancelled while running
+var errReindexCancelled = errors.New("reindex job cancelled")
+
+// reindexEngine is the part of the retrieval engine used by re-embedding jobs
+type reindexEngine interface {
+	BatchIndex(ctx context.Context, embedder embedding.Embedder, indexInfoList []*types.IndexInfo) error
+	DeleteByChunkIDList(ctx context.Context, chunkIDList []string, dimension int) error
+	DeleteByKnowledgeBaseID(ctx context.Context, knowledgeBaseID string) error
+	SwapKnowledgeBaseIndices(ctx context.Context, knowledgeBaseID string, stagingKnowledgeBaseID string) error
+}
+
+// reindexService re-embeds knowledge bases whose embedding model changes
+type reindexService struct {
+	jobRepo      interfaces.ReindexJobRepository
+	kbRepo       interfaces.KnowledgeBaseRepository
+	chunkRepo    interfaces.ChunkRepository
+	tenantRepo   interfaces.TenantRepository
+	modelService interfaces.ModelService
+	task         *asynq.Client
+}
+
+// NewReindexService creates a new reindex service
+func NewReindexService(
+	jobRepo interfaces.ReindexJobRepository,
+	kbRepo interfaces.KnowledgeBaseRepository,
+	chunkRepo interfaces.ChunkRepository,
+	tenantRepo interfaces.TenantRepository,
+	modelService interfaces.ModelService,
+	task *asynq.Client,
+) interfaces.ReindexService {
+	return &reindexService{
+		jobRepo:      jobRepo,
+		kbRepo:       kbRepo,
+		chunkRepo:    chunkRepo,
+		tenantRepo:   tenantRepo,
+		modelService: modelService,
+		task:         task,
+	}
+}
+
+// StartReindex creates a re-embedding job and enqueues it
+func (s *reindexService) StartReindex(ctx context.Context,
+	kb *types.KnowledgeBase, modelID string,
+) (*types.ReindexJob, error) {
+	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
+
+	active, err := s.jobRepo.GetActiveJobByKnowledgeBaseID(ctx, tenantID, kb.ID)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to get active reindex job: %v", err)
+		return nil, err
+	}
+	if active != nil {
+		logger.Warnf(ctx, "Knowledge base %s already has an active reindex job %s", kb.ID, active.ID)
+		return nil, werrors.NewConflictError("Knowledge base is being re-embedded").WithDetails(active)
+	}
+
+	// Make sure the new model is usable before walking the whole knowledge base
+	if _, err := s.modelService.GetEmbeddingModel(ctx, modelID); err != nil {
+		logger.Errorf(ctx, "Failed to get embedding model %s: %v", modelID, err)
+		return nil, werrors.NewBadRequestError("Invalid embedding model").WithDetails(err.Error())
+	}
+
+	total, err := s.chunkRepo.CountEnabledChunksByKnowledgeBaseID(ctx, tenantID, kb.ID)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to count chunks of knowledge base %s: %v", kb.ID, err)
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &types.ReindexJob{
+		ID:              uuid.New().String(),
+		TenantID:        tenantID,
+		KnowledgeBaseID: kb.ID,
+		FromModelID:     kb.EmbeddingModelID,
+		ToModelID:       modelID,
+		Status:          types.ReindexJobPending,
+		TotalChunks:     total,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := s.jobRepo.CreateJob(ctx, job); err != nil {
+		logger.Errorf(ctx, "Failed to create reindex job: %v", err)
+		return nil, err
+	}
+
+	requestID, _ := ctx.Value(types.RequestIDContextKey).(string)
+	payload, err := json.Marshal(types.ReindexPayload{TenantID: tenantID, JobID: job.ID, RequestID: requestID})
+	if err != nil {
+		return nil, err
+	}
+	task := asynq.NewTask(types.TypeKnowledgeBaseReindex, payload,
+		asynq.MaxRetry(reindexTaskMaxRetry), asynq.Queue("low"))
+	info, err := s.task.Enqueue(task)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to enqueue reindex task: %v", err)
+		job.ErrorMessage = err.Error()
+		if _, uerr := s.jobRepo.UpdateJobStatus(ctx, job,
+			[]types.ReindexJobStatus{types.ReindexJobPending}, types.ReindexJobFailed,
+		); uerr != nil {
+			logger.Errorf(ctx, "Failed to mark reindex job as failed: %v", uerr)
+		}
+		return nil, fmt.Errorf("failed to enqueue task: %v", err)
+	}
+	logger.Infof(ctx, "Reindex job %s enqueued, task: %s, knowledge base: %s, model: %s -> %s, chunks: %d",
+		job.ID, info.ID, kb.ID, job.FromModelID, job.ToModelID, total)
+	return job, nil
+}
+
+// GetReindexJob gets a re-embedding job of a knowledge base
+func (s *reindexService) GetReindexJob(ctx context.Context,
+	knowledgeBaseID string, jobID string,
+) (*types.ReindexJob, error) {
+	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
+	job, err := s.jobRepo.GetJobByID(ctx, tenantID, jobID)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to get reindex job %s: %v", jobID, err)
+		return nil, werrors.NewNotFoundError("Reindex job not found")
+	}
+	if job.KnowledgeBaseID != knowledgeBaseID {
+		return nil, werrors.NewNotFoundError("Reindex job not found")
+	}
+	return job, nil
+}
+
+// CancelReindexJob cancels a pending or running re-embedding job
+// The running task notices the cancellation after its current batch and drops the staged vectors
+func (s *reindexService) CancelReindexJob(ctx context.Context,
+	knowledgeBaseID string, jobID string,
+) (*types.ReindexJob, error) {
+	job, err := s.GetReindexJob(ctx, knowledgeBaseID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.jobRepo.UpdateJobStatus(ctx, job,
+		[]types.ReindexJobStatus{types.ReindexJobPending, types.ReindexJobRunning}, types.ReindexJobCancelled,
+	)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to cancel reindex job %s: %v", jobID, err)
+		return nil, err
+	}
+	if !ok {
+		return nil, werrors.NewConflictError("Reindex job already finished")
+	}
+	logger.Infof(ctx, "Reindex job %s cancelled", jobID)
+	return job, nil
+}
+
+// Reindex handles the asynq task of a re-embedding job
+func (s *reindexService) Reindex(ctx context.Context, t *asynq.Task) error {
+	var p types.ReindexPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		logger.Errorf(ctx, "failed to unmarshal task payload: %v", err)
+		return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+	}
+	if p.RequestID == "" {
+		p.RequestID = uuid.New().String()
+	}
+	ctx = logger.WithRequestID(ctx, p.RequestID)
+	ctx = logger.WithField(ctx, "reindex_job", p.JobID)
+	ctx = context.WithValue(ctx, types.RequestIDContextKey, p.RequestID)
+	ctx = context.WithValue(ctx, types.TenantIDContextKey, p.TenantID)
+
+	tenant, err := s.tenantRepo.GetTenantByID(ctx, p.TenantID)
+	if err != nil {
+		logger.Errorf(ctx, "failed to get tenant: %v", err)
+		return err
+	}
+	ctx = context.WithValue(ctx, types.TenantInfoContextKey, tenant)
+
+	job, err := s.jobRepo.GetJobByID(ctx, p.TenantID, p.JobID)
+	if err != nil {
+		logger.Warnf(ctx, "ignore task of reindex job %s: %v", p.JobID, err)
+		return nil
+	}
+	if job.Finished() {
+		logger.Infof(ctx, "reindex job already %s, skipping", job.Status)
+		return nil
+	}
+
+	retrieveEngine, err := retriever.NewCompositeRetrieveEngine(tenant.RetrieverEngines.Engines)
+	if err != nil {
+		logger.Errorf(ctx, "failed to create retrieval engine: %v", err)
+		return err
+	}
+
+	if job.Status == types.ReindexJobPending {
+		ok, err := s.jobRepo.UpdateJobStatus(ctx, job,
+			[]types.ReindexJobStatus{types.ReindexJobPending}, types.ReindexJobRunning,
+		)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			logger.Infof(ctx, "reindex job cancelled before it started")
+			return nil
+		}
+	}
+
+	err = s.reindex(ctx, retrieveEngine, job)
+	if errors.Is(err, errReindexCancelled) {
+		logger.Infof(ctx, "reindex job cancelled, dropping staged vectors")
+		s.dropStaged(ctx, retrieveEngine, job)
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, ok := asynq.GetMaxRetry(ctx)
+	if ok && retried < maxRetry {
+		logger.GetLogger(ctx).WithField("error", err).Warnf("reindex attempt %d failed, will retry", retried+1)
+		return err
+	}
+
+	logger.GetLogger(ctx).WithField("error", err).Errorf("reindex job failed")
+	job.ErrorMessage = err.Error()
+	if _, uerr := s.jobRepo.UpdateJobStatus(ctx, job,
+		[]types.ReindexJobStatus{types.ReindexJobRunning}, types.ReindexJobFailed,
+	); uerr != nil {
+		logger.GetLogger(ctx).WithField("error", uerr).Errorf("failed to mark reindex job as failed")
+	}
+	s.dropStaged(ctx, retrieveEngine, job)
+	return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+}
+
+// reindex embeds every enabled chunk under the staging knowledge base ID and swaps the vectors in
+// It resumes after the last chunk recorded by a previous attempt
+func (s *reindexService) reindex(ctx context.Context, retrieveEngine reindexEngine, job *types.ReindexJob) error {
+	kb, err := s.kbRepo.GetKnowledgeBaseByID(ctx, job.KnowledgeBaseID)
+	if err != nil {
+		return err
+	}
+	embeddingModel, err := s.modelService.GetEmbeddingModel(ctx, job.ToModelID)
+	if err != nil {
+		return err
+	}
+
+	var after *types.Chunk
+	if job.LastChunkID != "" && job.LastChunkCreatedAt != nil {
+		after = &types.Chunk{ID: job.LastChunkID, CreatedAt: *job.LastChunkCreatedAt}
+	}
+	for {
+		chunks, err := s.chunkRepo.ListEnabledChunksByKnowledgeBaseID(ctx,
+			job.TenantID, kb.ID, after, reindexBatchSize,
+		)
+		if err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			break
+		}
+
+		indexInfoList := utils.MapSlice(chunks, func(chunk *types.Chunk) *types.IndexInfo {
+			return &types.IndexInfo{
+				Content:         chunk.Content,
+				SourceID:        chunk.ID,
+				SourceType:      types.ReindexSourceType,
+				ChunkID:         chunk.ID,
+				KnowledgeID:     chunk.KnowledgeID,
+				KnowledgeBaseID: job.ID,
+			}
+		})
+		if err := retrieveEngine.BatchIndex(ctx, embeddingModel, indexInfoList); err != nil {
+			return err
+		}
+
+		after = chunks[len(chunks)-1]
+		job.LastChunkID = after.ID
+		job.LastChunkCreatedAt = &after.CreatedAt
+		job.ProcessedChunks += int64(len(chunks))
+		if job.ProcessedChunks > job.TotalChunks {
+			job.TotalChunks = job.ProcessedChunks
+		}
+		ok, err := s.jobRepo.UpdateJobProgress(ctx, job)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errReindexCancelled
+		}
+		logger.Infof(ctx, "Reindex progress: %d/%d", job.ProcessedChunks, job.TotalChunks)
+	}
+
+	// Last chance to notice a cancellation before the swap
+	ok, err := s.jobRepo.UpdateJobProgress(ctx, job)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errReindexCancelled
+	}
+
+	logger.Infof(ctx, "All chunks re-embedded, swapping vectors of knowledge base %s", kb.ID)
+	if err := retrieveEngine.SwapKnowledgeBaseIndices(ctx, kb.ID, job.ID); err != nil {
+		return err
+	}
+	if err := s.kbRepo.UpdateEmbeddingModel(ctx, kb.ID, job.ToModelID); err != nil {
+		return err
+	}
+	if err := s.catchUp(ctx, retrieveEngine, embeddingModel, job); err != nil {
+		return err
+	}
+
+	// The swap is done, a cancellation arriving meanwhile cannot be honoured any more
+	if _, err := s.jobRepo.UpdateJobStatus(ctx, job,
+		[]types.ReindexJobStatus{types.ReindexJobRunning, types.ReindexJobCancelled}, types.ReindexJobCompleted,
+	); err != nil {
+		logger.GetLogger(ctx).WithField("error", err).Errorf("failed to mark reindex job as completed")
+	}
+	logger.Infof(ctx, "Reindex job completed, knowledge base %s now uses embedding model %s", kb.ID, job.ToModelID)
+	return nil
+}
+
+// catchUp embeds again with the new model the chunks created or updated since the job was created, and drops
+// the vectors of the chunks disabled meanwhile. The staged vectors of these chunks may predate the change, and
+// knowledge ingested while the swap happened was embedded with the previous model, its vectors were either
+// dropped by the swap or written next to the swapped ones. Ingestion still running once the model switched
+// notices it and retries
+func (s *reindexService) catchUp(ctx context.Context, retrieveEngine reindexEngine,
+	embeddingModel embedding.Embedder, job *types.ReindexJob,
+) error {
+	var after *types.Chunk
+	for {
+		chunks, err := s.chunkRepo.ListChunksUpdatedSince(ctx,
+			job.TenantID, job.KnowledgeBaseID, job.CreatedAt, after, reindexBatchSize,
+		)
+		if err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		logger.Infof(ctx, "Re-embedding %d chunks changed during the job", len(chunks))
+		ids := utils.MapSlice(chunks, func(chunk *types.Chunk) string { return chunk.ID })
+		if err := retrieveEngine.DeleteByChunkIDList(ctx, ids, embeddingModel.GetDimensions()); err != nil {
+			return err
+		}
+		enabled := slices.DeleteFunc(slices.Clone(chunks), func(chunk *types.Chunk) bool { return !chunk.IsEnabled })
+		if len(enabled) > 0 {
+			if err := retrieveEngine.BatchIndex(ctx, embeddingModel, chunksToIndexInfo(enabled)); err != nil {
+				return err
+			}
+		}
+		after = chunks[len(chunks)-1]
+	}
+}
+
+// dropStaged deletes the vectors staged by a job that will not be swapped in
+func (s *reindexService) dropStaged(ctx context.Context, retrieveEngine reindexEngine, job *types.ReindexJob) {
+	if err := retrieveEngine.DeleteByKnowledgeBaseID(ctx, job.ID); err != nil {
+		logger.GetLogger(ctx).WithField("error", err).Errorf("failed to drop staged vectors of reindex job")
+	}
+}
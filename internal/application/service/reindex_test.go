@@ -0,0 +1,370 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/models/embedding"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/hibiken/asynq"
+)
+
+// fakeReindexJobRepo keeps a single job in memory
+type fakeReindexJobRepo struct {
+	interfaces.ReindexJobRepository
+	job      *types.ReindexJob
+	progress func(job *types.ReindexJob) // Called on every progress update
+}
+
+func (r *fakeReindexJobRepo) GetJobByID(ctx context.Context, tenantID uint, id string) (*types.ReindexJob, error) {
+	if r.job == nil || r.job.ID != id {
+		return nil, types.ErrReindexJobNotFound
+	}
+	job := *r.job
+	return &job, nil
+}
+
+func (r *fakeReindexJobRepo) UpdateJobProgress(ctx context.Context, job *types.ReindexJob) (bool, error) {
+	if r.progress != nil {
+		r.progress(r.job)
+	}
+	if r.job.Status != types.ReindexJobRunning {
+		return false, nil
+	}
+	r.job.ProcessedChunks = job.ProcessedChunks
+	r.job.LastChunkID = job.LastChunkID
+	return true, nil
+}
+
+func (r *fakeReindexJobRepo) UpdateJobStatus(ctx context.Context, job *types.ReindexJob,
+	from []types.ReindexJobStatus, to types.ReindexJobStatus,
+) (bool, error) {
+	if !slices.Contains(from, r.job.Status) {
+		return false, nil
+	}
+	r.job.Status = to
+	job.Status = to
+	return true, nil
+}
+
+// fakeReindexKBRepo records the embedding model switches
+type fakeReindexKBRepo struct {
+	interfaces.KnowledgeBaseRepository
+	kb       *types.KnowledgeBase
+	switches []string
+}
+
+func (r *fakeReindexKBRepo) GetKnowledgeBaseByID(ctx context.Context, id string) (*types.KnowledgeBase, error) {
+	kb := *r.kb
+	return &kb, nil
+}
+
+func (r *fakeReindexKBRepo) UpdateEmbeddingModel(ctx context.Context, id string, modelID string) error {
+	r.kb.EmbeddingModelID = modelID
+	r.switches = append(r.switches, modelID)
+	return nil
+}
+
+// fakeReindexChunkRepo walks its chunks in creation or update order
+type fakeReindexChunkRepo struct {
+	interfaces.ChunkRepository
+	chunks []*types.Chunk
+	now    time.Time
+}
+
+func (r *fakeReindexChunkRepo) ListEnabledChunksByKnowledgeBaseID(ctx context.Context,
+	tenantID uint, knowledgeBaseID string, after *types.Chunk, limit int,
+) ([]*types.Chunk, error) {
+	var chunks []*types.Chunk
+	for _, chunk := range r.chunks {
+		if !chunk.IsEnabled || (after != nil && (chunk.CreatedAt.Before(after.CreatedAt) ||
+			(chunk.CreatedAt.Equal(after.CreatedAt) && chunk.ID <= after.ID))) {
+			continue
+		}
+		if len(chunks) < limit {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, nil
+}
+
+func (r *fakeReindexChunkRepo) ListChunksUpdatedSince(ctx context.Context,
+	tenantID uint, knowledgeBaseID string, since time.Time, after *types.Chunk, limit int,
+) ([]*types.Chunk, error) {
+	var chunks []*types.Chunk
+	for _, chunk := range r.chunks {
+		if chunk.UpdatedAt.Before(since) || (after != nil && (chunk.UpdatedAt.Before(after.UpdatedAt) ||
+			(chunk.UpdatedAt.Equal(after.UpdatedAt) && chunk.ID <= after.ID))) {
+			continue
+		}
+		copied := *chunk
+		chunks = append(chunks, &copied)
+	}
+	slices.SortFunc(chunks, func(a, b *types.Chunk) int {
+		if c := a.UpdatedAt.Compare(b.UpdatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return chunks[:min(len(chunks), limit)], nil
+}
+
+// tick advances the clock of the repository by one minute
+func (r *fakeReindexChunkRepo) tick() time.Time {
+	if r.now.IsZero() {
+		r.now = time.Date(2025, 8, 12, 10, 0, 0, 0, time.UTC)
+	}
+	r.now = r.now.Add(time.Minute)
+	return r.now
+}
+
+// add creates a chunk one minute after the previous change
+func (r *fakeReindexChunkRepo) add(id string) {
+	now := r.tick()
+	r.chunks = append(r.chunks, &types.Chunk{
+		ID: id, KnowledgeBaseID: "kb", IsEnabled: true, CreatedAt: now, UpdatedAt: now,
+	})
+}
+
+// update changes a chunk one minute after the previous change
+func (r *fakeReindexChunkRepo) update(id string, enabled bool) {
+	for _, chunk := range r.chunks {
+		if chunk.ID == id {
+			chunk.IsEnabled = enabled
+			chunk.UpdatedAt = r.tick()
+		}
+	}
+}
+
+// fakeReindexModelService returns an embedder of the requested model
+type fakeReindexModelService struct {
+	interfaces.ModelService
+}
+
+func (fakeReindexModelService) GetEmbeddingModel(ctx context.Context, modelID string) (embedding.Embedder, error) {
+	return fakeReindexEmbedder{modelID: modelID}, nil
+}
+
+type fakeReindexEmbedder struct {
+	embedding.Embedder
+	modelID string
+}
+
+func (e fakeReindexEmbedder) GetDimensions() int { return 3 }
+
+// fakeReindexEngine records the vectors indexed by knowledge base
+type fakeReindexEngine struct {
+	indexed map[string][]string // Chunk IDs by knowledge base ID
+	deleted []string
+	swaps   int
+	swap    func() // Called when the vectors are swapped
+}
+
+func (e *fakeReindexEngine) BatchIndex(ctx context.Context,
+	embedder embedding.Embedder, indexInfoList []*types.IndexInfo,
+) error {
+	if e.indexed == nil {
+		e.indexed = make(map[string][]string)
+	}
+	for _, info := range indexInfoList {
+		if modelID := embedder.(fakeReindexEmbedder).modelID; modelID != "new" {
+			return fmt.Errorf("chunk %s embedded with model %s", info.ChunkID, modelID)
+		}
+		e.indexed[info.KnowledgeBaseID] = append(e.indexed[info.KnowledgeBaseID], info.ChunkID)
+	}
+	return nil
+}
+
+func (e *fakeReindexEngine) DeleteByChunkIDList(ctx context.Context, chunkIDList []string, dimension int) error {
+	e.deleted = append(e.deleted, chunkIDList...)
+	for knowledgeBaseID, ids := range e.indexed {
+		e.indexed[knowledgeBaseID] = slices.DeleteFunc(ids, func(id string) bool {
+			return slices.Contains(chunkIDList, id)
+		})
+	}
+	return nil
+}
+
+func (e *fakeReindexEngine) DeleteByKnowledgeBaseID(ctx context.Context, knowledgeBaseID string) error {
+	delete(e.indexed, knowledgeBaseID)
+	return nil
+}
+
+func (e *fakeReindexEngine) SwapKnowledgeBaseIndices(ctx context.Context,
+	knowledgeBaseID string, stagingKnowledgeBaseID string,
+) error {
+	e.swaps++
+	e.indexed[knowledgeBaseID] = e.indexed[stagingKnowledgeBaseID]
+	delete(e.indexed, stagingKnowledgeBaseID)
+	if e.swap != nil {
+		e.swap()
+	}
+	return nil
+}
+
+// newReindexFixture creates a running job re-embedding a knowledge base of the given chunks
+func newReindexFixture(chunkIDs ...string) (*reindexService, *fakeReindexJobRepo, *fakeReindexChunkRepo) {
+	jobRepo := &fakeReindexJobRepo{job: &types.ReindexJob{
+		ID:              "job",
+		TenantID:        1,
+		KnowledgeBaseID: "kb",
+		FromModelID:     "old",
+		ToModelID:       "new",
+		Status:          types.ReindexJobRunning,
+		TotalChunks:     int64(len(chunkIDs)),
+	}}
+	chunkRepo := &fakeReindexChunkRepo{}
+	for _, id := range chunkIDs {
+		chunkRepo.add(id)
+	}
+	jobRepo.job.CreatedAt = chunkRepo.tick()
+	s := &reindexService{
+		jobRepo:      jobRepo,
+		kbRepo:       &fakeReindexKBRepo{kb: &types.KnowledgeBase{ID: "kb", TenantID: 1, EmbeddingModelID: "old"}},
+		chunkRepo:    chunkRepo,
+		modelService: fakeReindexModelService{},
+	}
+	return s, jobRepo, chunkRepo
+}
+
+func TestReindexCompletes(t *testing.T) {
+	s, jobRepo, _ := newReindexFixture("c1", "c2", "c3")
+	engine := &fakeReindexEngine{}
+	job, _ := jobRepo.GetJobByID(context.Background(), 1, "job")
+
+	if err := s.reindex(context.Background(), engine, job); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if jobRepo.job.Status != types.ReindexJobCompleted || jobRepo.job.ProcessedChunks != 3 {
+		t.Errorf("Expected the job completed with 3 chunks, got %s with %d", jobRepo.job.Status,
+			jobRepo.job.ProcessedChunks)
+	}
+	if engine.swaps != 1 || !reflect.DeepEqual(engine.indexed["kb"], []string{"c1", "c2", "c3"}) {
+		t.Errorf("Expected the staged vectors swapped in, got %v", engine.indexed)
+	}
+	kbRepo := s.kbRepo.(*fakeReindexKBRepo)
+	if !reflect.DeepEqual(kbRepo.switches, []string{"new"}) {
+		t.Errorf("Expected the embedding model switched once, got %v", kbRepo.switches)
+	}
+	if len(engine.deleted) != 0 {
+		t.Errorf("Expected nothing to catch up, got %v", engine.deleted)
+	}
+}
+
+func TestReindexCatchesUpChunksCreatedDuringSwap(t *testing.T) {
+	s, jobRepo, chunkRepo := newReindexFixture("c1", "c2")
+	// Knowledge ingested with the previous model while the vectors are swapped
+	engine := &fakeReindexEngine{swap: func() { chunkRepo.add("c3") }}
+	job, _ := jobRepo.GetJobByID(context.Background(), 1, "job")
+
+	if err := s.reindex(context.Background(), engine, job); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(engine.deleted, []string{"c3"}) {
+		t.Errorf("Expected the vectors of the previous model dropped, got %v", engine.deleted)
+	}
+	if !reflect.DeepEqual(engine.indexed["kb"], []string{"c1", "c2", "c3"}) {
+		t.Errorf("Expected the chunk embedded again with the new model, got %v", engine.indexed["kb"])
+	}
+	if jobRepo.job.Status != types.ReindexJobCompleted {
+		t.Errorf("Expected the job completed, got %s", jobRepo.job.Status)
+	}
+}
+
+func TestReindexCatchesUpChunksChangedDuringWalk(t *testing.T) {
+	s, jobRepo, chunkRepo := newReindexFixture("c1", "c2", "c3")
+	// c1 is edited and c2 disabled once their vectors are staged
+	jobRepo.progress = func(job *types.ReindexJob) {
+		if job.ProcessedChunks == 3 && chunkRepo.chunks[1].IsEnabled {
+			chunkRepo.update("c1", true)
+			chunkRepo.update("c2", false)
+		}
+	}
+	engine := &fakeReindexEngine{}
+	job, _ := jobRepo.GetJobByID(context.Background(), 1, "job")
+
+	if err := s.reindex(context.Background(), engine, job); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(engine.deleted, []string{"c1", "c2"}) {
+		t.Errorf("Expected the stale staged vectors dropped, got %v", engine.deleted)
+	}
+	if !reflect.DeepEqual(engine.indexed["kb"], []string{"c3", "c1"}) {
+		t.Errorf("Expected c1 embedded again and c2 left out, got %v", engine.indexed["kb"])
+	}
+}
+
+func TestReindexResumes(t *testing.T) {
+	s, jobRepo, chunkRepo := newReindexFixture("c1", "c2", "c3")
+	jobRepo.job.LastChunkID = "c1"
+	jobRepo.job.LastChunkCreatedAt = &chunkRepo.chunks[0].CreatedAt
+	jobRepo.job.ProcessedChunks = 1
+	// The vectors of the first attempt are still staged
+	engine := &fakeReindexEngine{indexed: map[string][]string{"job": {"c1"}}}
+	job, _ := jobRepo.GetJobByID(context.Background(), 1, "job")
+
+	if err := s.reindex(context.Background(), engine, job); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(engine.indexed["kb"], []string{"c1", "c2", "c3"}) || jobRepo.job.ProcessedChunks != 3 {
+		t.Errorf("Expected the job to resume after c1, got %v", engine.indexed["kb"])
+	}
+}
+
+func TestReindexCancelled(t *testing.T) {
+	s, jobRepo, _ := newReindexFixture("c1", "c2")
+	jobRepo.progress = func(job *types.ReindexJob) { job.Status = types.ReindexJobCancelled }
+	engine := &fakeReindexEngine{}
+	job, _ := jobRepo.GetJobByID(context.Background(), 1, "job")
+
+	if err := s.reindex(context.Background(), engine, job); err != errReindexCancelled {
+		t.Fatalf("Expected the job to stop as cancelled, got %v", err)
+	}
+	if engine.swaps != 0 || len(s.kbRepo.(*fakeReindexKBRepo).switches) != 0 {
+		t.Error("Expected a cancelled job never to swap the vectors")
+	}
+	s.dropStaged(context.Background(), engine, job)
+	if len(engine.indexed["job"]) != 0 {
+		t.Errorf("Expected the staged vectors dropped, got %v", engine.indexed["job"])
+	}
+}
+
+// fakeReindexTenantRepo returns a tenant without retrieval engines
+type fakeReindexTenantRepo struct {
+	interfaces.TenantRepository
+}
+
+func (fakeReindexTenantRepo) GetTenantByID(ctx context.Context, id uint) (*types.Tenant, error) {
+	return &types.Tenant{ID: id}, nil
+}
+
+func TestReindexTaskSkipsFinishedJobs(t *testing.T) {
+	for _, status := range []types.ReindexJobStatus{
+		types.ReindexJobCompleted, types.ReindexJobFailed, types.ReindexJobCancelled,
+	} {
+		s, jobRepo, _ := newReindexFixture("c1")
+		s.tenantRepo = fakeReindexTenantRepo{}
+		jobRepo.job.Status = status
+		payload, _ := json.Marshal(types.ReindexPayload{TenantID: 1, JobID: "job"})
+		if err := s.Reindex(context.Background(), asynq.NewTask(types.TypeKnowledgeBaseReindex, payload)); err != nil {
+			t.Errorf("Expected a %s job to be skipped, got %v", status, err)
+		}
+		if jobRepo.job.Status != status {
+			t.Errorf("Expected the job to stay %s, got %s", status, jobRepo.job.Status)
+		}
+	}
+
+	s, _, _ := newReindexFixture("c1")
+	s.tenantRepo = fakeReindexTenantRepo{}
+	payload, _ := json.Marshal(types.ReindexPayload{TenantID: 1, JobID: "missing"})
+	if err := s.Reindex(context.Background(), asynq.NewTask(types.TypeKnowledgeBaseReindex, payload)); err != nil {
+		t.Errorf("Expected a missing job to be ignored, got %v", err)
+	}
+}
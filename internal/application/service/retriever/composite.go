@@ -268,6 +268,35 @@ func (c *CompositeRetrieveEngine) DeleteByKnowledgeIDList(ctx context.Context,
 	})
 }
 
+// DeleteByKnowledgeBaseID deletes vector embeddings of a knowledge base from all registered repositories
+func (c *CompositeRetrieveEngine) DeleteByKnowledgeBaseID(ctx context.Context, knowledgeBaseID string) error {
+	return c.concurrentExecWithError(ctx, func(ctx context.Context, engineInfo *engineInfo) error {
+		if err := engineInfo.retrieveEngine.DeleteByKnowledgeBaseID(ctx, knowledgeBaseID); err != nil {
+			logger.GetLogger(ctx).Errorf("Repository %s failed to delete knowledge base: %v",
+				engineInfo.retrieveEngine.EngineType(), err)
+			return err
+		}
+		return nil
+	})
+}
+
+// SwapKnowledgeBaseIndices replaces the vector embeddings of a knowledge base with the embeddings
+// staged under stagingKnowledgeBaseID in all registered repositories
+func (c *CompositeRetrieveEngine) SwapKnowledgeBaseIndices(ctx context.Context,
+	knowledgeBaseID string, stagingKnowledgeBaseID string,
+) error {
+	return c.concurrentExecWithError(ctx, func(ctx context.Context, engineInfo *engineInfo) error {
+		if err := engineInfo.retrieveEngine.SwapKnowledgeBaseIndices(
+			ctx, knowledgeBaseID, stagingKnowledgeBaseID,
+		); err != nil {
+			logger.GetLogger(ctx).Errorf("Repository %s failed to swap knowledge base indices: %v",
+				engineInfo.retrieveEngine.EngineType(), err)
+			return err
+		}
+		return nil
+	})
+}
+
 // EstimateStorageSize estimates the storage size required for the provided index information
 func (c *CompositeRetrieveEngine) EstimateStorageSize(ctx context.Context,
 	embedder embedding.Embedder, indexInfoList []*types.IndexInfo,
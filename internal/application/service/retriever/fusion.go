@@ -0,0 +1,151 @@
+package retriever
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/Tencent/WeKnora/internal/common"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// rrfK is the rank constant of reciprocal rank fusion, 60 is the value suggested by the original paper
+const rrfK = 60
+
+// FusionParams holds the parameters used to merge results from different retrievers
+type FusionParams struct {
+	// Strategy decides how results are merged, empty means concat
+	Strategy types.FusionStrategy
+	// VectorWeight is the weight of vector results
+	VectorWeight float64
+	// KeywordWeight is the weight of keyword results
+	KeywordWeight float64
+}
+
+// weight returns the weight of the given retriever type,
+// both weights unset means vector and keyword results are treated equally
+func (p FusionParams) weight(retrieverType types.RetrieverType) float64 {
+	vectorWeight, keywordWeight := max(p.VectorWeight, 0), max(p.KeywordWeight, 0)
+	if vectorWeight == 0 && keywordWeight == 0 {
+		vectorWeight, keywordWeight = 1, 1
+	}
+	switch retrieverType {
+	case types.VectorRetrieverType:
+		return vectorWeight
+	case types.KeywordsRetrieverType:
+		return keywordWeight
+	default:
+		return 1
+	}
+}
+
+// FuseRetrieveResults merges the results of different retrievers into a single list deduplicated by chunk ID.
+// For rrf and weighted fusion the score of each result is replaced by the fused score
+// and the list is sorted by it in descending order.
+func FuseRetrieveResults(results []*types.RetrieveResult, params FusionParams) []*types.IndexWithScore {
+	switch params.Strategy {
+	case types.FusionStrategyRRF:
+		return fuse(results, params, rrfScores)
+	case types.FusionStrategyWeighted:
+		return fuse(results, params, normalizedScores)
+	default:
+		var matchResults []*types.IndexWithScore
+		for _, result := range results {
+			matchResults = append(matchResults, result.Results...)
+		}
+		return common.Deduplicate(func(r *types.IndexWithScore) string { return r.ChunkID }, matchResults...)
+	}
+}
+
+// fuse accumulates the weighted per-list scores of every chunk and returns the fused results
+func fuse(results []*types.RetrieveResult,
+	params FusionParams,
+	listScores func(ranked []*types.IndexWithScore) []float64,
+) []*types.IndexWithScore {
+	fused := make(map[string]*types.IndexWithScore)
+	var order []string
+	for _, result := range results {
+		weight := params.weight(result.RetrieverType)
+		ranked := slices.Clone(result.Results)
+		slices.SortStableFunc(ranked, func(a, b *types.IndexWithScore) int { return cmp.Compare(b.Score, a.Score) })
+
+		for i, score := range listScores(ranked) {
+			item := ranked[i]
+			if _, ok := fused[item.ChunkID]; !ok {
+				copied := *item
+				copied.Score = 0
+				fused[item.ChunkID] = &copied
+				order = append(order, item.ChunkID)
+			}
+			fused[item.ChunkID].Score += weight * score
+		}
+	}
+
+	merged := make([]*types.IndexWithScore, 0, len(order))
+	for _, chunkID := range order {
+		merged = append(merged, fused[chunkID])
+	}
+	slices.SortStableFunc(merged, func(a, b *types.IndexWithScore) int { return cmp.Compare(b.Score, a.Score) })
+	return merged
+}
+
+// rrfScores returns 1/(k+rank) for each result of a ranked list
+func rrfScores(ranked []*types.IndexWithScore) []float64 {
+	scores := make([]float64, len(ranked))
+	for i := range ranked {
+		scores[i] = 1.0 / float64(rrfK+i+1)
+	}
+	return scores
+}
+
+// normalizedScores min-max normalizes the scores of a ranked list into [0, 1],
+// a list whose scores are all equal is normalized to 1
+func normalizedScores(ranked []*types.IndexWithScore) []float64 {
+	scores := make([]float64, len(ranked))
+	if len(ranked) == 0 {
+		return scores
+	}
+	maxScore, minScore := ranked[0].Score, ranked[len(ranked)-1].Score
+	for i, item := range ranked {
+		if maxScore == minScore {
+			scores[i] = 1
+			continue
+		}
+		scores[i] = (item.Score - minScore) / (maxScore - minScore)
+	}
+	return scores
+}
+
+// NormalizeByKnowledgeBase splits every result list by knowledge base and min-max normalizes the scores
+// of each split, so that results of knowledge bases with different score distributions can be merged
+func NormalizeByKnowledgeBase(results []*types.RetrieveResult) []*types.RetrieveResult {
+	normalized := make([]*types.RetrieveResult, 0, len(results))
+	for _, result := range results {
+		var kbIDs []string
+		byKnowledgeBase := make(map[string][]*types.IndexWithScore)
+		for _, item := range result.Results {
+			if _, ok := byKnowledgeBase[item.KnowledgeBaseID]; !ok {
+				kbIDs = append(kbIDs, item.KnowledgeBaseID)
+			}
+			byKnowledgeBase[item.KnowledgeBaseID] = append(byKnowledgeBase[item.KnowledgeBaseID], item)
+		}
+
+		for _, kbID := range kbIDs {
+			ranked := slices.Clone(byKnowledgeBase[kbID])
+			slices.SortStableFunc(ranked, func(a, b *types.IndexWithScore) int { return cmp.Compare(b.Score, a.Score) })
+			scores := normalizedScores(ranked)
+			items := make([]*types.IndexWithScore, len(ranked))
+			for i, item := range ranked {
+				copied := *item
+				copied.Score = scores[i]
+				items[i] = &copied
+			}
+			normalized = append(normalized, &types.RetrieveResult{
+				Results:             items,
+				RetrieverEngineType: result.RetrieverEngineType,
+				RetrieverType:       result.RetrieverType,
+				Error:               result.Error,
+			})
+		}
+	}
+	return normalized
+}
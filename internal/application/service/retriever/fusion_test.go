@@ -0,0 +1,140 @@
+package retriever
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+func testRetrieveResults() []*types.RetrieveResult {
+	return []*types.RetrieveResult{
+		{
+			RetrieverType: types.VectorRetrieverType,
+			Results: []*types.IndexWithScore{
+				{ChunkID: "a", Score: 0.9, MatchType: types.MatchTypeEmbedding},
+				{ChunkID: "b", Score: 0.8, MatchType: types.MatchTypeEmbedding},
+				{ChunkID: "c", Score: 0.7, MatchType: types.MatchTypeEmbedding},
+			},
+		},
+		{
+			RetrieverType: types.KeywordsRetrieverType,
+			Results: []*types.IndexWithScore{
+				{ChunkID: "c", Score: 12, MatchType: types.MatchTypeKeywords},
+				{ChunkID: "d", Score: 8, MatchType: types.MatchTypeKeywords},
+				{ChunkID: "b", Score: 2, MatchType: types.MatchTypeKeywords},
+			},
+		},
+	}
+}
+
+func TestFuseRetrieveResults(t *testing.T) {
+	tests := []struct {
+		name          string
+		params        FusionParams
+		expectedOrder []string
+		// expected fused scores, nil means the raw scores are kept
+		expectedScores map[string]float64
+	}{
+		{
+			name:   "rrf with equal weights",
+			params: FusionParams{Strategy: types.FusionStrategyRRF},
+			// b: 1/62 + 1/63, c: 1/63 + 1/61, a: 1/61, d: 1/62
+			expectedOrder: []string{"c", "b", "a", "d"},
+			expectedScores: map[string]float64{
+				"a": 1.0 / 61,
+				"b": 1.0/62 + 1.0/63,
+				"c": 1.0/63 + 1.0/61,
+				"d": 1.0 / 62,
+			},
+		},
+		{
+			name:   "weighted with vector preferred",
+			params: FusionParams{Strategy: types.FusionStrategyWeighted, VectorWeight: 0.8, KeywordWeight: 0.2},
+			// vector normalized: a=1, b=0.5, c=0; keyword normalized: c=1, d=0.6, b=0
+			expectedOrder: []string{"a", "b", "c", "d"},
+			expectedScores: map[string]float64{
+				"a": 0.8,
+				"b": 0.4,
+				"c": 0.2,
+				"d": 0.12,
+			},
+		},
+		{
+			name:          "concat keeps raw scores",
+			params:        FusionParams{},
+			expectedOrder: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := FuseRetrieveResults(testRetrieveResults(), tt.params)
+			if len(results) != 4 {
+				t.Fatalf("expected 4 results, got %d", len(results))
+			}
+			if tt.expectedOrder == nil {
+				raw := map[string]float64{"a": 0.9, "b": 0.8, "c": 0.7, "d": 8}
+				for _, r := range results {
+					if r.Score != raw[r.ChunkID] {
+						t.Errorf("chunk %s: expected raw score %v, got %v", r.ChunkID, raw[r.ChunkID], r.Score)
+					}
+				}
+				return
+			}
+			for i, r := range results {
+				if r.ChunkID != tt.expectedOrder[i] {
+					t.Errorf("position %d: expected chunk %s, got %s", i, tt.expectedOrder[i], r.ChunkID)
+				}
+				if math.Abs(r.Score-tt.expectedScores[r.ChunkID]) > 1e-9 {
+					t.Errorf("chunk %s: expected score %v, got %v", r.ChunkID, tt.expectedScores[r.ChunkID], r.Score)
+				}
+			}
+		})
+	}
+}
+
+func TestFuseRetrieveResultsDoesNotMutateInput(t *testing.T) {
+	input := testRetrieveResults()
+	FuseRetrieveResults(input, FusionParams{Strategy: types.FusionStrategyRRF})
+	if input[0].Results[0].Score != 0.9 || input[1].Results[0].ChunkID != "c" {
+		t.Errorf("input results were modified")
+	}
+}
+
+func TestNormalizeByKnowledgeBase(t *testing.T) {
+	input := []*types.RetrieveResult{
+		{
+			RetrieverType: types.KeywordsRetrieverType,
+			Results: []*types.IndexWithScore{
+				{ChunkID: "a", KnowledgeBaseID: "kb1", Score: 20},
+				{ChunkID: "b", KnowledgeBaseID: "kb2", Score: 4},
+				{ChunkID: "c", KnowledgeBaseID: "kb1", Score: 10},
+				{ChunkID: "d", KnowledgeBaseID: "kb2", Score: 2},
+			},
+		},
+	}
+
+	results := NormalizeByKnowledgeBase(input)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 result lists, got %d", len(results))
+	}
+	expected := map[string]float64{"a": 1, "c": 0, "b": 1, "d": 0}
+	for _, result := range results {
+		if result.RetrieverType != types.KeywordsRetrieverType {
+			t.Errorf("expected retriever type to be kept, got %s", result.RetrieverType)
+		}
+		kbID := result.Results[0].KnowledgeBaseID
+		for _, r := range result.Results {
+			if r.KnowledgeBaseID != kbID {
+				t.Errorf("expected results of %s only, got %s", kbID, r.KnowledgeBaseID)
+			}
+			if r.Score != expected[r.ChunkID] {
+				t.Errorf("chunk %s: expected score %v, got %v", r.ChunkID, expected[r.ChunkID], r.Score)
+			}
+		}
+	}
+	if input[0].Results[0].Score != 20 {
+		t.Errorf("input results were modified")
+	}
+}
@@ -121,6 +121,20 @@ func (v *KeywordsVectorHybridRetrieveEngineService) DeleteByKnowledgeIDList(ctx
 	return v.indexRepository.DeleteByKnowledgeIDList(ctx, knowledgeIDList, dimension)
 }
 
+// DeleteByKnowledgeBaseID deletes all vectors of a knowledge base
+func (v *KeywordsVectorHybridRetrieveEngineService) DeleteByKnowledgeBaseID(ctx context.Context,
+	knowledgeBaseID string,
+) error {
+	return v.indexRepository.DeleteByKnowledgeBaseID(ctx, knowledgeBaseID)
+}
+
+// SwapKnowledgeBaseIndices replaces the vectors of a knowledge base with the staged vectors
+func (v *KeywordsVectorHybridRetrieveEngineService) SwapKnowledgeBaseIndices(ctx context.Context,
+	knowledgeBaseID string, stagingKnowledgeBaseID string,
+) error {
+	return v.indexRepository.SwapKnowledgeBaseIndices(ctx, knowledgeBaseID, stagingKnowledgeBaseID)
+}
+
 // Support returns the retriever types supported by this engine
 func (v *KeywordsVectorHybridRetrieveEngineService) Support() []types.RetrieverType {
 	return v.indexRepository.Support()
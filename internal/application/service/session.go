@@ -2,11 +2,15 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"maps"
 	"strings"
+	"sync"
 
 	chatpipline "github.com/Tencent/WeKnora/internal/application/service/chat_pipline"
 	"github.com/Tencent/WeKnora/internal/config"
+	werrors "github.com/Tencent/WeKnora/internal/errors"
 	"github.com/Tencent/WeKnora/internal/logger"
 	"github.com/Tencent/WeKnora/internal/models/chat"
 	"github.com/Tencent/WeKnora/internal/tracing"
@@ -24,6 +28,8 @@ type sessionService struct {
 	knowledgeBaseService interfaces.KnowledgeBaseService // Service for knowledge base operations
 	modelService         interfaces.ModelService         // Service for model operations
 	eventManager         *chatpipline.EventManager       // Event manager for chat pipeline
+	pipelines            *chatpipline.PipelineRegistry   // Registry of the chat pipelines
+	summarizing          sync.Map                        // IDs of the sessions whose history is being summarized
 }
 
 // NewSessionService creates a new session service instance with all required dependencies
@@ -33,6 +39,7 @@ func NewSessionService(cfg *config.Config,
 	knowledgeBaseService interfaces.KnowledgeBaseService,
 	modelService interfaces.ModelService,
 	eventManager *chatpipline.EventManager,
+	pipelines *chatpipline.PipelineRegistry,
 ) interfaces.SessionService {
 	return &sessionService{
 		cfg:                  cfg,
@@ -41,6 +48,7 @@ func NewSessionService(cfg *config.Config,
 		knowledgeBaseService: knowledgeBaseService,
 		modelService:         modelService,
 		eventManager:         eventManager,
+		pipelines:            pipelines,
 	}
 }
 
@@ -57,6 +65,11 @@ func (s *sessionService) CreateSession(ctx context.Context, session *types.Sessi
 	logger.Infof(ctx, "Creating session, tenant ID: %d, model ID: %s, knowledge base ID: %s",
 		session.TenantID, session.SummaryModelID, session.KnowledgeBaseID)
 
+	if err := s.pipelines.ValidateConfig(session.Pipeline); err != nil {
+		logger.Errorf(ctx, "Invalid session pipeline: %v", err)
+		return nil, werrors.NewBadRequestError("Invalid pipeline").WithDetails(err.Error())
+	}
+
 	// Create session in repository
 	createdSession, err := s.sessionRepo.Create(ctx, session)
 	if err != nil {
@@ -156,6 +169,27 @@ func (s *sessionService) UpdateSession(ctx context.Context, session *types.Sessi
 
 	logger.Infof(ctx, "Updating session, ID: %s, tenant ID: %d", session.ID, session.TenantID)
 
+	if err := s.pipelines.ValidateConfig(session.Pipeline); err != nil {
+		logger.Errorf(ctx, "Invalid session pipeline: %v", err)
+		return werrors.NewBadRequestError("Invalid pipeline").WithDetails(err.Error())
+	}
+	if err := types.ValidateFusion(session.FusionStrategy, session.VectorWeight, session.KeywordWeight); err != nil {
+		logger.Errorf(ctx, "Invalid fusion strategy: %v", err)
+		return werrors.NewBadRequestError("Invalid fusion strategy").WithDetails(err.Error())
+	}
+
+	// All knowledge bases must exist and belong to the tenant of the session
+	for _, kbID := range session.GetKnowledgeBaseIDs() {
+		kb, err := s.knowledgeBaseService.GetKnowledgeBaseByID(ctx, kbID)
+		if err != nil && !errors.Is(err, types.ErrKnowledgeBaseNotFound) {
+			return err
+		}
+		if err != nil || kb.TenantID != session.TenantID {
+			logger.Errorf(ctx, "Knowledge base %s does not belong to tenant %d", kbID, session.TenantID)
+			return werrors.NewBadRequestError("Knowledge base not found").WithDetails(kbID)
+		}
+	}
+
 	// Update session in repository
 	err := s.sessionRepo.Update(ctx, session)
 	if err != nil {
@@ -213,6 +247,7 @@ func (s *sessionService) GenerateTitle(ctx context.Context,
 	// Get tenant ID from context
 	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
 	logger.Infof(ctx, "Getting session info, session ID: %s, tenant ID: %d", sessionID, tenantID)
+	ctx = context.WithValue(ctx, types.SessionIDContextKey, sessionID)
 
 	// Get session from repository
 	session, err := s.sessionRepo.Get(ctx, tenantID, sessionID)
@@ -306,7 +341,7 @@ func (s *sessionService) GenerateTitle(ctx context.Context,
 }
 
 // KnowledgeQA performs knowledge base question answering with LLM summarization
-func (s *sessionService) KnowledgeQA(ctx context.Context, sessionID, query string) (
+func (s *sessionService) KnowledgeQA(ctx context.Context, sessionID, query string, filter *types.SearchFilter) (
 	[]*types.SearchResult, <-chan types.StreamResponse, error,
 ) {
 	logger.Info(ctx, "Start knowledge base question answering")
@@ -324,21 +359,27 @@ func (s *sessionService) KnowledgeQA(ctx context.Context, sessionID, query strin
 	}
 
 	// Validate knowledge base association
-	if session.KnowledgeBaseID == "" {
+	knowledgeBaseIDs := session.GetKnowledgeBaseIDs()
+	if len(knowledgeBaseIDs) == 0 {
 		logger.Warnf(ctx, "Session has no associated knowledge base, session ID: %s", sessionID)
 		return nil, nil, errors.New("session has no knowledge base")
 	}
 
 	// Create chat management object with session settings
-	logger.Infof(ctx, "Creating chat manage object, knowledge base ID: %s", session.KnowledgeBaseID)
+	logger.Infof(ctx, "Creating chat manage object, knowledge base IDs: %v", knowledgeBaseIDs)
 	chatManage := &types.ChatManage{
 		Query:            query,
 		RewriteQuery:     query,
 		SessionID:        sessionID,
-		KnowledgeBaseID:  session.KnowledgeBaseID,
+		KnowledgeBaseID:  knowledgeBaseIDs[0],
+		KnowledgeBaseIDs: knowledgeBaseIDs,
 		VectorThreshold:  session.VectorThreshold,
 		KeywordThreshold: session.KeywordThreshold,
 		EmbeddingTopK:    session.EmbeddingTopK,
+		FusionStrategy:   session.FusionStrategy,
+		VectorWeight:     session.VectorWeight,
+		KeywordWeight:    session.KeywordWeight,
+		SearchFilter:     filter,
 		RerankModelID:    session.RerankModelID,
 		RerankTopK:       session.RerankTopK,
 		RerankThreshold:  session.RerankThreshold,
@@ -358,38 +399,75 @@ func (s *sessionService) KnowledgeQA(ctx context.Context, sessionID, query strin
 			MaxCompletionTokens: session.SummaryParameters.MaxCompletionTokens,
 		},
 		FallbackResponse: session.FallbackResponse,
+		HistorySummary:   session.Summary,
+		SummaryUntil:     session.SummaryUntil,
+	}
+	if session.QueryExpansion != nil {
+		chatManage.QueryParaphrases = session.QueryExpansion.Paraphrases
+		chatManage.QueryHyDE = session.QueryExpansion.HyDE
+	}
+
+	steps, err := s.ResolvePipeline(ctx, session)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to resolve pipeline, session ID: %s, error: %v", sessionID, err)
+		return nil, nil, err
 	}
 
 	// Start knowledge QA event processing
 	logger.Info(ctx, "Triggering knowledge base question answering event")
-	err = s.KnowledgeQAByEvent(ctx, chatManage, types.Pipline["rag_stream"])
+	err = s.KnowledgeQAByPipeline(ctx, chatManage, steps)
 	if err != nil {
 		logger.ErrorWithFields(ctx, err, map[string]interface{}{
-			"session_id":        sessionID,
-			"knowledge_base_id": session.KnowledgeBaseID,
+			"session_id":         sessionID,
+			"knowledge_base_ids": knowledgeBaseIDs,
 		})
 		return nil, nil, err
 	}
+	if chatManage.ResponseChan == nil {
+		logger.Errorf(ctx, "Pipeline produced no stream response, session ID: %s", sessionID)
+		return nil, nil, errors.New("pipeline produced no stream response")
+	}
 
 	logger.Info(ctx, "Knowledge base question answering completed")
 	return chatManage.MergeResult, chatManage.ResponseChan, nil
 }
 
+// ResolvePipeline returns the pipeline of a session, falling back to the pipeline of the tenant
+// and then to the default pipeline of the config
+func (s *sessionService) ResolvePipeline(ctx context.Context, session *types.Session) ([]types.PipelineStep, error) {
+	var tenantPipeline *types.PipelineConfig
+	if tenant, ok := ctx.Value(types.TenantInfoContextKey).(*types.Tenant); ok && tenant != nil {
+		tenantPipeline = tenant.Pipeline
+	}
+	return s.pipelines.Resolve(session.Pipeline, tenantPipeline)
+}
+
 // KnowledgeQAByEvent processes knowledge QA through a series of events in the pipeline
 func (s *sessionService) KnowledgeQAByEvent(ctx context.Context,
 	chatManage *types.ChatManage, eventList []types.EventType,
 ) error {
-	ctx, span := tracing.ContextWithSpan(ctx, "SessionService.KnowledgeQAByEvent")
+	return s.KnowledgeQAByPipeline(ctx, chatManage, types.PipelineSteps(eventList))
+}
+
+// KnowledgeQAByPipeline processes knowledge QA through the steps of a pipeline,
+// the parameters of a step are applied to the chat manage before its event is triggered
+func (s *sessionService) KnowledgeQAByPipeline(ctx context.Context,
+	chatManage *types.ChatManage, steps []types.PipelineStep,
+) error {
+	ctx, span := tracing.ContextWithSpan(ctx, "SessionService.KnowledgeQAByPipeline")
 	defer span.End()
+	if chatManage.SessionID != "" {
+		ctx = context.WithValue(ctx, types.SessionIDContextKey, chatManage.SessionID)
+	}
 
 	logger.Info(ctx, "Start processing knowledge base question answering through events")
-	logger.Infof(ctx, "Knowledge base question answering parameters, session ID: %s, knowledge base ID: %s, query: %s",
-		chatManage.SessionID, chatManage.KnowledgeBaseID, chatManage.Query)
+	logger.Infof(ctx, "Knowledge base question answering parameters, session ID: %s, knowledge base IDs: %v, query: %s",
+		chatManage.SessionID, chatManage.GetKnowledgeBaseIDs(), chatManage.Query)
 
 	// Prepare method list for logging and tracing
 	methods := []string{}
-	for _, event := range eventList {
-		methods = append(methods, string(event))
+	for _, step := range steps {
+		methods = append(methods, string(step.Event))
 	}
 
 	// Set up tracing attributes
@@ -401,7 +479,14 @@ func (s *sessionService) KnowledgeQAByEvent(ctx context.Context,
 	)
 
 	// Process each event in sequence
-	for _, event := range eventList {
+	for _, step := range steps {
+		event := step.Event
+		if len(step.Params) > 0 {
+			if err := applyPipelineParams(chatManage, step.Params); err != nil {
+				logger.Errorf(ctx, "Failed to apply parameters of event %v: %v", event, err)
+				return err
+			}
+		}
 		logger.Infof(ctx, "Starting to trigger event: %v", event)
 		err := s.eventManager.Trigger(ctx, event, chatManage)
 
@@ -429,9 +514,23 @@ func (s *sessionService) KnowledgeQAByEvent(ctx context.Context,
 	return nil
 }
 
+// applyPipelineParams overrides the chat manage fields named by the json keys of the parameters,
+// protected fields are never overridden even if the pipeline was not validated
+func applyPipelineParams(chatManage *types.ChatManage, params map[string]interface{}) error {
+	params = maps.Clone(params)
+	maps.DeleteFunc(params, func(key string, _ interface{}) bool {
+		return chatpipline.IsProtectedPipelineParam(key)
+	})
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, chatManage)
+}
+
 // SearchKnowledge performs knowledge base search without LLM summarization
 func (s *sessionService) SearchKnowledge(ctx context.Context,
-	knowledgeBaseID, query string,
+	knowledgeBaseID, query string, filter *types.SearchFilter,
 ) ([]*types.SearchResult, error) {
 	logger.Info(ctx, "Start knowledge base search without LLM summary")
 	logger.Infof(ctx, "Knowledge base search parameters, knowledge base ID: %s, query: %s", knowledgeBaseID, query)
@@ -444,8 +543,12 @@ func (s *sessionService) SearchKnowledge(ctx context.Context,
 		VectorThreshold:  s.cfg.Conversation.VectorThreshold,  // Use default configuration
 		KeywordThreshold: s.cfg.Conversation.KeywordThreshold, // Use default configuration
 		EmbeddingTopK:    s.cfg.Conversation.EmbeddingTopK,    // Use default configuration
-		RerankTopK:       s.cfg.Conversation.RerankTopK,       // Use default configuration
-		RerankThreshold:  s.cfg.Conversation.RerankThreshold,  // Use default configuration
+		FusionStrategy:   types.FusionStrategy(s.cfg.Conversation.FusionStrategy),
+		VectorWeight:     s.cfg.Conversation.VectorWeight,
+		KeywordWeight:    s.cfg.Conversation.KeywordWeight,
+		SearchFilter:     filter,
+		RerankTopK:       s.cfg.Conversation.RerankTopK,      // Use default configuration
+		RerankThreshold:  s.cfg.Conversation.RerankThreshold, // Use default configuration
 	}
 
 	// Get default models
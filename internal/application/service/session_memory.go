@@ -0,0 +1,173 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	chatpipline "github.com/Tencent/WeKnora/internal/application/service/chat_pipline"
+	"github.com/Tencent/WeKnora/internal/config"
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/models/chat"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+const (
+	// summaryMessageLimit is the number of most recent messages of a session considered for summarization
+	summaryMessageLimit = 40
+	// defaultKeepRounds is the number of most recent rounds kept out of the summary when the config sets none
+	defaultKeepRounds = 2
+	// defaultMaxSummaryTokens is the token limit of the summary when the config sets none
+	defaultMaxSummaryTokens = 512
+)
+
+// thinkTagRegexp matches the thinking process of the summary model
+var thinkTagRegexp = regexp.MustCompile(`(?s)<think>.*?</think>`)
+
+// SummarizeHistory compresses the older rounds of a session into its rolling conversation summary
+// once the rounds not summarized yet exceed the token budget or the maximum number of rounds.
+// The most recent rounds are kept as they are, a session is summarized by one call at a time
+func (s *sessionService) SummarizeHistory(ctx context.Context, sessionID string) error {
+	memory := s.cfg.Conversation.Memory
+	if memory == nil || !memory.Enabled {
+		return nil
+	}
+	if _, running := s.summarizing.LoadOrStore(sessionID, struct{}{}); running {
+		logger.Infof(ctx, "Session history is already being summarized, session ID: %s", sessionID)
+		return nil
+	}
+	defer s.summarizing.Delete(sessionID)
+
+	tenantID := ctx.Value(types.TenantIDContextKey).(uint)
+	ctx = context.WithValue(ctx, types.SessionIDContextKey, sessionID)
+	session, err := s.sessionRepo.Get(ctx, tenantID, sessionID)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to get session, session ID: %s, error: %v", sessionID, err)
+		return err
+	}
+	messages, err := s.messageRepo.GetRecentMessagesBySession(ctx, sessionID, summaryMessageLimit)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to get conversation history, session ID: %s, error: %v", sessionID, err)
+		return err
+	}
+
+	rounds := roundsToSummarize(chatpipline.GroupHistory(messages),
+		session.SummaryUntil, memory, s.cfg.Conversation.MaxRounds)
+	if len(rounds) == 0 {
+		return nil
+	}
+	logger.Infof(ctx, "Summarizing %d conversation rounds, session ID: %s", len(rounds), sessionID)
+
+	summary, err := s.summarizeRounds(ctx, session, rounds, memory)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to summarize conversation history, session ID: %s, error: %v", sessionID, err)
+		return err
+	}
+	until := rounds[len(rounds)-1].CreateAt
+	updated, err := s.sessionRepo.UpdateSummary(ctx, tenantID, sessionID, summary, until)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to update conversation summary, session ID: %s, error: %v", sessionID, err)
+		return err
+	}
+	if !updated {
+		logger.Infof(ctx, "Conversation summary is already more recent, session ID: %s", sessionID)
+		return nil
+	}
+
+	logger.Infof(ctx, "Conversation summary updated, session ID: %s, summary until: %s",
+		sessionID, until.Format(time.RFC3339))
+	return nil
+}
+
+// roundsToSummarize returns the rounds to compress into the summary, all rounds after the summary
+// but the most recent ones once they exceed the token budget or the maximum number of rounds
+func roundsToSummarize(history []*types.History,
+	summaryUntil *time.Time, memory *config.MemoryConfig, maxRounds int,
+) []*types.History {
+	if summaryUntil != nil {
+		history = slices.DeleteFunc(slices.Clone(history), func(round *types.History) bool {
+			return !round.CreateAt.After(*summaryUntil)
+		})
+	}
+	keepRounds := memory.KeepRounds
+	if keepRounds <= 0 {
+		keepRounds = defaultKeepRounds
+	}
+	if len(history) <= keepRounds {
+		return nil
+	}
+
+	tokens := 0
+	for _, round := range history {
+		tokens += chatpipline.EstimateTokens(round.Query) + chatpipline.EstimateTokens(round.Answer)
+	}
+	overRounds := maxRounds > 0 && len(history) > maxRounds
+	overTokens := memory.MaxHistoryTokens > 0 && tokens > memory.MaxHistoryTokens
+	if !overRounds && !overTokens {
+		return nil
+	}
+	return history[:len(history)-keepRounds]
+}
+
+// summarizeRounds merges the rounds into the current summary of the session with its summary model
+func (s *sessionService) summarizeRounds(ctx context.Context,
+	session *types.Session, rounds []*types.History, memory *config.MemoryConfig,
+) (string, error) {
+	data := map[string]interface{}{
+		"Summary":      session.Summary,
+		"Conversation": rounds,
+	}
+	systemContent, err := renderMemoryPrompt(memory.PromptSystem, data)
+	if err != nil {
+		return "", err
+	}
+	userContent, err := renderMemoryPrompt(memory.PromptUser, data)
+	if err != nil {
+		return "", err
+	}
+
+	chatModel, err := s.modelService.GetChatModel(ctx, session.SummaryModelID)
+	if err != nil {
+		return "", err
+	}
+	maxTokens := memory.MaxSummaryTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultMaxSummaryTokens
+	}
+	thinking := false
+	response, err := chatModel.Chat(ctx, []chat.Message{
+		{Role: "system", Content: systemContent},
+		{Role: "user", Content: userContent},
+	}, &chat.ChatOptions{
+		Temperature:         0.3,
+		MaxCompletionTokens: maxTokens,
+		Thinking:            &thinking,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	summary := strings.TrimSpace(thinkTagRegexp.ReplaceAllString(response.Content, ""))
+	if summary == "" {
+		return "", errors.New("summary model returned an empty summary")
+	}
+	return summary, nil
+}
+
+// renderMemoryPrompt executes a summarization prompt template
+func renderMemoryPrompt(text string, data map[string]interface{}) (string, error) {
+	tmpl, err := template.New("memoryPrompt").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, data); err != nil {
+		return "", err
+	}
+	return content.String(), nil
+}
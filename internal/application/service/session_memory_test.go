@@ -0,0 +1,85 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/config"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// newRounds creates conversation rounds one minute apart with answers of the given length
+func newRounds(count int, answerLength int) []*types.History {
+	start := time.Date(2025, 8, 12, 10, 0, 0, 0, time.UTC)
+	rounds := make([]*types.History, 0, count)
+	for i := 0; i < count; i++ {
+		rounds = append(rounds, &types.History{
+			Query:    "question",
+			Answer:   strings.Repeat("a", answerLength),
+			CreateAt: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return rounds
+}
+
+func TestRoundsToSummarize(t *testing.T) {
+	memory := &config.MemoryConfig{Enabled: true, MaxHistoryTokens: 100, KeepRounds: 2}
+
+	tests := []struct {
+		name         string
+		history      []*types.History
+		summaryUntil func(history []*types.History) *time.Time
+		maxRounds    int
+		want         int
+	}{
+		{
+			name:      "within budget",
+			history:   newRounds(4, 40),
+			maxRounds: 5,
+			want:      0,
+		},
+		{
+			name:      "over token budget",
+			history:   newRounds(4, 120),
+			maxRounds: 5,
+			want:      2,
+		},
+		{
+			name:      "over max rounds",
+			history:   newRounds(6, 4),
+			maxRounds: 5,
+			want:      4,
+		},
+		{
+			name:    "summarized rounds are skipped",
+			history: newRounds(6, 4),
+			summaryUntil: func(history []*types.History) *time.Time {
+				return &history[2].CreateAt
+			},
+			maxRounds: 5,
+			want:      0,
+		},
+		{
+			name:      "recent rounds are kept",
+			history:   newRounds(2, 1000),
+			maxRounds: 5,
+			want:      0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var summaryUntil *time.Time
+			if tt.summaryUntil != nil {
+				summaryUntil = tt.summaryUntil(tt.history)
+			}
+			rounds := roundsToSummarize(tt.history, summaryUntil, memory, tt.maxRounds)
+			if len(rounds) != tt.want {
+				t.Fatalf("Expected %d rounds to summarize, got %d", tt.want, len(rounds))
+			}
+			if len(rounds) > 0 && rounds[0] != tt.history[0] {
+				t.Errorf("Expected the oldest rounds to be summarized first")
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	werrors "github.com/Tencent/WeKnora/internal/errors"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+func TestUpdateSessionValidatesFusion(t *testing.T) {
+	s := &sessionService{}
+	for name, session := range map[string]*types.Session{
+		"unknown strategy": {ID: "s1", FusionStrategy: "max"},
+		"negative weight":  {ID: "s1", FusionStrategy: types.FusionStrategyWeighted, VectorWeight: -1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := s.UpdateSession(context.Background(), session)
+			if appErr, ok := werrors.IsAppError(err); !ok || appErr.HTTPCode != http.StatusBadRequest {
+				t.Errorf("Expected a bad request, got %v", err)
+			}
+		})
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"strings"
 	"time"
 
+	chatpipline "github.com/Tencent/WeKnora/internal/application/service/chat_pipline"
+	werrors "github.com/Tencent/WeKnora/internal/errors"
 	"github.com/Tencent/WeKnora/internal/logger"
 	"github.com/Tencent/WeKnora/internal/types"
 	"github.com/Tencent/WeKnora/internal/types/interfaces"
@@ -32,12 +34,15 @@ type ListTenantsParams struct {
 
 // tenantService implements the TenantService interface
 type tenantService struct {
-	repo interfaces.TenantRepository // Repository for tenant data operations
+	repo      interfaces.TenantRepository   // Repository for tenant data operations
+	pipelines *chatpipline.PipelineRegistry // Registry used to validate the tenant pipeline
 }
 
 // NewTenantService creates a new tenant service instance
-func NewTenantService(repo interfaces.TenantRepository) interfaces.TenantService {
-	return &tenantService{repo: repo}
+func NewTenantService(repo interfaces.TenantRepository,
+	pipelines *chatpipline.PipelineRegistry,
+) interfaces.TenantService {
+	return &tenantService{repo: repo, pipelines: pipelines}
 }
 
 // CreateTenant creates a new tenant
@@ -48,6 +53,10 @@ func (s *tenantService) CreateTenant(ctx context.Context, tenant *types.Tenant)
 		logger.Error(ctx, "Tenant name cannot be empty")
 		return nil, errors.New("tenant name cannot be empty")
 	}
+	if err := s.pipelines.ValidateConfig(tenant.Pipeline); err != nil {
+		logger.Errorf(ctx, "Invalid tenant pipeline: %v", err)
+		return nil, werrors.NewBadRequestError("Invalid pipeline").WithDetails(err.Error())
+	}
 
 	logger.Infof(ctx, "Creating tenant, name: %s", tenant.Name)
 
@@ -125,6 +134,11 @@ func (s *tenantService) UpdateTenant(ctx context.Context, tenant *types.Tenant)
 
 	logger.Infof(ctx, "Updating tenant, ID: %d, name: %s", tenant.ID, tenant.Name)
 
+	if err := s.pipelines.ValidateConfig(tenant.Pipeline); err != nil {
+		logger.Errorf(ctx, "Invalid tenant pipeline: %v", err)
+		return nil, werrors.NewBadRequestError("Invalid pipeline").WithDetails(err.Error())
+	}
+
 	// Generate new API key if empty
 	if tenant.APIKey == "" {
 		logger.Info(ctx, "API Key is empty, generating new API Key")
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/Tencent/WeKnora/internal/config"
+	werrors "github.com/Tencent/WeKnora/internal/errors"
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+)
+
+// usageService implements the UsageService interface
+type usageService struct {
+	cfg  *config.Config
+	repo interfaces.UsageRepository
+}
+
+// NewUsageService creates a new usage service instance
+func NewUsageService(cfg *config.Config, repo interfaces.UsageRepository) interfaces.UsageService {
+	return &usageService{cfg: cfg, repo: repo}
+}
+
+// RecordUsage records the token usage of a model call, attributed to the tenant, session and knowledge
+// of the context. Accounting never fails the model call, a record that cannot be saved is only logged
+func (s *usageService) RecordUsage(ctx context.Context,
+	usageType types.UsageType, modelID string, modelName string, usage *types.TokenUsage,
+) {
+	if s.cfg.Usage == nil || !s.cfg.Usage.Enabled || usage == nil {
+		return
+	}
+	tenantID, ok := ctx.Value(types.TenantIDContextKey).(uint)
+	if !ok {
+		logger.Warnf(ctx, "Token usage of model %s is not attributed to a tenant, skipped", modelName)
+		return
+	}
+	sessionID, _ := ctx.Value(types.SessionIDContextKey).(string)
+	knowledgeID, _ := ctx.Value(types.KnowledgeIDContextKey).(string)
+
+	totalTokens := usage.TotalTokens
+	if totalTokens == 0 {
+		totalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	record := &types.UsageRecord{
+		TenantID:         tenantID,
+		SessionID:        sessionID,
+		KnowledgeID:      knowledgeID,
+		ModelID:          modelID,
+		ModelName:        modelName,
+		Type:             usageType,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      totalTokens,
+	}
+	// The record outlives a cancelled request, the tokens have been consumed anyway
+	if err := s.repo.CreateUsageRecord(context.WithoutCancel(ctx), record); err != nil {
+		logger.Errorf(ctx, "Failed to record token usage of model %s: %v", modelName, err)
+	}
+}
+
+// GetUsageReport reports the token usage and cost of the tenant in a period,
+// grouping by tenant reports the usage of every tenant and is reserved to usage admin tenants
+func (s *usageService) GetUsageReport(ctx context.Context,
+	params *types.UsageReportParams,
+) (*types.UsageReport, error) {
+	params.TenantID = ctx.Value(types.TenantIDContextKey).(uint)
+	if slices.Contains(params.GroupBy, types.UsageGroupByTenant) {
+		if s.cfg.Usage == nil || !slices.Contains(s.cfg.Usage.AdminTenantIDs, params.TenantID) {
+			return nil, werrors.NewForbiddenError("Grouping by tenant is reserved to usage admin tenants")
+		}
+		params.AllTenants = true
+	}
+	logger.Infof(ctx, "Getting usage report, tenant ID: %d, start: %s, end: %s, group by: %v",
+		params.TenantID, params.StartTime, params.EndTime, params.GroupBy)
+
+	rows, err := s.repo.AggregateUsage(ctx, params)
+	if err != nil {
+		logger.ErrorWithFields(ctx, err, map[string]interface{}{
+			"tenant_id": params.TenantID,
+		})
+		return nil, err
+	}
+
+	var prices []config.ModelPrice
+	currency := ""
+	if s.cfg.Usage != nil {
+		prices = s.cfg.Usage.Prices
+		currency = s.cfg.Usage.Currency
+	}
+	items, total := groupUsage(rows, params.GroupBy, prices)
+	return &types.UsageReport{
+		StartTime: params.StartTime,
+		EndTime:   params.EndTime,
+		Currency:  currency,
+		Items:     items,
+		Total:     total,
+	}, nil
+}
+
+// groupUsage prices the per model rows and merges them into the requested groups,
+// ordered by day, tenant, model name and type. It also returns the total of all the rows
+func groupUsage(rows []*types.UsageReportItem,
+	groupBy []types.UsageGroupBy, prices []config.ModelPrice,
+) ([]*types.UsageReportItem, *types.UsageReportItem) {
+	byDay := slices.Contains(groupBy, types.UsageGroupByDay)
+	byTenant := slices.Contains(groupBy, types.UsageGroupByTenant)
+	byModel := slices.Contains(groupBy, types.UsageGroupByModel)
+	total := &types.UsageReportItem{}
+	groups := make(map[types.UsageReportItem]*types.UsageReportItem)
+	items := make([]*types.UsageReportItem, 0)
+	for _, row := range rows {
+		row.Cost = usageCost(row, prices)
+		addUsage(total, row)
+
+		var key types.UsageReportItem
+		if byDay {
+			key.Day = row.Day
+		}
+		if byTenant {
+			key.TenantID = row.TenantID
+		}
+		if byModel {
+			key.ModelID, key.ModelName, key.Type = row.ModelID, row.ModelName, row.Type
+		}
+		item, ok := groups[key]
+		if !ok {
+			item = &types.UsageReportItem{}
+			*item = key
+			groups[key] = item
+			items = append(items, item)
+		}
+		addUsage(item, row)
+	}
+
+	slices.SortFunc(items, func(a, b *types.UsageReportItem) int {
+		return cmp.Or(
+			strings.Compare(a.Day, b.Day),
+			cmp.Compare(a.TenantID, b.TenantID),
+			strings.Compare(a.ModelName, b.ModelName),
+			strings.Compare(string(a.Type), string(b.Type)),
+		)
+	})
+	return items, total
+}
+
+// addUsage adds the calls, tokens and cost of a row to an item
+func addUsage(item *types.UsageReportItem, row *types.UsageReportItem) {
+	item.Calls += row.Calls
+	item.PromptTokens += row.PromptTokens
+	item.CompletionTokens += row.CompletionTokens
+	item.TotalTokens += row.TotalTokens
+	item.Cost += row.Cost
+}
+
+// usageCost returns the cost of the tokens of a model at its configured price per thousand tokens,
+// models without a price cost nothing
+func usageCost(row *types.UsageReportItem, prices []config.ModelPrice) float64 {
+	for _, price := range prices {
+		if price.Model != row.ModelName && price.Model != row.ModelID {
+			continue
+		}
+		return float64(row.PromptTokens)/1000*price.PromptPrice +
+			float64(row.CompletionTokens)/1000*price.CompletionPrice
+	}
+	return 0
+}
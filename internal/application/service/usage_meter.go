@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Tencent/WeKnora/internal/models/chat"
+	"github.com/Tencent/WeKnora/internal/models/embedding"
+	"github.com/Tencent/WeKnora/internal/models/rerank"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+)
+
+// ErrTokenQuotaExceeded is returned when the tenant has consumed its daily token quota
+var ErrTokenQuotaExceeded = errors.New("token quota exceeded")
+
+// TokenQuotaError rejects a model call of a tenant without tokens left today,
+// it matches ErrTokenQuotaExceeded and carries the quota decision to tell when to retry
+type TokenQuotaError struct {
+	Decision *types.QuotaDecision
+}
+
+// Error implements the error interface
+func (e *TokenQuotaError) Error() string {
+	return ErrTokenQuotaExceeded.Error()
+}
+
+// Unwrap returns ErrTokenQuotaExceeded
+func (e *TokenQuotaError) Unwrap() error {
+	return ErrTokenQuotaExceeded
+}
+
+// checkTokenQuota returns a TokenQuotaError when the tenant of the context has no tokens left today
+func checkTokenQuota(ctx context.Context, quotaLimiter interfaces.QuotaLimiter) error {
+	if decision := quotaLimiter.CheckTokens(ctx); !decision.Allowed {
+		return &TokenQuotaError{Decision: decision}
+	}
+	return nil
+}
+
+// consumeTokens records the usage of a model call and counts its tokens against the daily token quota
+func consumeTokens(ctx context.Context,
+	usageService interfaces.UsageService, quotaLimiter interfaces.QuotaLimiter,
+	usageType types.UsageType, modelID string, modelName string, usage *types.TokenUsage,
+) {
+	usageService.RecordUsage(ctx, usageType, modelID, modelName, usage)
+	if usage == nil {
+		return
+	}
+	tokens := usage.TotalTokens
+	if tokens == 0 {
+		tokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	quotaLimiter.ConsumeTokens(ctx, tokens)
+}
+
+// meteredChat records the token usage of the calls of a chat model and enforces the token quota
+type meteredChat struct {
+	model        chat.Chat
+	usageService interfaces.UsageService
+	quotaLimiter interfaces.QuotaLimiter
+}
+
+// Chat records the usage reported with the response
+func (c *meteredChat) Chat(ctx context.Context,
+	messages []chat.Message, opts *chat.ChatOptions,
+) (*types.ChatResponse, error) {
+	if err := checkTokenQuota(ctx, c.quotaLimiter); err != nil {
+		return nil, err
+	}
+	response, err := c.model.Chat(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	consumeTokens(ctx, c.usageService, c.quotaLimiter,
+		types.UsageTypeChat, c.GetModelID(), c.GetModelName(), &response.Usage)
+	return response, nil
+}
+
+// ChatStream forwards the stream and records the usage reported with its final fragment
+func (c *meteredChat) ChatStream(ctx context.Context,
+	messages []chat.Message, opts *chat.ChatOptions,
+) (<-chan types.StreamResponse, error) {
+	if err := checkTokenQuota(ctx, c.quotaLimiter); err != nil {
+		return nil, err
+	}
+	stream, err := c.model.ChatStream(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	meteredStream := make(chan types.StreamResponse)
+	go func() {
+		defer close(meteredStream)
+		for response := range stream {
+			if response.Usage != nil {
+				consumeTokens(ctx, c.usageService, c.quotaLimiter,
+					types.UsageTypeChat, c.GetModelID(), c.GetModelName(), response.Usage)
+			}
+			meteredStream <- response
+		}
+	}()
+	return meteredStream, nil
+}
+
+// GetModelName returns the model name
+func (c *meteredChat) GetModelName() string {
+	return c.model.GetModelName()
+}
+
+// GetModelID returns the model ID
+func (c *meteredChat) GetModelID() string {
+	return c.model.GetModelID()
+}
+
+// meteredEmbedder records the token usage of the calls of an embedding model and enforces the token quota
+type meteredEmbedder struct {
+	embedding.Embedder
+	usageService interfaces.UsageService
+	quotaLimiter interfaces.QuotaLimiter
+}
+
+// Embed converts text to vector
+func (e *meteredEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := e.BatchEmbed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) == 0 {
+		return nil, fmt.Errorf("no embedding returned")
+	}
+	return embeddings[0], nil
+}
+
+// BatchEmbed converts multiple texts to vectors in batch
+func (e *meteredEmbedder) BatchEmbed(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings, _, err := e.BatchEmbedWithUsage(ctx, texts)
+	return embeddings, err
+}
+
+// BatchEmbedWithUsage converts multiple texts to vectors in batch and records the tokens consumed
+func (e *meteredEmbedder) BatchEmbedWithUsage(ctx context.Context,
+	texts []string,
+) ([][]float32, *types.TokenUsage, error) {
+	if err := checkTokenQuota(ctx, e.quotaLimiter); err != nil {
+		return nil, nil, err
+	}
+	embeddings, usage, err := e.Embedder.BatchEmbedWithUsage(ctx, texts)
+	if err != nil {
+		return nil, nil, err
+	}
+	consumeTokens(ctx, e.usageService, e.quotaLimiter,
+		types.UsageTypeEmbedding, e.GetModelID(), e.GetModelName(), usage)
+	return embeddings, usage, nil
+}
+
+// meteredReranker records the token usage of the calls of a rerank model and enforces the token quota
+type meteredReranker struct {
+	rerank.Reranker
+	usageService interfaces.UsageService
+	quotaLimiter interfaces.QuotaLimiter
+}
+
+// Rerank reranks documents based on relevance to the query
+func (r *meteredReranker) Rerank(ctx context.Context,
+	query string, documents []string,
+) ([]rerank.RankResult, error) {
+	results, _, err := r.RerankWithUsage(ctx, query, documents)
+	return results, err
+}
+
+// RerankWithUsage reranks documents based on relevance to the query and records the tokens consumed
+func (r *meteredReranker) RerankWithUsage(ctx context.Context,
+	query string, documents []string,
+) ([]rerank.RankResult, *types.TokenUsage, error) {
+	if err := checkTokenQuota(ctx, r.quotaLimiter); err != nil {
+		return nil, nil, err
+	}
+	results, usage, err := r.Reranker.RerankWithUsage(ctx, query, documents)
+	if err != nil {
+		return nil, nil, err
+	}
+	consumeTokens(ctx, r.usageService, r.quotaLimiter,
+		types.UsageTypeRerank, r.GetModelID(), r.GetModelName(), usage)
+	return results, usage, nil
+}
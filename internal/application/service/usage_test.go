@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/config"
+	werrors "github.com/Tencent/WeKnora/internal/errors"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+)
+
+func TestGroupUsage(t *testing.T) {
+	prices := []config.ModelPrice{
+		{Model: "qwen-plus", PromptPrice: 1, CompletionPrice: 2},
+		{Model: "embedding-model-id", PromptPrice: 0.5},
+	}
+	newRows := func() []*types.UsageReportItem {
+		return []*types.UsageReportItem{
+			{Day: "2025-08-13", ModelID: "chat-model-id", ModelName: "qwen-plus", Type: types.UsageTypeChat,
+				Calls: 2, PromptTokens: 3000, CompletionTokens: 1000, TotalTokens: 4000},
+			{Day: "2025-08-12", ModelID: "embedding-model-id", ModelName: "bge-m3", Type: types.UsageTypeEmbedding,
+				Calls: 5, PromptTokens: 2000, TotalTokens: 2000},
+			{Day: "2025-08-12", ModelID: "chat-model-id", ModelName: "qwen-plus", Type: types.UsageTypeChat,
+				Calls: 1, PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500},
+			{Day: "2025-08-12", ModelID: "rerank-model-id", ModelName: "gte-rerank", Type: types.UsageTypeRerank,
+				Calls: 1, PromptTokens: 800, TotalTokens: 800},
+		}
+	}
+
+	items, total := groupUsage(newRows(), []types.UsageGroupBy{types.UsageGroupByDay}, prices)
+	if len(items) != 2 || items[0].Day != "2025-08-12" || items[1].Day != "2025-08-13" {
+		t.Fatalf("Expected one item per day in date order, got %+v", items)
+	}
+	if items[0].Calls != 7 || items[0].TotalTokens != 4300 || items[0].ModelName != "" {
+		t.Errorf("Expected the models of a day to be merged, got %+v", items[0])
+	}
+	// 1000 prompt and 500 completion tokens of qwen-plus, 2000 tokens of the embedding model priced by ID
+	if math.Abs(items[0].Cost-3) > 1e-9 {
+		t.Errorf("Expected cost 3 on 2025-08-12, got %v", items[0].Cost)
+	}
+	if total.Calls != 9 || total.TotalTokens != 8300 || math.Abs(total.Cost-8) > 1e-9 {
+		t.Errorf("Expected total of 9 calls, 8300 tokens and cost 8, got %+v", total)
+	}
+
+	items, _ = groupUsage(newRows(), []types.UsageGroupBy{types.UsageGroupByModel}, prices)
+	if len(items) != 3 || items[0].ModelName != "bge-m3" || items[2].ModelName != "qwen-plus" {
+		t.Fatalf("Expected one item per model in name order, got %+v", items)
+	}
+	if items[2].Calls != 3 || items[2].PromptTokens != 4000 || math.Abs(items[2].Cost-7) > 1e-9 {
+		t.Errorf("Expected the days of qwen-plus to be merged, got %+v", items[2])
+	}
+	if items[1].Cost != 0 {
+		t.Errorf("Expected a model without price to cost nothing, got %v", items[1].Cost)
+	}
+}
+
+// fakeUsageRepo records the parameters of the aggregations
+type fakeUsageRepo struct {
+	interfaces.UsageRepository
+	params *types.UsageReportParams
+}
+
+func (r *fakeUsageRepo) AggregateUsage(ctx context.Context,
+	params *types.UsageReportParams,
+) ([]*types.UsageReportItem, error) {
+	r.params = params
+	return nil, nil
+}
+
+func TestGetUsageReportGroupByTenant(t *testing.T) {
+	cfg := &config.Config{Usage: &config.UsageConfig{AdminTenantIDs: []uint{1}}}
+	groupBy := []types.UsageGroupBy{types.UsageGroupByTenant}
+
+	repo := &fakeUsageRepo{}
+	s := NewUsageService(cfg, repo)
+	ctx := context.WithValue(context.Background(), types.TenantIDContextKey, uint(2))
+	_, err := s.GetUsageReport(ctx, &types.UsageReportParams{GroupBy: groupBy})
+	var appErr *werrors.AppError
+	if !errors.As(err, &appErr) || appErr.HTTPCode != http.StatusForbidden {
+		t.Fatalf("Expected a forbidden error for a tenant that is not a usage admin, got %v", err)
+	}
+	if repo.params != nil {
+		t.Error("Expected no aggregation for a forbidden report")
+	}
+
+	ctx = context.WithValue(context.Background(), types.TenantIDContextKey, uint(1))
+	if _, err := s.GetUsageReport(ctx, &types.UsageReportParams{GroupBy: groupBy}); err != nil {
+		t.Fatalf("Expected no error for a usage admin, got %v", err)
+	}
+	if !repo.params.AllTenants {
+		t.Error("Expected the usage of every tenant to be aggregated")
+	}
+
+	if _, err := s.GetUsageReport(ctx, &types.UsageReportParams{
+		GroupBy: []types.UsageGroupBy{types.UsageGroupByDay},
+	}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if repo.params.AllTenants || repo.params.TenantID != 1 {
+		t.Errorf("Expected the usage of the tenant only, got %+v", repo.params)
+	}
+}
+
+// fakeTokenLimiter answers the token quota checks with a fixed decision
+type fakeTokenLimiter struct {
+	interfaces.QuotaLimiter
+	decision *types.QuotaDecision
+}
+
+func (l fakeTokenLimiter) CheckTokens(ctx context.Context) *types.QuotaDecision {
+	return l.decision
+}
+
+func TestCheckTokenQuota(t *testing.T) {
+	if err := checkTokenQuota(context.Background(), fakeTokenLimiter{decision: types.UnlimitedQuota()}); err != nil {
+		t.Fatalf("Expected the call to be allowed, got %v", err)
+	}
+
+	decision := &types.QuotaDecision{Limit: 100, ResetAt: time.Now().Add(time.Hour)}
+	err := checkTokenQuota(context.Background(), fakeTokenLimiter{decision: decision})
+	var quotaErr *TokenQuotaError
+	if !errors.Is(err, ErrTokenQuotaExceeded) || !errors.As(err, &quotaErr) || quotaErr.Decision != decision {
+		t.Errorf("Expected a token quota error carrying the decision, got %v", err)
+	}
+}
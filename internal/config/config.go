@@ -23,6 +23,9 @@ type Config struct {
 	DocReader      *DocReaderConfig      `yaml:"docreader" json:"docreader"`
 	StreamManager  *StreamManagerConfig  `yaml:"stream_manager" json:"stream_manager"`
 	ExtractManager *ExtractManagerConfig `yaml:"extract" json:"extract"`
+	Usage          *UsageConfig          `yaml:"usage" json:"usage"`
+	RateLimit      *RateLimitConfig      `yaml:"rate_limit" json:"rate_limit"`
+	ModelRoute     *ModelRouteConfig     `yaml:"model_route" json:"model_route"`
 }
 
 type DocReaderConfig struct {
@@ -39,6 +42,9 @@ type ConversationConfig struct {
 	KeywordThreshold           float64        `yaml:"keyword_threshold" json:"keyword_threshold"`
 	EmbeddingTopK              int            `yaml:"embedding_top_k" json:"embedding_top_k"`
 	VectorThreshold            float64        `yaml:"vector_threshold" json:"vector_threshold"`
+	FusionStrategy             string         `yaml:"fusion_strategy" json:"fusion_strategy"`
+	VectorWeight               float64        `yaml:"vector_weight" json:"vector_weight"`
+	KeywordWeight              float64        `yaml:"keyword_weight" json:"keyword_weight"`
 	RerankTopK                 int            `yaml:"rerank_top_k" json:"rerank_top_k"`
 	RerankThreshold            float64        `yaml:"rerank_threshold" json:"rerank_threshold"`
 	FallbackStrategy           string         `yaml:"fallback_strategy" json:"fallback_strategy"`
@@ -55,6 +61,34 @@ type ConversationConfig struct {
 	SimplifyQueryPromptUser    string         `yaml:"simplify_query_prompt_user" json:"simplify_query_prompt_user"`
 	ExtractEntitiesPrompt      string         `yaml:"extract_entities_prompt" json:"extract_entities_prompt"`
 	ExtractRelationshipsPrompt string         `yaml:"extract_relationships_prompt" json:"extract_relationships_prompt"`
+	// Pipelines 自定义对话流水线，按名称声明事件步骤及参数，可覆盖内置流水线
+	Pipelines map[string][]types.PipelineStep `yaml:"pipelines" json:"pipelines"`
+	// DefaultPipeline 会话和租户未指定流水线时使用的流水线名称，默认为 rag_stream
+	DefaultPipeline string `yaml:"default_pipeline" json:"default_pipeline"`
+	// TokenBudget 对话模型上下文窗口在提示词、历史对话和检索内容之间的分配比例
+	TokenBudget *types.TokenBudget `yaml:"token_budget" json:"token_budget"`
+	// Memory 会话记忆配置，历史对话超出预算时将较早的轮次压缩为会话摘要
+	Memory *MemoryConfig `yaml:"memory" json:"memory"`
+	// QueryExpansion 查询扩展配置，会话开启查询扩展时生成改写问题和假设答案段落并分别检索
+	QueryExpansion *QueryExpansionConfig `yaml:"query_expansion" json:"query_expansion"`
+}
+
+// QueryExpansionConfig 查询扩展配置
+type QueryExpansionConfig struct {
+	MaxParaphrases   int    `yaml:"max_paraphrases" json:"max_paraphrases"`     // 改写问题数量上限
+	MaxLLMCalls      int    `yaml:"max_llm_calls" json:"max_llm_calls"`         // 每次查询扩展调用大模型的次数上限
+	ParaphrasePrompt string `yaml:"paraphrase_prompt" json:"paraphrase_prompt"` // 生成改写问题的提示词模板
+	HyDEPrompt       string `yaml:"hyde_prompt" json:"hyde_prompt"`             // 生成假设答案段落的提示词模板
+}
+
+// MemoryConfig 会话记忆配置
+type MemoryConfig struct {
+	Enabled          bool   `yaml:"enabled" json:"enabled"`                       // 是否开启会话摘要
+	MaxHistoryTokens int    `yaml:"max_history_tokens" json:"max_history_tokens"` // 未摘要历史对话的token预算
+	KeepRounds       int    `yaml:"keep_rounds" json:"keep_rounds"`               // 摘要后保留的最近原始轮数
+	MaxSummaryTokens int    `yaml:"max_summary_tokens" json:"max_summary_tokens"` // 摘要的最大token数
+	PromptSystem     string `yaml:"prompt_system" json:"prompt_system"`           // 摘要系统提示词
+	PromptUser       string `yaml:"prompt_user" json:"prompt_user"`               // 摘要用户提示词模板
 }
 
 // SummaryConfig 摘要配置
@@ -138,6 +172,35 @@ type FebriText struct {
 	WithNoTag string `yaml:"with_no_tag" json:"with_no_tag"`
 }
 
+// UsageConfig token 用量统计配置
+type UsageConfig struct {
+	Enabled  bool         `yaml:"enabled" json:"enabled"`   // 是否记录模型调用的 token 用量
+	Currency string       `yaml:"currency" json:"currency"` // 费用的币种
+	Prices   []ModelPrice `yaml:"prices" json:"prices"`     // 各模型的价格
+	// 用量管理租户，可按租户分组查看所有租户的用量
+	AdminTenantIDs []uint `yaml:"admin_tenant_ids" json:"admin_tenant_ids"`
+}
+
+// ModelPrice 模型价格，单位为每千 token 的费用
+type ModelPrice struct {
+	Model           string  `yaml:"model" json:"model"`                       // 模型名称或模型ID
+	PromptPrice     float64 `yaml:"prompt_price" json:"prompt_price"`         // 输入 token 价格
+	CompletionPrice float64 `yaml:"completion_price" json:"completion_price"` // 输出 token 价格
+}
+
+// RateLimitConfig 租户限流与配额配置，限流计数存储在 Redis 中以便多副本共享
+type RateLimitConfig struct {
+	Enabled bool                   `yaml:"enabled" json:"enabled"` // 是否启用租户限流
+	Prefix  string                 `yaml:"prefix" json:"prefix"`   // Redis 键前缀
+	Default types.TenantRateLimits `yaml:"default" json:"default"` // 租户未单独配置时使用的默认限额，0 表示不限制
+}
+
+// ModelRouteConfig 模型路由的熔断配置
+type ModelRouteConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold" json:"failure_threshold"` // 连续失败多少次后熔断模型
+	OpenDuration     time.Duration `yaml:"open_duration" json:"open_duration"`         // 熔断持续时间，之后放行一次探测请求
+}
+
 // LoadConfig 从配置文件加载配置
 func LoadConfig() (*Config, error) {
 	// 设置配置文件名和路径
@@ -188,3 +251,17 @@ func LoadConfig() (*Config, error) {
 	fmt.Printf("Using configuration file: %s\n", viper.ConfigFileUsed())
 	return &cfg, nil
 }
+
+// GetGraphDriver returns the store of the retrieval graph selected by the GRAPH_DRIVER environment variable,
+// NEO4J_ENABLE=true still selects Neo4j when GRAPH_DRIVER is unset.
+// An empty result means graph retrieval is disabled
+func GetGraphDriver() types.GraphDriverType {
+	switch driver := types.GraphDriverType(strings.ToLower(os.Getenv("GRAPH_DRIVER"))); driver {
+	case types.Neo4jGraphDriverType, types.PostgresGraphDriverType:
+		return driver
+	}
+	if strings.ToLower(os.Getenv("NEO4J_ENABLE")) == "true" {
+		return types.Neo4jGraphDriverType
+	}
+	return ""
+}
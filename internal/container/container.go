@@ -34,6 +34,7 @@ import (
 	"github.com/Tencent/WeKnora/internal/logger"
 	"github.com/Tencent/WeKnora/internal/models/embedding"
 	"github.com/Tencent/WeKnora/internal/models/utils/ollama"
+	"github.com/Tencent/WeKnora/internal/quota"
 	"github.com/Tencent/WeKnora/internal/router"
 	"github.com/Tencent/WeKnora/internal/stream"
 	"github.com/Tencent/WeKnora/internal/tracing"
@@ -72,6 +73,7 @@ func BuildContainer(container *dig.Container) *dig.Container {
 	must(container.Provide(initOllamaService))
 	must(container.Provide(initNeo4jClient))
 	must(container.Provide(stream.NewStreamManager))
+	must(container.Provide(quota.NewQuotaLimiter))
 
 	// Data repositories layer
 	must(container.Provide(repository.NewTenantRepository))
@@ -83,7 +85,12 @@ func BuildContainer(container *dig.Container) *dig.Container {
 	must(container.Provide(repository.NewModelRepository))
 	must(container.Provide(repository.NewUserRepository))
 	must(container.Provide(repository.NewAuthTokenRepository))
-	must(container.Provide(neo4jRepo.NewNeo4jRepository))
+	must(container.Provide(repository.NewReindexJobRepository))
+	must(container.Provide(repository.NewEvaluationRepository))
+	must(container.Provide(repository.NewDatasetRepository))
+	must(container.Provide(repository.NewGraphRepository))
+	must(container.Provide(repository.NewUsageRepository))
+	must(container.Provide(initRetrieveGraphRepository))
 
 	// Business service layer
 	must(container.Provide(service.NewTenantService))
@@ -93,18 +100,27 @@ func BuildContainer(container *dig.Container) *dig.Container {
 	must(container.Provide(service.NewMessageService))
 	must(container.Provide(service.NewChunkService))
 	must(container.Provide(embedding.NewBatchEmbedder))
+	must(container.Provide(service.NewUsageService))
 	must(container.Provide(service.NewModelService))
 	must(container.Provide(service.NewDatasetService))
 	must(container.Provide(service.NewEvaluationService))
+	must(container.Invoke(service.FailInterruptedEvaluations))
 	must(container.Provide(service.NewUserService))
 	must(container.Provide(service.NewChunkExtractService))
+	must(container.Provide(service.NewKnowledgeProcessService))
+	must(container.Provide(service.NewReindexService))
+	must(container.Provide(service.NewKnowledgeRefreshService))
+	must(container.Provide(service.NewGraphReconcileService))
+	must(container.Provide(service.NewGraphService))
 
 	// Chat pipeline components for processing chat requests
 	must(container.Provide(chatpipline.NewEventManager))
+	must(container.Provide(chatpipline.NewPipelineRegistry))
 	must(container.Invoke(chatpipline.NewPluginTracing))
 	must(container.Invoke(chatpipline.NewPluginSearch))
 	must(container.Invoke(chatpipline.NewPluginRerank))
 	must(container.Invoke(chatpipline.NewPluginMerge))
+	must(container.Invoke(chatpipline.NewPluginExpand))
 	must(container.Invoke(chatpipline.NewPluginIntoChatMessage))
 	must(container.Invoke(chatpipline.NewPluginChatCompletion))
 	must(container.Invoke(chatpipline.NewPluginChatCompletionStream))
@@ -112,8 +128,10 @@ func BuildContainer(container *dig.Container) *dig.Container {
 	must(container.Invoke(chatpipline.NewPluginFilterTopK))
 	must(container.Invoke(chatpipline.NewPluginPreprocess))
 	must(container.Invoke(chatpipline.NewPluginRewrite))
+	must(container.Invoke(chatpipline.NewPluginQueryExpand))
 	must(container.Invoke(chatpipline.NewPluginExtractEntity))
 	must(container.Invoke(chatpipline.NewPluginSearchEntity))
+	must(container.Invoke(chatpipline.ValidatePipelines))
 
 	// HTTP handlers layer
 	must(container.Provide(handler.NewTenantHandler))
@@ -124,15 +142,20 @@ func BuildContainer(container *dig.Container) *dig.Container {
 	must(container.Provide(handler.NewMessageHandler))
 	must(container.Provide(handler.NewModelHandler))
 	must(container.Provide(handler.NewEvaluationHandler))
+	must(container.Provide(handler.NewDatasetHandler))
+	must(container.Provide(handler.NewGraphHandler))
 	must(container.Provide(handler.NewInitializationHandler))
 	must(container.Provide(handler.NewAuthHandler))
 	must(container.Provide(handler.NewSystemHandler))
+	must(container.Provide(handler.NewOpenAIHandler))
+	must(container.Provide(handler.NewUsageHandler))
 
 	// Router configuration
 	must(container.Provide(router.NewRouter))
 	must(container.Provide(router.NewAsyncqClient))
 	must(container.Provide(router.NewAsynqServer))
 	must(container.Invoke(router.RunAsynqServer))
+	must(container.Invoke(router.RunAsynqScheduler))
 
 	return container
 }
@@ -195,6 +218,14 @@ func initDatabase(cfg *config.Config) (*gorm.DB, error) {
 		&types.User{},
 		&types.AuthToken{},
 		&types.KnowledgeBase{},
+		&types.ReindexJob{},
+		&types.EvaluationTask{},
+		&types.EvaluationQuestion{},
+		&types.Dataset{},
+		&types.DatasetQAPair{},
+		&types.GraphEntity{},
+		&types.GraphRelationship{},
+		&types.UsageRecord{},
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to auto-migrate database tables: %v", err)
@@ -256,7 +287,8 @@ func initFileService(cfg *config.Config) (interfaces.FileService, error) {
 	case "local":
 		return file.NewLocalFileService(os.Getenv("LOCAL_STORAGE_BASE_DIR")), nil
 	case "dummy":
-		return file.NewDummyFileService(), nil
+		// The ingestion tasks read the uploaded files back from the storage, which the dummy storage never keeps
+		return nil, fmt.Errorf("storage type dummy does not keep uploaded files, use local, minio or cos")
 	default:
 		return nil, fmt.Errorf("unsupported storage type: %s", os.Getenv("STORAGE_TYPE"))
 	}
@@ -397,8 +429,25 @@ func initOllamaService() (*ollama.OllamaService, error) {
 	return ollama.GetOllamaService()
 }
 
+// initRetrieveGraphRepository creates the retrieval graph repository selected by the GRAPH_DRIVER environment variable
+// The PostgreSQL repository keeps the graph in the main database, otherwise Neo4j is used,
+// which does nothing when no Neo4j driver is configured
+// Parameters:
+//   - db: Database connection
+//   - driver: Neo4j driver, nil when Neo4j is disabled
+//
+// Returns:
+//   - Configured retrieval graph repository
+//   - Error if initialization fails
+func initRetrieveGraphRepository(db *gorm.DB, driver neo4j.Driver) (interfaces.RetrieveGraphRepository, error) {
+	if config.GetGraphDriver() == types.PostgresGraphDriverType {
+		return postgresRepo.NewPostgresGraphRepository(db)
+	}
+	return neo4jRepo.NewNeo4jRepository(driver), nil
+}
+
 func initNeo4jClient() (neo4j.Driver, error) {
-	if strings.ToLower(os.Getenv("NEO4J_ENABLE")) != "true" {
+	if config.GetGraphDriver() != types.Neo4jGraphDriverType {
 		logger.Debugf(context.Background(), "NOT SUPPORT RETRIEVE GRAPH")
 		return nil, nil
 	}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"mime/multipart"
+	"net/http"
+
+	"github.com/Tencent/WeKnora/internal/application/service"
+	"github.com/Tencent/WeKnora/internal/errors"
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+// DatasetHandler handles evaluation dataset related HTTP requests
+type DatasetHandler struct {
+	datasetService interfaces.DatasetService // Service for dataset operations
+}
+
+// NewDatasetHandler creates a new DatasetHandler instance
+func NewDatasetHandler(datasetService interfaces.DatasetService) *DatasetHandler {
+	return &DatasetHandler{datasetService: datasetService}
+}
+
+// datasetFileFields are the form fields a dataset file can be uploaded in
+var datasetFileFields = []string{
+	service.DatasetFileQueries,
+	service.DatasetFileCorpus,
+	service.DatasetFileQrels,
+	service.DatasetFileAnswers,
+	service.DatasetFileQas,
+	service.DatasetFile,
+}
+
+// CreateDataset handles requests to upload a new evaluation dataset
+func (h *DatasetHandler) CreateDataset(c *gin.Context) {
+	ctx := c.Request.Context()
+	logger.Info(ctx, "Start creating dataset")
+
+	name := c.PostForm("name")
+	if name == "" {
+		logger.Error(ctx, "Dataset name is empty")
+		c.Error(errors.NewBadRequestError("Dataset name is required"))
+		return
+	}
+
+	files := make(map[string]*multipart.FileHeader)
+	for _, field := range datasetFileFields {
+		file, err := c.FormFile(field)
+		if err == nil {
+			files[field] = file
+		}
+	}
+	if len(files) == 0 {
+		logger.Error(ctx, "No dataset file uploaded")
+		c.Error(errors.NewBadRequestError("No dataset file uploaded"))
+		return
+	}
+
+	dataset, err := h.datasetService.CreateDataset(ctx, &types.Dataset{
+		Name:        name,
+		Description: c.PostForm("description"),
+		Format:      types.DatasetFormat(c.PostForm("format")),
+	}, files)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			c.Error(appErr)
+			return
+		}
+		logger.ErrorWithFields(ctx, err, nil)
+		c.Error(errors.NewInternalServerError(err.Error()))
+		return
+	}
+
+	logger.Infof(ctx, "Dataset created successfully, ID: %s", dataset.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    dataset,
+	})
+}
+
+// ListDatasets handles requests to list the evaluation datasets of the tenant
+func (h *DatasetHandler) ListDatasets(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	datasets, err := h.datasetService.ListDatasets(ctx)
+	if err != nil {
+		logger.ErrorWithFields(ctx, err, nil)
+		c.Error(errors.NewInternalServerError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    datasets,
+	})
+}
+
+// DeleteDataset handles requests to delete an evaluation dataset
+func (h *DatasetHandler) DeleteDataset(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	logger.Infof(ctx, "Start deleting dataset, ID: %s", id)
+
+	if err := h.datasetService.DeleteDataset(ctx, id); err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			c.Error(appErr)
+			return
+		}
+		logger.ErrorWithFields(ctx, err, nil)
+		c.Error(errors.NewInternalServerError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Dataset deleted successfully",
+	})
+}
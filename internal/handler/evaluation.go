@@ -58,6 +58,10 @@ func (e *EvaluationHandler) Evaluation(c *gin.Context) {
 		request.RerankModelID,
 	)
 	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			c.Error(appErr)
+			return
+		}
 		logger.ErrorWithFields(ctx, err, nil)
 		c.Error(errors.NewInternalServerError(err.Error()))
 		return
@@ -92,6 +96,10 @@ func (e *EvaluationHandler) GetEvaluationResult(c *gin.Context) {
 
 	result, err := e.evaluationService.EvaluationResult(ctx, request.TaskID)
 	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			c.Error(appErr)
+			return
+		}
 		logger.ErrorWithFields(ctx, err, nil)
 		c.Error(errors.NewInternalServerError(err.Error()))
 		return
@@ -103,3 +111,71 @@ func (e *EvaluationHandler) GetEvaluationResult(c *gin.Context) {
 		"data":    result,
 	})
 }
+
+// ListEvaluations lists the past evaluation tasks of the tenant with pagination
+func (e *EvaluationHandler) ListEvaluations(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	logger.Info(ctx, "Start listing evaluation tasks")
+
+	var pagination types.Pagination
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		logger.Error(ctx, "Failed to parse pagination parameters", err)
+		c.Error(errors.NewBadRequestError(err.Error()))
+		return
+	}
+
+	result, err := e.evaluationService.ListEvaluations(ctx, &pagination)
+	if err != nil {
+		logger.ErrorWithFields(ctx, err, nil)
+		c.Error(errors.NewInternalServerError(err.Error()))
+		return
+	}
+
+	logger.Infof(ctx, "Listed evaluation tasks successfully, total: %d", result.Total)
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      result.Data,
+		"total":     result.Total,
+		"page":      result.Page,
+		"page_size": result.PageSize,
+	})
+}
+
+// CompareEvaluationRequest contains the two evaluation tasks to compare
+type CompareEvaluationRequest struct {
+	BaseTaskID   string `form:"base_task_id" binding:"required"`   // ID of the base evaluation task
+	TargetTaskID string `form:"target_task_id" binding:"required"` // ID of the evaluation task compared to the base
+}
+
+// CompareEvaluations compares two evaluation tasks metric by metric
+func (e *EvaluationHandler) CompareEvaluations(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	logger.Info(ctx, "Start comparing evaluation tasks")
+
+	var request CompareEvaluationRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		logger.Error(ctx, "Failed to parse request parameters", err)
+		c.Error(errors.NewBadRequestError("Invalid request parameters").WithDetails(err.Error()))
+		return
+	}
+
+	comparison, err := e.evaluationService.CompareEvaluations(ctx, request.BaseTaskID, request.TargetTaskID)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			c.Error(appErr)
+			return
+		}
+		logger.ErrorWithFields(ctx, err, nil)
+		c.Error(errors.NewInternalServerError(err.Error()))
+		return
+	}
+
+	logger.Infof(ctx, "Compared evaluation tasks successfully, base: %s, target: %s",
+		request.BaseTaskID, request.TargetTaskID)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    comparison,
+	})
+}
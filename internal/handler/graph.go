@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/Tencent/WeKnora/internal/errors"
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+// GraphHandler handles requests on the GraphRAG knowledge graph of knowledge bases
+type GraphHandler struct {
+	graphService interfaces.GraphService // Service for knowledge graph queries
+}
+
+// NewGraphHandler creates a new GraphHandler instance
+func NewGraphHandler(graphService interfaces.GraphService) *GraphHandler {
+	return &GraphHandler{graphService: graphService}
+}
+
+// ListGraphEntitiesRequest contains the filter and pagination of an entity listing
+type ListGraphEntitiesRequest struct {
+	types.Pagination
+	Keyword string `form:"keyword"` // Only entities whose title contains the keyword
+}
+
+// GraphNeighborsRequest contains the depth of a neighbour query
+type GraphNeighborsRequest struct {
+	Depth int `form:"depth" binding:"omitempty,min=1"` // Number of relationships walked from the entity
+}
+
+// GraphPathRequest contains the ends of a path query
+type GraphPathRequest struct {
+	Source   string `form:"source" binding:"required"`           // ID of the entity the path starts at
+	Target   string `form:"target" binding:"required"`           // ID of the entity the path ends at
+	MaxDepth int    `form:"max_depth" binding:"omitempty,min=1"` // Maximum number of relationships of the path
+}
+
+// ListEntities lists the entities of the knowledge graph of a knowledge base
+func (h *GraphHandler) ListEntities(c *gin.Context) {
+	ctx := c.Request.Context()
+	kbID := c.Param("id")
+
+	logger.Infof(ctx, "Start listing graph entities, knowledge base ID: %s", kbID)
+
+	var request ListGraphEntitiesRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		logger.Error(ctx, "Failed to parse query parameters", err)
+		c.Error(errors.NewBadRequestError(err.Error()))
+		return
+	}
+
+	result, err := h.graphService.ListEntities(ctx, kbID, request.Keyword, &request.Pagination)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      result.Data,
+		"total":     result.Total,
+		"page":      result.Page,
+		"page_size": result.PageSize,
+	})
+}
+
+// GetNeighbors returns the subgraph around an entity
+func (h *GraphHandler) GetNeighbors(c *gin.Context) {
+	ctx := c.Request.Context()
+	kbID := c.Param("id")
+	entityID := c.Param("entity_id")
+
+	logger.Infof(ctx, "Start getting graph neighbors, knowledge base ID: %s, entity ID: %s", kbID, entityID)
+
+	var request GraphNeighborsRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		logger.Error(ctx, "Failed to parse query parameters", err)
+		c.Error(errors.NewBadRequestError(err.Error()))
+		return
+	}
+
+	graph, err := h.graphService.GetNeighbors(ctx, kbID, entityID, request.Depth)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    graph,
+	})
+}
+
+// FindPath returns a shortest path between two entities
+func (h *GraphHandler) FindPath(c *gin.Context) {
+	ctx := c.Request.Context()
+	kbID := c.Param("id")
+
+	var request GraphPathRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		logger.Error(ctx, "Failed to parse query parameters", err)
+		c.Error(errors.NewBadRequestError(err.Error()))
+		return
+	}
+
+	logger.Infof(ctx, "Start finding graph path, knowledge base ID: %s, source: %s, target: %s",
+		kbID, request.Source, request.Target)
+
+	graph, err := h.graphService.FindPath(ctx, kbID, request.Source, request.Target, request.MaxDepth)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    graph,
+	})
+}
+
+// ExportGraph exports the knowledge graph of a knowledge base as a JSON or GraphML file
+func (h *GraphHandler) ExportGraph(c *gin.Context) {
+	ctx := c.Request.Context()
+	kbID := c.Param("id")
+	format := types.GraphExportFormat(c.DefaultQuery("format", string(types.GraphExportFormatJSON)))
+
+	logger.Infof(ctx, "Start exporting knowledge graph, knowledge base ID: %s, format: %s", kbID, format)
+
+	var buf bytes.Buffer
+	if err := h.graphService.ExportGraph(ctx, kbID, format, &buf); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	contentType := "application/json"
+	if format == types.GraphExportFormatGraphML {
+		contentType = "application/graphml+xml"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", kbID, format))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// handleError reports a graph service error
+func (h *GraphHandler) handleError(c *gin.Context, err error) {
+	if appErr, ok := errors.IsAppError(err); ok {
+		c.Error(appErr)
+		return
+	}
+	logger.ErrorWithFields(c.Request.Context(), err, nil)
+	c.Error(errors.NewInternalServerError(err.Error()))
+}
@@ -224,9 +224,9 @@ func (h *InitializationHandler) InitializeByKB(c *gin.Context) {
 	}
 
 	// 验证Node Extractor配置（如果启用）
-	if strings.ToLower(os.Getenv("NEO4J_ENABLE")) != "true" && req.NodeExtract.Enabled {
+	if config.GetGraphDriver() == "" && req.NodeExtract.Enabled {
 		logger.Error(ctx, "Node Extractor configuration incomplete")
-		c.Error(errors.NewBadRequestError("请正确配置环境变量NEO4J_ENABLE"))
+		c.Error(errors.NewBadRequestError("请正确配置环境变量GRAPH_DRIVER"))
 		return
 	}
 	if req.NodeExtract.Enabled {
@@ -1047,8 +1047,12 @@ func buildConfigResponse(models []*types.Model,
 // RemoteModelCheckRequest 远程模型检查请求结构
 type RemoteModelCheckRequest struct {
 	ModelName string `json:"modelName" binding:"required"`
-	BaseURL   string `json:"baseUrl" binding:"required"`
+	BaseURL   string `json:"baseUrl"`
 	APIKey    string `json:"apiKey"`
+	// Source 模型来源：remote（OpenAI 兼容，默认）、anthropic、gemini、azure_openai
+	Source string `json:"source"`
+	// APIVersion Azure OpenAI 的 API 版本
+	APIVersion string `json:"apiVersion"`
 }
 
 // CheckRemoteModel 检查远程API模型连接
@@ -1064,8 +1068,23 @@ func (h *InitializationHandler) CheckRemoteModel(c *gin.Context) {
 		return
 	}
 
-	// 验证请求参数
-	if req.ModelName == "" || req.BaseURL == "" {
+	// 验证请求参数，Anthropic 与 Gemini 未指定 Base URL 时使用官方地址
+	source := types.ModelSource(strings.ToLower(req.Source))
+	switch source {
+	case "":
+		source = types.ModelSourceRemote
+	case types.ModelSourceRemote, types.ModelSourceAzureOpenAI, types.ModelSourceAnthropic, types.ModelSourceGemini:
+	default:
+		logger.Errorf(ctx, "Unsupported remote model source: %s", req.Source)
+		c.Error(errors.NewBadRequestError(fmt.Sprintf("不支持的模型来源: %s", req.Source)))
+		return
+	}
+	if req.ModelName == "" {
+		logger.Error(ctx, "Model name is required")
+		c.Error(errors.NewBadRequestError("模型名称不能为空"))
+		return
+	}
+	if req.BaseURL == "" && (source == types.ModelSourceRemote || source == types.ModelSourceAzureOpenAI) {
 		logger.Error(ctx, "Model name and base URL are required")
 		c.Error(errors.NewBadRequestError("模型名称和Base URL不能为空"))
 		return
@@ -1074,10 +1093,11 @@ func (h *InitializationHandler) CheckRemoteModel(c *gin.Context) {
 	// 创建模型配置进行测试
 	modelConfig := &types.Model{
 		Name:   req.ModelName,
-		Source: "remote",
+		Source: source,
 		Parameters: types.ModelParameters{
-			BaseURL: req.BaseURL,
-			APIKey:  req.APIKey,
+			BaseURL:    req.BaseURL,
+			APIKey:     req.APIKey,
+			APIVersion: req.APIVersion,
 		},
 		Type: "llm", // 默认类型，实际检查时不区分具体类型
 	}
@@ -1087,8 +1107,8 @@ func (h *InitializationHandler) CheckRemoteModel(c *gin.Context) {
 
 	logger.Info(ctx,
 		fmt.Sprintf(
-			"Remote model check completed: modelName=%s, baseUrl=%s, available=%v, message=%s",
-			req.ModelName, req.BaseURL, available, message,
+			"Remote model check completed: source=%s, modelName=%s, baseUrl=%s, available=%v, message=%s",
+			source, req.ModelName, req.BaseURL, available, message,
 		),
 	)
 
@@ -1168,11 +1188,12 @@ func (h *InitializationHandler) checkRemoteModelConnection(ctx context.Context,
 	// 使用 models/chat 进行连接检查
 	// 创建聊天配置
 	chatConfig := &chat.ChatConfig{
-		Source:    types.ModelSourceRemote,
-		BaseURL:   model.Parameters.BaseURL,
-		ModelName: model.Name,
-		APIKey:    model.Parameters.APIKey,
-		ModelID:   model.Name,
+		Source:     model.Source,
+		BaseURL:    model.Parameters.BaseURL,
+		ModelName:  model.Name,
+		APIKey:     model.Parameters.APIKey,
+		ModelID:    model.Name,
+		APIVersion: model.Parameters.APIVersion,
 	}
 
 	// 创建聊天实例
@@ -151,6 +151,59 @@ func (h *KnowledgeHandler) CreateKnowledgeFromFile(c *gin.Context) {
 	})
 }
 
+// ReplaceKnowledgeFile handles requests to replace the file of a knowledge,
+// only the chunks whose content changed are embedded again
+func (h *KnowledgeHandler) ReplaceKnowledgeFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	logger.Info(ctx, "Start replacing knowledge file")
+
+	// Get knowledge ID from URL path parameter
+	id := c.Param("id")
+	if id == "" {
+		logger.Error(ctx, "Knowledge ID is empty")
+		c.Error(errors.NewBadRequestError("Knowledge ID cannot be empty"))
+		return
+	}
+
+	// Get the uploaded file
+	file, err := c.FormFile("file")
+	if err != nil {
+		logger.Error(ctx, "File upload failed", err)
+		c.Error(errors.NewBadRequestError("File upload failed").WithDetails(err.Error()))
+		return
+	}
+	logger.Infof(ctx, "File upload successful, filename: %s, size: %.2f KB", file.Filename, float64(file.Size)/1024)
+
+	enableMultimodelForm := c.PostForm("enable_multimodel")
+	var enableMultimodel *bool
+	if enableMultimodelForm != "" {
+		parseBool, err := strconv.ParseBool(enableMultimodelForm)
+		if err != nil {
+			logger.Error(ctx, "Failed to parse enable_multimodel", err)
+			c.Error(errors.NewBadRequestError("Invalid enable_multimodel format").WithDetails(err.Error()))
+			return
+		}
+		enableMultimodel = &parseBool
+	}
+
+	knowledge, err := h.kgService.ReplaceKnowledgeFile(ctx, id, file, enableMultimodel)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			c.Error(appErr)
+			return
+		}
+		logger.ErrorWithFields(ctx, err, nil)
+		c.Error(errors.NewInternalServerError(err.Error()))
+		return
+	}
+
+	logger.Infof(ctx, "Knowledge file replaced successfully, ID: %s, title: %s", knowledge.ID, knowledge.Title)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    knowledge,
+	})
+}
+
 // CreateKnowledgeFromURL handles requests to create knowledge from a URL
 func (h *KnowledgeHandler) CreateKnowledgeFromURL(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -430,6 +483,45 @@ func (h *KnowledgeHandler) UpdateKnowledge(c *gin.Context) {
 	})
 }
 
+// SetKnowledgeRefreshInterval handles requests to set the refresh schedule of a URL knowledge
+func (h *KnowledgeHandler) SetKnowledgeRefreshInterval(c *gin.Context) {
+	ctx := c.Request.Context()
+	logger.Info(ctx, "Start setting knowledge refresh interval")
+
+	// Get knowledge ID from URL path parameter
+	id := c.Param("id")
+	if id == "" {
+		logger.Error(ctx, "Knowledge ID is empty")
+		c.Error(errors.NewBadRequestError("Knowledge ID cannot be empty"))
+		return
+	}
+
+	var req struct {
+		RefreshInterval *int `json:"refresh_interval" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Failed to parse request parameters", err)
+		c.Error(errors.NewBadRequestError(err.Error()))
+		return
+	}
+
+	knowledge, err := h.kgService.SetKnowledgeRefreshInterval(ctx, id, *req.RefreshInterval)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			c.Error(appErr)
+			return
+		}
+		logger.ErrorWithFields(ctx, err, nil)
+		c.Error(errors.NewInternalServerError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    knowledge,
+	})
+}
+
 // UpdateImageInfo updates a chunk's properties
 func (h *KnowledgeHandler) UpdateImageInfo(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -15,14 +15,16 @@ import (
 type KnowledgeBaseHandler struct {
 	service          interfaces.KnowledgeBaseService
 	knowledgeService interfaces.KnowledgeService
+	reindexService   interfaces.ReindexService
 }
 
 // NewKnowledgeBaseHandler creates a new knowledge base handler instance
 func NewKnowledgeBaseHandler(
 	service interfaces.KnowledgeBaseService,
 	knowledgeService interfaces.KnowledgeService,
+	reindexService interfaces.ReindexService,
 ) *KnowledgeBaseHandler {
-	return &KnowledgeBaseHandler{service: service, knowledgeService: knowledgeService}
+	return &KnowledgeBaseHandler{service: service, knowledgeService: knowledgeService, reindexService: reindexService}
 }
 
 // HybridSearch handles requests to perform hybrid vector and keyword search on a knowledge base
@@ -53,6 +55,10 @@ func (h *KnowledgeBaseHandler) HybridSearch(c *gin.Context) {
 	results, err := h.service.HybridSearch(ctx, id, req)
 	if err != nil {
 		logger.ErrorWithFields(ctx, err, nil)
+		if appErr, ok := tokenQuotaError(c, err); ok {
+			c.Error(appErr)
+			return
+		}
 		c.Error(errors.NewInternalServerError(err.Error()))
 		return
 	}
@@ -77,6 +83,11 @@ func (h *KnowledgeBaseHandler) CreateKnowledgeBase(c *gin.Context) {
 		c.Error(errors.NewBadRequestError("Invalid request parameters").WithDetails(err.Error()))
 		return
 	}
+	if err := req.ChunkingConfig.Validate(); err != nil {
+		logger.Error(ctx, "Invalid chunking config", err)
+		c.Error(errors.NewBadRequestError("Invalid chunking config").WithDetails(err.Error()))
+		return
+	}
 
 	logger.Infof(ctx, "Creating knowledge base, name: %s", req.Name)
 	// Create knowledge base using the service
@@ -216,6 +227,11 @@ func (h *KnowledgeBaseHandler) UpdateKnowledgeBase(c *gin.Context) {
 		c.Error(errors.NewBadRequestError("Invalid request parameters").WithDetails(err.Error()))
 		return
 	}
+	if err := req.Config.ChunkingConfig.Validate(); err != nil {
+		logger.Error(ctx, "Invalid chunking config", err)
+		c.Error(errors.NewBadRequestError("Invalid chunking config").WithDetails(err.Error()))
+		return
+	}
 
 	logger.Infof(ctx, "Updating knowledge base, ID: %s, name: %s", id, req.Name)
 
@@ -262,6 +278,116 @@ func (h *KnowledgeBaseHandler) DeleteKnowledgeBase(c *gin.Context) {
 	})
 }
 
+// SetEmbeddingModelRequest defines the request body structure for switching the embedding model
+type SetEmbeddingModelRequest struct {
+	ModelID string `json:"model_id" binding:"required"`
+}
+
+// SetEmbeddingModel handles requests to switch the embedding model of a knowledge base
+// Existing chunks are re-embedded in the background, searches keep using the old vectors until the job completes
+func (h *KnowledgeBaseHandler) SetEmbeddingModel(c *gin.Context) {
+	ctx := c.Request.Context()
+	logger.Info(ctx, "Start setting embedding model")
+
+	// Validate and get the knowledge base
+	_, id, err := h.validateAndGetKnowledgeBase(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req SetEmbeddingModelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Failed to parse request parameters", err)
+		c.Error(errors.NewBadRequestError("Invalid request parameters").WithDetails(err.Error()))
+		return
+	}
+
+	job, err := h.service.SetEmbeddingModel(ctx, id, req.ModelID)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			c.Error(appErr)
+			return
+		}
+		logger.ErrorWithFields(ctx, err, nil)
+		c.Error(errors.NewInternalServerError(err.Error()))
+		return
+	}
+
+	if job == nil {
+		logger.Infof(ctx, "Embedding model set directly, knowledge base ID: %s", id)
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Embedding model set successfully",
+		})
+		return
+	}
+
+	logger.Infof(ctx, "Reindex job started, knowledge base ID: %s, job ID: %s", id, job.ID)
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"data":    job,
+	})
+}
+
+// GetReindexJob handles requests to get the progress of a re-embedding job
+func (h *KnowledgeBaseHandler) GetReindexJob(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// Validate and get the knowledge base
+	_, id, err := h.validateAndGetKnowledgeBase(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	job, err := h.reindexService.GetReindexJob(ctx, id, c.Param("job_id"))
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			c.Error(appErr)
+			return
+		}
+		logger.ErrorWithFields(ctx, err, nil)
+		c.Error(errors.NewInternalServerError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    job,
+	})
+}
+
+// CancelReindexJob handles requests to cancel a re-embedding job
+func (h *KnowledgeBaseHandler) CancelReindexJob(c *gin.Context) {
+	ctx := c.Request.Context()
+	logger.Info(ctx, "Start cancelling reindex job")
+
+	// Validate and get the knowledge base
+	_, id, err := h.validateAndGetKnowledgeBase(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	job, err := h.reindexService.CancelReindexJob(ctx, id, c.Param("job_id"))
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			c.Error(appErr)
+			return
+		}
+		logger.ErrorWithFields(ctx, err, nil)
+		c.Error(errors.NewInternalServerError(err.Error()))
+		return
+	}
+
+	logger.Infof(ctx, "Reindex job cancelled, knowledge base ID: %s, job ID: %s", id, job.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    job,
+	})
+}
+
 type CopyKnowledgeBaseRequest struct {
 	SourceID string `json:"source_id" binding:"required"`
 	TargetID string `json:"target_id"`
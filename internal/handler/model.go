@@ -1,6 +1,7 @@
 package handler
 
 import (
+	stderrors "errors"
 	"net/http"
 
 	"github.com/Tencent/WeKnora/internal/application/service"
@@ -76,6 +77,11 @@ func (h *ModelHandler) CreateModel(c *gin.Context) {
 	}
 
 	if err := h.service.CreateModel(ctx, model); err != nil {
+		if stderrors.Is(err, service.ErrInvalidModelRoute) {
+			logger.Warnf(ctx, "Invalid model route: %v", err)
+			c.Error(errors.NewBadRequestError(err.Error()))
+			return
+		}
 		logger.ErrorWithFields(ctx, err, nil)
 		c.Error(errors.NewInternalServerError(err.Error()))
 		return
@@ -216,6 +222,11 @@ func (h *ModelHandler) UpdateModel(c *gin.Context) {
 
 	logger.Infof(ctx, "Updating model, ID: %s, Name: %s", id, model.Name)
 	if err := h.service.UpdateModel(ctx, model); err != nil {
+		if stderrors.Is(err, service.ErrInvalidModelRoute) {
+			logger.Warnf(ctx, "Invalid model route: %v", err)
+			c.Error(errors.NewBadRequestError(err.Error()))
+			return
+		}
 		logger.ErrorWithFields(ctx, err, nil)
 		c.Error(errors.NewInternalServerError(err.Error()))
 		return
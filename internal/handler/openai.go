@@ -0,0 +1,442 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/config"
+	"github.com/Tencent/WeKnora/internal/errors"
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// chatCompletionObject is the object type of a non-streaming chat completion response
+	chatCompletionObject = "chat.completion"
+	// chatCompletionChunkObject is the object type of a streaming chat completion chunk
+	chatCompletionChunkObject = "chat.completion.chunk"
+	// finishReasonStop is the finish reason reported when the answer is complete
+	finishReasonStop = "stop"
+	// chatCompletionPipeline is the pipeline run for every chat completion, it always answers with a stream
+	chatCompletionPipeline = "rag_stream"
+)
+
+// OpenAIHandler exposes the RAG pipeline through an OpenAI compatible chat completions API
+type OpenAIHandler struct {
+	sessionService       interfaces.SessionService       // Service for running the knowledge QA pipeline
+	knowledgebaseService interfaces.KnowledgeBaseService // Service for resolving knowledge bases
+	config               *config.Config                  // Application configuration
+}
+
+// NewOpenAIHandler creates a new instance of OpenAIHandler
+func NewOpenAIHandler(
+	sessionService interfaces.SessionService,
+	knowledgebaseService interfaces.KnowledgeBaseService,
+	config *config.Config,
+) *OpenAIHandler {
+	return &OpenAIHandler{
+		sessionService:       sessionService,
+		knowledgebaseService: knowledgebaseService,
+		config:               config,
+	}
+}
+
+// ChatCompletionMessage is a single message of an OpenAI chat completions request or response
+type ChatCompletionMessage struct {
+	Role    string                `json:"role"`
+	Content ChatCompletionContent `json:"content"`
+}
+
+// ChatCompletionContent is the content of a message, a string or an array of content parts in requests.
+// Only text parts are supported, they are joined by new lines. Responses always use a string
+type ChatCompletionContent string
+
+// UnmarshalJSON accepts both a string and an array of text content parts
+func (c *ChatCompletionContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = ChatCompletionContent(text)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or an array of content parts")
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type != "text" {
+			return fmt.Errorf("unsupported content part type: %s", part.Type)
+		}
+		texts = append(texts, part.Text)
+	}
+	*c = ChatCompletionContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+// ChatCompletionStreamOptions are the options of a streaming chat completion
+type ChatCompletionStreamOptions struct {
+	// IncludeUsage sends the token usage in a last chunk without choices
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatCompletionRequest is the OpenAI chat completions request body.
+// Model is either a session ID, whose retrieval and summary settings are used,
+// or a knowledge base ID, which is searched with the default conversation settings.
+type ChatCompletionRequest struct {
+	Model         string                       `json:"model"    binding:"required"`
+	Messages      []ChatCompletionMessage      `json:"messages" binding:"required"`
+	Stream        bool                         `json:"stream"`
+	StreamOptions *ChatCompletionStreamOptions `json:"stream_options,omitempty"`
+	Temperature   *float64                     `json:"temperature,omitempty"`
+	TopP          *float64                     `json:"top_p,omitempty"`
+	MaxTokens     *int                         `json:"max_tokens,omitempty"`
+	Seed          *int                         `json:"seed,omitempty"`
+}
+
+// ChatCompletionChoice is a choice of a non-streaming chat completion response
+type ChatCompletionChoice struct {
+	Index        int                   `json:"index"`
+	Message      ChatCompletionMessage `json:"message"`
+	FinishReason string                `json:"finish_reason"`
+}
+
+// ChatCompletionResponse is the OpenAI chat completion response,
+// References is an extension field carrying the retrieved knowledge
+type ChatCompletionResponse struct {
+	ID         string                 `json:"id"`
+	Object     string                 `json:"object"`
+	Created    int64                  `json:"created"`
+	Model      string                 `json:"model"`
+	Choices    []ChatCompletionChoice `json:"choices"`
+	Usage      types.TokenUsage       `json:"usage"`
+	References types.References       `json:"references,omitempty"`
+}
+
+// ChatCompletionChunkDelta is the incremental content of a streaming chunk
+type ChatCompletionChunkDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// ChatCompletionChunkChoice is a choice of a streaming chat completion chunk
+type ChatCompletionChunkChoice struct {
+	Index        int                      `json:"index"`
+	Delta        ChatCompletionChunkDelta `json:"delta"`
+	FinishReason *string                  `json:"finish_reason"`
+}
+
+// ChatCompletionChunk is an OpenAI chat completion chunk sent as an SSE frame,
+// References is an extension field sent with the first chunk
+type ChatCompletionChunk struct {
+	ID         string                      `json:"id"`
+	Object     string                      `json:"object"`
+	Created    int64                       `json:"created"`
+	Model      string                      `json:"model"`
+	Choices    []ChatCompletionChunkChoice `json:"choices"`
+	Usage      *types.TokenUsage           `json:"usage,omitempty"`
+	References types.References            `json:"references,omitempty"`
+}
+
+// ChatCompletions handles OpenAI compatible chat completion requests, both streaming and non-streaming
+func (h *OpenAIHandler) ChatCompletions(c *gin.Context) {
+	ctx := logger.CloneContext(c.Request.Context())
+
+	logger.Info(ctx, "Start processing chat completions request")
+
+	// Parse request body
+	var request ChatCompletionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.Error(ctx, "Failed to parse request data", err)
+		c.Error(errors.NewBadRequestError(err.Error()))
+		return
+	}
+
+	query, history, err := splitChatCompletionMessages(request.Messages)
+	if err != nil {
+		logger.Error(ctx, "Invalid chat completion messages", err)
+		c.Error(errors.NewBadRequestError(err.Error()))
+		return
+	}
+
+	// Resolve the model to the session whose settings drive the pipeline
+	session, appErr := h.resolveModel(c, request.Model)
+	if appErr != nil {
+		c.Error(appErr)
+		return
+	}
+
+	chatManage := newChatManageFromSession(session, query, history)
+	applyChatCompletionOptions(&chatManage.SummaryConfig, &request)
+
+	logger.Infof(ctx, "Chat completions request, model: %s, knowledge base IDs: %v, query: %s, stream: %v",
+		request.Model, chatManage.KnowledgeBaseIDs, query, request.Stream)
+
+	// The configured pipelines may not stream, the streaming RAG pipeline is always used
+	if err := h.sessionService.KnowledgeQAByEvent(ctx, chatManage, types.Pipline[chatCompletionPipeline]); err != nil {
+		logger.ErrorWithFields(ctx, err, map[string]interface{}{
+			"model": request.Model,
+		})
+		if appErr, ok := tokenQuotaError(c, err); ok {
+			c.Error(appErr)
+			return
+		}
+		c.Error(errors.NewInternalServerError(err.Error()))
+		return
+	}
+	if chatManage.ResponseChan == nil {
+		logger.Errorf(ctx, "Pipeline produced no stream response, model: %s", request.Model)
+		c.Error(errors.NewInternalServerError("pipeline produced no stream response"))
+		return
+	}
+
+	completionID := "chatcmpl-" + c.GetString(types.RequestIDContextKey.String())
+	created := time.Now().Unix()
+
+	if !request.Stream {
+		// Collect the whole answer before responding
+		var content, streamErr string
+		var usage types.TokenUsage
+		for response := range chatManage.ResponseChan {
+			switch response.ResponseType {
+			case types.ResponseTypeAnswer:
+				content += response.Content
+			case types.ResponseTypeError:
+				streamErr = response.Content
+			}
+			if response.Usage != nil {
+				usage = *response.Usage
+			}
+		}
+		if streamErr != "" {
+			logger.Errorf(ctx, "Chat completion failed, model: %s, error: %s", request.Model, streamErr)
+			c.Error(errors.NewInternalServerError(streamErr))
+			return
+		}
+		c.JSON(http.StatusOK, &ChatCompletionResponse{
+			ID:      completionID,
+			Object:  chatCompletionObject,
+			Created: created,
+			Model:   request.Model,
+			Choices: []ChatCompletionChoice{{
+				Message:      ChatCompletionMessage{Role: "assistant", Content: ChatCompletionContent(content)},
+				FinishReason: finishReasonStop,
+			}},
+			Usage:      usage,
+			References: chatManage.MergeResult,
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	newChunk := func(delta ChatCompletionChunkDelta, finishReason *string) *ChatCompletionChunk {
+		return &ChatCompletionChunk{
+			ID:      completionID,
+			Object:  chatCompletionChunkObject,
+			Created: created,
+			Model:   request.Model,
+			Choices: []ChatCompletionChunkChoice{{Delta: delta, FinishReason: finishReason}},
+		}
+	}
+
+	// The first chunk announces the assistant role and carries the references
+	first := newChunk(ChatCompletionChunkDelta{Role: "assistant"}, nil)
+	first.References = chatManage.MergeResult
+	writeChatCompletionEvent(c, first)
+
+	var usage types.TokenUsage
+	for response := range chatManage.ResponseChan {
+		if response.Usage != nil {
+			usage = *response.Usage
+		}
+		if response.ResponseType == types.ResponseTypeError {
+			// The stream ends with an error event instead of a finish reason, as OpenAI does
+			logger.Errorf(ctx, "Chat completion stream failed, model: %s, error: %s", request.Model, response.Content)
+			writeChatCompletionError(c, response.Content)
+			return
+		}
+		if response.ResponseType != types.ResponseTypeAnswer || response.Content == "" {
+			continue
+		}
+		writeChatCompletionEvent(c, newChunk(ChatCompletionChunkDelta{Content: response.Content}, nil))
+	}
+
+	finishReason := finishReasonStop
+	writeChatCompletionEvent(c, newChunk(ChatCompletionChunkDelta{}, &finishReason))
+	if request.StreamOptions != nil && request.StreamOptions.IncludeUsage {
+		// The usage chunk has no choices, as OpenAI does
+		last := newChunk(ChatCompletionChunkDelta{}, nil)
+		last.Choices = []ChatCompletionChunkChoice{}
+		last.Usage = &usage
+		writeChatCompletionEvent(c, last)
+	}
+	fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+}
+
+// resolveModel maps the requested model to a session.
+// A knowledge base model is turned into a transient session using the default conversation settings.
+func (h *OpenAIHandler) resolveModel(c *gin.Context, model string) (*types.Session, *errors.AppError) {
+	ctx := c.Request.Context()
+
+	if session, err := h.sessionService.GetSession(ctx, model); err == nil {
+		if len(session.GetKnowledgeBaseIDs()) == 0 {
+			logger.Errorf(ctx, "Session has no associated knowledge base, session ID: %s", model)
+			return nil, errors.NewBadRequestError("Session has no knowledge base").WithDetails(model)
+		}
+		return session, nil
+	}
+
+	tenantID := c.GetUint(types.TenantIDContextKey.String())
+	kb, err := h.knowledgebaseService.GetKnowledgeBaseByID(ctx, model)
+	if err != nil || kb.TenantID != tenantID {
+		logger.Errorf(ctx, "Model %s is neither a session nor a knowledge base of tenant %d", model, tenantID)
+		return nil, errors.NewNotFoundError("Model not found").WithDetails(model)
+	}
+
+	return &types.Session{
+		TenantID:         tenantID,
+		KnowledgeBaseID:  kb.ID,
+		KnowledgeBaseIDs: types.StringArray{kb.ID},
+		SummaryModelID:   kb.SummaryModelID,
+		RerankModelID:    kb.RerankModelID,
+		EmbeddingTopK:    h.config.Conversation.EmbeddingTopK,
+		KeywordThreshold: h.config.Conversation.KeywordThreshold,
+		VectorThreshold:  h.config.Conversation.VectorThreshold,
+		FusionStrategy:   types.FusionStrategy(h.config.Conversation.FusionStrategy),
+		VectorWeight:     h.config.Conversation.VectorWeight,
+		KeywordWeight:    h.config.Conversation.KeywordWeight,
+		RerankTopK:       h.config.Conversation.RerankTopK,
+		RerankThreshold:  h.config.Conversation.RerankThreshold,
+		FallbackResponse: h.config.Conversation.FallbackResponse,
+		SummaryParameters: &types.SummaryConfig{
+			MaxTokens:           h.config.Conversation.Summary.MaxTokens,
+			TopP:                h.config.Conversation.Summary.TopP,
+			TopK:                h.config.Conversation.Summary.TopK,
+			FrequencyPenalty:    h.config.Conversation.Summary.FrequencyPenalty,
+			PresencePenalty:     h.config.Conversation.Summary.PresencePenalty,
+			RepeatPenalty:       h.config.Conversation.Summary.RepeatPenalty,
+			Prompt:              h.config.Conversation.Summary.Prompt,
+			ContextTemplate:     h.config.Conversation.Summary.ContextTemplate,
+			NoMatchPrefix:       h.config.Conversation.Summary.NoMatchPrefix,
+			Temperature:         h.config.Conversation.Summary.Temperature,
+			Seed:                h.config.Conversation.Summary.Seed,
+			MaxCompletionTokens: h.config.Conversation.Summary.MaxCompletionTokens,
+		},
+	}, nil
+}
+
+// splitChatCompletionMessages returns the last user message as the query and
+// the preceding user/assistant pairs as the conversation history, system messages are ignored
+func splitChatCompletionMessages(messages []ChatCompletionMessage) (string, []*types.History, error) {
+	last := -1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			last = i
+			break
+		}
+	}
+	if last < 0 || messages[last].Content == "" {
+		return "", nil, fmt.Errorf("messages must end with a non-empty user message")
+	}
+
+	// An empty, non-nil history keeps the pipeline from loading the history of the session
+	history := make([]*types.History, 0)
+	var current *types.History
+	for _, message := range messages[:last] {
+		switch message.Role {
+		case "user":
+			current = &types.History{Query: string(message.Content)}
+		case "assistant":
+			if current != nil && message.Content != "" {
+				current.Answer = string(message.Content)
+				history = append(history, current)
+			}
+			current = nil
+		}
+	}
+	return string(messages[last].Content), history, nil
+}
+
+// newChatManageFromSession creates the chat management object of a request using the session settings
+func newChatManageFromSession(session *types.Session, query string, history []*types.History) *types.ChatManage {
+	knowledgeBaseIDs := session.GetKnowledgeBaseIDs()
+	chatManage := &types.ChatManage{
+		Query:            query,
+		RewriteQuery:     query,
+		History:          history,
+		SessionID:        session.ID,
+		KnowledgeBaseID:  knowledgeBaseIDs[0],
+		KnowledgeBaseIDs: knowledgeBaseIDs,
+		VectorThreshold:  session.VectorThreshold,
+		KeywordThreshold: session.KeywordThreshold,
+		EmbeddingTopK:    session.EmbeddingTopK,
+		FusionStrategy:   session.FusionStrategy,
+		VectorWeight:     session.VectorWeight,
+		KeywordWeight:    session.KeywordWeight,
+		RerankModelID:    session.RerankModelID,
+		RerankTopK:       session.RerankTopK,
+		RerankThreshold:  session.RerankThreshold,
+		ChatModelID:      session.SummaryModelID,
+		FallbackResponse: session.FallbackResponse,
+	}
+	if session.SummaryParameters != nil {
+		chatManage.SummaryConfig = *session.SummaryParameters
+	}
+	if session.QueryExpansion != nil {
+		chatManage.QueryParaphrases = session.QueryExpansion.Paraphrases
+		chatManage.QueryHyDE = session.QueryExpansion.HyDE
+	}
+	return chatManage
+}
+
+// applyChatCompletionOptions overrides the summary settings with the sampling options of the request
+func applyChatCompletionOptions(summaryConfig *types.SummaryConfig, request *ChatCompletionRequest) {
+	if request.Temperature != nil {
+		summaryConfig.Temperature = *request.Temperature
+	}
+	if request.TopP != nil {
+		summaryConfig.TopP = *request.TopP
+	}
+	if request.MaxTokens != nil {
+		summaryConfig.MaxCompletionTokens = *request.MaxTokens
+	}
+	if request.Seed != nil {
+		summaryConfig.Seed = *request.Seed
+	}
+}
+
+// writeChatCompletionEvent writes a chunk as an SSE data frame and flushes it
+func writeChatCompletionEvent(c *gin.Context, chunk *ChatCompletionChunk) {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		logger.Error(c.Request.Context(), "Failed to marshal chat completion chunk", err)
+		return
+	}
+	fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+	c.Writer.Flush()
+}
+
+// writeChatCompletionError writes an OpenAI error object as an SSE data frame and flushes it
+func writeChatCompletionError(c *gin.Context, message string) {
+	data, err := json.Marshal(gin.H{
+		"error": gin.H{"message": message, "type": "server_error"},
+	})
+	if err != nil {
+		logger.Error(c.Request.Context(), "Failed to marshal chat completion error", err)
+		return
+	}
+	fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+	c.Writer.Flush()
+}
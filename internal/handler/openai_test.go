@@ -0,0 +1,325 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tencent/WeKnora/internal/config"
+	"github.com/Tencent/WeKnora/internal/errors"
+	"github.com/Tencent/WeKnora/internal/middleware"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+)
+
+// fakeOpenAISessionService knows a single session and answers with fixed stream responses
+type fakeOpenAISessionService struct {
+	interfaces.SessionService
+	session    *types.Session
+	responses  []types.StreamResponse
+	references types.References
+	chatManage *types.ChatManage
+	events     []types.EventType
+}
+
+func (s *fakeOpenAISessionService) GetSession(ctx context.Context, id string) (*types.Session, error) {
+	if s.session == nil || s.session.ID != id {
+		return nil, errors.ErrSessionNotFound
+	}
+	return s.session, nil
+}
+
+func (s *fakeOpenAISessionService) KnowledgeQAByEvent(ctx context.Context,
+	chatManage *types.ChatManage, eventList []types.EventType,
+) error {
+	s.chatManage = chatManage
+	s.events = eventList
+	responseChan := make(chan types.StreamResponse, len(s.responses))
+	for _, response := range s.responses {
+		responseChan <- response
+	}
+	close(responseChan)
+	chatManage.ResponseChan = responseChan
+	chatManage.MergeResult = s.references
+	return nil
+}
+
+// fakeOpenAIKnowledgeBaseService knows a single knowledge base of tenant 1
+type fakeOpenAIKnowledgeBaseService struct {
+	interfaces.KnowledgeBaseService
+}
+
+func (fakeOpenAIKnowledgeBaseService) GetKnowledgeBaseByID(ctx context.Context,
+	id string,
+) (*types.KnowledgeBase, error) {
+	if id != "kb" {
+		return nil, types.ErrKnowledgeBaseNotFound
+	}
+	return &types.KnowledgeBase{ID: "kb", TenantID: 1, SummaryModelID: "chat"}, nil
+}
+
+// newOpenAIRouter serves the chat completions of tenant 1
+func newOpenAIRouter(sessionService *fakeOpenAISessionService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.ErrorHandler())
+	r.Use(func(c *gin.Context) {
+		c.Set(types.TenantIDContextKey.String(), uint(1))
+		c.Set(types.RequestIDContextKey.String(), "req")
+		c.Next()
+	})
+	h := NewOpenAIHandler(sessionService, fakeOpenAIKnowledgeBaseService{}, &config.Config{
+		Conversation: &config.ConversationConfig{EmbeddingTopK: 10, Summary: &config.SummaryConfig{}},
+	})
+	r.POST("/chat/completions", h.ChatCompletions)
+	return r
+}
+
+func postChatCompletion(r *gin.Engine, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSplitChatCompletionMessages(t *testing.T) {
+	query, history, err := splitChatCompletionMessages([]ChatCompletionMessage{
+		{Role: "system", Content: "You are a helpful assistant"},
+		{Role: "user", Content: "What is a comet?"},
+		{Role: "assistant", Content: "A small icy body."},
+		{Role: "user", Content: "Unanswered question"},
+		{Role: "user", Content: "Why does it have a tail?"},
+		{Role: "assistant", Content: "Trailing assistant message"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if query != "Why does it have a tail?" {
+		t.Errorf("Expected the last user message as the query, got %q", query)
+	}
+	// The system message and the unanswered question are left out of the history
+	expected := []*types.History{{Query: "What is a comet?", Answer: "A small icy body."}}
+	if !reflect.DeepEqual(history, expected) {
+		t.Errorf("Expected the answered rounds as history, got %+v", history)
+	}
+
+	// The history is empty but not nil so that the history of the session is not loaded
+	_, history, err = splitChatCompletionMessages([]ChatCompletionMessage{{Role: "user", Content: "Hi"}})
+	if err != nil || history == nil || len(history) != 0 {
+		t.Errorf("Expected an empty history, got %v, %v", history, err)
+	}
+
+	for _, messages := range [][]ChatCompletionMessage{
+		nil,
+		{{Role: "system", Content: "You are a helpful assistant"}},
+		{{Role: "user", Content: ""}},
+	} {
+		if _, _, err := splitChatCompletionMessages(messages); err == nil {
+			t.Errorf("Expected messages %+v to be rejected", messages)
+		}
+	}
+}
+
+func TestChatCompletionContent(t *testing.T) {
+	var message ChatCompletionMessage
+	body := `{"role":"user","content":[{"type":"text","text":"Hello"},{"type":"text","text":"world"}]}`
+	if err := json.Unmarshal([]byte(body), &message); err != nil {
+		t.Fatalf("Expected content parts to be accepted, got %v", err)
+	}
+	if message.Content != "Hello\nworld" {
+		t.Errorf("Expected the text parts joined, got %q", message.Content)
+	}
+
+	if err := json.Unmarshal([]byte(`{"role":"user","content":"Hello"}`), &message); err != nil ||
+		message.Content != "Hello" {
+		t.Errorf("Expected string content to be accepted, got %q, %v", message.Content, err)
+	}
+
+	body = `{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}`
+	if err := json.Unmarshal([]byte(body), &message); err == nil {
+		t.Error("Expected image parts to be rejected")
+	}
+
+	// Responses always carry a string
+	data, _ := json.Marshal(ChatCompletionMessage{Role: "assistant", Content: "Hi"})
+	if string(data) != `{"role":"assistant","content":"Hi"}` {
+		t.Errorf("Expected string content, got %s", data)
+	}
+}
+
+func TestChatCompletionsResolveModel(t *testing.T) {
+	sessionService := &fakeOpenAISessionService{
+		session: &types.Session{
+			ID: "session", KnowledgeBaseIDs: types.StringArray{"kb1", "kb2"}, EmbeddingTopK: 3,
+		},
+		responses: []types.StreamResponse{{ResponseType: types.ResponseTypeAnswer, Content: "ok"}},
+	}
+	r := newOpenAIRouter(sessionService)
+
+	// A session model uses the settings of the session
+	w := postChatCompletion(r, `{"model":"session","messages":[{"role":"user","content":"Hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	chatManage := sessionService.chatManage
+	if chatManage.SessionID != "session" || chatManage.EmbeddingTopK != 3 ||
+		!reflect.DeepEqual(chatManage.KnowledgeBaseIDs, []string{"kb1", "kb2"}) {
+		t.Errorf("Expected the session settings, got %+v", chatManage)
+	}
+	if !reflect.DeepEqual(sessionService.events, types.Pipline["rag_stream"]) {
+		t.Errorf("Expected the rag_stream pipeline, got %v", sessionService.events)
+	}
+
+	// A knowledge base model uses the default conversation settings
+	w = postChatCompletion(r, `{"model":"kb","messages":[{"role":"user","content":"Hi"}],"temperature":0.2}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	chatManage = sessionService.chatManage
+	if chatManage.SessionID != "" || chatManage.EmbeddingTopK != 10 || chatManage.ChatModelID != "chat" ||
+		!reflect.DeepEqual(chatManage.KnowledgeBaseIDs, []string{"kb"}) {
+		t.Errorf("Expected the knowledge base with the default settings, got %+v", chatManage)
+	}
+	if chatManage.SummaryConfig.Temperature != 0.2 {
+		t.Errorf("Expected the temperature of the request, got %v", chatManage.SummaryConfig.Temperature)
+	}
+
+	w = postChatCompletion(r, `{"model":"unknown","messages":[{"role":"user","content":"Hi"}]}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected an unknown model to be rejected with 404, got %d", w.Code)
+	}
+}
+
+func TestChatCompletionsNonStream(t *testing.T) {
+	usage := &types.TokenUsage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}
+	sessionService := &fakeOpenAISessionService{
+		responses: []types.StreamResponse{
+			{ResponseType: types.ResponseTypeAnswer, Content: "A comet "},
+			{ResponseType: types.ResponseTypeAnswer, Content: "tail.", Done: true, Usage: usage},
+		},
+		references: types.References{{ID: "c1", KnowledgeID: "k1"}},
+	}
+	r := newOpenAIRouter(sessionService)
+
+	body := `{"model":"kb","messages":[{"role":"user","content":[{"type":"text","text":"Why a tail?"}]}]}`
+	w := postChatCompletion(r, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if sessionService.chatManage.Query != "Why a tail?" {
+		t.Errorf("Expected the text of the content parts as the query, got %q", sessionService.chatManage.Query)
+	}
+	var response ChatCompletionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Expected a chat completion, got %s", w.Body.String())
+	}
+	if response.ID != "chatcmpl-req" || response.Object != "chat.completion" || response.Model != "kb" {
+		t.Errorf("Unexpected chat completion header %+v", response)
+	}
+	if len(response.Choices) != 1 || response.Choices[0].Message.Content != "A comet tail." ||
+		response.Choices[0].Message.Role != "assistant" || response.Choices[0].FinishReason != "stop" {
+		t.Errorf("Expected the whole answer in a single choice, got %+v", response.Choices)
+	}
+	if response.Usage != *usage {
+		t.Errorf("Expected the usage of the model, got %+v", response.Usage)
+	}
+	if len(response.References) != 1 || response.References[0].ID != "c1" {
+		t.Errorf("Expected the references, got %+v", response.References)
+	}
+}
+
+// chatCompletionFrames splits an SSE body into its data payloads
+func chatCompletionFrames(t *testing.T, body string) []string {
+	t.Helper()
+	var frames []string
+	for _, event := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		data, ok := strings.CutPrefix(event, "data: ")
+		if !ok {
+			t.Fatalf("Expected a data frame, got %q", event)
+		}
+		frames = append(frames, data)
+	}
+	return frames
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	sessionService := &fakeOpenAISessionService{
+		responses: []types.StreamResponse{
+			{ResponseType: types.ResponseTypeReferences},
+			{ResponseType: types.ResponseTypeAnswer, Content: "A comet "},
+			{ResponseType: types.ResponseTypeAnswer, Content: "tail."},
+			{ResponseType: types.ResponseTypeAnswer, Done: true, Usage: &types.TokenUsage{TotalTokens: 15}},
+		},
+		references: types.References{{ID: "c1", KnowledgeID: "k1"}},
+	}
+	r := newOpenAIRouter(sessionService)
+
+	w := postChatCompletion(r, `{"model":"kb","stream":true,"stream_options":{"include_usage":true},`+
+		`"messages":[{"role":"user","content":"Why a tail?"}]}`)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	frames := chatCompletionFrames(t, w.Body.String())
+	if len(frames) != 6 || frames[len(frames)-1] != "[DONE]" {
+		t.Fatalf("Expected 5 chunks and [DONE], got %v", frames)
+	}
+
+	chunks := make([]ChatCompletionChunk, 0, len(frames)-1)
+	for _, frame := range frames[:len(frames)-1] {
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(frame), &chunk); err != nil {
+			t.Fatalf("Expected a chunk, got %s", frame)
+		}
+		if chunk.ID != "chatcmpl-req" || chunk.Object != "chat.completion.chunk" || chunk.Model != "kb" {
+			t.Errorf("Unexpected chunk header %s", frame)
+		}
+		chunks = append(chunks, chunk)
+	}
+	// The first chunk announces the role and carries the references
+	if chunks[0].Choices[0].Delta.Role != "assistant" || len(chunks[0].References) != 1 {
+		t.Errorf("Expected the role and the references first, got %s", frames[0])
+	}
+	if chunks[1].Choices[0].Delta.Content != "A comet " || chunks[2].Choices[0].Delta.Content != "tail." {
+		t.Errorf("Expected the answer deltas, got %s %s", frames[1], frames[2])
+	}
+	if finish := chunks[3].Choices[0].FinishReason; finish == nil || *finish != "stop" {
+		t.Errorf("Expected the finish reason, got %s", frames[3])
+	}
+	if len(chunks[4].Choices) != 0 || chunks[4].Usage == nil || chunks[4].Usage.TotalTokens != 15 {
+		t.Errorf("Expected the usage chunk without choices, got %s", frames[4])
+	}
+}
+
+func TestChatCompletionsStreamError(t *testing.T) {
+	sessionService := &fakeOpenAISessionService{
+		responses: []types.StreamResponse{
+			{ResponseType: types.ResponseTypeAnswer, Content: "A comet "},
+			{ResponseType: types.ResponseTypeError, Content: "upstream failed"},
+		},
+	}
+	r := newOpenAIRouter(sessionService)
+
+	w := postChatCompletion(r, `{"model":"kb","stream":true,"messages":[{"role":"user","content":"Why a tail?"}]}`)
+	frames := chatCompletionFrames(t, w.Body.String())
+	last := frames[len(frames)-1]
+	if !strings.Contains(last, `"error"`) || !strings.Contains(last, "upstream failed") {
+		t.Errorf("Expected the stream to end with an error frame, got %v", frames)
+	}
+	for _, frame := range frames {
+		if frame == "[DONE]" || strings.Contains(frame, `"finish_reason":"stop"`) {
+			t.Errorf("Expected no completion after the error, got %v", frames)
+		}
+	}
+
+	w = postChatCompletion(r, `{"model":"kb","messages":[{"role":"user","content":"Why a tail?"}]}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected a failed non-stream answer to return 500, got %d", w.Code)
+	}
+}
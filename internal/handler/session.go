@@ -2,11 +2,14 @@ package handler
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/Tencent/WeKnora/internal/application/service"
 	"github.com/Tencent/WeKnora/internal/config"
 	"github.com/Tencent/WeKnora/internal/errors"
 	"github.com/Tencent/WeKnora/internal/logger"
@@ -57,6 +60,12 @@ type SessionStrategy struct {
 	KeywordThreshold float64 `json:"keyword_threshold"`
 	// Threshold for vector-based retrieval
 	VectorThreshold float64 `json:"vector_threshold"`
+	// Strategy for merging vector and keyword results
+	FusionStrategy types.FusionStrategy `json:"fusion_strategy"`
+	// Weight of vector results in fusion
+	VectorWeight float64 `json:"vector_weight"`
+	// Weight of keyword results in fusion
+	KeywordWeight float64 `json:"keyword_weight"`
 	// ID of the model used for reranking results
 	RerankModelID string `json:"rerank_model_id"`
 	// Number of top results after reranking
@@ -69,12 +78,18 @@ type SessionStrategy struct {
 	SummaryParameters *types.SummaryConfig `json:"summary_parameters" gorm:"type:json"`
 	// Prefix for responses when no match is found
 	NoMatchPrefix string `json:"no_match_prefix"`
+	// Chat pipeline, a built-in or configured pipeline name or inline steps
+	Pipeline *types.PipelineConfig `json:"pipeline"`
+	// Query expansion before retrieval, disabled when nil
+	QueryExpansion *types.QueryExpansion `json:"query_expansion"`
 }
 
 // CreateSessionRequest represents a request to create a new session
 type CreateSessionRequest struct {
 	// ID of the associated knowledge base
-	KnowledgeBaseID string `json:"knowledge_base_id" binding:"required"`
+	KnowledgeBaseID string `json:"knowledge_base_id"`
+	// IDs of the associated knowledge bases, used together with KnowledgeBaseID
+	KnowledgeBaseIDs []string `json:"knowledge_base_ids"`
 	// Session strategy configuration
 	SessionStrategy *SessionStrategy `json:"session_strategy"`
 }
@@ -101,24 +116,37 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 		return
 	}
 
+	// Create session object with base properties
+	createdSession := &types.Session{
+		TenantID:         tenantID.(uint),
+		KnowledgeBaseID:  request.KnowledgeBaseID,
+		KnowledgeBaseIDs: request.KnowledgeBaseIDs,
+	}
+
 	// Validate knowledge base ID
-	if request.KnowledgeBaseID == "" {
+	knowledgeBaseIDs := createdSession.GetKnowledgeBaseIDs()
+	if len(knowledgeBaseIDs) == 0 {
 		logger.Error(ctx, "Knowledge base ID is empty")
 		c.Error(errors.NewBadRequestError("Knowledge base cannot be empty"))
 		return
 	}
+	createdSession.KnowledgeBaseID = knowledgeBaseIDs[0]
+	createdSession.KnowledgeBaseIDs = knowledgeBaseIDs
 
 	logger.Infof(
 		ctx,
-		"Processing session creation request, tenant ID: %d, knowledge base ID: %s",
+		"Processing session creation request, tenant ID: %d, knowledge base IDs: %v",
 		tenantID.(uint),
-		request.KnowledgeBaseID,
+		knowledgeBaseIDs,
 	)
 
-	// Create session object with base properties
-	createdSession := &types.Session{
-		TenantID:        tenantID.(uint),
-		KnowledgeBaseID: request.KnowledgeBaseID,
+	if request.SessionStrategy != nil {
+		if err := types.ValidateFusion(request.SessionStrategy.FusionStrategy,
+			request.SessionStrategy.VectorWeight, request.SessionStrategy.KeywordWeight); err != nil {
+			logger.Errorf(ctx, "Invalid fusion strategy: %v", err)
+			c.Error(errors.NewBadRequestError("Invalid fusion strategy").WithDetails(err.Error()))
+			return
+		}
 	}
 
 	// If summary model parameters are empty, set defaults
@@ -132,8 +160,13 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 		createdSession.EmbeddingTopK = request.SessionStrategy.EmbeddingTopK
 		createdSession.KeywordThreshold = request.SessionStrategy.KeywordThreshold
 		createdSession.VectorThreshold = request.SessionStrategy.VectorThreshold
+		createdSession.FusionStrategy = request.SessionStrategy.FusionStrategy
+		createdSession.VectorWeight = request.SessionStrategy.VectorWeight
+		createdSession.KeywordWeight = request.SessionStrategy.KeywordWeight
 		createdSession.RerankTopK = request.SessionStrategy.RerankTopK
 		createdSession.RerankThreshold = request.SessionStrategy.RerankThreshold
+		createdSession.Pipeline = request.SessionStrategy.Pipeline
+		createdSession.QueryExpansion = request.SessionStrategy.QueryExpansion
 		if request.SessionStrategy.SummaryParameters != nil {
 			createdSession.SummaryParameters = request.SessionStrategy.SummaryParameters
 		} else {
@@ -170,6 +203,9 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 		createdSession.EmbeddingTopK = h.config.Conversation.EmbeddingTopK
 		createdSession.KeywordThreshold = h.config.Conversation.KeywordThreshold
 		createdSession.VectorThreshold = h.config.Conversation.VectorThreshold
+		createdSession.FusionStrategy = types.FusionStrategy(h.config.Conversation.FusionStrategy)
+		createdSession.VectorWeight = h.config.Conversation.VectorWeight
+		createdSession.KeywordWeight = h.config.Conversation.KeywordWeight
 		createdSession.RerankThreshold = h.config.Conversation.RerankThreshold
 		createdSession.RerankTopK = h.config.Conversation.RerankTopK
 		createdSession.SummaryParameters = &types.SummaryConfig{
@@ -190,11 +226,23 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 		logger.Debug(ctx, "Using default session strategy")
 	}
 
-	kb, err := h.knowledgebaseService.GetKnowledgeBaseByID(ctx, request.KnowledgeBaseID)
-	if err != nil {
-		logger.Error(ctx, "Failed to get knowledge base", err)
-		c.Error(errors.NewInternalServerError(err.Error()))
-		return
+	// All knowledge bases must exist and belong to the tenant, the first one provides the default models
+	var kb *types.KnowledgeBase
+	for _, kbID := range knowledgeBaseIDs {
+		current, err := h.knowledgebaseService.GetKnowledgeBaseByID(ctx, kbID)
+		if err != nil {
+			logger.Error(ctx, "Failed to get knowledge base", err)
+			c.Error(errors.NewInternalServerError(err.Error()))
+			return
+		}
+		if current.TenantID != tenantID.(uint) {
+			logger.Errorf(ctx, "Knowledge base %s does not belong to tenant %d", kbID, tenantID.(uint))
+			c.Error(errors.NewBadRequestError("Knowledge base not found").WithDetails(kbID))
+			return
+		}
+		if kb == nil {
+			kb = current
+		}
 	}
 
 	// Get model IDs from knowledge base if not provided
@@ -207,8 +255,13 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 
 	// Call service to create session
 	logger.Infof(ctx, "Calling session service to create session")
-	createdSession, err = h.sessionService.CreateSession(ctx, createdSession)
+	createdSession, err := h.sessionService.CreateSession(ctx, createdSession)
 	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			logger.Error(ctx, "Failed to create session: application error", appErr)
+			c.Error(appErr)
+			return
+		}
 		logger.ErrorWithFields(ctx, err, nil)
 		c.Error(errors.NewInternalServerError(err.Error()))
 		return
@@ -335,6 +388,11 @@ func (h *SessionHandler) UpdateSession(c *gin.Context) {
 			c.Error(errors.NewNotFoundError(err.Error()))
 			return
 		}
+		if appErr, ok := errors.IsAppError(err); ok {
+			logger.Error(ctx, "Failed to update session: application error", appErr)
+			c.Error(appErr)
+			return
+		}
 		logger.ErrorWithFields(ctx, err, nil)
 		c.Error(errors.NewInternalServerError(err.Error()))
 		return
@@ -429,13 +487,35 @@ func (h *SessionHandler) GenerateTitle(c *gin.Context) {
 
 // CreateKnowledgeQARequest defines the request structure for knowledge QA
 type CreateKnowledgeQARequest struct {
-	Query string `json:"query" binding:"required"` // Query text for knowledge base search
+	Query  string              `json:"query" binding:"required"` // Query text for knowledge base search
+	Filter *types.SearchFilter `json:"filter"`                   // Optional metadata filter
 }
 
 // SearchKnowledgeRequest defines the request structure for searching knowledge without LLM summarization
 type SearchKnowledgeRequest struct {
-	Query           string `json:"query" binding:"required"`             // Query text to search for
-	KnowledgeBaseID string `json:"knowledge_base_id" binding:"required"` // ID of the knowledge base to search
+	Query           string              `json:"query" binding:"required"`             // Query text to search for
+	KnowledgeBaseID string              `json:"knowledge_base_id" binding:"required"` // ID of the knowledge base to search
+	Filter          *types.SearchFilter `json:"filter"`                               // Optional metadata filter
+}
+
+// validateSearchFilter checks that the search filter is well-formed
+func validateSearchFilter(filter *types.SearchFilter) error {
+	if filter == nil {
+		return nil
+	}
+	if filter.CreatedAfter != nil && filter.CreatedBefore != nil && !filter.CreatedAfter.Before(*filter.CreatedBefore) {
+		return errors.NewBadRequestError("created_after must be earlier than created_before")
+	}
+	for key := range filter.Metadata {
+		if key == "" {
+			return errors.NewBadRequestError("Metadata filter key cannot be empty")
+		}
+	}
+	if len(filter.KnowledgeIDs) > types.MaxSearchFilterKnowledge {
+		return errors.NewBadRequestError(
+			fmt.Sprintf("knowledge_ids cannot contain more than %d IDs", types.MaxSearchFilterKnowledge))
+	}
+	return nil
 }
 
 // SearchKnowledge performs knowledge base search without LLM summarization
@@ -465,6 +545,12 @@ func (h *SessionHandler) SearchKnowledge(c *gin.Context) {
 		return
 	}
 
+	if err := validateSearchFilter(request.Filter); err != nil {
+		logger.Error(ctx, "Invalid search filter", err)
+		c.Error(err)
+		return
+	}
+
 	logger.Infof(
 		ctx,
 		"Knowledge search request, knowledge base ID: %s, query: %s",
@@ -473,9 +559,17 @@ func (h *SessionHandler) SearchKnowledge(c *gin.Context) {
 	)
 
 	// Directly call knowledge retrieval service without LLM summarization
-	searchResults, err := h.sessionService.SearchKnowledge(ctx, request.KnowledgeBaseID, request.Query)
+	searchResults, err := h.sessionService.SearchKnowledge(ctx, request.KnowledgeBaseID, request.Query, request.Filter)
 	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			c.Error(appErr)
+			return
+		}
 		logger.ErrorWithFields(ctx, err, nil)
+		if appErr, ok := tokenQuotaError(c, err); ok {
+			c.Error(appErr)
+			return
+		}
 		c.Error(errors.NewInternalServerError(err.Error()))
 		return
 	}
@@ -543,6 +637,13 @@ func (h *SessionHandler) ContinueStream(c *gin.Context) {
 		return
 	}
 
+	// A failed message is replayed as a failed stream, its stream may already be gone
+	if message.IsFailed {
+		logger.Infof(ctx, "Message failed, replaying the error, session ID: %s, message ID: %s", sessionID, messageID)
+		h.replayFailedStream(c, message.RequestID, message.KnowledgeReferences, message.Content, message.ErrorMessage)
+		return
+	}
+
 	// Get stream information
 	streamInfo, err := h.streamManager.GetStream(ctx, sessionID, messageID)
 	if err != nil {
@@ -560,6 +661,13 @@ func (h *SessionHandler) ContinueStream(c *gin.Context) {
 		return
 	}
 
+	if streamInfo.IsFailed {
+		logger.Infof(ctx, "Stream failed, replaying the error, session ID: %s, message ID: %s", sessionID, messageID)
+		h.replayFailedStream(c, message.RequestID,
+			streamInfo.KnowledgeReferences, streamInfo.Content, streamInfo.ErrorMessage)
+		return
+	}
+
 	// If stream is already completed, return the full message
 	if streamInfo.IsCompleted {
 		logger.Infof(
@@ -604,6 +712,7 @@ func (h *SessionHandler) ContinueStream(c *gin.Context) {
 	// Create channels to monitor content updates
 	contentCh := make(chan string, 10)
 	doneCh := make(chan bool, 1)
+	failedCh := make(chan string, 1)
 
 	logger.Debug(ctx, "Starting content update monitoring")
 
@@ -630,6 +739,12 @@ func (h *SessionHandler) ContinueStream(c *gin.Context) {
 					return
 				}
 
+				if latestStreamInfo.IsFailed {
+					logger.Debug(ctx, "Stream failed")
+					failedCh <- latestStreamInfo.ErrorMessage
+					return
+				}
+
 				if latestStreamInfo.IsCompleted {
 					logger.Debug(ctx, "Stream completed")
 					doneCh <- true
@@ -670,6 +785,16 @@ func (h *SessionHandler) ContinueStream(c *gin.Context) {
 			})
 			return false
 
+		case errorMessage := <-failedCh:
+			logger.Debug(ctx, "Stream failed, sending error notification")
+			c.SSEvent("message", &types.StreamResponse{
+				ID:           message.RequestID,
+				ResponseType: types.ResponseTypeError,
+				Content:      errorMessage,
+				Done:         true,
+			})
+			return false
+
 		case content := <-contentCh:
 			logger.Debugf(ctx, "Sending content fragment: %d bytes", len(content))
 			c.SSEvent("message", &types.StreamResponse{
@@ -683,6 +808,32 @@ func (h *SessionHandler) ContinueStream(c *gin.Context) {
 	})
 }
 
+// replayFailedStream sends the references and partial content of a failed stream followed by its error
+func (h *SessionHandler) replayFailedStream(c *gin.Context,
+	requestID string, references types.References, content, errorMessage string,
+) {
+	if len(references) > 0 {
+		c.SSEvent("message", &types.StreamResponse{
+			ID:                  requestID,
+			ResponseType:        types.ResponseTypeReferences,
+			KnowledgeReferences: references,
+		})
+	}
+	if content != "" {
+		c.SSEvent("message", &types.StreamResponse{
+			ID:           requestID,
+			ResponseType: types.ResponseTypeAnswer,
+			Content:      content,
+		})
+	}
+	c.SSEvent("message", &types.StreamResponse{
+		ID:           requestID,
+		ResponseType: types.ResponseTypeError,
+		Content:      errorMessage,
+		Done:         true,
+	})
+}
+
 // KnowledgeQA handles knowledge base question answering requests with LLM summarization
 func (h *SessionHandler) KnowledgeQA(c *gin.Context) {
 	ctx := logger.CloneContext(c.Request.Context())
@@ -721,6 +872,12 @@ func (h *SessionHandler) KnowledgeQA(c *gin.Context) {
 		return
 	}
 
+	if err := validateSearchFilter(request.Filter); err != nil {
+		logger.Error(ctx, "Invalid search filter", err)
+		c.Error(err)
+		return
+	}
+
 	logger.Infof(ctx, "Knowledge QA request, session ID: %s, query: %s", sessionID, request.Query)
 
 	// Create user message
@@ -745,9 +902,15 @@ func (h *SessionHandler) KnowledgeQA(c *gin.Context) {
 	logger.Infof(ctx, "Calling knowledge QA service, session ID: %s", sessionID)
 
 	// Call service to perform knowledge QA
-	searchResults, respCh, err := h.sessionService.KnowledgeQA(ctx, sessionID, request.Query)
+	searchResults, respCh, err := h.sessionService.KnowledgeQA(ctx, sessionID, request.Query, request.Filter)
 	if err != nil {
 		logger.ErrorWithFields(ctx, err, nil)
+		assistantMessage.IsFailed = true
+		assistantMessage.ErrorMessage = err.Error()
+		if appErr, ok := tokenQuotaError(c, err); ok {
+			c.Error(appErr)
+			return
+		}
 		c.Error(errors.NewInternalServerError(err.Error()))
 		return
 	}
@@ -784,6 +947,16 @@ func (h *SessionHandler) KnowledgeQA(c *gin.Context) {
 			response.ID = requestID
 			c.SSEvent("message", response)
 			c.Writer.Flush()
+			if response.ResponseType == types.ResponseTypeError {
+				logger.Errorf(ctx, "Knowledge QA stream failed, session ID: %s, error: %s", sessionID, response.Content)
+				assistantMessage.IsFailed = true
+				assistantMessage.ErrorMessage = response.Content
+				if err := h.streamManager.FailStream(
+					ctx, sessionID, assistantMessage.ID, response.Content,
+				); err != nil {
+					logger.GetLogger(ctx).Error("Fail stream failed", "error", err)
+				}
+			}
 			if response.ResponseType == types.ResponseTypeAnswer {
 				assistantMessage.Content += response.Content
 				// Update stream manager with new content
@@ -797,9 +970,32 @@ func (h *SessionHandler) KnowledgeQA(c *gin.Context) {
 	}()
 }
 
-// completeAssistantMessage marks an assistant message as complete and updates it
+// tokenQuotaError converts a model call rejected by the daily token quota into a 429
+// and sets Retry-After to the time the quota resets
+func tokenQuotaError(c *gin.Context, err error) (*errors.AppError, bool) {
+	var quotaErr *service.TokenQuotaError
+	if !stderrors.As(err, &quotaErr) {
+		return nil, false
+	}
+	retryAfter := quotaErr.Decision.RetryAfter(time.Now())
+	c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	return errors.NewTooManyRequestsError("Daily token quota exceeded"), true
+}
+
+// completeAssistantMessage marks an assistant message as complete and updates it,
+// then compresses the older rounds of the session into its summary in the background.
+// A failed message is kept with its partial content and left out of the summary
 func (h *SessionHandler) completeAssistantMessage(ctx context.Context, assistantMessage *types.Message) {
 	assistantMessage.UpdatedAt = time.Now()
 	assistantMessage.IsCompleted = true
-	_ = h.messageService.UpdateMessage(ctx, assistantMessage)
+	if err := h.messageService.UpdateMessage(ctx, assistantMessage); err != nil ||
+		assistantMessage.Content == "" || assistantMessage.IsFailed {
+		return
+	}
+	go func() {
+		if err := h.sessionService.SummarizeHistory(ctx, assistantMessage.SessionID); err != nil {
+			logger.Errorf(ctx, "Failed to summarize session history, session ID: %s, error: %v",
+				assistantMessage.SessionID, err)
+		}
+	}()
 }
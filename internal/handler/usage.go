@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/errors"
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// usageDateLayout is the layout of the dates of a usage report request
+	usageDateLayout = "2006-01-02"
+	// defaultUsageReportDays is the number of days reported when no start date is given
+	defaultUsageReportDays = 30
+)
+
+// UsageHandler handles token usage related HTTP requests
+type UsageHandler struct {
+	usageService interfaces.UsageService // Service for usage accounting
+}
+
+// NewUsageHandler creates a new UsageHandler instance
+func NewUsageHandler(usageService interfaces.UsageService) *UsageHandler {
+	return &UsageHandler{usageService: usageService}
+}
+
+// GetUsageReport handles requests to report the token usage and cost of the tenant.
+// The period runs from start_date to end_date inclusive, the last 30 days by default,
+// and is grouped by the comma separated group_by dimensions, day and model by default
+func (h *UsageHandler) GetUsageReport(c *gin.Context) {
+	ctx := c.Request.Context()
+	logger.Info(ctx, "Start getting usage report")
+
+	now := time.Now()
+	endDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if value := c.Query("end_date"); value != "" {
+		date, err := time.ParseInLocation(usageDateLayout, value, time.Local)
+		if err != nil {
+			logger.Errorf(ctx, "Invalid end date: %s", value)
+			c.Error(errors.NewBadRequestError("Invalid end_date, please use YYYY-MM-DD format"))
+			return
+		}
+		endDate = date
+	}
+	startDate := endDate.AddDate(0, 0, 1-defaultUsageReportDays)
+	if value := c.Query("start_date"); value != "" {
+		date, err := time.ParseInLocation(usageDateLayout, value, time.Local)
+		if err != nil {
+			logger.Errorf(ctx, "Invalid start date: %s", value)
+			c.Error(errors.NewBadRequestError("Invalid start_date, please use YYYY-MM-DD format"))
+			return
+		}
+		startDate = date
+	}
+	if startDate.After(endDate) {
+		logger.Errorf(ctx, "Start date %s is after end date %s", startDate, endDate)
+		c.Error(errors.NewBadRequestError("start_date must not be after end_date"))
+		return
+	}
+
+	var groupBy []types.UsageGroupBy
+	for _, value := range strings.Split(c.DefaultQuery("group_by", "day,model"), ",") {
+		dimension := types.UsageGroupBy(strings.TrimSpace(value))
+		switch dimension {
+		case types.UsageGroupByDay, types.UsageGroupByModel, types.UsageGroupByTenant:
+			groupBy = append(groupBy, dimension)
+		case "":
+		default:
+			logger.Errorf(ctx, "Invalid usage group by: %s", value)
+			c.Error(errors.NewBadRequestError("Invalid group_by, supported values are day, model and tenant"))
+			return
+		}
+	}
+
+	report, err := h.usageService.GetUsageReport(ctx, &types.UsageReportParams{
+		StartTime: startDate,
+		EndTime:   endDate.AddDate(0, 0, 1),
+		GroupBy:   groupBy,
+	})
+	if err != nil {
+		logger.ErrorWithFields(ctx, err, nil)
+		c.Error(errors.NewInternalServerError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
@@ -90,6 +90,10 @@ func Auth(tenantService interfaces.TenantService, userService interfaces.UserSer
 
 		// 尝试X-API-Key认证（兼容模式）
 		apiKey := c.GetHeader("X-API-Key")
+		// OpenAI兼容客户端通过 Authorization: Bearer 传递API Key
+		if apiKey == "" && strings.HasPrefix(authHeader, "Bearer ") {
+			apiKey = strings.TrimPrefix(authHeader, "Bearer ")
+		}
 		if apiKey != "" {
 			// Get tenant information
 			tenantID, err := tenantService.ExtractTenantIDFromAPIKey(apiKey)
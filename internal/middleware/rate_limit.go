@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/Tencent/WeKnora/internal/errors"
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+)
+
+// 限流相关的响应头
+const (
+	headerRetryAfter              = "Retry-After"
+	headerRateLimitLimit          = "X-RateLimit-Limit"
+	headerRateLimitRemaining      = "X-RateLimit-Remaining"
+	headerRateLimitReset          = "X-RateLimit-Reset"
+	headerQuotaTokensRemaining    = "X-Quota-Tokens-Remaining"
+	headerQuotaDocumentsRemaining = "X-Quota-Documents-Remaining"
+	headerQuotaStreamsRemaining   = "X-Quota-Streams-Remaining"
+)
+
+// rateLimitedAPI 受租户限流的接口，所有接口都计入每分钟请求数
+type rateLimitedAPI struct {
+	stream   bool // 占用并发对话流名额
+	tokens   bool // 需要剩余 token 配额
+	document bool // 计入每小时文档数
+}
+
+// 受租户限流的对话、检索和导入接口，键为请求方法和路由路径
+var rateLimitedAPIs = map[string]rateLimitedAPI{
+	"POST /api/v1/knowledge-chat/:session_id":         {stream: true, tokens: true},
+	"POST /api/v1/chat/completions":                   {stream: true, tokens: true},
+	"POST /api/v1/knowledge-search":                   {tokens: true},
+	"GET /api/v1/knowledge-bases/:id/hybrid-search":   {tokens: true},
+	"POST /api/v1/knowledge-bases/:id/knowledge/file": {document: true},
+	"POST /api/v1/knowledge-bases/:id/knowledge/url":  {document: true},
+	"PUT /api/v1/knowledge/:id/file":                  {document: true},
+}
+
+// RateLimitedRoutes 返回受租户限流的接口，格式为“请求方法 路由路径”，用于校验路由注册
+func RateLimitedRoutes() []string {
+	routes := make([]string, 0, len(rateLimitedAPIs))
+	for route := range rateLimitedAPIs {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// RateLimit 租户限流中间件，需放在认证中间件之后。
+// 超过限额的请求返回 429 和 Retry-After，并通过响应头返回剩余配额
+func RateLimit(limiter interfaces.QuotaLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		api, ok := rateLimitedAPIs[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		if _, ok := ctx.Value(types.TenantIDContextKey).(uint); !ok {
+			c.Next()
+			return
+		}
+
+		decision := limiter.AllowRequest(ctx)
+		if !decision.Unlimited() {
+			c.Header(headerRateLimitLimit, strconv.FormatInt(decision.Limit, 10))
+			c.Header(headerRateLimitRemaining, strconv.FormatInt(decision.Remaining, 10))
+			c.Header(headerRateLimitReset, strconv.FormatInt(decision.ResetAt.Unix(), 10))
+		}
+		if !decision.Allowed {
+			rejectRequest(c, decision, "Too many requests, please retry later")
+			return
+		}
+
+		if api.tokens {
+			decision := limiter.CheckTokens(ctx)
+			setRemainingHeader(c, headerQuotaTokensRemaining, decision)
+			if !decision.Allowed {
+				rejectRequest(c, decision, "Daily token quota exceeded")
+				return
+			}
+		}
+
+		if api.document {
+			decision := limiter.AllowDocument(ctx)
+			setRemainingHeader(c, headerQuotaDocumentsRemaining, decision)
+			if !decision.Allowed {
+				rejectRequest(c, decision, "Hourly document quota exceeded")
+				return
+			}
+		}
+
+		if api.stream {
+			streamID := uuid.New().String()
+			decision := limiter.AcquireStream(ctx, streamID)
+			setRemainingHeader(c, headerQuotaStreamsRemaining, decision)
+			if !decision.Allowed {
+				rejectRequest(c, decision, "Too many concurrent streams, please retry later")
+				return
+			}
+			// 流式接口在生成结束后才返回，此时释放名额
+			defer limiter.ReleaseStream(context.WithoutCancel(ctx), streamID)
+		}
+
+		c.Next()
+	}
+}
+
+// setRemainingHeader 设置剩余配额响应头，不限制时不设置
+func setRemainingHeader(c *gin.Context, header string, decision *types.QuotaDecision) {
+	if decision.Unlimited() {
+		return
+	}
+	c.Header(header, strconv.FormatInt(decision.Remaining, 10))
+}
+
+// rejectRequest 以 429 拒绝超过限额的请求
+func rejectRequest(c *gin.Context, decision *types.QuotaDecision, message string) {
+	retryAfter := decision.RetryAfter(time.Now())
+	logger.Warnf(c.Request.Context(), "Request rejected by rate limit: %s, retry after %s", message, retryAfter)
+	c.Header(headerRetryAfter, strconv.Itoa(int(retryAfter.Seconds())))
+	c.Error(errors.NewTooManyRequestsError(message))
+	c.Abort()
+}
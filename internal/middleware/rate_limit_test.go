@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// fakeQuotaLimiter returns fixed decisions and records the calls
+type fakeQuotaLimiter struct {
+	request  *types.QuotaDecision
+	document *types.QuotaDecision
+	stream   *types.QuotaDecision
+	tokens   *types.QuotaDecision
+	calls    []string
+	acquired []string
+	released []string
+}
+
+func newFakeQuotaLimiter() *fakeQuotaLimiter {
+	return &fakeQuotaLimiter{
+		request:  types.UnlimitedQuota(),
+		document: types.UnlimitedQuota(),
+		stream:   types.UnlimitedQuota(),
+		tokens:   types.UnlimitedQuota(),
+	}
+}
+
+func (l *fakeQuotaLimiter) AllowRequest(ctx context.Context) *types.QuotaDecision {
+	l.calls = append(l.calls, "request")
+	return l.request
+}
+
+func (l *fakeQuotaLimiter) AllowDocument(ctx context.Context) *types.QuotaDecision {
+	l.calls = append(l.calls, "document")
+	return l.document
+}
+
+func (l *fakeQuotaLimiter) AcquireStream(ctx context.Context, streamID string) *types.QuotaDecision {
+	l.calls = append(l.calls, "stream")
+	l.acquired = append(l.acquired, streamID)
+	return l.stream
+}
+
+func (l *fakeQuotaLimiter) ReleaseStream(ctx context.Context, streamID string) {
+	l.released = append(l.released, streamID)
+}
+
+func (l *fakeQuotaLimiter) CheckTokens(ctx context.Context) *types.QuotaDecision {
+	l.calls = append(l.calls, "tokens")
+	return l.tokens
+}
+
+func (l *fakeQuotaLimiter) ConsumeTokens(ctx context.Context, tokens int) {}
+
+// newRateLimitRouter returns a router serving the rate limited APIs for tenant 1 and whether a handler ran
+func newRateLimitRouter(limiter *fakeQuotaLimiter, handled *bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ErrorHandler())
+	r.Use(func(c *gin.Context) {
+		if c.GetHeader("X-Tenant") != "" {
+			c.Request = c.Request.WithContext(
+				context.WithValue(c.Request.Context(), types.TenantIDContextKey, uint(1)),
+			)
+		}
+		c.Next()
+	})
+	r.Use(RateLimit(limiter))
+	handler := func(c *gin.Context) {
+		*handled = true
+		if len(limiter.released) != 0 {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+	v1 := r.Group("/api/v1")
+	v1.POST("/knowledge-chat/:session_id", handler)
+	v1.POST("/knowledge-search", handler)
+	v1.POST("/knowledge-bases/:id/knowledge/file", handler)
+	v1.GET("/sessions/:id", handler)
+	return r
+}
+
+func serveRateLimited(r *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-Tenant", "1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitUnlimitedAPI(t *testing.T) {
+	limiter := newFakeQuotaLimiter()
+	var handled bool
+	r := newRateLimitRouter(limiter, &handled)
+
+	w := serveRateLimited(r, http.MethodGet, "/api/v1/sessions/s1")
+	if w.Code != http.StatusOK || !handled || len(limiter.calls) != 0 {
+		t.Errorf("Expected an API without limits not to be counted, got %d and %v", w.Code, limiter.calls)
+	}
+}
+
+func TestRateLimitRequests(t *testing.T) {
+	limiter := newFakeQuotaLimiter()
+	resetAt := time.Now().Add(30 * time.Second)
+	limiter.request = &types.QuotaDecision{Allowed: false, Limit: 60, ResetAt: resetAt}
+	var handled bool
+	r := newRateLimitRouter(limiter, &handled)
+
+	w := serveRateLimited(r, http.MethodPost, "/api/v1/knowledge-search")
+	if w.Code != http.StatusTooManyRequests || handled {
+		t.Fatalf("Expected the request to be rejected, got %d", w.Code)
+	}
+	if retryAfter := w.Header().Get(headerRetryAfter); retryAfter != "30" && retryAfter != "29" {
+		t.Errorf("Expected to retry when the window resets, got %s", retryAfter)
+	}
+	if w.Header().Get(headerRateLimitLimit) != "60" || w.Header().Get(headerRateLimitRemaining) != "0" {
+		t.Errorf("Expected the rate limit headers, got %v", w.Header())
+	}
+	if len(limiter.calls) != 1 {
+		t.Errorf("Expected the other quotas not to be counted, got %v", limiter.calls)
+	}
+
+	// Requests without tenant are left to the authentication
+	handled = false
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/knowledge-search", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !handled {
+		t.Errorf("Expected a request without tenant not to be limited, got %d", w.Code)
+	}
+}
+
+func TestRateLimitTokens(t *testing.T) {
+	limiter := newFakeQuotaLimiter()
+	limiter.tokens = &types.QuotaDecision{Allowed: false, Limit: 1000, ResetAt: time.Now().Add(time.Hour)}
+	var handled bool
+	r := newRateLimitRouter(limiter, &handled)
+
+	w := serveRateLimited(r, http.MethodPost, "/api/v1/knowledge-search")
+	if w.Code != http.StatusTooManyRequests || handled {
+		t.Fatalf("Expected the request to be rejected, got %d", w.Code)
+	}
+	if w.Header().Get(headerQuotaTokensRemaining) != "0" || w.Header().Get(headerRetryAfter) == "" {
+		t.Errorf("Expected the token quota headers, got %v", w.Header())
+	}
+	if w.Header().Get(headerRateLimitLimit) != "" {
+		t.Errorf("Expected no rate limit headers without a request limit, got %v", w.Header())
+	}
+}
+
+func TestRateLimitDocuments(t *testing.T) {
+	limiter := newFakeQuotaLimiter()
+	limiter.document = &types.QuotaDecision{Allowed: true, Limit: 10, Remaining: 9, ResetAt: time.Now()}
+	var handled bool
+	r := newRateLimitRouter(limiter, &handled)
+
+	w := serveRateLimited(r, http.MethodPost, "/api/v1/knowledge-bases/kb/knowledge/file")
+	if w.Code != http.StatusOK || !handled {
+		t.Fatalf("Expected the document to be allowed, got %d", w.Code)
+	}
+	if w.Header().Get(headerQuotaDocumentsRemaining) != "9" {
+		t.Errorf("Expected the remaining documents, got %v", w.Header())
+	}
+	if len(limiter.calls) != 2 || limiter.calls[1] != "document" {
+		t.Errorf("Expected the request and the document to be counted, got %v", limiter.calls)
+	}
+}
+
+func TestRateLimitStreams(t *testing.T) {
+	limiter := newFakeQuotaLimiter()
+	limiter.stream = &types.QuotaDecision{Allowed: true, Limit: 2, Remaining: 1}
+	var handled bool
+	r := newRateLimitRouter(limiter, &handled)
+
+	// The slot is held while the handler streams and released once it returns
+	w := serveRateLimited(r, http.MethodPost, "/api/v1/knowledge-chat/s1")
+	if w.Code != http.StatusOK || !handled {
+		t.Fatalf("Expected the stream to be allowed, got %d", w.Code)
+	}
+	if len(limiter.acquired) != 1 || len(limiter.released) != 1 || limiter.acquired[0] != limiter.released[0] {
+		t.Errorf("Expected the acquired slot to be released, got %v and %v", limiter.acquired, limiter.released)
+	}
+	if w.Header().Get(headerQuotaStreamsRemaining) != "1" {
+		t.Errorf("Expected the remaining streams, got %v", w.Header())
+	}
+
+	limiter.stream = &types.QuotaDecision{Allowed: false, Limit: 2, ResetAt: time.Now().Add(5 * time.Second)}
+	limiter.released = nil
+	handled = false
+	w = serveRateLimited(r, http.MethodPost, "/api/v1/knowledge-chat/s1")
+	if w.Code != http.StatusTooManyRequests || handled {
+		t.Fatalf("Expected the stream to be rejected, got %d", w.Code)
+	}
+	if len(limiter.released) != 0 {
+		t.Errorf("Expected the rejected stream not to be released by the middleware, got %v", limiter.released)
+	}
+}
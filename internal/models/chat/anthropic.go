@@ -0,0 +1,283 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/models/utils"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+const (
+	// anthropicDefaultBaseURL Anthropic API 默认地址
+	anthropicDefaultBaseURL = "https://api.anthropic.com"
+	// anthropicAPIVersion Anthropic Messages API 版本
+	anthropicAPIVersion = "2023-06-01"
+	// anthropicDefaultMaxTokens 未指定时的最大输出 token 数，Messages API 要求必填
+	anthropicDefaultMaxTokens = 4096
+)
+
+// AnthropicChat 基于 Anthropic Messages API 的聊天实现
+type AnthropicChat struct {
+	modelName string
+	modelID   string
+	baseURL   string
+	apiKey    string
+	client    *http.Client
+}
+
+// anthropicMessage Anthropic 消息
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// anthropicRequest Anthropic Messages API 请求
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	TopP        *float64           `json:"top_p,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+// anthropicUsage Anthropic token 用量
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicResponse Anthropic Messages API 响应
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Usage anthropicUsage `json:"usage"`
+}
+
+// anthropicStreamEvent Anthropic 流式事件，只解析用到的字段
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewAnthropicChat 创建 Anthropic 聊天实例
+func NewAnthropicChat(chatConfig *ChatConfig) (*AnthropicChat, error) {
+	baseURL := strings.TrimSuffix(chatConfig.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = anthropicDefaultBaseURL
+	}
+	return &AnthropicChat{
+		modelName: chatConfig.ModelName,
+		modelID:   chatConfig.ModelID,
+		baseURL:   baseURL,
+		apiKey:    chatConfig.APIKey,
+		client:    &http.Client{},
+	}, nil
+}
+
+// endpoint 返回 Messages API 地址，兼容带 /v1 的 Base URL
+func (c *AnthropicChat) endpoint() string {
+	if strings.HasSuffix(c.baseURL, "/v1") {
+		return c.baseURL + "/messages"
+	}
+	return c.baseURL + "/v1/messages"
+}
+
+// buildRequest 构建请求参数，system 消息放入 system 字段，相邻的同角色消息合并
+func (c *AnthropicChat) buildRequest(messages []Message, opts *ChatOptions, isStream bool) *anthropicRequest {
+	req := &anthropicRequest{
+		Model:     c.modelName,
+		MaxTokens: anthropicDefaultMaxTokens,
+		Stream:    isStream,
+	}
+	var system []string
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			system = append(system, msg.Content)
+			continue
+		}
+		if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == msg.Role {
+			req.Messages[n-1].Content += "\n\n" + msg.Content
+			continue
+		}
+		req.Messages = append(req.Messages, anthropicMessage{Role: msg.Role, Content: msg.Content})
+	}
+	req.System = strings.Join(system, "\n\n")
+
+	if opts != nil {
+		if opts.Temperature > 0 {
+			req.Temperature = &opts.Temperature
+		}
+		if opts.TopP > 0 {
+			req.TopP = &opts.TopP
+		}
+		if opts.MaxCompletionTokens > 0 {
+			req.MaxTokens = opts.MaxCompletionTokens
+		}
+		if opts.MaxTokens > 0 {
+			req.MaxTokens = opts.MaxTokens
+		}
+	}
+	return req
+}
+
+// send 发送请求，非 200 响应返回带状态码的错误
+func (c *AnthropicChat) send(ctx context.Context, req *anthropicRequest) (*http.Response, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", c.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &utils.HTTPStatusError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("anthropic API error: Http Status: %s, Body: %s", resp.Status, string(body)),
+		}
+	}
+	return resp, nil
+}
+
+// Chat 进行非流式聊天
+func (c *AnthropicChat) Chat(ctx context.Context, messages []Message, opts *ChatOptions) (*types.ChatResponse, error) {
+	resp, err := c.send(ctx, c.buildRequest(messages, opts, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var chatResp anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	var content strings.Builder
+	for _, block := range chatResp.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+	return &types.ChatResponse{
+		Content: content.String(),
+		Usage: types.TokenUsage{
+			PromptTokens:     chatResp.Usage.InputTokens,
+			CompletionTokens: chatResp.Usage.OutputTokens,
+			TotalTokens:      chatResp.Usage.InputTokens + chatResp.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+// ChatStream 进行流式聊天
+func (c *AnthropicChat) ChatStream(ctx context.Context,
+	messages []Message, opts *ChatOptions,
+) (<-chan types.StreamResponse, error) {
+	resp, err := c.send(ctx, c.buildRequest(messages, opts, true))
+	if err != nil {
+		return nil, err
+	}
+
+	streamChan := make(chan types.StreamResponse)
+	go func() {
+		defer close(streamChan)
+		defer resp.Body.Close()
+
+		// 输入 token 在 message_start 中返回，输出 token 在 message_delta 中累计返回
+		var usage anthropicUsage
+		var streamErr error
+		stopped := false
+		err := readSSEData(resp.Body, func(data []byte) bool {
+			var event anthropicStreamEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				logger.GetLogger(ctx).Errorf("解析 Anthropic 流式事件失败: %v", err)
+				return true
+			}
+			switch event.Type {
+			case "message_start":
+				usage.InputTokens = event.Message.Usage.InputTokens
+			case "content_block_delta":
+				if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+					streamChan <- types.StreamResponse{
+						ResponseType: types.ResponseTypeAnswer,
+						Content:      event.Delta.Text,
+						Done:         false,
+					}
+				}
+			case "message_delta":
+				usage.OutputTokens = event.Usage.OutputTokens
+			case "message_stop":
+				stopped = true
+				return false
+			case "error":
+				streamErr = fmt.Errorf("anthropic stream error: %s %s", event.Error.Type, event.Error.Message)
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			streamErr = fmt.Errorf("read anthropic stream: %w", err)
+		} else if !stopped && streamErr == nil {
+			streamErr = fmt.Errorf("anthropic stream ended before message_stop")
+		}
+
+		final := types.StreamResponse{
+			ResponseType: types.ResponseTypeAnswer,
+			Done:         true,
+			Usage: &types.TokenUsage{
+				PromptTokens:     usage.InputTokens,
+				CompletionTokens: usage.OutputTokens,
+				TotalTokens:      usage.InputTokens + usage.OutputTokens,
+			},
+		}
+		if streamErr != nil {
+			logger.GetLogger(ctx).Errorf("Anthropic 流式聊天失败: %v", streamErr)
+			final.ResponseType = types.ResponseTypeError
+			final.Content = streamErr.Error()
+		}
+		streamChan <- final
+	}()
+
+	return streamChan, nil
+}
+
+// GetModelName 获取模型名称
+func (c *AnthropicChat) GetModelName() string {
+	return c.modelName
+}
+
+// GetModelID 获取模型ID
+func (c *AnthropicChat) GetModelID() string {
+	return c.modelID
+}
@@ -0,0 +1,30 @@
+package chat
+
+import (
+	"github.com/sashabaranov/go-openai"
+)
+
+// azureOpenAIDefaultAPIVersion Azure OpenAI 默认 API 版本
+const azureOpenAIDefaultAPIVersion = "2024-10-21"
+
+// NewAzureOpenAIChat 创建 Azure OpenAI 聊天实例，Base URL 为资源地址，模型名称为部署名称
+func NewAzureOpenAIChat(chatConfig *ChatConfig) (*RemoteAPIChat, error) {
+	config := openai.DefaultAzureConfig(chatConfig.APIKey, chatConfig.BaseURL)
+	config.APIVersion = azureOpenAIDefaultAPIVersion
+	if chatConfig.APIVersion != "" {
+		config.APIVersion = chatConfig.APIVersion
+	}
+	// 部署名称与模型名称一致，不做转换
+	config.AzureModelMapperFunc = func(model string) string {
+		return model
+	}
+	return &RemoteAPIChat{
+		modelName:        chatConfig.ModelName,
+		client:           openai.NewClientWithConfig(config),
+		modelID:          chatConfig.ModelID,
+		baseURL:          chatConfig.BaseURL,
+		apiKey:           chatConfig.APIKey,
+		noTemplateKwargs: true,
+		noStreamUsage:    chatConfig.NoStreamUsage,
+	}, nil
+}
@@ -44,11 +44,14 @@ type Chat interface {
 }
 
 type ChatConfig struct {
-	Source    types.ModelSource
-	BaseURL   string
-	ModelName string
-	APIKey    string
-	ModelID   string
+	Source     types.ModelSource
+	BaseURL    string
+	ModelName  string
+	APIKey     string
+	ModelID    string
+	APIVersion string
+	// NoStreamUsage 流式请求不携带 stream_options，用于不接受该字段的 OpenAI 兼容服务
+	NoStreamUsage bool
 }
 
 // NewChat 创建聊天实例
@@ -66,6 +69,12 @@ func NewChat(config *ChatConfig) (Chat, error) {
 		return chat, nil
 	case string(types.ModelSourceRemote):
 		return NewRemoteAPIChat(config)
+	case string(types.ModelSourceAnthropic):
+		return NewAnthropicChat(config)
+	case string(types.ModelSourceGemini):
+		return NewGeminiChat(config)
+	case string(types.ModelSourceAzureOpenAI):
+		return NewAzureOpenAIChat(config)
 	default:
 		return nil, fmt.Errorf("unsupported chat model source: %s", config.Source)
 	}
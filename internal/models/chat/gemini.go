@@ -0,0 +1,282 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/models/utils"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// geminiDefaultBaseURL Gemini API 默认地址
+const geminiDefaultBaseURL = "https://generativelanguage.googleapis.com"
+
+// GeminiChat 基于 Gemini generateContent API 的聊天实现
+type GeminiChat struct {
+	modelName string
+	modelID   string
+	baseURL   string
+	apiKey    string
+	client    *http.Client
+}
+
+// geminiPart Gemini 内容片段
+type geminiPart struct {
+	Text    string `json:"text,omitempty"`
+	Thought bool   `json:"thought,omitempty"`
+}
+
+// geminiContent Gemini 内容，角色为 user 或 model
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiGenerationConfig Gemini 生成参数
+type geminiGenerationConfig struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	MaxOutputTokens  int      `json:"maxOutputTokens,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	FrequencyPenalty *float64 `json:"frequencyPenalty,omitempty"`
+	PresencePenalty  *float64 `json:"presencePenalty,omitempty"`
+}
+
+// geminiRequest Gemini generateContent 请求
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// geminiResponse Gemini generateContent 响应，流式响应的每个数据块格式相同
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+// NewGeminiChat 创建 Gemini 聊天实例
+func NewGeminiChat(chatConfig *ChatConfig) (*GeminiChat, error) {
+	baseURL := strings.TrimSuffix(chatConfig.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = geminiDefaultBaseURL
+	}
+	return &GeminiChat{
+		modelName: chatConfig.ModelName,
+		modelID:   chatConfig.ModelID,
+		baseURL:   baseURL,
+		apiKey:    chatConfig.APIKey,
+		client:    &http.Client{},
+	}, nil
+}
+
+// endpoint 返回模型方法的地址，兼容带 /v1beta 的 Base URL
+func (c *GeminiChat) endpoint(method string) string {
+	baseURL := c.baseURL
+	if !strings.HasSuffix(baseURL, "/v1beta") && !strings.HasSuffix(baseURL, "/v1") {
+		baseURL += "/v1beta"
+	}
+	return fmt.Sprintf("%s/models/%s:%s", baseURL, url.PathEscape(c.modelName), method)
+}
+
+// buildRequest 构建请求参数，system 消息放入 systemInstruction，assistant 角色转换为 model，
+// 相邻的同角色消息合并
+func (c *GeminiChat) buildRequest(messages []Message, opts *ChatOptions) *geminiRequest {
+	req := &geminiRequest{}
+	var system []geminiPart
+	for _, msg := range messages {
+		role := "user"
+		switch msg.Role {
+		case "system":
+			system = append(system, geminiPart{Text: msg.Content})
+			continue
+		case "assistant":
+			role = "model"
+		}
+		if n := len(req.Contents); n > 0 && req.Contents[n-1].Role == role {
+			req.Contents[n-1].Parts = append(req.Contents[n-1].Parts, geminiPart{Text: msg.Content})
+			continue
+		}
+		req.Contents = append(req.Contents, geminiContent{Role: role, Parts: []geminiPart{{Text: msg.Content}}})
+	}
+	if len(system) > 0 {
+		req.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	if opts != nil {
+		config := &geminiGenerationConfig{}
+		if opts.Temperature > 0 {
+			config.Temperature = &opts.Temperature
+		}
+		if opts.TopP > 0 {
+			config.TopP = &opts.TopP
+		}
+		if opts.MaxCompletionTokens > 0 {
+			config.MaxOutputTokens = opts.MaxCompletionTokens
+		}
+		if opts.MaxTokens > 0 {
+			config.MaxOutputTokens = opts.MaxTokens
+		}
+		if opts.Seed > 0 {
+			config.Seed = &opts.Seed
+		}
+		if opts.FrequencyPenalty > 0 {
+			config.FrequencyPenalty = &opts.FrequencyPenalty
+		}
+		if opts.PresencePenalty > 0 {
+			config.PresencePenalty = &opts.PresencePenalty
+		}
+		req.GenerationConfig = config
+	}
+	return req
+}
+
+// send 发送请求，非 200 响应返回带状态码的错误
+func (c *GeminiChat) send(ctx context.Context, endpoint string, req *geminiRequest) (*http.Response, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &utils.HTTPStatusError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("gemini API error: Http Status: %s, Body: %s", resp.Status, string(body)),
+		}
+	}
+	return resp, nil
+}
+
+// text 返回响应中第一个候选的回答文本，不包含思考内容
+func (r *geminiResponse) text() string {
+	if len(r.Candidates) == 0 {
+		return ""
+	}
+	var text strings.Builder
+	for _, part := range r.Candidates[0].Content.Parts {
+		if !part.Thought {
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String()
+}
+
+// usage 返回响应中的 token 用量
+func (r *geminiResponse) usage() *types.TokenUsage {
+	if r.UsageMetadata == nil {
+		return nil
+	}
+	return &types.TokenUsage{
+		PromptTokens:     r.UsageMetadata.PromptTokenCount,
+		CompletionTokens: r.UsageMetadata.TotalTokenCount - r.UsageMetadata.PromptTokenCount,
+		TotalTokens:      r.UsageMetadata.TotalTokenCount,
+	}
+}
+
+// Chat 进行非流式聊天
+func (c *GeminiChat) Chat(ctx context.Context, messages []Message, opts *ChatOptions) (*types.ChatResponse, error) {
+	resp, err := c.send(ctx, c.endpoint("generateContent"), c.buildRequest(messages, opts))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var chatResp geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if len(chatResp.Candidates) == 0 {
+		return nil, fmt.Errorf("no response from Gemini")
+	}
+
+	response := &types.ChatResponse{Content: chatResp.text()}
+	if usage := chatResp.usage(); usage != nil {
+		response.Usage = *usage
+	}
+	return response, nil
+}
+
+// ChatStream 进行流式聊天
+func (c *GeminiChat) ChatStream(ctx context.Context,
+	messages []Message, opts *ChatOptions,
+) (<-chan types.StreamResponse, error) {
+	resp, err := c.send(ctx, c.endpoint("streamGenerateContent")+"?alt=sse", c.buildRequest(messages, opts))
+	if err != nil {
+		return nil, err
+	}
+
+	streamChan := make(chan types.StreamResponse)
+	go func() {
+		defer close(streamChan)
+		defer resp.Body.Close()
+
+		// 每个数据块都带有截至当前的用量，以最后一个为准
+		var usage *types.TokenUsage
+		err := readSSEData(resp.Body, func(data []byte) bool {
+			var chunk geminiResponse
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				logger.GetLogger(ctx).Errorf("解析 Gemini 流式响应失败: %v", err)
+				return true
+			}
+			if chunkUsage := chunk.usage(); chunkUsage != nil {
+				usage = chunkUsage
+			}
+			if text := chunk.text(); text != "" {
+				streamChan <- types.StreamResponse{
+					ResponseType: types.ResponseTypeAnswer,
+					Content:      text,
+					Done:         false,
+				}
+			}
+			return true
+		})
+		final := types.StreamResponse{
+			ResponseType: types.ResponseTypeAnswer,
+			Done:         true,
+			Usage:        usage,
+		}
+		if err != nil {
+			logger.GetLogger(ctx).Errorf("读取 Gemini 流式响应失败: %v", err)
+			final.ResponseType = types.ResponseTypeError
+			final.Content = fmt.Sprintf("read gemini stream: %v", err)
+		}
+		streamChan <- final
+	}()
+
+	return streamChan, nil
+}
+
+// GetModelName 获取模型名称
+func (c *GeminiChat) GetModelName() string {
+	return c.modelName
+}
+
+// GetModelID 获取模型ID
+func (c *GeminiChat) GetModelID() string {
+	return c.modelID
+}
@@ -0,0 +1,208 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+var testMessages = []Message{
+	{Role: "system", Content: "你是一个助手"},
+	{Role: "user", Content: "你好"},
+	{Role: "user", Content: "介绍一下你自己"},
+}
+
+// TestAnthropicChat 测试 Anthropic 请求构建与响应解析
+func TestAnthropicChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "key" {
+			t.Errorf("unexpected request %s with key %q", r.URL.Path, r.Header.Get("x-api-key"))
+		}
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if req.System != "你是一个助手" || len(req.Messages) != 1 || req.MaxTokens != 16 {
+			t.Errorf("unexpected request %+v", req)
+		}
+		if !req.Stream {
+			fmt.Fprint(w, `{"content":[{"type":"text","text":"你好，"},{"type":"text","text":"我是助手"}],`+
+				`"usage":{"input_tokens":12,"output_tokens":5}}`)
+			return
+		}
+		fmt.Fprint(w, "event: message_start\n"+
+			`data: {"type":"message_start","message":{"usage":{"input_tokens":12,"output_tokens":1}}}`+"\n\n"+
+			"event: content_block_delta\n"+
+			`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"你好，"}}`+"\n\n"+
+			`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"我是助手"}}`+"\n\n"+
+			`data: {"type":"message_delta","usage":{"output_tokens":5}}`+"\n\n"+
+			`data: {"type":"message_stop"}`+"\n\n")
+	}))
+	defer server.Close()
+
+	chat, err := NewAnthropicChat(&ChatConfig{BaseURL: server.URL, ModelName: "claude", APIKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &ChatOptions{MaxTokens: 16}
+
+	resp, err := chat.Chat(context.Background(), testMessages, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "你好，我是助手" || resp.Usage.TotalTokens != 17 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	stream, err := chat.ChatStream(context.Background(), testMessages, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content strings.Builder
+	var last bool
+	for chunk := range stream {
+		content.WriteString(chunk.Content)
+		if chunk.Done {
+			last = true
+			if chunk.Usage == nil || chunk.Usage.PromptTokens != 12 || chunk.Usage.CompletionTokens != 5 {
+				t.Errorf("unexpected usage %+v", chunk.Usage)
+			}
+		}
+	}
+	if content.String() != "你好，我是助手" || !last {
+		t.Errorf("unexpected stream content %q, done %v", content.String(), last)
+	}
+}
+
+// TestGeminiChat 测试 Gemini 请求构建与响应解析
+func TestGeminiChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-goog-api-key") != "key" {
+			t.Errorf("unexpected key %q", r.Header.Get("x-goog-api-key"))
+		}
+		var req geminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if req.SystemInstruction == nil || len(req.Contents) != 1 || len(req.Contents[0].Parts) != 2 {
+			t.Errorf("unexpected request %+v", req)
+		}
+		switch r.URL.Path {
+		case "/v1beta/models/gemini:generateContent":
+			fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"思考","thought":true},`+
+				`{"text":"我是助手"}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":4,"totalTokenCount":20}}`)
+		case "/v1beta/models/gemini:streamGenerateContent":
+			if r.URL.Query().Get("alt") != "sse" {
+				t.Errorf("expected an SSE stream, got %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `data: {"candidates":[{"content":{"role":"model","parts":[{"text":"你好，"}]}}]}`+"\n\n"+
+				`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"我是助手"}]}}],`+
+				`"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":4,"totalTokenCount":14}}`+"\n\n")
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	chat, err := NewGeminiChat(&ChatConfig{BaseURL: server.URL, ModelName: "gemini", APIKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := chat.Chat(context.Background(), testMessages, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 思考 token 计入输出用量
+	if resp.Content != "我是助手" || resp.Usage.CompletionTokens != 10 || resp.Usage.TotalTokens != 20 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	stream, err := chat.ChatStream(context.Background(), testMessages, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content strings.Builder
+	for chunk := range stream {
+		content.WriteString(chunk.Content)
+		if chunk.Done && (chunk.Usage == nil || chunk.Usage.TotalTokens != 14) {
+			t.Errorf("unexpected usage %+v", chunk.Usage)
+		}
+	}
+	if content.String() != "你好，我是助手" {
+		t.Errorf("unexpected stream content %q", content.String())
+	}
+}
+
+// TestNativeChatHTTPError 测试非 200 响应返回带状态码的错误
+func TestNativeChatHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"overloaded"}`, http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	anthropic, _ := NewAnthropicChat(&ChatConfig{BaseURL: server.URL + "/v1", ModelName: "claude"})
+	gemini, _ := NewGeminiChat(&ChatConfig{BaseURL: server.URL, ModelName: "gemini"})
+	for _, chat := range []Chat{anthropic, gemini} {
+		if _, err := chat.Chat(context.Background(), testMessages, nil); err == nil ||
+			!strings.Contains(err.Error(), "503") {
+			t.Errorf("expected a 503 error from %T, got %v", chat, err)
+		}
+	}
+}
+
+// TestAnthropicChatStreamError 测试流式响应中途出错时以错误响应结束
+func TestAnthropicChatStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"你好"}}`+"\n\n"+
+			`data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`+"\n\n")
+	}))
+	defer server.Close()
+
+	chat, _ := NewAnthropicChat(&ChatConfig{BaseURL: server.URL, ModelName: "claude"})
+	stream, err := chat.ChatStream(context.Background(), testMessages, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last types.StreamResponse
+	for chunk := range stream {
+		last = chunk
+	}
+	if last.ResponseType != types.ResponseTypeError || !last.Done || !strings.Contains(last.Content, "Overloaded") {
+		t.Errorf("expected the stream to end with an error response, got %+v", last)
+	}
+}
+
+// TestRemoteAPIChatStreamUsage 测试流式请求按模型配置携带 stream_options
+func TestRemoteAPIChatStreamUsage(t *testing.T) {
+	for _, noStreamUsage := range []bool{false, true} {
+		var request map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				t.Error(err)
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"content":"你好"}}]}`+"\n\n"+"data: [DONE]\n\n")
+		}))
+
+		chat, _ := NewRemoteAPIChat(&ChatConfig{BaseURL: server.URL, ModelName: "gpt", NoStreamUsage: noStreamUsage})
+		stream, err := chat.ChatStream(context.Background(), testMessages, &ChatOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range stream {
+		}
+		server.Close()
+
+		if _, ok := request["stream_options"]; ok == noStreamUsage {
+			t.Errorf("no_stream_usage=%v, unexpected stream_options in request %v", noStreamUsage, request)
+		}
+	}
+}
@@ -92,10 +92,10 @@ func (c *OllamaChat) Chat(ctx context.Context, messages []Message, opts *ChatOpt
 	err := c.ollamaService.Chat(ctx, chatReq, func(resp ollamaapi.ChatResponse) error {
 		responseContent = resp.Message.Content
 
-		// 获取token计数
-		if resp.EvalCount > 0 {
+		// 获取token计数，EvalCount 即生成的 token 数
+		if resp.Done {
 			promptTokens = resp.PromptEvalCount
-			completionTokens = resp.EvalCount - promptTokens
+			completionTokens = resp.EvalCount
 		}
 
 		return nil
@@ -107,11 +107,7 @@ func (c *OllamaChat) Chat(ctx context.Context, messages []Message, opts *ChatOpt
 	// 构建响应
 	return &types.ChatResponse{
 		Content: responseContent,
-		Usage: struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		}{
+		Usage: types.TokenUsage{
 			PromptTokens:     promptTokens,
 			CompletionTokens: completionTokens,
 			TotalTokens:      promptTokens + completionTokens,
@@ -156,6 +152,11 @@ func (c *OllamaChat) ChatStream(
 				streamChan <- types.StreamResponse{
 					ResponseType: types.ResponseTypeAnswer,
 					Done:         true,
+					Usage: &types.TokenUsage{
+						PromptTokens:     resp.PromptEvalCount,
+						CompletionTokens: resp.EvalCount,
+						TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+					},
 				}
 			}
 
@@ -165,7 +166,8 @@ func (c *OllamaChat) ChatStream(
 			logger.GetLogger(ctx).Errorf("流式聊天请求失败: %v", err)
 			// 发送错误响应
 			streamChan <- types.StreamResponse{
-				ResponseType: types.ResponseTypeAnswer,
+				ResponseType: types.ResponseTypeError,
+				Content:      fmt.Sprintf("流式聊天请求失败: %v", err),
 				Done:         true,
 			}
 		}
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 
+	"github.com/Tencent/WeKnora/internal/models/utils"
 	"github.com/Tencent/WeKnora/internal/types"
 	"github.com/sashabaranov/go-openai"
 )
@@ -19,6 +22,10 @@ type RemoteAPIChat struct {
 	modelID   string
 	baseURL   string
 	apiKey    string
+	// noTemplateKwargs 不发送 chat_template_kwargs，用于不接受该字段的服务
+	noTemplateKwargs bool
+	// noStreamUsage 流式请求不携带 stream_options，此时流式回答没有 token 用量
+	noStreamUsage bool
 }
 
 // QwenChatCompletionRequest 用于 qwen 模型的自定义请求结构体
@@ -35,11 +42,12 @@ func NewRemoteAPIChat(chatConfig *ChatConfig) (*RemoteAPIChat, error) {
 		config.BaseURL = baseURL
 	}
 	return &RemoteAPIChat{
-		modelName: chatConfig.ModelName,
-		client:    openai.NewClientWithConfig(config),
-		modelID:   chatConfig.ModelID,
-		baseURL:   chatConfig.BaseURL,
-		apiKey:    apiKey,
+		modelName:     chatConfig.ModelName,
+		client:        openai.NewClientWithConfig(config),
+		modelID:       chatConfig.ModelID,
+		baseURL:       chatConfig.BaseURL,
+		apiKey:        apiKey,
+		noStreamUsage: chatConfig.NoStreamUsage,
 	}, nil
 }
 
@@ -112,8 +120,10 @@ func (c *RemoteAPIChat) buildChatCompletionRequest(messages []Message,
 		}
 	}
 
-	req.ChatTemplateKwargs = map[string]interface{}{
-		"enable_thinking": thinking,
+	if !c.noTemplateKwargs {
+		req.ChatTemplateKwargs = map[string]interface{}{
+			"enable_thinking": thinking,
+		}
 	}
 
 	return req
@@ -142,11 +152,7 @@ func (c *RemoteAPIChat) Chat(ctx context.Context, messages []Message, opts *Chat
 	// 转换响应格式
 	return &types.ChatResponse{
 		Content: resp.Choices[0].Message.Content,
-		Usage: struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		}{
+		Usage: types.TokenUsage{
 			PromptTokens:     resp.Usage.PromptTokens,
 			CompletionTokens: resp.Usage.CompletionTokens,
 			TotalTokens:      resp.Usage.TotalTokens,
@@ -188,7 +194,10 @@ func (c *RemoteAPIChat) chatWithQwen(ctx context.Context, messages []Message, op
 
 	// 检查响应状态
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+		return nil, &utils.HTTPStatusError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("API request failed with status: %d", resp.StatusCode),
+		}
 	}
 
 	// 解析响应
@@ -204,11 +213,7 @@ func (c *RemoteAPIChat) chatWithQwen(ctx context.Context, messages []Message, op
 	// 转换响应格式
 	return &types.ChatResponse{
 		Content: chatResp.Choices[0].Message.Content,
-		Usage: struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		}{
+		Usage: types.TokenUsage{
 			PromptTokens:     chatResp.Usage.PromptTokens,
 			CompletionTokens: chatResp.Usage.CompletionTokens,
 			TotalTokens:      chatResp.Usage.TotalTokens,
@@ -220,8 +225,11 @@ func (c *RemoteAPIChat) chatWithQwen(ctx context.Context, messages []Message, op
 func (c *RemoteAPIChat) ChatStream(ctx context.Context,
 	messages []Message, opts *ChatOptions,
 ) (<-chan types.StreamResponse, error) {
-	// 构建请求参数
+	// 构建请求参数，除非模型关闭，要求在最后一个数据块中返回 token 用量
 	req := c.buildChatCompletionRequest(messages, opts, true)
+	if !c.noStreamUsage {
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
 
 	// 创建流式响应通道
 	streamChan := make(chan types.StreamResponse)
@@ -238,15 +246,35 @@ func (c *RemoteAPIChat) ChatStream(ctx context.Context,
 		defer close(streamChan)
 		defer stream.Close()
 
+		var usage *types.TokenUsage
 		for {
 			response, err := stream.Recv()
-			if err != nil {
+			if errors.Is(err, io.EOF) {
 				streamChan <- types.StreamResponse{
 					ResponseType: types.ResponseTypeAnswer,
 					Done:         true,
+					Usage:        usage,
 				}
 				return
 			}
+			if err != nil {
+				// 连接中断或服务端报错，以错误响应结束，避免截断的回答被当作完整回答
+				streamChan <- types.StreamResponse{
+					ResponseType: types.ResponseTypeError,
+					Content:      fmt.Sprintf("receive chat completion stream: %v", err),
+					Done:         true,
+					Usage:        usage,
+				}
+				return
+			}
+			// 用量在不含 choices 的最后一个数据块中返回
+			if response.Usage != nil {
+				usage = &types.TokenUsage{
+					PromptTokens:     response.Usage.PromptTokens,
+					CompletionTokens: response.Usage.CompletionTokens,
+					TotalTokens:      response.Usage.TotalTokens,
+				}
+			}
 			if len(response.Choices) > 0 {
 				streamChan <- types.StreamResponse{
 					ResponseType: types.ResponseTypeAnswer,
@@ -0,0 +1,30 @@
+package chat
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// maxSSELineSize 单行服务端事件的最大长度
+const maxSSELineSize = 1024 * 1024
+
+// readSSEData 逐条读取服务端事件（SSE）中的 data 字段，handle 返回 false 时停止读取
+func readSSEData(body io.Reader, handle func(data []byte) bool) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+		if len(data) == 0 {
+			continue
+		}
+		if !handle(data) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
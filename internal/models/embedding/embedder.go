@@ -18,6 +18,9 @@ type Embedder interface {
 	// BatchEmbed converts multiple texts to vectors in batch
 	BatchEmbed(ctx context.Context, texts []string) ([][]float32, error)
 
+	// BatchEmbedWithUsage converts multiple texts to vectors in batch and reports the tokens consumed
+	BatchEmbedWithUsage(ctx context.Context, texts []string) ([][]float32, *types.TokenUsage, error)
+
 	// GetModelName returns the model name
 	GetModelName() string
 
@@ -7,6 +7,7 @@ import (
 
 	"github.com/Tencent/WeKnora/internal/logger"
 	"github.com/Tencent/WeKnora/internal/models/utils/ollama"
+	"github.com/Tencent/WeKnora/internal/types"
 	ollamaapi "github.com/ollama/ollama/api"
 )
 
@@ -81,9 +82,17 @@ func (e *OllamaEmbedder) Embed(ctx context.Context, text string) ([]float32, err
 
 // BatchEmbed converts multiple texts to vectors in batch
 func (e *OllamaEmbedder) BatchEmbed(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings, _, err := e.BatchEmbedWithUsage(ctx, texts)
+	return embeddings, err
+}
+
+// BatchEmbedWithUsage converts multiple texts to vectors in batch and reports the tokens consumed
+func (e *OllamaEmbedder) BatchEmbedWithUsage(ctx context.Context,
+	texts []string,
+) ([][]float32, *types.TokenUsage, error) {
 	// Ensure model is available
 	if err := e.ensureModelAvailable(ctx); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Create request
@@ -102,11 +111,14 @@ func (e *OllamaEmbedder) BatchEmbed(ctx context.Context, texts []string) ([][]fl
 	startTime := time.Now()
 	resp, err := e.ollamaService.Embeddings(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get embedding vectors: %w", err)
+		return nil, nil, fmt.Errorf("failed to get embedding vectors: %w", err)
 	}
 
 	logger.GetLogger(ctx).Debugf("Embedding vector retrieval took: %v", time.Since(startTime))
-	return resp.Embeddings, nil
+	return resp.Embeddings, &types.TokenUsage{
+		PromptTokens: resp.PromptEvalCount,
+		TotalTokens:  resp.PromptEvalCount,
+	}, nil
 }
 
 // GetModelName returns the model name
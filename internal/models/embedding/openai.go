@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/models/utils"
+	"github.com/Tencent/WeKnora/internal/types"
 )
 
 // OpenAIEmbedder implements text vectorization functionality using OpenAI API
@@ -39,6 +41,7 @@ type OpenAIEmbedResponse struct {
 		Embedding []float32 `json:"embedding"`
 		Index     int       `json:"index"`
 	} `json:"data"`
+	Usage types.TokenUsage `json:"usage"`
 }
 
 // NewOpenAIEmbedder creates a new OpenAI embedder
@@ -132,7 +135,16 @@ func (e *OpenAIEmbedder) doRequestWithRetry(ctx context.Context, jsonData []byte
 	return nil, err
 }
 
+// BatchEmbed converts multiple texts to vectors in batch
 func (e *OpenAIEmbedder) BatchEmbed(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings, _, err := e.BatchEmbedWithUsage(ctx, texts)
+	return embeddings, err
+}
+
+// BatchEmbedWithUsage converts multiple texts to vectors in batch and reports the tokens consumed
+func (e *OpenAIEmbedder) BatchEmbedWithUsage(ctx context.Context,
+	texts []string,
+) ([][]float32, *types.TokenUsage, error) {
 	// Create request body
 	reqBody := OpenAIEmbedRequest{
 		Model:                e.modelName,
@@ -143,14 +155,14 @@ func (e *OpenAIEmbedder) BatchEmbed(ctx context.Context, texts []string) ([][]fl
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		logger.GetLogger(ctx).Errorf("OpenAIEmbedder EmbedBatch marshal request error: %v", err)
-		return nil, fmt.Errorf("marshal request: %w", err)
+		return nil, nil, fmt.Errorf("marshal request: %w", err)
 	}
 
 	// Send request (passing jsonData instead of constructing http.Request)
 	resp, err := e.doRequestWithRetry(ctx, jsonData)
 	if err != nil {
 		logger.GetLogger(ctx).Errorf("OpenAIEmbedder EmbedBatch send request error: %v", err)
-		return nil, fmt.Errorf("send request: %w", err)
+		return nil, nil, fmt.Errorf("send request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -158,19 +170,22 @@ func (e *OpenAIEmbedder) BatchEmbed(ctx context.Context, texts []string) ([][]fl
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		logger.GetLogger(ctx).Errorf("OpenAIEmbedder EmbedBatch read response error: %v", err)
-		return nil, fmt.Errorf("read response: %w", err)
+		return nil, nil, fmt.Errorf("read response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		logger.GetLogger(ctx).Errorf("OpenAIEmbedder EmbedBatch API error: Http Status %s", resp.Status)
-		return nil, fmt.Errorf("EmbedBatch API error: Http Status %s", resp.Status)
+		return nil, nil, &utils.HTTPStatusError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("EmbedBatch API error: Http Status %s", resp.Status),
+		}
 	}
 
 	// Parse response
 	var response OpenAIEmbedResponse
 	if err := json.Unmarshal(body, &response); err != nil {
 		logger.GetLogger(ctx).Errorf("OpenAIEmbedder EmbedBatch unmarshal response error: %v", err)
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+		return nil, nil, fmt.Errorf("unmarshal response: %w", err)
 	}
 
 	// Extract embedding vectors
@@ -179,7 +194,12 @@ func (e *OpenAIEmbedder) BatchEmbed(ctx context.Context, texts []string) ([][]fl
 		embeddings = append(embeddings, data.Embedding)
 	}
 
-	return embeddings, nil
+	// Some OpenAI compatible APIs only report the total tokens of an embedding request
+	usage := response.Usage
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = usage.TotalTokens
+	}
+	return embeddings, &usage, nil
 }
 
 // GetModelName returns the model name
@@ -9,6 +9,8 @@ import (
 	"net/http"
 
 	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/models/utils"
+	"github.com/Tencent/WeKnora/internal/types"
 )
 
 // AliyunReranker implements a reranking system based on Aliyun DashScope models
@@ -86,6 +88,14 @@ func NewAliyunReranker(config *RerankerConfig) (*AliyunReranker, error) {
 
 // Rerank performs document reranking based on relevance to the query using Aliyun DashScope API
 func (r *AliyunReranker) Rerank(ctx context.Context, query string, documents []string) ([]RankResult, error) {
+	results, _, err := r.RerankWithUsage(ctx, query, documents)
+	return results, err
+}
+
+// RerankWithUsage performs document reranking using Aliyun DashScope API and reports the tokens consumed
+func (r *AliyunReranker) RerankWithUsage(ctx context.Context,
+	query string, documents []string,
+) ([]RankResult, *types.TokenUsage, error) {
 	// Build the request body
 	requestBody := &AliyunRerankRequest{
 		Model: r.modelName,
@@ -101,13 +111,13 @@ func (r *AliyunReranker) Rerank(ctx context.Context, query string, documents []s
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		return nil, fmt.Errorf("marshal request body: %w", err)
+		return nil, nil, fmt.Errorf("marshal request body: %w", err)
 	}
 
 	// Send the request
 	req, err := http.NewRequestWithContext(ctx, "POST", r.baseURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, nil, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.apiKey))
@@ -119,23 +129,26 @@ func (r *AliyunReranker) Rerank(ctx context.Context, query string, documents []s
 
 	resp, err := r.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		return nil, nil, fmt.Errorf("do request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Read the response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("read response body: %w", err)
+		return nil, nil, fmt.Errorf("read response body: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("aliyun rerank API error: Http Status: %s, Body: %s", resp.Status, string(body))
+		return nil, nil, &utils.HTTPStatusError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("aliyun rerank API error: Http Status: %s, Body: %s", resp.Status, string(body)),
+		}
 	}
 
 	var response AliyunRerankResponse
 	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+		return nil, nil, fmt.Errorf("unmarshal response: %w", err)
 	}
 
 	// Convert Aliyun results to standard RankResult format
@@ -150,7 +163,10 @@ func (r *AliyunReranker) Rerank(ctx context.Context, query string, documents []s
 		}
 	}
 
-	return results, nil
+	return results, &types.TokenUsage{
+		PromptTokens: response.Usage.TotalTokens,
+		TotalTokens:  response.Usage.TotalTokens,
+	}, nil
 }
 
 // GetModelName returns the name of the reranking model
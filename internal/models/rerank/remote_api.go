@@ -9,6 +9,8 @@ import (
 	"net/http"
 
 	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/models/utils"
+	"github.com/Tencent/WeKnora/internal/types"
 )
 
 // OpenAIReranker implements a reranking system based on OpenAI models
@@ -61,6 +63,14 @@ func NewOpenAIReranker(config *RerankerConfig) (*OpenAIReranker, error) {
 
 // Rerank performs document reranking based on relevance to the query
 func (r *OpenAIReranker) Rerank(ctx context.Context, query string, documents []string) ([]RankResult, error) {
+	results, _, err := r.RerankWithUsage(ctx, query, documents)
+	return results, err
+}
+
+// RerankWithUsage performs document reranking and reports the tokens consumed
+func (r *OpenAIReranker) RerankWithUsage(ctx context.Context,
+	query string, documents []string,
+) ([]RankResult, *types.TokenUsage, error) {
 	// Build the request body
 	requestBody := &RerankRequest{
 		Model:                r.modelName,
@@ -71,13 +81,13 @@ func (r *OpenAIReranker) Rerank(ctx context.Context, query string, documents []s
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		return nil, fmt.Errorf("marshal request body: %w", err)
+		return nil, nil, fmt.Errorf("marshal request body: %w", err)
 	}
 
 	// Send the request
 	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/rerank", r.baseURL), bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, nil, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.apiKey))
@@ -90,25 +100,31 @@ func (r *OpenAIReranker) Rerank(ctx context.Context, query string, documents []s
 
 	resp, err := r.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		return nil, nil, fmt.Errorf("do request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Read the response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("read response body: %w", err)
+		return nil, nil, fmt.Errorf("read response body: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Rerank API error: Http Status: %s", resp.Status)
+		return nil, nil, &utils.HTTPStatusError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("Rerank API error: Http Status: %s", resp.Status),
+		}
 	}
 
 	var response RerankResponse
 	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+		return nil, nil, fmt.Errorf("unmarshal response: %w", err)
 	}
-	return response.Results, nil
+	return response.Results, &types.TokenUsage{
+		PromptTokens: response.Usage.TotalTokens,
+		TotalTokens:  response.Usage.TotalTokens,
+	}, nil
 }
 
 // GetModelName returns the name of the reranking model
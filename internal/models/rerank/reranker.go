@@ -14,6 +14,9 @@ type Reranker interface {
 	// Rerank reranks documents based on relevance to the query
 	Rerank(ctx context.Context, query string, documents []string) ([]RankResult, error)
 
+	// RerankWithUsage reranks documents based on relevance to the query and reports the tokens consumed
+	RerankWithUsage(ctx context.Context, query string, documents []string) ([]RankResult, *types.TokenUsage, error)
+
 	// GetModelName returns the model name
 	GetModelName() string
 
@@ -0,0 +1,53 @@
+package route
+
+import (
+	"context"
+
+	"github.com/Tencent/WeKnora/internal/models/chat"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// Chat is a chat model route
+type Chat struct {
+	model   *types.Model
+	router  *Router
+	clients map[string]chat.Chat
+}
+
+// NewChat creates a chat model route over the clients of its models, keyed by model ID
+func NewChat(model *types.Model, router *Router, clients map[string]chat.Chat) *Chat {
+	return &Chat{model: model, router: router, clients: clients}
+}
+
+// Chat calls the models of the route until one responds
+func (c *Chat) Chat(ctx context.Context,
+	messages []chat.Message, opts *chat.ChatOptions,
+) (*types.ChatResponse, error) {
+	return call(ctx, c.router, c.model.ID, c.model.Parameters.Route, c.clients,
+		func(client chat.Chat) (*types.ChatResponse, error) {
+			return client.Chat(ctx, messages, opts)
+		},
+	)
+}
+
+// ChatStream calls the models of the route until one starts a stream,
+// a stream that fails once started is not resumed on another model
+func (c *Chat) ChatStream(ctx context.Context,
+	messages []chat.Message, opts *chat.ChatOptions,
+) (<-chan types.StreamResponse, error) {
+	return call(ctx, c.router, c.model.ID, c.model.Parameters.Route, c.clients,
+		func(client chat.Chat) (<-chan types.StreamResponse, error) {
+			return client.ChatStream(ctx, messages, opts)
+		},
+	)
+}
+
+// GetModelName returns the name of the route
+func (c *Chat) GetModelName() string {
+	return c.model.Name
+}
+
+// GetModelID returns the ID of the route
+func (c *Chat) GetModelID() string {
+	return c.model.ID
+}
@@ -0,0 +1,93 @@
+package route
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Tencent/WeKnora/internal/models/embedding"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// Embedder is an embedding model route, all its models have the dimensions of the route
+type Embedder struct {
+	model   *types.Model
+	router  *Router
+	clients map[string]embedding.Embedder
+}
+
+// NewEmbedder creates an embedding model route over the clients of its models, keyed by model ID.
+// Vectors of models with other dimensions than the route cannot share an index, such models are refused
+func NewEmbedder(model *types.Model, router *Router, clients map[string]embedding.Embedder) (*Embedder, error) {
+	if len(clients) == 0 {
+		return nil, ErrNoTarget
+	}
+	for modelID, client := range clients {
+		if client.GetDimensions() != model.Parameters.EmbeddingParameters.Dimension {
+			return nil, fmt.Errorf("model %s has %d dimensions, route %s has %d",
+				modelID, client.GetDimensions(), model.ID, model.Parameters.EmbeddingParameters.Dimension)
+		}
+	}
+	return &Embedder{model: model, router: router, clients: clients}, nil
+}
+
+// Embed converts text to vector
+func (e *Embedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	return call(ctx, e.router, e.model.ID, e.model.Parameters.Route, e.clients,
+		func(client embedding.Embedder) ([]float32, error) {
+			return client.Embed(ctx, text)
+		},
+	)
+}
+
+// BatchEmbed converts multiple texts to vectors in batch
+func (e *Embedder) BatchEmbed(ctx context.Context, texts []string) ([][]float32, error) {
+	return call(ctx, e.router, e.model.ID, e.model.Parameters.Route, e.clients,
+		func(client embedding.Embedder) ([][]float32, error) {
+			return client.BatchEmbed(ctx, texts)
+		},
+	)
+}
+
+// embedResult is the result of a batch embedding with its usage
+type embedResult struct {
+	embeddings [][]float32
+	usage      *types.TokenUsage
+}
+
+// BatchEmbedWithUsage converts multiple texts to vectors in batch and reports the tokens consumed
+func (e *Embedder) BatchEmbedWithUsage(ctx context.Context,
+	texts []string,
+) ([][]float32, *types.TokenUsage, error) {
+	result, err := call(ctx, e.router, e.model.ID, e.model.Parameters.Route, e.clients,
+		func(client embedding.Embedder) (embedResult, error) {
+			embeddings, usage, err := client.BatchEmbedWithUsage(ctx, texts)
+			return embedResult{embeddings: embeddings, usage: usage}, err
+		},
+	)
+	return result.embeddings, result.usage, err
+}
+
+// BatchEmbedWithPool embeds the texts in concurrent batches, each batch is routed on its own
+func (e *Embedder) BatchEmbedWithPool(ctx context.Context,
+	model embedding.Embedder, texts []string,
+) ([][]float32, error) {
+	for _, client := range e.clients {
+		return client.BatchEmbedWithPool(ctx, model, texts)
+	}
+	return nil, ErrNoTarget
+}
+
+// GetModelName returns the name of the route
+func (e *Embedder) GetModelName() string {
+	return e.model.Name
+}
+
+// GetDimensions returns the vector dimensions
+func (e *Embedder) GetDimensions() int {
+	return e.model.Parameters.EmbeddingParameters.Dimension
+}
+
+// GetModelID returns the ID of the route
+func (e *Embedder) GetModelID() string {
+	return e.model.ID
+}
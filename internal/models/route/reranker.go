@@ -0,0 +1,58 @@
+package route
+
+import (
+	"context"
+
+	"github.com/Tencent/WeKnora/internal/models/rerank"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// Reranker is a rerank model route
+type Reranker struct {
+	model   *types.Model
+	router  *Router
+	clients map[string]rerank.Reranker
+}
+
+// NewReranker creates a rerank model route over the clients of its models, keyed by model ID
+func NewReranker(model *types.Model, router *Router, clients map[string]rerank.Reranker) *Reranker {
+	return &Reranker{model: model, router: router, clients: clients}
+}
+
+// Rerank reranks documents based on relevance to the query
+func (r *Reranker) Rerank(ctx context.Context, query string, documents []string) ([]rerank.RankResult, error) {
+	return call(ctx, r.router, r.model.ID, r.model.Parameters.Route, r.clients,
+		func(client rerank.Reranker) ([]rerank.RankResult, error) {
+			return client.Rerank(ctx, query, documents)
+		},
+	)
+}
+
+// rerankResult is the result of a rerank with its usage
+type rerankResult struct {
+	results []rerank.RankResult
+	usage   *types.TokenUsage
+}
+
+// RerankWithUsage reranks documents based on relevance to the query and reports the tokens consumed
+func (r *Reranker) RerankWithUsage(ctx context.Context,
+	query string, documents []string,
+) ([]rerank.RankResult, *types.TokenUsage, error) {
+	result, err := call(ctx, r.router, r.model.ID, r.model.Parameters.Route, r.clients,
+		func(client rerank.Reranker) (rerankResult, error) {
+			results, usage, err := client.RerankWithUsage(ctx, query, documents)
+			return rerankResult{results: results, usage: usage}, err
+		},
+	)
+	return result.results, result.usage, err
+}
+
+// GetModelName returns the name of the route
+func (r *Reranker) GetModelName() string {
+	return r.model.Name
+}
+
+// GetModelID returns the ID of the route
+func (r *Reranker) GetModelID() string {
+	return r.model.ID
+}
@@ -0,0 +1,247 @@
+// Package route implements model routes, which group several models of the same type behind the
+// chat, embedding and rerank interfaces. A call is served by one model of the route and falls back
+// to the next one on errors of the endpoint, models that keep failing are skipped for a while
+package route
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/models/utils"
+	"github.com/Tencent/WeKnora/internal/types"
+	ollamaapi "github.com/ollama/ollama/api"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultFailureThreshold is the number of consecutive failures after which a model is skipped
+	DefaultFailureThreshold = 3
+	// DefaultOpenDuration is how long a failing model is skipped before it is probed again
+	DefaultOpenDuration = 30 * time.Second
+)
+
+// ErrNoTarget is returned when a route has no model to call
+var ErrNoTarget = errors.New("model route has no available model")
+
+// breaker tracks the health of a model, it opens after consecutive failures and lets a single
+// probe call through once it has been open for the open duration
+type breaker struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// Router keeps the health of the models and the round-robin state of the routes across calls,
+// it is shared by all the route clients of the process
+type Router struct {
+	mu               sync.Mutex
+	failureThreshold int
+	openDuration     time.Duration
+	breakers         map[string]*breaker
+	weights          map[string]map[string]int
+	now              func() time.Time
+}
+
+// NewRouter creates a router, zero values use the default failure threshold and open duration
+func NewRouter(failureThreshold int, openDuration time.Duration) *Router {
+	if failureThreshold <= 0 {
+		failureThreshold = DefaultFailureThreshold
+	}
+	if openDuration <= 0 {
+		openDuration = DefaultOpenDuration
+	}
+	return &Router{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		breakers:         make(map[string]*breaker),
+		weights:          make(map[string]map[string]int),
+		now:              time.Now,
+	}
+}
+
+// healthy returns whether a model can be called, the lock must be held
+func (r *Router) healthy(modelID string) bool {
+	b, ok := r.breakers[modelID]
+	if !ok || b.failures < r.failureThreshold {
+		return true
+	}
+	return !b.probing && !r.now().Before(b.openUntil)
+}
+
+// begin marks the start of a call to a model, the call of an open model is its probe
+func (r *Router) begin(modelID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, ok := r.breakers[modelID]; ok && b.failures >= r.failureThreshold {
+		b.probing = true
+	}
+}
+
+// succeed closes the breaker of a model after a successful call
+func (r *Router) succeed(modelID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.breakers, modelID)
+}
+
+// fail counts a failed call of a model and opens its breaker at the failure threshold
+func (r *Router) fail(modelID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.breakers[modelID]
+	if !ok {
+		b = &breaker{}
+		r.breakers[modelID] = b
+	}
+	b.failures++
+	b.probing = false
+	if b.failures >= r.failureThreshold {
+		b.openUntil = r.now().Add(r.openDuration)
+	}
+}
+
+// abandon ends a call of a model that tells nothing about its health
+func (r *Router) abandon(modelID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, ok := r.breakers[modelID]; ok {
+		b.probing = false
+	}
+}
+
+// order returns the targets of a route in the order a call tries them. Healthy models come first,
+// in the order of the strategy, models with an open breaker are only tried as a last resort
+func (r *Router) order(routeID string, route *types.ModelRoute) []types.ModelRouteTarget {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	targets := slices.Clone(route.Targets)
+	slices.SortStableFunc(targets, func(a, b types.ModelRouteTarget) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+	healthy := make([]types.ModelRouteTarget, 0, len(targets))
+	unhealthy := make([]types.ModelRouteTarget, 0)
+	for _, target := range targets {
+		if r.healthy(target.ModelID) {
+			healthy = append(healthy, target)
+		} else {
+			unhealthy = append(unhealthy, target)
+		}
+	}
+
+	if route.Strategy == types.ModelRouteStrategyWeighted && len(healthy) > 1 {
+		picked := healthy[r.pick(routeID, healthy)]
+		healthy = slices.DeleteFunc(healthy, func(target types.ModelRouteTarget) bool {
+			return target.ModelID == picked.ModelID
+		})
+		healthy = append([]types.ModelRouteTarget{picked}, healthy...)
+	}
+	return append(healthy, unhealthy...)
+}
+
+// pick returns the index of the next target of a route by smooth weighted round-robin,
+// the lock must be held
+func (r *Router) pick(routeID string, targets []types.ModelRouteTarget) int {
+	current, ok := r.weights[routeID]
+	if !ok {
+		current = make(map[string]int)
+		r.weights[routeID] = current
+	}
+	picked, total := 0, 0
+	for i, target := range targets {
+		weight := max(target.Weight, 1)
+		total += weight
+		current[target.ModelID] += weight
+		if current[target.ModelID] > current[targets[picked].ModelID] {
+			picked = i
+		}
+	}
+	current[targets[picked].ModelID] -= total
+	return picked
+}
+
+// call calls the models of a route in order until one succeeds. It falls back to the next model
+// on errors that another endpoint may not have, other errors are returned at once
+func call[C any, R any](ctx context.Context, router *Router, routeID string, route *types.ModelRoute,
+	clients map[string]C, fn func(client C) (R, error),
+) (R, error) {
+	var zero R
+	maxAttempts := route.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = len(route.Targets)
+	}
+
+	lastErr := ErrNoTarget
+	attempts := 0
+	for _, target := range router.order(routeID, route) {
+		client, ok := clients[target.ModelID]
+		if !ok {
+			continue
+		}
+		if attempts >= maxAttempts {
+			break
+		}
+		attempts++
+
+		router.begin(target.ModelID)
+		result, err := fn(client)
+		if err == nil {
+			router.succeed(target.ModelID)
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			router.abandon(target.ModelID)
+			return zero, err
+		}
+		if !IsRetryable(err) {
+			// The endpoint answered, the request itself is at fault
+			router.succeed(target.ModelID)
+			return zero, err
+		}
+		router.fail(target.ModelID)
+		logger.Warnf(ctx, "Model %s of route %s failed, falling back: %v", target.ModelID, routeID, err)
+		lastErr = fmt.Errorf("model %s: %w", target.ModelID, err)
+	}
+	return zero, lastErr
+}
+
+// IsRetryable returns whether an error of a model call may not happen on another endpoint:
+// server errors, rate limiting, timeouts and connection failures
+func IsRetryable(err error) bool {
+	var statusErr *utils.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return isRetryableStatus(statusErr.StatusCode)
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return isRetryableStatus(apiErr.HTTPStatusCode)
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return isRetryableStatus(requestErr.HTTPStatusCode)
+	}
+	var ollamaErr ollamaapi.StatusError
+	if errors.As(err, &ollamaErr) {
+		return isRetryableStatus(ollamaErr.StatusCode)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isRetryableStatus returns whether an HTTP status is worth a call to another endpoint
+func isRetryableStatus(statusCode int) bool {
+	return statusCode >= http.StatusInternalServerError ||
+		statusCode == http.StatusTooManyRequests ||
+		statusCode == http.StatusRequestTimeout
+}
@@ -0,0 +1,152 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/models/utils"
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+func TestRouterOrderByPriority(t *testing.T) {
+	router := NewRouter(2, time.Minute)
+	route := &types.ModelRoute{
+		Strategy: types.ModelRouteStrategyPriority,
+		Targets: []types.ModelRouteTarget{
+			{ModelID: "backup", Priority: 2},
+			{ModelID: "primary", Priority: 1},
+		},
+	}
+
+	order := router.order("route", route)
+	if order[0].ModelID != "primary" || order[1].ModelID != "backup" {
+		t.Fatalf("Expected the models by ascending priority, got %+v", order)
+	}
+
+	router.fail("primary")
+	if order := router.order("route", route); order[0].ModelID != "primary" {
+		t.Errorf("Expected a model below the failure threshold to keep its place, got %+v", order)
+	}
+	router.fail("primary")
+	if order := router.order("route", route); order[0].ModelID != "backup" || order[1].ModelID != "primary" {
+		t.Errorf("Expected an open model to be tried last, got %+v", order)
+	}
+}
+
+func TestRouterOrderByWeight(t *testing.T) {
+	router := NewRouter(0, 0)
+	route := &types.ModelRoute{
+		Strategy: types.ModelRouteStrategyWeighted,
+		Targets: []types.ModelRouteTarget{
+			{ModelID: "a", Weight: 3},
+			{ModelID: "b", Weight: 1},
+		},
+	}
+
+	picks := make(map[string]int)
+	for range 8 {
+		order := router.order("route", route)
+		if len(order) != 2 {
+			t.Fatalf("Expected every model to be a candidate, got %+v", order)
+		}
+		picks[order[0].ModelID]++
+	}
+	if picks["a"] != 6 || picks["b"] != 2 {
+		t.Errorf("Expected calls spread by weight, got %v", picks)
+	}
+}
+
+func TestRouterBreakerProbe(t *testing.T) {
+	now := time.Date(2025, 8, 12, 10, 0, 0, 0, time.UTC)
+	router := NewRouter(1, 30*time.Second)
+	router.now = func() time.Time { return now }
+
+	router.fail("model")
+	router.mu.Lock()
+	healthy := router.healthy("model")
+	router.mu.Unlock()
+	if healthy {
+		t.Fatal("Expected the model to be skipped once its breaker is open")
+	}
+
+	now = now.Add(31 * time.Second)
+	router.mu.Lock()
+	healthy = router.healthy("model")
+	router.mu.Unlock()
+	if !healthy {
+		t.Fatal("Expected the model to be probed once the open duration has passed")
+	}
+
+	router.begin("model")
+	router.mu.Lock()
+	healthy = router.healthy("model")
+	router.mu.Unlock()
+	if healthy {
+		t.Error("Expected a single probe at a time")
+	}
+
+	router.succeed("model")
+	router.mu.Lock()
+	healthy = router.healthy("model")
+	router.mu.Unlock()
+	if !healthy {
+		t.Error("Expected a successful probe to close the breaker")
+	}
+}
+
+func TestCallFallback(t *testing.T) {
+	route := &types.ModelRoute{
+		Targets: []types.ModelRouteTarget{
+			{ModelID: "primary", Priority: 1},
+			{ModelID: "backup", Priority: 2},
+		},
+	}
+	clients := map[string]error{
+		"primary": &utils.HTTPStatusError{StatusCode: 503, Message: "unavailable"},
+		"backup":  nil,
+	}
+	router := NewRouter(0, 0)
+
+	var called []string
+	result, err := call(context.Background(), router, "route", route, clients, func(clientErr error) (string, error) {
+		called = append(called, fmt.Sprint(clientErr))
+		if clientErr != nil {
+			return "", clientErr
+		}
+		return "ok", nil
+	})
+	if err != nil || result != "ok" || len(called) != 2 {
+		t.Fatalf("Expected the backup model to serve the call, got %q, %v after %v", result, err, called)
+	}
+
+	clients["primary"] = &utils.HTTPStatusError{StatusCode: 400, Message: "bad request"}
+	called = nil
+	_, err = call(context.Background(), router, "route", route, clients, func(clientErr error) (string, error) {
+		called = append(called, fmt.Sprint(clientErr))
+		return "", clientErr
+	})
+	if err == nil || len(called) != 1 {
+		t.Errorf("Expected a client error to be returned without fallback, got %v after %v", err, called)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{&utils.HTTPStatusError{StatusCode: 502}, true},
+		{&utils.HTTPStatusError{StatusCode: 429}, true},
+		{&utils.HTTPStatusError{StatusCode: 401}, false},
+		{fmt.Errorf("send request: %w", context.DeadlineExceeded), true},
+		{errors.New("no embedding returned"), false},
+	}
+	for _, tt := range tests {
+		if retryable := IsRetryable(tt.err); retryable != tt.retryable {
+			t.Errorf("Expected retryable %v for %v, got %v", tt.retryable, tt.err, retryable)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package utils
+
+// HTTPStatusError is returned when a model endpoint answers with an unsuccessful HTTP status
+type HTTPStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error implements the error interface
+func (e *HTTPStatusError) Error() string {
+	return e.Message
+}
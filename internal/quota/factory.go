@@ -0,0 +1,27 @@
+package quota
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/Tencent/WeKnora/internal/config"
+	"github.com/Tencent/WeKnora/internal/types/interfaces"
+)
+
+// NewQuotaLimiter 创建租户限流器，未启用限流时不限制任何请求
+func NewQuotaLimiter(cfg *config.Config) (interfaces.QuotaLimiter, error) {
+	if cfg.RateLimit == nil || !cfg.RateLimit.Enabled {
+		return NewNoopQuotaLimiter(), nil
+	}
+	db, err := strconv.Atoi(os.Getenv("REDIS_DB"))
+	if err != nil {
+		db = 0
+	}
+	return NewRedisQuotaLimiter(
+		os.Getenv("REDIS_ADDR"),
+		os.Getenv("REDIS_PASSWORD"),
+		db,
+		cfg.RateLimit.Prefix,
+		cfg.RateLimit.Default,
+	)
+}
@@ -0,0 +1,41 @@
+package quota
+
+import (
+	"context"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// NoopQuotaLimiter 不做任何限制的限流器，用于未启用限流的情况
+type NoopQuotaLimiter struct{}
+
+// NewNoopQuotaLimiter 创建一个不做任何限制的限流器
+func NewNoopQuotaLimiter() *NoopQuotaLimiter {
+	return &NoopQuotaLimiter{}
+}
+
+// AllowRequest 允许所有请求
+func (l *NoopQuotaLimiter) AllowRequest(ctx context.Context) *types.QuotaDecision {
+	return types.UnlimitedQuota()
+}
+
+// AllowDocument 允许导入所有文档
+func (l *NoopQuotaLimiter) AllowDocument(ctx context.Context) *types.QuotaDecision {
+	return types.UnlimitedQuota()
+}
+
+// AcquireStream 允许所有对话流
+func (l *NoopQuotaLimiter) AcquireStream(ctx context.Context, streamID string) *types.QuotaDecision {
+	return types.UnlimitedQuota()
+}
+
+// ReleaseStream 无需释放
+func (l *NoopQuotaLimiter) ReleaseStream(ctx context.Context, streamID string) {}
+
+// CheckTokens 不限制 token 用量
+func (l *NoopQuotaLimiter) CheckTokens(ctx context.Context) *types.QuotaDecision {
+	return types.UnlimitedQuota()
+}
+
+// ConsumeTokens 不记录 token 用量
+func (l *NoopQuotaLimiter) ConsumeTokens(ctx context.Context, tokens int) {}
@@ -0,0 +1,214 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/logger"
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// streamTTL 对话流占用名额的最长时间，避免副本异常退出后名额无法释放
+	streamTTL = 30 * time.Minute
+	// streamRetryAfter 对话流名额已满时建议的重试间隔
+	streamRetryAfter = 5 * time.Second
+)
+
+// RedisQuotaLimiter 基于Redis的租户限流器实现，计数在多个副本之间共享。
+// 每分钟请求数和每小时文档数使用固定窗口计数，token 配额按自然日计数，
+// 并发对话流使用有序集合记录正在进行的流。Redis 不可用时放行请求
+type RedisQuotaLimiter struct {
+	client   *redis.Client
+	prefix   string                 // Redis键前缀
+	defaults types.TenantRateLimits // 租户未单独配置时的默认限额
+}
+
+// NewRedisQuotaLimiter 创建一个新的Redis租户限流器
+func NewRedisQuotaLimiter(redisAddr, redisPassword string,
+	redisDB int, prefix string, defaults types.TenantRateLimits,
+) (*RedisQuotaLimiter, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     redisAddr,
+		Password: redisPassword,
+		DB:       redisDB,
+	})
+
+	// 验证连接
+	_, err := client.Ping(context.Background()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("连接Redis失败: %w", err)
+	}
+
+	if prefix == "" {
+		prefix = "quota:" // 默认前缀
+	}
+
+	return &RedisQuotaLimiter{
+		client:   client,
+		prefix:   prefix,
+		defaults: defaults,
+	}, nil
+}
+
+// limits 返回上下文中租户的ID和限额，租户配置了 rate_limits 时整体覆盖默认限额
+func (l *RedisQuotaLimiter) limits(ctx context.Context) (uint, types.TenantRateLimits, bool) {
+	tenantID, ok := ctx.Value(types.TenantIDContextKey).(uint)
+	if !ok {
+		return 0, types.TenantRateLimits{}, false
+	}
+	limits := l.defaults
+	if tenant, ok := ctx.Value(types.TenantInfoContextKey).(*types.Tenant); ok && tenant != nil && tenant.RateLimits != nil {
+		limits = *tenant.RateLimits
+	}
+	return tenantID, limits, true
+}
+
+// key 构建租户计数的Redis键
+func (l *RedisQuotaLimiter) key(tenantID uint, name string, window string) string {
+	if window == "" {
+		return fmt.Sprintf("%s%d:%s", l.prefix, tenantID, name)
+	}
+	return fmt.Sprintf("%s%d:%s:%s", l.prefix, tenantID, name, window)
+}
+
+// AllowRequest 按每分钟请求数限制请求
+func (l *RedisQuotaLimiter) AllowRequest(ctx context.Context) *types.QuotaDecision {
+	tenantID, limits, ok := l.limits(ctx)
+	if !ok {
+		return types.UnlimitedQuota()
+	}
+	return l.countWindow(ctx, tenantID, "rpm", limits.RequestsPerMinute, time.Minute)
+}
+
+// AllowDocument 按每小时文档数限制文档导入
+func (l *RedisQuotaLimiter) AllowDocument(ctx context.Context) *types.QuotaDecision {
+	tenantID, limits, ok := l.limits(ctx)
+	if !ok {
+		return types.UnlimitedQuota()
+	}
+	return l.countWindow(ctx, tenantID, "documents", limits.DocumentsPerHour, time.Hour)
+}
+
+// countWindow 在固定窗口内计数一次，计数超过限额时拒绝
+func (l *RedisQuotaLimiter) countWindow(ctx context.Context,
+	tenantID uint, name string, limit int64, size time.Duration,
+) *types.QuotaDecision {
+	if limit <= 0 {
+		return types.UnlimitedQuota()
+	}
+	start, reset := fixedWindow(time.Now(), size)
+	key := l.key(tenantID, name, strconv.FormatInt(start.Unix(), 10))
+
+	pipe := l.client.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.ExpireAt(ctx, key, reset.Add(time.Minute))
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Errorf(ctx, "Failed to count %s of tenant %d, request allowed: %v", name, tenantID, err)
+		return types.UnlimitedQuota()
+	}
+	return newDecision(limit, count.Val(), reset)
+}
+
+// AcquireStream 占用一个并发对话流名额，名额已满时拒绝
+func (l *RedisQuotaLimiter) AcquireStream(ctx context.Context, streamID string) *types.QuotaDecision {
+	tenantID, limits, ok := l.limits(ctx)
+	if !ok || limits.ConcurrentStreams <= 0 {
+		return types.UnlimitedQuota()
+	}
+	now := time.Now()
+	key := l.key(tenantID, "streams", "")
+
+	pipe := l.client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Add(-streamTTL).Unix(), 10))
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Unix()), Member: streamID})
+	count := pipe.ZCard(ctx, key)
+	pipe.Expire(ctx, key, streamTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Errorf(ctx, "Failed to acquire stream of tenant %d, request allowed: %v", tenantID, err)
+		return types.UnlimitedQuota()
+	}
+
+	decision := newDecision(limits.ConcurrentStreams, count.Val(), now.Add(streamRetryAfter))
+	if !decision.Allowed {
+		l.ReleaseStream(ctx, streamID)
+	}
+	return decision
+}
+
+// ReleaseStream 释放对话流占用的名额
+func (l *RedisQuotaLimiter) ReleaseStream(ctx context.Context, streamID string) {
+	tenantID, limits, ok := l.limits(ctx)
+	if !ok || limits.ConcurrentStreams <= 0 {
+		return
+	}
+	// 请求结束后上下文可能已取消，名额仍需释放
+	if err := l.client.ZRem(context.WithoutCancel(ctx), l.key(tenantID, "streams", ""), streamID).Err(); err != nil {
+		logger.Errorf(ctx, "Failed to release stream of tenant %d: %v", tenantID, err)
+	}
+}
+
+// CheckTokens 检查当天剩余的 token 配额，配额用尽时拒绝
+func (l *RedisQuotaLimiter) CheckTokens(ctx context.Context) *types.QuotaDecision {
+	tenantID, limits, ok := l.limits(ctx)
+	if !ok || limits.TokensPerDay <= 0 {
+		return types.UnlimitedQuota()
+	}
+	start, reset := dayWindow(time.Now())
+	used, err := l.client.Get(ctx, l.key(tenantID, "tokens", start.Format("20060102"))).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		logger.Errorf(ctx, "Failed to get tokens of tenant %d, request allowed: %v", tenantID, err)
+		return types.UnlimitedQuota()
+	}
+	return &types.QuotaDecision{
+		Allowed:   used < limits.TokensPerDay,
+		Limit:     limits.TokensPerDay,
+		Remaining: max(limits.TokensPerDay-used, 0),
+		ResetAt:   reset,
+	}
+}
+
+// ConsumeTokens 记录模型调用消耗的 token
+func (l *RedisQuotaLimiter) ConsumeTokens(ctx context.Context, tokens int) {
+	tenantID, limits, ok := l.limits(ctx)
+	if !ok || limits.TokensPerDay <= 0 || tokens <= 0 {
+		return
+	}
+	start, reset := dayWindow(time.Now())
+	key := l.key(tenantID, "tokens", start.Format("20060102"))
+
+	// 模型调用已完成，即使请求已取消也需要记录
+	ctx = context.WithoutCancel(ctx)
+	pipe := l.client.TxPipeline()
+	pipe.IncrBy(ctx, key, int64(tokens))
+	pipe.ExpireAt(ctx, key, reset.Add(time.Hour))
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Errorf(ctx, "Failed to consume %d tokens of tenant %d: %v", tokens, tenantID, err)
+	}
+}
+
+// fixedWindow 返回时间所在固定窗口的开始和重置时间
+func fixedWindow(now time.Time, size time.Duration) (time.Time, time.Time) {
+	start := now.Truncate(size)
+	return start, start.Add(size)
+}
+
+// dayWindow 返回时间所在自然日的开始和次日零点
+func dayWindow(now time.Time) (time.Time, time.Time) {
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
+// newDecision 根据计入本次请求后的计数生成限流结果
+func newDecision(limit int64, count int64, reset time.Time) *types.QuotaDecision {
+	return &types.QuotaDecision{
+		Allowed:   count <= limit,
+		Limit:     limit,
+		Remaining: max(limit-count, 0),
+		ResetAt:   reset,
+	}
+}
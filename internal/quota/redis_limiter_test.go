@@ -0,0 +1,273 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestFixedWindow(t *testing.T) {
+	now := time.Date(2025, 8, 12, 10, 17, 42, 0, time.UTC)
+	start, reset := fixedWindow(now, time.Minute)
+	if !start.Equal(time.Date(2025, 8, 12, 10, 17, 0, 0, time.UTC)) || !reset.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected the minute window of %s, got %s - %s", now, start, reset)
+	}
+	start, reset = fixedWindow(now, time.Hour)
+	if !start.Equal(time.Date(2025, 8, 12, 10, 0, 0, 0, time.UTC)) || !reset.Equal(start.Add(time.Hour)) {
+		t.Errorf("Expected the hour window of %s, got %s - %s", now, start, reset)
+	}
+}
+
+func TestDayWindow(t *testing.T) {
+	location := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2025, 8, 12, 23, 30, 0, 0, location)
+	start, reset := dayWindow(now)
+	if !start.Equal(time.Date(2025, 8, 12, 0, 0, 0, 0, location)) {
+		t.Errorf("Expected the day to start at local midnight, got %s", start)
+	}
+	if !reset.Equal(time.Date(2025, 8, 13, 0, 0, 0, 0, location)) {
+		t.Errorf("Expected the day to reset at the next local midnight, got %s", reset)
+	}
+}
+
+func TestNewDecision(t *testing.T) {
+	now := time.Date(2025, 8, 12, 10, 17, 42, 0, time.UTC)
+	reset := now.Add(18 * time.Second)
+
+	decision := newDecision(3, 3, reset)
+	if !decision.Allowed || decision.Remaining != 0 {
+		t.Errorf("Expected the last request of the window to be allowed, got %+v", decision)
+	}
+	decision = newDecision(3, 5, reset)
+	if decision.Allowed || decision.Remaining != 0 {
+		t.Errorf("Expected a request over the limit to be rejected, got %+v", decision)
+	}
+	if retryAfter := decision.RetryAfter(now); retryAfter != 18*time.Second {
+		t.Errorf("Expected to retry when the window resets, got %s", retryAfter)
+	}
+	if retryAfter := decision.RetryAfter(reset); retryAfter != time.Second {
+		t.Errorf("Expected to retry after at least a second, got %s", retryAfter)
+	}
+}
+
+// fakeRedis answers the commands of the limiter from memory instead of a Redis server
+type fakeRedis struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	sets     map[string]map[string]float64
+	expires  map[string]bool
+}
+
+func (f *fakeRedis) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (f *fakeRedis) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		return f.process(cmd)
+	}
+}
+
+func (f *fakeRedis) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if err := f.process(cmd); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (f *fakeRedis) process(cmd redis.Cmder) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	args := cmd.Args()
+	arg := func(i int) string { return fmt.Sprint(args[i]) }
+	switch cmd.Name() {
+	case "multi", "exec":
+	case "incr", "incrby":
+		by := int64(1)
+		if cmd.Name() == "incrby" {
+			by, _ = strconv.ParseInt(arg(2), 10, 64)
+		}
+		f.counters[arg(1)] += by
+		cmd.(*redis.IntCmd).SetVal(f.counters[arg(1)])
+	case "get":
+		value, ok := f.counters[arg(1)]
+		if !ok {
+			cmd.SetErr(redis.Nil)
+			return redis.Nil
+		}
+		cmd.(*redis.StringCmd).SetVal(strconv.FormatInt(value, 10))
+	case "expire", "expireat":
+		f.expires[arg(1)] = true
+		cmd.(*redis.BoolCmd).SetVal(true)
+	case "zadd":
+		if f.sets[arg(1)] == nil {
+			f.sets[arg(1)] = make(map[string]float64)
+		}
+		score, _ := strconv.ParseFloat(arg(2), 64)
+		f.sets[arg(1)][arg(3)] = score
+		cmd.(*redis.IntCmd).SetVal(1)
+	case "zcard":
+		cmd.(*redis.IntCmd).SetVal(int64(len(f.sets[arg(1)])))
+	case "zrem":
+		delete(f.sets[arg(1)], arg(2))
+		cmd.(*redis.IntCmd).SetVal(1)
+	case "zremrangebyscore":
+		limit, _ := strconv.ParseFloat(arg(3), 64)
+		for member, score := range f.sets[arg(1)] {
+			if score <= limit {
+				delete(f.sets[arg(1)], member)
+			}
+		}
+		cmd.(*redis.IntCmd).SetVal(0)
+	default:
+		err := fmt.Errorf("unexpected command %s", cmd.Name())
+		cmd.SetErr(err)
+		return err
+	}
+	return nil
+}
+
+// newTestLimiter returns a limiter backed by a fake Redis
+func newTestLimiter(t *testing.T, defaults types.TenantRateLimits) (*RedisQuotaLimiter, *fakeRedis) {
+	t.Helper()
+	fake := &fakeRedis{
+		counters: make(map[string]int64),
+		sets:     make(map[string]map[string]float64),
+		expires:  make(map[string]bool),
+	}
+	client := redis.NewClient(&redis.Options{Addr: "fake:6379"})
+	client.AddHook(fake)
+	t.Cleanup(func() { client.Close() })
+	return &RedisQuotaLimiter{client: client, prefix: "quota:", defaults: defaults}, fake
+}
+
+func tenantContext(tenantID uint, tenant *types.Tenant) context.Context {
+	ctx := context.WithValue(context.Background(), types.TenantIDContextKey, tenantID)
+	return context.WithValue(ctx, types.TenantInfoContextKey, tenant)
+}
+
+func TestRedisQuotaLimiterAllowRequest(t *testing.T) {
+	limiter, fake := newTestLimiter(t, types.TenantRateLimits{RequestsPerMinute: 2})
+	ctx := tenantContext(1, &types.Tenant{ID: 1})
+
+	for i, remaining := range []int64{1, 0} {
+		decision := limiter.AllowRequest(ctx)
+		if !decision.Allowed || decision.Limit != 2 || decision.Remaining != remaining {
+			t.Fatalf("Expected request %d to be allowed with %d remaining, got %+v", i, remaining, decision)
+		}
+	}
+	if decision := limiter.AllowRequest(ctx); decision.Allowed {
+		t.Errorf("Expected the request over the limit to be rejected, got %+v", decision)
+	}
+	if len(fake.expires) != 1 {
+		t.Errorf("Expected the window to expire, got %v", fake.expires)
+	}
+
+	// Other tenants are counted separately and may have their own limits
+	other := tenantContext(2, &types.Tenant{ID: 2, RateLimits: &types.TenantRateLimits{RequestsPerMinute: 5}})
+	if decision := limiter.AllowRequest(other); !decision.Allowed || decision.Remaining != 4 {
+		t.Errorf("Expected the limits of the tenant to apply, got %+v", decision)
+	}
+	unlimited := tenantContext(3, &types.Tenant{ID: 3, RateLimits: &types.TenantRateLimits{}})
+	if decision := limiter.AllowRequest(unlimited); !decision.Allowed || !decision.Unlimited() {
+		t.Errorf("Expected a zero limit not to limit, got %+v", decision)
+	}
+	if decision := limiter.AllowRequest(context.Background()); !decision.Unlimited() {
+		t.Errorf("Expected a request without tenant not to be limited, got %+v", decision)
+	}
+}
+
+func TestRedisQuotaLimiterAllowDocument(t *testing.T) {
+	limiter, _ := newTestLimiter(t, types.TenantRateLimits{DocumentsPerHour: 1})
+	ctx := tenantContext(1, &types.Tenant{ID: 1})
+
+	if decision := limiter.AllowDocument(ctx); !decision.Allowed {
+		t.Fatalf("Expected the first document to be allowed, got %+v", decision)
+	}
+	decision := limiter.AllowDocument(ctx)
+	if decision.Allowed || decision.ResetAt.Sub(time.Now()) > time.Hour {
+		t.Errorf("Expected the second document to be rejected until the hour resets, got %+v", decision)
+	}
+}
+
+func TestRedisQuotaLimiterStreams(t *testing.T) {
+	limiter, fake := newTestLimiter(t, types.TenantRateLimits{ConcurrentStreams: 2})
+	ctx := tenantContext(1, &types.Tenant{ID: 1})
+
+	for _, streamID := range []string{"s1", "s2"} {
+		if decision := limiter.AcquireStream(ctx, streamID); !decision.Allowed {
+			t.Fatalf("Expected stream %s to be allowed, got %+v", streamID, decision)
+		}
+	}
+	decision := limiter.AcquireStream(ctx, "s3")
+	if decision.Allowed || decision.RetryAfter(time.Now()) != streamRetryAfter {
+		t.Errorf("Expected the third stream to be rejected, got %+v", decision)
+	}
+	if streams := fake.sets["quota:1:streams"]; len(streams) != 2 {
+		t.Errorf("Expected the rejected stream not to hold a slot, got %v", streams)
+	}
+
+	limiter.ReleaseStream(ctx, "s1")
+	if decision := limiter.AcquireStream(ctx, "s3"); !decision.Allowed || decision.Remaining != 0 {
+		t.Errorf("Expected the released slot to be reused, got %+v", decision)
+	}
+
+	// Streams left over by a replica that exited are expired
+	fake.sets["quota:1:streams"]["s2"] = float64(time.Now().Add(-streamTTL - time.Minute).Unix())
+	if decision := limiter.AcquireStream(ctx, "s4"); !decision.Allowed {
+		t.Errorf("Expected the expired stream to be dropped, got %+v", decision)
+	}
+}
+
+func TestRedisQuotaLimiterTokens(t *testing.T) {
+	limiter, _ := newTestLimiter(t, types.TenantRateLimits{TokensPerDay: 100})
+	ctx := tenantContext(1, &types.Tenant{ID: 1})
+
+	if decision := limiter.CheckTokens(ctx); !decision.Allowed || decision.Remaining != 100 {
+		t.Fatalf("Expected the full quota, got %+v", decision)
+	}
+	limiter.ConsumeTokens(ctx, 60)
+	if decision := limiter.CheckTokens(ctx); !decision.Allowed || decision.Remaining != 40 {
+		t.Errorf("Expected 40 tokens left, got %+v", decision)
+	}
+	// The call that crosses the quota completes, the next one is rejected
+	limiter.ConsumeTokens(ctx, 50)
+	decision := limiter.CheckTokens(ctx)
+	if decision.Allowed || decision.Remaining != 0 {
+		t.Errorf("Expected the quota to be exhausted, got %+v", decision)
+	}
+	if _, reset := dayWindow(time.Now()); !decision.ResetAt.Equal(reset) {
+		t.Errorf("Expected the quota to reset at midnight, got %s", decision.ResetAt)
+	}
+}
+
+func TestRedisQuotaLimiterUnavailable(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: time.Second})
+	defer client.Close()
+	limiter := &RedisQuotaLimiter{client: client, prefix: "quota:", defaults: types.TenantRateLimits{
+		RequestsPerMinute: 1, ConcurrentStreams: 1, TokensPerDay: 1, DocumentsPerHour: 1,
+	}}
+	ctx := tenantContext(1, &types.Tenant{ID: 1})
+
+	// Requests are allowed when the counts can not be read
+	for name, decision := range map[string]*types.QuotaDecision{
+		"request":  limiter.AllowRequest(ctx),
+		"document": limiter.AllowDocument(ctx),
+		"stream":   limiter.AcquireStream(ctx, "s1"),
+		"tokens":   limiter.CheckTokens(ctx),
+	} {
+		if !decision.Allowed {
+			t.Errorf("Expected the %s to be allowed, got %+v", name, decision)
+		}
+	}
+}
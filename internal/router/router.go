@@ -35,9 +35,14 @@ type RouterParams struct {
 	MessageHandler        *handler.MessageHandler
 	ModelHandler          *handler.ModelHandler
 	EvaluationHandler     *handler.EvaluationHandler
+	DatasetHandler        *handler.DatasetHandler
+	GraphHandler          *handler.GraphHandler
 	AuthHandler           *handler.AuthHandler
 	InitializationHandler *handler.InitializationHandler
 	SystemHandler         *handler.SystemHandler
+	OpenAIHandler         *handler.OpenAIHandler
+	UsageHandler          *handler.UsageHandler
+	QuotaLimiter          interfaces.QuotaLimiter
 }
 
 // NewRouter 创建新的路由
@@ -49,7 +54,7 @@ func NewRouter(params RouterParams) *gin.Engine {
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Request-ID"},
-		ExposeHeaders:    []string{"Content-Length", "Access-Control-Allow-Origin"},
+		ExposeHeaders:    []string{"Content-Length", "Access-Control-Allow-Origin", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Quota-Tokens-Remaining", "X-Quota-Documents-Remaining", "X-Quota-Streams-Remaining"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -60,6 +65,8 @@ func NewRouter(params RouterParams) *gin.Engine {
 	r.Use(middleware.Recovery())
 	r.Use(middleware.ErrorHandler())
 	r.Use(middleware.Auth(params.TenantService, params.UserService, params.Config))
+	// 租户限流中间件，依赖认证中间件设置的租户信息
+	r.Use(middleware.RateLimit(params.QuotaLimiter))
 
 	// 添加OpenTelemetry追踪中间件
 	r.Use(middleware.TracingMiddleware())
@@ -82,8 +89,12 @@ func NewRouter(params RouterParams) *gin.Engine {
 		RegisterMessageRoutes(v1, params.MessageHandler)
 		RegisterModelRoutes(v1, params.ModelHandler)
 		RegisterEvaluationRoutes(v1, params.EvaluationHandler)
+		RegisterDatasetRoutes(v1, params.DatasetHandler)
+		RegisterGraphRoutes(v1, params.GraphHandler)
 		RegisterInitializationRoutes(v1, params.InitializationHandler)
 		RegisterSystemRoutes(v1, params.SystemHandler)
+		RegisterOpenAIRoutes(v1, params.OpenAIHandler)
+		RegisterUsageRoutes(v1, params.UsageHandler)
 	}
 
 	return r
@@ -129,6 +140,10 @@ func RegisterKnowledgeRoutes(r *gin.RouterGroup, handler *handler.KnowledgeHandl
 		k.DELETE("/:id", handler.DeleteKnowledge)
 		// 更新知识
 		k.PUT("/:id", handler.UpdateKnowledge)
+		// 替换知识文件，仅重新嵌入内容变化的分块
+		k.PUT("/:id/file", handler.ReplaceKnowledgeFile)
+		// 设置URL知识的定时刷新间隔
+		k.PUT("/:id/refresh-schedule", handler.SetKnowledgeRefreshInterval)
 		// 获取知识文件
 		k.GET("/:id/download", handler.DownloadKnowledgeFile)
 		// 更新图像分块信息
@@ -155,6 +170,12 @@ func RegisterKnowledgeBaseRoutes(r *gin.RouterGroup, handler *handler.KnowledgeB
 		kb.GET("/:id/hybrid-search", handler.HybridSearch)
 		// 拷贝知识库
 		kb.POST("/copy", handler.CopyKnowledgeBase)
+		// 切换嵌入模型
+		kb.PUT("/:id/embedding-model", handler.SetEmbeddingModel)
+		// 获取重新嵌入任务进度
+		kb.GET("/:id/reindex-jobs/:job_id", handler.GetReindexJob)
+		// 取消重新嵌入任务
+		kb.POST("/:id/reindex-jobs/:job_id/cancel", handler.CancelReindexJob)
 	}
 }
 
@@ -185,6 +206,12 @@ func RegisterSessionRoutes(r *gin.RouterGroup, handler *handler.SessionHandler)
 	}
 }
 
+// RegisterOpenAIRoutes 注册OpenAI兼容接口的路由
+func RegisterOpenAIRoutes(r *gin.RouterGroup, handler *handler.OpenAIHandler) {
+	// OpenAI兼容的对话补全，model为会话ID或知识库ID
+	r.POST("/chat/completions", handler.ChatCompletions)
+}
+
 // RegisterChatRoutes 注册路由
 func RegisterChatRoutes(r *gin.RouterGroup, handler *handler.SessionHandler) {
 	knowledgeChat := r.Group("/knowledge-chat")
@@ -235,6 +262,38 @@ func RegisterEvaluationRoutes(r *gin.RouterGroup, handler *handler.EvaluationHan
 	{
 		evaluationRoutes.POST("/", handler.Evaluation)
 		evaluationRoutes.GET("/", handler.GetEvaluationResult)
+		// 获取历史评估任务列表
+		evaluationRoutes.GET("/runs", handler.ListEvaluations)
+		// 对比两次评估任务的指标
+		evaluationRoutes.GET("/compare", handler.CompareEvaluations)
+	}
+}
+
+// RegisterDatasetRoutes 注册评估数据集相关的路由
+func RegisterDatasetRoutes(r *gin.RouterGroup, handler *handler.DatasetHandler) {
+	datasets := r.Group("/datasets")
+	{
+		// 上传评估数据集
+		datasets.POST("", handler.CreateDataset)
+		// 获取评估数据集列表
+		datasets.GET("", handler.ListDatasets)
+		// 删除评估数据集
+		datasets.DELETE("/:id", handler.DeleteDataset)
+	}
+}
+
+// RegisterGraphRoutes 注册知识图谱相关的路由
+func RegisterGraphRoutes(r *gin.RouterGroup, handler *handler.GraphHandler) {
+	graph := r.Group("/knowledge-bases/:id/graph")
+	{
+		// 获取知识图谱实体列表
+		graph.GET("/entities", handler.ListEntities)
+		// 获取实体的邻居子图
+		graph.GET("/entities/:entity_id/neighbors", handler.GetNeighbors)
+		// 查找两个实体之间的最短路径
+		graph.GET("/path", handler.FindPath)
+		// 导出知识图谱
+		graph.GET("/export", handler.ExportGraph)
 	}
 }
 
@@ -280,3 +339,12 @@ func RegisterSystemRoutes(r *gin.RouterGroup, handler *handler.SystemHandler) {
 		systemRoutes.GET("/info", handler.GetSystemInfo)
 	}
 }
+
+// RegisterUsageRoutes 注册 token 用量相关的路由
+func RegisterUsageRoutes(r *gin.RouterGroup, handler *handler.UsageHandler) {
+	usage := r.Group("/usage")
+	{
+		// 按天、模型、租户统计 token 用量与费用
+		usage.GET("/report", handler.GetUsageReport)
+	}
+}
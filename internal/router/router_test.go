@@ -0,0 +1,26 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tencent/WeKnora/internal/config"
+	"github.com/Tencent/WeKnora/internal/middleware"
+)
+
+// 限流配置中的路由是手工维护的，路由调整后必须同步更新，否则限流会静默失效
+func TestRateLimitedRoutesAreRegistered(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(RouterParams{Config: &config.Config{}})
+
+	registered := make(map[string]bool)
+	for _, route := range r.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+	for _, route := range middleware.RateLimitedRoutes() {
+		if !registered[route] {
+			t.Errorf("Rate limited route %q is not registered", route)
+		}
+	}
+}
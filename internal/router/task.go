@@ -2,9 +2,12 @@ package router
 
 import (
 	"log"
+	"math"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/Tencent/WeKnora/internal/application/service"
 	"github.com/Tencent/WeKnora/internal/types"
 	"github.com/Tencent/WeKnora/internal/types/interfaces"
 	"github.com/hibiken/asynq"
@@ -14,8 +17,12 @@ import (
 type AsynqTaskParams struct {
 	dig.In
 
-	Server    *asynq.Server
-	Extracter interfaces.Extracter
+	Server             *asynq.Server
+	Extracter          interfaces.Extracter
+	KnowledgeProcessor interfaces.KnowledgeProcessor
+	ReindexService     interfaces.ReindexService
+	KnowledgeRefresher interfaces.KnowledgeRefresher
+	GraphReconciler    interfaces.GraphReconciler
 }
 
 func getAsynqRedisClientOpt() *asynq.RedisClientOpt {
@@ -45,16 +52,38 @@ func NewAsynqServer() *asynq.Server {
 				"default":  3, // Default priority queue
 				"low":      1, // Lowest priority queue
 			},
+			RetryDelayFunc: retryDelay,
 		},
 	)
 	return srv
 }
 
+// retryDelay backs off knowledge ingestion tasks exponentially, capped at ten minutes
+func retryDelay(n int, err error, task *asynq.Task) time.Duration {
+	if !strings.HasPrefix(task.Type(), "knowledge:") {
+		return asynq.DefaultRetryDelayFunc(n, err, task)
+	}
+	delay := time.Duration(math.Pow(2, float64(n))) * 10 * time.Second
+	if delay > 10*time.Minute {
+		delay = 10 * time.Minute
+	}
+	return delay
+}
+
 func RunAsynqServer(params AsynqTaskParams) *asynq.ServeMux {
 	// Create a new mux and register all handlers
 	mux := asynq.NewServeMux()
 
 	mux.HandleFunc(types.TypeChunkExtract, params.Extracter.Extract)
+	mux.HandleFunc(types.TypeKnowledgeParse, params.KnowledgeProcessor.Parse)
+	mux.HandleFunc(types.TypeKnowledgeEmbed, params.KnowledgeProcessor.Embed)
+	mux.HandleFunc(types.TypeKnowledgeSummarize, params.KnowledgeProcessor.Summarize)
+	mux.HandleFunc(types.TypeKnowledgeGraph, params.KnowledgeProcessor.Graph)
+	mux.HandleFunc(types.TypeKnowledgeBaseReindex, params.ReindexService.Reindex)
+	mux.HandleFunc(types.TypeKnowledgeRefreshScan, params.KnowledgeRefresher.Scan)
+	mux.HandleFunc(types.TypeKnowledgeRefresh, params.KnowledgeRefresher.Refresh)
+	mux.HandleFunc(types.TypeGraphReconcileScan, params.GraphReconciler.Scan)
+	mux.HandleFunc(types.TypeGraphReconcile, params.GraphReconciler.Reconcile)
 
 	go func() {
 		// Start the server
@@ -64,3 +93,28 @@ func RunAsynqServer(params AsynqTaskParams) *asynq.ServeMux {
 	}()
 	return mux
 }
+
+// RunAsynqScheduler starts the scheduler enqueueing the periodic tasks
+func RunAsynqScheduler() *asynq.Scheduler {
+	scheduler := asynq.NewScheduler(getAsynqRedisClientOpt(), nil)
+	// Every instance runs a scheduler, the unique option keeps a single scan per period
+	if _, err := scheduler.Register(service.KnowledgeRefreshScanSpec,
+		asynq.NewTask(types.TypeKnowledgeRefreshScan, nil),
+		asynq.Queue("low"), asynq.MaxRetry(0), asynq.Unique(time.Minute),
+	); err != nil {
+		log.Fatalf("could not register knowledge refresh scan: %v", err)
+	}
+	if _, err := scheduler.Register(service.GraphReconcileScanSpec,
+		asynq.NewTask(types.TypeGraphReconcileScan, nil),
+		asynq.Queue("low"), asynq.MaxRetry(0), asynq.Unique(time.Hour),
+	); err != nil {
+		log.Fatalf("could not register graph reconcile scan: %v", err)
+	}
+
+	go func() {
+		if err := scheduler.Run(); err != nil {
+			log.Fatalf("could not run scheduler: %v", err)
+		}
+	}()
+	return scheduler
+}
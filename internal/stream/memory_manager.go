@@ -18,6 +18,8 @@ type memoryStreamInfo struct {
 	knowledgeReferences types.References
 	lastUpdated         time.Time
 	isCompleted         bool
+	isFailed            bool
+	errorMessage        string
 }
 
 // MemoryStreamManager 基于内存的流管理器实现
@@ -96,6 +98,21 @@ func (m *MemoryStreamManager) CompleteStream(ctx context.Context, sessionID, req
 	return nil
 }
 
+// FailStream 记录流失败的错误信息
+func (m *MemoryStreamManager) FailStream(ctx context.Context, sessionID, requestID string, errorMessage string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sessionMap, exists := m.activeStreams[sessionID]; exists {
+		if stream, found := sessionMap[requestID]; found {
+			stream.isFailed = true
+			stream.errorMessage = errorMessage
+			stream.lastUpdated = time.Now()
+		}
+	}
+	return nil
+}
+
 // GetStream 获取特定流
 func (m *MemoryStreamManager) GetStream(ctx context.Context,
 	sessionID, requestID string,
@@ -113,6 +130,8 @@ func (m *MemoryStreamManager) GetStream(ctx context.Context,
 				KnowledgeReferences: stream.knowledgeReferences,
 				LastUpdated:         stream.lastUpdated,
 				IsCompleted:         stream.isCompleted,
+				IsFailed:            stream.isFailed,
+				ErrorMessage:        stream.errorMessage,
 			}, nil
 		}
 	}
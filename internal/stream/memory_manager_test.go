@@ -0,0 +1,33 @@
+package stream
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryStreamManagerFailStream(t *testing.T) {
+	ctx := context.Background()
+	manager := NewMemoryStreamManager()
+	if err := manager.RegisterStream(ctx, "s1", "m1", "query"); err != nil {
+		t.Fatalf("RegisterStream: %v", err)
+	}
+	if err := manager.UpdateStream(ctx, "s1", "m1", "partial", nil); err != nil {
+		t.Fatalf("UpdateStream: %v", err)
+	}
+	if err := manager.FailStream(ctx, "s1", "m1", "model overloaded"); err != nil {
+		t.Fatalf("FailStream: %v", err)
+	}
+
+	info, err := manager.GetStream(ctx, "s1", "m1")
+	if err != nil || info == nil {
+		t.Fatalf("Expected the stream, got %v, %v", info, err)
+	}
+	if !info.IsFailed || info.ErrorMessage != "model overloaded" || info.Content != "partial" {
+		t.Errorf("Expected the failure to be recorded with the partial content, got %+v", info)
+	}
+
+	// Failing an unknown stream is a no-op
+	if err := manager.FailStream(ctx, "s1", "unknown", "error"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
@@ -20,6 +20,8 @@ type redisStreamInfo struct {
 	KnowledgeReferences types.References `json:"knowledge_references"`
 	LastUpdated         time.Time        `json:"last_updated"`
 	IsCompleted         bool             `json:"is_completed"`
+	IsFailed            bool             `json:"is_failed"`
+	ErrorMessage        string           `json:"error_message,omitempty"`
 }
 
 // RedisStreamManager 基于Redis的流管理器实现
@@ -153,6 +155,38 @@ func (r *RedisStreamManager) CompleteStream(ctx context.Context, sessionID, requ
 	return r.client.Set(ctx, key, updatedData, r.ttl).Err()
 }
 
+// FailStream 记录流失败的错误信息
+func (r *RedisStreamManager) FailStream(ctx context.Context, sessionID, requestID string, errorMessage string) error {
+	key := r.buildKey(sessionID, requestID)
+
+	// 获取当前数据
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil // 键不存在，可能已过期
+		}
+		return fmt.Errorf("获取流数据失败: %w", err)
+	}
+
+	var info redisStreamInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return fmt.Errorf("解析流数据失败: %w", err)
+	}
+
+	// 记录失败信息
+	info.IsFailed = true
+	info.ErrorMessage = errorMessage
+	info.LastUpdated = time.Now()
+
+	// 保存回Redis
+	updatedData, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("序列化更新的流信息失败: %w", err)
+	}
+
+	return r.client.Set(ctx, key, updatedData, r.ttl).Err()
+}
+
 // GetStream 获取特定流
 func (r *RedisStreamManager) GetStream(ctx context.Context, sessionID, requestID string) (*interfaces.StreamInfo, error) {
 	key := r.buildKey(sessionID, requestID)
@@ -180,6 +214,8 @@ func (r *RedisStreamManager) GetStream(ctx context.Context, sessionID, requestID
 		KnowledgeReferences: info.KnowledgeReferences,
 		LastUpdated:         info.LastUpdated,
 		IsCompleted:         info.IsCompleted,
+		IsFailed:            info.IsFailed,
+		ErrorMessage:        info.ErrorMessage,
 	}, nil
 }
 
@@ -95,7 +95,11 @@ func InitTracer() (*Tracer, error) {
 }
 
 // GetTracer gets global Tracer
+// Before InitTracer it falls back to the tracer of the global provider, which is a no-op
 func GetTracer() trace.Tracer {
+	if tracer == nil {
+		return otel.Tracer(AppName)
+	}
 	return tracer
 }
 
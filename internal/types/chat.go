@@ -9,14 +9,7 @@ import (
 type ChatResponse struct {
 	Content string `json:"content"`
 	// Usage information
-	Usage struct {
-		// Prompt tokens
-		PromptTokens int `json:"prompt_tokens"`
-		// Completion tokens
-		CompletionTokens int `json:"completion_tokens"`
-		// Total tokens
-		TotalTokens int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage TokenUsage `json:"usage"`
 }
 
 // Response type
@@ -27,6 +20,8 @@ const (
 	ResponseTypeAnswer ResponseType = "answer"
 	// References response type
 	ResponseTypeReferences ResponseType = "references"
+	// Error response type, ends a stream that failed with the error message as content
+	ResponseTypeError ResponseType = "error"
 )
 
 // StreamResponse stream response
@@ -35,12 +30,14 @@ type StreamResponse struct {
 	ID string `json:"id"`
 	// Response type
 	ResponseType ResponseType `json:"response_type"`
-	// Current fragment content
+	// Current fragment content, or the error message of an error response
 	Content string `json:"content"`
 	// Whether the response is complete
 	Done bool `json:"done"`
 	// Knowledge references
 	KnowledgeReferences References `json:"knowledge_references"`
+	// Token usage of the whole answer, set on the final fragment when the model reports it
+	Usage *TokenUsage `json:"usage,omitempty"`
 }
 
 // References references
@@ -1,5 +1,13 @@
 package types
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
 // ChatManage represents the configuration and state for a chat session
 // including query processing, search parameters, and model configurations
 type ChatManage struct {
@@ -8,18 +16,38 @@ type ChatManage struct {
 	ProcessedQuery string     `json:"processed_query,omitempty"` // Query after preprocessing
 	RewriteQuery   string     `json:"rewrite_query,omitempty"`   // Query after rewriting for better retrieval
 	History        []*History `json:"history,omitempty"`         // Chat history for context
+	HistorySummary string     `json:"-"`                         // Rolling summary of the rounds before the history
+	SummaryUntil   *time.Time `json:"-"`                         // Creation time of the last round in the summary
+
+	KnowledgeBaseID  string   `json:"knowledge_base_id"`  // ID of the primary knowledge base to search against
+	KnowledgeBaseIDs []string `json:"knowledge_base_ids"` // IDs of all knowledge bases to search against
+	VectorThreshold  float64  `json:"vector_threshold"`   // Minimum score threshold for vector search results
+	KeywordThreshold float64  `json:"keyword_threshold"`  // Minimum score threshold for keyword search results
+	EmbeddingTopK    int      `json:"embedding_top_k"`    // Number of top results to retrieve from embedding search
+	VectorDatabase   string   `json:"vector_database"`    // Vector database type/name to use
 
-	KnowledgeBaseID  string  `json:"knowledge_base_id"` // ID of the knowledge base to search against
-	VectorThreshold  float64 `json:"vector_threshold"`  // Minimum score threshold for vector search results
-	KeywordThreshold float64 `json:"keyword_threshold"` // Minimum score threshold for keyword search results
-	EmbeddingTopK    int     `json:"embedding_top_k"`   // Number of top results to retrieve from embedding search
-	VectorDatabase   string  `json:"vector_database"`   // Vector database type/name to use
+	FusionStrategy FusionStrategy `json:"fusion_strategy"` // Strategy for merging vector and keyword results
+	VectorWeight   float64        `json:"vector_weight"`   // Weight of vector results in fusion
+	KeywordWeight  float64        `json:"keyword_weight"`  // Weight of keyword results in fusion
+	SearchFilter   *SearchFilter  `json:"search_filter"`   // Metadata filter applied to retrieval
+
+	QueryParaphrases int  `json:"query_paraphrases"` // Number of paraphrases of the query searched besides it
+	QueryHyDE        bool `json:"query_hyde"`        // Whether a hypothetical answer passage is searched besides the query
 
 	RerankModelID   string  `json:"rerank_model_id"`  // Model ID for reranking search results
 	RerankTopK      int     `json:"rerank_top_k"`     // Number of top results after reranking
 	RerankThreshold float64 `json:"rerank_threshold"` // Minimum score threshold for reranked results
 
+	GraphMaxHops       int      `json:"graph_max_hops"`       // Maximum number of relations walked from query entities
+	GraphRelationTypes []string `json:"graph_relation_types"` // Relation types walked from query entities, empty for all
+	GraphPathTopK      int      `json:"graph_path_top_k"`     // Number of best graph paths whose chunks are retrieved
+
+	ExpandWindow    int  `json:"expand_window"`     // Number of neighbouring chunks added on each side of a result
+	ExpandToParent  bool `json:"expand_to_parent"`  // Whether results are expanded to their parent chunk
+	ExpandMaxTokens int  `json:"expand_max_tokens"` // Token budget of the results after expansion
+
 	ChatModelID      string           `json:"chat_model_id"`     // Model ID for chat completion
+	TokenBudget      *TokenBudget     `json:"token_budget"`      // Shares of the context window of the chat model
 	SummaryConfig    SummaryConfig    `json:"summary_config"`    // Configuration for summary generation
 	FallbackStrategy FallbackStrategy `json:"fallback_strategy"` // Strategy when no relevant results are found
 	FallbackResponse string           `json:"fallback_response"` // Default response when fallback occurs
@@ -27,7 +55,9 @@ type ChatManage struct {
 	// Internal fields for pipeline data processing
 	SearchResult []*SearchResult       `json:"-"` // Results from search phase
 	RerankResult []*SearchResult       `json:"-"` // Results after reranking
+	Expansions   []string              `json:"-"` // Paraphrases and hypothetical passages searched besides the query
 	MergeResult  []*SearchResult       `json:"-"` // Final merged results after all processing
+	DropResult   []*SearchResult       `json:"-"` // Merged results dropped from the chat context by the token budget
 	Entity       []string              `json:"-"` // List of identified entities
 	GraphResult  *GraphData            `json:"-"` // Graph data from search phase
 	UserContent  string                `json:"-"` // Processed user content
@@ -35,22 +65,47 @@ type ChatManage struct {
 	ResponseChan <-chan StreamResponse `json:"-"` // Channel for streaming responses
 }
 
+// GetKnowledgeBaseIDs returns the IDs of all knowledge bases to search against
+func (c *ChatManage) GetKnowledgeBaseIDs() []string {
+	if len(c.KnowledgeBaseIDs) > 0 {
+		return c.KnowledgeBaseIDs
+	}
+	if c.KnowledgeBaseID != "" {
+		return []string{c.KnowledgeBaseID}
+	}
+	return nil
+}
+
 // Clone creates a deep copy of the ChatManage object
 func (c *ChatManage) Clone() *ChatManage {
 	return &ChatManage{
-		Query:            c.Query,
-		ProcessedQuery:   c.ProcessedQuery,
-		RewriteQuery:     c.RewriteQuery,
-		SessionID:        c.SessionID,
-		KnowledgeBaseID:  c.KnowledgeBaseID,
-		VectorThreshold:  c.VectorThreshold,
-		KeywordThreshold: c.KeywordThreshold,
-		EmbeddingTopK:    c.EmbeddingTopK,
-		VectorDatabase:   c.VectorDatabase,
-		RerankModelID:    c.RerankModelID,
-		RerankTopK:       c.RerankTopK,
-		RerankThreshold:  c.RerankThreshold,
-		ChatModelID:      c.ChatModelID,
+		Query:              c.Query,
+		ProcessedQuery:     c.ProcessedQuery,
+		RewriteQuery:       c.RewriteQuery,
+		SessionID:          c.SessionID,
+		KnowledgeBaseID:    c.KnowledgeBaseID,
+		KnowledgeBaseIDs:   slices.Clone(c.KnowledgeBaseIDs),
+		VectorThreshold:    c.VectorThreshold,
+		KeywordThreshold:   c.KeywordThreshold,
+		EmbeddingTopK:      c.EmbeddingTopK,
+		VectorDatabase:     c.VectorDatabase,
+		FusionStrategy:     c.FusionStrategy,
+		VectorWeight:       c.VectorWeight,
+		KeywordWeight:      c.KeywordWeight,
+		SearchFilter:       c.SearchFilter,
+		QueryParaphrases:   c.QueryParaphrases,
+		QueryHyDE:          c.QueryHyDE,
+		RerankModelID:      c.RerankModelID,
+		RerankTopK:         c.RerankTopK,
+		RerankThreshold:    c.RerankThreshold,
+		GraphMaxHops:       c.GraphMaxHops,
+		GraphRelationTypes: slices.Clone(c.GraphRelationTypes),
+		GraphPathTopK:      c.GraphPathTopK,
+		ExpandWindow:       c.ExpandWindow,
+		ExpandToParent:     c.ExpandToParent,
+		ExpandMaxTokens:    c.ExpandMaxTokens,
+		ChatModelID:        c.ChatModelID,
+		TokenBudget:        c.TokenBudget,
 		SummaryConfig: SummaryConfig{
 			MaxTokens:           c.SummaryConfig.MaxTokens,
 			RepeatPenalty:       c.SummaryConfig.RepeatPenalty,
@@ -70,16 +125,65 @@ func (c *ChatManage) Clone() *ChatManage {
 	}
 }
 
+// TokenBudget splits the context window of the chat model, less the tokens reserved for the completion,
+// between the prompt, the chat history and the retrieved content. The shares are fractions of the window,
+// the prompt is never cut and the content also takes what the prompt and the history leave of their shares.
+// Shares summing to less than one leave headroom for the inaccuracy of the token estimate
+type TokenBudget struct {
+	PromptShare  float64 `yaml:"prompt_share" json:"prompt_share"`   // Share of the system prompt, the template and the query
+	HistoryShare float64 `yaml:"history_share" json:"history_share"` // Share of the chat history, older rounds are dropped first
+	ContentShare float64 `yaml:"content_share" json:"content_share"` // Share of the retrieved content, lower scores are dropped first
+}
+
+// DefaultTokenBudget is the token budget used when neither the request nor the config set one
+var DefaultTokenBudget = TokenBudget{PromptShare: 0.15, HistoryShare: 0.15, ContentShare: 0.6}
+
+// Validate checks that the shares are fractions that sum to at most one
+func (b *TokenBudget) Validate() error {
+	for _, share := range []float64{b.PromptShare, b.HistoryShare, b.ContentShare} {
+		if share < 0 || share > 1 {
+			return fmt.Errorf("token budget shares must be between 0 and 1, got %v", share)
+		}
+	}
+	if sum := b.PromptShare + b.HistoryShare + b.ContentShare; sum > 1 {
+		return fmt.Errorf("token budget shares must sum to at most 1, got %v", sum)
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface, used to persist the parameters of a ChatManage
+// Internal pipeline fields are not persisted
+func (c *ChatManage) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	return json.Marshal(c)
+}
+
+// Scan implements the sql.Scanner interface, used to convert database value to ChatManage
+func (c *ChatManage) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(b, c)
+}
+
 // EventType represents different stages in the RAG (Retrieval Augmented Generation) pipeline
 type EventType string
 
 const (
 	PREPROCESS_QUERY       EventType = "preprocess_query"       // Query preprocessing stage
 	REWRITE_QUERY          EventType = "rewrite_query"          // Query rewriting for better retrieval
+	QUERY_EXPAND           EventType = "query_expand"           // Expand the query into paraphrases and a hypothetical passage
 	CHUNK_SEARCH           EventType = "chunk_search"           // Search for relevant chunks
 	ENTITY_SEARCH          EventType = "entity_search"          // Search for relevant entities
 	CHUNK_RERANK           EventType = "chunk_rerank"           // Rerank search results
 	CHUNK_MERGE            EventType = "chunk_merge"            // Merge similar chunks
+	CHUNK_EXPAND           EventType = "chunk_expand"           // Expand chunks with their neighbours or parent
 	INTO_CHAT_MESSAGE      EventType = "into_chat_message"      // Convert chunks into chat messages
 	CHAT_COMPLETION        EventType = "chat_completion"        // Generate chat completion
 	CHAT_COMPLETION_STREAM EventType = "chat_completion_stream" // Stream chat completion
@@ -87,7 +191,8 @@ const (
 	FILTER_TOP_K           EventType = "filter_top_k"           // Keep only top K results
 )
 
-// Pipline defines the sequence of events for different chat modes
+// Pipline defines the built-in sequences of events for different chat modes
+// Additional pipelines can be declared in the conversation config, see PipelineConfig
 var Pipline = map[string][]EventType{
 	"chat": { // Simple chat without retrieval
 		CHAT_COMPLETION,
@@ -97,20 +202,24 @@ var Pipline = map[string][]EventType{
 		STREAM_FILTER,
 	},
 	"rag": { // Retrieval Augmented Generation
+		QUERY_EXPAND,
 		CHUNK_SEARCH,
 		CHUNK_RERANK,
 		CHUNK_MERGE,
+		CHUNK_EXPAND,
 		INTO_CHAT_MESSAGE,
 		CHAT_COMPLETION,
 	},
 	"rag_stream": { // Streaming Retrieval Augmented Generation
 		REWRITE_QUERY,
 		PREPROCESS_QUERY,
+		QUERY_EXPAND,
 		CHUNK_SEARCH,
 		ENTITY_SEARCH,
 		CHUNK_RERANK,
 		CHUNK_MERGE,
 		FILTER_TOP_K,
+		CHUNK_EXPAND,
 		INTO_CHAT_MESSAGE,
 		CHAT_COMPLETION_STREAM,
 		STREAM_FILTER,
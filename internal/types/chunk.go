@@ -24,6 +24,8 @@ const (
 	ChunkTypeEntity ChunkType = "entity"
 	// ChunkTypeRelationship 表示关系类型的 Chunk
 	ChunkTypeRelationship ChunkType = "relationship"
+	// ChunkTypeParentText 表示父子分块中的父 Chunk，不参与检索，命中子 Chunk 时作为上下文返回
+	ChunkTypeParentText ChunkType = "parent_text"
 )
 
 // ImageInfo 表示与 Chunk 关联的图片信息
@@ -81,6 +83,8 @@ type Chunk struct {
 	IndirectRelationChunks JSON `json:"indirect_relation_chunks" gorm:"type:json"`
 	// 图片信息，存储为 JSON
 	ImageInfo string `json:"image_info" gorm:"type:text"`
+	// 创建该 Chunk 时知识内容的版本，替换内容时只有新版本的 Chunk 需要重新向量化
+	Generation int64 `json:"generation"`
 	// Chunk creation time
 	CreatedAt time.Time `json:"created_at"`
 	// Chunk last update time
@@ -12,6 +12,10 @@ const (
 	RequestIDContextKey ContextKey = "RequestID"
 	// LoggerContextKey is the context key for logger
 	LoggerContextKey ContextKey = "Logger"
+	// SessionIDContextKey is the context key for the ID of the session a model call is made for
+	SessionIDContextKey ContextKey = "SessionID"
+	// KnowledgeIDContextKey is the context key for the ID of the knowledge a model call is made for
+	KnowledgeIDContextKey ContextKey = "KnowledgeID"
 )
 
 // String returns the string representation of the context key
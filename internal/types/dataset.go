@@ -1,5 +1,23 @@
 package types
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// DefaultDatasetID is the ID of the built-in sample dataset shipped with the service
+const DefaultDatasetID = "default"
+
+// DatasetFormat is the file format a dataset was uploaded in
+type DatasetFormat string
+
+const (
+	DatasetFormatParquet DatasetFormat = "parquet" // queries/corpus/qrels/answers parquet files
+	DatasetFormatJSONL   DatasetFormat = "jsonl"   // one QA pair per line
+	DatasetFormatCSV     DatasetFormat = "csv"     // one QA pair per row
+)
+
 // QAPair represents a complete QA example with question, related passages and answer
 type QAPair struct {
 	QID      int      // Question ID
@@ -9,3 +27,76 @@ type QAPair struct {
 	AID      int      // Answer ID
 	Answer   string   // Answer text
 }
+
+// Dataset is an evaluation dataset uploaded by a tenant
+type Dataset struct {
+	// Unique identifier of the dataset
+	ID string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	// Tenant ID
+	TenantID uint `json:"tenant_id" gorm:"index"`
+	// Name of the dataset
+	Name string `json:"name"`
+	// Description of the dataset
+	Description string `json:"description"`
+	// Format the dataset was uploaded in
+	Format DatasetFormat `json:"format" gorm:"type:varchar(32)"`
+	// Number of QA pairs
+	QuestionCount int `json:"question_count"`
+	// Number of distinct passages referenced by the QA pairs
+	PassageCount int `json:"passage_count"`
+	// Creation time of the dataset
+	CreatedAt time.Time `json:"created_at"`
+	// Last updated time of the dataset
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DatasetQAPair is a persisted QA pair of a dataset
+type DatasetQAPair struct {
+	// Unique identifier of the QA pair
+	ID uint64 `json:"id" gorm:"primaryKey;autoIncrement"`
+	// ID of the dataset
+	DatasetID string `json:"dataset_id" gorm:"type:varchar(36);index"`
+	// Question ID
+	QID int `json:"qid" gorm:"column:qid"`
+	// Question text
+	Question string `json:"question" gorm:"type:text"`
+	// Related passage IDs
+	PIDs IntArray `json:"pids" gorm:"column:pids;type:json"`
+	// Passage texts
+	Passages StringArray `json:"passages" gorm:"type:json"`
+	// Answer ID
+	AID int `json:"aid" gorm:"column:aid"`
+	// Answer text
+	Answer string `json:"answer" gorm:"type:text"`
+}
+
+// QAPair converts the persisted QA pair to a QAPair
+func (p *DatasetQAPair) QAPair() *QAPair {
+	return &QAPair{
+		QID:      p.QID,
+		Question: p.Question,
+		PIDs:     p.PIDs,
+		Passages: p.Passages,
+		AID:      p.AID,
+		Answer:   p.Answer,
+	}
+}
+
+type IntArray []int
+
+// Value implements the driver.Valuer interface, used to convert IntArray to database value
+func (c IntArray) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+// Scan implements the sql.Scanner interface, used to convert database value to IntArray
+func (c *IntArray) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(b, c)
+}
@@ -7,6 +7,7 @@ const (
 	ChunkSourceType   SourceType = iota // Source is a text chunk
 	PassageSourceType                   // Source is a passage
 	SummarySourceType                   // Source is a summary
+	ReindexSourceType                   // Source is a chunk staged by a re-embedding job
 )
 
 // MatchType represents the type of matching algorithm
@@ -1,6 +1,18 @@
 package types
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the repositories when a record does not exist
+var (
+	ErrKnowledgeNotFound      = errors.New("knowledge not found")
+	ErrKnowledgeBaseNotFound  = errors.New("knowledge base not found")
+	ErrDatasetNotFound        = errors.New("dataset not found")
+	ErrEvaluationTaskNotFound = errors.New("evaluation task not found")
+	ErrReindexJobNotFound     = errors.New("reindex job not found")
+)
 
 // StorageQuotaExceededError represents the storage quota exceeded error
 type StorageQuotaExceededError struct {
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"database/sql/driver"
 	"encoding/json"
 	"time"
 
@@ -21,17 +22,30 @@ const (
 )
 
 // EvaluationTask contains information about an evaluation task
+// Tasks are persisted together with their parameters and metrics so that runs can be compared later
 type EvaluationTask struct {
-	ID        string `json:"id"`         // Unique task ID
-	TenantID  uint   `json:"tenant_id"`  // Tenant/Organization ID
-	DatasetID string `json:"dataset_id"` // Dataset ID for evaluation
+	ID        string `json:"id" gorm:"type:varchar(36);primaryKey"` // Unique task ID
+	TenantID  uint   `json:"tenant_id" gorm:"index"`                // Tenant/Organization ID
+	DatasetID string `json:"dataset_id"`                            // Dataset ID for evaluation
 
-	StartTime time.Time        `json:"start_time"`        // Task start time
-	Status    EvaluationStatue `json:"status"`            // Current task status
-	ErrMsg    string           `json:"err_msg,omitempty"` // Error message if failed
+	StartTime time.Time        `json:"start_time"`         // Task start time
+	EndTime   *time.Time       `json:"end_time,omitempty"` // Task end time, whatever the outcome
+	Status    EvaluationStatue `json:"status"`             // Current task status
+	ErrMsg    string           `json:"err_msg,omitempty"`  // Error message if failed
 
 	Total    int `json:"total,omitempty"`    // Total items to evaluate
 	Finished int `json:"finished,omitempty"` // Completed items count
+
+	Params *ChatManage   `json:"-" gorm:"type:json"` // Evaluation parameters
+	Metric *MetricResult `json:"-" gorm:"type:json"` // Aggregate evaluation metrics
+
+	CreatedAt time.Time `json:"created_at"` // Creation time of the task
+	UpdatedAt time.Time `json:"updated_at"` // Last updated time of the task
+}
+
+// Detail returns the evaluation detail of the task
+func (e *EvaluationTask) Detail() *EvaluationDetail {
+	return &EvaluationDetail{Task: e, Params: e.Params, Metric: e.Metric}
 }
 
 // EvaluationDetail contains detailed evaluation information
@@ -41,6 +55,18 @@ type EvaluationDetail struct {
 	Metric *MetricResult   `json:"metric,omitempty"` // Evaluation metrics
 }
 
+// EvaluationQuestion is the evaluation record of a single question of a task
+type EvaluationQuestion struct {
+	ID            uint64        `json:"id" gorm:"primaryKey;autoIncrement"`    // Unique record ID
+	TaskID        string        `json:"task_id" gorm:"type:varchar(36);index"` // ID of the evaluation task
+	QuestionIndex int           `json:"question_index"`                        // Position of the question in the dataset
+	QID           int           `json:"qid" gorm:"column:qid"`                 // Question ID in the dataset
+	Question      string        `json:"question" gorm:"type:text"`             // Question text
+	Input         *MetricInput  `json:"input" gorm:"type:json"`                // Metric input of the question
+	Metric        *MetricResult `json:"metric" gorm:"type:json"`               // Metrics of the question
+	CreatedAt     time.Time     `json:"created_at"`                            // Creation time of the record
+}
+
 // String returns JSON representation of EvaluationTask
 func (e *EvaluationTask) String() string {
 	b, _ := json.Marshal(e)
@@ -49,11 +75,28 @@ func (e *EvaluationTask) String() string {
 
 // MetricInput contains input data for metric calculation
 type MetricInput struct {
-	RetrievalGT  [][]int // Ground truth for retrieval
-	RetrievalIDs []int   // Retrieved IDs
+	RetrievalGT  [][]int `json:"retrieval_gt"`  // Ground truth for retrieval
+	RetrievalIDs []int   `json:"retrieval_ids"` // Retrieved IDs
+
+	GeneratedTexts string `json:"generated_texts"` // Generated text for evaluation
+	GeneratedGT    string `json:"generated_gt"`    // Ground truth text for comparison
+}
+
+// Value implements the driver.Valuer interface, used to convert MetricInput to database value
+func (m MetricInput) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
 
-	GeneratedTexts string // Generated text for evaluation
-	GeneratedGT    string // Ground truth text for comparison
+// Scan implements the sql.Scanner interface, used to convert database value to MetricInput
+func (m *MetricInput) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(b, m)
 }
 
 // MetricResult contains evaluation metrics
@@ -62,6 +105,23 @@ type MetricResult struct {
 	GenerationMetrics GenerationMetrics `json:"generation_metrics"` // Text generation quality metrics
 }
 
+// Value implements the driver.Valuer interface, used to convert MetricResult to database value
+func (m MetricResult) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+// Scan implements the sql.Scanner interface, used to convert database value to MetricResult
+func (m *MetricResult) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(b, m)
+}
+
 // RetrievalMetrics contains metrics for retrieval evaluation
 type RetrievalMetrics struct {
 	Precision float64 `json:"precision"` // Precision score
@@ -97,3 +157,28 @@ const (
 	StateAfterComplete                      // After completion
 	StateEnd                                // Evaluation ended
 )
+
+// MetricDiff is the difference of a metric between two evaluation runs
+type MetricDiff struct {
+	Name   string  `json:"name"`   // Metric name, same as its JSON field name in MetricResult
+	Base   float64 `json:"base"`   // Value of the base run
+	Target float64 `json:"target"` // Value of the target run
+	Delta  float64 `json:"delta"`  // Target minus base
+}
+
+// QuestionRegression is a question whose metrics dropped from the base run to the target run
+type QuestionRegression struct {
+	QID       int                 `json:"qid"`       // Question ID in the dataset
+	Question  string              `json:"question"`  // Question text
+	Base      *EvaluationQuestion `json:"base"`      // Record of the question in the base run
+	Target    *EvaluationQuestion `json:"target"`    // Record of the question in the target run
+	Regressed []*MetricDiff       `json:"regressed"` // Metrics that dropped
+}
+
+// EvaluationComparison is the metric by metric comparison of two evaluation runs
+type EvaluationComparison struct {
+	Base        *EvaluationDetail     `json:"base"`        // Base run
+	Target      *EvaluationDetail     `json:"target"`      // Target run
+	Metrics     []*MetricDiff         `json:"metrics"`     // Differences of the aggregate metrics
+	Regressions []*QuestionRegression `json:"regressions"` // Questions that regressed in the target run
+}
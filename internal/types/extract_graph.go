@@ -1,7 +1,17 @@
 package types
 
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+)
+
 const (
 	TypeChunkExtract = "chunk:extract"
+
+	TypeGraphReconcileScan = "graph:reconcile_scan"
+	TypeGraphReconcile     = "graph:reconcile"
 )
 
 type ExtractChunkPayload struct {
@@ -10,6 +20,12 @@ type ExtractChunkPayload struct {
 	ModelID  string `json:"model_id"`
 }
 
+// GraphReconcilePayload is the payload of the task repairing the retrieval graph of a knowledge base
+type GraphReconcilePayload struct {
+	TenantID        uint   `json:"tenant_id"`
+	KnowledgeBaseID string `json:"knowledge_base_id"`
+}
+
 type PromptTemplateStructured struct {
 	Description string      `json:"description"`
 	Tags        []string    `json:"tags"`
@@ -49,3 +65,88 @@ func (n NameSpace) Labels() []string {
 	}
 	return res
 }
+
+// GraphDriverType represents the store the retrieval graph is kept in
+type GraphDriverType string
+
+// GraphDriverType constants
+const (
+	Neo4jGraphDriverType    GraphDriverType = "neo4j"
+	PostgresGraphDriverType GraphDriverType = "postgres"
+)
+
+// GraphPathQuery describes a bounded neighbourhood search of the retrieval graph
+type GraphPathQuery struct {
+	Entities      []string // Texts the name of the start node contains any of
+	MaxHops       int      // Maximum number of relations of a path
+	RelationTypes []string // Relation types a path may walk, empty for all types
+	Limit         int      // Maximum number of paths returned
+}
+
+// graphPathCandidateFactor is the number of paths collected for every path returned by a search
+const graphPathCandidateFactor = 20
+
+// CandidateLimit returns the number of paths a repository collects before ranking them
+func (q *GraphPathQuery) CandidateLimit() int {
+	return max(q.Limit, 1) * graphPathCandidateFactor
+}
+
+// GraphPath is a walk through the retrieval graph, Relations[i] connects Nodes[i] and Nodes[i+1]
+// in either direction
+type GraphPath struct {
+	Nodes     []*GraphNode     `json:"nodes"`
+	Relations []*GraphRelation `json:"relations"`
+	Score     float64          `json:"score"`
+}
+
+// String renders the path as "A -[type]-> B <-[type]- C"
+func (p *GraphPath) String() string {
+	var b strings.Builder
+	for i, node := range p.Nodes {
+		if i > 0 {
+			relation := p.Relations[i-1]
+			if relation.Node1 == node.Name {
+				b.WriteString(" <-[" + relation.Type + "]- ")
+			} else {
+				b.WriteString(" -[" + relation.Type + "]-> ")
+			}
+		}
+		b.WriteString(node.Name)
+	}
+	return b.String()
+}
+
+// graphPathHopDecay is the factor the score of a path decays by with every relation after the first
+const graphPathHopDecay = 0.7
+
+// ScoreGraphPath scores a path by the number of its nodes matching an entity,
+// decayed by its length so that a longer path only wins when it connects more entities
+func ScoreGraphPath(path *GraphPath, entities []string) float64 {
+	matched := 0
+	for _, node := range path.Nodes {
+		if slices.ContainsFunc(entities, func(entity string) bool {
+			return entity != "" && strings.Contains(node.Name, entity)
+		}) {
+			matched++
+		}
+	}
+	return float64(matched) * math.Pow(graphPathHopDecay, float64(max(len(path.Relations)-1, 0)))
+}
+
+// RankGraphPaths scores the paths and returns at most limit of them, the best first,
+// shorter paths come first among paths with the same score
+func RankGraphPaths(paths []*GraphPath, entities []string, limit int) []*GraphPath {
+	for _, path := range paths {
+		path.Score = ScoreGraphPath(path, entities)
+	}
+	slices.SortStableFunc(paths, func(a, b *GraphPath) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(len(a.Relations), len(b.Relations))
+	})
+	if limit > 0 && len(paths) > limit {
+		paths = paths[:limit]
+	}
+	return paths
+}
@@ -1,7 +1,15 @@
 // Package types defines the core data structures and interfaces used throughout the WeKnora system.
 package types
 
-import "context"
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
 
 // Entity represents a node in the knowledge graph extracted from document chunks.
 // Each entity corresponds to a meaningful concept, person, place or thing identified in the text.
@@ -51,3 +59,190 @@ type GraphBuilder interface {
 	// This is primarily used for visualization and diagnostics.
 	GetAllRelationships() []*Relationship
 }
+
+// GraphExportFormat is the file format a knowledge graph is exported in
+type GraphExportFormat string
+
+const (
+	GraphExportFormatJSON    GraphExportFormat = "json"    // Entities and relationships as JSON
+	GraphExportFormatGraphML GraphExportFormat = "graphml" // GraphML XML document
+)
+
+// GraphSource is the contribution of a single knowledge to a persisted entity or relationship
+type GraphSource struct {
+	ChunkIDs    []string `json:"chunk_ids"`          // Chunks of the knowledge the entity or relationship appears in
+	Type        string   `json:"type,omitempty"`     // Entity type extracted from the knowledge
+	Description string   `json:"description"`        // Description extracted from the knowledge
+	Strength    int      `json:"strength,omitempty"` // Relationship strength extracted from the knowledge
+}
+
+// GraphSources maps knowledge IDs to their contribution
+type GraphSources map[string]*GraphSource
+
+// GraphEntity is an entity of the knowledge graph of a knowledge base,
+// entities extracted from different knowledge with the same normalized title are merged into one
+type GraphEntity struct {
+	// Unique identifier of the entity
+	ID string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	// Tenant ID
+	TenantID uint `json:"tenant_id" gorm:"index"`
+	// Knowledge base ID
+	KnowledgeBaseID string `json:"knowledge_base_id" gorm:"type:varchar(36);uniqueIndex:idx_graph_entity_title"`
+	// Display name of the entity
+	Title string `json:"title"`
+	// Normalized title the entities are de-duplicated by
+	TitleKey string `json:"-" gorm:"type:varchar(255);uniqueIndex:idx_graph_entity_title"`
+	// Classification of the entity
+	Type string `json:"type"`
+	// Description of the entity
+	Description string `json:"description" gorm:"type:text"`
+	// Number of chunks the entity appears in
+	Frequency int `json:"frequency"`
+	// Number of relationships of the entity
+	Degree int `json:"degree"`
+	// Chunks the entity appears in
+	ChunkIDs StringArray `json:"chunk_ids" gorm:"type:json"`
+	// Knowledge the entity was extracted from
+	KnowledgeIDs StringArray `json:"knowledge_ids" gorm:"type:json"`
+	// Contribution of each knowledge
+	Sources GraphSources `json:"-" gorm:"type:json"`
+	// Creation time of the entity
+	CreatedAt time.Time `json:"created_at"`
+	// Last updated time of the entity
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GraphRelationship is a directed relationship between two entities of the knowledge graph of a knowledge base
+type GraphRelationship struct {
+	// Unique identifier of the relationship
+	ID string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	// Tenant ID
+	TenantID uint `json:"tenant_id" gorm:"index"`
+	// Knowledge base ID
+	KnowledgeBaseID string `json:"knowledge_base_id" gorm:"type:varchar(36);uniqueIndex:idx_graph_relationship_ends"`
+	// ID of the entity where the relationship starts
+	SourceID string `json:"source_id" gorm:"type:varchar(36);uniqueIndex:idx_graph_relationship_ends"`
+	// ID of the entity where the relationship ends
+	TargetID string `json:"target_id" gorm:"type:varchar(36);uniqueIndex:idx_graph_relationship_ends"`
+	// Description of how the entities are related
+	Description string `json:"description" gorm:"type:text"`
+	// Strength of the relationship (1-10)
+	Strength int `json:"strength"`
+	// Chunks the relationship is established in
+	ChunkIDs StringArray `json:"chunk_ids" gorm:"type:json"`
+	// Knowledge the relationship was extracted from
+	KnowledgeIDs StringArray `json:"knowledge_ids" gorm:"type:json"`
+	// Contribution of each knowledge
+	Sources GraphSources `json:"-" gorm:"type:json"`
+	// Creation time of the relationship
+	CreatedAt time.Time `json:"created_at"`
+	// Last updated time of the relationship
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// KnowledgeGraph is a subgraph of the knowledge graph of a knowledge base
+type KnowledgeGraph struct {
+	Entities      []*GraphEntity       `json:"entities"`
+	Relationships []*GraphRelationship `json:"relationships"`
+}
+
+// GraphChanges are the changes to the knowledge graph of a knowledge base
+type GraphChanges struct {
+	SaveEntities          []*GraphEntity       // Entities to create or update
+	DeleteEntityIDs       []string             // Entities to delete
+	SaveRelationships     []*GraphRelationship // Relationships to create or update
+	DeleteRelationshipIDs []string             // Relationships to delete
+}
+
+// GraphScope is the part of the knowledge graph of a knowledge base a change is merged into
+type GraphScope struct {
+	Entities     []*GraphEntity // Entities the change contributes to, created when their title key is new
+	KnowledgeIDs []string       // Knowledge whose contributions the change replaces or removes
+}
+
+// maxEntityTitleKeyLength is the size of the title key column
+const maxEntityTitleKeyLength = 255
+
+// NormalizeEntityTitle returns the key entities are de-duplicated by,
+// titles differing only in case or whitespace refer to the same entity
+func NormalizeEntityTitle(title string) string {
+	key := []rune(strings.ToLower(strings.Join(strings.Fields(title), " ")))
+	if len(key) > maxEntityTitleKeyLength {
+		key = key[:maxEntityTitleKeyLength]
+	}
+	return string(key)
+}
+
+// Refresh recomputes the merged fields of the entity from its sources
+func (e *GraphEntity) Refresh() {
+	e.KnowledgeIDs, e.ChunkIDs = e.Sources.ids()
+	e.Frequency = 0
+	for _, source := range e.Sources {
+		e.Frequency += len(source.ChunkIDs)
+	}
+	if source := e.Sources.primary(); source != nil {
+		e.Type = source.Type
+		e.Description = source.Description
+	}
+}
+
+// Refresh recomputes the merged fields of the relationship from its sources,
+// the strength is the average of the sources weighted by their number of chunks
+func (r *GraphRelationship) Refresh() {
+	r.KnowledgeIDs, r.ChunkIDs = r.Sources.ids()
+	strength, weight := 0, 0
+	for _, source := range r.Sources {
+		n := max(len(source.ChunkIDs), 1)
+		strength += source.Strength * n
+		weight += n
+	}
+	if weight > 0 {
+		r.Strength = int(math.Round(float64(strength) / float64(weight)))
+	}
+	if source := r.Sources.primary(); source != nil {
+		r.Description = source.Description
+	}
+}
+
+// ids returns the sorted knowledge IDs and the sorted, de-duplicated chunk IDs of the sources
+func (s GraphSources) ids() (StringArray, StringArray) {
+	knowledgeIDs := make(StringArray, 0, len(s))
+	chunkIDs := make(StringArray, 0)
+	for knowledgeID, source := range s {
+		knowledgeIDs = append(knowledgeIDs, knowledgeID)
+		chunkIDs = append(chunkIDs, source.ChunkIDs...)
+	}
+	slices.Sort(knowledgeIDs)
+	slices.Sort(chunkIDs)
+	return knowledgeIDs, slices.Compact(chunkIDs)
+}
+
+// primary returns the source with the most detailed description, ties are broken by knowledge ID
+func (s GraphSources) primary() *GraphSource {
+	var primary *GraphSource
+	var primaryID string
+	for knowledgeID, source := range s {
+		if primary == nil || len(source.Description) > len(primary.Description) ||
+			(len(source.Description) == len(primary.Description) && knowledgeID < primaryID) {
+			primary, primaryID = source, knowledgeID
+		}
+	}
+	return primary
+}
+
+// Value implements the driver.Valuer interface, used to convert GraphSources to database value
+func (s GraphSources) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan implements the sql.Scanner interface, used to convert database value to GraphSources
+func (s *GraphSources) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(b, s)
+}
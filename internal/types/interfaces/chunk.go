@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	"github.com/Tencent/WeKnora/internal/types"
 )
@@ -24,11 +25,41 @@ type ChunkRepository interface {
 		page *types.Pagination,
 		chunk_type []types.ChunkType,
 	) ([]*types.Chunk, int64, error)
+	// ListChunksByKnowledgeIDAndType lists all chunks of the given types by knowledge id
+	ListChunksByKnowledgeIDAndType(
+		ctx context.Context,
+		tenantID uint,
+		knowledgeID string,
+		chunkType []types.ChunkType,
+	) ([]*types.Chunk, error)
 	ListChunkByParentID(ctx context.Context, tenantID uint, parentID string) ([]*types.Chunk, error)
+	// ListEnabledChunksByKnowledgeBaseID lists enabled chunks of a knowledge base after the given chunk,
+	// ordered by creation time, a nil after lists from the first chunk. Parent chunks are not listed
+	ListEnabledChunksByKnowledgeBaseID(
+		ctx context.Context,
+		tenantID uint,
+		knowledgeBaseID string,
+		after *types.Chunk,
+		limit int,
+	) ([]*types.Chunk, error)
+	// ListChunksUpdatedSince lists chunks of a knowledge base updated at or after the given time after the given
+	// chunk, ordered by update time. Disabled chunks are listed, parent chunks are not
+	ListChunksUpdatedSince(
+		ctx context.Context,
+		tenantID uint,
+		knowledgeBaseID string,
+		since time.Time,
+		after *types.Chunk,
+		limit int,
+	) ([]*types.Chunk, error)
+	// CountEnabledChunksByKnowledgeBaseID counts enabled chunks of a knowledge base, parent chunks excluded
+	CountEnabledChunksByKnowledgeBaseID(ctx context.Context, tenantID uint, knowledgeBaseID string) (int64, error)
 	// UpdateChunk updates a chunk
 	UpdateChunk(ctx context.Context, chunk *types.Chunk) error
 	// DeleteChunk deletes a chunk
 	DeleteChunk(ctx context.Context, tenantID uint, id string) error
+	// DeleteChunks deletes chunks by ids
+	DeleteChunks(ctx context.Context, tenantID uint, ids []string) error
 	// DeleteChunksByKnowledgeID deletes chunks by knowledge id
 	DeleteChunksByKnowledgeID(ctx context.Context, tenantID uint, knowledgeID string) error
 	// DeleteByKnowledgeList deletes all chunks for a knowledge list
@@ -0,0 +1,39 @@
+package interfaces
+
+import (
+	"context"
+	"mime/multipart"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// DatasetService defines operations for dataset management
+type DatasetService interface {
+	// GetDatasetByID retrieves QA pairs from dataset by ID
+	GetDatasetByID(ctx context.Context, datasetID string) ([]*types.QAPair, error)
+	// GetDataset gets the information of a dataset, including the built-in default dataset
+	GetDataset(ctx context.Context, datasetID string) (*types.Dataset, error)
+	// CreateDataset parses the uploaded files into QA pairs and saves them as a new dataset
+	// Parquet datasets are uploaded as queries/corpus/qrels/answers/qas files, JSONL and CSV as a single file
+	CreateDataset(ctx context.Context,
+		dataset *types.Dataset, files map[string]*multipart.FileHeader,
+	) (*types.Dataset, error)
+	// ListDatasets lists the datasets of the tenant
+	ListDatasets(ctx context.Context) ([]*types.Dataset, error)
+	// DeleteDataset deletes a dataset of the tenant
+	DeleteDataset(ctx context.Context, datasetID string) error
+}
+
+// DatasetRepository persists datasets and their QA pairs
+type DatasetRepository interface {
+	// CreateDataset creates a dataset with its QA pairs
+	CreateDataset(ctx context.Context, dataset *types.Dataset, pairs []*types.DatasetQAPair) error
+	// GetDatasetByID gets a dataset by id
+	GetDatasetByID(ctx context.Context, tenantID uint, id string) (*types.Dataset, error)
+	// ListDatasets lists the datasets of a tenant
+	ListDatasets(ctx context.Context, tenantID uint) ([]*types.Dataset, error)
+	// ListQAPairs lists the QA pairs of a dataset
+	ListQAPairs(ctx context.Context, datasetID string) ([]*types.DatasetQAPair, error)
+	// DeleteDataset deletes a dataset with its QA pairs
+	DeleteDataset(ctx context.Context, tenantID uint, id string) error
+}
@@ -14,6 +14,28 @@ type EvaluationService interface {
 	) (*types.EvaluationDetail, error)
 	// EvaluationResult retrieves evaluation result by task ID
 	EvaluationResult(ctx context.Context, taskID string) (*types.EvaluationDetail, error)
+	// ListEvaluations lists the past evaluation tasks of the tenant with pagination
+	ListEvaluations(ctx context.Context, page *types.Pagination) (*types.PageResult, error)
+	// CompareEvaluations compares two evaluation tasks metric by metric
+	CompareEvaluations(ctx context.Context, baseTaskID string, targetTaskID string) (*types.EvaluationComparison, error)
+}
+
+// EvaluationRepository persists evaluation tasks and their per-question records
+type EvaluationRepository interface {
+	// CreateTask creates a task
+	CreateTask(ctx context.Context, task *types.EvaluationTask) error
+	// GetTaskByID gets a task by id
+	GetTaskByID(ctx context.Context, tenantID uint, id string) (*types.EvaluationTask, error)
+	// ListPagedTasks lists the tasks of a tenant with pagination
+	ListPagedTasks(ctx context.Context, tenantID uint, page *types.Pagination) ([]*types.EvaluationTask, int64, error)
+	// UpdateTask saves a task
+	UpdateTask(ctx context.Context, task *types.EvaluationTask) error
+	// FailInterruptedTasks marks the pending and running tasks as failed and returns their number
+	FailInterruptedTasks(ctx context.Context, errMsg string) (int64, error)
+	// CreateQuestion creates the record of a question
+	CreateQuestion(ctx context.Context, question *types.EvaluationQuestion) error
+	// ListQuestionsByTaskID lists the question records of a task
+	ListQuestionsByTaskID(ctx context.Context, taskID string) ([]*types.EvaluationQuestion, error)
 }
 
 // Metrics defines interface for computing evaluation metrics
@@ -27,9 +49,3 @@ type EvalHook interface {
 	// Handle processes evaluation state change
 	Handle(ctx context.Context, state types.EvalState, index int, data interface{}) error
 }
-
-// DatasetService defines operations for dataset management
-type DatasetService interface {
-	// GetDatasetByID retrieves QA pairs from dataset by ID
-	GetDatasetByID(ctx context.Context, datasetID string) ([]*types.QAPair, error)
-}
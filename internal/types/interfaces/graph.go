@@ -0,0 +1,47 @@
+package interfaces
+
+import (
+	"context"
+	"io"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// GraphService defines the service interface of the persisted knowledge graph of knowledge bases
+type GraphService interface {
+	// SaveKnowledgeGraph replaces the contribution of a knowledge to the graph of its knowledge base
+	SaveKnowledgeGraph(ctx context.Context, knowledge *types.Knowledge,
+		entities []*types.Entity, relationships []*types.Relationship) error
+	// DeleteKnowledgeGraph removes the contribution of knowledge to the graph of a knowledge base
+	DeleteKnowledgeGraph(ctx context.Context, knowledgeBaseID string, knowledgeIDs []string) error
+	// ListEntities lists the entities of a knowledge base, optionally filtered by a title keyword
+	ListEntities(ctx context.Context,
+		knowledgeBaseID string, keyword string, page *types.Pagination) (*types.PageResult, error)
+	// GetNeighbors returns the subgraph within depth relationships of an entity
+	GetNeighbors(ctx context.Context, knowledgeBaseID string, entityID string, depth int) (*types.KnowledgeGraph, error)
+	// FindPath returns the shortest path between two entities, ignoring the direction of relationships
+	FindPath(ctx context.Context,
+		knowledgeBaseID string, sourceID string, targetID string, maxDepth int) (*types.KnowledgeGraph, error)
+	// ExportGraph writes the whole graph of a knowledge base in the given format
+	ExportGraph(ctx context.Context, knowledgeBaseID string, format types.GraphExportFormat, w io.Writer) error
+}
+
+// GraphRepository defines the repository interface of the persisted knowledge graph
+type GraphRepository interface {
+	// UpdateGraph locks the entities of the scope with their relationships and applies the changes
+	// computed by update on them
+	UpdateGraph(ctx context.Context, knowledgeBaseID string, scope *types.GraphScope,
+		update func(graph *types.KnowledgeGraph) (*types.GraphChanges, error)) error
+	// DeleteGraph deletes the whole graph of a knowledge base
+	DeleteGraph(ctx context.Context, knowledgeBaseID string) error
+	// ListEntities lists the entities of a knowledge base by degree
+	ListEntities(ctx context.Context,
+		knowledgeBaseID string, keyword string, page *types.Pagination) ([]*types.GraphEntity, int64, error)
+	// GetEntitiesByIDs gets entities of a knowledge base by id
+	GetEntitiesByIDs(ctx context.Context, knowledgeBaseID string, ids []string) ([]*types.GraphEntity, error)
+	// ListRelationshipsByEntityIDs lists the relationships starting or ending at the entities
+	ListRelationshipsByEntityIDs(ctx context.Context,
+		knowledgeBaseID string, entityIDs []string) ([]*types.GraphRelationship, error)
+	// GetGraph gets the whole graph of a knowledge base
+	GetGraph(ctx context.Context, knowledgeBaseID string) (*types.KnowledgeGraph, error)
+}
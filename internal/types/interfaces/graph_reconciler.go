@@ -0,0 +1,15 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/hibiken/asynq"
+)
+
+// GraphReconciler removes the references to deleted chunks left in the retrieval graph
+type GraphReconciler interface {
+	// Scan enqueues a reconcile task for every knowledge base.
+	Scan(ctx context.Context, t *asynq.Task) error
+	// Reconcile prunes the chunks that no longer exist from the graph of a knowledge base.
+	Reconcile(ctx context.Context, t *asynq.Task) error
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"mime/multipart"
+	"time"
 
 	"github.com/Tencent/WeKnora/internal/types"
 )
@@ -18,6 +19,13 @@ type KnowledgeService interface {
 		metadata map[string]string,
 		enableMultimodel *bool,
 	) (*types.Knowledge, error)
+	// ReplaceKnowledgeFile replaces the file of a knowledge and re-ingests only the changed chunks.
+	ReplaceKnowledgeFile(
+		ctx context.Context,
+		id string,
+		file *multipart.FileHeader,
+		enableMultimodel *bool,
+	) (*types.Knowledge, error)
 	// CreateKnowledgeFromURL creates knowledge from a URL.
 	CreateKnowledgeFromURL(ctx context.Context, kbID string, url string, enableMultimodel *bool) (*types.Knowledge, error)
 	// CreateKnowledgeFromPassage creates knowledge from text passages.
@@ -40,6 +48,8 @@ type KnowledgeService interface {
 	GetKnowledgeFile(ctx context.Context, id string) (io.ReadCloser, string, error)
 	// UpdateKnowledge updates knowledge information.
 	UpdateKnowledge(ctx context.Context, knowledge *types.Knowledge) error
+	// SetKnowledgeRefreshInterval sets the refresh interval in minutes of a URL knowledge, 0 disables refreshing.
+	SetKnowledgeRefreshInterval(ctx context.Context, id string, interval int) (*types.Knowledge, error)
 	// CloneKnowledgeBase clones knowledge to another knowledge base.
 	CloneKnowledgeBase(ctx context.Context, srcID, dstID string) error
 	// UpdateImageInfo updates image information for a knowledge chunk.
@@ -71,4 +81,12 @@ type KnowledgeRepository interface {
 	// AminusB returns the difference set of A and B.
 	AminusB(ctx context.Context, Atenant uint, A string, Btenant uint, B string) ([]string, error)
 	UpdateKnowledgeColumn(ctx context.Context, id string, column string, value interface{}) error
+	// UpdateKnowledgeColumns updates the given columns of a knowledge without touching the others
+	UpdateKnowledgeColumns(ctx context.Context, id string, columns map[string]interface{}) error
+	// ListKnowledgeDueForRefresh lists the URL knowledge of all tenants whose scheduled refresh is due
+	ListKnowledgeDueForRefresh(ctx context.Context, now time.Time, limit int) ([]*types.Knowledge, error)
+	// ListKnowledgeIDsByFilter lists at most limit IDs of the knowledge in the knowledge bases matching the search filter
+	ListKnowledgeIDsByFilter(ctx context.Context,
+		tenantID uint, kbIDs []string, filter *types.SearchFilter, limit int,
+	) ([]string, error)
 }
@@ -0,0 +1,20 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/hibiken/asynq"
+)
+
+// KnowledgeProcessor runs the persisted knowledge ingestion stages.
+// Every stage is an asynq task that enqueues the next stage once it succeeds.
+type KnowledgeProcessor interface {
+	// Parse reads the source document and persists its chunks.
+	Parse(ctx context.Context, t *asynq.Task) error
+	// Embed embeds the persisted chunks and writes them to the retrieve engines.
+	Embed(ctx context.Context, t *asynq.Task) error
+	// Summarize generates and indexes the document summary.
+	Summarize(ctx context.Context, t *asynq.Task) error
+	// Graph builds the knowledge graph and completes the ingestion.
+	Graph(ctx context.Context, t *asynq.Task) error
+}
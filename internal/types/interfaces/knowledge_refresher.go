@@ -0,0 +1,15 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/hibiken/asynq"
+)
+
+// KnowledgeRefresher re-fetches URL knowledge on their refresh schedule and re-ingests changed content
+type KnowledgeRefresher interface {
+	// Scan enqueues a refresh task for every URL knowledge whose scheduled refresh is due.
+	Scan(ctx context.Context, t *asynq.Task) error
+	// Refresh re-fetches the URL of a knowledge and re-ingests it when its content changed.
+	Refresh(ctx context.Context, t *asynq.Task) error
+}
@@ -61,6 +61,16 @@ type KnowledgeBaseService interface {
 	//   - Possible errors such as not existing, insufficient permissions, etc.
 	DeleteKnowledgeBase(ctx context.Context, id string) error
 
+	// SetEmbeddingModel switches the embedding model of a knowledge base
+	// Parameters:
+	//   - ctx: Context information
+	//   - id: Unique identifier of the knowledge base
+	//   - modelID: ID of the new embedding model
+	// Returns:
+	//   - Re-embedding job when existing chunks must be re-embedded, nil if the model was switched directly
+	//   - Possible errors such as not existing, an active re-embedding job, invalid model, etc.
+	SetEmbeddingModel(ctx context.Context, id string, modelID string) (*types.ReindexJob, error)
+
 	// HybridSearch performs hybrid search (vector + keywords) in the knowledge base
 	// Parameters:
 	//   - ctx: Context information
@@ -71,6 +81,16 @@ type KnowledgeBaseService interface {
 	//   - Possible errors such as not existing, insufficient permissions, search engine errors, etc.
 	HybridSearch(ctx context.Context, id string, params types.SearchParams) ([]*types.SearchResult, error)
 
+	// MultiHybridSearch performs hybrid search (vector + keywords) across several knowledge bases
+	// Parameters:
+	//   - ctx: Context information
+	//   - ids: Unique identifiers of the knowledge bases
+	//   - params: Search parameters, including query text, thresholds, etc.
+	// Returns:
+	//   - List of search results, scores are normalized per knowledge base when searching several of them
+	//   - Possible errors such as not existing, insufficient permissions, search engine errors, etc.
+	MultiHybridSearch(ctx context.Context, ids []string, params types.SearchParams) ([]*types.SearchResult, error)
+
 	// CopyKnowledgeBase copies a knowledge base
 	// Parameters:
 	//   - ctx: Context information
@@ -128,6 +148,16 @@ type KnowledgeBaseRepository interface {
 	//   - Possible errors such as record not existing, database errors, etc.
 	UpdateKnowledgeBase(ctx context.Context, kb *types.KnowledgeBase) error
 
+	// UpdateEmbeddingModel switches the embedding model of a knowledge base and of its knowledge,
+	// only the embedding model and update time columns are written
+	// Parameters:
+	//   - ctx: Context information
+	//   - id: Knowledge base ID
+	//   - modelID: Embedding model ID
+	// Returns:
+	//   - Possible errors such as record not existing, database errors, etc.
+	UpdateEmbeddingModel(ctx context.Context, id string, modelID string) error
+
 	// DeleteKnowledgeBase deletes a knowledge base record
 	// Parameters:
 	//   - ctx: Context information
@@ -0,0 +1,29 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// QuotaLimiter enforces the rate limits and quotas of the tenant of the context.
+// The limits are shared by all the replicas of the service
+type QuotaLimiter interface {
+	// AllowRequest counts a request against the requests per minute limit
+	AllowRequest(ctx context.Context) *types.QuotaDecision
+
+	// AllowDocument counts an ingested document against the documents per hour quota
+	AllowDocument(ctx context.Context) *types.QuotaDecision
+
+	// AcquireStream takes a slot of the concurrent streams limit, which is held until released
+	AcquireStream(ctx context.Context, streamID string) *types.QuotaDecision
+
+	// ReleaseStream releases the slot of a stream
+	ReleaseStream(ctx context.Context, streamID string)
+
+	// CheckTokens checks the tokens left of the tokens per day quota without consuming them
+	CheckTokens(ctx context.Context) *types.QuotaDecision
+
+	// ConsumeTokens counts the tokens consumed by a model call against the tokens per day quota
+	ConsumeTokens(ctx context.Context, tokens int)
+}
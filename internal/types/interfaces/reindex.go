@@ -0,0 +1,37 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Tencent/WeKnora/internal/types"
+	"github.com/hibiken/asynq"
+)
+
+// ReindexService re-embeds the chunks of a knowledge base when its embedding model changes
+type ReindexService interface {
+	// StartReindex creates a re-embedding job switching the knowledge base to the given embedding model
+	// The knowledge base keeps its current embedding model until the job swaps in the new vectors
+	StartReindex(ctx context.Context, kb *types.KnowledgeBase, modelID string) (*types.ReindexJob, error)
+	// GetReindexJob gets a re-embedding job of a knowledge base
+	GetReindexJob(ctx context.Context, knowledgeBaseID string, jobID string) (*types.ReindexJob, error)
+	// CancelReindexJob cancels a pending or running re-embedding job
+	CancelReindexJob(ctx context.Context, knowledgeBaseID string, jobID string) (*types.ReindexJob, error)
+	// Reindex handles the asynq task of a re-embedding job
+	Reindex(ctx context.Context, t *asynq.Task) error
+}
+
+// ReindexJobRepository persists re-embedding jobs
+type ReindexJobRepository interface {
+	// CreateJob creates a job
+	CreateJob(ctx context.Context, job *types.ReindexJob) error
+	// GetJobByID gets a job by id
+	GetJobByID(ctx context.Context, tenantID uint, id string) (*types.ReindexJob, error)
+	// GetActiveJobByKnowledgeBaseID gets the pending or running job of a knowledge base, nil if none
+	GetActiveJobByKnowledgeBaseID(ctx context.Context, tenantID uint, knowledgeBaseID string) (*types.ReindexJob, error)
+	// UpdateJobProgress saves the progress of a running job, false if the job is no longer running
+	UpdateJobProgress(ctx context.Context, job *types.ReindexJob) (bool, error)
+	// UpdateJobStatus moves a job from one of the given statuses to another, false if it was in none of them
+	UpdateJobStatus(ctx context.Context,
+		job *types.ReindexJob, from []types.ReindexJobStatus, to types.ReindexJobStatus,
+	) (bool, error)
+}
@@ -49,6 +49,13 @@ type RetrieveEngineRepository interface {
 	// DeleteByKnowledgeIDList deletes the index info by knowledge id list
 	DeleteByKnowledgeIDList(ctx context.Context, knowledgeIDList []string, dimension int) error
 
+	// DeleteByKnowledgeBaseID deletes the index info of a knowledge base
+	DeleteByKnowledgeBaseID(ctx context.Context, knowledgeBaseID string) error
+
+	// SwapKnowledgeBaseIndices replaces the index info of a knowledge base with the index info
+	// staged under stagingKnowledgeBaseID
+	SwapKnowledgeBaseIndices(ctx context.Context, knowledgeBaseID string, stagingKnowledgeBaseID string) error
+
 	// RetrieveEngine retrieves the engine
 	RetrieveEngine
 }
@@ -104,6 +111,13 @@ type RetrieveEngineService interface {
 	// DeleteByKnowledgeIDList deletes the index info by knowledge id list
 	DeleteByKnowledgeIDList(ctx context.Context, knowledgeIDList []string, dimension int) error
 
+	// DeleteByKnowledgeBaseID deletes the index info of a knowledge base
+	DeleteByKnowledgeBaseID(ctx context.Context, knowledgeBaseID string) error
+
+	// SwapKnowledgeBaseIndices replaces the index info of a knowledge base with the index info
+	// staged under stagingKnowledgeBaseID
+	SwapKnowledgeBaseIndices(ctx context.Context, knowledgeBaseID string, stagingKnowledgeBaseID string) error
+
 	// RetrieveEngine retrieves the engine
 	RetrieveEngine
 }
@@ -10,4 +10,12 @@ type RetrieveGraphRepository interface {
 	AddGraph(ctx context.Context, namespace types.NameSpace, graphs []*types.GraphData) error
 	DelGraph(ctx context.Context, namespace []types.NameSpace) error
 	SearchNode(ctx context.Context, namespace types.NameSpace, nodes []string) (*types.GraphData, error)
+	// SearchPath walks at most query.MaxHops relations from the nodes matching query.Entities
+	// and returns the best scored paths
+	SearchPath(ctx context.Context, namespace types.NameSpace, query *types.GraphPathQuery) ([]*types.GraphPath, error)
+	// DelChunks removes the chunks from the nodes of the namespace, nodes left without chunks by the delete are
+	// removed with their relations, as are their chunkless neighbours left without relations
+	DelChunks(ctx context.Context, namespace types.NameSpace, chunkIDs []string) error
+	// ListChunkIDs returns the distinct chunks referenced by the nodes of the namespace
+	ListChunkIDs(ctx context.Context, namespace types.NameSpace) ([]string, error)
 }
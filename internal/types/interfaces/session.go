@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	"github.com/Tencent/WeKnora/internal/types"
 )
@@ -22,14 +23,22 @@ type SessionService interface {
 	DeleteSession(ctx context.Context, id string) error
 	// GenerateTitle generates a title for the current conversation
 	GenerateTitle(ctx context.Context, sessionID string, messages []types.Message) (string, error)
+	// SummarizeHistory compresses the older rounds of a session into its conversation summary
+	SummarizeHistory(ctx context.Context, sessionID string) error
 	// KnowledgeQA performs knowledge-based question answering
 	KnowledgeQA(ctx context.Context,
-		sessionID, query string,
+		sessionID, query string, filter *types.SearchFilter,
 	) ([]*types.SearchResult, <-chan types.StreamResponse, error)
 	// KnowledgeQAByEvent performs knowledge-based question answering by event
 	KnowledgeQAByEvent(ctx context.Context, chatManage *types.ChatManage, eventList []types.EventType) error
+	// KnowledgeQAByPipeline performs knowledge-based question answering by the steps of a pipeline
+	KnowledgeQAByPipeline(ctx context.Context, chatManage *types.ChatManage, steps []types.PipelineStep) error
+	// ResolvePipeline resolves the pipeline of a session from the session, tenant and config
+	ResolvePipeline(ctx context.Context, session *types.Session) ([]types.PipelineStep, error)
 	// SearchKnowledge performs knowledge-based search, without summarization
-	SearchKnowledge(ctx context.Context, knowledgeBaseID, query string) ([]*types.SearchResult, error)
+	SearchKnowledge(ctx context.Context,
+		knowledgeBaseID, query string, filter *types.SearchFilter,
+	) ([]*types.SearchResult, error)
 }
 
 // SessionRepository defines the session repository interface
@@ -44,6 +53,9 @@ type SessionRepository interface {
 	GetPagedByTenantID(ctx context.Context, tenantID uint, page *types.Pagination) ([]*types.Session, int64, error)
 	// Update updates a session
 	Update(ctx context.Context, session *types.Session) error
+	// UpdateSummary updates the conversation summary of a session unless it already covers the rounds until the given time,
+	// it reports whether the summary was updated
+	UpdateSummary(ctx context.Context, tenantID uint, id string, summary string, until time.Time) (bool, error)
 	// Delete deletes a session
 	Delete(ctx context.Context, tenantID uint, id string) error
 }
@@ -16,6 +16,8 @@ type StreamInfo struct {
 	KnowledgeReferences types.References // knowledge references
 	LastUpdated         time.Time        // last updated time
 	IsCompleted         bool             // whether completed
+	IsFailed            bool             // whether failed
+	ErrorMessage        string           // error message of a failed stream
 }
 
 // StreamManager stream manager interface
@@ -29,6 +31,9 @@ type StreamManager interface {
 	// CompleteStream completes the stream
 	CompleteStream(ctx context.Context, sessionID, requestID string) error
 
+	// FailStream records the error of a failed stream
+	FailStream(ctx context.Context, sessionID, requestID string, errorMessage string) error
+
 	// GetStream gets a specific stream
 	GetStream(ctx context.Context, sessionID, requestID string) (*StreamInfo, error)
 }
@@ -0,0 +1,26 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Tencent/WeKnora/internal/types"
+)
+
+// UsageService defines operations for token usage accounting
+type UsageService interface {
+	// RecordUsage records the token usage of a model call, attributed to the tenant,
+	// session and knowledge of the context
+	RecordUsage(ctx context.Context,
+		usageType types.UsageType, modelID string, modelName string, usage *types.TokenUsage,
+	)
+	// GetUsageReport reports the token usage and cost of the tenant in a period
+	GetUsageReport(ctx context.Context, params *types.UsageReportParams) (*types.UsageReport, error)
+}
+
+// UsageRepository persists the token usage of model calls
+type UsageRepository interface {
+	// CreateUsageRecord creates a usage record
+	CreateUsageRecord(ctx context.Context, record *types.UsageRecord) error
+	// AggregateUsage sums the usage of a tenant in a period per model and the requested dimensions
+	AggregateUsage(ctx context.Context, params *types.UsageReportParams) ([]*types.UsageReportItem, error)
+}
@@ -1,6 +1,8 @@
 package types
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -54,6 +56,24 @@ type Knowledge struct {
 	ProcessedAt *time.Time `json:"processed_at"`
 	// Error message of the knowledge
 	ErrorMessage string `json:"error_message"`
+	// Current ingestion stage of the knowledge
+	ProcessStage KnowledgeProcessStage `json:"process_stage"`
+	// Progress of every ingestion stage
+	StageProgress KnowledgeStageProgress `json:"stage_progress" gorm:"type:json"`
+	// Generation of the content of the knowledge, incremented every time the content is replaced
+	Generation int64 `json:"generation"`
+	// Interval in minutes between two re-fetches of a URL knowledge, 0 disables refreshing
+	RefreshInterval int `json:"refresh_interval"`
+	// Time of the next scheduled re-fetch of a URL knowledge
+	NextRefreshAt *time.Time `json:"next_refresh_at" gorm:"index"`
+	// ETag returned by the source of a URL knowledge when it was last fetched
+	ETag string `json:"etag" gorm:"column:etag"`
+	// Hash of the content of a URL knowledge when it was last fetched
+	ContentHash string `json:"content_hash"`
+	// Last time the source of a URL knowledge was checked for changes
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+	// Last time a change of the source of a URL knowledge was detected
+	LastChangedAt *time.Time `json:"last_changed_at"`
 	// Deletion time of the knowledge
 	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
@@ -77,6 +97,70 @@ func (k *Knowledge) BeforeCreate(tx *gorm.DB) (err error) {
 	return nil
 }
 
+// KnowledgeProcessStage represents a stage of the knowledge ingestion pipeline
+type KnowledgeProcessStage string
+
+const (
+	// KnowledgeStageParse reads the source document and splits it into chunks
+	KnowledgeStageParse KnowledgeProcessStage = "parse"
+	// KnowledgeStageEmbed embeds the chunks and writes them to the retrieve engines
+	KnowledgeStageEmbed KnowledgeProcessStage = "embed"
+	// KnowledgeStageSummarize generates the document summary chunk
+	KnowledgeStageSummarize KnowledgeProcessStage = "summarize"
+	// KnowledgeStageGraph builds the knowledge graph and dispatches extract tasks
+	KnowledgeStageGraph KnowledgeProcessStage = "graph"
+)
+
+// StageProgress records the execution state of a single ingestion stage
+type StageProgress struct {
+	// Status of the stage: processing, completed or failed
+	Status string `json:"status"`
+	// Number of attempts made so far
+	Attempts int `json:"attempts"`
+	// Error message of the last failed attempt
+	Error string `json:"error,omitempty"`
+	// Start time of the last attempt
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// Finish time of the stage
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// KnowledgeStageProgress maps every ingestion stage to its progress
+type KnowledgeStageProgress map[KnowledgeProcessStage]*StageProgress
+
+// Value implements the driver.Valuer interface, used to convert KnowledgeStageProgress to database value
+func (p KnowledgeStageProgress) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return json.Marshal(p)
+}
+
+// Scan implements the sql.Scanner interface, used to convert database value to KnowledgeStageProgress
+func (p *KnowledgeStageProgress) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(b, p)
+}
+
+// Stage returns the progress of the given stage, creating it if necessary
+func (k *Knowledge) Stage(stage KnowledgeProcessStage) *StageProgress {
+	if k.StageProgress == nil {
+		k.StageProgress = KnowledgeStageProgress{}
+	}
+	progress, ok := k.StageProgress[stage]
+	if !ok {
+		progress = &StageProgress{}
+		k.StageProgress[stage] = progress
+	}
+	return progress
+}
+
 // KnowledgeCheckParams defines parameters used to check if knowledge already exists.
 type KnowledgeCheckParams struct {
 	// File parameters
@@ -0,0 +1,29 @@
+package types
+
+const (
+	TypeKnowledgeParse     = "knowledge:parse"
+	TypeKnowledgeEmbed     = "knowledge:embed"
+	TypeKnowledgeSummarize = "knowledge:summarize"
+	TypeKnowledgeGraph     = "knowledge:graph"
+
+	TypeKnowledgeRefreshScan = "knowledge:refresh_scan"
+	TypeKnowledgeRefresh     = "knowledge:refresh"
+)
+
+// KnowledgeProcessPayload is the payload shared by all knowledge ingestion tasks
+type KnowledgeProcessPayload struct {
+	TenantID         uint     `json:"tenant_id"`
+	KnowledgeID      string   `json:"knowledge_id"`
+	RequestID        string   `json:"request_id"`
+	EnableMultimodel bool     `json:"enable_multimodel"`
+	Passages         []string `json:"passages,omitempty"`
+	// Generation is set when the content of an existing knowledge is replaced,
+	// only the chunks created for this generation of the content are embedded again
+	Generation int64 `json:"generation,omitempty"`
+}
+
+// KnowledgeRefreshPayload is the payload of the refresh task of a URL knowledge
+type KnowledgeRefreshPayload struct {
+	TenantID    uint   `json:"tenant_id"`
+	KnowledgeID string `json:"knowledge_id"`
+}
@@ -3,6 +3,7 @@ package types
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
@@ -66,6 +67,44 @@ type ChunkingConfig struct {
 	Separators []string `yaml:"separators" json:"separators"`
 	// Enable multimodal
 	EnableMultimodal bool `yaml:"enable_multimodal" json:"enable_multimodal"`
+	// Chunking strategy, the recursive splitter when empty
+	Strategy ChunkingStrategy `yaml:"strategy" json:"strategy,omitempty"`
+	// Size of the parent chunks of the parent_child strategy, ChunkSize is the size of the child chunks
+	ParentChunkSize int `yaml:"parent_chunk_size" json:"parent_chunk_size,omitempty"`
+	// Percentile of the distances between neighbouring sentences above which the semantic strategy
+	// starts a new chunk
+	BreakpointPercentile int `yaml:"breakpoint_percentile" json:"breakpoint_percentile,omitempty"`
+}
+
+// ChunkingStrategy represents how documents are split into chunks
+type ChunkingStrategy string
+
+const (
+	// ChunkingStrategyRecursive splits the text recursively at the separators
+	ChunkingStrategyRecursive ChunkingStrategy = "recursive"
+	// ChunkingStrategyHeading splits the text at its Markdown and HTML headings, keeping the section hierarchy
+	ChunkingStrategyHeading ChunkingStrategy = "heading"
+	// ChunkingStrategySemantic cuts the text where the embeddings of neighbouring sentences diverge
+	ChunkingStrategySemantic ChunkingStrategy = "semantic"
+	// ChunkingStrategyParentChild retrieves small child chunks and answers with the parent section
+	ChunkingStrategyParentChild ChunkingStrategy = "parent_child"
+)
+
+// Validate checks the chunking strategy and its parameters
+func (c *ChunkingConfig) Validate() error {
+	switch c.Strategy {
+	case "", ChunkingStrategyRecursive, ChunkingStrategyHeading, ChunkingStrategySemantic:
+	case ChunkingStrategyParentChild:
+		if c.ParentChunkSize != 0 && c.ParentChunkSize <= c.ChunkSize {
+			return fmt.Errorf("parent chunk size %d must be larger than chunk size %d", c.ParentChunkSize, c.ChunkSize)
+		}
+	default:
+		return fmt.Errorf("unknown chunking strategy: %s", c.Strategy)
+	}
+	if c.BreakpointPercentile < 0 || c.BreakpointPercentile > 100 {
+		return fmt.Errorf("breakpoint percentile must be between 0 and 100, got %d", c.BreakpointPercentile)
+	}
+	return nil
 }
 
 // COSConfig represents the COS configuration
@@ -36,6 +36,10 @@ type Message struct {
 	KnowledgeReferences References `json:"knowledge_references" gorm:"type:json,column:knowledge_references"`
 	// Whether message generation is complete
 	IsCompleted bool `json:"is_completed"`
+	// Whether message generation failed, the content is then the part generated before the failure
+	IsFailed bool `json:"is_failed"`
+	// Error that ended the generation of a failed message
+	ErrorMessage string `json:"error_message,omitempty"`
 	// Message creation timestamp
 	CreatedAt time.Time `json:"created_at"`
 	// Last update timestamp
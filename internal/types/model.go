@@ -31,20 +31,67 @@ const (
 type ModelSource string
 
 const (
-	ModelSourceLocal  ModelSource = "local"  // Local model
-	ModelSourceRemote ModelSource = "remote" // Remote model
-	ModelSourceAliyun ModelSource = "aliyun" // Aliyun DashScope model
+	ModelSourceLocal       ModelSource = "local"        // Local model
+	ModelSourceRemote      ModelSource = "remote"       // Remote model
+	ModelSourceAliyun      ModelSource = "aliyun"       // Aliyun DashScope model
+	ModelSourceRoute       ModelSource = "route"        // Route over several models of the same type
+	ModelSourceAnthropic   ModelSource = "anthropic"    // Anthropic Messages API chat model
+	ModelSourceGemini      ModelSource = "gemini"       // Google Gemini API chat model
+	ModelSourceAzureOpenAI ModelSource = "azure_openai" // Azure OpenAI deployment
 )
 
+// ModelRouteStrategy is how a model route picks the model that serves a call
+type ModelRouteStrategy string
+
+const (
+	// ModelRouteStrategyPriority calls the models by ascending priority, the later ones as fallback
+	ModelRouteStrategyPriority ModelRouteStrategy = "priority"
+	// ModelRouteStrategyWeighted spreads the calls over the models by weighted round-robin,
+	// the other models as fallback by ascending priority
+	ModelRouteStrategyWeighted ModelRouteStrategy = "weighted"
+)
+
+// ModelRouteTarget is a model of a route
+type ModelRouteTarget struct {
+	// ID of the model, which must have the type of the route
+	ModelID string `yaml:"model_id" json:"model_id"`
+	// Priority of the model, lower values are called first
+	Priority int `yaml:"priority" json:"priority"`
+	// Weight of the model in weighted round-robin, at least 1
+	Weight int `yaml:"weight" json:"weight"`
+}
+
+// ModelRoute groups several models of the same type behind one model, embedding models of a route
+// must have identical dimensions
+type ModelRoute struct {
+	// Strategy to pick the model of a call, priority by default
+	Strategy ModelRouteStrategy `yaml:"strategy" json:"strategy"`
+	// Models of the route
+	Targets []ModelRouteTarget `yaml:"targets" json:"targets"`
+	// Number of models tried by a call before giving up, all of them when zero
+	MaxAttempts int `yaml:"max_attempts" json:"max_attempts,omitempty"`
+}
+
 type EmbeddingParameters struct {
 	Dimension            int `yaml:"dimension" json:"dimension"`
 	TruncatePromptTokens int `yaml:"truncate_prompt_tokens" json:"truncate_prompt_tokens"`
 }
 
+// DefaultContextWindow is the context window assumed for chat models that do not declare one
+const DefaultContextWindow = 8192
+
 type ModelParameters struct {
 	BaseURL             string              `yaml:"base_url" json:"base_url"`
 	APIKey              string              `yaml:"api_key" json:"api_key"`
 	EmbeddingParameters EmbeddingParameters `yaml:"embedding_parameters" json:"embedding_parameters"`
+	// Number of tokens the chat model accepts, prompt and completion included
+	ContextWindow int `yaml:"context_window" json:"context_window,omitempty"`
+	// Models grouped by a model of the route source
+	Route *ModelRoute `yaml:"route" json:"route,omitempty"`
+	// API version of the endpoint, used by Azure OpenAI deployments
+	APIVersion string `yaml:"api_version" json:"api_version,omitempty"`
+	// Do not ask for the token usage of streamed answers, for OpenAI compatible services rejecting stream_options
+	NoStreamUsage bool `yaml:"no_stream_usage" json:"no_stream_usage,omitempty"`
 }
 
 // Model represents the AI model
@@ -75,6 +122,14 @@ type Model struct {
 	DeletedAt gorm.DeletedAt `yaml:"deleted_at" json:"deleted_at" gorm:"index"`
 }
 
+// GetContextWindow returns the context window of the model, or the default when the model does not declare one
+func (m *Model) GetContextWindow() int {
+	if m.Parameters.ContextWindow > 0 {
+		return m.Parameters.ContextWindow
+	}
+	return DefaultContextWindow
+}
+
 // Value implements the driver.Valuer interface, used to convert ModelParameters to database value
 func (c ModelParameters) Value() (driver.Value, error) {
 	return json.Marshal(c)
@@ -0,0 +1,61 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+)
+
+// DefaultPipelineName is the pipeline used when neither the session, the tenant nor the config selects one
+const DefaultPipelineName = "rag_stream"
+
+// PipelineStep is a single event of a pipeline declaration
+type PipelineStep struct {
+	// Event triggered by the step
+	Event EventType `yaml:"event" json:"event"`
+	// Params overrides the ChatManage fields of the same json name before the event is triggered,
+	// e.g. {"rerank_top_k": 5} or {"embedding_top_k": 20}
+	Params map[string]interface{} `yaml:"params" json:"params,omitempty"`
+}
+
+// PipelineConfig selects the pipeline of a session or tenant
+// Steps declares the pipeline inline, otherwise Name refers to a built-in or configured pipeline
+type PipelineConfig struct {
+	// Name of a built-in or configured pipeline
+	Name string `yaml:"name" json:"name,omitempty"`
+	// Inline pipeline declaration, takes precedence over Name
+	Steps []PipelineStep `yaml:"steps" json:"steps,omitempty"`
+}
+
+// IsEmpty reports whether the config selects no pipeline
+func (c *PipelineConfig) IsEmpty() bool {
+	return c == nil || (c.Name == "" && len(c.Steps) == 0)
+}
+
+// Value implements the driver.Valuer interface, used to convert PipelineConfig to database value
+func (c *PipelineConfig) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	return json.Marshal(c)
+}
+
+// Scan implements the sql.Scanner interface, used to convert database value to PipelineConfig
+func (c *PipelineConfig) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(b, c)
+}
+
+// PipelineSteps converts a list of events to pipeline steps without parameters
+func PipelineSteps(events []EventType) []PipelineStep {
+	steps := make([]PipelineStep, 0, len(events))
+	for _, event := range events {
+		steps = append(steps, PipelineStep{Event: event})
+	}
+	return steps
+}
@@ -0,0 +1,70 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// TenantRateLimits are the rate limits and quotas of a tenant, a zero limit is unlimited
+type TenantRateLimits struct {
+	// Requests per minute to the chat, search and ingestion APIs
+	RequestsPerMinute int64 `yaml:"requests_per_minute" json:"requests_per_minute"`
+	// Chat streams generated at the same time
+	ConcurrentStreams int64 `yaml:"concurrent_streams" json:"concurrent_streams"`
+	// Model tokens consumed per day, reset at midnight
+	TokensPerDay int64 `yaml:"tokens_per_day" json:"tokens_per_day"`
+	// Documents ingested per hour
+	DocumentsPerHour int64 `yaml:"documents_per_hour" json:"documents_per_hour"`
+}
+
+// Value implements the driver.Valuer interface, used to convert TenantRateLimits to database value
+func (l *TenantRateLimits) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	return json.Marshal(l)
+}
+
+// Scan implements the sql.Scanner interface, used to convert database value to TenantRateLimits
+func (l *TenantRateLimits) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(b, l)
+}
+
+// QuotaDecision is the outcome of counting a request against a rate limit or quota
+type QuotaDecision struct {
+	// Whether the request is allowed
+	Allowed bool
+	// Limit of the current window, zero when unlimited
+	Limit int64
+	// Remaining requests, streams, tokens or documents of the current window
+	Remaining int64
+	// Time at which the current window resets
+	ResetAt time.Time
+}
+
+// Unlimited returns whether no limit applies
+func (d *QuotaDecision) Unlimited() bool {
+	return d.Limit <= 0
+}
+
+// RetryAfter returns how long to wait before retrying a rejected request, at least a second
+func (d *QuotaDecision) RetryAfter(now time.Time) time.Duration {
+	wait := d.ResetAt.Sub(now).Round(time.Second)
+	if wait < time.Second {
+		return time.Second
+	}
+	return wait
+}
+
+// UnlimitedQuota is the decision for a request that no limit applies to
+func UnlimitedQuota() *QuotaDecision {
+	return &QuotaDecision{Allowed: true}
+}
@@ -0,0 +1,68 @@
+package types
+
+import "time"
+
+const (
+	TypeKnowledgeBaseReindex = "knowledge_base:reindex"
+)
+
+// ReindexJobStatus represents the status of a re-embedding job
+type ReindexJobStatus string
+
+const (
+	ReindexJobPending   ReindexJobStatus = "pending"
+	ReindexJobRunning   ReindexJobStatus = "running"
+	ReindexJobCompleted ReindexJobStatus = "completed"
+	ReindexJobFailed    ReindexJobStatus = "failed"
+	ReindexJobCancelled ReindexJobStatus = "cancelled"
+)
+
+// ReindexJob re-embeds every enabled chunk of a knowledge base with a new embedding model
+// The new vectors are staged under the job ID and swapped in once all chunks are embedded,
+// so searches keep using the old vectors until the job completes
+type ReindexJob struct {
+	// Unique identifier of the job, also used as the staging knowledge base ID of the new vectors
+	ID string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	// Tenant ID
+	TenantID uint `json:"tenant_id"`
+	// ID of the knowledge base being re-embedded
+	KnowledgeBaseID string `json:"knowledge_base_id"`
+	// Embedding model used before the job
+	FromModelID string `json:"from_model_id"`
+	// Embedding model the knowledge base switches to
+	ToModelID string `json:"to_model_id"`
+	// Job status
+	Status ReindexJobStatus `json:"status"`
+	// Number of chunks to re-embed, estimated when the job is created
+	TotalChunks int64 `json:"total_chunks"`
+	// Number of chunks re-embedded so far
+	ProcessedChunks int64 `json:"processed_chunks"`
+	// Creation time of the last re-embedded chunk, used to resume the job
+	LastChunkCreatedAt *time.Time `json:"-"`
+	// ID of the last re-embedded chunk, used to resume the job
+	LastChunkID string `json:"-"`
+	// Error message of a failed job
+	ErrorMessage string `json:"error_message"`
+	// Creation time of the job
+	CreatedAt time.Time `json:"created_at"`
+	// Last updated time of the job
+	UpdatedAt time.Time `json:"updated_at"`
+	// Time the job finished, whatever the outcome
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// Finished reports whether the job reached a terminal status
+func (j *ReindexJob) Finished() bool {
+	switch j.Status {
+	case ReindexJobCompleted, ReindexJobFailed, ReindexJobCancelled:
+		return true
+	}
+	return false
+}
+
+// ReindexPayload is the payload of the knowledge base re-embedding task
+type ReindexPayload struct {
+	TenantID  uint   `json:"tenant_id"`
+	JobID     string `json:"job_id"`
+	RequestID string `json:"request_id"`
+}
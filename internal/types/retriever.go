@@ -1,5 +1,10 @@
 package types
 
+import (
+	"errors"
+	"fmt"
+)
+
 // RetrieverEngineType represents the type of retriever engine
 type RetrieverEngineType string
 
@@ -21,6 +26,32 @@ const (
 	WebSearchRetrieverType RetrieverType = "websearch" // Web search retriever
 )
 
+// FusionStrategy represents how results from different retrievers are merged
+type FusionStrategy string
+
+// FusionStrategy constants
+const (
+	// FusionStrategyConcat concatenates results and keeps the raw retriever scores
+	FusionStrategyConcat FusionStrategy = "concat"
+	// FusionStrategyRRF ranks results by reciprocal rank fusion
+	FusionStrategyRRF FusionStrategy = "rrf"
+	// FusionStrategyWeighted ranks results by the weighted sum of min-max normalized scores
+	FusionStrategyWeighted FusionStrategy = "weighted"
+)
+
+// ValidateFusion checks that the fusion strategy is known and that the weights of the retrievers are not negative
+func ValidateFusion(strategy FusionStrategy, vectorWeight, keywordWeight float64) error {
+	switch strategy {
+	case "", FusionStrategyConcat, FusionStrategyRRF, FusionStrategyWeighted:
+	default:
+		return fmt.Errorf("unknown fusion strategy %q", strategy)
+	}
+	if vectorWeight < 0 || keywordWeight < 0 {
+		return errors.New("vector_weight and keyword_weight cannot be negative")
+	}
+	return nil
+}
+
 // RetrieveParams represents the parameters for retrieval
 type RetrieveParams struct {
 	// Query text
@@ -29,6 +60,8 @@ type RetrieveParams struct {
 	Embedding []float32
 	// Knowledge base IDs
 	KnowledgeBaseIDs []string
+	// Knowledge IDs, only the given knowledge is retrieved if not empty
+	KnowledgeIDs []string
 	// Excluded knowledge IDs
 	ExcludeKnowledgeIDs []string
 	// Excluded chunk IDs
@@ -3,6 +3,7 @@ package types
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"time"
 )
 
 // SearchResult represents the search result
@@ -46,6 +47,10 @@ type SearchResult struct {
 	// Knowledge source
 	// Used to indicate the source of the knowledge, such as "url"
 	KnowledgeSource string `json:"knowledge_source"`
+
+	// Graph path
+	// Used for graph matched chunks, the knowledge graph path the chunk was retrieved along
+	GraphPath *GraphPath `json:"graph_path,omitempty"`
 }
 
 // SearchParams represents the search parameters
@@ -54,6 +59,47 @@ type SearchParams struct {
 	VectorThreshold  float64 `json:"vector_threshold"`
 	KeywordThreshold float64 `json:"keyword_threshold"`
 	MatchCount       int     `json:"match_count"`
+	// FusionStrategy decides how vector and keyword results are merged, empty means concat
+	FusionStrategy FusionStrategy `json:"fusion_strategy"`
+	// VectorWeight is the weight of vector results in rrf and weighted fusion
+	VectorWeight float64 `json:"vector_weight"`
+	// KeywordWeight is the weight of keyword results in rrf and weighted fusion
+	KeywordWeight float64 `json:"keyword_weight"`
+	// Filter restricts the search to knowledge matching the filter
+	Filter *SearchFilter `json:"filter,omitempty"`
+}
+
+// MaxSearchFilterKnowledge is the maximum number of knowledge IDs passed to the retrieve engines, which bound
+// the size of their ID lists. The results of a search filter matching more knowledge are filtered after retrieval
+const MaxSearchFilterKnowledge = 10000
+
+// SearchFilter represents the metadata filter of a search, all conditions are combined with AND
+type SearchFilter struct {
+	// Only search the given knowledge
+	KnowledgeIDs []string `json:"knowledge_ids,omitempty"`
+	// Only search knowledge of the given file types, e.g. pdf, docx
+	FileTypes []string `json:"file_types,omitempty"`
+	// Only search knowledge tagged with all the given tags,
+	// tags are read from the comma separated "tags" metadata of the knowledge
+	Tags []string `json:"tags,omitempty"`
+	// Only search knowledge created at or after the given time
+	CreatedAfter *time.Time `json:"created_after,omitempty"`
+	// Only search knowledge created before the given time
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+	// Only search knowledge whose metadata contains all the given key-value pairs
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// IsEmpty returns true if the filter has no condition
+func (f *SearchFilter) IsEmpty() bool {
+	return f == nil || (len(f.KnowledgeIDs) == 0 && !f.HasKnowledgeConditions())
+}
+
+// HasKnowledgeConditions returns true if the filter has conditions on knowledge attributes,
+// which must be resolved against the knowledge table before retrieval
+func (f *SearchFilter) HasKnowledgeConditions() bool {
+	return f != nil && (len(f.FileTypes) > 0 || len(f.Tags) > 0 ||
+		f.CreatedAfter != nil || f.CreatedBefore != nil || len(f.Metadata) > 0)
 }
 
 // Value implements the driver.Valuer interface, used to convert SearchResult to database value
@@ -3,6 +3,7 @@ package types
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -44,6 +45,15 @@ type SummaryConfig struct {
 	MaxCompletionTokens int `json:"max_completion_tokens"`
 }
 
+// QueryExpansion configures the expansion of the query before retrieval,
+// every expansion is searched besides the query and the results are fused
+type QueryExpansion struct {
+	// Number of paraphrases of the query to search, 0 disables paraphrasing
+	Paraphrases int `json:"paraphrases"`
+	// Whether to search a hypothetical answer passage generated for the query (HyDE)
+	HyDE bool `json:"hyde"`
+}
+
 // Session represents the session
 type Session struct {
 	// ID
@@ -57,6 +67,7 @@ type Session struct {
 
 	// Strategy configuration
 	KnowledgeBaseID   string           `json:"knowledge_base_id"`                   // 关联的知识库ID
+	KnowledgeBaseIDs  StringArray      `json:"knowledge_base_ids" gorm:"type:json"` // 关联的全部知识库ID
 	MaxRounds         int              `json:"max_rounds"`                          // 多轮保持轮数
 	EnableRewrite     bool             `json:"enable_rewrite"`                      // 多轮改写开关
 	FallbackStrategy  FallbackStrategy `json:"fallback_strategy"`                   // 兜底策略
@@ -64,11 +75,18 @@ type Session struct {
 	EmbeddingTopK     int              `json:"embedding_top_k"`                     // 向量召回TopK
 	KeywordThreshold  float64          `json:"keyword_threshold"`                   // 关键词召回阈值
 	VectorThreshold   float64          `json:"vector_threshold"`                    // 向量召回阈值
+	FusionStrategy    FusionStrategy   `json:"fusion_strategy"`                     // 混合召回融合策略
+	VectorWeight      float64          `json:"vector_weight"`                       // 向量召回融合权重
+	KeywordWeight     float64          `json:"keyword_weight"`                      // 关键词召回融合权重
 	RerankModelID     string           `json:"rerank_model_id"`                     // 排序模型ID
 	RerankTopK        int              `json:"rerank_top_k"`                        // 排序TopK
 	RerankThreshold   float64          `json:"rerank_threshold"`                    // 排序阈值
 	SummaryModelID    string           `json:"summary_model_id"`                    // 总结模型ID
 	SummaryParameters *SummaryConfig   `json:"summary_parameters" gorm:"type:json"` // 总结模型参数
+	Pipeline          *PipelineConfig  `json:"pipeline" gorm:"type:json"`           // 对话流水线，为空时使用租户或全局配置
+	QueryExpansion    *QueryExpansion  `json:"query_expansion" gorm:"type:json"`    // 查询扩展，为空时不扩展
+	Summary           string           `json:"summary"`                             // 早期对话的滚动摘要
+	SummaryUntil      *time.Time       `json:"summary_until"`                       // 已压缩进摘要的最后一轮对话时间
 
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
@@ -83,6 +101,21 @@ func (s *Session) BeforeCreate(tx *gorm.DB) (err error) {
 	return nil
 }
 
+// GetKnowledgeBaseIDs returns the IDs of all knowledge bases associated with the session,
+// sessions created before multi knowledge base support only have KnowledgeBaseID
+func (s *Session) GetKnowledgeBaseIDs() []string {
+	ids := make([]string, 0, len(s.KnowledgeBaseIDs)+1)
+	if s.KnowledgeBaseID != "" {
+		ids = append(ids, s.KnowledgeBaseID)
+	}
+	for _, id := range s.KnowledgeBaseIDs {
+		if id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 type StringArray []string
 
 // Value implements the driver.Valuer interface, used to convert StringArray to database value
@@ -118,3 +151,23 @@ func (c *SummaryConfig) Scan(value interface{}) error {
 	}
 	return json.Unmarshal(b, c)
 }
+
+// Value implements the driver.Valuer interface, used to convert QueryExpansion to database value
+func (c *QueryExpansion) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	return json.Marshal(c)
+}
+
+// Scan implements the sql.Scanner interface, used to convert database value to QueryExpansion
+func (c *QueryExpansion) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(b, c)
+}
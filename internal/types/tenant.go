@@ -32,6 +32,10 @@ type Tenant struct {
 	StorageQuota int64 `yaml:"storage_quota" json:"storage_quota" gorm:"default:10737418240"`
 	// Storage used (Bytes)
 	StorageUsed int64 `yaml:"storage_used" json:"storage_used" gorm:"default:0"`
+	// Chat pipeline of the tenant's sessions that do not select one
+	Pipeline *PipelineConfig `yaml:"pipeline" json:"pipeline" gorm:"type:json"`
+	// Rate limits and quotas of the tenant, the configured defaults apply when empty
+	RateLimits *TenantRateLimits `yaml:"rate_limits" json:"rate_limits" gorm:"type:json"`
 	// Creation time
 	CreatedAt time.Time `yaml:"created_at" json:"created_at"`
 	// Last updated time
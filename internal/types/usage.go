@@ -0,0 +1,110 @@
+package types
+
+import "time"
+
+// TokenUsage is the number of tokens consumed by a model call
+type TokenUsage struct {
+	// Prompt tokens
+	PromptTokens int `json:"prompt_tokens"`
+	// Completion tokens
+	CompletionTokens int `json:"completion_tokens"`
+	// Total tokens
+	TotalTokens int `json:"total_tokens"`
+}
+
+// UsageType is the kind of model call the usage was consumed by
+type UsageType string
+
+const (
+	UsageTypeChat      UsageType = "chat"      // chat completion
+	UsageTypeEmbedding UsageType = "embedding" // text embedding
+	UsageTypeRerank    UsageType = "rerank"    // document reranking
+)
+
+// UsageRecord is the token usage of a single model call, attributed to the tenant,
+// session and knowledge it was consumed for
+type UsageRecord struct {
+	// Unique identifier of the record
+	ID uint64 `json:"id" gorm:"primaryKey;autoIncrement"`
+	// Tenant ID
+	TenantID uint `json:"tenant_id" gorm:"index:idx_usage_tenant_created"`
+	// Session ID, empty when the call was not made for a conversation
+	SessionID string `json:"session_id" gorm:"type:varchar(36);index"`
+	// Knowledge ID, empty when the call was not made for processing a knowledge
+	KnowledgeID string `json:"knowledge_id" gorm:"type:varchar(36);index"`
+	// Model ID
+	ModelID string `json:"model_id" gorm:"type:varchar(64)"`
+	// Model name
+	ModelName string `json:"model_name" gorm:"type:varchar(255)"`
+	// Kind of the model call
+	Type UsageType `json:"type" gorm:"type:varchar(32)"`
+	// Prompt tokens, the input tokens of embedding and rerank calls
+	PromptTokens int `json:"prompt_tokens"`
+	// Completion tokens
+	CompletionTokens int `json:"completion_tokens"`
+	// Total tokens
+	TotalTokens int `json:"total_tokens"`
+	// Time of the model call
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_usage_tenant_created"`
+}
+
+// UsageGroupBy is a dimension the usage report can be grouped by
+type UsageGroupBy string
+
+const (
+	UsageGroupByDay    UsageGroupBy = "day"    // calendar day of the model call
+	UsageGroupByModel  UsageGroupBy = "model"  // model and kind of the model call
+	UsageGroupByTenant UsageGroupBy = "tenant" // tenant the usage is attributed to, for usage admin tenants
+)
+
+// UsageReportParams are the parameters of a usage report
+type UsageReportParams struct {
+	// Tenant ID
+	TenantID uint
+	// Report the usage of every tenant instead of the tenant ID
+	AllTenants bool
+	// Start of the reported period, inclusive
+	StartTime time.Time
+	// End of the reported period, exclusive
+	EndTime time.Time
+	// Dimensions the usage is grouped by
+	GroupBy []UsageGroupBy
+}
+
+// UsageReportItem is the usage of one group of a usage report
+type UsageReportItem struct {
+	// Day of the group, formatted as 2006-01-02, set when grouped by day
+	Day string `json:"day,omitempty"`
+	// Tenant ID, set when grouped by tenant
+	TenantID uint `json:"tenant_id,omitempty"`
+	// Model ID, set when grouped by model
+	ModelID string `json:"model_id,omitempty"`
+	// Model name, set when grouped by model
+	ModelName string `json:"model_name,omitempty"`
+	// Kind of the model calls, set when grouped by model
+	Type UsageType `json:"type,omitempty"`
+	// Number of model calls
+	Calls int64 `json:"calls"`
+	// Prompt tokens
+	PromptTokens int64 `json:"prompt_tokens"`
+	// Completion tokens
+	CompletionTokens int64 `json:"completion_tokens"`
+	// Total tokens
+	TotalTokens int64 `json:"total_tokens"`
+	// Cost of the tokens at the configured model prices
+	Cost float64 `json:"cost"`
+}
+
+// UsageReport is the token usage and cost of a period
+type UsageReport struct {
+	// Start of the reported period
+	StartTime time.Time `json:"start_time"`
+	// End of the reported period
+	EndTime time.Time `json:"end_time"`
+	// Currency of the costs
+	Currency string `json:"currency"`
+	// Usage of each group
+	Items []*UsageReportItem `json:"items"`
+	// Total usage of the period
+	Total *UsageReportItem `json:"total"`
+}
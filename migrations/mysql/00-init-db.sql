@@ -16,6 +16,8 @@ CREATE TABLE tenants (
     business VARCHAR(255) NOT NULL,
     storage_quota BIGINT NOT NULL DEFAULT 10737418240,
     storage_used BIGINT NOT NULL DEFAULT 0,
+    pipeline JSON,
+    rate_limits JSON,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP NULL DEFAULT NULL
@@ -81,10 +83,20 @@ CREATE TABLE knowledges (
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP NULL DEFAULT NULL,
     processed_at TIMESTAMP,
-    error_message TEXT
+    error_message TEXT,
+    process_stage VARCHAR(32),
+    stage_progress JSON,
+    generation BIGINT NOT NULL DEFAULT 0,
+    refresh_interval INT NOT NULL DEFAULT 0,
+    next_refresh_at TIMESTAMP NULL DEFAULT NULL,
+    etag VARCHAR(255),
+    content_hash VARCHAR(64),
+    last_checked_at TIMESTAMP NULL DEFAULT NULL,
+    last_changed_at TIMESTAMP NULL DEFAULT NULL
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 CREATE INDEX idx_knowledges_tenant_id ON knowledges(tenant_id, knowledge_base_id);
+CREATE INDEX idx_knowledges_next_refresh_at ON knowledges(next_refresh_at);
 
 CREATE TABLE sessions (
     id VARCHAR(36) PRIMARY KEY,
@@ -92,18 +104,26 @@ CREATE TABLE sessions (
     title VARCHAR(255),
     description TEXT,
     knowledge_base_id VARCHAR(36),
+    knowledge_base_ids JSON,
     max_rounds INT NOT NULL DEFAULT 5,
     enable_rewrite BOOLEAN NOT NULL DEFAULT TRUE,
     fallback_strategy VARCHAR(255) NOT NULL DEFAULT 'fixed',
     fallback_response VARCHAR(255) NOT NULL DEFAULT '很抱歉，我暂时无法回答这个问题。',
     keyword_threshold FLOAT NOT NULL DEFAULT 0.5,
     vector_threshold FLOAT NOT NULL DEFAULT 0.5,
+    fusion_strategy VARCHAR(32) NOT NULL DEFAULT 'concat',
+    vector_weight FLOAT NOT NULL DEFAULT 0.5,
+    keyword_weight FLOAT NOT NULL DEFAULT 0.5,
     rerank_model_id VARCHAR(64),
     embedding_top_k INTEGER NOT NULL DEFAULT 10,
     rerank_top_k INTEGER NOT NULL DEFAULT 10,
     rerank_threshold FLOAT NOT NULL DEFAULT 0.65,
     summary_model_id VARCHAR(64),
     summary_parameters JSON NOT NULL,
+    pipeline JSON,
+    summary TEXT,
+    summary_until TIMESTAMP NULL DEFAULT NULL,
+    query_expansion JSON,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP NULL DEFAULT NULL
@@ -119,6 +139,8 @@ CREATE TABLE messages (
     content TEXT NOT NULL,
     knowledge_references JSON NOT NULL,
     is_completed BOOLEAN NOT NULL DEFAULT FALSE,
+    is_failed BOOLEAN NOT NULL DEFAULT FALSE,
+    error_message TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP NULL DEFAULT NULL
@@ -143,6 +165,7 @@ CREATE TABLE chunks (
     image_info TEXT,
     relation_chunks JSON,
     indirect_relation_chunks JSON,
+    generation BIGINT NOT NULL DEFAULT 0,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP NULL DEFAULT NULL
@@ -151,3 +174,138 @@ CREATE TABLE chunks (
 CREATE INDEX idx_chunks_tenant_knowledge ON chunks(tenant_id, knowledge_id);
 CREATE INDEX idx_chunks_parent_id ON chunks(parent_chunk_id);
 CREATE INDEX idx_chunks_chunk_type ON chunks(chunk_type);
+CREATE INDEX idx_chunks_kb_created ON chunks(knowledge_base_id, created_at, id);
+
+CREATE TABLE reindex_jobs (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    knowledge_base_id VARCHAR(36) NOT NULL,
+    from_model_id VARCHAR(64),
+    to_model_id VARCHAR(64) NOT NULL,
+    status VARCHAR(32) NOT NULL DEFAULT 'pending',
+    total_chunks BIGINT NOT NULL DEFAULT 0,
+    processed_chunks BIGINT NOT NULL DEFAULT 0,
+    last_chunk_created_at TIMESTAMP NULL DEFAULT NULL,
+    last_chunk_id VARCHAR(36),
+    error_message TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP NULL DEFAULT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX idx_reindex_jobs_tenant_kb ON reindex_jobs(tenant_id, knowledge_base_id);
+
+CREATE TABLE evaluation_tasks (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    dataset_id VARCHAR(64),
+    start_time TIMESTAMP NULL DEFAULT NULL,
+    end_time TIMESTAMP NULL DEFAULT NULL,
+    status INTEGER NOT NULL DEFAULT 0,
+    err_msg TEXT,
+    total INTEGER NOT NULL DEFAULT 0,
+    finished INTEGER NOT NULL DEFAULT 0,
+    params JSON,
+    metric JSON,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX idx_evaluation_tasks_tenant_id ON evaluation_tasks(tenant_id);
+
+CREATE TABLE evaluation_questions (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    task_id VARCHAR(36) NOT NULL,
+    question_index INTEGER NOT NULL,
+    qid INTEGER NOT NULL DEFAULT 0,
+    question TEXT,
+    input JSON,
+    metric JSON,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX idx_evaluation_questions_task_id ON evaluation_questions(task_id);
+
+CREATE TABLE datasets (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    format VARCHAR(32) NOT NULL,
+    question_count INTEGER NOT NULL DEFAULT 0,
+    passage_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX idx_datasets_tenant_id ON datasets(tenant_id);
+
+CREATE TABLE dataset_qa_pairs (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    dataset_id VARCHAR(36) NOT NULL,
+    qid INTEGER NOT NULL DEFAULT 0,
+    question TEXT,
+    pids JSON,
+    passages JSON,
+    aid INTEGER NOT NULL DEFAULT 0,
+    answer TEXT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX idx_dataset_qa_pairs_dataset_id ON dataset_qa_pairs(dataset_id);
+
+CREATE TABLE graph_entities (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    knowledge_base_id VARCHAR(36) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    title_key VARCHAR(255) NOT NULL,
+    type VARCHAR(255),
+    description TEXT,
+    frequency INTEGER NOT NULL DEFAULT 0,
+    degree INTEGER NOT NULL DEFAULT 0,
+    chunk_ids JSON,
+    knowledge_ids JSON,
+    sources JSON,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX idx_graph_entities_tenant_id ON graph_entities(tenant_id);
+CREATE UNIQUE INDEX idx_graph_entity_title ON graph_entities(knowledge_base_id, title_key);
+
+CREATE TABLE graph_relationships (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    knowledge_base_id VARCHAR(36) NOT NULL,
+    source_id VARCHAR(36) NOT NULL,
+    target_id VARCHAR(36) NOT NULL,
+    description TEXT,
+    strength INTEGER NOT NULL DEFAULT 0,
+    chunk_ids JSON,
+    knowledge_ids JSON,
+    sources JSON,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX idx_graph_relationships_tenant_id ON graph_relationships(tenant_id);
+CREATE UNIQUE INDEX idx_graph_relationship_ends ON graph_relationships(knowledge_base_id, source_id, target_id);
+CREATE INDEX idx_graph_relationships_target_id ON graph_relationships(knowledge_base_id, target_id);
+
+CREATE TABLE usage_records (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    session_id VARCHAR(36),
+    knowledge_id VARCHAR(36),
+    model_id VARCHAR(64),
+    model_name VARCHAR(255),
+    type VARCHAR(32) NOT NULL,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    total_tokens INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX idx_usage_tenant_created ON usage_records(tenant_id, created_at);
+CREATE INDEX idx_usage_records_session_id ON usage_records(session_id);
+CREATE INDEX idx_usage_records_knowledge_id ON usage_records(knowledge_id);
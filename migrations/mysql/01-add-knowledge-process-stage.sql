@@ -0,0 +1,7 @@
+-- 为已有数据库的 knowledges 表补充分阶段处理的进度字段
+-- 新建数据库的 00-init-db.sql 已包含这些字段，只需在升级已有数据库时执行一次
+-- mysql -u root -p WeKnora < migrations/mysql/01-add-knowledge-process-stage.sql
+
+ALTER TABLE knowledges
+    ADD COLUMN process_stage VARCHAR(32) AFTER error_message,
+    ADD COLUMN stage_progress JSON AFTER process_stage;
@@ -16,6 +16,8 @@ CREATE TABLE IF NOT EXISTS tenants (
     business VARCHAR(255) NOT NULL,
     storage_quota BIGINT NOT NULL DEFAULT 10737418240, -- 默认10GB配额(Bytes)
     storage_used BIGINT NOT NULL DEFAULT 0, -- 已使用的存储空间(Bytes)
+    pipeline JSONB, -- 对话流水线
+    rate_limits JSONB, -- 限流与配额
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP WITH TIME ZONE
@@ -94,6 +96,15 @@ CREATE TABLE IF NOT EXISTS knowledges (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     processed_at TIMESTAMP WITH TIME ZONE,
     error_message TEXT,
+    process_stage VARCHAR(32),
+    stage_progress JSONB,
+    generation BIGINT NOT NULL DEFAULT 0,
+    refresh_interval INTEGER NOT NULL DEFAULT 0,
+    next_refresh_at TIMESTAMP WITH TIME ZONE,
+    etag VARCHAR(255),
+    content_hash VARCHAR(64),
+    last_checked_at TIMESTAMP WITH TIME ZONE,
+    last_changed_at TIMESTAMP WITH TIME ZONE,
     deleted_at TIMESTAMP WITH TIME ZONE
 );
 
@@ -102,6 +113,7 @@ CREATE INDEX IF NOT EXISTS idx_knowledges_tenant_id ON knowledges(tenant_id);
 CREATE INDEX IF NOT EXISTS idx_knowledges_base_id ON knowledges(knowledge_base_id);
 CREATE INDEX IF NOT EXISTS idx_knowledges_parse_status ON knowledges(parse_status);
 CREATE INDEX IF NOT EXISTS idx_knowledges_enable_status ON knowledges(enable_status);
+CREATE INDEX IF NOT EXISTS idx_knowledges_next_refresh_at ON knowledges(next_refresh_at);
 
 -- Create session table
 CREATE TABLE IF NOT EXISTS sessions (
@@ -110,18 +122,26 @@ CREATE TABLE IF NOT EXISTS sessions (
     title VARCHAR(255),
     description TEXT,
     knowledge_base_id VARCHAR(36),
+    knowledge_base_ids JSONB NOT NULL DEFAULT '[]',
     max_rounds INTEGER NOT NULL DEFAULT 5,
     enable_rewrite BOOLEAN NOT NULL DEFAULT true,
     fallback_strategy VARCHAR(255) NOT NULL DEFAULT 'fixed',
     fallback_response TEXT NOT NULL DEFAULT '很抱歉，我暂时无法回答这个问题。',
     keyword_threshold FLOAT NOT NULL DEFAULT 0.5,
     vector_threshold FLOAT NOT NULL DEFAULT 0.5,
+    fusion_strategy VARCHAR(32) NOT NULL DEFAULT 'concat',
+    vector_weight FLOAT NOT NULL DEFAULT 0.5,
+    keyword_weight FLOAT NOT NULL DEFAULT 0.5,
     rerank_model_id VARCHAR(64),
     embedding_top_k INTEGER NOT NULL DEFAULT 10,
     rerank_top_k INTEGER NOT NULL DEFAULT 10,
     rerank_threshold FLOAT NOT NULL DEFAULT 0.65,
     summary_model_id VARCHAR(64),
     summary_parameters JSONB NOT NULL DEFAULT '{}',
+    pipeline JSONB,
+    summary TEXT,
+    summary_until TIMESTAMP WITH TIME ZONE,
+    query_expansion JSONB,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP WITH TIME ZONE
@@ -140,6 +160,8 @@ CREATE TABLE IF NOT EXISTS messages (
     content TEXT NOT NULL,
     knowledge_references JSONB NOT NULL DEFAULT '[]',
     is_completed BOOLEAN NOT NULL DEFAULT false,
+    is_failed BOOLEAN NOT NULL DEFAULT false, -- 生成失败
+    error_message TEXT, -- 生成失败的原因
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP WITH TIME ZONE
@@ -166,6 +188,7 @@ CREATE TABLE IF NOT EXISTS chunks (
     image_info TEXT,
     relation_chunks JSONB,
     indirect_relation_chunks JSONB,
+    generation BIGINT NOT NULL DEFAULT 0,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP WITH TIME ZONE
@@ -174,6 +197,178 @@ CREATE TABLE IF NOT EXISTS chunks (
 CREATE INDEX IF NOT EXISTS idx_chunks_tenant_kg ON chunks(tenant_id, knowledge_id);
 CREATE INDEX IF NOT EXISTS idx_chunks_parent_id ON chunks(parent_chunk_id);
 CREATE INDEX IF NOT EXISTS idx_chunks_chunk_type ON chunks(chunk_type);
+CREATE INDEX IF NOT EXISTS idx_chunks_kb_created ON chunks(knowledge_base_id, created_at, id);
+
+-- Create reindex_jobs table
+CREATE TABLE IF NOT EXISTS reindex_jobs (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    knowledge_base_id VARCHAR(36) NOT NULL,
+    from_model_id VARCHAR(64),
+    to_model_id VARCHAR(64) NOT NULL,
+    status VARCHAR(32) NOT NULL DEFAULT 'pending',
+    total_chunks BIGINT NOT NULL DEFAULT 0,
+    processed_chunks BIGINT NOT NULL DEFAULT 0,
+    last_chunk_created_at TIMESTAMP WITH TIME ZONE,
+    last_chunk_id VARCHAR(36),
+    error_message TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_reindex_jobs_tenant_kb ON reindex_jobs(tenant_id, knowledge_base_id);
+
+-- Create evaluation_tasks table
+CREATE TABLE IF NOT EXISTS evaluation_tasks (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    dataset_id VARCHAR(64),
+    start_time TIMESTAMP WITH TIME ZONE,
+    end_time TIMESTAMP WITH TIME ZONE,
+    status INTEGER NOT NULL DEFAULT 0,
+    err_msg TEXT,
+    total INTEGER NOT NULL DEFAULT 0,
+    finished INTEGER NOT NULL DEFAULT 0,
+    params JSON,
+    metric JSON,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_evaluation_tasks_tenant_id ON evaluation_tasks(tenant_id);
+
+-- Create evaluation_questions table
+CREATE TABLE IF NOT EXISTS evaluation_questions (
+    id BIGSERIAL PRIMARY KEY,
+    task_id VARCHAR(36) NOT NULL,
+    question_index INTEGER NOT NULL,
+    qid INTEGER NOT NULL DEFAULT 0,
+    question TEXT,
+    input JSON,
+    metric JSON,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_evaluation_questions_task_id ON evaluation_questions(task_id);
+
+-- Create datasets table
+CREATE TABLE IF NOT EXISTS datasets (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    format VARCHAR(32) NOT NULL,
+    question_count INTEGER NOT NULL DEFAULT 0,
+    passage_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_datasets_tenant_id ON datasets(tenant_id);
+
+-- Create dataset_qa_pairs table
+CREATE TABLE IF NOT EXISTS dataset_qa_pairs (
+    id BIGSERIAL PRIMARY KEY,
+    dataset_id VARCHAR(36) NOT NULL,
+    qid INTEGER NOT NULL DEFAULT 0,
+    question TEXT,
+    pids JSON,
+    passages JSON,
+    aid INTEGER NOT NULL DEFAULT 0,
+    answer TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_dataset_qa_pairs_dataset_id ON dataset_qa_pairs(dataset_id);
+
+-- Create graph_entities table
+CREATE TABLE IF NOT EXISTS graph_entities (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    knowledge_base_id VARCHAR(36) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    title_key VARCHAR(255) NOT NULL,
+    type VARCHAR(255),
+    description TEXT,
+    frequency INTEGER NOT NULL DEFAULT 0,
+    degree INTEGER NOT NULL DEFAULT 0,
+    chunk_ids JSONB,
+    knowledge_ids JSONB,
+    sources JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_graph_entities_tenant_id ON graph_entities(tenant_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_graph_entity_title ON graph_entities(knowledge_base_id, title_key);
+
+-- Create graph_relationships table
+CREATE TABLE IF NOT EXISTS graph_relationships (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    knowledge_base_id VARCHAR(36) NOT NULL,
+    source_id VARCHAR(36) NOT NULL,
+    target_id VARCHAR(36) NOT NULL,
+    description TEXT,
+    strength INTEGER NOT NULL DEFAULT 0,
+    chunk_ids JSONB,
+    knowledge_ids JSONB,
+    sources JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_graph_relationships_tenant_id ON graph_relationships(tenant_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_graph_relationship_ends ON graph_relationships(knowledge_base_id, source_id, target_id);
+CREATE INDEX IF NOT EXISTS idx_graph_relationships_target_id ON graph_relationships(knowledge_base_id, target_id);
+
+-- Create usage_records table
+CREATE TABLE IF NOT EXISTS usage_records (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    session_id VARCHAR(36),
+    knowledge_id VARCHAR(36),
+    model_id VARCHAR(64),
+    model_name VARCHAR(255),
+    type VARCHAR(32) NOT NULL,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    total_tokens INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_tenant_created ON usage_records(tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_usage_records_session_id ON usage_records(session_id);
+CREATE INDEX IF NOT EXISTS idx_usage_records_knowledge_id ON usage_records(knowledge_id);
+
+-- Create graph_nodes table
+CREATE TABLE IF NOT EXISTS graph_nodes (
+    id BIGSERIAL PRIMARY KEY,
+    knowledge_base_id VARCHAR(36) NOT NULL,
+    knowledge_id VARCHAR(36) NOT NULL,
+    name TEXT NOT NULL,
+    chunks JSONB,
+    attributes JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_graph_nodes_name ON graph_nodes(knowledge_base_id, knowledge_id, name);
+
+-- Create graph_edges table
+CREATE TABLE IF NOT EXISTS graph_edges (
+    id BIGSERIAL PRIMARY KEY,
+    knowledge_base_id VARCHAR(36) NOT NULL,
+    knowledge_id VARCHAR(36) NOT NULL,
+    source_id BIGINT NOT NULL,
+    target_id BIGINT NOT NULL,
+    type VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_graph_edges_ends ON graph_edges(source_id, target_id, type);
+CREATE INDEX IF NOT EXISTS idx_graph_edges_target_id ON graph_edges(target_id);
+CREATE INDEX IF NOT EXISTS idx_graph_edges_namespace ON graph_edges(knowledge_base_id, knowledge_id);
 
 CREATE TABLE IF NOT EXISTS embeddings (
     id SERIAL PRIMARY KEY,
@@ -0,0 +1,6 @@
+-- 为已有数据库的 knowledges 表补充分阶段处理的进度字段
+-- 新建数据库的 00-init-db.sql 已包含这些字段，本脚本可重复执行
+-- psql -U postgres -h localhost -p 5432 -d WeKnora -f migrations/paradedb/02-add-knowledge-process-stage.sql
+
+ALTER TABLE knowledges ADD COLUMN IF NOT EXISTS process_stage VARCHAR(32);
+ALTER TABLE knowledges ADD COLUMN IF NOT EXISTS stage_progress JSONB;
@@ -40,6 +40,12 @@ except ImportError:
 logger = logging.getLogger(__name__)
 logger.setLevel(logging.INFO)
 
+# Markdown ATX headings and single line HTML headings
+HEADING_PATTERN = re.compile(
+    r"^(?:(#{1,6})[ \t]+(.*?)[ \t#]*|<h([1-6])\b[^>]*>(.*?)</h\3>)[ \t]*$",
+    re.MULTILINE | re.IGNORECASE,
+)
+
 
 @dataclass
 class Chunk:
@@ -626,7 +632,10 @@ class BaseParser(ABC):
             image_map = {}
         logger.info(f"Extracted {len(text)} characters of text from {self.file_name}")
         logger.info(f"Beginning chunking process for text")
-        chunks = self.chunk_text(text)
+        if self.chunking_config and self.chunking_config.chunking_strategy == "heading":
+            chunks = self.chunk_text_by_heading(text)
+        else:
+            chunks = self.chunk_text(text)
         logger.info(f"Created {len(chunks)} chunks from document")
 
         # Limit the number of returned chunks
@@ -918,6 +927,85 @@ class BaseParser(ABC):
         logger.info(f"Chunking complete, created {len(chunks)} chunks from text")
         return chunks
 
+    def _find_headings(self, text: str) -> List[Tuple[int, int, str]]:
+        """Find the Markdown and HTML headings of the text, headings in code blocks are ignored
+
+        Args:
+            text: Text content
+
+        Returns:
+            List of (start position, level, title) of the headings
+        """
+        code_ranges = [
+            (match.start(), match.end())
+            for match in re.finditer(r"```[\s\S]*?```", text)
+        ]
+        headings = []
+        for match in HEADING_PATTERN.finditer(text):
+            if any(start <= match.start() < end for start, end in code_ranges):
+                continue
+            if match.group(1):
+                level, title = len(match.group(1)), match.group(2)
+            else:
+                level, title = int(match.group(3)), re.sub(r"<[^>]+>", "", match.group(4))
+            title = title.strip()
+            if title:
+                headings.append((match.start(), level, title))
+        return headings
+
+    def chunk_text_by_heading(self, text: str) -> List[Chunk]:
+        """Chunk text along its headings, keeping the hierarchy of the document
+
+        Every section is chunked on its own so that a chunk never spans two sections,
+        sections larger than the chunk size are split by chunk_text. A chunk is prefixed
+        with the titles of the sections enclosing it that it does not start with itself.
+
+        Args:
+            text: Text content
+
+        Returns:
+            List of text chunks
+        """
+        headings = self._find_headings(text)
+        logger.info(f"Chunking text by heading, found {len(headings)} headings")
+        if not headings:
+            return self.chunk_text(text)
+
+        # Sections as (start, end, enclosing headings, own heading)
+        sections = []
+        if headings[0][0] > 0:
+            sections.append((0, headings[0][0], [], None))
+        stack = []
+        for i, (start, level, title) in enumerate(headings):
+            end = headings[i + 1][0] if i + 1 < len(headings) else len(text)
+            while stack and stack[-1][0] >= level:
+                stack.pop()
+            sections.append((start, end, list(stack), (level, title)))
+            stack.append((level, title))
+
+        chunks = []
+        for start, end, parents, heading in sections:
+            section = text[start:end]
+            body = section.split("\n", 1)[1] if heading and "\n" in section else section
+            if heading and (section == body or not body.strip()):
+                # A heading without content only shows up in the titles of its subsections
+                continue
+            if not section.strip():
+                continue
+            for i, chunk in enumerate(self.chunk_text(section)):
+                path = parents if i == 0 or heading is None else parents + [heading]
+                prefix = "".join(f"{'#' * level} {title}\n" for level, title in path)
+                chunks.append(
+                    Chunk(
+                        seq=len(chunks),
+                        content=prefix + chunk.content,
+                        start=start + chunk.start,
+                        end=start + chunk.end,
+                    )
+                )
+        logger.info(f"Chunking by heading complete, created {len(chunks)} chunks")
+        return chunks
+
     def extract_images_from_chunk(self, chunk: Chunk) -> List[Dict[str, str]]:
         """Extract image information from a chunk
 
@@ -18,4 +18,5 @@ class ChunkingConfig:
     )
     storage_config: dict = None  # Preferred field name going forward
     vlm_config: dict = None  # VLM configuration for image captioning
+    chunking_strategy: str = "recursive"  # "recursive" or "heading" (split at Markdown/HTML headings)
 
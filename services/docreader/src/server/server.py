@@ -118,10 +118,11 @@ class DocReaderServicer(docreader_pb2_grpc.DocReaderServicer):
                 chunk_overlap = request.read_config.chunk_overlap or 50
                 separators = request.read_config.separators or ["\n\n", "\n", "。"]
                 enable_multimodal = request.read_config.enable_multimodal or False
+                chunking_strategy = request.read_config.chunking_strategy or "recursive"
 
                 logger.info(
                     f"Using chunking config: size={chunk_size}, overlap={chunk_overlap}, "
-                    f"multimodal={enable_multimodal}"
+                    f"multimodal={enable_multimodal}, strategy={chunking_strategy}"
                 )
 
                 # Get Storage and VLM config from request
@@ -158,6 +159,7 @@ class DocReaderServicer(docreader_pb2_grpc.DocReaderServicer):
                     enable_multimodal=enable_multimodal,
                     storage_config=storage_config,
                     vlm_config=vlm_config,
+                    chunking_strategy=chunking_strategy,
                 )
 
                 # Parse file
@@ -211,10 +213,11 @@ class DocReaderServicer(docreader_pb2_grpc.DocReaderServicer):
                 chunk_overlap = request.read_config.chunk_overlap or 50
                 separators = request.read_config.separators or ["\n\n", "\n", "。"]
                 enable_multimodal = request.read_config.enable_multimodal or False
+                chunking_strategy = request.read_config.chunking_strategy or "recursive"
 
                 logger.info(
                     f"Using chunking config: size={chunk_size}, overlap={chunk_overlap}, "
-                    f"multimodal={enable_multimodal}"
+                    f"multimodal={enable_multimodal}, strategy={chunking_strategy}"
                 )
 
                 # Get Storage and VLM config from request
@@ -250,6 +253,7 @@ class DocReaderServicer(docreader_pb2_grpc.DocReaderServicer):
                     enable_multimodal=enable_multimodal,
                     storage_config=storage_config,
                     vlm_config=vlm_config,
+                    chunking_strategy=chunking_strategy,
                 )
 
                 # Parse URL